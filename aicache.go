@@ -1,19 +1,54 @@
 package main
 
 import (
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"path/filepath"
 	"sync"
 	"time"
+
+	"DealDone/cache"
+)
+
+// defaultPersistentCacheTTL is how long responses are kept on disk. Keys
+// change with the content, model and prompts, so entries only go stale
+// when a provider improves.
+const defaultPersistentCacheTTL = 30 * 24 * time.Hour
+
+// Bounds of the persistent AI response cache
+const (
+	defaultAICacheMaxBytes   = 512 << 20
+	defaultAICacheMaxEntries = 50000
 )
 
-// AICache provides caching for AI responses
+// aiCachePath returns where AI responses are persisted under the DealDone
+// root
+func aiCachePath(root string) string {
+	return filepath.Join(root, ".dealdone", "ai_cache")
+}
+
+// promptVersionCacheKey records which prompt version the persistent store
+// was filled under
+const promptVersionCacheKey = "dealdone:prompt-version"
+
+// AICache provides caching for AI responses: recent responses in memory,
+// backed by an optional persistent store that survives restarts
 type AICache struct {
-	mu      sync.RWMutex
-	items   map[string]*cacheItem
-	ttl     time.Duration
-	maxSize int
+	mu       sync.RWMutex
+	items    map[string]*cacheItem
+	ttl      time.Duration
+	maxSize  int
+	store    cache.Store
+	storeTTL time.Duration
+	scope    aiCacheScope
+}
+
+// aiCacheScope identifies which provider, model and prompts produce the
+// responses being cached
+type aiCacheScope struct {
+	provider      string
+	model         string
+	promptVersion string
 }
 
 // cacheItem represents a cached item
@@ -26,30 +61,108 @@ type cacheItem struct {
 
 // NewAICache creates a new AI cache
 func NewAICache(ttl time.Duration) *AICache {
-	cache := &AICache{
-		items:   make(map[string]*cacheItem),
-		ttl:     ttl,
-		maxSize: 1000, // Default max size
+	ac := &AICache{
+		items:    make(map[string]*cacheItem),
+		ttl:      ttl,
+		maxSize:  1000, // Default max size
+		storeTTL: defaultPersistentCacheTTL,
 	}
 
 	// Start cleanup goroutine
-	go cache.cleanupExpired()
+	go ac.cleanupExpired()
 
-	return cache
+	return ac
 }
 
 // GenerateKey creates a cache key from operation, content, and metadata
+// within the current provider, model and prompt version
 func (ac *AICache) GenerateKey(operation string, content string, metadata map[string]interface{}) string {
-	h := sha256.New()
-	h.Write([]byte(operation))
-	h.Write([]byte(content))
+	ac.mu.RLock()
+	scope := ac.scope
+	ac.mu.RUnlock()
+
+	return cache.Key(cache.KeyParts{
+		Operation:     operation,
+		Provider:      scope.provider,
+		Model:         scope.model,
+		PromptVersion: scope.promptVersion,
+		Content:       content,
+		Params:        metadata,
+	})
+}
+
+// SetScope sets the provider, model and prompt version that later keys are
+// generated for. A new prompt version invalidates every cached response.
+func (ac *AICache) SetScope(provider AIProvider, model, promptVersion string) {
+	ac.mu.Lock()
+	promptsChanged := ac.scope.promptVersion != promptVersion
+	ac.scope = aiCacheScope{provider: string(provider), model: model, promptVersion: promptVersion}
+	if promptsChanged {
+		ac.items = make(map[string]*cacheItem)
+	}
+	ac.mu.Unlock()
+
+	ac.syncPromptVersion()
+}
+
+// SetStore attaches a persistent store behind the in-memory cache
+func (ac *AICache) SetStore(store cache.Store) {
+	ac.mu.Lock()
+	ac.store = store
+	ac.mu.Unlock()
+
+	ac.syncPromptVersion()
+}
+
+// syncPromptVersion clears the persistent store when it was filled under
+// different prompts, so outdated responses do not take up space
+func (ac *AICache) syncPromptVersion() {
+	ac.mu.RLock()
+	store, promptVersion := ac.store, ac.scope.promptVersion
+	ac.mu.RUnlock()
+	if store == nil || promptVersion == "" {
+		return
+	}
+
+	if recorded, ok := store.Get(promptVersionCacheKey); ok && string(recorded) == promptVersion {
+		return
+	} else if ok {
+		if err := store.Clear(); err != nil {
+			fmt.Printf("Warning: Failed to clear AI cache after prompt change: %v\n", err)
+		}
+	}
+	if err := store.Set(promptVersionCacheKey, []byte(promptVersion), 0); err != nil {
+		fmt.Printf("Warning: Failed to record AI cache prompt version: %v\n", err)
+	}
+}
+
+// cachedValue returns a cached response of type T, checking memory first
+// and then the persistent store
+func cachedValue[T any](ac *AICache, key string) (*T, bool) {
+	if cached := ac.Get(key); cached != nil {
+		if result, ok := cached.(*T); ok {
+			return result, true
+		}
+	}
 
-	if metadata != nil {
-		metaBytes, _ := json.Marshal(metadata)
-		h.Write(metaBytes)
+	ac.mu.RLock()
+	store := ac.store
+	ac.mu.RUnlock()
+	if store == nil {
+		return nil, false
 	}
 
-	return hex.EncodeToString(h.Sum(nil))
+	data, ok := store.Get(key)
+	if !ok {
+		return nil, false
+	}
+	result := new(T)
+	if err := json.Unmarshal(data, result); err != nil {
+		store.Delete(key)
+		return nil, false
+	}
+	ac.SetTransient(key, result)
+	return result, true
 }
 
 // Get retrieves an item from cache
@@ -77,8 +190,29 @@ func (ac *AICache) Get(key string) interface{} {
 	return item.value
 }
 
-// Set stores an item in cache
+// Set stores an item in cache and in the persistent store
 func (ac *AICache) Set(key string, value interface{}) {
+	ac.SetTransient(key, value)
+
+	ac.mu.RLock()
+	store, ttl := ac.store, ac.storeTTL
+	ac.mu.RUnlock()
+	if store == nil {
+		return
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
+	}
+	if err := store.Set(key, data, ttl); err != nil {
+		fmt.Printf("Warning: Failed to persist AI response: %v\n", err)
+	}
+}
+
+// SetTransient stores an item in memory only, for responses that should
+// not outlive the session
+func (ac *AICache) SetTransient(key string, value interface{}) {
 	ac.mu.Lock()
 	defer ac.mu.Unlock()
 
@@ -102,11 +236,21 @@ func (ac *AICache) Delete(key string) {
 	ac.mu.Unlock()
 }
 
-// Clear removes all items from cache
-func (ac *AICache) Clear() {
+// Clear removes all items from cache, including the persistent store
+func (ac *AICache) Clear() error {
 	ac.mu.Lock()
 	ac.items = make(map[string]*cacheItem)
+	store := ac.store
 	ac.mu.Unlock()
+
+	if store == nil {
+		return nil
+	}
+	if err := store.Clear(); err != nil {
+		return err
+	}
+	ac.syncPromptVersion()
+	return nil
 }
 
 // GetStats returns cache statistics
@@ -119,12 +263,16 @@ func (ac *AICache) GetStats() map[string]interface{} {
 		totalHits += item.hits
 	}
 
-	return map[string]interface{}{
+	stats := map[string]interface{}{
 		"size":      len(ac.items),
 		"maxSize":   ac.maxSize,
 		"totalHits": totalHits,
 		"ttl":       ac.ttl.String(),
 	}
+	if ac.store != nil {
+		stats["persistent"] = ac.store.Stats()
+	}
+	return stats
 }
 
 // evictLRU removes the least recently used item
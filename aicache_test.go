@@ -3,6 +3,8 @@ package main
 import (
 	"testing"
 	"time"
+
+	"DealDone/cache"
 )
 
 func TestAICache(t *testing.T) {
@@ -140,3 +142,83 @@ func TestAICache(t *testing.T) {
 		}
 	})
 }
+
+func TestAICache_PersistentStore(t *testing.T) {
+	dir := t.TempDir()
+	store, err := cache.NewDiskStore(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to open store: %v", err)
+	}
+
+	first := NewAICache(time.Minute)
+	first.SetScope(ProviderOpenAI, "gpt-4", "1-abc")
+	first.SetStore(store)
+	key := first.GenerateKey("classify", "Non-disclosure agreement", nil)
+	first.Set(key, &AIClassificationResult{DocumentType: "legal", Confidence: 0.9})
+
+	// A new process reopens the store and finds the response
+	reopened, err := cache.NewDiskStore(dir, 0, 0)
+	if err != nil {
+		t.Fatalf("Failed to reopen store: %v", err)
+	}
+	second := NewAICache(time.Minute)
+	second.SetScope(ProviderOpenAI, "gpt-4", "1-abc")
+	second.SetStore(reopened)
+
+	if second.GenerateKey("classify", "Non-disclosure agreement", nil) != key {
+		t.Fatal("Expected the same key across instances")
+	}
+	result, ok := cachedValue[AIClassificationResult](second, key)
+	if !ok {
+		t.Fatal("Expected persisted response to be found")
+	}
+	if result.DocumentType != "legal" {
+		t.Errorf("Expected document type 'legal', got %s", result.DocumentType)
+	}
+	if second.GetStats()["size"].(int) != 1 {
+		t.Error("Expected persisted response to be promoted to memory")
+	}
+	if _, ok := second.GetStats()["persistent"].(cache.Stats); !ok {
+		t.Error("Expected persistent store statistics")
+	}
+
+	// Responses are scoped to the provider and model
+	second.SetScope(ProviderClaude, "claude-3", "1-abc")
+	if second.GenerateKey("classify", "Non-disclosure agreement", nil) == key {
+		t.Error("Expected a different key for a different provider")
+	}
+	if reopened.Stats().Entries != 2 {
+		t.Errorf("Expected the response and prompt version to remain, got %d entries", reopened.Stats().Entries)
+	}
+
+	// New prompts invalidate the store
+	second.SetScope(ProviderOpenAI, "gpt-4", "1-def")
+	if _, ok := cachedValue[AIClassificationResult](second, key); ok {
+		t.Error("Expected prompt change to invalidate cached responses")
+	}
+	if reopened.Stats().Entries != 1 {
+		t.Errorf("Expected only the prompt version to remain, got %d entries", reopened.Stats().Entries)
+	}
+}
+
+func TestAICache_SetTransient(t *testing.T) {
+	store := cache.NewMemoryStore(0, 0)
+	ac := NewAICache(time.Minute)
+	ac.SetStore(store)
+
+	ac.SetTransient("fallback", &AIClassificationResult{DocumentType: "general"})
+	if _, ok := cachedValue[AIClassificationResult](ac, "fallback"); !ok {
+		t.Error("Expected transient response in memory")
+	}
+	if _, ok := store.Get("fallback"); ok {
+		t.Error("Expected transient response not to be persisted")
+	}
+
+	ac.Set("primary", &AIClassificationResult{DocumentType: "legal"})
+	if err := ac.Clear(); err != nil {
+		t.Fatalf("Clear failed: %v", err)
+	}
+	if _, ok := cachedValue[AIClassificationResult](ac, "primary"); ok {
+		t.Error("Expected Clear to remove persisted responses")
+	}
+}
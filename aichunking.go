@@ -0,0 +1,760 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+const (
+	// DefaultChunkTokens keeps each chunk inside the smallest provider prompt
+	// budget, which truncates content at 15,000 characters
+	DefaultChunkTokens = 3000
+	// DefaultChunkOverlapTokens repeats the end of each chunk at the start of
+	// the next so values split across a boundary are still seen whole
+	DefaultChunkOverlapTokens = 150
+
+	charsPerToken       = 4
+	maxConcurrentChunks = 4
+)
+
+// DocumentChunk is one piece of a long document sent to a provider on its own
+type DocumentChunk struct {
+	Index     int    `json:"index"`
+	Text      string `json:"text"`
+	StartPage int    `json:"startPage,omitempty"` // 0 when the text has no page breaks
+	EndPage   int    `json:"endPage,omitempty"`
+	Section   string `json:"section,omitempty"`
+	Tokens    int    `json:"tokens"`
+}
+
+// FieldProvenance records which chunks of a long document a merged value
+// came from and how disagreements between them were settled
+type FieldProvenance struct {
+	Field          string      `json:"field"`
+	Value          interface{} `json:"value"`
+	Chunks         []int       `json:"chunks"`
+	Pages          []int       `json:"pages,omitempty"`
+	Sections       []string    `json:"sections,omitempty"`
+	Confidence     float64     `json:"confidence"`
+	Resolution     string      `json:"resolution"` // "single", "agreed", "union", "max" or a ConflictResolver strategy
+	RequiresReview bool        `json:"requiresReview,omitempty"`
+	Candidates     int         `json:"candidates"`
+}
+
+// DocumentChunker splits long documents by page, section and token budget
+type DocumentChunker struct {
+	maxTokens     int
+	overlapTokens int
+}
+
+// NewDocumentChunker creates a chunker; zero values use the defaults
+func NewDocumentChunker(maxTokens, overlapTokens int) *DocumentChunker {
+	if maxTokens <= 0 {
+		maxTokens = DefaultChunkTokens
+	}
+	if overlapTokens < 0 || overlapTokens >= maxTokens/2 {
+		overlapTokens = DefaultChunkOverlapTokens
+		if overlapTokens >= maxTokens/2 {
+			overlapTokens = maxTokens / 10
+		}
+	}
+	return &DocumentChunker{maxTokens: maxTokens, overlapTokens: overlapTokens}
+}
+
+// estimateTokens approximates a token count from character length
+func estimateTokens(text string) int {
+	return (len(text) + charsPerToken - 1) / charsPerToken
+}
+
+// chunkUnit is a paragraph-sized piece of a page used to pack chunks
+type chunkUnit struct {
+	text         string
+	page         int
+	section      string
+	startSection bool
+}
+
+var numberedHeadingPattern = regexp.MustCompile(`^(\d+(\.\d+)*\.?|[IVXLC]+\.|(?i:section|article|part|schedule|exhibit|appendix)\s+[\dIVXLCA-Z]+[.:]?)\s+\S`)
+
+// isSectionHeading reports whether a line looks like a heading: markdown
+// headings, numbered headings or short all-caps lines without figures
+func isSectionHeading(line string) bool {
+	line = strings.TrimSpace(line)
+	if line == "" || len(line) > 80 {
+		return false
+	}
+	if strings.HasPrefix(line, "#") {
+		return true
+	}
+	if strings.HasSuffix(line, ".") || strings.HasSuffix(line, ",") || strings.HasSuffix(line, ";") {
+		return false
+	}
+	if numberedHeadingPattern.MatchString(line) && len(strings.Fields(line)) <= 10 {
+		return true
+	}
+
+	// All-caps lines with figures are table rows such as "EBITDA: 40"
+	letters := 0
+	for _, r := range line {
+		if unicode.IsDigit(r) || unicode.IsLower(r) {
+			return false
+		}
+		if unicode.IsLetter(r) {
+			letters++
+		}
+	}
+	return letters >= 3
+}
+
+// Split divides content into chunks of at most the token budget. Form feeds
+// mark page breaks; chunks prefer to end at section headings and never split
+// a paragraph unless it alone exceeds the budget.
+func (dc *DocumentChunker) Split(content string) []DocumentChunk {
+	pages := strings.Split(content, "\f")
+	paged := len(pages) > 1
+
+	if estimateTokens(content) <= dc.maxTokens {
+		chunk := DocumentChunk{Text: content, Tokens: estimateTokens(content)}
+		if paged {
+			chunk.Text = strings.Join(pages, "\n\n")
+			chunk.StartPage, chunk.EndPage = 1, len(pages)
+		}
+		return []DocumentChunk{chunk}
+	}
+
+	maxChars := dc.maxTokens * charsPerToken
+	units := make([]chunkUnit, 0)
+	section := ""
+	for i, page := range pages {
+		pageNumber := 0
+		if paged {
+			pageNumber = i + 1
+		}
+		for _, paragraph := range splitParagraphs(page) {
+			firstLine := strings.SplitN(paragraph, "\n", 2)[0]
+			startSection := isSectionHeading(firstLine)
+			if startSection {
+				section = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(firstLine), "#"))
+			}
+			for j, piece := range splitToLength(paragraph, maxChars) {
+				units = append(units, chunkUnit{text: piece, page: pageNumber, section: section, startSection: startSection && j == 0})
+			}
+		}
+	}
+
+	chunks := make([]DocumentChunk, 0)
+	var current []chunkUnit
+	currentLen := 0
+	overlap := ""
+
+	flush := func() {
+		if len(current) == 0 {
+			return
+		}
+		parts := make([]string, 0, len(current)+1)
+		if overlap != "" {
+			parts = append(parts, overlap)
+		}
+		for _, unit := range current {
+			parts = append(parts, unit.text)
+		}
+		text := strings.Join(parts, "\n\n")
+		chunks = append(chunks, DocumentChunk{
+			Index:     len(chunks),
+			Text:      text,
+			StartPage: current[0].page,
+			EndPage:   current[len(current)-1].page,
+			Section:   current[0].section,
+			Tokens:    estimateTokens(text),
+		})
+		overlap = overlapTail(text, dc.overlapTokens*charsPerToken)
+		current = nil
+		currentLen = 0
+	}
+
+	for _, unit := range units {
+		projected := currentLen + len(unit.text) + len(overlap) + 2*(len(current)+1)
+		// Break early at a new section once the chunk is reasonably full
+		if len(current) > 0 && (projected > maxChars || (unit.startSection && currentLen > maxChars/2)) {
+			flush()
+		}
+		if len(current) == 0 && len(overlap)+len(unit.text)+2 > maxChars {
+			overlap = overlapTail(overlap, maxChars-len(unit.text)-2)
+		}
+		current = append(current, unit)
+		currentLen += len(unit.text)
+	}
+	flush()
+
+	return chunks
+}
+
+// splitParagraphs splits text on blank lines, dropping empty paragraphs
+func splitParagraphs(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	paragraphs := make([]string, 0)
+	var current []string
+	for _, line := range strings.Split(text, "\n") {
+		if strings.TrimSpace(line) == "" {
+			if len(current) > 0 {
+				paragraphs = append(paragraphs, strings.Join(current, "\n"))
+				current = nil
+			}
+			continue
+		}
+		current = append(current, line)
+	}
+	if len(current) > 0 {
+		paragraphs = append(paragraphs, strings.Join(current, "\n"))
+	}
+	return paragraphs
+}
+
+// splitToLength breaks text longer than maxChars at line, sentence or word
+// boundaries, falling back to a hard cut
+func splitToLength(text string, maxChars int) []string {
+	pieces := make([]string, 0, 1)
+	for len(text) > maxChars {
+		cut := -1
+		for _, sep := range []string{"\n", ". ", " "} {
+			if i := strings.LastIndex(text[:maxChars], sep); i > maxChars/2 {
+				cut = i + len(sep)
+				break
+			}
+		}
+		if cut <= 0 {
+			cut = maxChars
+			for cut > 0 && !utf8.RuneStart(text[cut]) {
+				cut--
+			}
+		}
+		pieces = append(pieces, strings.TrimSpace(text[:cut]))
+		text = strings.TrimSpace(text[cut:])
+	}
+	if text != "" {
+		pieces = append(pieces, text)
+	}
+	return pieces
+}
+
+// overlapTail returns up to maxChars from the end of text, starting at a word
+// boundary
+func overlapTail(text string, maxChars int) string {
+	if maxChars <= 0 {
+		return ""
+	}
+	if len(text) <= maxChars {
+		return text
+	}
+	start := len(text) - maxChars
+	for start < len(text) && !utf8.RuneStart(text[start]) {
+		start++
+	}
+	tail := text[start:]
+	if i := strings.IndexAny(tail, " \n"); i >= 0 && i < len(tail)-1 {
+		tail = tail[i+1:]
+	}
+	return strings.TrimSpace(tail)
+}
+
+// chunkResult pairs a chunk with the provider result for it
+type chunkResult struct {
+	chunk    DocumentChunk
+	provider AIProvider
+	result   interface{}
+}
+
+// chunkCall runs one provider operation against a chunk
+type chunkCall func(ctx context.Context, provider AIServiceInterface, chunk DocumentChunk) (interface{}, error)
+
+// mapChunks runs call over every chunk with provider fallback and bounded
+// concurrency. Chunks that fail on every provider are reported as warnings;
+// it errors only when no chunk succeeds.
+func (as *AIService) mapChunks(ctx context.Context, chunks []DocumentChunk, call chunkCall) ([]chunkResult, []string, error) {
+	results := make([]*chunkResult, len(chunks))
+	errs := make([]error, len(chunks))
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, maxConcurrentChunks)
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func(i int, chunk DocumentChunk) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			if err := as.limiter().Wait(ctx); err != nil {
+				errs[i] = fmt.Errorf("rate limit exceeded: %w", err)
+				return
+			}
+
+			for _, provider := range as.providerOrder(ctx) {
+				p, exists := as.provider(provider)
+				if !exists || !p.IsAvailable() {
+					continue
+				}
+				result, err := call(ctx, p, chunk)
+				if err == nil {
+					results[i] = &chunkResult{chunk: chunk, provider: provider, result: result}
+					return
+				}
+				errs[i] = err
+			}
+		}(i, chunk)
+	}
+	wg.Wait()
+
+	succeeded := make([]chunkResult, 0, len(chunks))
+	warnings := make([]string, 0)
+	var lastError error
+	for i, result := range results {
+		if result != nil {
+			succeeded = append(succeeded, *result)
+			continue
+		}
+		lastError = errs[i]
+		warnings = append(warnings, fmt.Sprintf("%s could not be analyzed: %v", describeChunk(chunks[i]), errs[i]))
+	}
+
+	if len(succeeded) == 0 {
+		return nil, warnings, lastError
+	}
+	return succeeded, warnings, nil
+}
+
+// describeChunk names a chunk for warnings
+func describeChunk(chunk DocumentChunk) string {
+	switch {
+	case chunk.StartPage > 0 && chunk.StartPage == chunk.EndPage:
+		return fmt.Sprintf("chunk %d (page %d)", chunk.Index+1, chunk.StartPage)
+	case chunk.StartPage > 0:
+		return fmt.Sprintf("chunk %d (pages %d-%d)", chunk.Index+1, chunk.StartPage, chunk.EndPage)
+	default:
+		return fmt.Sprintf("chunk %d", chunk.Index+1)
+	}
+}
+
+// chunkValue is one chunk's value for a field
+type chunkValue struct {
+	value      interface{}
+	confidence float64
+	chunk      DocumentChunk
+}
+
+// resolveChunkValues merges per-chunk values for a field. Values that agree
+// are combined; disagreements go through the conflict resolver.
+func (as *AIService) resolveChunkValues(ctx context.Context, operation, field, fieldType string, values []chunkValue) (interface{}, FieldProvenance) {
+	provenance := newFieldProvenance(field, values)
+	if len(values) == 0 {
+		return nil, provenance
+	}
+
+	distinct := make(map[string]bool)
+	for _, v := range values {
+		distinct[strings.ToLower(strings.TrimSpace(fmt.Sprintf("%v", v.value)))] = true
+	}
+
+	if len(distinct) == 1 {
+		provenance.Value = values[0].value
+		provenance.Resolution = "agreed"
+		if len(values) == 1 {
+			provenance.Resolution = "single"
+		}
+		for _, v := range values {
+			provenance.Confidence = math.Max(provenance.Confidence, v.confidence)
+		}
+		return values[0].value, provenance
+	}
+
+	conflicting := make([]ConflictingValue, len(values))
+	now := time.Now().Unix()
+	for i, v := range values {
+		conflicting[i] = ConflictingValue{
+			Value:      v.value,
+			Confidence: v.confidence,
+			Source:     describeChunk(v.chunk),
+			Method:     "ai_" + operation,
+			Timestamp:  now,
+		}
+	}
+
+	resolved, err := as.conflictResolver.ResolveConflict(ctx, &ConflictContext{
+		TemplatePath:      "chunked/" + operation,
+		FieldName:         field,
+		FieldType:         fieldType,
+		ConflictingValues: conflicting,
+		Metadata:          map[string]interface{}{"operation": operation, "chunks": provenance.Chunks},
+	})
+	if err != nil {
+		// Keep the most confident value rather than failing the whole merge
+		sort.SliceStable(values, func(i, j int) bool { return values[i].confidence > values[j].confidence })
+		provenance.Value = values[0].value
+		provenance.Confidence = values[0].confidence
+		provenance.Resolution = "highest_confidence"
+		provenance.RequiresReview = true
+		return values[0].value, provenance
+	}
+
+	provenance.Value = resolved.ResolvedValue
+	provenance.Confidence = resolved.FinalConfidence
+	provenance.Resolution = resolved.ResolutionMethod
+	provenance.RequiresReview = resolved.RequiresReview
+	return resolved.ResolvedValue, provenance
+}
+
+// newFieldProvenance collects the chunks, pages and sections behind values
+func newFieldProvenance(field string, values []chunkValue) FieldProvenance {
+	provenance := FieldProvenance{Field: field, Candidates: len(values), Chunks: make([]int, 0, len(values))}
+	pages := make(map[int]bool)
+	sections := make(map[string]bool)
+	for _, v := range values {
+		provenance.Chunks = append(provenance.Chunks, v.chunk.Index)
+		for page := v.chunk.StartPage; page > 0 && page <= v.chunk.EndPage; page++ {
+			pages[page] = true
+		}
+		if v.chunk.Section != "" && !sections[v.chunk.Section] {
+			sections[v.chunk.Section] = true
+			provenance.Sections = append(provenance.Sections, v.chunk.Section)
+		}
+	}
+	sort.Ints(provenance.Chunks)
+	for page := range pages {
+		provenance.Pages = append(provenance.Pages, page)
+	}
+	sort.Ints(provenance.Pages)
+	return provenance
+}
+
+// appendUnique appends items not already present, compared case-insensitively
+func appendUnique(list []string, seen map[string]bool, items ...string) []string {
+	for _, item := range items {
+		key := strings.ToLower(strings.TrimSpace(item))
+		if key == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		list = append(list, item)
+	}
+	return list
+}
+
+// mergeFinancialAnalyses combines per-chunk financial extractions
+func (as *AIService) mergeFinancialAnalyses(ctx context.Context, results []chunkResult, warnings []string) *FinancialAnalysis {
+	merged := &FinancialAnalysis{
+		DataPoints: make(map[string]float64),
+		Warnings:   make([]string, 0),
+		Provenance: make([]FieldProvenance, 0),
+	}
+
+	analyses := make([]*FinancialAnalysis, len(results))
+	for i, r := range results {
+		analyses[i] = r.result.(*FinancialAnalysis)
+	}
+
+	numericFields := []struct {
+		name   string
+		target *float64
+		get    func(*FinancialAnalysis) float64
+	}{
+		{"revenue", &merged.Revenue, func(fa *FinancialAnalysis) float64 { return fa.Revenue }},
+		{"ebitda", &merged.EBITDA, func(fa *FinancialAnalysis) float64 { return fa.EBITDA }},
+		{"netIncome", &merged.NetIncome, func(fa *FinancialAnalysis) float64 { return fa.NetIncome }},
+		{"totalAssets", &merged.TotalAssets, func(fa *FinancialAnalysis) float64 { return fa.TotalAssets }},
+		{"totalLiabilities", &merged.TotalLiabilities, func(fa *FinancialAnalysis) float64 { return fa.TotalLiabilities }},
+		{"cashFlow", &merged.CashFlow, func(fa *FinancialAnalysis) float64 { return fa.CashFlow }},
+		{"grossMargin", &merged.GrossMargin, func(fa *FinancialAnalysis) float64 { return fa.GrossMargin }},
+		{"operatingMargin", &merged.OperatingMargin, func(fa *FinancialAnalysis) float64 { return fa.OperatingMargin }},
+	}
+
+	for _, field := range numericFields {
+		values := make([]chunkValue, 0)
+		for i, fa := range analyses {
+			if v := field.get(fa); v != 0 {
+				values = append(values, chunkValue{value: v, confidence: fa.Confidence, chunk: results[i].chunk})
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+		value, provenance := as.resolveChunkValues(ctx, "financial", field.name, "number", values)
+		*field.target = toFloat64(value)
+		merged.Provenance = append(merged.Provenance, provenance)
+	}
+
+	for _, field := range []struct {
+		name   string
+		target *string
+		get    func(*FinancialAnalysis) string
+	}{
+		{"period", &merged.Period, func(fa *FinancialAnalysis) string { return fa.Period }},
+		{"currency", &merged.Currency, func(fa *FinancialAnalysis) string { return fa.Currency }},
+	} {
+		values := make([]chunkValue, 0)
+		for i, fa := range analyses {
+			if v := strings.TrimSpace(field.get(fa)); v != "" {
+				values = append(values, chunkValue{value: v, confidence: fa.Confidence, chunk: results[i].chunk})
+			}
+		}
+		if len(values) == 0 {
+			continue
+		}
+		value, provenance := as.resolveChunkValues(ctx, "financial", field.name, "string", values)
+		*field.target = fmt.Sprintf("%v", value)
+		merged.Provenance = append(merged.Provenance, provenance)
+	}
+
+	dataPoints := make(map[string][]chunkValue)
+	for i, fa := range analyses {
+		for key, v := range fa.DataPoints {
+			dataPoints[key] = append(dataPoints[key], chunkValue{value: v, confidence: fa.Confidence, chunk: results[i].chunk})
+		}
+	}
+	keys := make([]string, 0, len(dataPoints))
+	for key := range dataPoints {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, provenance := as.resolveChunkValues(ctx, "financial", "dataPoints."+key, "number", dataPoints[key])
+		merged.DataPoints[key] = toFloat64(value)
+		merged.Provenance = append(merged.Provenance, provenance)
+	}
+
+	seenLineItems := make(map[string]bool)
+	seenWarnings := make(map[string]bool)
+	totalConfidence := 0.0
+	for _, fa := range analyses {
+		totalConfidence += fa.Confidence
+		for _, item := range fa.LineItems {
+			key := fmt.Sprintf("%s|%s|%s|%g", strings.ToLower(item.Canonical), strings.ToLower(item.LineItem), item.Period.Label, item.Value)
+			if !seenLineItems[key] {
+				seenLineItems[key] = true
+				merged.LineItems = append(merged.LineItems, item)
+			}
+		}
+		merged.Warnings = appendUnique(merged.Warnings, seenWarnings, fa.Warnings...)
+	}
+	merged.Warnings = appendUnique(merged.Warnings, seenWarnings, warnings...)
+	merged.Confidence = totalConfidence / float64(len(analyses))
+
+	return merged
+}
+
+// mergeRiskAnalyses combines per-chunk risk assessments. The overall score is
+// the worst chunk's, since a risk anywhere in the document is a document risk.
+func mergeRiskAnalyses(results []chunkResult, warnings []string) *RiskAnalysis {
+	merged := &RiskAnalysis{
+		RiskCategories:  make([]RiskItem, 0),
+		Recommendations: make([]string, 0),
+		CriticalIssues:  make([]string, 0),
+		Provenance:      make([]FieldProvenance, 0),
+	}
+
+	riskIndex := make(map[string]int)
+	riskSources := make(map[string][]chunkValue)
+	seenRecommendations := make(map[string]bool)
+	seenIssues := make(map[string]bool)
+	scoreSources := make([]chunkValue, 0)
+	totalConfidence := 0.0
+
+	for _, r := range results {
+		ra := r.result.(*RiskAnalysis)
+		totalConfidence += ra.Confidence
+
+		if ra.OverallRiskScore > merged.OverallRiskScore {
+			merged.OverallRiskScore = ra.OverallRiskScore
+			scoreSources = scoreSources[:0]
+		}
+		if ra.OverallRiskScore == merged.OverallRiskScore {
+			scoreSources = append(scoreSources, chunkValue{value: ra.OverallRiskScore, confidence: ra.Confidence, chunk: r.chunk})
+		}
+
+		for _, risk := range ra.RiskCategories {
+			key := strings.ToLower(strings.TrimSpace(risk.Category)) + "|" + strings.ToLower(strings.TrimSpace(risk.Description))
+			riskSources[key] = append(riskSources[key], chunkValue{value: risk.Description, confidence: risk.Score, chunk: r.chunk})
+			if i, exists := riskIndex[key]; exists {
+				if risk.Score > merged.RiskCategories[i].Score {
+					merged.RiskCategories[i] = risk
+				}
+				continue
+			}
+			riskIndex[key] = len(merged.RiskCategories)
+			merged.RiskCategories = append(merged.RiskCategories, risk)
+		}
+
+		merged.Recommendations = appendUnique(merged.Recommendations, seenRecommendations, ra.Recommendations...)
+		merged.CriticalIssues = appendUnique(merged.CriticalIssues, seenIssues, ra.CriticalIssues...)
+	}
+
+	merged.CriticalIssues = appendUnique(merged.CriticalIssues, seenIssues, warnings...)
+	merged.Confidence = totalConfidence / float64(len(results))
+
+	scoreProvenance := newFieldProvenance("overallRiskScore", scoreSources)
+	scoreProvenance.Value = merged.OverallRiskScore
+	scoreProvenance.Resolution = "max"
+	scoreProvenance.Candidates = len(results)
+	merged.Provenance = append(merged.Provenance, scoreProvenance)
+
+	riskProvenance := make([]FieldProvenance, len(merged.RiskCategories))
+	for key, i := range riskIndex {
+		provenance := newFieldProvenance(fmt.Sprintf("riskCategories[%d]", i), riskSources[key])
+		provenance.Value = merged.RiskCategories[i].Description
+		provenance.Confidence = merged.RiskCategories[i].Score
+		provenance.Resolution = "union"
+		riskProvenance[i] = provenance
+	}
+	merged.Provenance = append(merged.Provenance, riskProvenance...)
+
+	return merged
+}
+
+// mergeEntityExtractions combines per-chunk entities, keeping the most
+// confident mention of each and recording the chunks and pages it appeared in
+func mergeEntityExtractions(results []chunkResult) *EntityExtraction {
+	merged := &EntityExtraction{}
+
+	categories := []func(*EntityExtraction) *[]Entity{
+		func(e *EntityExtraction) *[]Entity { return &e.People },
+		func(e *EntityExtraction) *[]Entity { return &e.Organizations },
+		func(e *EntityExtraction) *[]Entity { return &e.Locations },
+		func(e *EntityExtraction) *[]Entity { return &e.Dates },
+		func(e *EntityExtraction) *[]Entity { return &e.MonetaryValues },
+		func(e *EntityExtraction) *[]Entity { return &e.Percentages },
+		func(e *EntityExtraction) *[]Entity { return &e.Products },
+	}
+
+	for _, category := range categories {
+		target := category(merged)
+		*target = make([]Entity, 0)
+		index := make(map[string]int)
+		sources := make(map[string][]chunkValue)
+
+		for _, r := range results {
+			for _, entity := range *category(r.result.(*EntityExtraction)) {
+				key := strings.ToLower(strings.Join(strings.Fields(entity.Text), " "))
+				if key == "" {
+					continue
+				}
+				sources[key] = append(sources[key], chunkValue{value: entity.Text, confidence: entity.Confidence, chunk: r.chunk})
+				if i, exists := index[key]; exists {
+					if entity.Confidence > (*target)[i].Confidence {
+						(*target)[i] = entity
+					}
+					continue
+				}
+				index[key] = len(*target)
+				*target = append(*target, entity)
+			}
+		}
+
+		for key, i := range index {
+			provenance := newFieldProvenance(key, sources[key])
+			metadata := make(map[string]interface{}, len((*target)[i].Metadata)+2)
+			for k, v := range (*target)[i].Metadata {
+				metadata[k] = v
+			}
+			metadata["chunks"] = provenance.Chunks
+			if len(provenance.Pages) > 0 {
+				metadata["pages"] = provenance.Pages
+			}
+			(*target)[i].Metadata = metadata
+		}
+	}
+
+	return merged
+}
+
+// mergeDocumentFieldExtractions combines per-chunk field extractions
+func (as *AIService) mergeDocumentFieldExtractions(ctx context.Context, results []chunkResult, warnings []string) *DocumentFieldExtraction {
+	merged := &DocumentFieldExtraction{
+		Fields:     make(map[string]interface{}),
+		FieldTypes: make(map[string]string),
+		Metadata:   make(map[string]interface{}),
+		Warnings:   make([]string, 0),
+		Provenance: make([]FieldProvenance, 0),
+	}
+
+	fieldValues := make(map[string][]chunkValue)
+	seenWarnings := make(map[string]bool)
+	totalConfidence := 0.0
+	for _, r := range results {
+		extraction := r.result.(*DocumentFieldExtraction)
+		totalConfidence += extraction.Confidence
+		for name, value := range extraction.Fields {
+			if value == nil || fmt.Sprintf("%v", value) == "" {
+				continue
+			}
+			fieldValues[name] = append(fieldValues[name], chunkValue{value: value, confidence: extraction.Confidence, chunk: r.chunk})
+			if fieldType, ok := extraction.FieldTypes[name]; ok && merged.FieldTypes[name] == "" {
+				merged.FieldTypes[name] = fieldType
+			}
+		}
+		for key, value := range extraction.Metadata {
+			if _, exists := merged.Metadata[key]; !exists {
+				merged.Metadata[key] = value
+			}
+		}
+		if merged.Source == "" {
+			merged.Source = extraction.Source
+		}
+		merged.Warnings = appendUnique(merged.Warnings, seenWarnings, extraction.Warnings...)
+	}
+	merged.Warnings = appendUnique(merged.Warnings, seenWarnings, warnings...)
+
+	names := make([]string, 0, len(fieldValues))
+	for name := range fieldValues {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		value, provenance := as.resolveChunkValues(ctx, "extract_fields", name, conflictFieldType(merged.FieldTypes[name]), fieldValues[name])
+		merged.Fields[name] = value
+		merged.Provenance = append(merged.Provenance, provenance)
+	}
+
+	merged.Confidence = totalConfidence / float64(len(results))
+	merged.Metadata["chunks"] = len(results)
+	return merged
+}
+
+// conflictFieldType maps extraction field types onto the types the conflict
+// resolver has strategies for
+func conflictFieldType(fieldType string) string {
+	switch strings.ToLower(fieldType) {
+	case "currency", "number", "numeric", "percentage", "integer", "float":
+		return "number"
+	case "date", "datetime":
+		return "date"
+	case "boolean", "bool":
+		return "boolean"
+	default:
+		return "string"
+	}
+}
+
+// toFloat64 converts a resolved value back to a number
+func toFloat64(value interface{}) float64 {
+	switch v := value.(type) {
+	case float64:
+		return v
+	case float32:
+		return float64(v)
+	case int:
+		return float64(v)
+	case int64:
+		return float64(v)
+	case string:
+		if parsed, ok := parseStructuredNumber(v); ok {
+			return parsed
+		}
+	}
+	return 0
+}
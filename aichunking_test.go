@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// chunkTestProvider answers from markers in each chunk so merges can be
+// checked without a real model
+type chunkTestProvider struct {
+	*DefaultProvider
+	calls int32
+}
+
+var chunkRevenuePattern = regexp.MustCompile(`Revenue: (\d+)`)
+
+func (p *chunkTestProvider) ExtractFinancialData(ctx context.Context, content string) (*FinancialAnalysis, error) {
+	atomic.AddInt32(&p.calls, 1)
+	if strings.Contains(content, "CORRUPT") {
+		return nil, fmt.Errorf("provider rejected chunk")
+	}
+
+	result := &FinancialAnalysis{Confidence: 0.6, DataPoints: map[string]float64{}, Warnings: []string{}}
+	if strings.Contains(content, "audited") {
+		result.Confidence = 0.9
+	}
+	if match := chunkRevenuePattern.FindStringSubmatch(content); match != nil {
+		result.Revenue, _ = strconv.ParseFloat(match[1], 64)
+		result.Currency = "USD"
+	}
+	if strings.Contains(content, "EBITDA: 40") {
+		result.EBITDA = 40
+	}
+	return result, nil
+}
+
+func (p *chunkTestProvider) AnalyzeRisks(ctx context.Context, content string, docType string) (*RiskAnalysis, error) {
+	atomic.AddInt32(&p.calls, 1)
+	result := &RiskAnalysis{Confidence: 0.8, OverallRiskScore: 0.2, Recommendations: []string{"Confirm working capital"}}
+	if strings.Contains(content, "litigation") {
+		result.OverallRiskScore = 0.7
+		result.RiskCategories = []RiskItem{{Category: "legal", Description: "Pending litigation", Severity: "high", Score: 0.7}}
+	}
+	return result, nil
+}
+
+func (p *chunkTestProvider) ExtractEntities(ctx context.Context, content string) (*EntityExtraction, error) {
+	atomic.AddInt32(&p.calls, 1)
+	result := &EntityExtraction{Organizations: []Entity{{Text: "Acme Corp", Type: "organization", Confidence: 0.7}}}
+	if strings.Contains(content, "Globex") {
+		result.Organizations = append(result.Organizations, Entity{Text: "Globex", Type: "organization", Confidence: 0.9})
+	}
+	return result, nil
+}
+
+func (p *chunkTestProvider) ExtractDocumentFields(ctx context.Context, content string, documentType string, templateContext map[string]interface{}) (*DocumentFieldExtraction, error) {
+	atomic.AddInt32(&p.calls, 1)
+	fields := map[string]interface{}{"company_name": "Acme Corp"}
+	if strings.Contains(content, "closing") {
+		fields["closing_date"] = "2024-06-30"
+	}
+	return &DocumentFieldExtraction{
+		Fields:     fields,
+		FieldTypes: map[string]string{"company_name": "text", "closing_date": "date"},
+		Confidence: 0.8,
+	}, nil
+}
+
+func newChunkTestService(t *testing.T, maxTokens int) (*AIService, *chunkTestProvider) {
+	service := NewAIService(&AIConfig{CacheTTL: time.Minute, RateLimit: 6000})
+	provider := &chunkTestProvider{DefaultProvider: NewDefaultProvider()}
+	service.providers = map[AIProvider]AIServiceInterface{ProviderOpenAI: provider}
+	service.fallbackOrder = []AIProvider{ProviderOpenAI}
+	service.chunker = NewDocumentChunker(maxTokens, 10)
+	return service, provider
+}
+
+// fillerPage pads a page with prose so each page becomes its own chunk
+func fillerPage(lines ...string) string {
+	filler := strings.Repeat("The business operates across several regions with stable demand. ", 5)
+	return strings.Join(lines, "\n\n") + "\n\n" + filler
+}
+
+func TestDocumentChunkerSplit(t *testing.T) {
+	chunker := NewDocumentChunker(100, 10)
+
+	short := chunker.Split("Revenue: 100")
+	require.Len(t, short, 1)
+	assert.Equal(t, "Revenue: 100", short[0].Text)
+	assert.Zero(t, short[0].StartPage)
+
+	document := strings.Join([]string{
+		fillerPage("EXECUTIVE SUMMARY", "Acme is a leading supplier."),
+		fillerPage("1. Financial Overview", "Revenue: 100"),
+		fillerPage("Revenue continued to grow."),
+	}, "\f")
+
+	chunks := chunker.Split(document)
+	require.Greater(t, len(chunks), 2)
+	assert.Equal(t, 1, chunks[0].StartPage)
+	assert.Equal(t, "EXECUTIVE SUMMARY", chunks[0].Section)
+	assert.Equal(t, 3, chunks[len(chunks)-1].EndPage)
+
+	sawFinancialSection := false
+	for i, chunk := range chunks {
+		assert.Equal(t, i, chunk.Index)
+		assert.LessOrEqual(t, chunk.Tokens, 100, "chunk %d exceeds the budget", i)
+		assert.NotContains(t, chunk.Text, "\f")
+		if chunk.Section == "1. Financial Overview" {
+			sawFinancialSection = true
+		}
+		if i > 0 {
+			// Each chunk starts with the tail of the previous one
+			previous := chunks[i-1].Text
+			assert.Contains(t, previous[len(previous)-50:], strings.Fields(chunk.Text)[0])
+		}
+	}
+	assert.True(t, sawFinancialSection)
+
+	// Oversized paragraphs are split at word boundaries
+	long := chunker.Split(strings.Repeat("word ", 400))
+	require.Greater(t, len(long), 1)
+	for _, chunk := range long {
+		assert.LessOrEqual(t, chunk.Tokens, 100)
+		assert.NotContains(t, chunk.Text, "wo rd")
+	}
+
+	assert.True(t, isSectionHeading("## Risk Factors"))
+	assert.True(t, isSectionHeading("ARTICLE IV Purchase Price"))
+	assert.False(t, isSectionHeading("Revenue grew 12% in 2023."))
+	assert.False(t, isSectionHeading("EBITDA: 40"))
+}
+
+func TestAIServiceChunkedFinancialExtraction(t *testing.T) {
+	service, provider := newChunkTestService(t, 150)
+	resolver := NewConflictResolver(t.TempDir(), nil)
+	service.SetConflictResolver(resolver)
+
+	document := strings.Join([]string{
+		fillerPage("INCOME STATEMENT", "Revenue: 100 (audited)"),
+		fillerPage("SEGMENT DATA", "Revenue: 100 (audited)", "EBITDA: 40"),
+		fillerPage("MANAGEMENT ESTIMATES", "Revenue: 120"),
+		fillerPage("APPENDIX", "CORRUPT"),
+	}, "\f")
+
+	result, err := service.ExtractFinancialData(context.Background(), document)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, atomic.LoadInt32(&provider.calls), int32(4))
+
+	// Conflicting revenue goes through the resolver, agreeing EBITDA does not
+	provenance := make(map[string]FieldProvenance)
+	for _, p := range result.Provenance {
+		provenance[p.Field] = p
+	}
+	revenue := provenance["revenue"]
+	assert.Equal(t, "numeric_averaging", revenue.Resolution)
+	assert.Equal(t, 3, revenue.Candidates)
+	assert.Equal(t, []int{1, 2, 3}, revenue.Pages)
+	assert.InDelta(t, 105.0, result.Revenue, 0.01)
+	assert.Len(t, resolver.GetConflictHistory("", "chunked/financial", "revenue", 0), 1)
+
+	ebitda := provenance["ebitda"]
+	assert.Equal(t, "single", ebitda.Resolution)
+	assert.Equal(t, 40.0, result.EBITDA)
+	assert.Equal(t, []int{2}, ebitda.Pages)
+	assert.Equal(t, []string{"SEGMENT DATA"}, ebitda.Sections)
+
+	assert.Equal(t, "agreed", provenance["currency"].Resolution)
+	assert.Equal(t, "USD", result.Currency)
+
+	// The failed chunk is reported rather than failing the document
+	require.NotEmpty(t, result.Warnings)
+	assert.Contains(t, result.Warnings[len(result.Warnings)-1], "page 4")
+	assert.Contains(t, result.Warnings[len(result.Warnings)-1], "provider rejected chunk")
+
+	// Short documents still make a single call
+	before := atomic.LoadInt32(&provider.calls)
+	short, err := service.ExtractFinancialData(context.Background(), "Revenue: 50")
+	require.NoError(t, err)
+	assert.Equal(t, before+1, atomic.LoadInt32(&provider.calls))
+	assert.Equal(t, 50.0, short.Revenue)
+	assert.Empty(t, short.Provenance)
+}
+
+func TestAIServiceChunkedMerges(t *testing.T) {
+	service, _ := newChunkTestService(t, 150)
+	document := strings.Join([]string{
+		fillerPage("OVERVIEW", "Acme Corp agreed terms with Globex."),
+		fillerPage("LEGAL", "There is pending litigation.", "The closing is expected mid-year."),
+		fillerPage("OPERATIONS", "Acme Corp runs three plants."),
+	}, "\f")
+
+	risks, err := service.AnalyzeRisks(context.Background(), document, "cim")
+	require.NoError(t, err)
+	assert.Equal(t, 0.7, risks.OverallRiskScore)
+	require.Len(t, risks.RiskCategories, 1)
+	assert.Equal(t, []string{"Confirm working capital"}, risks.Recommendations)
+	assert.Equal(t, "max", risks.Provenance[0].Resolution)
+	assert.Equal(t, []int{2}, risks.Provenance[0].Pages)
+
+	entities, err := service.ExtractEntities(context.Background(), document)
+	require.NoError(t, err)
+	require.Len(t, entities.Organizations, 2)
+	assert.Equal(t, "Acme Corp", entities.Organizations[0].Text)
+	assert.Equal(t, []int{1, 2, 3}, entities.Organizations[0].Metadata["pages"])
+	assert.Equal(t, []int{1}, entities.Organizations[1].Metadata["pages"])
+
+	fields, err := service.ExtractDocumentFields(context.Background(), document, "cim", nil)
+	require.NoError(t, err)
+	assert.Equal(t, "Acme Corp", fields.Fields["company_name"])
+	assert.Equal(t, "2024-06-30", fields.Fields["closing_date"])
+	require.Len(t, fields.Provenance, 2)
+	assert.Equal(t, "closing_date", fields.Provenance[0].Field)
+	assert.Equal(t, []int{2}, fields.Provenance[0].Pages)
+	assert.Equal(t, "agreed", fields.Provenance[1].Resolution)
+}
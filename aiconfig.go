@@ -69,14 +69,10 @@ func (acm *AIConfigManager) createDefaultConfig() *AIConfig {
 			MinConfidenceScore:      0.7,
 			EnableRiskAnalysis:      true,
 			EnableFinancialAnalysis: true,
+			ChunkTokens:             DefaultChunkTokens,
+			ChunkOverlapTokens:      DefaultChunkOverlapTokens,
 		},
-		SecuritySettings: SecuritySettings{
-			RedactPII:         true,
-			AllowedDomains:    []string{},
-			BlockedKeywords:   []string{},
-			MaxRequestsPerDoc: 10,
-			EnableAuditLog:    true,
-		},
+		SecuritySettings: defaultSecuritySettings(),
 	}
 }
 
@@ -96,22 +92,43 @@ type AnalysisSettings struct {
 	MinConfidenceScore      float64 `json:"min_confidence_score"`
 	EnableRiskAnalysis      bool    `json:"enable_risk_analysis"`
 	EnableFinancialAnalysis bool    `json:"enable_financial_analysis"`
+	ChunkTokens             int     `json:"chunk_tokens"`         // Token budget per chunk for long documents
+	ChunkOverlapTokens      int     `json:"chunk_overlap_tokens"` // Tokens repeated between adjacent chunks
 }
 
+// SecuritySettings control what is sent to AI providers; the AI service's
+// outbound policy enforces them
 type SecuritySettings struct {
 	RedactPII         bool     `json:"redact_pii"`
-	AllowedDomains    []string `json:"allowed_domains"`
-	BlockedKeywords   []string `json:"blocked_keywords"`
+	AllowedDomains    []string `json:"allowed_domains"`  // Provider hosts that may be contacted; empty allows all
+	BlockedKeywords   []string `json:"blocked_keywords"` // Content naming one is never sent
 	MaxRequestsPerDoc int      `json:"max_requests_per_doc"`
 	EnableAuditLog    bool     `json:"enable_audit_log"`
 }
 
+// EmbeddingSettings select the embedding model used for correction
+// retrieval. API keys are not kept here: OpenAI embeddings use OpenAIKey and
+// Voyage embeddings read VOYAGE_API_KEY.
+type EmbeddingSettings struct {
+	Provider string `json:"provider,omitempty"` // "local" when empty
+	Model    string `json:"model,omitempty"`
+}
+
+// defaultSecuritySettings redacts PII and audits every request
+func defaultSecuritySettings() SecuritySettings {
+	return SecuritySettings{
+		RedactPII:         true,
+		AllowedDomains:    []string{},
+		BlockedKeywords:   []string{},
+		MaxRequestsPerDoc: 10,
+		EnableAuditLog:    true,
+	}
+}
+
 // Update AIConfig to include new settings
 func (acm *AIConfigManager) enhanceAIConfig() {
-	// This would be called during migration to add new fields
-	acm.mu.Lock()
-	defer acm.mu.Unlock()
-
+	// This would be called during migration to add new fields; the caller
+	// holds the lock
 	if acm.config.PromptSettings.Temperature == 0 {
 		acm.config.PromptSettings = PromptSettings{
 			Temperature: 0.3,
@@ -129,15 +146,13 @@ func (acm *AIConfigManager) enhanceAIConfig() {
 			MinConfidenceScore:      0.7,
 			EnableRiskAnalysis:      true,
 			EnableFinancialAnalysis: true,
+			ChunkTokens:             DefaultChunkTokens,
+			ChunkOverlapTokens:      DefaultChunkOverlapTokens,
 		}
 	}
 
 	if acm.config.SecuritySettings.MaxRequestsPerDoc == 0 {
-		acm.config.SecuritySettings = SecuritySettings{
-			RedactPII:         true,
-			MaxRequestsPerDoc: 10,
-			EnableAuditLog:    true,
-		}
+		acm.config.SecuritySettings = defaultSecuritySettings()
 	}
 }
 
@@ -227,6 +242,31 @@ func (acm *AIConfigManager) applyUpdates(updates map[string]interface{}) error {
 	if partialConfig.RateLimit > 0 {
 		acm.config.RateLimit = partialConfig.RateLimit
 	}
+	if _, ok := updates["local_endpoints"]; ok {
+		endpoints, err := normalizeLocalEndpoints(partialConfig.LocalEndpoints)
+		if err != nil {
+			return err
+		}
+		acm.config.LocalEndpoints = endpoints
+	}
+	if localOnly, ok := updates["local_only"].(bool); ok {
+		acm.config.LocalOnly = localOnly
+	}
+	if update, ok := updates["security_settings"]; ok {
+		// Fields left out of the update keep their current values
+		settings := acm.config.SecuritySettings
+		data, err := json.Marshal(update)
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &settings); err != nil {
+			return fmt.Errorf("invalid security_settings: %w", err)
+		}
+		if settings.MaxRequestsPerDoc < 1 {
+			return fmt.Errorf("security_settings.max_requests_per_doc must be at least 1")
+		}
+		acm.config.SecuritySettings = settings
+	}
 	// ... apply other fields as needed
 
 	return nil
@@ -282,12 +322,95 @@ func (acm *AIConfigManager) SetAPIKey(provider AIProvider, apiKey string) error
 	case ProviderClaude:
 		acm.config.ClaudeKey = apiKey
 	default:
-		return fmt.Errorf("unknown provider: %s", provider)
+		i := acm.localEndpointIndex(provider)
+		if i < 0 {
+			return fmt.Errorf("unknown provider: %s", provider)
+		}
+		acm.config.LocalEndpoints[i].APIKey = apiKey
 	}
 
 	return acm.Save()
 }
 
+// SetLocalEndpoint adds a local OpenAI-compatible endpoint, replacing any
+// endpoint with the same name
+func (acm *AIConfigManager) SetLocalEndpoint(endpoint LocalEndpoint) error {
+	endpoint, err := normalizeLocalEndpoint(endpoint)
+	if err != nil {
+		return err
+	}
+
+	acm.mu.Lock()
+	defer acm.mu.Unlock()
+
+	if i := acm.localEndpointIndex(LocalProviderID(endpoint.Name)); i >= 0 {
+		acm.config.LocalEndpoints[i] = endpoint
+	} else {
+		acm.config.LocalEndpoints = append(acm.config.LocalEndpoints, endpoint)
+	}
+	return acm.Save()
+}
+
+// RemoveLocalEndpoint removes a local endpoint by name
+func (acm *AIConfigManager) RemoveLocalEndpoint(name string) error {
+	acm.mu.Lock()
+	defer acm.mu.Unlock()
+
+	i := acm.localEndpointIndex(LocalProviderID(name))
+	if i < 0 {
+		return fmt.Errorf("local endpoint not found: %s", name)
+	}
+	acm.config.LocalEndpoints = append(acm.config.LocalEndpoints[:i], acm.config.LocalEndpoints[i+1:]...)
+	return acm.Save()
+}
+
+// SetLocalOnly restricts AI processing to local endpoints and the rule-based
+// provider so no content leaves the network
+func (acm *AIConfigManager) SetLocalOnly(localOnly bool) error {
+	acm.mu.Lock()
+	defer acm.mu.Unlock()
+
+	acm.config.LocalOnly = localOnly
+	return acm.Save()
+}
+
+// localEndpointIndex finds a local endpoint by provider id; callers hold the lock
+func (acm *AIConfigManager) localEndpointIndex(provider AIProvider) int {
+	for i, endpoint := range acm.config.LocalEndpoints {
+		if LocalProviderID(endpoint.Name) == provider {
+			return i
+		}
+	}
+	return -1
+}
+
+// normalizeLocalEndpoints validates endpoints and rejects duplicate names
+func normalizeLocalEndpoints(endpoints []LocalEndpoint) ([]LocalEndpoint, error) {
+	normalized := make([]LocalEndpoint, 0, len(endpoints))
+	seen := make(map[string]bool)
+	for _, endpoint := range endpoints {
+		endpoint, err := normalizeLocalEndpoint(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		if seen[endpoint.Name] {
+			return nil, fmt.Errorf("duplicate local endpoint name: %s", endpoint.Name)
+		}
+		seen[endpoint.Name] = true
+		normalized = append(normalized, endpoint)
+	}
+	return normalized, nil
+}
+
+// SetEmbeddings records the embedding provider and model to use at startup
+func (acm *AIConfigManager) SetEmbeddings(provider, model string) error {
+	acm.mu.Lock()
+	defer acm.mu.Unlock()
+
+	acm.config.Embeddings = EmbeddingSettings{Provider: provider, Model: model}
+	return acm.Save()
+}
+
 // SetPreferredProvider sets the preferred AI provider
 func (acm *AIConfigManager) SetPreferredProvider(provider AIProvider) error {
 	acm.mu.Lock()
@@ -309,8 +432,10 @@ func (acm *AIConfigManager) IsProviderConfigured(provider AIProvider) bool {
 		return acm.config.ClaudeKey != ""
 	case ProviderDefault:
 		return true
+	case ProviderLocal:
+		return len(acm.config.LocalEndpoints) > 0
 	default:
-		return false
+		return acm.localEndpointIndex(provider) >= 0
 	}
 }
 
@@ -325,14 +450,29 @@ func (acm *AIConfigManager) GetProviderStatus() map[AIProvider]ProviderStatus {
 	status[ProviderOpenAI] = ProviderStatus{
 		Configured: acm.config.OpenAIKey != "",
 		Model:      acm.config.OpenAIModel,
-		Enabled:    acm.config.EnabledProviders == nil || contains(acm.config.EnabledProviders, string(ProviderOpenAI)),
+		Enabled:    !acm.config.LocalOnly && (acm.config.EnabledProviders == nil || contains(acm.config.EnabledProviders, string(ProviderOpenAI))),
 	}
 
 	// Claude status
 	status[ProviderClaude] = ProviderStatus{
 		Configured: acm.config.ClaudeKey != "",
 		Model:      acm.config.ClaudeModel,
-		Enabled:    acm.config.EnabledProviders == nil || contains(acm.config.EnabledProviders, string(ProviderClaude)),
+		Enabled:    !acm.config.LocalOnly && (acm.config.EnabledProviders == nil || contains(acm.config.EnabledProviders, string(ProviderClaude))),
+	}
+
+	// Local endpoints, each with its own model
+	for _, endpoint := range acm.config.LocalEndpoints {
+		provider := LocalProviderID(endpoint.Name)
+		model := endpoint.Model
+		if model == "" {
+			model = "auto"
+		}
+		status[provider] = ProviderStatus{
+			Configured: true,
+			Model:      model,
+			Enabled:    acm.config.EnabledProviders == nil || contains(acm.config.EnabledProviders, string(provider)) || contains(acm.config.EnabledProviders, string(ProviderLocal)),
+			Endpoint:   endpoint.BaseURL,
+		}
 	}
 
 	// Default provider always available
@@ -350,6 +490,7 @@ type ProviderStatus struct {
 	Configured bool   `json:"configured"`
 	Model      string `json:"model"`
 	Enabled    bool   `json:"enabled"`
+	Endpoint   string `json:"endpoint,omitempty"` // Base URL for local providers
 }
 
 // Export exports configuration (without sensitive data)
@@ -365,6 +506,7 @@ func (acm *AIConfigManager) Export() (map[string]interface{}, error) {
 	export["max_retries"] = acm.config.MaxRetries
 	export["retry_delay"] = acm.config.RetryDelay.String()
 	export["preferred_provider"] = acm.config.PreferredProvider
+	export["local_only"] = acm.config.LocalOnly
 	export["prompt_settings"] = acm.config.PromptSettings
 	export["analysis_settings"] = acm.config.AnalysisSettings
 	export["security_settings"] = acm.config.SecuritySettings
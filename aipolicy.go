@@ -0,0 +1,434 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/url"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ErrAIContentBlocked is returned for provider requests the outbound policy
+// refuses. The rule-based provider still answers them, since it runs
+// in-process.
+var ErrAIContentBlocked = errors.New("AI request blocked by outbound content policy")
+
+// piiKind names a kind of personal data and the placeholder it is replaced
+// with, such as [EMAIL_1]
+type piiKind string
+
+const (
+	piiEmail   piiKind = "EMAIL"
+	piiSSN     piiKind = "SSN"
+	piiCard    piiKind = "CARD"
+	piiIBAN    piiKind = "IBAN"
+	piiAccount piiKind = "ACCOUNT"
+	piiPhone   piiKind = "PHONE"
+	piiPerson  piiKind = "PERSON"
+)
+
+// piiDetector finds one kind of personal data. When the pattern has a
+// group, only the group is replaced, so labels such as "Account No:" stay.
+type piiDetector struct {
+	kind    piiKind
+	pattern *regexp.Regexp
+	valid   func(string) bool
+}
+
+// piiDetectors run in order; earlier kinds win where matches overlap.
+// Names are only recognized after a title or an employee or name label.
+var piiDetectors = []piiDetector{
+	{kind: piiEmail, pattern: regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)},
+	{kind: piiIBAN, pattern: regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,3})?\b`), valid: validIBAN},
+	{kind: piiCard, pattern: regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), valid: validCardNumber},
+	{kind: piiSSN, pattern: regexp.MustCompile(`\b\d{3}-\d{2}-\d{4}\b`)},
+	{kind: piiAccount, pattern: regexp.MustCompile(`(?i:\b(?:account|acct|a/c|routing)(?:\s+(?:no\.?|number|#))?\s*[:#]?\s*)(\d[\d -]{4,18}\d)\b`)},
+	{kind: piiPhone, pattern: regexp.MustCompile(`(?:\+\d{1,3}[ .-]?)?\(?\b\d{3}\)?[ .-]\d{3}[ .-]\d{4}\b`)},
+	{kind: piiPerson, pattern: regexp.MustCompile(`\b(?:Mr|Mrs|Ms|Miss|Dr|Prof)\.?\s+([A-Z][a-zA-Z'-]+(?:\s+[A-Z][a-zA-Z'-]+){0,2})`)},
+	{kind: piiPerson, pattern: regexp.MustCompile(`(?i:\b(?:employee(?:\s+name)?|name|contact(?:\s+person)?)\s*:\s*)([A-Z][a-zA-Z'-]+(?:\s+[A-Z][a-zA-Z'-]+){1,2})`)},
+}
+
+// piiPlaceholder matches the placeholders PII is replaced with
+var piiPlaceholder = regexp.MustCompile(`\[(?:EMAIL|SSN|CARD|IBAN|ACCOUNT|PHONE|PERSON)_\d+\]`)
+
+// piiVault swaps PII for placeholders and back. One vault serves every
+// request of an AI service call, so the chunks of a document share
+// placeholders.
+type piiVault struct {
+	mu            sync.Mutex
+	placeholders  map[string]string // Original value to placeholder
+	originals     map[string]string // Placeholder to original value
+	kindSequences map[piiKind]int
+}
+
+func newPIIVault() *piiVault {
+	return &piiVault{
+		placeholders:  make(map[string]string),
+		originals:     make(map[string]string),
+		kindSequences: make(map[piiKind]int),
+	}
+}
+
+// tokenize replaces the PII in text with placeholders and counts the
+// replacements by kind
+func (v *piiVault) tokenize(text string, counts map[string]int) string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	for _, detector := range piiDetectors {
+		text = v.replaceMatches(text, detector, counts)
+	}
+
+	// Values found anywhere in the call are replaced wherever they recur,
+	// such as a name labelled once and mentioned again later
+	values := make([]string, 0, len(v.placeholders))
+	for value := range v.placeholders {
+		values = append(values, value)
+	}
+	sort.Slice(values, func(i, j int) bool { return len(values[i]) > len(values[j]) })
+	for _, value := range values {
+		if n := strings.Count(text, value); n > 0 {
+			placeholder := v.placeholders[value]
+			text = strings.ReplaceAll(text, value, placeholder)
+			counts[placeholderKind(placeholder)] += n
+		}
+	}
+	return text
+}
+
+func (v *piiVault) replaceMatches(text string, detector piiDetector, counts map[string]int) string {
+	matches := detector.pattern.FindAllStringSubmatchIndex(text, -1)
+	if len(matches) == 0 {
+		return text
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		start, end := m[0], m[1]
+		if len(m) > 2 && m[2] >= 0 {
+			start, end = m[2], m[3]
+		}
+		value := text[start:end]
+		if detector.valid != nil && !detector.valid(value) {
+			continue
+		}
+		b.WriteString(text[last:start])
+		b.WriteString(v.placeholderFor(detector.kind, value))
+		counts[string(detector.kind)]++
+		last = end
+	}
+	b.WriteString(text[last:])
+	return b.String()
+}
+
+func (v *piiVault) placeholderFor(kind piiKind, value string) string {
+	if placeholder, ok := v.placeholders[value]; ok {
+		return placeholder
+	}
+	v.kindSequences[kind]++
+	placeholder := fmt.Sprintf("[%s_%d]", kind, v.kindSequences[kind])
+	v.placeholders[value] = placeholder
+	v.originals[placeholder] = value
+	return placeholder
+}
+
+// restore puts the original values back in a response. Values are escaped
+// when the response is JSON.
+func (v *piiVault) restore(text string) string {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if len(v.originals) == 0 {
+		return text
+	}
+	isJSON := json.Valid([]byte(text))
+	return piiPlaceholder.ReplaceAllStringFunc(text, func(placeholder string) string {
+		original, ok := v.originals[placeholder]
+		if !ok {
+			return placeholder
+		}
+		if isJSON {
+			quoted, _ := json.Marshal(original)
+			return string(quoted[1 : len(quoted)-1])
+		}
+		return original
+	})
+}
+
+func placeholderKind(placeholder string) string {
+	kind, _, _ := strings.Cut(strings.TrimPrefix(placeholder, "["), "_")
+	return kind
+}
+
+// validCardNumber applies the Luhn checksum so figures such as long
+// reference numbers are not mistaken for card numbers
+func validCardNumber(value string) bool {
+	digits := strings.NewReplacer(" ", "", "-", "").Replace(value)
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := range digits {
+		d := int(digits[len(digits)-1-i] - '0')
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// validIBAN applies the ISO 13616 mod-97 check
+func validIBAN(value string) bool {
+	iban := strings.ReplaceAll(value, " ", "")
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+	var numeric strings.Builder
+	for _, r := range iban[4:] + iban[:4] {
+		if r >= 'A' && r <= 'Z' {
+			fmt.Fprintf(&numeric, "%d", r-'A'+10)
+		} else {
+			numeric.WriteRune(r)
+		}
+	}
+	n, ok := new(big.Int).SetString(numeric.String(), 10)
+	return ok && new(big.Int).Mod(n, big.NewInt(97)).Int64() == 1
+}
+
+// aiOutboundAuditPath is where the outbound policy's decisions are logged
+func aiOutboundAuditPath(root string) string {
+	return filepath.Join(root, "data", "ai_outbound_audit.log")
+}
+
+// OutboundPolicy enforces the AI security settings on every request sent
+// to a provider: PII is replaced with placeholders that are restored in the
+// response, content naming a blocked keyword is refused, only allowed
+// domains are contacted, and each processing run of a document may make at
+// most MaxRequestsPerDoc requests. Each decision is written to the audit log.
+type OutboundPolicy struct {
+	settings SecuritySettings
+	keywords []string // Lowercased blocked keywords
+	audit    *AuditLogger
+	mu       sync.Mutex
+}
+
+// NewOutboundPolicy creates a policy enforcing settings
+func NewOutboundPolicy(settings SecuritySettings) *OutboundPolicy {
+	policy := &OutboundPolicy{
+		settings: settings,
+	}
+	for _, keyword := range settings.BlockedKeywords {
+		if keyword = strings.ToLower(strings.TrimSpace(keyword)); keyword != "" {
+			policy.keywords = append(policy.keywords, keyword)
+		}
+	}
+	return policy
+}
+
+// SetAuditLogger sets where decisions are recorded when the settings
+// enable the audit log
+func (p *OutboundPolicy) SetAuditLogger(logger *AuditLogger) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.audit = logger
+}
+
+// outboundCall is the policy state of one AI service call, carried in its
+// context to the providers
+type outboundCall struct {
+	policy    *OutboundPolicy
+	operation string
+	dealName  string
+	run       *aiDocumentRun
+	vault     *piiVault
+}
+
+// aiDocumentRun counts the requests made while processing a document once.
+// Calls not attributed to a document count on their own.
+type aiDocumentRun struct {
+	document string
+	mu       sync.Mutex
+	requests int
+}
+
+type aiOutboundKey struct{}
+
+type aiDocumentKey struct{}
+
+// WithAIDocument attributes the AI requests made with a context to a
+// document. They count against its request cap together; the count starts
+// afresh each time the document is processed again.
+func WithAIDocument(ctx context.Context, document string) context.Context {
+	if document == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, aiDocumentKey{}, &aiDocumentRun{document: document})
+}
+
+// attach carries the policy to the providers answering an AI service call
+func (p *OutboundPolicy) attach(ctx context.Context, operation string) context.Context {
+	if p == nil {
+		return ctx
+	}
+	run, ok := ctx.Value(aiDocumentKey{}).(*aiDocumentRun)
+	if !ok {
+		run = &aiDocumentRun{}
+	}
+	return context.WithValue(ctx, aiOutboundKey{}, &outboundCall{
+		policy:    p,
+		operation: operation,
+		dealName:  aiDealFromContext(ctx),
+		run:       run,
+		vault:     newPIIVault(),
+	})
+}
+
+// screenOutbound applies the policy attached to ctx to one provider request
+// to endpoint. It returns the texts to send in place of texts and a function
+// restoring PII in the response. Requests made without a policy pass
+// unchanged.
+func screenOutbound(ctx context.Context, provider AIProvider, endpoint string, texts []string) ([]string, func(string) string, error) {
+	call, ok := ctx.Value(aiOutboundKey{}).(*outboundCall)
+	if !ok {
+		return texts, func(text string) string { return text }, nil
+	}
+	screened, err := call.screen(provider, endpoint, texts)
+	if err != nil {
+		return nil, nil, err
+	}
+	return screened, call.vault.restore, nil
+}
+
+func (c *outboundCall) screen(provider AIProvider, endpoint string, texts []string) ([]string, error) {
+	p := c.policy
+	details := map[string]interface{}{"provider": string(provider)}
+
+	if host := endpointHost(endpoint); !p.domainAllowed(host) {
+		details["host"] = host
+		c.record("ai_request_blocked", "warning", "domain_not_allowed", details)
+		return nil, fmt.Errorf("%w: %s is not an allowed domain", ErrAIContentBlocked, host)
+	}
+
+	if keyword := p.blockedKeyword(texts); keyword != "" {
+		details["keyword"] = keyword
+		c.record("ai_request_blocked", "warning", "blocked_keyword", details)
+		return nil, fmt.Errorf("%w: content contains blocked keyword %q", ErrAIContentBlocked, keyword)
+	}
+
+	count, allowed := c.takeRequest()
+	details["requestNumber"] = count
+	if !allowed {
+		details["maxRequestsPerDoc"] = p.settings.MaxRequestsPerDoc
+		c.record("ai_request_blocked", "warning", "request_cap_reached", details)
+		return nil, fmt.Errorf("%w: document has made %d requests", ErrAIContentBlocked, p.settings.MaxRequestsPerDoc)
+	}
+
+	screened := texts
+	if p.settings.RedactPII {
+		redactions := make(map[string]int)
+		screened = make([]string, len(texts))
+		for i, text := range texts {
+			screened[i] = c.vault.tokenize(text, redactions)
+		}
+		details["redactions"] = redactions
+	}
+	c.record("ai_request_allowed", "info", "", details)
+	return screened, nil
+}
+
+// takeRequest counts a request against the document run's cap, reporting
+// the request's number and whether it is within the cap
+func (c *outboundCall) takeRequest() (int, bool) {
+	run := c.run
+	run.mu.Lock()
+	defer run.mu.Unlock()
+
+	if limit := c.policy.settings.MaxRequestsPerDoc; limit > 0 && run.requests >= limit {
+		return run.requests + 1, false
+	}
+	run.requests++
+	return run.requests, true
+}
+
+func (p *OutboundPolicy) domainAllowed(host string) bool {
+	if len(p.settings.AllowedDomains) == 0 {
+		return true
+	}
+	for _, domain := range p.settings.AllowedDomains {
+		domain = strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "."))
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// blockedKeyword returns the first blocked keyword the texts contain
+func (p *OutboundPolicy) blockedKeyword(texts []string) string {
+	if len(p.keywords) == 0 {
+		return ""
+	}
+	for _, text := range texts {
+		lower := strings.ToLower(text)
+		for _, keyword := range p.keywords {
+			if strings.Contains(lower, keyword) {
+				return keyword
+			}
+		}
+	}
+	return ""
+}
+
+// record writes a policy decision to the audit log. PII values are never
+// logged, only how many of each kind were replaced.
+func (c *outboundCall) record(eventType, severity, reason string, details map[string]interface{}) {
+	p := c.policy
+	p.mu.Lock()
+	audit := p.audit
+	p.mu.Unlock()
+	if audit == nil || !p.settings.EnableAuditLog {
+		return
+	}
+
+	details["operation"] = c.operation
+	if c.dealName != "" {
+		details["dealName"] = c.dealName
+	}
+	if c.run.document != "" {
+		details["document"] = c.run.document
+	}
+	if reason != "" {
+		details["reason"] = reason
+	}
+	if err := audit.LogEvent(&AuditEvent{
+		EventID:   uuid.New().String(),
+		EventType: eventType,
+		Details:   details,
+		Timestamp: time.Now(),
+		Severity:  severity,
+	}); err != nil {
+		fmt.Printf("Warning: Failed to write AI policy audit event: %v\n", err)
+	}
+}
+
+func endpointHost(endpoint string) string {
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
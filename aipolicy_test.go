@@ -0,0 +1,224 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPIIVault_TokenizeAndRestore(t *testing.T) {
+	vault := newPIIVault()
+	counts := make(map[string]int)
+	text := strings.Join([]string{
+		"Employee: Jane Smith, SSN 123-45-6789, jane.smith@acme.com, (555) 123-4567.",
+		"Paid to IBAN GB82 WEST 1234 5698 7654 32 and card 4111 1111 1111 1111; Account No: 00123456789.",
+		"Dr. Alan Turing reviewed the plan. Jane Smith signed it. Invoice 1234567890123 totals 2,500,000.",
+	}, "\n")
+
+	tokenized := vault.tokenize(text, counts)
+	for _, value := range []string{"Jane Smith", "123-45-6789", "jane.smith@acme.com", "555", "GB82", "4111", "00123456789", "Alan Turing"} {
+		assert.NotContains(t, tokenized, value)
+	}
+	assert.Contains(t, tokenized, "Employee: [PERSON_2], SSN [SSN_1], [EMAIL_1], [PHONE_1].")
+	assert.Contains(t, tokenized, "Account No: [ACCOUNT_1]")
+	assert.Contains(t, tokenized, "Dr. [PERSON_1] reviewed the plan. [PERSON_2] signed it.")
+	assert.Contains(t, tokenized, "Invoice 1234567890123 totals 2,500,000.", "numbers failing the Luhn check are kept")
+	assert.Equal(t, map[string]int{"EMAIL": 1, "IBAN": 1, "CARD": 1, "SSN": 1, "ACCOUNT": 1, "PHONE": 1, "PERSON": 3}, counts)
+	assert.Equal(t, text, vault.restore(tokenized))
+
+	// Values keep their placeholder across the requests of a call
+	assert.Equal(t, "Ask [PERSON_2] at [EMAIL_1]", vault.tokenize("Ask Jane Smith at jane.smith@acme.com", map[string]int{}))
+
+	// Restored values are escaped inside JSON responses
+	vault.placeholderFor(piiPerson, `Jane "JJ" Smith`)
+	restored := vault.restore(`{"owner": "[PERSON_3]", "contact": "[EMAIL_1]", "other": "[PERSON_9]"}`)
+	var response map[string]string
+	require.NoError(t, json.Unmarshal([]byte(restored), &response))
+	assert.Equal(t, map[string]string{"owner": `Jane "JJ" Smith`, "contact": "jane.smith@acme.com", "other": "[PERSON_9]"}, response)
+}
+
+// newPolicyTestService returns an AI service answered by a local model
+// server, with its policy decisions logged to the returned path
+func newPolicyTestService(t *testing.T, server *localModelServer, settings SecuritySettings) (*AIService, string) {
+	t.Helper()
+	service := NewAIService(&AIConfig{
+		CacheTTL:         time.Minute,
+		RateLimit:        600,
+		LocalEndpoints:   []LocalEndpoint{{Name: "ollama", BaseURL: server.URL, Model: "llama3.1:8b"}},
+		SecuritySettings: settings,
+	})
+
+	auditPath := aiOutboundAuditPath(t.TempDir())
+	logger, err := NewAuditLogger(auditPath)
+	require.NoError(t, err)
+	t.Cleanup(func() { logger.Close() })
+	service.SetAuditLogger(logger)
+	return service, auditPath
+}
+
+func readAuditEvents(t *testing.T, path string) []AuditEvent {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	var events []AuditEvent
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "" {
+			continue
+		}
+		var event AuditEvent
+		require.NoError(t, json.Unmarshal([]byte(line), &event))
+		events = append(events, event)
+	}
+	return events
+}
+
+func TestOutboundPolicy_RedactsRequestsAndRestoresResults(t *testing.T) {
+	server := newLocalModelServer(t, `{"overallRiskScore": 0.6, "recommendations": ["Confirm retention terms with [PERSON_1] ([EMAIL_1])"]}`)
+	service, auditPath := newPolicyTestService(t, server, defaultSecuritySettings())
+
+	ctx := WithAIDocument(WithAIDeal(context.Background(), "Acme"), "/deals/Acme/legal/employment.pdf")
+	result, err := service.AnalyzeRisks(ctx, "Employee: Jane Smith (jane.smith@acme.com) holds a change of control bonus.", "legal")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"Confirm retention terms with Jane Smith (jane.smith@acme.com)"}, result.Recommendations)
+
+	require.Len(t, server.requests, 1)
+	sent, _ := json.Marshal(server.requests[0].Messages)
+	assert.NotContains(t, string(sent), "Jane Smith")
+	assert.NotContains(t, string(sent), "jane.smith@acme.com")
+	assert.Contains(t, string(sent), "Employee: [PERSON_1] ([EMAIL_1])")
+
+	events := readAuditEvents(t, auditPath)
+	require.Len(t, events, 1)
+	assert.Equal(t, "ai_request_allowed", events[0].EventType)
+	assert.Equal(t, "local:ollama", events[0].Details["provider"])
+	assert.Equal(t, "risk", events[0].Details["operation"])
+	assert.Equal(t, "Acme", events[0].Details["dealName"])
+	assert.Equal(t, map[string]interface{}{"PERSON": 1.0, "EMAIL": 1.0}, events[0].Details["redactions"])
+
+	logged, err := os.ReadFile(auditPath)
+	require.NoError(t, err)
+	assert.NotContains(t, string(logged), "jane.smith@acme.com", "PII values are never audited")
+}
+
+func TestOutboundPolicy_BlocksContent(t *testing.T) {
+	server := newLocalModelServer(t, `{"overallRiskScore": 0.6}`)
+	settings := defaultSecuritySettings()
+	settings.BlockedKeywords = []string{"Project Falcon"}
+	service, auditPath := newPolicyTestService(t, server, settings)
+
+	// Blocked requests are answered by the rule-based provider
+	result, err := service.AnalyzeRisks(context.Background(), "Board minutes on PROJECT FALCON pricing.", "general")
+	require.NoError(t, err)
+	assert.NotEqual(t, 0.6, result.OverallRiskScore)
+	assert.Empty(t, server.requests)
+
+	events := readAuditEvents(t, auditPath)
+	require.Len(t, events, 1)
+	assert.Equal(t, "ai_request_blocked", events[0].EventType)
+	assert.Equal(t, "blocked_keyword", events[0].Details["reason"])
+	assert.Equal(t, "project falcon", events[0].Details["keyword"])
+
+	// Only allowed domains are contacted
+	settings = defaultSecuritySettings()
+	settings.AllowedDomains = []string{"api.openai.com"}
+	service, auditPath = newPolicyTestService(t, server, settings)
+	_, err = service.AnalyzeRisks(context.Background(), "Customer concentration is high.", "general")
+	require.NoError(t, err)
+	assert.Empty(t, server.requests)
+	assert.Equal(t, "domain_not_allowed", readAuditEvents(t, auditPath)[0].Details["reason"])
+
+	ctx := NewOutboundPolicy(settings).attach(context.Background(), "classify")
+	_, _, err = screenOutbound(ctx, ProviderOpenAI, "https://eu.api.openai.com/v1", []string{"text"})
+	assert.NoError(t, err, "subdomains of allowed domains are allowed")
+}
+
+func TestOutboundPolicy_ScreensEmbeddings(t *testing.T) {
+	var inputs [][]string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request embeddingRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		inputs = append(inputs, request.Input)
+		w.Write([]byte(`{"data": [{"index": 0, "embedding": [1, 0]}]}`))
+	}))
+	defer server.Close()
+
+	settings := defaultSecuritySettings()
+	settings.BlockedKeywords = []string{"Project Falcon"}
+	embedder := NewHTTPEmbedder("openai", server.URL, "key", "text-embedding-3-small", 0)
+	embedder.SetOutboundPolicy(NewOutboundPolicy(settings))
+
+	_, err := embedder.Embed(context.Background(), []string{"Contact jane.smith@acme.com"})
+	require.NoError(t, err)
+	require.Len(t, inputs, 1)
+	assert.Equal(t, []string{"Contact [EMAIL_1]"}, inputs[0])
+
+	_, err = embedder.Embed(context.Background(), []string{"Project Falcon revenue"})
+	assert.ErrorIs(t, err, ErrAIContentBlocked)
+	assert.Len(t, inputs, 1)
+}
+
+func TestOutboundPolicy_CapsRequestsPerDocument(t *testing.T) {
+	server := newLocalModelServer(t, `{"overallRiskScore": 0.6}`)
+	settings := defaultSecuritySettings()
+	settings.MaxRequestsPerDoc = 2
+	service, auditPath := newPolicyTestService(t, server, settings)
+
+	ctx := WithAIDocument(context.Background(), "/deals/Acme/legal/spa.pdf")
+	for _, content := range []string{"First section.", "Second section.", "Third section."} {
+		_, err := service.AnalyzeRisks(ctx, content, "legal")
+		require.NoError(t, err)
+	}
+	assert.Len(t, server.requests, 2, "the third request is answered locally")
+
+	// Other documents have their own allowance
+	_, err := service.AnalyzeRisks(WithAIDocument(context.Background(), "/deals/Acme/legal/nda.pdf"), "Fourth section.", "legal")
+	require.NoError(t, err)
+	assert.Len(t, server.requests, 3)
+
+	// Processing the document again starts a new allowance
+	_, err = service.AnalyzeRisks(WithAIDocument(context.Background(), "/deals/Acme/legal/spa.pdf"), "Fifth section.", "legal")
+	require.NoError(t, err)
+	assert.Len(t, server.requests, 4)
+
+	var types []string
+	for _, event := range readAuditEvents(t, auditPath) {
+		types = append(types, event.EventType)
+	}
+	assert.Equal(t, []string{"ai_request_allowed", "ai_request_allowed", "ai_request_blocked", "ai_request_allowed", "ai_request_allowed"}, types)
+
+	// Requests not attributed to a document are capped per call
+	ctx = NewOutboundPolicy(settings).attach(context.Background(), "risk")
+	for i := 0; i < 2; i++ {
+		_, _, err = screenOutbound(ctx, ProviderOpenAI, "https://api.openai.com/v1", []string{"chunk"})
+		require.NoError(t, err)
+	}
+	_, _, err = screenOutbound(ctx, ProviderOpenAI, "https://api.openai.com/v1", []string{"chunk"})
+	assert.ErrorIs(t, err, ErrAIContentBlocked)
+}
+
+func TestAIConfigManagerSecuritySettings(t *testing.T) {
+	manager := &AIConfigManager{
+		config:     &AIConfig{SecuritySettings: defaultSecuritySettings()},
+		configPath: filepath.Join(t.TempDir(), "ai_config.json"),
+	}
+
+	require.NoError(t, manager.UpdateConfig(map[string]interface{}{
+		"security_settings": map[string]interface{}{"blocked_keywords": []string{"Project Falcon"}, "max_requests_per_doc": 25},
+	}))
+	settings := manager.GetConfig().SecuritySettings
+	assert.Equal(t, []string{"Project Falcon"}, settings.BlockedKeywords)
+	assert.Equal(t, 25, settings.MaxRequestsPerDoc)
+	assert.True(t, settings.RedactPII, "fields left out keep their values")
+
+	assert.Error(t, manager.UpdateConfig(map[string]interface{}{"security_settings": map[string]interface{}{"max_requests_per_doc": 0}}))
+	assert.Equal(t, 25, manager.GetConfig().SecuritySettings.MaxRequestsPerDoc)
+}
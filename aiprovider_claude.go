@@ -7,17 +7,20 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"strings"
 	"sync/atomic"
 	"time"
 )
 
 // ClaudeProvider implements AI service using Anthropic's Claude API
 type ClaudeProvider struct {
-	apiKey     string
-	model      string
-	endpoint   string
-	httpClient *http.Client
-	stats      *AIUsageStats
+	apiKey            string
+	model             string
+	endpoint          string
+	httpClient        *http.Client
+	streamClient      *http.Client
+	structuredRetries int
+	stats             *AIUsageStats
 }
 
 // NewClaudeProvider creates a new Claude provider
@@ -33,6 +36,10 @@ func NewClaudeProvider(apiKey, model string) AIServiceInterface {
 		httpClient: &http.Client{
 			Timeout: time.Minute * 2,
 		},
+		// Streams are bounded by the caller's context rather than a fixed
+		// timeout since long documents can take several minutes
+		streamClient:      &http.Client{},
+		structuredRetries: DefaultStructuredOutputRetries,
 		stats: &AIUsageStats{
 			LastReset: time.Now(),
 		},
@@ -41,11 +48,25 @@ func NewClaudeProvider(apiKey, model string) AIServiceInterface {
 
 // Claude API types
 type claudeRequest struct {
-	Model       string          `json:"model"`
-	Messages    []claudeMessage `json:"messages"`
-	MaxTokens   int             `json:"max_tokens"`
-	System      string          `json:"system,omitempty"`
-	Temperature float64         `json:"temperature"`
+	Model       string            `json:"model"`
+	Messages    []claudeMessage   `json:"messages"`
+	MaxTokens   int               `json:"max_tokens"`
+	System      string            `json:"system,omitempty"`
+	Temperature float64           `json:"temperature"`
+	Tools       []claudeTool      `json:"tools,omitempty"`
+	ToolChoice  *claudeToolChoice `json:"tool_choice,omitempty"`
+	Stream      bool              `json:"stream,omitempty"`
+}
+
+type claudeTool struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	InputSchema map[string]interface{} `json:"input_schema"`
+}
+
+type claudeToolChoice struct {
+	Type string `json:"type"`
+	Name string `json:"name,omitempty"`
 }
 
 type claudeMessage struct {
@@ -65,8 +86,27 @@ type claudeResponse struct {
 }
 
 type claudeContent struct {
-	Type string `json:"type"`
-	Text string `json:"text"`
+	Type  string          `json:"type"`
+	Text  string          `json:"text,omitempty"`
+	ID    string          `json:"id,omitempty"`
+	Name  string          `json:"name,omitempty"`
+	Input json.RawMessage `json:"input,omitempty"`
+}
+
+// claudeStreamEvent covers the fields used from Messages API stream events
+type claudeStreamEvent struct {
+	Type    string `json:"type"`
+	Message struct {
+		Usage claudeUsage `json:"usage"`
+	} `json:"message"`
+	Delta struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`
+		PartialJSON string `json:"partial_json"`
+		StopReason  string `json:"stop_reason"`
+	} `json:"delta"`
+	Usage claudeUsage  `json:"usage"`
+	Error *claudeError `json:"error,omitempty"`
 }
 
 type claudeUsage struct {
@@ -102,7 +142,7 @@ Provide your response in JSON format with the following structure:
 
 	userPrompt := fmt.Sprintf("Analyze this document and respond with JSON:\n\n%s", content)
 
-	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt)
+	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt, structuredOutputFor("ai_classification_result", AIClassificationResult{}))
 	if err != nil {
 		atomic.AddInt64(&cp.stats.FailedCalls, 1)
 		return nil, err
@@ -146,7 +186,7 @@ Use 0 for any values not found. Include warnings about missing or unclear data.`
 
 	userPrompt := fmt.Sprintf("Extract financial data from this document and respond with JSON:\n\n%s", content)
 
-	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt)
+	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt, structuredOutputFor("financial_analysis", FinancialAnalysis{}))
 	if err != nil {
 		atomic.AddInt64(&cp.stats.FailedCalls, 1)
 		return nil, err
@@ -187,7 +227,7 @@ Provide your response in JSON format with the following structure:
 
 	userPrompt := fmt.Sprintf("Analyze risks in this document and respond with JSON:\n\n%s", content)
 
-	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt)
+	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt, structuredOutputFor("risk_analysis", RiskAnalysis{}))
 	if err != nil {
 		atomic.AddInt64(&cp.stats.FailedCalls, 1)
 		return nil, err
@@ -222,7 +262,7 @@ Provide your response in JSON format with the following structure:
 
 	userPrompt := fmt.Sprintf("Generate insights for this %s document and respond with JSON:\n\n%s", docType, content)
 
-	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt)
+	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt, structuredOutputFor("document_insights", DocumentInsights{}))
 	if err != nil {
 		atomic.AddInt64(&cp.stats.FailedCalls, 1)
 		return nil, err
@@ -256,7 +296,7 @@ Provide your response in JSON format with the following structure:
 
 	userPrompt := fmt.Sprintf("Extract entities from this text and respond with JSON:\n\n%s", content)
 
-	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt)
+	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt, structuredOutputFor("entity_extraction", EntityExtraction{}))
 	if err != nil {
 		atomic.AddInt64(&cp.stats.FailedCalls, 1)
 		return nil, err
@@ -272,18 +312,48 @@ Provide your response in JSON format with the following structure:
 	return &result, nil
 }
 
-// makeRequest makes an API request to Claude
-func (cp *ClaudeProvider) makeRequest(ctx context.Context, systemPrompt, userPrompt string) (string, error) {
+// makeRequest makes an API request to Claude. With an output spec the model
+// is forced to call a tool whose input schema is the result struct, and the
+// returned JSON is validated, repaired and retried as needed.
+func (cp *ClaudeProvider) makeRequest(ctx context.Context, systemPrompt, userPrompt string, output *structuredOutput) (string, error) {
+	if output == nil {
+		return cp.send(ctx, systemPrompt, userPrompt, nil, 1)
+	}
+
+	return completeStructured(ctx, ProviderClaude, output, userPrompt, cp.structuredRetries,
+		func(ctx context.Context, prompt string, attempt int) (string, error) {
+			return cp.send(ctx, systemPrompt, prompt, output, attempt)
+		})
+}
+
+// send performs one Messages API call, streaming when the context carries a
+// progress callback
+func (cp *ClaudeProvider) send(ctx context.Context, systemPrompt, userPrompt string, output *structuredOutput, attempt int) (string, error) {
+	prompts, restore, err := screenOutbound(ctx, ProviderClaude, cp.endpoint, []string{systemPrompt, userPrompt})
+	if err != nil {
+		return "", err
+	}
+	systemPrompt, userPrompt = prompts[0], prompts[1]
+
 	messages := []claudeMessage{
 		{Role: "user", Content: userPrompt},
 	}
 
+	progress := aiProgressFromContext(ctx)
 	reqBody := claudeRequest{
 		Model:       cp.model,
 		Messages:    messages,
 		MaxTokens:   4096,
 		Temperature: 0.3, // Lower temperature for more consistent results
 		System:      systemPrompt,
+		Stream:      progress != nil,
+	}
+
+	operation := ""
+	if output != nil {
+		operation = output.Name
+		reqBody.Tools = []claudeTool{{Name: output.Name, Description: output.Description, InputSchema: output.Schema}}
+		reqBody.ToolChoice = &claudeToolChoice{Type: "tool", Name: output.Name}
 	}
 
 	jsonData, err := json.Marshal(reqBody)
@@ -300,18 +370,21 @@ func (cp *ClaudeProvider) makeRequest(ctx context.Context, systemPrompt, userPro
 	req.Header.Set("x-api-key", cp.apiKey)
 	req.Header.Set("anthropic-version", "2023-06-01")
 
-	resp, err := cp.httpClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("API request failed: %w", err)
+	client := cp.httpClient
+	if reqBody.Stream {
+		req.Header.Set("Accept", "text/event-stream")
+		client = cp.streamClient
+		progress(AIProgressEvent{Provider: ProviderClaude, Operation: operation, Stage: "started", Attempt: attempt})
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return "", fmt.Errorf("API request failed: %w", err)
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
 		var errResp claudeResponse
 		if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error != nil {
 			return "", fmt.Errorf("Claude API error: %s", errResp.Error.Message)
@@ -319,6 +392,18 @@ func (cp *ClaudeProvider) makeRequest(ctx context.Context, systemPrompt, userPro
 		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
+	if reqBody.Stream {
+		var usage claudeUsage
+		content, err := cp.readStream(resp.Body, operation, attempt, progress, &usage)
+		reportAIUsage(ctx, ProviderClaude, cp.model, usage.InputTokens, usage.OutputTokens)
+		return restore(content), err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+
 	var apiResp claudeResponse
 	if err := json.Unmarshal(body, &apiResp); err != nil {
 		return "", fmt.Errorf("failed to parse response: %w", err)
@@ -330,17 +415,101 @@ func (cp *ClaudeProvider) makeRequest(ctx context.Context, systemPrompt, userPro
 
 	// Update token usage
 	atomic.AddInt64(&cp.stats.TotalTokens, int64(apiResp.Usage.InputTokens+apiResp.Usage.OutputTokens))
+	reportAIUsage(ctx, ProviderClaude, cp.model, apiResp.Usage.InputTokens, apiResp.Usage.OutputTokens)
 
-	// Claude returns content as array, get the first text content
+	// Prefer the forced tool call; otherwise use the first text content
+	for _, content := range apiResp.Content {
+		if content.Type == "tool_use" && len(content.Input) > 0 {
+			return restore(string(content.Input)), nil
+		}
+	}
 	for _, content := range apiResp.Content {
 		if content.Type == "text" {
-			return content.Text, nil
+			return restore(content.Text), nil
 		}
 	}
 
 	return "", fmt.Errorf("no text content in Claude response")
 }
 
+// readStream accumulates text and tool input deltas from a Messages API
+// event stream, reporting each delta to progress and the billed tokens in
+// usage
+func (cp *ClaudeProvider) readStream(body io.Reader, operation string, attempt int, progress AIProgressFunc, usage *claudeUsage) (string, error) {
+	var text, toolInput strings.Builder
+	var streamErr error
+
+	err := readSSE(body, func(event sseEvent) (bool, error) {
+		if event.Data == "" {
+			return true, nil
+		}
+
+		var payload claudeStreamEvent
+		if err := json.Unmarshal([]byte(event.Data), &payload); err != nil {
+			return false, fmt.Errorf("failed to parse stream event: %w", err)
+		}
+
+		switch payload.Type {
+		case "message_start":
+			usage.InputTokens = payload.Message.Usage.InputTokens
+		case "content_block_delta":
+			delta := payload.Delta.Text
+			if payload.Delta.Type == "input_json_delta" {
+				delta = payload.Delta.PartialJSON
+				toolInput.WriteString(delta)
+			} else {
+				text.WriteString(delta)
+			}
+			progress(AIProgressEvent{
+				Provider:      ProviderClaude,
+				Operation:     operation,
+				Stage:         "streaming",
+				Delta:         delta,
+				ReceivedChars: text.Len() + toolInput.Len(),
+				InputTokens:   usage.InputTokens,
+				Attempt:       attempt,
+			})
+		case "message_delta":
+			usage.OutputTokens = payload.Usage.OutputTokens
+		case "message_stop":
+			return false, nil
+		case "error":
+			if payload.Error != nil {
+				streamErr = fmt.Errorf("Claude API error: %s", payload.Error.Message)
+			} else {
+				streamErr = fmt.Errorf("Claude API stream error")
+			}
+			return false, nil
+		}
+		return true, nil
+	})
+	if err != nil {
+		return "", err
+	}
+	if streamErr != nil {
+		return "", streamErr
+	}
+
+	atomic.AddInt64(&cp.stats.TotalTokens, int64(usage.InputTokens+usage.OutputTokens))
+	progress(AIProgressEvent{
+		Provider:      ProviderClaude,
+		Operation:     operation,
+		Stage:         "completed",
+		ReceivedChars: text.Len() + toolInput.Len(),
+		InputTokens:   usage.InputTokens,
+		OutputTokens:  usage.OutputTokens,
+		Attempt:       attempt,
+	})
+
+	if toolInput.Len() > 0 {
+		return toolInput.String(), nil
+	}
+	if text.Len() == 0 {
+		return "", fmt.Errorf("no response from Claude")
+	}
+	return text.String(), nil
+}
+
 // GetProvider returns the provider name
 func (cp *ClaudeProvider) GetProvider() AIProvider {
 	return ProviderClaude
@@ -402,7 +571,7 @@ Extract as many relevant fields as possible. Use descriptive field names. For mo
 
 	userPrompt := fmt.Sprintf("Extract structured fields from this %s document:\n\n%s", documentType, content)
 
-	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt)
+	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt, structuredOutputFor("document_field_extraction", DocumentFieldExtraction{}))
 	if err != nil {
 		atomic.AddInt64(&cp.stats.FailedCalls, 1)
 		return nil, err
@@ -469,7 +638,7 @@ Focus on creating high-confidence mappings. Consider field names, data types, an
 	userPrompt := fmt.Sprintf("Map these extracted fields:\n%s\n\nTo these template fields:\n%s",
 		string(extractedFieldsJSON), string(templateFieldsJSON))
 
-	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt)
+	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt, structuredOutputFor("field_mapping_result", FieldMappingResult{}))
 	if err != nil {
 		atomic.AddInt64(&cp.stats.FailedCalls, 1)
 		return nil, err
@@ -517,7 +686,7 @@ Common formatting patterns:
 	userPrompt := fmt.Sprintf("Format this value: %v\nField type: %s\nFormat requirements: %s",
 		rawValue, fieldType, string(formatReqJSON))
 
-	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt)
+	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt, structuredOutputFor("formatted_field_value", FormattedFieldValue{}))
 	if err != nil {
 		atomic.AddInt64(&cp.stats.FailedCalls, 1)
 		return nil, err
@@ -579,7 +748,7 @@ Validation types:
 	userPrompt := fmt.Sprintf("Validate this template data:\n%s\n\nUsing these validation rules:\n%s",
 		string(templateDataJSON), string(validationRulesJSON))
 
-	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt)
+	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt, structuredOutputFor("validation_result", ValidationResult{}))
 	if err != nil {
 		atomic.AddInt64(&cp.stats.FailedCalls, 1)
 		return nil, err
@@ -649,7 +818,7 @@ Provide your response in JSON format with the following structure:
 
 	userPrompt := fmt.Sprintf("Extract company and deal names from this %s document and respond with JSON:\n\n%s", documentType, content)
 
-	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt)
+	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt, structuredOutputFor("company_deal_extraction", CompanyDealExtraction{}))
 	if err != nil {
 		atomic.AddInt64(&cp.stats.FailedCalls, 1)
 		return nil, err
@@ -743,7 +912,7 @@ Provide your response in JSON format with the following structure:
 
 	userPrompt := fmt.Sprintf("Extract financial metrics from this %s document and respond with JSON:\n\n%s", documentType, content)
 
-	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt)
+	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt, structuredOutputFor("financial_metrics_extraction", FinancialMetricsExtraction{}))
 	if err != nil {
 		atomic.AddInt64(&cp.stats.FailedCalls, 1)
 		return nil, err
@@ -826,7 +995,7 @@ Provide your response in JSON format with the following structure:
 
 	userPrompt := fmt.Sprintf("Extract personnel and role information from this %s document and respond with JSON:\n\n%s", documentType, content)
 
-	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt)
+	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt, structuredOutputFor("personnel_role_extraction", PersonnelRoleExtraction{}))
 	if err != nil {
 		atomic.AddInt64(&cp.stats.FailedCalls, 1)
 		return nil, err
@@ -949,7 +1118,7 @@ Provide your response in JSON format with the following structure:
 			return string(summaryBytes)
 		}())
 
-	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt)
+	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt, structuredOutputFor("cross_document_validation", CrossDocumentValidation{}))
 	if err != nil {
 		atomic.AddInt64(&cp.stats.FailedCalls, 1)
 		return nil, err
@@ -997,7 +1166,7 @@ Provide semantic analysis including:
 6. Confidence score (0.0 to 1.0)
 7. Alternative interpretations`, fieldName, fieldValue, documentContext)
 
-	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt)
+	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt, structuredOutputFor("field_semantic_analysis", FieldSemanticAnalysis{}))
 	if err != nil {
 		atomic.AddInt64(&cp.stats.FailedCalls, 1)
 		return nil, fmt.Errorf("Claude API request failed: %w", err)
@@ -1062,7 +1231,7 @@ Provide:
 5. Unmapped fields and reasons
 6. Overall mapping strategy and confidence`, documentType, sourceFieldsJSON, templateFieldsJSON)
 
-	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt)
+	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt, structuredOutputFor("semantic_mapping_result", SemanticMappingResult{}))
 	if err != nil {
 		atomic.AddInt64(&cp.stats.FailedCalls, 1)
 		return nil, fmt.Errorf("Claude API request failed: %w", err)
@@ -1111,7 +1280,7 @@ Provide:
 5. Flags for conflicts requiring manual review
 6. Alternative values to consider`, conflictsJSON, contextJSON)
 
-	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt)
+	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt, structuredOutputFor("conflict_resolution_result", ConflictResolutionResult{}))
 	if err != nil {
 		atomic.AddInt64(&cp.stats.FailedCalls, 1)
 		return nil, fmt.Errorf("Claude API request failed: %w", err)
@@ -1166,7 +1335,7 @@ Provide:
 6. Validation rules and constraints
 7. Complexity assessment and compatibility score`, templatePath, contentStr)
 
-	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt)
+	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt, structuredOutputFor("template_structure_analysis", TemplateStructureAnalysis{}))
 	if err != nil {
 		atomic.AddInt64(&cp.stats.FailedCalls, 1)
 		return nil, fmt.Errorf("Claude API request failed: %w", err)
@@ -1216,7 +1385,7 @@ Provide:
 5. Recommendations for improvement
 6. Audit trail of validation steps`, mappingJSON, rulesJSON)
 
-	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt)
+	response, err := cp.makeRequest(ctx, systemPrompt, userPrompt, structuredOutputFor("mapping_validation_result", MappingValidationResult{}))
 	if err != nil {
 		atomic.AddInt64(&cp.stats.FailedCalls, 1)
 		return nil, fmt.Errorf("Claude API request failed: %w", err)
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// DefaultLocalTimeout allows for slow inference on CPU-only hosts
+const DefaultLocalTimeout = 10 * time.Minute
+
+// LocalEndpoint is an OpenAI-compatible inference server that keeps document
+// content on the local network, such as llama.cpp, Ollama or vLLM
+type LocalEndpoint struct {
+	Name           string `json:"name"`
+	BaseURL        string `json:"base_url"`                  // e.g. http://localhost:11434/v1
+	Model          string `json:"model,omitempty"`           // Empty uses the first model the server lists
+	APIKey         string `json:"api_key,omitempty"`         // Only for servers started with a key
+	TimeoutSeconds int    `json:"timeout_seconds,omitempty"` // Defaults to DefaultLocalTimeout
+}
+
+// LocalProviderID returns the provider key an endpoint is registered under
+func LocalProviderID(name string) AIProvider {
+	return AIProvider(string(ProviderLocal) + ":" + name)
+}
+
+// normalizeLocalEndpoint validates an endpoint and fills in defaults. A base
+// URL without a path gets /v1, which llama.cpp, Ollama and vLLM all serve.
+func normalizeLocalEndpoint(endpoint LocalEndpoint) (LocalEndpoint, error) {
+	endpoint.BaseURL = strings.TrimSpace(endpoint.BaseURL)
+	if endpoint.BaseURL == "" {
+		return endpoint, fmt.Errorf("local endpoint base URL is required")
+	}
+
+	parsed, err := url.Parse(endpoint.BaseURL)
+	if err != nil {
+		return endpoint, fmt.Errorf("invalid local endpoint URL: %w", err)
+	}
+	if (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return endpoint, fmt.Errorf("local endpoint URL must be http(s)://host[:port], got %q", endpoint.BaseURL)
+	}
+	if strings.Trim(parsed.Path, "/") == "" {
+		parsed.Path = "/v1"
+	}
+	endpoint.BaseURL = strings.TrimRight(parsed.String(), "/")
+
+	endpoint.Name = strings.TrimSpace(endpoint.Name)
+	if endpoint.Name == "" {
+		endpoint.Name = parsed.Host
+	}
+	if strings.ContainsAny(endpoint.Name, " /") {
+		return endpoint, fmt.Errorf("local endpoint name %q must not contain spaces or slashes", endpoint.Name)
+	}
+	endpoint.Model = strings.TrimSpace(endpoint.Model)
+	if endpoint.TimeoutSeconds < 0 {
+		endpoint.TimeoutSeconds = 0
+	}
+
+	return endpoint, nil
+}
+
+// LocalProvider implements the AI service against an OpenAI-compatible
+// server. It reuses the OpenAI client, so prompts, structured output and
+// streaming behave the same as the hosted API.
+type LocalProvider struct {
+	*OpenAIProvider
+	endpoint LocalEndpoint
+}
+
+// NewLocalProvider creates a provider for one local endpoint
+func NewLocalProvider(endpoint LocalEndpoint) (*LocalProvider, error) {
+	endpoint, err := normalizeLocalEndpoint(endpoint)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout := DefaultLocalTimeout
+	if endpoint.TimeoutSeconds > 0 {
+		timeout = time.Duration(endpoint.TimeoutSeconds) * time.Second
+	}
+
+	return &LocalProvider{
+		OpenAIProvider: newOpenAICompatibleProvider(LocalProviderID(endpoint.Name), endpoint.BaseURL, endpoint.APIKey, endpoint.Model, timeout),
+		endpoint:       endpoint,
+	}, nil
+}
+
+// IsAvailable reports whether the endpoint is configured; local servers
+// don't need an API key
+func (lp *LocalProvider) IsAvailable() bool {
+	return lp.endpoint.BaseURL != ""
+}
+
+// Endpoint returns the endpoint configuration without its API key
+func (lp *LocalProvider) Endpoint() LocalEndpoint {
+	endpoint := lp.endpoint
+	endpoint.APIKey = ""
+	return endpoint
+}
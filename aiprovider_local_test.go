@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// localModelServer mimics an OpenAI-compatible server such as Ollama
+type localModelServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	requests []openAIRequest
+	auth     []string
+}
+
+func newLocalModelServer(t *testing.T, content string) *localModelServer {
+	server := &localModelServer{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/v1/models", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"object": "list", "data": [{"id": "llama3.1:8b"}, {"id": "qwen2.5:14b"}]}`))
+	})
+	mux.HandleFunc("/v1/chat/completions", func(w http.ResponseWriter, r *http.Request) {
+		var request openAIRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+
+		server.mu.Lock()
+		server.requests = append(server.requests, request)
+		server.auth = append(server.auth, r.Header.Get("Authorization"))
+		server.mu.Unlock()
+
+		body, _ := json.Marshal(map[string]interface{}{
+			"model":   request.Model,
+			"choices": []map[string]interface{}{{"message": map[string]string{"role": "assistant", "content": content}}},
+			"usage":   map[string]int{"prompt_tokens": 50, "completion_tokens": 10, "total_tokens": 60},
+		})
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+	server.Server = httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestNormalizeLocalEndpoint(t *testing.T) {
+	endpoint, err := normalizeLocalEndpoint(LocalEndpoint{BaseURL: "http://gpu-box:11434/"})
+	require.NoError(t, err)
+	assert.Equal(t, "http://gpu-box:11434/v1", endpoint.BaseURL)
+	assert.Equal(t, "gpu-box:11434", endpoint.Name)
+
+	endpoint, err = normalizeLocalEndpoint(LocalEndpoint{Name: "vllm", BaseURL: "https://10.0.0.5/openai/v1/"})
+	require.NoError(t, err)
+	assert.Equal(t, "https://10.0.0.5/openai/v1", endpoint.BaseURL)
+
+	_, err = normalizeLocalEndpoint(LocalEndpoint{BaseURL: "localhost:8080"})
+	assert.Error(t, err)
+	_, err = normalizeLocalEndpoint(LocalEndpoint{Name: "two words", BaseURL: "http://localhost:8080"})
+	assert.Error(t, err)
+}
+
+func TestLocalProviderDiscoversModel(t *testing.T) {
+	server := newLocalModelServer(t, `{"revenue": 2500000, "currency": "EUR", "confidence": 0.8}`)
+
+	provider, err := NewLocalProvider(LocalEndpoint{Name: "ollama", BaseURL: server.URL})
+	require.NoError(t, err)
+	assert.True(t, provider.IsAvailable())
+	assert.Equal(t, AIProvider("local:ollama"), provider.GetProvider())
+
+	models, err := provider.ListModels(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []string{"llama3.1:8b", "qwen2.5:14b"}, models)
+
+	result, err := provider.ExtractFinancialData(context.Background(), "Revenue of EUR 2.5M")
+	require.NoError(t, err)
+	assert.Equal(t, 2500000.0, result.Revenue)
+	assert.Equal(t, "EUR", result.Currency)
+
+	require.Len(t, server.requests, 1)
+	assert.Equal(t, "llama3.1:8b", server.requests[0].Model, "first listed model is used")
+	assert.Equal(t, "json_object", server.requests[0].ResponseFormat.Type)
+	assert.Empty(t, server.auth[0], "no API key is sent to keyless servers")
+	assert.Equal(t, int64(60), provider.GetUsage().TotalTokens)
+}
+
+func TestAIServiceLocalOnly(t *testing.T) {
+	llama := newLocalModelServer(t, `{"overallRiskScore": 0.4, "recommendations": ["Review customer concentration"]}`)
+	ollama := newLocalModelServer(t, `{"overallRiskScore": 0.9}`)
+
+	config := &AIConfig{
+		OpenAIKey: "sk-test",
+		ClaudeKey: "claude-test",
+		CacheTTL:  time.Minute,
+		RateLimit: 600,
+		LocalEndpoints: []LocalEndpoint{
+			{Name: "llama-cpp", BaseURL: llama.URL, Model: "mistral-7b-instruct", APIKey: "local-secret"},
+			{Name: "ollama", BaseURL: ollama.URL, Model: "qwen2.5:14b"},
+		},
+		LocalOnly: true,
+	}
+
+	service := NewAIService(config)
+	assert.Equal(t, []AIProvider{"local:llama-cpp", "local:ollama", ProviderDefault}, service.fallbackOrder)
+	assert.Equal(t, AIProvider("local:llama-cpp"), service.primaryProvider)
+
+	result, err := service.AnalyzeRisks(context.Background(), "Top customer is 40% of revenue", "cim")
+	require.NoError(t, err)
+	assert.Equal(t, 0.4, result.OverallRiskScore)
+
+	// Each endpoint uses its own model and key
+	require.Len(t, llama.requests, 1)
+	assert.Equal(t, "mistral-7b-instruct", llama.requests[0].Model)
+	assert.Equal(t, "Bearer local-secret", llama.auth[0])
+	assert.Empty(t, ollama.requests)
+
+	// Without local-only the hosted providers follow the local ones
+	config.LocalOnly = false
+	service = NewAIService(config)
+	assert.Equal(t, []AIProvider{"local:llama-cpp", "local:ollama", ProviderOpenAI, ProviderClaude, ProviderDefault}, service.fallbackOrder)
+}
+
+func TestAIServiceReconfigureLocalOnly(t *testing.T) {
+	llama := newLocalModelServer(t, `{"overallRiskScore": 0.4}`)
+	config := &AIConfig{
+		OpenAIKey:      "sk-test",
+		CacheTTL:       time.Minute,
+		RateLimit:      600,
+		LocalEndpoints: []LocalEndpoint{{Name: "llama-cpp", BaseURL: llama.URL, Model: "mistral-7b-instruct"}},
+	}
+	service := NewAIService(config)
+	mapper := NewDataMapper(service, nil)
+
+	// Components built before the switch follow it
+	service.Reconfigure(&AIConfig{CacheTTL: time.Minute, RateLimit: 600, LocalEndpoints: config.LocalEndpoints, OpenAIKey: "sk-test", LocalOnly: true})
+	assert.Equal(t, []AIProvider{"local:llama-cpp", ProviderDefault}, mapper.aiService.providerOrder(context.Background()))
+	_, hosted := mapper.aiService.provider(ProviderOpenAI)
+	assert.False(t, hosted)
+}
+
+func TestAIConfigManagerLocalEndpoints(t *testing.T) {
+	manager := &AIConfigManager{
+		config:     &AIConfig{ClaudeKey: "claude-test", ClaudeModel: "claude-3-opus-20240229"},
+		configPath: filepath.Join(t.TempDir(), "ai_config.json"),
+	}
+
+	require.NoError(t, manager.SetLocalEndpoint(LocalEndpoint{Name: "ollama", BaseURL: "http://localhost:11434", Model: "llama3.1:8b"}))
+	require.NoError(t, manager.SetLocalEndpoint(LocalEndpoint{Name: "vllm", BaseURL: "http://10.0.0.5:8000/v1"}))
+	require.NoError(t, manager.SetLocalEndpoint(LocalEndpoint{Name: "ollama", BaseURL: "http://localhost:11434", Model: "qwen2.5:14b"}))
+	assert.Error(t, manager.SetLocalEndpoint(LocalEndpoint{Name: "bad", BaseURL: "ftp://host"}))
+	require.NoError(t, manager.SetAPIKey(LocalProviderID("vllm"), "vllm-key"))
+	require.NoError(t, manager.SetLocalOnly(true))
+
+	assert.True(t, manager.IsProviderConfigured(ProviderLocal))
+	assert.True(t, manager.IsProviderConfigured("local:vllm"))
+	assert.False(t, manager.IsProviderConfigured("local:missing"))
+
+	status := manager.GetProviderStatus()
+	assert.Equal(t, ProviderStatus{Configured: true, Model: "qwen2.5:14b", Enabled: true, Endpoint: "http://localhost:11434/v1"}, status["local:ollama"])
+	assert.Equal(t, "auto", status["local:vllm"].Model)
+	assert.False(t, status[ProviderClaude].Enabled, "hosted providers are disabled when local-only")
+
+	// Settings persist across reloads
+	reloaded := &AIConfigManager{configPath: manager.configPath}
+	require.NoError(t, reloaded.Load())
+	config := reloaded.GetConfig()
+	assert.True(t, config.LocalOnly)
+	require.Len(t, config.LocalEndpoints, 2)
+	assert.Equal(t, "vllm-key", config.LocalEndpoints[1].APIKey)
+
+	require.NoError(t, reloaded.RemoveLocalEndpoint("vllm"))
+	assert.Error(t, reloaded.RemoveLocalEndpoint("vllm"))
+	assert.Len(t, reloaded.GetConfig().LocalEndpoints, 1)
+
+	require.NoError(t, reloaded.UpdateConfig(map[string]interface{}{
+		"local_endpoints": []map[string]interface{}{{"name": "lan", "base_url": "http://192.168.1.20:8080"}},
+		"local_only":      false,
+	}))
+	config = reloaded.GetConfig()
+	assert.False(t, config.LocalOnly)
+	require.Len(t, config.LocalEndpoints, 1)
+	assert.Equal(t, "http://192.168.1.20:8080/v1", config.LocalEndpoints[0].BaseURL)
+}
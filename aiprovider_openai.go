@@ -9,17 +9,23 @@ import (
 	"net/http"
 	"path/filepath"
 	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
 
-// OpenAIProvider implements AI service using OpenAI's API
+// OpenAIProvider implements AI service using OpenAI's API. It also drives
+// OpenAI-compatible servers; see LocalProvider.
 type OpenAIProvider struct {
-	apiKey     string
-	model      string
-	endpoint   string
-	httpClient *http.Client
-	stats      *AIUsageStats
+	id                AIProvider
+	apiKey            string
+	model             string
+	modelMu           sync.Mutex
+	endpoint          string
+	httpClient        *http.Client
+	streamClient      *http.Client
+	structuredRetries int
+	stats             *AIUsageStats
 }
 
 // NewOpenAIProvider creates a new OpenAI provider
@@ -28,13 +34,25 @@ func NewOpenAIProvider(apiKey, model string) AIServiceInterface {
 		model = "gpt-4-turbo-preview"
 	}
 
+	return newOpenAICompatibleProvider(ProviderOpenAI, "https://api.openai.com/v1", apiKey, model, time.Minute*2)
+}
+
+// newOpenAICompatibleProvider creates a chat completions client for any
+// server speaking the OpenAI API. An empty model is discovered from the
+// server's model list on first use.
+func newOpenAICompatibleProvider(id AIProvider, endpoint, apiKey, model string, timeout time.Duration) *OpenAIProvider {
 	return &OpenAIProvider{
+		id:       id,
 		apiKey:   apiKey,
 		model:    model,
-		endpoint: "https://api.openai.com/v1",
+		endpoint: strings.TrimRight(endpoint, "/"),
 		httpClient: &http.Client{
-			Timeout: time.Minute * 2,
+			Timeout: timeout,
 		},
+		// Streams are bounded by the caller's context rather than a fixed
+		// timeout since long documents can take several minutes
+		streamClient:      &http.Client{},
+		structuredRetries: DefaultStructuredOutputRetries,
 		stats: &AIUsageStats{
 			LastReset: time.Now(),
 		},
@@ -43,11 +61,17 @@ func NewOpenAIProvider(apiKey, model string) AIServiceInterface {
 
 // OpenAI API types
 type openAIRequest struct {
-	Model          string          `json:"model"`
-	Messages       []openAIMessage `json:"messages"`
-	Temperature    float64         `json:"temperature"`
-	MaxTokens      int             `json:"max_tokens,omitempty"`
-	ResponseFormat *responseFormat `json:"response_format,omitempty"`
+	Model          string               `json:"model"`
+	Messages       []openAIMessage      `json:"messages"`
+	Temperature    float64              `json:"temperature"`
+	MaxTokens      int                  `json:"max_tokens,omitempty"`
+	ResponseFormat *responseFormat      `json:"response_format,omitempty"`
+	Stream         bool                 `json:"stream,omitempty"`
+	StreamOptions  *openAIStreamOptions `json:"stream_options,omitempty"`
+}
+
+type openAIStreamOptions struct {
+	IncludeUsage bool `json:"include_usage"`
 }
 
 type openAIMessage struct {
@@ -56,7 +80,27 @@ type openAIMessage struct {
 }
 
 type responseFormat struct {
-	Type string `json:"type"`
+	Type       string            `json:"type"`
+	JSONSchema *openAIJSONSchema `json:"json_schema,omitempty"`
+}
+
+type openAIJSONSchema struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Schema      map[string]interface{} `json:"schema"`
+	Strict      bool                   `json:"strict"`
+}
+
+// openAIStreamChunk is one chat completion chunk from a stream
+type openAIStreamChunk struct {
+	Choices []struct {
+		Delta struct {
+			Content string `json:"content"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+	Usage *openAIUsage `json:"usage,omitempty"`
+	Error *openAIError `json:"error,omitempty"`
 }
 
 type openAIResponse struct {
@@ -115,7 +159,7 @@ Provide your response in JSON format with the following structure:
 		{Role: "user", Content: userPrompt},
 	}
 
-	response, err := op.makeRequest(ctx, messages, true)
+	response, err := op.makeRequest(ctx, messages, structuredOutputFor("ai_classification_result", AIClassificationResult{}))
 	if err != nil {
 		atomic.AddInt64(&op.stats.FailedCalls, 1)
 		return nil, err
@@ -164,7 +208,7 @@ Use 0 for any values not found. Include warnings about missing or unclear data.`
 		{Role: "user", Content: userPrompt},
 	}
 
-	response, err := op.makeRequest(ctx, messages, true)
+	response, err := op.makeRequest(ctx, messages, structuredOutputFor("financial_analysis", FinancialAnalysis{}))
 	if err != nil {
 		atomic.AddInt64(&op.stats.FailedCalls, 1)
 		return nil, err
@@ -208,7 +252,7 @@ Provide your response in JSON format with the following structure:
 		{Role: "user", Content: fmt.Sprintf("Analyze risks in this document:\n\n%s", content)},
 	}
 
-	response, err := op.makeRequest(ctx, messages, true)
+	response, err := op.makeRequest(ctx, messages, structuredOutputFor("risk_analysis", RiskAnalysis{}))
 	if err != nil {
 		atomic.AddInt64(&op.stats.FailedCalls, 1)
 		return nil, err
@@ -246,7 +290,7 @@ Provide your response in JSON format with the following structure:
 		{Role: "user", Content: fmt.Sprintf("Generate insights for this %s document:\n\n%s", docType, content)},
 	}
 
-	response, err := op.makeRequest(ctx, messages, true)
+	response, err := op.makeRequest(ctx, messages, structuredOutputFor("document_insights", DocumentInsights{}))
 	if err != nil {
 		atomic.AddInt64(&op.stats.FailedCalls, 1)
 		return nil, err
@@ -283,7 +327,7 @@ Provide your response in JSON format with the following structure:
 		{Role: "user", Content: fmt.Sprintf("Extract entities from:\n\n%s", content)},
 	}
 
-	response, err := op.makeRequest(ctx, messages, true)
+	response, err := op.makeRequest(ctx, messages, structuredOutputFor("entity_extraction", EntityExtraction{}))
 	if err != nil {
 		atomic.AddInt64(&op.stats.FailedCalls, 1)
 		return nil, err
@@ -299,16 +343,88 @@ Provide your response in JSON format with the following structure:
 	return &result, nil
 }
 
-// makeRequest makes an API request to OpenAI
-func (op *OpenAIProvider) makeRequest(ctx context.Context, messages []openAIMessage, jsonMode bool) (string, error) {
+// makeRequest makes an API request to OpenAI. With an output spec the
+// response is constrained to the result struct's JSON schema where the model
+// supports it, then validated, repaired and retried as needed.
+func (op *OpenAIProvider) makeRequest(ctx context.Context, messages []openAIMessage, output *structuredOutput) (string, error) {
+	if output == nil {
+		return op.send(ctx, messages, nil, 1)
+	}
+
+	userPrompt := ""
+	if len(messages) > 0 {
+		userPrompt = messages[len(messages)-1].Content
+	}
+
+	return completeStructured(ctx, op.id, output, userPrompt, op.structuredRetries,
+		func(ctx context.Context, prompt string, attempt int) (string, error) {
+			attemptMessages := append([]openAIMessage{}, messages...)
+			if len(attemptMessages) > 0 {
+				attemptMessages[len(attemptMessages)-1].Content = prompt
+			}
+			return op.send(ctx, attemptMessages, output, attempt)
+		})
+}
+
+// openAISupportsJSONSchema reports whether a model accepts json_schema
+// response formats; older models only support json_object
+func openAISupportsJSONSchema(model string) bool {
+	for _, prefix := range []string{"gpt-4o", "gpt-4.1", "gpt-5", "o1", "o3", "o4"} {
+		if strings.HasPrefix(model, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// send performs one chat completion call, streaming when the context carries
+// a progress callback
+func (op *OpenAIProvider) send(ctx context.Context, messages []openAIMessage, output *structuredOutput, attempt int) (string, error) {
+	model, err := op.resolveModel(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	contents := make([]string, len(messages))
+	for i, message := range messages {
+		contents[i] = message.Content
+	}
+	contents, restore, err := screenOutbound(ctx, op.id, op.endpoint, contents)
+	if err != nil {
+		return "", err
+	}
+	screened := make([]openAIMessage, len(messages))
+	for i, message := range messages {
+		screened[i] = openAIMessage{Role: message.Role, Content: contents[i]}
+	}
+	messages = screened
+
+	progress := aiProgressFromContext(ctx)
 	reqBody := openAIRequest{
-		Model:       op.model,
+		Model:       model,
 		Messages:    messages,
 		Temperature: 0.3, // Lower temperature for more consistent results
+		Stream:      progress != nil,
+	}
+
+	if reqBody.Stream {
+		reqBody.StreamOptions = &openAIStreamOptions{IncludeUsage: true}
 	}
 
-	if jsonMode {
+	operation := ""
+	if output != nil {
+		operation = output.Name
 		reqBody.ResponseFormat = &responseFormat{Type: "json_object"}
+		if openAISupportsJSONSchema(model) {
+			reqBody.ResponseFormat = &responseFormat{
+				Type: "json_schema",
+				JSONSchema: &openAIJSONSchema{
+					Name:        output.Name,
+					Description: output.Description,
+					Schema:      output.Schema,
+				},
+			}
+		}
 	}
 
 	jsonData, err := json.Marshal(reqBody)
@@ -322,20 +438,25 @@ func (op *OpenAIProvider) makeRequest(ctx context.Context, messages []openAIMess
 	}
 
 	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+op.apiKey)
+	if op.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+op.apiKey)
+	}
 
-	resp, err := op.httpClient.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("API request failed: %w", err)
+	client := op.httpClient
+	if reqBody.Stream {
+		req.Header.Set("Accept", "text/event-stream")
+		client = op.streamClient
+		progress(AIProgressEvent{Provider: op.id, Operation: operation, Stage: "started", Attempt: attempt})
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
+	resp, err := client.Do(req)
 	if err != nil {
-		return "", fmt.Errorf("failed to read response: %w", err)
+		return "", fmt.Errorf("API request failed: %w", err)
 	}
+	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
 		var errResp openAIResponse
 		if err := json.Unmarshal(body, &errResp); err == nil && errResp.Error != nil {
 			return "", fmt.Errorf("OpenAI API error: %s", errResp.Error.Message)
@@ -343,6 +464,18 @@ func (op *OpenAIProvider) makeRequest(ctx context.Context, messages []openAIMess
 		return "", fmt.Errorf("API request failed with status %d: %s", resp.StatusCode, string(body))
 	}
 
+	if reqBody.Stream {
+		var usage openAIUsage
+		content, err := op.readStream(resp.Body, operation, attempt, progress, &usage)
+		reportAIUsage(ctx, op.id, model, usage.PromptTokens, usage.CompletionTokens)
+		return restore(content), err
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response: %w", err)
+	}
+
 	var apiResp openAIResponse
 	if err := json.Unmarshal(body, &apiResp); err != nil {
 		return "", fmt.Errorf("failed to parse response: %w", err)
@@ -354,13 +487,138 @@ func (op *OpenAIProvider) makeRequest(ctx context.Context, messages []openAIMess
 
 	// Update token usage
 	atomic.AddInt64(&op.stats.TotalTokens, int64(apiResp.Usage.TotalTokens))
+	reportAIUsage(ctx, op.id, model, apiResp.Usage.PromptTokens, apiResp.Usage.CompletionTokens)
 
-	return apiResp.Choices[0].Message.Content, nil
+	return restore(apiResp.Choices[0].Message.Content), nil
+}
+
+// readStream accumulates content deltas from a chat completion stream,
+// reporting each delta to progress and the billed tokens in usage
+func (op *OpenAIProvider) readStream(body io.Reader, operation string, attempt int, progress AIProgressFunc, usage *openAIUsage) (string, error) {
+	var content strings.Builder
+
+	err := readSSE(body, func(event sseEvent) (bool, error) {
+		if event.Data == "" {
+			return true, nil
+		}
+		if event.Data == "[DONE]" {
+			return false, nil
+		}
+
+		var chunk openAIStreamChunk
+		if err := json.Unmarshal([]byte(event.Data), &chunk); err != nil {
+			return false, fmt.Errorf("failed to parse stream chunk: %w", err)
+		}
+		if chunk.Error != nil {
+			return false, fmt.Errorf("OpenAI API error: %s", chunk.Error.Message)
+		}
+		if chunk.Usage != nil {
+			*usage = *chunk.Usage
+		}
+
+		for _, choice := range chunk.Choices {
+			if choice.Delta.Content == "" {
+				continue
+			}
+			content.WriteString(choice.Delta.Content)
+			progress(AIProgressEvent{
+				Provider:      op.id,
+				Operation:     operation,
+				Stage:         "streaming",
+				Delta:         choice.Delta.Content,
+				ReceivedChars: content.Len(),
+				Attempt:       attempt,
+			})
+		}
+		return true, nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	atomic.AddInt64(&op.stats.TotalTokens, int64(usage.TotalTokens))
+	progress(AIProgressEvent{
+		Provider:      op.id,
+		Operation:     operation,
+		Stage:         "completed",
+		ReceivedChars: content.Len(),
+		InputTokens:   usage.PromptTokens,
+		OutputTokens:  usage.CompletionTokens,
+		Attempt:       attempt,
+	})
+
+	if content.Len() == 0 {
+		return "", fmt.Errorf("no response from OpenAI")
+	}
+	return content.String(), nil
+}
+
+// resolveModel returns the configured model, asking the server for its
+// first listed model when none was configured
+func (op *OpenAIProvider) resolveModel(ctx context.Context) (string, error) {
+	op.modelMu.Lock()
+	defer op.modelMu.Unlock()
+
+	if op.model != "" {
+		return op.model, nil
+	}
+
+	models, err := op.ListModels(ctx)
+	if err != nil {
+		return "", fmt.Errorf("no model configured and model discovery failed: %w", err)
+	}
+	if len(models) == 0 {
+		return "", fmt.Errorf("no model configured and %s serves no models", op.endpoint)
+	}
+	op.model = models[0]
+	return op.model, nil
+}
+
+// ListModels returns the ids of the models the server offers
+func (op *OpenAIProvider) ListModels(ctx context.Context) ([]string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", op.endpoint+"/models", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+	if op.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+op.apiKey)
+	}
+
+	resp, err := op.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("model list request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read model list: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("model list request failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var list struct {
+		Data []struct {
+			ID string `json:"id"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &list); err != nil {
+		return nil, fmt.Errorf("failed to parse model list: %w", err)
+	}
+
+	models := make([]string, 0, len(list.Data))
+	for _, model := range list.Data {
+		if model.ID != "" {
+			models = append(models, model.ID)
+		}
+	}
+	return models, nil
 }
 
 // GetProvider returns the provider name
 func (op *OpenAIProvider) GetProvider() AIProvider {
-	return ProviderOpenAI
+	return op.id
 }
 
 // IsAvailable checks if the service is configured
@@ -424,7 +682,7 @@ Extract as many relevant fields as possible. Use descriptive field names. For mo
 		{Role: "user", Content: userPrompt},
 	}
 
-	response, err := op.makeRequest(ctx, messages, true)
+	response, err := op.makeRequest(ctx, messages, structuredOutputFor("document_field_extraction", DocumentFieldExtraction{}))
 	if err != nil {
 		atomic.AddInt64(&op.stats.FailedCalls, 1)
 		return nil, err
@@ -496,7 +754,7 @@ Focus on creating high-confidence mappings. Consider field names, data types, an
 		{Role: "user", Content: userPrompt},
 	}
 
-	response, err := op.makeRequest(ctx, messages, true)
+	response, err := op.makeRequest(ctx, messages, structuredOutputFor("field_mapping_result", FieldMappingResult{}))
 	if err != nil {
 		atomic.AddInt64(&op.stats.FailedCalls, 1)
 		return nil, err
@@ -549,7 +807,7 @@ Common formatting patterns:
 		{Role: "user", Content: userPrompt},
 	}
 
-	response, err := op.makeRequest(ctx, messages, true)
+	response, err := op.makeRequest(ctx, messages, structuredOutputFor("formatted_field_value", FormattedFieldValue{}))
 	if err != nil {
 		atomic.AddInt64(&op.stats.FailedCalls, 1)
 		return nil, err
@@ -616,7 +874,7 @@ Validation types:
 		{Role: "user", Content: userPrompt},
 	}
 
-	response, err := op.makeRequest(ctx, messages, true)
+	response, err := op.makeRequest(ctx, messages, structuredOutputFor("validation_result", ValidationResult{}))
 	if err != nil {
 		atomic.AddInt64(&op.stats.FailedCalls, 1)
 		return nil, err
@@ -691,7 +949,7 @@ Provide your response in JSON format with the following structure:
 		{Role: "user", Content: userPrompt},
 	}
 
-	response, err := op.makeRequest(ctx, messages, true)
+	response, err := op.makeRequest(ctx, messages, structuredOutputFor("company_deal_extraction", CompanyDealExtraction{}))
 	if err != nil {
 		atomic.AddInt64(&op.stats.FailedCalls, 1)
 		return nil, err
@@ -790,7 +1048,7 @@ Provide your response in JSON format with the following structure:
 		{Role: "user", Content: userPrompt},
 	}
 
-	response, err := op.makeRequest(ctx, messages, true)
+	response, err := op.makeRequest(ctx, messages, structuredOutputFor("financial_metrics_extraction", FinancialMetricsExtraction{}))
 	if err != nil {
 		atomic.AddInt64(&op.stats.FailedCalls, 1)
 		return nil, err
@@ -878,7 +1136,7 @@ Provide your response in JSON format with the following structure:
 		{Role: "user", Content: userPrompt},
 	}
 
-	response, err := op.makeRequest(ctx, messages, true)
+	response, err := op.makeRequest(ctx, messages, structuredOutputFor("personnel_role_extraction", PersonnelRoleExtraction{}))
 	if err != nil {
 		atomic.AddInt64(&op.stats.FailedCalls, 1)
 		return nil, err
@@ -1006,7 +1264,7 @@ Provide your response in JSON format with the following structure:
 		{Role: "user", Content: userPrompt},
 	}
 
-	response, err := op.makeRequest(ctx, messages, true)
+	response, err := op.makeRequest(ctx, messages, structuredOutputFor("cross_document_validation", CrossDocumentValidation{}))
 	if err != nil {
 		atomic.AddInt64(&op.stats.FailedCalls, 1)
 		return nil, err
@@ -1058,7 +1316,7 @@ Provide semantic analysis including:
 		{Role: "system", Content: systemPrompt},
 		{Role: "user", Content: userPrompt},
 	}
-	response, err := op.makeRequest(ctx, messages, true)
+	response, err := op.makeRequest(ctx, messages, structuredOutputFor("field_semantic_analysis", FieldSemanticAnalysis{}))
 	if err != nil {
 		atomic.AddInt64(&op.stats.FailedCalls, 1)
 		return nil, fmt.Errorf("OpenAI API request failed: %w", err)
@@ -1127,7 +1385,7 @@ Provide:
 		{Role: "system", Content: systemPrompt},
 		{Role: "user", Content: userPrompt},
 	}
-	response, err := op.makeRequest(ctx, messages, true)
+	response, err := op.makeRequest(ctx, messages, structuredOutputFor("semantic_mapping_result", SemanticMappingResult{}))
 	if err != nil {
 		atomic.AddInt64(&op.stats.FailedCalls, 1)
 		return nil, fmt.Errorf("OpenAI API request failed: %w", err)
@@ -1179,7 +1437,7 @@ Provide:
 		{Role: "system", Content: systemPrompt},
 		{Role: "user", Content: userPrompt},
 	}
-	response, err := op.makeRequest(ctx, messages, true)
+	response, err := op.makeRequest(ctx, messages, structuredOutputFor("conflict_resolution_result", ConflictResolutionResult{}))
 	if err != nil {
 		atomic.AddInt64(&op.stats.FailedCalls, 1)
 		return nil, fmt.Errorf("OpenAI API request failed: %w", err)
@@ -1237,7 +1495,7 @@ Provide:
 		{Role: "system", Content: systemPrompt},
 		{Role: "user", Content: userPrompt},
 	}
-	response, err := op.makeRequest(ctx, messages, true)
+	response, err := op.makeRequest(ctx, messages, structuredOutputFor("template_structure_analysis", TemplateStructureAnalysis{}))
 	if err != nil {
 		atomic.AddInt64(&op.stats.FailedCalls, 1)
 		return nil, fmt.Errorf("OpenAI API request failed: %w", err)
@@ -1290,7 +1548,7 @@ Provide:
 		{Role: "system", Content: systemPrompt},
 		{Role: "user", Content: userPrompt},
 	}
-	response, err := op.makeRequest(ctx, messages, true)
+	response, err := op.makeRequest(ctx, messages, structuredOutputFor("mapping_validation_result", MappingValidationResult{}))
 	if err != nil {
 		atomic.AddInt64(&op.stats.FailedCalls, 1)
 		return nil, fmt.Errorf("OpenAI API request failed: %w", err)
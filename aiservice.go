@@ -2,9 +2,14 @@ package main
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
+
+	"DealDone/cache"
 )
 
 // AIProvider represents different AI service providers
@@ -13,6 +18,7 @@ type AIProvider string
 const (
 	ProviderOpenAI  AIProvider = "openai"
 	ProviderClaude  AIProvider = "claude"
+	ProviderLocal   AIProvider = "local" // Endpoints register as "local:<name>"
 	ProviderDefault AIProvider = "default"
 )
 
@@ -59,46 +65,263 @@ type AIServiceInterface interface {
 
 // AIService is the main AI service that manages multiple providers
 type AIService struct {
-	providers       map[AIProvider]AIServiceInterface
-	primaryProvider AIProvider
-	fallbackOrder   []AIProvider
-	cache           *AICache
-	rateLimiter     *RateLimiter
-	mu              sync.RWMutex
+	providers        map[AIProvider]AIServiceInterface
+	primaryProvider  AIProvider
+	fallbackOrder    []AIProvider
+	models           map[AIProvider]string // Model each provider answers with, for cache keys
+	promptVersion    string
+	cache            *AICache
+	usage            *AIUsageLedger // Optional; records spend and enforces deal budgets
+	pricing          *AIPriceTable
+	policy           *OutboundPolicy // Screens every request sent to a provider
+	audit            *AuditLogger    // Kept so a reconfigured policy keeps logging
+	rateLimiter      *RateLimiter
+	chunker          *DocumentChunker
+	conflictResolver *ConflictResolver
+	mu               sync.RWMutex // Guards the fields Reconfigure replaces
 }
 
 // NewAIService creates a new AI service with configured providers
 func NewAIService(config *AIConfig) *AIService {
 	service := &AIService{
 		providers:     make(map[AIProvider]AIServiceInterface),
+		models:        make(map[AIProvider]string),
+		promptVersion: promptCacheVersion(config.PromptSettings),
 		cache:         NewAICache(config.CacheTTL),
+		pricing:       NewAIPriceTable(config.Pricing),
+		policy:        NewOutboundPolicy(config.SecuritySettings),
 		rateLimiter:   NewRateLimiter(config.RateLimit),
 		fallbackOrder: []AIProvider{},
+		chunker:       NewDocumentChunker(config.AnalysisSettings.ChunkTokens, config.AnalysisSettings.ChunkOverlapTokens),
+		// In-memory until the app supplies its persistent resolver
+		conflictResolver: NewConflictResolver("", nil),
+	}
+
+	// Local endpoints come first so content stays on the network whenever
+	// one can answer
+	for _, endpoint := range config.LocalEndpoints {
+		provider, err := NewLocalProvider(endpoint)
+		if err != nil {
+			continue
+		}
+		if _, exists := service.providers[provider.GetProvider()]; exists {
+			continue
+		}
+		service.providers[provider.GetProvider()] = provider
+		service.models[provider.GetProvider()] = endpoint.Model
+		service.fallbackOrder = append(service.fallbackOrder, provider.GetProvider())
 	}
 
-	// Initialize providers based on config
-	if config.OpenAIKey != "" {
+	// Initialize providers based on config. Air-gapped deployments never
+	// register the hosted APIs.
+	if config.OpenAIKey != "" && !config.LocalOnly {
 		service.providers[ProviderOpenAI] = NewOpenAIProvider(config.OpenAIKey, config.OpenAIModel)
+		service.models[ProviderOpenAI] = config.OpenAIModel
 		service.fallbackOrder = append(service.fallbackOrder, ProviderOpenAI)
 	}
 
-	if config.ClaudeKey != "" {
+	if config.ClaudeKey != "" && !config.LocalOnly {
 		service.providers[ProviderClaude] = NewClaudeProvider(config.ClaudeKey, config.ClaudeModel)
+		service.models[ProviderClaude] = config.ClaudeModel
 		service.fallbackOrder = append(service.fallbackOrder, ProviderClaude)
 	}
 
 	// Always add default provider as last fallback
 	service.providers[ProviderDefault] = NewDefaultProvider()
+	service.models[ProviderDefault] = "rule-based"
 	service.fallbackOrder = append(service.fallbackOrder, ProviderDefault)
 
 	// Set primary provider
 	if len(service.fallbackOrder) > 0 {
 		service.primaryProvider = service.fallbackOrder[0]
 	}
+	service.cache.SetScope(service.primaryProvider, service.models[service.primaryProvider], service.promptVersion)
 
 	return service
 }
 
+// aiPromptVersion must be bumped whenever provider prompts change so
+// responses cached under the old prompts are no longer used
+const aiPromptVersion = "1"
+
+// promptCacheVersion identifies the prompts and prompt settings responses
+// are generated with
+func promptCacheVersion(settings PromptSettings) string {
+	data, _ := json.Marshal(settings)
+	sum := sha256.Sum256(data)
+	return aiPromptVersion + "-" + hex.EncodeToString(sum[:])[:12]
+}
+
+// SetCacheStore persists cached responses in store so they survive restarts
+func (as *AIService) SetCacheStore(store cache.Store) {
+	if store != nil {
+		as.cache.SetStore(store)
+	}
+}
+
+// GetCacheStats returns statistics for the response cache
+func (as *AIService) GetCacheStats() map[string]interface{} {
+	return as.cache.GetStats()
+}
+
+// ClearCache removes every cached response, including persisted ones
+func (as *AIService) ClearCache() error {
+	return as.cache.Clear()
+}
+
+// SetUsageLedger records the spend of every provider request in ledger and
+// enforces deal budgets
+func (as *AIService) SetUsageLedger(ledger *AIUsageLedger) {
+	as.usage = ledger
+}
+
+// SetAuditLogger records the outbound policy's decisions in logger
+func (as *AIService) SetAuditLogger(logger *AuditLogger) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+	as.audit = logger
+	if as.policy != nil {
+		as.policy.SetAuditLogger(logger)
+	}
+}
+
+// Reconfigure applies a changed configuration in place. Every component
+// holding the service uses the new providers and outbound policy from its
+// next request, so switching to local-only takes effect everywhere at once.
+func (as *AIService) Reconfigure(config *AIConfig) {
+	next := NewAIService(config)
+
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	next.policy.SetAuditLogger(as.audit)
+	as.providers = next.providers
+	as.models = next.models
+	as.fallbackOrder = next.fallbackOrder
+	as.primaryProvider = next.primaryProvider
+	as.promptVersion = next.promptVersion
+	as.pricing = next.pricing
+	as.policy = next.policy
+	as.rateLimiter = next.rateLimiter
+	as.chunker = next.chunker
+	as.cache.SetScope(as.primaryProvider, as.models[as.primaryProvider], as.promptVersion)
+}
+
+// OutboundPolicy returns the policy requests are screened with
+func (as *AIService) OutboundPolicy() *OutboundPolicy {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+	return as.policy
+}
+
+// provider returns a configured provider
+func (as *AIService) provider(name AIProvider) (AIServiceInterface, bool) {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+	p, exists := as.providers[name]
+	return p, exists
+}
+
+// primary returns the primary provider
+func (as *AIService) primary() AIProvider {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+	return as.primaryProvider
+}
+
+// limiter returns the rate limiter requests wait on
+func (as *AIService) limiter() *RateLimiter {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+	return as.rateLimiter
+}
+
+// splitter returns the chunker long documents are split with
+func (as *AIService) splitter() *DocumentChunker {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+	return as.chunker
+}
+
+// admitRequest checks the budget of the deal a request is made for and
+// attaches spend recording and the outbound policy to the context. Deals
+// past their soft cap are answered by the rule-based provider; deals past
+// their hard cap are refused.
+func (as *AIService) admitRequest(ctx context.Context, operation string) (context.Context, error) {
+	as.mu.RLock()
+	policy, pricing := as.policy, as.pricing
+	as.mu.RUnlock()
+
+	ctx = policy.attach(ctx, operation)
+	if as.usage == nil {
+		return ctx, nil
+	}
+	dealName := aiDealFromContext(ctx)
+	if dealName != "" {
+		status := as.usage.BudgetStatus(dealName)
+		switch status.State {
+		case BudgetStateHardExceeded:
+			return ctx, fmt.Errorf("%w: deal %s has spent $%.2f and %d tokens", ErrAIBudgetExceeded, dealName, status.Spent.CostUSD, status.Spent.TotalTokens)
+		case BudgetStateSoftExceeded:
+			ctx = context.WithValue(ctx, aiDegradedKey{}, true)
+		}
+	}
+
+	ledger := as.usage
+	record := aiUsageFunc(func(provider AIProvider, model string, inputTokens, outputTokens int) {
+		err := ledger.Record(AIUsageRecord{
+			DealName:     dealName,
+			Provider:     provider,
+			Model:        model,
+			Operation:    operation,
+			InputTokens:  inputTokens,
+			OutputTokens: outputTokens,
+			CostUSD:      pricing.Cost(model, inputTokens, outputTokens),
+		})
+		if err != nil {
+			fmt.Printf("Warning: Failed to record AI usage: %v\n", err)
+		}
+	})
+	return context.WithValue(ctx, aiUsageKey{}, record), nil
+}
+
+// providerOrder returns the providers to try for a request in order
+func (as *AIService) providerOrder(ctx context.Context) []AIProvider {
+	if aiBudgetDegraded(ctx) {
+		return []AIProvider{ProviderDefault}
+	}
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+	return as.fallbackOrder
+}
+
+// cacheResult caches a provider response. Only responses from the primary
+// provider are persisted, since keys are scoped to it; fallback responses
+// are kept for this session only.
+func (as *AIService) cacheResult(key string, provider AIProvider, result interface{}) {
+	if provider == as.primary() {
+		as.cache.Set(key, result)
+		return
+	}
+	as.cache.SetTransient(key, result)
+}
+
+// cacheChunkedResult caches a response merged from chunk results, persisting
+// it only when every chunk was answered by the primary provider
+func (as *AIService) cacheChunkedResult(key string, results []chunkResult, warnings []string, merged interface{}) {
+	primary := as.primary()
+	provider := primary
+	if len(warnings) > 0 {
+		provider = ""
+	}
+	for _, result := range results {
+		if result.provider != primary {
+			provider = result.provider
+		}
+	}
+	as.cacheResult(key, provider, merged)
+}
+
 // AIConfig holds configuration for AI services
 type AIConfig struct {
 	OpenAIKey   string        `json:"openai_key"`
@@ -118,6 +341,16 @@ type AIConfig struct {
 	PromptSettings    PromptSettings   `json:"prompt_settings"`
 	AnalysisSettings  AnalysisSettings `json:"analysis_settings"`
 	SecuritySettings  SecuritySettings `json:"security_settings"`
+
+	// Local OpenAI-compatible servers; LocalOnly disables the hosted APIs
+	LocalEndpoints []LocalEndpoint `json:"local_endpoints,omitempty"`
+	LocalOnly      bool            `json:"local_only"`
+
+	// Per-model prices in USD per million tokens, overriding the defaults
+	Pricing map[string]ModelPrice `json:"pricing,omitempty"`
+
+	// Embedding model for correction retrieval
+	Embeddings EmbeddingSettings `json:"embeddings"`
 }
 
 // AIClassificationResult represents the classification result from AI
@@ -133,28 +366,31 @@ type AIClassificationResult struct {
 
 // FinancialAnalysis represents extracted financial data
 type FinancialAnalysis struct {
-	Revenue          float64            `json:"revenue"`
-	EBITDA           float64            `json:"ebitda"`
-	NetIncome        float64            `json:"netIncome"`
-	TotalAssets      float64            `json:"totalAssets"`
-	TotalLiabilities float64            `json:"totalLiabilities"`
-	CashFlow         float64            `json:"cashFlow"`
-	GrossMargin      float64            `json:"grossMargin"`
-	OperatingMargin  float64            `json:"operatingMargin"`
-	Confidence       float64            `json:"confidence"`
-	Period           string             `json:"period"`
-	Currency         string             `json:"currency"`
-	DataPoints       map[string]float64 `json:"dataPoints"`
-	Warnings         []string           `json:"warnings"`
+	Revenue          float64             `json:"revenue"`
+	EBITDA           float64             `json:"ebitda"`
+	NetIncome        float64             `json:"netIncome"`
+	TotalAssets      float64             `json:"totalAssets"`
+	TotalLiabilities float64             `json:"totalLiabilities"`
+	CashFlow         float64             `json:"cashFlow"`
+	GrossMargin      float64             `json:"grossMargin"`
+	OperatingMargin  float64             `json:"operatingMargin"`
+	Confidence       float64             `json:"confidence"`
+	Period           string              `json:"period"`
+	Currency         string              `json:"currency"`
+	DataPoints       map[string]float64  `json:"dataPoints"`
+	LineItems        []FinancialLineItem `json:"lineItems,omitempty"`
+	Warnings         []string            `json:"warnings"`
+	Provenance       []FieldProvenance   `json:"provenance,omitempty" jsonschema:"-"` // Set when merged from chunks
 }
 
 // RiskAnalysis represents risk assessment results
 type RiskAnalysis struct {
-	OverallRiskScore float64    `json:"overallRiskScore"`
-	RiskCategories   []RiskItem `json:"riskCategories"`
-	Recommendations  []string   `json:"recommendations"`
-	CriticalIssues   []string   `json:"criticalIssues"`
-	Confidence       float64    `json:"confidence"`
+	OverallRiskScore float64           `json:"overallRiskScore"`
+	RiskCategories   []RiskItem        `json:"riskCategories"`
+	Recommendations  []string          `json:"recommendations"`
+	CriticalIssues   []string          `json:"criticalIssues"`
+	Confidence       float64           `json:"confidence"`
+	Provenance       []FieldProvenance `json:"provenance,omitempty" jsonschema:"-"` // Set when merged from chunks
 }
 
 // RiskItem represents a specific risk
@@ -201,12 +437,13 @@ type Entity struct {
 
 // DocumentFieldExtraction represents structured field data extracted from documents
 type DocumentFieldExtraction struct {
-	Fields     map[string]interface{} `json:"fields"`     // Raw extracted field values
-	Confidence float64                `json:"confidence"` // Overall extraction confidence
-	FieldTypes map[string]string      `json:"fieldTypes"` // Detected field types (currency, date, text, etc.)
-	Metadata   map[string]interface{} `json:"metadata"`   // Additional extraction metadata
-	Warnings   []string               `json:"warnings"`   // Extraction warnings or issues
-	Source     string                 `json:"source"`     // Source document information
+	Fields     map[string]interface{} `json:"fields"`                              // Raw extracted field values
+	Confidence float64                `json:"confidence"`                          // Overall extraction confidence
+	FieldTypes map[string]string      `json:"fieldTypes"`                          // Detected field types (currency, date, text, etc.)
+	Metadata   map[string]interface{} `json:"metadata"`                            // Additional extraction metadata
+	Warnings   []string               `json:"warnings"`                            // Extraction warnings or issues
+	Source     string                 `json:"source"`                              // Source document information
+	Provenance []FieldProvenance      `json:"provenance,omitempty" jsonschema:"-"` // Per-field chunk sources when merged from chunks
 }
 
 // FieldMappingResult represents the result of mapping document fields to template fields
@@ -261,25 +498,28 @@ type AIUsageStats struct {
 func (as *AIService) ClassifyDocument(ctx context.Context, content string, metadata map[string]interface{}) (*AIClassificationResult, error) {
 	// Check cache first
 	cacheKey := as.cache.GenerateKey("classify", content, metadata)
-	if cached := as.cache.Get(cacheKey); cached != nil {
-		if result, ok := cached.(*AIClassificationResult); ok {
-			return result, nil
-		}
+	if result, ok := cachedValue[AIClassificationResult](as.cache, cacheKey); ok {
+		return result, nil
+	}
+
+	ctx, err := as.admitRequest(ctx, "classify")
+	if err != nil {
+		return nil, err
 	}
 
 	// Rate limiting
-	if err := as.rateLimiter.Wait(ctx); err != nil {
+	if err := as.limiter().Wait(ctx); err != nil {
 		return nil, fmt.Errorf("rate limit exceeded: %w", err)
 	}
 
 	// Try each provider in fallback order
 	var lastError error
-	for _, provider := range as.fallbackOrder {
-		if p, exists := as.providers[provider]; exists && p.IsAvailable() {
+	for _, provider := range as.providerOrder(ctx) {
+		if p, exists := as.provider(provider); exists && p.IsAvailable() {
 			result, err := p.ClassifyDocument(ctx, content, metadata)
 			if err == nil {
 				// Cache successful result
-				as.cache.Set(cacheKey, result)
+				as.cacheResult(cacheKey, provider, result)
 				return result, nil
 			}
 			lastError = err
@@ -293,24 +533,42 @@ func (as *AIService) ClassifyDocument(ctx context.Context, content string, metad
 func (as *AIService) ExtractFinancialData(ctx context.Context, content string) (*FinancialAnalysis, error) {
 	// Check cache
 	cacheKey := as.cache.GenerateKey("financial", content, nil)
-	if cached := as.cache.Get(cacheKey); cached != nil {
-		if result, ok := cached.(*FinancialAnalysis); ok {
-			return result, nil
+	if result, ok := cachedValue[FinancialAnalysis](as.cache, cacheKey); ok {
+		return result, nil
+	}
+
+	ctx, err := as.admitRequest(ctx, "financial")
+	if err != nil {
+		return nil, err
+	}
+
+	// Long documents are extracted chunk by chunk and merged
+	chunks := as.splitter().Split(content)
+	if len(chunks) > 1 {
+		results, warnings, err := as.mapChunks(ctx, chunks, func(ctx context.Context, p AIServiceInterface, chunk DocumentChunk) (interface{}, error) {
+			return p.ExtractFinancialData(ctx, chunk.Text)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("financial extraction failed: %w", err)
 		}
+		result := as.mergeFinancialAnalyses(ctx, results, warnings)
+		as.cacheChunkedResult(cacheKey, results, warnings, result)
+		return result, nil
 	}
+	content = chunks[0].Text // Page breaks removed
 
 	// Rate limiting
-	if err := as.rateLimiter.Wait(ctx); err != nil {
+	if err := as.limiter().Wait(ctx); err != nil {
 		return nil, fmt.Errorf("rate limit exceeded: %w", err)
 	}
 
 	// Try providers with fallback
 	var lastError error
-	for _, provider := range as.fallbackOrder {
-		if p, exists := as.providers[provider]; exists && p.IsAvailable() {
+	for _, provider := range as.providerOrder(ctx) {
+		if p, exists := as.provider(provider); exists && p.IsAvailable() {
 			result, err := p.ExtractFinancialData(ctx, content)
 			if err == nil {
-				as.cache.Set(cacheKey, result)
+				as.cacheResult(cacheKey, provider, result)
 				return result, nil
 			}
 			lastError = err
@@ -322,11 +580,15 @@ func (as *AIService) ExtractFinancialData(ctx context.Context, content string) (
 
 // SetPrimaryProvider changes the primary AI provider
 func (as *AIService) SetPrimaryProvider(provider AIProvider) error {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
 	if _, exists := as.providers[provider]; !exists {
 		return fmt.Errorf("provider %s not configured", provider)
 	}
 
 	as.primaryProvider = provider
+	as.cache.SetScope(provider, as.models[provider], as.promptVersion)
 
 	// Reorder fallback list to put primary first
 	newOrder := []AIProvider{provider}
@@ -340,8 +602,19 @@ func (as *AIService) SetPrimaryProvider(provider AIProvider) error {
 	return nil
 }
 
+// SetConflictResolver routes conflicts between chunk results through
+// resolver so they share its history and audit trail
+func (as *AIService) SetConflictResolver(resolver *ConflictResolver) {
+	if resolver != nil {
+		as.conflictResolver = resolver
+	}
+}
+
 // GetAvailableProviders returns list of configured providers
 func (as *AIService) GetAvailableProviders() []AIProvider {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
 	providers := []AIProvider{}
 	for provider, p := range as.providers {
 		if p.IsAvailable() {
@@ -360,24 +633,42 @@ func (as *AIService) IsAvailable() bool {
 func (as *AIService) AnalyzeRisks(ctx context.Context, content string, docType string) (*RiskAnalysis, error) {
 	// Check cache
 	cacheKey := as.cache.GenerateKey("risk", content, map[string]interface{}{"docType": docType})
-	if cached := as.cache.Get(cacheKey); cached != nil {
-		if result, ok := cached.(*RiskAnalysis); ok {
-			return result, nil
+	if result, ok := cachedValue[RiskAnalysis](as.cache, cacheKey); ok {
+		return result, nil
+	}
+
+	ctx, err := as.admitRequest(ctx, "risk")
+	if err != nil {
+		return nil, err
+	}
+
+	// Long documents are assessed chunk by chunk and merged
+	chunks := as.splitter().Split(content)
+	if len(chunks) > 1 {
+		results, warnings, err := as.mapChunks(ctx, chunks, func(ctx context.Context, p AIServiceInterface, chunk DocumentChunk) (interface{}, error) {
+			return p.AnalyzeRisks(ctx, chunk.Text, docType)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("risk analysis failed: %w", err)
 		}
+		result := mergeRiskAnalyses(results, warnings)
+		as.cacheChunkedResult(cacheKey, results, warnings, result)
+		return result, nil
 	}
+	content = chunks[0].Text // Page breaks removed
 
 	// Rate limiting
-	if err := as.rateLimiter.Wait(ctx); err != nil {
+	if err := as.limiter().Wait(ctx); err != nil {
 		return nil, fmt.Errorf("rate limit exceeded: %w", err)
 	}
 
 	// Try providers with fallback
 	var lastError error
-	for _, provider := range as.fallbackOrder {
-		if p, exists := as.providers[provider]; exists && p.IsAvailable() {
+	for _, provider := range as.providerOrder(ctx) {
+		if p, exists := as.provider(provider); exists && p.IsAvailable() {
 			result, err := p.AnalyzeRisks(ctx, content, docType)
 			if err == nil {
-				as.cache.Set(cacheKey, result)
+				as.cacheResult(cacheKey, provider, result)
 				return result, nil
 			}
 			lastError = err
@@ -390,24 +681,27 @@ func (as *AIService) AnalyzeRisks(ctx context.Context, content string, docType s
 func (as *AIService) GenerateInsights(ctx context.Context, content string, docType string) (*DocumentInsights, error) {
 	// Check cache
 	cacheKey := as.cache.GenerateKey("insights", content, map[string]interface{}{"docType": docType})
-	if cached := as.cache.Get(cacheKey); cached != nil {
-		if result, ok := cached.(*DocumentInsights); ok {
-			return result, nil
-		}
+	if result, ok := cachedValue[DocumentInsights](as.cache, cacheKey); ok {
+		return result, nil
+	}
+
+	ctx, err := as.admitRequest(ctx, "insights")
+	if err != nil {
+		return nil, err
 	}
 
 	// Rate limiting
-	if err := as.rateLimiter.Wait(ctx); err != nil {
+	if err := as.limiter().Wait(ctx); err != nil {
 		return nil, fmt.Errorf("rate limit exceeded: %w", err)
 	}
 
 	// Try providers with fallback
 	var lastError error
-	for _, provider := range as.fallbackOrder {
-		if p, exists := as.providers[provider]; exists && p.IsAvailable() {
+	for _, provider := range as.providerOrder(ctx) {
+		if p, exists := as.provider(provider); exists && p.IsAvailable() {
 			result, err := p.GenerateInsights(ctx, content, docType)
 			if err == nil {
-				as.cache.Set(cacheKey, result)
+				as.cacheResult(cacheKey, provider, result)
 				return result, nil
 			}
 			lastError = err
@@ -420,24 +714,43 @@ func (as *AIService) GenerateInsights(ctx context.Context, content string, docTy
 func (as *AIService) ExtractEntities(ctx context.Context, content string) (*EntityExtraction, error) {
 	// Check cache
 	cacheKey := as.cache.GenerateKey("entities", content, nil)
-	if cached := as.cache.Get(cacheKey); cached != nil {
-		if result, ok := cached.(*EntityExtraction); ok {
-			return result, nil
+	if result, ok := cachedValue[EntityExtraction](as.cache, cacheKey); ok {
+		return result, nil
+	}
+
+	ctx, err := as.admitRequest(ctx, "entities")
+	if err != nil {
+		return nil, err
+	}
+
+	// Long documents are extracted chunk by chunk and merged. Entities
+	// don't conflict, so chunk failures are simply skipped.
+	chunks := as.splitter().Split(content)
+	if len(chunks) > 1 {
+		results, warnings, err := as.mapChunks(ctx, chunks, func(ctx context.Context, p AIServiceInterface, chunk DocumentChunk) (interface{}, error) {
+			return p.ExtractEntities(ctx, chunk.Text)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("entity extraction failed: %w", err)
 		}
+		result := mergeEntityExtractions(results)
+		as.cacheChunkedResult(cacheKey, results, warnings, result)
+		return result, nil
 	}
+	content = chunks[0].Text // Page breaks removed
 
 	// Rate limiting
-	if err := as.rateLimiter.Wait(ctx); err != nil {
+	if err := as.limiter().Wait(ctx); err != nil {
 		return nil, fmt.Errorf("rate limit exceeded: %w", err)
 	}
 
 	// Try providers with fallback
 	var lastError error
-	for _, provider := range as.fallbackOrder {
-		if p, exists := as.providers[provider]; exists && p.IsAvailable() {
+	for _, provider := range as.providerOrder(ctx) {
+		if p, exists := as.provider(provider); exists && p.IsAvailable() {
 			result, err := p.ExtractEntities(ctx, content)
 			if err == nil {
-				as.cache.Set(cacheKey, result)
+				as.cacheResult(cacheKey, provider, result)
 				return result, nil
 			}
 			lastError = err
@@ -456,24 +769,42 @@ func (as *AIService) ExtractDocumentFields(ctx context.Context, content string,
 		"documentType": documentType,
 		"context":      templateContext,
 	})
-	if cached := as.cache.Get(cacheKey); cached != nil {
-		if result, ok := cached.(*DocumentFieldExtraction); ok {
-			return result, nil
+	if result, ok := cachedValue[DocumentFieldExtraction](as.cache, cacheKey); ok {
+		return result, nil
+	}
+
+	ctx, err := as.admitRequest(ctx, "extract_fields")
+	if err != nil {
+		return nil, err
+	}
+
+	// Long documents are extracted chunk by chunk and merged
+	chunks := as.splitter().Split(content)
+	if len(chunks) > 1 {
+		results, warnings, err := as.mapChunks(ctx, chunks, func(ctx context.Context, p AIServiceInterface, chunk DocumentChunk) (interface{}, error) {
+			return p.ExtractDocumentFields(ctx, chunk.Text, documentType, templateContext)
+		})
+		if err != nil {
+			return nil, fmt.Errorf("document field extraction failed: %w", err)
 		}
+		result := as.mergeDocumentFieldExtractions(ctx, results, warnings)
+		as.cacheChunkedResult(cacheKey, results, warnings, result)
+		return result, nil
 	}
+	content = chunks[0].Text // Page breaks removed
 
 	// Rate limiting
-	if err := as.rateLimiter.Wait(ctx); err != nil {
+	if err := as.limiter().Wait(ctx); err != nil {
 		return nil, fmt.Errorf("rate limit exceeded: %w", err)
 	}
 
 	// Try providers with fallback
 	var lastError error
-	for _, provider := range as.fallbackOrder {
-		if p, exists := as.providers[provider]; exists && p.IsAvailable() {
+	for _, provider := range as.providerOrder(ctx) {
+		if p, exists := as.provider(provider); exists && p.IsAvailable() {
 			result, err := p.ExtractDocumentFields(ctx, content, documentType, templateContext)
 			if err == nil {
-				as.cache.Set(cacheKey, result)
+				as.cacheResult(cacheKey, provider, result)
 				return result, nil
 			}
 			lastError = err
@@ -491,24 +822,27 @@ func (as *AIService) MapFieldsToTemplate(ctx context.Context, extractedFields ma
 		"templateFields": templateFields,
 		"context":        mappingContext,
 	})
-	if cached := as.cache.Get(cacheKey); cached != nil {
-		if result, ok := cached.(*FieldMappingResult); ok {
-			return result, nil
-		}
+	if result, ok := cachedValue[FieldMappingResult](as.cache, cacheKey); ok {
+		return result, nil
+	}
+
+	ctx, err := as.admitRequest(ctx, "map_fields")
+	if err != nil {
+		return nil, err
 	}
 
 	// Rate limiting
-	if err := as.rateLimiter.Wait(ctx); err != nil {
+	if err := as.limiter().Wait(ctx); err != nil {
 		return nil, fmt.Errorf("rate limit exceeded: %w", err)
 	}
 
 	// Try providers with fallback
 	var lastError error
-	for _, provider := range as.fallbackOrder {
-		if p, exists := as.providers[provider]; exists && p.IsAvailable() {
+	for _, provider := range as.providerOrder(ctx) {
+		if p, exists := as.provider(provider); exists && p.IsAvailable() {
 			result, err := p.MapFieldsToTemplate(ctx, extractedFields, templateFields, mappingContext)
 			if err == nil {
-				as.cache.Set(cacheKey, result)
+				as.cacheResult(cacheKey, provider, result)
 				return result, nil
 			}
 			lastError = err
@@ -526,24 +860,27 @@ func (as *AIService) FormatFieldValue(ctx context.Context, rawValue interface{},
 		"fieldType":          fieldType,
 		"formatRequirements": formatRequirements,
 	})
-	if cached := as.cache.Get(cacheKey); cached != nil {
-		if result, ok := cached.(*FormattedFieldValue); ok {
-			return result, nil
-		}
+	if result, ok := cachedValue[FormattedFieldValue](as.cache, cacheKey); ok {
+		return result, nil
+	}
+
+	ctx, err := as.admitRequest(ctx, "format_field")
+	if err != nil {
+		return nil, err
 	}
 
 	// Rate limiting
-	if err := as.rateLimiter.Wait(ctx); err != nil {
+	if err := as.limiter().Wait(ctx); err != nil {
 		return nil, fmt.Errorf("rate limit exceeded: %w", err)
 	}
 
 	// Try providers with fallback
 	var lastError error
-	for _, provider := range as.fallbackOrder {
-		if p, exists := as.providers[provider]; exists && p.IsAvailable() {
+	for _, provider := range as.providerOrder(ctx) {
+		if p, exists := as.provider(provider); exists && p.IsAvailable() {
 			result, err := p.FormatFieldValue(ctx, rawValue, fieldType, formatRequirements)
 			if err == nil {
-				as.cache.Set(cacheKey, result)
+				as.cacheResult(cacheKey, provider, result)
 				return result, nil
 			}
 			lastError = err
@@ -560,24 +897,27 @@ func (as *AIService) ValidateTemplateData(ctx context.Context, templateData map[
 	cacheKey := as.cache.GenerateKey("validate_data", templateDataStr, map[string]interface{}{
 		"validationRules": validationRules,
 	})
-	if cached := as.cache.Get(cacheKey); cached != nil {
-		if result, ok := cached.(*ValidationResult); ok {
-			return result, nil
-		}
+	if result, ok := cachedValue[ValidationResult](as.cache, cacheKey); ok {
+		return result, nil
+	}
+
+	ctx, err := as.admitRequest(ctx, "validate_data")
+	if err != nil {
+		return nil, err
 	}
 
 	// Rate limiting
-	if err := as.rateLimiter.Wait(ctx); err != nil {
+	if err := as.limiter().Wait(ctx); err != nil {
 		return nil, fmt.Errorf("rate limit exceeded: %w", err)
 	}
 
 	// Try providers with fallback
 	var lastError error
-	for _, provider := range as.fallbackOrder {
-		if p, exists := as.providers[provider]; exists && p.IsAvailable() {
+	for _, provider := range as.providerOrder(ctx) {
+		if p, exists := as.provider(provider); exists && p.IsAvailable() {
 			result, err := p.ValidateTemplateData(ctx, templateData, validationRules)
 			if err == nil {
-				as.cache.Set(cacheKey, result)
+				as.cacheResult(cacheKey, provider, result)
 				return result, nil
 			}
 			lastError = err
@@ -618,25 +958,28 @@ func (as *AIService) ExtractCompanyAndDealNames(ctx context.Context, content str
 	cacheKey := as.cache.GenerateKey("company_deal_extract", content, map[string]interface{}{
 		"documentType": documentType,
 	})
-	if cached := as.cache.Get(cacheKey); cached != nil {
-		if result, ok := cached.(*CompanyDealExtraction); ok {
-			return result, nil
-		}
+	if result, ok := cachedValue[CompanyDealExtraction](as.cache, cacheKey); ok {
+		return result, nil
+	}
+
+	ctx, err := as.admitRequest(ctx, "company_deal_extract")
+	if err != nil {
+		return nil, err
 	}
 
 	// Rate limiting
-	if err := as.rateLimiter.Wait(ctx); err != nil {
+	if err := as.limiter().Wait(ctx); err != nil {
 		return nil, fmt.Errorf("rate limit exceeded: %w", err)
 	}
 
 	// Try providers with fallback
 	var lastError error
-	for _, provider := range as.fallbackOrder {
-		if p, exists := as.providers[provider]; exists && p.IsAvailable() {
+	for _, provider := range as.providerOrder(ctx) {
+		if p, exists := as.provider(provider); exists && p.IsAvailable() {
 			if enhancedProvider, ok := p.(EnhancedEntityExtractorInterface); ok {
 				result, err := enhancedProvider.ExtractCompanyAndDealNames(ctx, content, documentType)
 				if err == nil {
-					as.cache.Set(cacheKey, result)
+					as.cacheResult(cacheKey, provider, result)
 					return result, nil
 				}
 				lastError = err
@@ -653,25 +996,28 @@ func (as *AIService) ExtractFinancialMetrics(ctx context.Context, content string
 	cacheKey := as.cache.GenerateKey("financial_metrics", content, map[string]interface{}{
 		"documentType": documentType,
 	})
-	if cached := as.cache.Get(cacheKey); cached != nil {
-		if result, ok := cached.(*FinancialMetricsExtraction); ok {
-			return result, nil
-		}
+	if result, ok := cachedValue[FinancialMetricsExtraction](as.cache, cacheKey); ok {
+		return result, nil
+	}
+
+	ctx, err := as.admitRequest(ctx, "financial_metrics")
+	if err != nil {
+		return nil, err
 	}
 
 	// Rate limiting
-	if err := as.rateLimiter.Wait(ctx); err != nil {
+	if err := as.limiter().Wait(ctx); err != nil {
 		return nil, fmt.Errorf("rate limit exceeded: %w", err)
 	}
 
 	// Try providers with fallback
 	var lastError error
-	for _, provider := range as.fallbackOrder {
-		if p, exists := as.providers[provider]; exists && p.IsAvailable() {
+	for _, provider := range as.providerOrder(ctx) {
+		if p, exists := as.provider(provider); exists && p.IsAvailable() {
 			if enhancedProvider, ok := p.(EnhancedEntityExtractorInterface); ok {
 				result, err := enhancedProvider.ExtractFinancialMetrics(ctx, content, documentType)
 				if err == nil {
-					as.cache.Set(cacheKey, result)
+					as.cacheResult(cacheKey, provider, result)
 					return result, nil
 				}
 				lastError = err
@@ -688,25 +1034,28 @@ func (as *AIService) ExtractPersonnelAndRoles(ctx context.Context, content strin
 	cacheKey := as.cache.GenerateKey("personnel_roles", content, map[string]interface{}{
 		"documentType": documentType,
 	})
-	if cached := as.cache.Get(cacheKey); cached != nil {
-		if result, ok := cached.(*PersonnelRoleExtraction); ok {
-			return result, nil
-		}
+	if result, ok := cachedValue[PersonnelRoleExtraction](as.cache, cacheKey); ok {
+		return result, nil
+	}
+
+	ctx, err := as.admitRequest(ctx, "personnel_roles")
+	if err != nil {
+		return nil, err
 	}
 
 	// Rate limiting
-	if err := as.rateLimiter.Wait(ctx); err != nil {
+	if err := as.limiter().Wait(ctx); err != nil {
 		return nil, fmt.Errorf("rate limit exceeded: %w", err)
 	}
 
 	// Try providers with fallback
 	var lastError error
-	for _, provider := range as.fallbackOrder {
-		if p, exists := as.providers[provider]; exists && p.IsAvailable() {
+	for _, provider := range as.providerOrder(ctx) {
+		if p, exists := as.provider(provider); exists && p.IsAvailable() {
 			if enhancedProvider, ok := p.(EnhancedEntityExtractorInterface); ok {
 				result, err := enhancedProvider.ExtractPersonnelAndRoles(ctx, content, documentType)
 				if err == nil {
-					as.cache.Set(cacheKey, result)
+					as.cacheResult(cacheKey, provider, result)
 					return result, nil
 				}
 				lastError = err
@@ -724,25 +1073,28 @@ func (as *AIService) ValidateEntitiesAcrossDocuments(ctx context.Context, docume
 		"documentCount": len(documentExtractions),
 		"extractionIds": extractDocumentIds(documentExtractions),
 	})
-	if cached := as.cache.Get(cacheKey); cached != nil {
-		if result, ok := cached.(*CrossDocumentValidation); ok {
-			return result, nil
-		}
+	if result, ok := cachedValue[CrossDocumentValidation](as.cache, cacheKey); ok {
+		return result, nil
+	}
+
+	ctx, err := as.admitRequest(ctx, "cross_doc_validation")
+	if err != nil {
+		return nil, err
 	}
 
 	// Rate limiting
-	if err := as.rateLimiter.Wait(ctx); err != nil {
+	if err := as.limiter().Wait(ctx); err != nil {
 		return nil, fmt.Errorf("rate limit exceeded: %w", err)
 	}
 
 	// Try providers with fallback
 	var lastError error
-	for _, provider := range as.fallbackOrder {
-		if p, exists := as.providers[provider]; exists && p.IsAvailable() {
+	for _, provider := range as.providerOrder(ctx) {
+		if p, exists := as.provider(provider); exists && p.IsAvailable() {
 			if enhancedProvider, ok := p.(EnhancedEntityExtractorInterface); ok {
 				result, err := enhancedProvider.ValidateEntitiesAcrossDocuments(ctx, documentExtractions)
 				if err == nil {
-					as.cache.Set(cacheKey, result)
+					as.cacheResult(cacheKey, provider, result)
 					return result, nil
 				}
 				lastError = err
@@ -1155,25 +1507,28 @@ func (as *AIService) AnalyzeFieldSemantics(ctx context.Context, fieldName string
 		"fieldValue":      fieldValue,
 		"documentContext": documentContext,
 	})
-	if cached := as.cache.Get(cacheKey); cached != nil {
-		if result, ok := cached.(*FieldSemanticAnalysis); ok {
-			return result, nil
-		}
+	if result, ok := cachedValue[FieldSemanticAnalysis](as.cache, cacheKey); ok {
+		return result, nil
+	}
+
+	ctx, err := as.admitRequest(ctx, "field_semantics")
+	if err != nil {
+		return nil, err
 	}
 
 	// Rate limiting
-	if err := as.rateLimiter.Wait(ctx); err != nil {
+	if err := as.limiter().Wait(ctx); err != nil {
 		return nil, fmt.Errorf("rate limit exceeded: %w", err)
 	}
 
 	// Try providers with fallback
 	var lastError error
-	for _, provider := range as.fallbackOrder {
-		if p, exists := as.providers[provider]; exists && p.IsAvailable() {
+	for _, provider := range as.providerOrder(ctx) {
+		if p, exists := as.provider(provider); exists && p.IsAvailable() {
 			if semanticProvider, ok := p.(SemanticFieldMappingInterface); ok {
 				result, err := semanticProvider.AnalyzeFieldSemantics(ctx, fieldName, fieldValue, documentContext)
 				if err == nil {
-					as.cache.Set(cacheKey, result)
+					as.cacheResult(cacheKey, provider, result)
 					return result, nil
 				}
 				lastError = err
@@ -1192,25 +1547,28 @@ func (as *AIService) CreateSemanticMapping(ctx context.Context, sourceFields map
 		"templateFieldCount": len(templateFields),
 		"documentType":       documentType,
 	})
-	if cached := as.cache.Get(cacheKey); cached != nil {
-		if result, ok := cached.(*SemanticMappingResult); ok {
-			return result, nil
-		}
+	if result, ok := cachedValue[SemanticMappingResult](as.cache, cacheKey); ok {
+		return result, nil
+	}
+
+	ctx, err := as.admitRequest(ctx, "semantic_mapping")
+	if err != nil {
+		return nil, err
 	}
 
 	// Rate limiting
-	if err := as.rateLimiter.Wait(ctx); err != nil {
+	if err := as.limiter().Wait(ctx); err != nil {
 		return nil, fmt.Errorf("rate limit exceeded: %w", err)
 	}
 
 	// Try providers with fallback
 	var lastError error
-	for _, provider := range as.fallbackOrder {
-		if p, exists := as.providers[provider]; exists && p.IsAvailable() {
+	for _, provider := range as.providerOrder(ctx) {
+		if p, exists := as.provider(provider); exists && p.IsAvailable() {
 			if semanticProvider, ok := p.(SemanticFieldMappingInterface); ok {
 				result, err := semanticProvider.CreateSemanticMapping(ctx, sourceFields, templateFields, documentType)
 				if err == nil {
-					as.cache.Set(cacheKey, result)
+					as.cacheResult(cacheKey, provider, result)
 					return result, nil
 				}
 				lastError = err
@@ -1228,25 +1586,28 @@ func (as *AIService) ResolveFieldConflicts(ctx context.Context, conflicts []Fiel
 		"conflictCount": len(conflicts),
 		"contextHash":   generateContextHash(resolutionContext),
 	})
-	if cached := as.cache.Get(cacheKey); cached != nil {
-		if result, ok := cached.(*ConflictResolutionResult); ok {
-			return result, nil
-		}
+	if result, ok := cachedValue[ConflictResolutionResult](as.cache, cacheKey); ok {
+		return result, nil
+	}
+
+	ctx, err := as.admitRequest(ctx, "conflict_resolution")
+	if err != nil {
+		return nil, err
 	}
 
 	// Rate limiting
-	if err := as.rateLimiter.Wait(ctx); err != nil {
+	if err := as.limiter().Wait(ctx); err != nil {
 		return nil, fmt.Errorf("rate limit exceeded: %w", err)
 	}
 
 	// Try providers with fallback
 	var lastError error
-	for _, provider := range as.fallbackOrder {
-		if p, exists := as.providers[provider]; exists && p.IsAvailable() {
+	for _, provider := range as.providerOrder(ctx) {
+		if p, exists := as.provider(provider); exists && p.IsAvailable() {
 			if semanticProvider, ok := p.(SemanticFieldMappingInterface); ok {
 				result, err := semanticProvider.ResolveFieldConflicts(ctx, conflicts, resolutionContext)
 				if err == nil {
-					as.cache.Set(cacheKey, result)
+					as.cacheResult(cacheKey, provider, result)
 					return result, nil
 				}
 				lastError = err
@@ -1264,25 +1625,28 @@ func (as *AIService) AnalyzeTemplateStructure(ctx context.Context, templatePath
 		"contentSize": len(templateContent),
 		"contentHash": generateContentHash(templateContent),
 	})
-	if cached := as.cache.Get(cacheKey); cached != nil {
-		if result, ok := cached.(*TemplateStructureAnalysis); ok {
-			return result, nil
-		}
+	if result, ok := cachedValue[TemplateStructureAnalysis](as.cache, cacheKey); ok {
+		return result, nil
+	}
+
+	ctx, err := as.admitRequest(ctx, "template_structure")
+	if err != nil {
+		return nil, err
 	}
 
 	// Rate limiting
-	if err := as.rateLimiter.Wait(ctx); err != nil {
+	if err := as.limiter().Wait(ctx); err != nil {
 		return nil, fmt.Errorf("rate limit exceeded: %w", err)
 	}
 
 	// Try providers with fallback
 	var lastError error
-	for _, provider := range as.fallbackOrder {
-		if p, exists := as.providers[provider]; exists && p.IsAvailable() {
+	for _, provider := range as.providerOrder(ctx) {
+		if p, exists := as.provider(provider); exists && p.IsAvailable() {
 			if semanticProvider, ok := p.(SemanticFieldMappingInterface); ok {
 				result, err := semanticProvider.AnalyzeTemplateStructure(ctx, templatePath, templateContent)
 				if err == nil {
-					as.cache.Set(cacheKey, result)
+					as.cacheResult(cacheKey, provider, result)
 					return result, nil
 				}
 				lastError = err
@@ -1300,25 +1664,28 @@ func (as *AIService) ValidateFieldMapping(ctx context.Context, mapping *FieldMap
 		"mappingHash": generateMappingHash(mapping),
 		"rulesCount":  len(validationRules),
 	})
-	if cached := as.cache.Get(cacheKey); cached != nil {
-		if result, ok := cached.(*MappingValidationResult); ok {
-			return result, nil
-		}
+	if result, ok := cachedValue[MappingValidationResult](as.cache, cacheKey); ok {
+		return result, nil
+	}
+
+	ctx, err := as.admitRequest(ctx, "mapping_validation")
+	if err != nil {
+		return nil, err
 	}
 
 	// Rate limiting
-	if err := as.rateLimiter.Wait(ctx); err != nil {
+	if err := as.limiter().Wait(ctx); err != nil {
 		return nil, fmt.Errorf("rate limit exceeded: %w", err)
 	}
 
 	// Try providers with fallback
 	var lastError error
-	for _, provider := range as.fallbackOrder {
-		if p, exists := as.providers[provider]; exists && p.IsAvailable() {
+	for _, provider := range as.providerOrder(ctx) {
+		if p, exists := as.provider(provider); exists && p.IsAvailable() {
 			if semanticProvider, ok := p.(SemanticFieldMappingInterface); ok {
 				result, err := semanticProvider.ValidateFieldMapping(ctx, mapping, validationRules)
 				if err == nil {
-					as.cache.Set(cacheKey, result)
+					as.cacheResult(cacheKey, provider, result)
 					return result, nil
 				}
 				lastError = err
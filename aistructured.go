@@ -0,0 +1,463 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// AIProgressEvent reports incremental progress of a provider request
+type AIProgressEvent struct {
+	Provider      AIProvider `json:"provider"`
+	Operation     string     `json:"operation"`
+	Stage         string     `json:"stage"` // started, streaming, retrying, completed
+	Delta         string     `json:"delta,omitempty"`
+	ReceivedChars int        `json:"receivedChars"`
+	InputTokens   int        `json:"inputTokens,omitempty"`
+	OutputTokens  int        `json:"outputTokens,omitempty"`
+	Attempt       int        `json:"attempt"`
+	Message       string     `json:"message,omitempty"`
+}
+
+// AIProgressFunc receives progress events; it is called from the goroutine
+// making the request and should return quickly
+type AIProgressFunc func(event AIProgressEvent)
+
+type aiProgressKey struct{}
+
+// WithAIProgress attaches a progress callback to a context. Providers stream
+// responses when a callback is present so long documents report progress
+// while the model is still generating.
+func WithAIProgress(ctx context.Context, progress AIProgressFunc) context.Context {
+	if progress == nil {
+		return ctx
+	}
+	return context.WithValue(ctx, aiProgressKey{}, progress)
+}
+
+// aiProgressFromContext returns the progress callback, or nil
+func aiProgressFromContext(ctx context.Context) AIProgressFunc {
+	progress, _ := ctx.Value(aiProgressKey{}).(AIProgressFunc)
+	return progress
+}
+
+// DefaultStructuredOutputRetries is how many times a schema-invalid response
+// is retried after local repair fails
+const DefaultStructuredOutputRetries = 2
+
+// structuredOutput describes the JSON a request must produce
+type structuredOutput struct {
+	Name        string
+	Description string
+	Schema      map[string]interface{}
+}
+
+var structuredSchemaCache sync.Map // reflect.Type -> map[string]interface{}
+
+// structuredOutputFor builds the output spec for a Go result struct, using
+// its json tags for property names
+func structuredOutputFor(name string, sample interface{}) *structuredOutput {
+	t := reflect.TypeOf(sample)
+	if cached, ok := structuredSchemaCache.Load(t); ok {
+		return &structuredOutput{Name: name, Description: "Record the " + strings.ReplaceAll(name, "_", " "), Schema: cached.(map[string]interface{})}
+	}
+
+	schema := jsonSchemaForType(t, make(map[reflect.Type]bool))
+	structuredSchemaCache.Store(t, schema)
+	return &structuredOutput{Name: name, Description: "Record the " + strings.ReplaceAll(name, "_", " "), Schema: schema}
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+// jsonSchemaForType maps a Go type onto a JSON schema. No properties are
+// required since prompts tell the model to use zero values for missing data.
+func jsonSchemaForType(t reflect.Type, visiting map[reflect.Type]bool) map[string]interface{} {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	if t == timeType {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": jsonSchemaForType(t.Elem(), visiting)}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": jsonSchemaForType(t.Elem(), visiting)}
+	case reflect.Struct:
+		if visiting[t] {
+			return map[string]interface{}{"type": "object"}
+		}
+		visiting[t] = true
+		defer delete(visiting, t)
+
+		properties := make(map[string]interface{})
+		collectStructProperties(t, properties, visiting)
+		return map[string]interface{}{"type": "object", "properties": properties}
+	default:
+		// interface{} and anything else accepts any JSON value
+		return map[string]interface{}{}
+	}
+}
+
+func collectStructProperties(t reflect.Type, properties map[string]interface{}, visiting map[reflect.Type]bool) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		// jsonschema:"-" marks fields filled in locally rather than by the model
+		if tag == "-" || field.Tag.Get("jsonschema") == "-" || (!field.IsExported() && !field.Anonymous) {
+			continue
+		}
+
+		name := strings.Split(tag, ",")[0]
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			for embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				collectStructProperties(embedded, properties, visiting)
+				continue
+			}
+		}
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = jsonSchemaForType(field.Type, visiting)
+	}
+}
+
+var (
+	jsonFencePattern     = regexp.MustCompile("(?s)```(?:json|JSON)?\\s*(.*?)```")
+	trailingCommaPattern = regexp.MustCompile(`,(\s*[}\]])`)
+)
+
+// repairStructuredJSON extracts a JSON object from model output, fixes common
+// syntax slips and coerces values to the schema's types. It returns the
+// repaired JSON and any schema violations that could not be fixed.
+func repairStructuredJSON(text string, schema map[string]interface{}) (string, []string, error) {
+	candidate := strings.TrimSpace(text)
+	if match := jsonFencePattern.FindStringSubmatch(candidate); match != nil {
+		candidate = strings.TrimSpace(match[1])
+	}
+	if start, end := strings.Index(candidate, "{"), strings.LastIndex(candidate, "}"); start >= 0 && end > start {
+		candidate = candidate[start : end+1]
+	}
+	candidate = trailingCommaPattern.ReplaceAllString(candidate, "$1")
+
+	var value interface{}
+	if err := json.Unmarshal([]byte(candidate), &value); err != nil {
+		return "", nil, fmt.Errorf("response is not valid JSON: %w", err)
+	}
+	if _, ok := value.(map[string]interface{}); !ok {
+		return "", nil, fmt.Errorf("response is a JSON %s, expected an object", jsonTypeName(value))
+	}
+
+	value = coerceToSchema(value, schema)
+	problems := validateAgainstSchema(value, schema, "$")
+
+	repaired, err := json.Marshal(value)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to re-encode repaired JSON: %w", err)
+	}
+	return string(repaired), problems, nil
+}
+
+// coerceToSchema converts values the model commonly emits in the wrong type,
+// such as "$1,250,000" for a number or a bare value for an array
+func coerceToSchema(value interface{}, schema map[string]interface{}) interface{} {
+	if value == nil || schema == nil {
+		return value
+	}
+
+	switch schema["type"] {
+	case "number", "integer":
+		number, ok := value.(float64)
+		if text, isText := value.(string); isText {
+			number, ok = parseStructuredNumber(text)
+		}
+		if ok {
+			if schema["type"] == "integer" {
+				return math.Round(number)
+			}
+			return number
+		}
+	case "string":
+		switch v := value.(type) {
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64)
+		case bool:
+			return strconv.FormatBool(v)
+		}
+	case "boolean":
+		if text, ok := value.(string); ok {
+			if parsed, err := strconv.ParseBool(strings.ToLower(strings.TrimSpace(text))); err == nil {
+				return parsed
+			}
+		}
+	case "array":
+		items, _ := schema["items"].(map[string]interface{})
+		list, ok := value.([]interface{})
+		if !ok {
+			list = []interface{}{value}
+		}
+		for i := range list {
+			list[i] = coerceToSchema(list[i], items)
+		}
+		return list
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return value
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		additional, _ := schema["additionalProperties"].(map[string]interface{})
+		for key, child := range object {
+			if propertySchema, ok := properties[key].(map[string]interface{}); ok {
+				object[key] = coerceToSchema(child, propertySchema)
+			} else if additional != nil {
+				object[key] = coerceToSchema(child, additional)
+			}
+		}
+		return object
+	}
+	return value
+}
+
+// parseStructuredNumber parses numbers written with currency symbols,
+// separators, percent signs or accounting parentheses
+func parseStructuredNumber(text string) (float64, bool) {
+	cleaned := strings.TrimSpace(text)
+	negative := strings.HasPrefix(cleaned, "(") && strings.HasSuffix(cleaned, ")")
+	cleaned = strings.Trim(cleaned, "()")
+	cleaned = strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) || r == '.' || r == '-' || r == 'e' || r == 'E' {
+			return r
+		}
+		if r == ',' || r == '$' || r == '%' || unicode.IsSpace(r) || unicode.Is(unicode.Sc, r) {
+			return -1
+		}
+		return 'x'
+	}, cleaned)
+	if cleaned == "" || strings.ContainsRune(cleaned, 'x') {
+		return 0, false
+	}
+	number, err := strconv.ParseFloat(cleaned, 64)
+	if err != nil {
+		return 0, false
+	}
+	if negative {
+		number = -number
+	}
+	return number, true
+}
+
+// validateAgainstSchema reports type mismatches; null is accepted anywhere
+// since it decodes to the zero value
+func validateAgainstSchema(value interface{}, schema map[string]interface{}, path string) []string {
+	if value == nil || schema == nil {
+		return nil
+	}
+
+	expected, _ := schema["type"].(string)
+	actual := jsonTypeName(value)
+	switch expected {
+	case "":
+		return nil
+	case "integer":
+		if number, ok := value.(float64); !ok || number != float64(int64(number)) {
+			return []string{fmt.Sprintf("%s: expected integer, got %s", path, actual)}
+		}
+		return nil
+	case "number", "string", "boolean":
+		if actual != expected {
+			return []string{fmt.Sprintf("%s: expected %s, got %s", path, expected, actual)}
+		}
+		return nil
+	case "array":
+		list, ok := value.([]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected array, got %s", path, actual)}
+		}
+		items, _ := schema["items"].(map[string]interface{})
+		problems := make([]string, 0)
+		for i, item := range list {
+			problems = append(problems, validateAgainstSchema(item, items, fmt.Sprintf("%s[%d]", path, i))...)
+		}
+		return problems
+	case "object":
+		object, ok := value.(map[string]interface{})
+		if !ok {
+			return []string{fmt.Sprintf("%s: expected object, got %s", path, actual)}
+		}
+		properties, _ := schema["properties"].(map[string]interface{})
+		additional, _ := schema["additionalProperties"].(map[string]interface{})
+
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		problems := make([]string, 0)
+		for _, key := range keys {
+			if propertySchema, ok := properties[key].(map[string]interface{}); ok {
+				problems = append(problems, validateAgainstSchema(object[key], propertySchema, path+"."+key)...)
+			} else if additional != nil {
+				problems = append(problems, validateAgainstSchema(object[key], additional, path+"."+key)...)
+			}
+		}
+		return problems
+	}
+	return nil
+}
+
+func jsonTypeName(value interface{}) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []interface{}:
+		return "array"
+	case map[string]interface{}:
+		return "object"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+// schemaRetryPrompt is appended to the user prompt when a response failed
+// validation so the next attempt knows what to fix
+func schemaRetryPrompt(userPrompt string, problems []string, parseErr error) string {
+	var reason string
+	if parseErr != nil {
+		reason = parseErr.Error()
+	} else {
+		if len(problems) > 10 {
+			problems = append(problems[:10], fmt.Sprintf("and %d more", len(problems)-10))
+		}
+		reason = strings.Join(problems, "; ")
+	}
+	return userPrompt + "\n\nA previous response could not be used (" + reason +
+		"). Respond with a single JSON object that follows the requested structure exactly."
+}
+
+// completeStructured runs attempt until it yields JSON that satisfies the
+// output schema, repairing locally first and retrying with feedback after.
+// When retries run out it returns the last parseable JSON so callers keep
+// their existing fallbacks.
+func completeStructured(ctx context.Context, provider AIProvider, output *structuredOutput, userPrompt string, retries int,
+	attempt func(ctx context.Context, userPrompt string, attemptNumber int) (string, error)) (string, error) {
+
+	progress := aiProgressFromContext(ctx)
+	prompt := userPrompt
+	lastParseable := ""
+	var lastErr error
+
+	for attemptNumber := 1; attemptNumber <= retries+1; attemptNumber++ {
+		if attemptNumber > 1 && progress != nil {
+			progress(AIProgressEvent{Provider: provider, Operation: output.Name, Stage: "retrying", Attempt: attemptNumber, Message: lastErr.Error()})
+		}
+
+		text, err := attempt(ctx, prompt, attemptNumber)
+		if err != nil {
+			return "", err
+		}
+
+		repaired, problems, parseErr := repairStructuredJSON(text, output.Schema)
+		if parseErr == nil && len(problems) == 0 {
+			return repaired, nil
+		}
+		if parseErr == nil {
+			lastParseable = repaired
+			lastErr = fmt.Errorf("response did not match %s schema: %s", output.Name, strings.Join(problems, "; "))
+		} else {
+			lastErr = parseErr
+		}
+		prompt = schemaRetryPrompt(userPrompt, problems, parseErr)
+	}
+
+	if lastParseable != "" {
+		return lastParseable, nil
+	}
+	return "", lastErr
+}
+
+// sseEvent is one server-sent event
+type sseEvent struct {
+	Event string
+	Data  string
+}
+
+// readSSE calls handle for each event in a server-sent-event stream until the
+// stream ends or handle returns false or an error
+func readSSE(body io.Reader, handle func(event sseEvent) (bool, error)) error {
+	reader := bufio.NewReader(body)
+	var event sseEvent
+	var data []string
+
+	dispatch := func() (bool, error) {
+		if len(data) == 0 && event.Event == "" {
+			return true, nil
+		}
+		event.Data = strings.Join(data, "\n")
+		cont, err := handle(event)
+		event, data = sseEvent{}, nil
+		return cont, err
+	}
+
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("failed to read event stream: %w", err)
+		}
+
+		trimmed := strings.TrimRight(line, "\r\n")
+		switch {
+		case trimmed == "":
+			if line != "" || err == io.EOF {
+				cont, handleErr := dispatch()
+				if handleErr != nil || !cont {
+					return handleErr
+				}
+			}
+		case strings.HasPrefix(trimmed, ":"):
+			// Comment or keep-alive
+		case strings.HasPrefix(trimmed, "event:"):
+			event.Event = strings.TrimSpace(strings.TrimPrefix(trimmed, "event:"))
+		case strings.HasPrefix(trimmed, "data:"):
+			data = append(data, strings.TrimPrefix(strings.TrimPrefix(trimmed, "data:"), " "))
+		}
+
+		if err == io.EOF {
+			_, handleErr := dispatch()
+			return handleErr
+		}
+	}
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClaudeProvider(endpoint string) *ClaudeProvider {
+	provider := NewClaudeProvider("test-key", "").(*ClaudeProvider)
+	provider.endpoint = endpoint
+	return provider
+}
+
+func newTestOpenAIProvider(endpoint string) *OpenAIProvider {
+	provider := NewOpenAIProvider("test-key", "").(*OpenAIProvider)
+	provider.endpoint = endpoint
+	return provider
+}
+
+// recordProgress collects progress events from concurrent callers
+type recordProgress struct {
+	mu     sync.Mutex
+	events []AIProgressEvent
+}
+
+func (r *recordProgress) record(event AIProgressEvent) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+}
+
+func (r *recordProgress) stages() []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stages := make([]string, 0, len(r.events))
+	for _, event := range r.events {
+		if len(stages) == 0 || stages[len(stages)-1] != event.Stage {
+			stages = append(stages, event.Stage)
+		}
+	}
+	return stages
+}
+
+func writeSSE(w http.ResponseWriter, events ...string) {
+	w.Header().Set("Content-Type", "text/event-stream")
+	for _, event := range events {
+		fmt.Fprint(w, event)
+		w.(http.Flusher).Flush()
+	}
+}
+
+func TestStructuredOutputSchema(t *testing.T) {
+	output := structuredOutputFor("financial_analysis", FinancialAnalysis{})
+	assert.Equal(t, "financial_analysis", output.Name)
+	assert.Equal(t, "object", output.Schema["type"])
+
+	properties := output.Schema["properties"].(map[string]interface{})
+	assert.Equal(t, "number", properties["revenue"].(map[string]interface{})["type"])
+	assert.Equal(t, "string", properties["currency"].(map[string]interface{})["type"])
+	assert.Equal(t, "array", properties["warnings"].(map[string]interface{})["type"])
+	assert.Equal(t, "object", properties["dataPoints"].(map[string]interface{})["type"])
+
+	// Schemas are reflected once per type
+	again := structuredOutputFor("financial_analysis", FinancialAnalysis{})
+	assert.Equal(t, fmt.Sprintf("%p", output.Schema), fmt.Sprintf("%p", again.Schema))
+}
+
+func TestRepairStructuredJSON(t *testing.T) {
+	schema := structuredOutputFor("financial_analysis", FinancialAnalysis{}).Schema
+
+	text := "Here is the data:\n```json\n{\"revenue\": \"$1,250.5\", \"confidence\": \"0.9\", " +
+		"\"currency\": \"USD\", \"warnings\": \"estimated\",}\n```"
+	repaired, problems, err := repairStructuredJSON(text, schema)
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+
+	var result FinancialAnalysis
+	require.NoError(t, json.Unmarshal([]byte(repaired), &result))
+	assert.Equal(t, 1250.5, result.Revenue)
+	assert.Equal(t, 0.9, result.Confidence)
+	assert.Equal(t, []string{"estimated"}, result.Warnings)
+
+	_, problems, err = repairStructuredJSON(`{"revenue": "unknown"}`, schema)
+	require.NoError(t, err)
+	assert.NotEmpty(t, problems)
+
+	_, _, err = repairStructuredJSON("no json here", schema)
+	assert.Error(t, err)
+}
+
+func TestClaudeProviderToolUse(t *testing.T) {
+	var request claudeRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/messages", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"type": "message", "content": [
+			{"type": "tool_use", "id": "tu_1", "name": "financial_analysis",
+			 "input": {"revenue": 5000000, "ebitda": 1200000, "confidence": 0.85, "currency": "USD"}}
+		], "usage": {"input_tokens": 100, "output_tokens": 40}}`))
+	}))
+	defer server.Close()
+
+	provider := newTestClaudeProvider(server.URL)
+	result, err := provider.ExtractFinancialData(context.Background(), "Revenue was $5M")
+	require.NoError(t, err)
+
+	assert.False(t, request.Stream)
+	require.Len(t, request.Tools, 1)
+	assert.Equal(t, "financial_analysis", request.Tools[0].Name)
+	require.NotNil(t, request.ToolChoice)
+	assert.Equal(t, "tool", request.ToolChoice.Type)
+	assert.Equal(t, "financial_analysis", request.ToolChoice.Name)
+
+	assert.Equal(t, 5000000.0, result.Revenue)
+	assert.Equal(t, 1200000.0, result.EBITDA)
+	assert.Equal(t, "USD", result.Currency)
+}
+
+func TestClaudeProviderStreamingProgress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request claudeRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		assert.True(t, request.Stream)
+
+		writeSSE(w,
+			"event: message_start\ndata: {\"type\":\"message_start\",\"message\":{\"usage\":{\"input_tokens\":120,\"output_tokens\":1}}}\n\n",
+			"event: content_block_start\ndata: {\"type\":\"content_block_start\",\"index\":0}\n\n",
+			"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\"{\\\"overallRiskScore\\\": 0.7, \"}}\n\n",
+			"event: content_block_delta\ndata: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"input_json_delta\",\"partial_json\":\"\\\"recommendations\\\": [\\\"Review leases\\\"]}\"}}\n\n",
+			"event: message_delta\ndata: {\"type\":\"message_delta\",\"delta\":{\"stop_reason\":\"tool_use\"},\"usage\":{\"output_tokens\":30}}\n\n",
+			"event: message_stop\ndata: {\"type\":\"message_stop\"}\n\n",
+		)
+	}))
+	defer server.Close()
+
+	progress := &recordProgress{}
+	ctx := WithAIProgress(context.Background(), progress.record)
+
+	provider := newTestClaudeProvider(server.URL)
+	result, err := provider.AnalyzeRisks(ctx, "Lease terms", "legal")
+	require.NoError(t, err)
+
+	assert.Equal(t, 0.7, result.OverallRiskScore)
+	assert.Equal(t, []string{"Review leases"}, result.Recommendations)
+
+	assert.Equal(t, []string{"started", "streaming", "completed"}, progress.stages())
+	last := progress.events[len(progress.events)-1]
+	assert.Equal(t, ProviderClaude, last.Provider)
+	assert.Equal(t, "risk_analysis", last.Operation)
+	assert.Equal(t, 120, last.InputTokens)
+	assert.Equal(t, 30, last.OutputTokens)
+	assert.Equal(t, int64(150), provider.stats.TotalTokens)
+}
+
+func TestClaudeProviderStreamError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeSSE(w, "event: error\ndata: {\"type\":\"error\",\"error\":{\"type\":\"overloaded_error\",\"message\":\"Overloaded\"}}\n\n")
+	}))
+	defer server.Close()
+
+	ctx := WithAIProgress(context.Background(), func(AIProgressEvent) {})
+	_, err := newTestClaudeProvider(server.URL).ExtractEntities(ctx, "Acme Corp")
+	assert.ErrorContains(t, err, "Overloaded")
+}
+
+func TestOpenAIProviderStreaming(t *testing.T) {
+	var request openAIRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/chat/completions", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+
+		writeSSE(w,
+			"data: {\"choices\":[{\"delta\":{\"content\":\"{\\\"revenue\\\": \"}}]}\n\n",
+			"data: {\"choices\":[{\"delta\":{\"content\":\"2500000, \\\"currency\\\": \\\"EUR\\\"}\"}}]}\n\n",
+			"data: {\"choices\":[],\"usage\":{\"prompt_tokens\":80,\"completion_tokens\":20,\"total_tokens\":100}}\n\n",
+			"data: [DONE]\n\n",
+		)
+	}))
+	defer server.Close()
+
+	progress := &recordProgress{}
+	ctx := WithAIProgress(context.Background(), progress.record)
+
+	provider := newTestOpenAIProvider(server.URL)
+	provider.model = "gpt-4o-mini"
+	result, err := provider.ExtractFinancialData(ctx, "Revenue of EUR 2.5M")
+	require.NoError(t, err)
+
+	assert.True(t, request.Stream)
+	require.NotNil(t, request.StreamOptions)
+	assert.True(t, request.StreamOptions.IncludeUsage)
+	require.NotNil(t, request.ResponseFormat)
+	assert.Equal(t, "json_schema", request.ResponseFormat.Type)
+	assert.Equal(t, "financial_analysis", request.ResponseFormat.JSONSchema.Name)
+
+	assert.Equal(t, 2500000.0, result.Revenue)
+	assert.Equal(t, "EUR", result.Currency)
+	assert.Equal(t, []string{"started", "streaming", "completed"}, progress.stages())
+	assert.Equal(t, int64(100), provider.stats.TotalTokens)
+}
+
+func TestOpenAIProviderRetriesInvalidOutput(t *testing.T) {
+	var calls int32
+	var prompts []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request openAIRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		prompts = append(prompts, request.Messages[len(request.Messages)-1].Content)
+
+		// Older models fall back to plain JSON mode
+		assert.Equal(t, "json_object", request.ResponseFormat.Type)
+		assert.Nil(t, request.ResponseFormat.JSONSchema)
+
+		content := `{"overallRiskScore": "high"}`
+		if atomic.AddInt32(&calls, 1) > 1 {
+			content = `{"overallRiskScore": 0.8}`
+		}
+		body, _ := json.Marshal(map[string]interface{}{
+			"choices": []map[string]interface{}{{"message": map[string]string{"role": "assistant", "content": content}}},
+			"usage":   map[string]int{"total_tokens": 10},
+		})
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	}))
+	defer server.Close()
+
+	provider := newTestOpenAIProvider(server.URL)
+	provider.model = "gpt-4-turbo-preview"
+	result, err := provider.AnalyzeRisks(context.Background(), "Pending litigation", "legal")
+	require.NoError(t, err)
+
+	assert.Equal(t, int32(2), atomic.LoadInt32(&calls))
+	assert.Equal(t, 0.8, result.OverallRiskScore)
+	require.Len(t, prompts, 2)
+	assert.True(t, strings.Contains(prompts[1], "overallRiskScore"), "retry prompt names the invalid field")
+}
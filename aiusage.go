@@ -0,0 +1,487 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ErrAIBudgetExceeded is returned when a deal has reached its hard AI budget
+var ErrAIBudgetExceeded = errors.New("AI budget exceeded")
+
+// ModelPrice is what a model costs in USD per million tokens
+type ModelPrice struct {
+	InputPerMillion  float64 `json:"input_per_million"`
+	OutputPerMillion float64 `json:"output_per_million"`
+}
+
+// defaultModelPrices are list prices for the hosted models. Keys match
+// model names by prefix, so dated releases share their family's price.
+// Local models are free unless priced in the configuration.
+var defaultModelPrices = map[string]ModelPrice{
+	"gpt-4o":            {InputPerMillion: 2.50, OutputPerMillion: 10.00},
+	"gpt-4o-mini":       {InputPerMillion: 0.15, OutputPerMillion: 0.60},
+	"gpt-4.1":           {InputPerMillion: 2.00, OutputPerMillion: 8.00},
+	"gpt-4.1-mini":      {InputPerMillion: 0.40, OutputPerMillion: 1.60},
+	"gpt-4-turbo":       {InputPerMillion: 10.00, OutputPerMillion: 30.00},
+	"gpt-4":             {InputPerMillion: 30.00, OutputPerMillion: 60.00},
+	"gpt-3.5-turbo":     {InputPerMillion: 0.50, OutputPerMillion: 1.50},
+	"claude-3-opus":     {InputPerMillion: 15.00, OutputPerMillion: 75.00},
+	"claude-3-sonnet":   {InputPerMillion: 3.00, OutputPerMillion: 15.00},
+	"claude-3-5-sonnet": {InputPerMillion: 3.00, OutputPerMillion: 15.00},
+	"claude-3-7-sonnet": {InputPerMillion: 3.00, OutputPerMillion: 15.00},
+	"claude-3-haiku":    {InputPerMillion: 0.25, OutputPerMillion: 1.25},
+	"claude-3-5-haiku":  {InputPerMillion: 0.80, OutputPerMillion: 4.00},
+}
+
+// AIPriceTable prices provider requests by model
+type AIPriceTable struct {
+	prices map[string]ModelPrice
+}
+
+// NewAIPriceTable creates a price table from the defaults with overrides
+// from the configuration applied on top
+func NewAIPriceTable(overrides map[string]ModelPrice) *AIPriceTable {
+	prices := make(map[string]ModelPrice, len(defaultModelPrices)+len(overrides))
+	for model, price := range defaultModelPrices {
+		prices[model] = price
+	}
+	for model, price := range overrides {
+		prices[strings.ToLower(model)] = price
+	}
+	return &AIPriceTable{prices: prices}
+}
+
+// Price returns the price of a model, matching the longest known prefix
+func (pt *AIPriceTable) Price(model string) (ModelPrice, bool) {
+	model = strings.ToLower(model)
+	if price, ok := pt.prices[model]; ok {
+		return price, true
+	}
+
+	best := ""
+	for prefix := range pt.prices {
+		if strings.HasPrefix(model, prefix) && len(prefix) > len(best) {
+			best = prefix
+		}
+	}
+	if best == "" {
+		return ModelPrice{}, false
+	}
+	return pt.prices[best], true
+}
+
+// Cost returns the USD cost of a request
+func (pt *AIPriceTable) Cost(model string, inputTokens, outputTokens int) float64 {
+	price, _ := pt.Price(model)
+	return (float64(inputTokens)*price.InputPerMillion + float64(outputTokens)*price.OutputPerMillion) / 1e6
+}
+
+// AIUsageRecord is one billed provider request
+type AIUsageRecord struct {
+	Timestamp    time.Time  `json:"timestamp"`
+	DealName     string     `json:"dealName,omitempty"` // Empty when the request was not made for a deal
+	Provider     AIProvider `json:"provider"`
+	Model        string     `json:"model"`
+	Operation    string     `json:"operation"`
+	InputTokens  int        `json:"inputTokens"`
+	OutputTokens int        `json:"outputTokens"`
+	CostUSD      float64    `json:"costUSD"`
+}
+
+// AIUsageTotals sums token usage and cost
+type AIUsageTotals struct {
+	Requests     int64   `json:"requests"`
+	InputTokens  int64   `json:"inputTokens"`
+	OutputTokens int64   `json:"outputTokens"`
+	TotalTokens  int64   `json:"totalTokens"`
+	CostUSD      float64 `json:"costUSD"`
+}
+
+func (t *AIUsageTotals) add(record AIUsageRecord) {
+	t.Requests++
+	t.InputTokens += int64(record.InputTokens)
+	t.OutputTokens += int64(record.OutputTokens)
+	t.TotalTokens += int64(record.InputTokens + record.OutputTokens)
+	t.CostUSD += record.CostUSD
+}
+
+// AIUsageReport breaks down usage within a period
+type AIUsageReport struct {
+	From        time.Time                 `json:"from"`
+	To          time.Time                 `json:"to"`
+	Total       AIUsageTotals             `json:"total"`
+	ByDeal      map[string]*AIUsageTotals `json:"byDeal"` // Requests without a deal are under ""
+	ByProvider  map[string]*AIUsageTotals `json:"byProvider"`
+	ByModel     map[string]*AIUsageTotals `json:"byModel"`
+	ByOperation map[string]*AIUsageTotals `json:"byOperation"`
+}
+
+// DealBudget caps a deal's lifetime AI spend. Past the soft cap requests are
+// answered by the rule-based provider; past the hard cap they are refused.
+// Zero leaves a cap unset.
+type DealBudget struct {
+	SoftCapUSD    float64 `json:"softCapUSD,omitempty"`
+	HardCapUSD    float64 `json:"hardCapUSD,omitempty"`
+	SoftCapTokens int64   `json:"softCapTokens,omitempty"`
+	HardCapTokens int64   `json:"hardCapTokens,omitempty"`
+}
+
+// Budget states
+const (
+	BudgetStateOK           = "ok"
+	BudgetStateSoftExceeded = "soft_cap_exceeded"
+	BudgetStateHardExceeded = "hard_cap_exceeded"
+)
+
+// DealBudgetStatus reports a deal's spend against its budget
+type DealBudgetStatus struct {
+	DealName string        `json:"dealName"`
+	Budget   *DealBudget   `json:"budget,omitempty"`
+	Spent    AIUsageTotals `json:"spent"`
+	State    string        `json:"state"`
+}
+
+// AIUsageLedger persists every billed request in monthly JSON-lines files
+// and enforces deal budgets against the running totals
+type AIUsageLedger struct {
+	storagePath string
+	dealTotals  map[string]*AIUsageTotals
+	budgets     map[string]*DealBudget
+	mu          sync.RWMutex
+}
+
+// NewAIUsageLedger opens the ledger in storagePath, totalling the existing
+// records so budgets apply across restarts
+func NewAIUsageLedger(storagePath string) (*AIUsageLedger, error) {
+	if err := os.MkdirAll(storagePath, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create usage ledger directory: %w", err)
+	}
+
+	ledger := &AIUsageLedger{
+		storagePath: storagePath,
+		dealTotals:  make(map[string]*AIUsageTotals),
+		budgets:     make(map[string]*DealBudget),
+	}
+
+	data, err := os.ReadFile(ledger.budgetsPath())
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read AI budgets: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &ledger.budgets); err != nil {
+			return nil, fmt.Errorf("failed to parse AI budgets: %w", err)
+		}
+		if ledger.budgets == nil {
+			ledger.budgets = make(map[string]*DealBudget)
+		}
+	}
+
+	err = ledger.scan(time.Time{}, time.Time{}, func(record AIUsageRecord) {
+		ledger.totalsFor(record.DealName).add(record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return ledger, nil
+}
+
+func (l *AIUsageLedger) budgetsPath() string {
+	return filepath.Join(l.storagePath, "budgets.json")
+}
+
+// ledgerFile returns the file holding a month's records
+func (l *AIUsageLedger) ledgerFile(t time.Time) string {
+	return filepath.Join(l.storagePath, t.UTC().Format("2006-01")+".jsonl")
+}
+
+func (l *AIUsageLedger) totalsFor(dealName string) *AIUsageTotals {
+	totals, ok := l.dealTotals[dealName]
+	if !ok {
+		totals = &AIUsageTotals{}
+		l.dealTotals[dealName] = totals
+	}
+	return totals
+}
+
+// Record appends a request to the ledger
+func (l *AIUsageLedger) Record(record AIUsageRecord) error {
+	if record.Timestamp.IsZero() {
+		record.Timestamp = time.Now()
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal usage record: %w", err)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	file, err := os.OpenFile(l.ledgerFile(record.Timestamp), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open usage ledger: %w", err)
+	}
+	defer file.Close()
+	if _, err := file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write usage record: %w", err)
+	}
+
+	l.totalsFor(record.DealName).add(record)
+	return nil
+}
+
+// scan calls fn for every record in [from, to); zero bounds are open
+func (l *AIUsageLedger) scan(from, to time.Time, fn func(AIUsageRecord)) error {
+	files, err := filepath.Glob(filepath.Join(l.storagePath, "*.jsonl"))
+	if err != nil {
+		return fmt.Errorf("failed to list usage ledgers: %w", err)
+	}
+	sort.Strings(files)
+
+	for _, path := range files {
+		month, err := time.Parse("2006-01", strings.TrimSuffix(filepath.Base(path), ".jsonl"))
+		if err != nil {
+			continue
+		}
+		if (!to.IsZero() && !month.Before(to)) || (!from.IsZero() && !month.AddDate(0, 1, 0).After(from)) {
+			continue
+		}
+
+		if err := scanLedgerFile(path, func(record AIUsageRecord) {
+			if (from.IsZero() || !record.Timestamp.Before(from)) && (to.IsZero() || record.Timestamp.Before(to)) {
+				fn(record)
+			}
+		}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanLedgerFile reads one ledger file, skipping a line torn by a crash
+func scanLedgerFile(path string, fn func(AIUsageRecord)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open usage ledger: %w", err)
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var record AIUsageRecord
+		if err := json.Unmarshal(scanner.Bytes(), &record); err != nil {
+			continue
+		}
+		fn(record)
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read usage ledger: %w", err)
+	}
+	return nil
+}
+
+// Report summarizes usage in [from, to); zero bounds are open
+func (l *AIUsageLedger) Report(from, to time.Time) (*AIUsageReport, error) {
+	report := &AIUsageReport{
+		From:        from,
+		To:          to,
+		ByDeal:      make(map[string]*AIUsageTotals),
+		ByProvider:  make(map[string]*AIUsageTotals),
+		ByModel:     make(map[string]*AIUsageTotals),
+		ByOperation: make(map[string]*AIUsageTotals),
+	}
+	group := func(groups map[string]*AIUsageTotals, key string, record AIUsageRecord) {
+		totals, ok := groups[key]
+		if !ok {
+			totals = &AIUsageTotals{}
+			groups[key] = totals
+		}
+		totals.add(record)
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	err := l.scan(from, to, func(record AIUsageRecord) {
+		report.Total.add(record)
+		group(report.ByDeal, record.DealName, record)
+		group(report.ByProvider, string(record.Provider), record)
+		group(report.ByModel, record.Model, record)
+		group(report.ByOperation, record.Operation, record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return report, nil
+}
+
+// SetBudget sets or, when budget is nil, removes a deal's budget
+func (l *AIUsageLedger) SetBudget(dealName string, budget *DealBudget) error {
+	if dealName == "" {
+		return fmt.Errorf("deal name is required")
+	}
+	if budget != nil {
+		if budget.SoftCapUSD < 0 || budget.HardCapUSD < 0 || budget.SoftCapTokens < 0 || budget.HardCapTokens < 0 {
+			return fmt.Errorf("budget caps cannot be negative")
+		}
+		if (budget.HardCapUSD > 0 && budget.SoftCapUSD > budget.HardCapUSD) ||
+			(budget.HardCapTokens > 0 && budget.SoftCapTokens > budget.HardCapTokens) {
+			return fmt.Errorf("soft cap cannot exceed hard cap")
+		}
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if budget == nil {
+		delete(l.budgets, dealName)
+	} else {
+		l.budgets[dealName] = budget
+	}
+
+	data, err := json.MarshalIndent(l.budgets, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal AI budgets: %w", err)
+	}
+	return writeFileDurable(l.budgetsPath(), data, 0644)
+}
+
+// GetBudgets returns every deal budget
+func (l *AIUsageLedger) GetBudgets() map[string]DealBudget {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	budgets := make(map[string]DealBudget, len(l.budgets))
+	for dealName, budget := range l.budgets {
+		budgets[dealName] = *budget
+	}
+	return budgets
+}
+
+// BudgetStatus returns a deal's lifetime spend and where it stands against
+// its budget
+func (l *AIUsageLedger) BudgetStatus(dealName string) DealBudgetStatus {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	status := DealBudgetStatus{DealName: dealName, State: BudgetStateOK}
+	if totals, ok := l.dealTotals[dealName]; ok {
+		status.Spent = *totals
+	}
+
+	budget, ok := l.budgets[dealName]
+	if !ok {
+		return status
+	}
+	copied := *budget
+	status.Budget = &copied
+
+	spent := status.Spent
+	switch {
+	case (budget.HardCapUSD > 0 && spent.CostUSD >= budget.HardCapUSD) ||
+		(budget.HardCapTokens > 0 && spent.TotalTokens >= budget.HardCapTokens):
+		status.State = BudgetStateHardExceeded
+	case (budget.SoftCapUSD > 0 && spent.CostUSD >= budget.SoftCapUSD) ||
+		(budget.SoftCapTokens > 0 && spent.TotalTokens >= budget.SoftCapTokens):
+		status.State = BudgetStateSoftExceeded
+	}
+	return status
+}
+
+type aiDealKey struct{}
+
+// WithAIDeal attributes the AI requests made with a context to a deal, so
+// they count against its budget and appear under it in usage reports
+func WithAIDeal(ctx context.Context, dealName string) context.Context {
+	if dealName == "" {
+		return ctx
+	}
+	return context.WithValue(ctx, aiDealKey{}, dealName)
+}
+
+// aiDealFromContext returns the deal requests are made for, or ""
+func aiDealFromContext(ctx context.Context) string {
+	dealName, _ := ctx.Value(aiDealKey{}).(string)
+	return dealName
+}
+
+// aiUsageFunc receives the tokens billed for one provider request
+type aiUsageFunc func(provider AIProvider, model string, inputTokens, outputTokens int)
+
+type aiUsageKey struct{}
+
+type aiDegradedKey struct{}
+
+// reportAIUsage passes the tokens billed for a request to the recorder
+// attached to the context, if any
+func reportAIUsage(ctx context.Context, provider AIProvider, model string, inputTokens, outputTokens int) {
+	if inputTokens == 0 && outputTokens == 0 {
+		return
+	}
+	if record, ok := ctx.Value(aiUsageKey{}).(aiUsageFunc); ok {
+		record(provider, model, inputTokens, outputTokens)
+	}
+}
+
+// aiBudgetDegraded reports whether requests must use the rule-based
+// provider because the deal is past its soft cap
+func aiBudgetDegraded(ctx context.Context) bool {
+	degraded, _ := ctx.Value(aiDegradedKey{}).(bool)
+	return degraded
+}
+
+// aiErrorStatus maps an AI service error onto an HTTP status
+func aiErrorStatus(err error) int {
+	if errors.Is(err, ErrAIBudgetExceeded) {
+		return http.StatusPaymentRequired
+	}
+	return http.StatusInternalServerError
+}
+
+// parseUsagePeriod turns inclusive YYYY-MM-DD dates into a [from, to) range;
+// empty dates are open
+func parseUsagePeriod(from, to string) (time.Time, time.Time, error) {
+	var start, end time.Time
+	var err error
+	if from != "" {
+		if start, err = time.ParseInLocation("2006-01-02", from, time.Local); err != nil {
+			return start, end, fmt.Errorf("invalid from date %q, expected YYYY-MM-DD", from)
+		}
+	}
+	if to != "" {
+		if end, err = time.ParseInLocation("2006-01-02", to, time.Local); err != nil {
+			return start, end, fmt.Errorf("invalid to date %q, expected YYYY-MM-DD", to)
+		}
+		end = end.AddDate(0, 0, 1)
+	}
+	if !start.IsZero() && !end.IsZero() && !start.Before(end) {
+		return start, end, fmt.Errorf("from date must not be after to date")
+	}
+	return start, end, nil
+}
+
+// dealNameFromPath returns the deal a file belongs to when it lies inside
+// the deals folder
+func dealNameFromPath(dealsPath, path string) string {
+	if dealsPath == "" {
+		return ""
+	}
+	rel, err := filepath.Rel(dealsPath, path)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	parts := strings.Split(filepath.ToSlash(rel), "/")
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[0]
+}
@@ -0,0 +1,280 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// usageTestProvider bills a fixed number of tokens for every classification
+type usageTestProvider struct {
+	*DefaultProvider
+	calls int
+}
+
+func (p *usageTestProvider) ClassifyDocument(ctx context.Context, content string, metadata map[string]interface{}) (*AIClassificationResult, error) {
+	p.calls++
+	reportAIUsage(ctx, ProviderOpenAI, "gpt-4o-2024-08-06", 1000, 200)
+	return &AIClassificationResult{DocumentType: "legal", Confidence: 0.95}, nil
+}
+
+func TestAIPriceTable(t *testing.T) {
+	table := NewAIPriceTable(map[string]ModelPrice{
+		"GPT-4o":      {InputPerMillion: 5, OutputPerMillion: 15},
+		"local-llama": {InputPerMillion: 0.1, OutputPerMillion: 0.1},
+	})
+
+	// Dated releases match the longest family prefix
+	price, ok := table.Price("gpt-4o-mini-2024-07-18")
+	require.True(t, ok)
+	assert.Equal(t, defaultModelPrices["gpt-4o-mini"], price)
+
+	price, ok = table.Price("gpt-4o-2024-08-06")
+	require.True(t, ok)
+	assert.Equal(t, 5.0, price.InputPerMillion, "configured prices override the defaults")
+
+	_, ok = table.Price("mistral")
+	assert.False(t, ok)
+	assert.Zero(t, table.Cost("mistral", 1000, 1000))
+
+	assert.InDelta(t, 0.008, table.Cost("gpt-4o", 1000, 200), 1e-9)
+	assert.InDelta(t, 0.0002, table.Cost("local-llama", 1000, 1000), 1e-9)
+}
+
+func TestAIUsageLedger_Report(t *testing.T) {
+	dir := t.TempDir()
+	ledger, err := NewAIUsageLedger(dir)
+	require.NoError(t, err)
+
+	may := time.Date(2024, 5, 20, 12, 0, 0, 0, time.UTC)
+	june := time.Date(2024, 6, 3, 12, 0, 0, 0, time.UTC)
+	records := []AIUsageRecord{
+		{Timestamp: may, DealName: "Acme", Provider: ProviderOpenAI, Model: "gpt-4o", Operation: "classify", InputTokens: 100, OutputTokens: 10, CostUSD: 0.5},
+		{Timestamp: june, DealName: "Acme", Provider: ProviderClaude, Model: "claude-3-haiku", Operation: "financial", InputTokens: 200, OutputTokens: 20, CostUSD: 0.25},
+		{Timestamp: june, DealName: "Globex", Provider: ProviderOpenAI, Model: "gpt-4o", Operation: "classify", InputTokens: 300, OutputTokens: 30, CostUSD: 1},
+		{Timestamp: june, Provider: ProviderOpenAI, Model: "gpt-4o", Operation: "entities", InputTokens: 50, OutputTokens: 5, CostUSD: 0.1},
+	}
+	for _, record := range records {
+		require.NoError(t, ledger.Record(record))
+	}
+	assert.FileExists(t, filepath.Join(dir, "2024-05.jsonl"))
+	assert.FileExists(t, filepath.Join(dir, "2024-06.jsonl"))
+
+	report, err := ledger.Report(time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(4), report.Total.Requests)
+	assert.Equal(t, int64(715), report.Total.TotalTokens)
+	assert.InDelta(t, 1.85, report.Total.CostUSD, 1e-9)
+	assert.InDelta(t, 0.75, report.ByDeal["Acme"].CostUSD, 1e-9)
+	assert.Equal(t, int64(1), report.ByDeal[""].Requests)
+	assert.Equal(t, int64(3), report.ByProvider["openai"].Requests)
+	assert.Equal(t, int64(3), report.ByModel["gpt-4o"].Requests)
+	assert.Equal(t, int64(2), report.ByOperation["classify"].Requests)
+
+	// Only June
+	from, to, err := parseUsagePeriod("2024-06-01", "2024-06-30")
+	require.NoError(t, err)
+	report, err = ledger.Report(from.UTC(), to.UTC())
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), report.Total.Requests)
+	assert.InDelta(t, 0.25, report.ByDeal["Acme"].CostUSD, 1e-9)
+
+	// A torn line is skipped and totals survive a restart
+	file, err := os.OpenFile(filepath.Join(dir, "2024-06.jsonl"), os.O_APPEND|os.O_WRONLY, 0644)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"timestamp":"2024-06-`)
+	require.NoError(t, err)
+	file.Close()
+
+	reopened, err := NewAIUsageLedger(dir)
+	require.NoError(t, err)
+	status := reopened.BudgetStatus("Acme")
+	assert.Equal(t, int64(2), status.Spent.Requests)
+	assert.InDelta(t, 0.75, status.Spent.CostUSD, 1e-9)
+}
+
+func TestAIUsageLedger_Budgets(t *testing.T) {
+	dir := t.TempDir()
+	ledger, err := NewAIUsageLedger(dir)
+	require.NoError(t, err)
+
+	assert.Error(t, ledger.SetBudget("", &DealBudget{HardCapUSD: 1}))
+	assert.Error(t, ledger.SetBudget("Acme", &DealBudget{SoftCapUSD: -1}))
+	assert.Error(t, ledger.SetBudget("Acme", &DealBudget{SoftCapUSD: 5, HardCapUSD: 2}))
+
+	require.NoError(t, ledger.SetBudget("Acme", &DealBudget{SoftCapUSD: 1, HardCapUSD: 2, HardCapTokens: 10000}))
+	assert.Equal(t, BudgetStateOK, ledger.BudgetStatus("Acme").State)
+
+	require.NoError(t, ledger.Record(AIUsageRecord{DealName: "Acme", InputTokens: 100, CostUSD: 1.5}))
+	assert.Equal(t, BudgetStateSoftExceeded, ledger.BudgetStatus("Acme").State)
+
+	require.NoError(t, ledger.Record(AIUsageRecord{DealName: "Acme", InputTokens: 10000}))
+	assert.Equal(t, BudgetStateHardExceeded, ledger.BudgetStatus("Acme").State, "token cap applies on its own")
+
+	// Deals without a budget are never capped
+	require.NoError(t, ledger.Record(AIUsageRecord{DealName: "Globex", CostUSD: 100}))
+	status := ledger.BudgetStatus("Globex")
+	assert.Equal(t, BudgetStateOK, status.State)
+	assert.Nil(t, status.Budget)
+
+	// Budgets are persisted
+	reopened, err := NewAIUsageLedger(dir)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]DealBudget{"Acme": {SoftCapUSD: 1, HardCapUSD: 2, HardCapTokens: 10000}}, reopened.GetBudgets())
+
+	require.NoError(t, reopened.SetBudget("Acme", nil))
+	assert.Empty(t, reopened.GetBudgets())
+	assert.Equal(t, BudgetStateOK, reopened.BudgetStatus("Acme").State)
+}
+
+func TestAIService_DealBudgets(t *testing.T) {
+	ledger, err := NewAIUsageLedger(t.TempDir())
+	require.NoError(t, err)
+
+	service := NewAIService(&AIConfig{CacheTTL: time.Minute, RateLimit: 6000})
+	provider := &usageTestProvider{DefaultProvider: NewDefaultProvider()}
+	service.providers = map[AIProvider]AIServiceInterface{
+		ProviderOpenAI:  provider,
+		ProviderDefault: NewDefaultProvider(),
+	}
+	service.fallbackOrder = []AIProvider{ProviderOpenAI, ProviderDefault}
+	service.SetUsageLedger(ledger)
+	require.NoError(t, ledger.SetBudget("Acme", &DealBudget{SoftCapUSD: 0.004, HardCapUSD: 0.02}))
+
+	ctx := WithAIDeal(context.Background(), "Acme")
+	result, err := service.ClassifyDocument(ctx, "Share purchase agreement one", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 0.95, result.Confidence)
+
+	status := ledger.BudgetStatus("Acme")
+	assert.Equal(t, int64(1200), status.Spent.TotalTokens)
+	assert.InDelta(t, 0.0045, status.Spent.CostUSD, 1e-9)
+
+	report, err := ledger.Report(time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), report.ByOperation["classify"].Requests)
+	assert.Equal(t, int64(1), report.ByModel["gpt-4o-2024-08-06"].Requests)
+
+	// Past the soft cap requests are answered by the rule-based provider
+	_, err = service.ClassifyDocument(ctx, "Share purchase agreement two", nil)
+	require.NoError(t, err)
+	_, err = service.ClassifyDocument(ctx, "Share purchase agreement three", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 1, provider.calls)
+	assert.Equal(t, BudgetStateSoftExceeded, ledger.BudgetStatus("Acme").State)
+
+	// Past the hard cap requests are refused
+	require.NoError(t, ledger.Record(AIUsageRecord{DealName: "Acme", CostUSD: 0.02}))
+	_, err = service.ClassifyDocument(ctx, "Share purchase agreement four", nil)
+	require.Error(t, err)
+	assert.True(t, errors.Is(err, ErrAIBudgetExceeded))
+	assert.Equal(t, 402, aiErrorStatus(err))
+
+	// Other deals are unaffected
+	_, err = service.ClassifyDocument(WithAIDeal(context.Background(), "Globex"), "Share purchase agreement five", nil)
+	require.NoError(t, err)
+	assert.Equal(t, 2, provider.calls)
+}
+
+// entityUsageProvider bills a fixed number of tokens for every company name
+// extraction
+type entityUsageProvider struct {
+	*DefaultProvider
+}
+
+func (p *entityUsageProvider) ExtractCompanyAndDealNames(ctx context.Context, content string, documentType string) (*CompanyDealExtraction, error) {
+	reportAIUsage(ctx, ProviderOpenAI, "gpt-4o-2024-08-06", 1000, 200)
+	return &CompanyDealExtraction{}, nil
+}
+
+func TestEntityExtractionBillsNamedDeal(t *testing.T) {
+	ledger, err := NewAIUsageLedger(t.TempDir())
+	require.NoError(t, err)
+
+	service := NewAIService(&AIConfig{CacheTTL: time.Minute, RateLimit: 6000})
+	service.providers = map[AIProvider]AIServiceInterface{
+		ProviderOpenAI: &entityUsageProvider{DefaultProvider: NewDefaultProvider()},
+	}
+	service.fallbackOrder = []AIProvider{ProviderOpenAI}
+	service.SetUsageLedger(ledger)
+
+	app := &App{aiService: service}
+	wh := NewWebhookHandlers(app, nil)
+
+	req := httptest.NewRequest(http.MethodPost, "/webhook/entity-extraction/company-and-deal-names",
+		strings.NewReader(`{"content":"Acme Corp acquires Beta","documentType":"loi","dealName":"Acme"}`))
+	w := httptest.NewRecorder()
+	wh.handleExtractCompanyAndDealNames(w, req)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+
+	assert.Equal(t, int64(1200), ledger.BudgetStatus("Acme").Spent.TotalTokens)
+}
+
+func (p *entityUsageProvider) ExtractPersonnelAndRoles(ctx context.Context, content string, documentType string) (*PersonnelRoleExtraction, error) {
+	reportAIUsage(ctx, ProviderOpenAI, "gpt-4o-2024-08-06", 1000, 200)
+	return &PersonnelRoleExtraction{Personnel: []PersonEntity{{Name: "Jane Smith", Title: "CEO"}}}, nil
+}
+
+func TestDataMapper_PersonnelExtractionBillsDeal(t *testing.T) {
+	ledger, err := NewAIUsageLedger(t.TempDir())
+	require.NoError(t, err)
+
+	service := NewAIService(&AIConfig{CacheTTL: time.Minute, RateLimit: 6000})
+	service.providers = map[AIProvider]AIServiceInterface{
+		ProviderOpenAI: &entityUsageProvider{DefaultProvider: NewDefaultProvider()},
+	}
+	service.fallbackOrder = []AIProvider{ProviderOpenAI}
+	service.SetUsageLedger(ledger)
+
+	dir := t.TempDir()
+	var documents []DocumentInfo
+	for _, name := range []string{"board.txt", "management.txt"} {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(name+": Jane Smith, CEO"), 0644))
+		documents = append(documents, DocumentInfo{Name: name, Path: path, Type: DocTypeLegal})
+	}
+
+	mapper := NewDataMapper(service, NewTemplateParser(t.TempDir()))
+	extraction, warnings := mapper.extractPersonnelFromDocuments(documents, "Acme")
+	assert.Empty(t, warnings)
+	require.NotNil(t, extraction)
+	assert.Len(t, extraction.Personnel, 1, "people found in both documents are merged")
+
+	report, err := ledger.Report(time.Time{}, time.Time{})
+	require.NoError(t, err)
+	assert.Equal(t, int64(2), report.ByDeal["Acme"].Requests)
+}
+
+func TestParseUsagePeriod(t *testing.T) {
+	from, to, err := parseUsagePeriod("2024-06-01", "2024-06-30")
+	require.NoError(t, err)
+	assert.Equal(t, time.Date(2024, 6, 1, 0, 0, 0, 0, time.Local), from)
+	assert.Equal(t, time.Date(2024, 7, 1, 0, 0, 0, 0, time.Local), to)
+
+	from, to, err = parseUsagePeriod("", "")
+	require.NoError(t, err)
+	assert.True(t, from.IsZero())
+	assert.True(t, to.IsZero())
+
+	_, _, err = parseUsagePeriod("June", "")
+	assert.Error(t, err)
+	_, _, err = parseUsagePeriod("2024-07-01", "2024-06-01")
+	assert.Error(t, err)
+}
+
+func TestDealNameFromPath(t *testing.T) {
+	deals := filepath.Join("root", "Deals")
+	assert.Equal(t, "Acme", dealNameFromPath(deals, filepath.Join(deals, "Acme", "legal", "nda.pdf")))
+	assert.Equal(t, "", dealNameFromPath(deals, filepath.Join(deals, "stray.pdf")))
+	assert.Equal(t, "", dealNameFromPath(deals, filepath.Join("root", "Templates", "model.xlsx")))
+	assert.Equal(t, "", dealNameFromPath("", filepath.Join(deals, "Acme", "nda.pdf")))
+}
@@ -6,19 +6,25 @@ import (
 	"crypto/hmac"
 	"crypto/rand"
 	"crypto/sha256"
+	"encoding/csv"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
 	"time"
 
+	"DealDone/cache"
+
 	"github.com/joho/godotenv"
+	wailsruntime "github.com/wailsapp/wails/v2/pkg/runtime"
 )
 
 // App struct
@@ -33,12 +39,15 @@ type App struct {
 	aiService               *AIService
 	ocrService              *OCRService
 	documentRouter          *DocumentRouter
+	searchIndex             *SearchIndex
 	aiConfigManager         *AIConfigManager
 	templateParser          *TemplateParser
 	dataMapper              *DataMapper
+	tableExtractor          *FinancialTableExtractor
 	fieldMatcher            *FieldMatcher
 	templatePopulator       *TemplatePopulator
 	dealValuationCalculator *DealValuationCalculator
+	comparablesStore        *ComparablesStore
 	competitiveAnalyzer     *CompetitiveAnalyzer
 	trendAnalyzer           *TrendAnalyzer
 	anomalyDetector         *AnomalyDetector
@@ -52,9 +61,16 @@ type App struct {
 	schemaValidator         *WebhookSchemaValidator
 	authManager             *AuthManager
 	queueManager            *QueueManager
+	dealWatcher             *DealFolderWatcher
 	conflictResolver        *ConflictResolver
+	aiCacheStore            cache.Store
+	aiUsageLedger           *AIUsageLedger
+	aiAuditLogger           *AuditLogger // Outbound AI policy decisions
+	stateStore              *StateStore
 	workflowRecovery        *WorkflowRecoveryService
 	correctionProcessor     *CorrectionProcessor
+	feedbackLoop            *FeedbackLoop
+	rootOverride            string // DealDone root for this process only, set by the CLI
 }
 
 // NewApp creates a new App application struct
@@ -77,6 +93,13 @@ func priorityToString(priority ProcessingPriority) string {
 // startup is called when the app starts. The context is saved
 // so we can call the runtime methods
 func (a *App) startup(ctx context.Context) {
+	a.initServices(ctx)
+	a.startBackgroundServices()
+}
+
+// initServices creates the application services without starting any
+// background processing, so CLI commands can run against the same services
+func (a *App) initServices(ctx context.Context) {
 	a.ctx = ctx
 
 	// Load environment variables from .env file
@@ -101,6 +124,9 @@ func (a *App) startup(ctx context.Context) {
 			},
 		}
 	}
+	if a.rootOverride != "" {
+		configService.OverrideDealDoneRoot(a.rootOverride)
+	}
 	a.configService = configService
 
 	// Initialize folder manager
@@ -137,8 +163,9 @@ func (a *App) startup(ctx context.Context) {
 			// Create with default config
 			aiConfigManager = &AIConfigManager{
 				config: &AIConfig{
-					CacheTTL:  time.Minute * 30,
-					RateLimit: 60,
+					CacheTTL:         time.Minute * 30,
+					RateLimit:        60,
+					SecuritySettings: defaultSecuritySettings(),
 				},
 			}
 		}
@@ -146,17 +173,47 @@ func (a *App) startup(ctx context.Context) {
 		// Create with default config if initialization takes too long
 		aiConfigManager = &AIConfigManager{
 			config: &AIConfig{
-				CacheTTL:  time.Minute * 30,
-				RateLimit: 60,
+				CacheTTL:         time.Minute * 30,
+				RateLimit:        60,
+				SecuritySettings: defaultSecuritySettings(),
 			},
 		}
 	}
 	a.aiConfigManager = aiConfigManager
 
+	// Persist AI responses so a restart does not send every document to
+	// the providers again
+	aiCacheStore, cacheErr := cache.NewDiskStore(aiCachePath(configService.GetDealDoneRoot()), defaultAICacheMaxBytes, defaultAICacheMaxEntries)
+	if cacheErr != nil {
+		fmt.Printf("Warning: Failed to open AI response cache, responses will not persist: %v\n", cacheErr)
+	} else {
+		a.aiCacheStore = aiCacheStore
+	}
+
 	// Initialize AI service with config
 	aiService := NewAIService(aiConfigManager.GetConfig())
+	aiService.SetCacheStore(a.aiCacheStore)
 	a.aiService = aiService
 
+	// Record what the outbound policy sends to, and withholds from, the
+	// AI providers
+	aiAuditLogger, auditErr := NewAuditLogger(aiOutboundAuditPath(configService.GetDealDoneRoot()))
+	if auditErr != nil {
+		fmt.Printf("Warning: Failed to open AI outbound audit log: %v\n", auditErr)
+	} else {
+		a.aiAuditLogger = aiAuditLogger
+		aiService.SetAuditLogger(aiAuditLogger)
+	}
+
+	// Record AI spend per deal and enforce deal budgets
+	aiUsageLedger, ledgerErr := NewAIUsageLedger(filepath.Join(configService.GetDealDoneRoot(), "data", "ai_usage"))
+	if ledgerErr != nil {
+		fmt.Printf("Warning: Failed to open AI usage ledger, spend will not be tracked: %v\n", ledgerErr)
+	} else {
+		a.aiUsageLedger = aiUsageLedger
+		aiService.SetUsageLedger(aiUsageLedger)
+	}
+
 	// Initialize OCR service with tesseract as default provider
 	a.ocrService = NewOCRService("tesseract") // Enable OCR with tesseract
 
@@ -164,16 +221,25 @@ func (a *App) startup(ctx context.Context) {
 	a.documentProcessor = NewDocumentProcessor(aiService)
 	a.documentProcessor.SetOCRService(a.ocrService) // Set OCR service for PDF processing
 	a.documentRouter = NewDocumentRouter(a.folderManager, a.documentProcessor)
+	a.searchIndex = NewSearchIndex(a.folderManager, a.documentProcessor)
+	a.documentRouter.SetSearchIndex(a.searchIndex)
 
 	// Initialize template processing services
 	templatesPath := configService.GetTemplatesPath()
 	a.templateParser = NewTemplateParser(templatesPath)
 	a.fieldMatcher = NewFieldMatcher(aiService)
 	a.dataMapper = NewDataMapper(aiService, a.templateParser)
+	a.tableExtractor = NewFinancialTableExtractor(a.documentProcessor)
+	a.dataMapper.SetTableExtractor(a.tableExtractor)
 	a.templatePopulator = NewTemplatePopulator(a.templateParser)
 
 	// Initialize analysis services
 	a.dealValuationCalculator = NewDealValuationCalculator(aiService)
+	a.comparablesStore = NewComparablesStore(configService.GetComparablesPath())
+	if err := a.comparablesStore.Load(); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+	a.dealValuationCalculator.SetComparablesStore(a.comparablesStore)
 	a.competitiveAnalyzer = NewCompetitiveAnalyzer(aiService, a.documentProcessor)
 	a.trendAnalyzer = NewTrendAnalyzer(aiService, a.dataMapper)
 	a.anomalyDetector = NewAnomalyDetector(aiService, a.dataMapper)
@@ -211,8 +277,19 @@ func (a *App) startup(ctx context.Context) {
 	}
 	a.webhookService = webhookService
 
+	// Component state lives in one transactional store; state files from
+	// earlier versions are imported on first start
+	stateStore, err := OpenStateStore(stateStorePath(configService.GetDealDoneRoot()))
+	if err != nil {
+		fmt.Printf("Warning: Failed to open state store, state will not persist: %v\n", err)
+		stateStore = NewMemoryStateStore()
+	} else if err := stateStore.ImportLegacyState(configService.GetDealDoneRoot()); err != nil {
+		fmt.Printf("Warning: Failed to import legacy state: %v\n", err)
+	}
+	a.stateStore = stateStore
+
 	// Initialize job tracker
-	a.jobTracker = NewJobTracker(configService)
+	a.jobTracker = NewJobTrackerWithRepository(stateStore)
 
 	// Initialize n8n integration service
 	n8nConfig := &N8nConfig{
@@ -249,17 +326,11 @@ func (a *App) startup(ctx context.Context) {
 	}
 	a.n8nIntegration = n8nIntegration
 
-	// Start n8n integration service
-	if err := a.n8nIntegration.Start(); err != nil {
-		fmt.Printf("Warning: Failed to start n8n integration service: %v\n", err)
-	}
-
 	// Initialize schema validator
 	a.schemaValidator = NewWebhookSchemaValidator()
 
 	// Initialize authentication manager
-	authStoragePath := filepath.Join(configService.GetDealDoneRoot(), "config", "auth_keys.json")
-	authManager, err := NewAuthManager(authStoragePath, nil)
+	authManager, err := NewAuthManagerWithRepository(stateStore, filepath.Join(configService.GetDealDoneRoot(), "config"), nil)
 	if err != nil {
 		fmt.Printf("Warning: Failed to initialize auth manager: %v\n", err)
 	} else {
@@ -270,23 +341,16 @@ func (a *App) startup(ctx context.Context) {
 	a.webhookHandlers = NewWebhookHandlers(a, webhookService)
 
 	// Initialize queue manager
-	queueStoragePath := filepath.Join(configService.GetDealDoneRoot(), "data")
-	os.MkdirAll(queueStoragePath, 0755) // Ensure directory exists
-	a.queueManager = NewQueueManager(queueStoragePath)
-
-	// Start queue manager
-	if err := a.queueManager.Start(); err != nil {
-		fmt.Printf("Warning: Failed to start queue manager: %v\n", err)
-	}
-
-	// Initialize conflict resolver
-	conflictStoragePath := filepath.Join(configService.GetDealDoneRoot(), "data", "conflicts")
-	os.MkdirAll(conflictStoragePath, 0755) // Ensure directory exists
+	a.queueManager = NewQueueManagerWithRepository(stateStore)
+	a.registerQueueProcessors()
+	a.dealWatcher = NewDealFolderWatcher(a.queueManager, configService.GetDealsPath())
 
 	// Create a simple logger implementation for ConflictResolver
 	appLogger := &AppLogger{}
 
-	a.conflictResolver = NewConflictResolver(conflictStoragePath, appLogger)
+	// Initialize conflict resolver
+	a.conflictResolver = NewConflictResolverWithRepository(stateStore, appLogger)
+	a.aiService.SetConflictResolver(a.conflictResolver)
 
 	// Setup workflow recovery service
 	workflowRecoveryStoragePath := filepath.Join(configService.GetDealDoneRoot(), "data", "workflow_recovery")
@@ -307,6 +371,7 @@ func (a *App) startup(ctx context.Context) {
 		NotificationThreshold: SeverityHigh,
 		EnablePartialResults:  true,
 		StoragePath:           workflowRecoveryStoragePath,
+		Repository:            stateStore,
 	}
 
 	workflowNotifier := &AppErrorNotifier{logger: appLogger}
@@ -325,9 +390,73 @@ func (a *App) startup(ctx context.Context) {
 		StoragePath:                filepath.Join(configService.GetDealDoneRoot(), "data", "corrections"),
 		BackupInterval:             10 * time.Minute,
 		MaxCorrectionHistory:       1000,
+		Repository:                 stateStore,
+		Embedder:                   a.savedEmbedder(),
 	}
 
 	a.correctionProcessor = NewCorrectionProcessor(correctionConfig, &AppLogger{})
+
+	// Initialize Feedback Loop
+	feedbackConfig := FeedbackLoopConfig{
+		QueueSize:             100,
+		ProcessingInterval:    time.Minute,
+		MinFeedbacksToProcess: 5,
+		MaxProcessingBatch:    50,
+		FeedbackRetentionDays: 90,
+		ImpactThreshold:       0.5,
+		ConfidenceAdjustment:  0.1,
+		LearningRateModifier:  1.0,
+		StoragePath:           filepath.Join(configService.GetDealDoneRoot(), "data", "feedback"),
+		EnableBatchProcessing: true,
+		UserTrustWeighting:    0.5,
+		Repository:            stateStore,
+	}
+
+	a.feedbackLoop = NewFeedbackLoop(feedbackConfig, a.correctionProcessor, nil, &AppLogger{})
+}
+
+// startBackgroundServices starts the n8n integration, the queue workers and
+// the deal folder watcher
+func (a *App) startBackgroundServices() {
+	if err := a.n8nIntegration.Start(); err != nil {
+		fmt.Printf("Warning: Failed to start n8n integration service: %v\n", err)
+	}
+
+	if err := a.queueManager.Start(); err != nil {
+		fmt.Printf("Warning: Failed to start queue manager: %v\n", err)
+	}
+
+	// Watch deal folders that have auto-ingest enabled
+	for _, dealName := range a.configService.GetConfig().WatchedDeals {
+		if err := a.dealWatcher.EnableDeal(dealName); err != nil {
+			fmt.Printf("Warning: Failed to watch deal %s: %v\n", dealName, err)
+		}
+	}
+	if err := a.dealWatcher.Start(); err != nil {
+		fmt.Printf("Warning: Failed to start deal folder watcher: %v\n", err)
+	}
+}
+
+// shutdown is called when the app is closing
+func (a *App) shutdown(ctx context.Context) {
+	if a.dealWatcher != nil {
+		a.dealWatcher.Stop()
+	}
+
+	// Interrupted queue items resume on the next start
+	if a.queueManager != nil {
+		if err := a.queueManager.Stop(); err != nil {
+			fmt.Printf("Warning: Failed to stop queue manager: %v\n", err)
+		}
+	}
+
+	if a.feedbackLoop != nil {
+		a.feedbackLoop.Shutdown()
+	}
+
+	if a.aiAuditLogger != nil {
+		a.aiAuditLogger.Close()
+	}
 }
 
 // AppLogger implements the Logger interface for ConflictResolver
@@ -505,6 +634,37 @@ func (a *App) GetRoutingSummary(results []*RoutingResult) map[string]interface{}
 	return a.documentRouter.GetRoutingSummary(results)
 }
 
+// GetDealManifest returns the content manifest of documents routed into a deal
+func (a *App) GetDealManifest(dealName string) (*DealManifest, error) {
+	if a.documentRouter == nil {
+		return nil, fmt.Errorf("document router not initialized")
+	}
+
+	return a.documentRouter.GetManifest(dealName)
+}
+
+// SearchDealContent searches the text of a deal's documents, best matches
+// first. See parseSearchQuery for the query syntax.
+func (a *App) SearchDealContent(dealName, query string, limit int) (*ContentSearchResult, error) {
+	if a.searchIndex == nil {
+		return nil, fmt.Errorf("search index not initialized")
+	}
+	if dealName == "" {
+		return nil, fmt.Errorf("dealName is required")
+	}
+
+	return a.searchIndex.Search(dealName, query, limit)
+}
+
+// RebuildSearchIndex re-reads every document of a deal into its search index
+func (a *App) RebuildSearchIndex(dealName string) (*SearchIndexStatus, error) {
+	if a.searchIndex == nil {
+		return nil, fmt.Errorf("search index not initialized")
+	}
+
+	return a.searchIndex.Rebuild(dealName)
+}
+
 // GetSupportedFileTypes returns list of supported file extensions
 func (a *App) GetSupportedFileTypes() []string {
 	if a.documentProcessor == nil {
@@ -548,6 +708,28 @@ func (a *App) ExtractTextFromDocument(filePath string) (string, error) {
 	return a.documentProcessor.ExtractText(filePath)
 }
 
+// extractPagedText extracts document text with page breaks kept for AI analysis
+func (a *App) extractPagedText(filePath string) (string, error) {
+	if a.documentProcessor == nil {
+		return "", fmt.Errorf("document processor not initialized")
+	}
+
+	extraction, err := a.documentProcessor.ExtractPages(filePath)
+	if err != nil {
+		return "", err
+	}
+	return extraction.PagedText(), nil
+}
+
+// ExtractFinancialTables extracts financial statement tables as typed line items
+func (a *App) ExtractFinancialTables(filePath string) ([]FinancialTable, error) {
+	if a.tableExtractor == nil {
+		return nil, fmt.Errorf("table extractor not initialized")
+	}
+
+	return a.tableExtractor.ExtractTables(filePath)
+}
+
 // GetDocumentMetadata extracts metadata from a document
 func (a *App) GetDocumentMetadata(filePath string) (map[string]interface{}, error) {
 	if a.documentProcessor == nil {
@@ -664,11 +846,15 @@ func (a *App) GetAIProviderStatus() map[string]interface{} {
 	result := make(map[string]interface{})
 
 	for provider, providerStatus := range status {
-		result[string(provider)] = map[string]interface{}{
+		entry := map[string]interface{}{
 			"configured": providerStatus.Configured,
 			"model":      providerStatus.Model,
 			"enabled":    providerStatus.Enabled,
 		}
+		if providerStatus.Endpoint != "" {
+			entry["endpoint"] = providerStatus.Endpoint
+		}
+		result[string(provider)] = entry
 	}
 
 	return result
@@ -693,14 +879,104 @@ func (a *App) UpdateAIConfiguration(updates map[string]interface{}) error {
 		return err
 	}
 
-	// Reinitialize AI service with new config
-	a.aiService = NewAIService(a.aiConfigManager.GetConfig())
-	a.documentProcessor = NewDocumentProcessor(a.aiService)
-	a.documentRouter = NewDocumentRouter(a.folderManager, a.documentProcessor)
-
+	a.reloadAIService()
 	return nil
 }
 
+// reloadAIService applies a configuration change to the AI service. The
+// service is reconfigured in place, so the document processor, data mapper,
+// analyzers and every other component holding it follow the change.
+func (a *App) reloadAIService() {
+	config := a.aiConfigManager.GetConfig()
+	a.aiService.Reconfigure(config)
+
+	// Remote embeddings follow the new outbound policy, and local-only
+	// deployments never embed corrections remotely. The saved remote
+	// embedder is used again once local-only mode is lifted.
+	if a.correctionProcessor != nil {
+		remote, isRemote := a.correctionProcessor.Embedder().(*HTTPEmbedder)
+		switch {
+		case isRemote && config.LocalOnly:
+			if err := a.correctionProcessor.SetEmbedder(NewLocalEmbedder(DefaultEmbeddingDimensions)); err != nil {
+				fmt.Printf("Warning: Failed to switch to local embeddings: %v\n", err)
+			}
+		case isRemote:
+			remote.SetOutboundPolicy(a.aiService.OutboundPolicy())
+		case !config.LocalOnly:
+			if saved := a.savedEmbedder(); saved != nil {
+				if err := a.correctionProcessor.SetEmbedder(saved); err != nil {
+					fmt.Printf("Warning: Failed to restore %s embeddings: %v\n", saved.Name(), err)
+				}
+			}
+		}
+	}
+}
+
+// GetAICacheStats returns statistics for the AI response cache
+func (a *App) GetAICacheStats() (map[string]interface{}, error) {
+	if a.aiService == nil {
+		return nil, fmt.Errorf("AI service not initialized")
+	}
+	return a.aiService.GetCacheStats(), nil
+}
+
+// ClearAICache removes every cached AI response so documents are analyzed
+// again on their next use
+func (a *App) ClearAICache() error {
+	if a.aiService == nil {
+		return fmt.Errorf("AI service not initialized")
+	}
+	return a.aiService.ClearCache()
+}
+
+// GetAIUsageReport breaks down AI spend by deal, provider, model and
+// operation between two dates (YYYY-MM-DD, both inclusive). Empty dates
+// leave the period open.
+func (a *App) GetAIUsageReport(from, to string) (*AIUsageReport, error) {
+	if a.aiUsageLedger == nil {
+		return nil, fmt.Errorf("AI usage ledger not initialized")
+	}
+
+	start, end, err := parseUsagePeriod(from, to)
+	if err != nil {
+		return nil, err
+	}
+	return a.aiUsageLedger.Report(start, end)
+}
+
+// GetDealAIBudgetStatus returns a deal's AI spend against its budget
+func (a *App) GetDealAIBudgetStatus(dealName string) (*DealBudgetStatus, error) {
+	if a.aiUsageLedger == nil {
+		return nil, fmt.Errorf("AI usage ledger not initialized")
+	}
+	status := a.aiUsageLedger.BudgetStatus(dealName)
+	return &status, nil
+}
+
+// GetAIBudgets returns the AI budget of every deal that has one
+func (a *App) GetAIBudgets() (map[string]DealBudget, error) {
+	if a.aiUsageLedger == nil {
+		return nil, fmt.Errorf("AI usage ledger not initialized")
+	}
+	return a.aiUsageLedger.GetBudgets(), nil
+}
+
+// SetDealAIBudget sets a deal's soft and hard AI spend caps
+func (a *App) SetDealAIBudget(dealName string, budget DealBudget) error {
+	if a.aiUsageLedger == nil {
+		return fmt.Errorf("AI usage ledger not initialized")
+	}
+	return a.aiUsageLedger.SetBudget(dealName, &budget)
+}
+
+// RemoveDealAIBudget removes a deal's AI spend caps
+func (a *App) RemoveDealAIBudget(dealName string) error {
+	if a.aiUsageLedger == nil {
+		return fmt.Errorf("AI usage ledger not initialized")
+	}
+	return a.aiUsageLedger.SetBudget(dealName, nil)
+}
+
 // SetAIProvider sets the preferred AI provider
 func (a *App) SetAIProvider(provider string) error {
 	if a.aiConfigManager == nil {
@@ -720,16 +996,97 @@ func (a *App) SetAIAPIKey(provider string, apiKey string) error {
 		return err
 	}
 
-	// Reinitialize AI service with new config
-	a.aiService = NewAIService(a.aiConfigManager.GetConfig())
-	a.documentProcessor = NewDocumentProcessor(a.aiService)
-	a.documentRouter = NewDocumentRouter(a.folderManager, a.documentProcessor)
+	a.reloadAIService()
+	return nil
+}
 
+// SetLocalAIEndpoint adds or replaces a local OpenAI-compatible endpoint
+// (llama.cpp, Ollama, vLLM). An empty model uses the first one the server lists.
+func (a *App) SetLocalAIEndpoint(name, baseURL, model, apiKey string) error {
+	if a.aiConfigManager == nil {
+		return fmt.Errorf("AI configuration not initialized")
+	}
+
+	endpoint := LocalEndpoint{Name: name, BaseURL: baseURL, Model: model, APIKey: apiKey}
+	if err := a.aiConfigManager.SetLocalEndpoint(endpoint); err != nil {
+		return err
+	}
+
+	a.reloadAIService()
+	return nil
+}
+
+// RemoveLocalAIEndpoint removes a local endpoint by name
+func (a *App) RemoveLocalAIEndpoint(name string) error {
+	if a.aiConfigManager == nil {
+		return fmt.Errorf("AI configuration not initialized")
+	}
+
+	if err := a.aiConfigManager.RemoveLocalEndpoint(name); err != nil {
+		return err
+	}
+
+	a.reloadAIService()
 	return nil
 }
 
+// SetLocalAIOnly keeps all AI processing on local endpoints when enabled
+func (a *App) SetLocalAIOnly(localOnly bool) error {
+	if a.aiConfigManager == nil {
+		return fmt.Errorf("AI configuration not initialized")
+	}
+
+	if err := a.aiConfigManager.SetLocalOnly(localOnly); err != nil {
+		return err
+	}
+
+	a.reloadAIService()
+	return nil
+}
+
+// ListLocalAIModels returns the models a local endpoint serves, for choosing
+// the endpoint's model
+func (a *App) ListLocalAIModels(name string) ([]string, error) {
+	if a.aiConfigManager == nil {
+		return nil, fmt.Errorf("AI configuration not initialized")
+	}
+
+	for _, endpoint := range a.aiConfigManager.GetConfig().LocalEndpoints {
+		if endpoint.Name != name {
+			continue
+		}
+		provider, err := NewLocalProvider(endpoint)
+		if err != nil {
+			return nil, err
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		return provider.ListModels(ctx)
+	}
+
+	return nil, fmt.Errorf("local endpoint not found: %s", name)
+}
+
 // AI Analysis Methods
 
+// aiContext returns a context for an AI call about a file that streams
+// provider progress to the frontend as "ai:progress" events while the app is
+// running. Files inside a deal folder are billed to that deal.
+func (a *App) aiContext(parent context.Context, timeout time.Duration, filePath string) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithTimeout(parent, timeout)
+	if a.configService != nil {
+		ctx = WithAIDeal(ctx, dealNameFromPath(a.configService.GetDealsPath(), filePath))
+	}
+	ctx = WithAIDocument(ctx, filePath)
+	if a.ctx == nil || a.ctx.Value("events") == nil {
+		return ctx, cancel
+	}
+
+	return WithAIProgress(ctx, func(event AIProgressEvent) {
+		wailsruntime.EventsEmit(a.ctx, "ai:progress", event)
+	}), cancel
+}
+
 // AnalyzeDocumentRisks analyzes a document for potential risks
 func (a *App) AnalyzeDocumentRisks(filePath string) (*RiskAnalysis, error) {
 	if a.aiService == nil || !a.aiService.IsAvailable() {
@@ -737,7 +1094,7 @@ func (a *App) AnalyzeDocumentRisks(filePath string) (*RiskAnalysis, error) {
 	}
 
 	// Extract text from document
-	text, err := a.ExtractTextFromDocument(filePath)
+	text, err := a.extractPagedText(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract text: %w", err)
 	}
@@ -748,7 +1105,7 @@ func (a *App) AnalyzeDocumentRisks(filePath string) (*RiskAnalysis, error) {
 		return nil, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*2)
+	ctx, cancel := a.aiContext(context.Background(), time.Minute*2, filePath)
 	defer cancel()
 
 	return a.aiService.AnalyzeRisks(ctx, text, string(info.Type))
@@ -772,7 +1129,7 @@ func (a *App) GenerateDocumentInsights(filePath string) (*DocumentInsights, erro
 		return nil, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*2)
+	ctx, cancel := a.aiContext(context.Background(), time.Minute*2, filePath)
 	defer cancel()
 
 	return a.aiService.GenerateInsights(ctx, text, string(info.Type))
@@ -780,17 +1137,21 @@ func (a *App) GenerateDocumentInsights(filePath string) (*DocumentInsights, erro
 
 // ExtractDocumentEntities extracts named entities from a document
 func (a *App) ExtractDocumentEntities(filePath string) (*EntityExtraction, error) {
+	return a.extractDocumentEntities(context.Background(), filePath)
+}
+
+func (a *App) extractDocumentEntities(parent context.Context, filePath string) (*EntityExtraction, error) {
 	if a.aiService == nil || !a.aiService.IsAvailable() {
 		return nil, fmt.Errorf("AI service not available")
 	}
 
 	// Extract text from document
-	text, err := a.ExtractTextFromDocument(filePath)
+	text, err := a.extractPagedText(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract text: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*2)
+	ctx, cancel := a.aiContext(parent, time.Minute*2, filePath)
 	defer cancel()
 
 	return a.aiService.ExtractEntities(ctx, text)
@@ -798,17 +1159,21 @@ func (a *App) ExtractDocumentEntities(filePath string) (*EntityExtraction, error
 
 // ExtractFinancialData extracts financial data from a document
 func (a *App) ExtractFinancialData(filePath string) (*FinancialAnalysis, error) {
+	return a.extractFinancialData(context.Background(), filePath)
+}
+
+func (a *App) extractFinancialData(parent context.Context, filePath string) (*FinancialAnalysis, error) {
 	if a.aiService == nil || !a.aiService.IsAvailable() {
 		return nil, fmt.Errorf("AI service not available")
 	}
 
 	// Extract text from document
-	text, err := a.ExtractTextFromDocument(filePath)
+	text, err := a.extractPagedText(filePath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract text: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*2)
+	ctx, cancel := a.aiContext(parent, time.Minute*2, filePath)
 	defer cancel()
 
 	return a.aiService.ExtractFinancialData(ctx, text)
@@ -926,6 +1291,12 @@ func (a *App) ImportTemplate(sourcePath string, metadata *TemplateMetadata) erro
 	return a.templateDiscovery.ImportTemplate(sourcePath, metadata)
 }
 
+// ValidateTemplateBindings checks a template's binding manifest against the
+// template
+func (a *App) ValidateTemplateBindings(templatePath string) (*TemplateBindingManifest, error) {
+	return a.templateDiscovery.ValidateTemplateBindings(templatePath)
+}
+
 // SaveTemplateMetadata saves metadata for a template
 func (a *App) SaveTemplateMetadata(templatePath string, metadata *TemplateMetadata) error {
 	return a.templateDiscovery.SaveTemplateMetadata(templatePath, metadata)
@@ -970,7 +1341,7 @@ func (a *App) MapDataToTemplate(templatePath string, documentPaths []string, dea
 	// Process documents to get document info
 	documents := make([]DocumentInfo, 0, len(documentPaths))
 	for _, path := range documentPaths {
-		info, err := a.documentProcessor.ProcessDocument(path)
+		info, err := a.documentProcessor.ProcessDocumentForDeal(path, dealName)
 		if err != nil {
 			continue // Skip failed documents
 		}
@@ -1055,6 +1426,20 @@ func (a *App) CalculateQuickValuation(revenue, ebitda, netIncome float64) (*Valu
 	return a.dealValuationCalculator.CalculateQuickValuation(revenue, ebitda, netIncome), nil
 }
 
+// CalculateDCF runs the DCF model with explicit assumptions
+func (a *App) CalculateDCF(financialData *FinancialAnalysis, assumptions DCFAssumptions) (*DCFResult, error) {
+	if a.dealValuationCalculator == nil {
+		return nil, fmt.Errorf("deal valuation calculator not initialized")
+	}
+
+	return a.dealValuationCalculator.CalculateDCF(financialData, mergeDCFAssumptions(DefaultDCFAssumptions(financialData), assumptions))
+}
+
+// GetDefaultDCFAssumptions returns the starting assumptions for a target
+func (a *App) GetDefaultDCFAssumptions(financialData *FinancialAnalysis) DCFAssumptions {
+	return DefaultDCFAssumptions(financialData)
+}
+
 // GenerateValuationReport generates a text report of the valuation
 func (a *App) GenerateValuationReport(result *ValuationResult) (string, error) {
 	if a.dealValuationCalculator == nil {
@@ -1064,13 +1449,86 @@ func (a *App) GenerateValuationReport(result *ValuationResult) (string, error) {
 	return a.dealValuationCalculator.GenerateValuationReport(result), nil
 }
 
+// ListComparables returns stored comparables; kind is "trading",
+// "transaction" or empty for both
+func (a *App) ListComparables(kind string) ([]ComparableRecord, error) {
+	if a.comparablesStore == nil {
+		return nil, fmt.Errorf("comparables store not initialized")
+	}
+
+	return a.comparablesStore.List(ComparableKind(kind)), nil
+}
+
+// GetComparable returns a single comparable
+func (a *App) GetComparable(id string) (*ComparableRecord, error) {
+	if a.comparablesStore == nil {
+		return nil, fmt.Errorf("comparables store not initialized")
+	}
+
+	return a.comparablesStore.Get(id)
+}
+
+// AddComparable adds a trading comp or precedent transaction
+func (a *App) AddComparable(record ComparableRecord) (*ComparableRecord, error) {
+	if a.comparablesStore == nil {
+		return nil, fmt.Errorf("comparables store not initialized")
+	}
+
+	return a.comparablesStore.Add(record)
+}
+
+// UpdateComparable updates a stored comparable
+func (a *App) UpdateComparable(record ComparableRecord) (*ComparableRecord, error) {
+	if a.comparablesStore == nil {
+		return nil, fmt.Errorf("comparables store not initialized")
+	}
+
+	return a.comparablesStore.Update(record)
+}
+
+// DeleteComparable removes a stored comparable
+func (a *App) DeleteComparable(id string) error {
+	if a.comparablesStore == nil {
+		return fmt.Errorf("comparables store not initialized")
+	}
+
+	return a.comparablesStore.Delete(id)
+}
+
+// ImportComparables imports comparables from a CSV or JSON file
+func (a *App) ImportComparables(filePath string) (int, error) {
+	if a.comparablesStore == nil {
+		return 0, fmt.Errorf("comparables store not initialized")
+	}
+
+	return a.comparablesStore.Import(filePath)
+}
+
+// ReloadComparables re-reads the comparables directory after files change
+func (a *App) ReloadComparables() error {
+	if a.comparablesStore == nil {
+		return fmt.Errorf("comparables store not initialized")
+	}
+
+	return a.comparablesStore.Load()
+}
+
+// SelectComparables returns the peers most similar to the criteria
+func (a *App) SelectComparables(criteria ComparableCriteria) ([]ScoredComparable, error) {
+	if a.comparablesStore == nil {
+		return nil, fmt.Errorf("comparables store not initialized")
+	}
+
+	return a.comparablesStore.Select(criteria), nil
+}
+
 // AnalyzeCompetitiveLandscape performs competitive analysis
 func (a *App) AnalyzeCompetitiveLandscape(dealName string, targetCompany string, documents []DocumentInfo, marketData map[string]interface{}) (*CompetitiveAnalysis, error) {
 	if a.competitiveAnalyzer == nil {
 		return nil, fmt.Errorf("competitive analyzer not initialized")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*5)
+	ctx, cancel := context.WithTimeout(WithAIDeal(context.Background(), dealName), time.Minute*5)
 	defer cancel()
 
 	return a.competitiveAnalyzer.AnalyzeCompetitiveLandscape(ctx, dealName, targetCompany, documents, marketData)
@@ -1091,7 +1549,7 @@ func (a *App) AnalyzeTrends(dealName string, documents []DocumentInfo, historica
 		return nil, fmt.Errorf("trend analyzer not initialized")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*5)
+	ctx, cancel := context.WithTimeout(WithAIDeal(context.Background(), dealName), time.Minute*5)
 	defer cancel()
 
 	return a.trendAnalyzer.AnalyzeTrends(ctx, dealName, documents, historicalData)
@@ -1106,13 +1564,26 @@ func (a *App) QuickTrendAssessment(metricName string, values []float64) (map[str
 	return a.trendAnalyzer.QuickTrendAssessment(metricName, values), nil
 }
 
+// QuickTrendAssessmentFromDocuments assesses a metric's trend from the periods
+// reported in the given documents
+func (a *App) QuickTrendAssessmentFromDocuments(metricName string, documents []DocumentInfo) (map[string]interface{}, error) {
+	if a.trendAnalyzer == nil {
+		return nil, fmt.Errorf("trend analyzer not initialized")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*5)
+	defer cancel()
+
+	return a.trendAnalyzer.QuickTrendAssessmentFromDocuments(ctx, metricName, documents)
+}
+
 // DetectAnomalies performs anomaly detection
 func (a *App) DetectAnomalies(dealName string, documents []DocumentInfo, timeSeriesData map[string][]DataPoint) (*AnomalyDetectionResult, error) {
 	if a.anomalyDetector == nil {
 		return nil, fmt.Errorf("anomaly detector not initialized")
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Minute*5)
+	ctx, cancel := context.WithTimeout(WithAIDeal(context.Background(), dealName), time.Minute*5)
 	defer cancel()
 
 	return a.anomalyDetector.DetectAnomalies(ctx, dealName, documents, timeSeriesData)
@@ -1179,8 +1650,34 @@ func (a *App) ExportCompleteAnalysisReport(dealName string, outputPath string, f
 // Helper methods for exporting data
 
 func (a *App) exportValuationData(result *ValuationResult, outputPath string, format string) error {
-	// Implementation would depend on the format and requirements
-	// For now, return success
+	if result == nil {
+		return fmt.Errorf("no valuation result to export")
+	}
+	if err := os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return fmt.Errorf("failed to create export directory: %w", err)
+	}
+
+	file, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer file.Close()
+
+	switch format {
+	case "csv":
+		writer := csv.NewWriter(file)
+		if err := writer.WriteAll(ValuationCSVRows(result)); err != nil {
+			return fmt.Errorf("failed to write valuation CSV: %w", err)
+		}
+	case "json":
+		encoder := json.NewEncoder(file)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(result); err != nil {
+			return fmt.Errorf("failed to write valuation JSON: %w", err)
+		}
+	default:
+		return fmt.Errorf("unsupported export format: %s", format)
+	}
 	return nil
 }
 
@@ -1686,6 +2183,20 @@ func (a *App) GetWebhookEndpoints() (map[string]interface{}, error) {
 				"description": "Health check endpoint for monitoring",
 				"auth":        "none",
 			},
+			"aiUsage": map[string]interface{}{
+				"url":         fmt.Sprintf("%s/webhook/ai-usage", baseURL),
+				"method":      "GET",
+				"description": "AI spend by deal, provider, model and operation",
+				"auth":        "API key required",
+				"params":      []string{"from", "to"},
+			},
+			"aiBudgets": map[string]interface{}{
+				"url":         fmt.Sprintf("%s/webhook/ai-budgets", baseURL),
+				"method":      "GET, POST, DELETE",
+				"description": "Read, set or remove per-deal AI budgets",
+				"auth":        "API key required",
+				"params":      []string{"dealName"},
+			},
 		},
 	}, nil
 }
@@ -1694,10 +2205,14 @@ func (a *App) GetWebhookEndpoints() (map[string]interface{}, error) {
 func (a *App) createAuthenticatedWebhookServer(config *WebhookServerConfig) *http.Server {
 	mux := http.NewServeMux()
 
-	// Add authentication middleware for protected endpoints
-	mux.HandleFunc("/webhook/results", a.withAuthentication(a.webhookHandlers.HandleProcessingResults))
-	mux.HandleFunc("/webhook/status", a.withAuthentication(a.webhookHandlers.HandleStatusQuery))
-	mux.HandleFunc("/webhook/health", a.webhookHandlers.HandleHealthCheck) // No auth for health checks
+	// Every route other than the health check requires a key with its scope
+	for _, route := range a.webhookHandlers.Routes() {
+		if route.Policy.Public {
+			registerRoute(mux, route, route.Handler)
+			continue
+		}
+		registerRoute(mux, route, a.withAuthentication(route.Policy, route.Handler))
+	}
 
 	return &http.Server{
 		Addr:         fmt.Sprintf(":%d", config.Port),
@@ -1708,12 +2223,32 @@ func (a *App) createAuthenticatedWebhookServer(config *WebhookServerConfig) *htt
 	}
 }
 
-// withAuthentication wraps an HTTP handler with API key and HMAC authentication
-func (a *App) withAuthentication(handler http.HandlerFunc) http.HandlerFunc {
+// webhookRouteScopes maps each authenticated webhook route to the scope it
+// requires, with method-specific scopes keyed by "METHOD path"
+func (a *App) webhookRouteScopes() map[string]string {
+	scopes := make(map[string]string)
+	if a.webhookHandlers == nil {
+		return scopes
+	}
+	for _, route := range a.webhookHandlers.Routes() {
+		if route.Policy.Public {
+			continue
+		}
+		scopes[route.Path] = route.Policy.Scope
+		for method, scope := range route.Policy.MethodScopes {
+			scopes[method+" "+route.Path] = scope
+		}
+	}
+	return scopes
+}
+
+// withAuthentication wraps an HTTP handler with API key and HMAC
+// authentication and checks the key against the route's policy
+func (a *App) withAuthentication(policy RoutePolicy, handler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Set CORS headers
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Methods", "POST, GET, DELETE, OPTIONS")
 		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-API-Key, X-Signature, X-Timestamp")
 
 		// Handle preflight OPTIONS request
@@ -1722,12 +2257,6 @@ func (a *App) withAuthentication(handler http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		// Skip authentication for health checks
-		if r.URL.Path == "/webhook/health" {
-			handler(w, r)
-			return
-		}
-
 		// Extract authentication headers
 		apiKey := r.Header.Get("X-API-Key")
 		signature := r.Header.Get("X-Signature")
@@ -1738,71 +2267,81 @@ func (a *App) withAuthentication(handler http.HandlerFunc) http.HandlerFunc {
 			return
 		}
 
-		// Authenticate request using AuthManager
-		if a.authManager != nil {
-			// Read body for authentication
-			var body string
-			if r.Body != nil {
-				bodyBytes, err := io.ReadAll(r.Body)
-				if err != nil {
-					http.Error(w, "Failed to read request body", http.StatusBadRequest)
-					return
-				}
-				body = string(bodyBytes)
-				// Restore body for handler
-				r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
-			}
+		// Without an AuthManager no key can be checked against the policy
+		if a.authManager == nil {
+			http.Error(w, "Authentication unavailable", http.StatusServiceUnavailable)
+			return
+		}
 
-			// Parse timestamp
-			var timestampInt int64
-			if timestamp != "" {
-				var err error
-				timestampInt, err = strconv.ParseInt(timestamp, 10, 64)
-				if err != nil {
-					timestampInt = time.Now().Unix()
-				}
-			} else {
-				timestampInt = time.Now().Unix()
+		// Read body for authentication
+		var bodyBytes []byte
+		if r.Body != nil {
+			var err error
+			bodyBytes, err = io.ReadAll(r.Body)
+			if err != nil {
+				http.Error(w, "Failed to read request body", http.StatusBadRequest)
+				return
 			}
+			// Restore body for handler
+			r.Body = io.NopCloser(bytes.NewBuffer(bodyBytes))
+		}
+		body := string(bodyBytes)
 
-			// Create authentication request
-			authReq := &AuthenticationRequest{
-				APIKey:    apiKey,
-				Signature: signature,
-				Timestamp: timestampInt,
-				Method:    r.Method,
-				Path:      r.URL.Path,
-				Body:      body,
-				Headers:   make(map[string]string),
-				ClientIP:  r.RemoteAddr,
-				UserAgent: r.UserAgent(),
-				RequestID: r.Header.Get("X-Request-ID"),
+		// Parse timestamp
+		var timestampInt int64
+		if timestamp != "" {
+			var err error
+			timestampInt, err = strconv.ParseInt(timestamp, 10, 64)
+			if err != nil {
+				timestampInt = time.Now().Unix()
 			}
-
-			// Copy relevant headers
-			for key, values := range r.Header {
-				if len(values) > 0 {
-					authReq.Headers[key] = values[0]
-				}
+		} else {
+			timestampInt = time.Now().Unix()
+		}
+
+		// Create authentication request
+		authReq := &AuthenticationRequest{
+			APIKey:    apiKey,
+			Signature: signature,
+			Timestamp: timestampInt,
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Body:      body,
+			Headers:   make(map[string]string),
+			ClientIP:  remoteIP(r),
+			UserAgent: r.UserAgent(),
+			RequestID: r.Header.Get("X-Request-ID"),
+		}
+
+		// Copy relevant headers
+		for key, values := range r.Header {
+			if len(values) > 0 {
+				authReq.Headers[key] = values[0]
 			}
+		}
 
-			// Authenticate the request
-			authResult, err := a.authManager.AuthenticateRequest(authReq)
-			if err != nil {
-				http.Error(w, fmt.Sprintf("Authentication error: %v", err), http.StatusInternalServerError)
-				return
-			}
+		// Authenticate the request
+		authResult, err := a.authManager.AuthenticateRequest(authReq)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("Authentication error: %v", err), http.StatusInternalServerError)
+			return
+		}
 
-			if !authResult.Success {
-				http.Error(w, authResult.ErrorMessage, http.StatusUnauthorized)
-				return
+		if authResult.Success {
+			authResult = a.authManager.AuthorizeRequest(authResult, authReq, policy, requestDeals(r, bodyBytes))
+		}
+		if !authResult.Success {
+			if authResult.ErrorCode == "RATE_LIMIT_EXCEEDED" {
+				w.Header().Set("Retry-After", strconv.Itoa(a.authManager.retryAfterSeconds(authResult.RateLimitTier)))
 			}
-
-			// Add authentication info to request context for handler use
-			ctx := context.WithValue(r.Context(), "authResult", authResult)
-			r = r.WithContext(ctx)
+			http.Error(w, authResult.ErrorMessage, authFailureStatus(authResult.ErrorCode))
+			return
 		}
 
+		// Add authentication info to request context for handler use
+		ctx := context.WithValue(r.Context(), "authResult", authResult)
+		r = r.WithContext(ctx)
+
 		// Call the original handler
 		handler(w, r)
 	}
@@ -2784,6 +3323,8 @@ func (a *App) GenerateAPIKey(req map[string]interface{}) (map[string]interface{}
 	if rateLimitTier, ok := req["rateLimitTier"].(string); ok {
 		keyReq.RateLimitTier = rateLimitTier
 	}
+	keyReq.IPWhitelist = getStringSlice(req, "ipWhitelist")
+	keyReq.AllowedDeals = getStringSlice(req, "allowedDeals")
 
 	result, err := a.authManager.GenerateAPIKey(keyReq)
 	if err != nil {
@@ -2800,6 +3341,8 @@ func (a *App) GenerateAPIKey(req map[string]interface{}) (map[string]interface{}
 		"generatedAt":   result.GeneratedAt,
 		"isActive":      result.KeyInfo.IsActive,
 		"rateLimitTier": result.KeyInfo.RateLimitTier,
+		"ipWhitelist":   result.KeyInfo.IPWhitelist,
+		"allowedDeals":  result.KeyInfo.AllowedDeals,
 	}, nil
 }
 
@@ -2827,6 +3370,8 @@ func (a *App) ListAPIKeys() ([]map[string]interface{}, error) {
 			"usageCount":    key.UsageCount,
 			"isActive":      key.IsActive,
 			"rateLimitTier": key.RateLimitTier,
+			"ipWhitelist":   key.IPWhitelist,
+			"allowedDeals":  key.AllowedDeals,
 		}
 	}
 
@@ -2864,6 +3409,8 @@ func (a *App) GetAPIKeyInfo(keyID string) (map[string]interface{}, error) {
 		"usageCount":    key.UsageCount,
 		"isActive":      key.IsActive,
 		"rateLimitTier": key.RateLimitTier,
+		"ipWhitelist":   key.IPWhitelist,
+		"allowedDeals":  key.AllowedDeals,
 	}, nil
 }
 
@@ -2877,7 +3424,7 @@ func (a *App) CreateWebhookAuthPair(name string, description string) (map[string
 	keyReq := &KeyGenerationRequest{
 		Name:           name,
 		Description:    description + " (webhook communication)",
-		Permissions:    []string{"webhook:receive", "webhook:send", "documents:process"},
+		Permissions:    []string{ScopeWriteJobs, ScopeReadJobs, ScopeWriteDocuments, ScopeReadTemplates, ScopeWriteTemplates},
 		RateLimitTier:  "premium",
 		ExpirationDays: 365, // 1 year
 	}
@@ -2984,6 +3531,67 @@ func (a *App) EnqueueDocument(dealName, documentPath, documentName string, prior
 	}, nil
 }
 
+// registerQueueProcessors sets up the stages queued documents run through:
+// route into the deal folder, extract fields, then populate templates
+func (a *App) registerQueueProcessors() {
+	a.queueManager.RegisterProcessor("route", func(ctx context.Context, item QueueItem) (map[string]interface{}, error) {
+		if a.documentRouter == nil {
+			return nil, fmt.Errorf("document router not initialized")
+		}
+		if _, err := os.Stat(item.DocumentPath); os.IsNotExist(err) {
+			return nil, NonRetryable(fmt.Errorf("document not found: %s", item.DocumentPath))
+		}
+
+		result, err := a.documentRouter.RouteDocumentContext(ctx, item.DocumentPath, item.DealName)
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"destinationPath":  result.DestinationPath,
+			"documentType":     string(result.DocumentType),
+			"alreadyProcessed": result.AlreadyProcessed,
+		}, nil
+	})
+
+	a.queueManager.RegisterProcessor("extract", func(ctx context.Context, item QueueItem) (map[string]interface{}, error) {
+		params := map[string]interface{}{
+			"documentData": map[string]interface{}{"filePath": queuedDocumentPath(item)},
+		}
+		result, err := a.extractDocumentFields(ctx, params, item.DealName)
+		if err != nil {
+			return nil, err
+		}
+		if total, ok := result["totalFields"].(int); ok {
+			result["fieldsExtracted"] = float64(total)
+		}
+		return result, nil
+	})
+
+	a.queueManager.RegisterProcessor("populate", func(ctx context.Context, item QueueItem) (map[string]interface{}, error) {
+		result, err := a.legacyAnalyzeDocumentsAndPopulateTemplates(ctx, item.DealName, []string{queuedDocumentPath(item)})
+		if err != nil {
+			return nil, err
+		}
+		return map[string]interface{}{
+			"templatesUsed": result.PopulatedTemplates,
+			"errors":        result.Errors,
+		}, nil
+	})
+}
+
+// queuedDocumentPath returns where the route stage filed the document,
+// falling back to the original path
+func queuedDocumentPath(item QueueItem) string {
+	if results, ok := item.Metadata["stageResults"].(map[string]interface{}); ok {
+		if route, ok := results["route"].(map[string]interface{}); ok {
+			if path, ok := route["destinationPath"].(string); ok && path != "" {
+				return path
+			}
+		}
+	}
+	return item.DocumentPath
+}
+
 // GetQueueStatus returns current queue statistics
 func (a *App) GetQueueStatus() (map[string]interface{}, error) {
 	if a.queueManager == nil {
@@ -3104,13 +3712,71 @@ func (a *App) GetDealFolderMirror(dealName string) (map[string]interface{}, erro
 		return nil, fmt.Errorf("queue manager not initialized")
 	}
 
-	// Access the internal mirror (simplified for frontend)
-	// In production, you'd expose this through a proper method
+	mirror, exists := a.queueManager.GetDealFolderMirror(dealName)
+	if !exists {
+		return nil, fmt.Errorf("deal folder not tracked: %s", dealName)
+	}
+
+	files := make([]map[string]interface{}, 0, len(mirror.FileStructure))
+	for _, info := range mirror.FileStructure {
+		files = append(files, map[string]interface{}{
+			"path":            info.Path,
+			"size":            info.Size,
+			"modifiedAt":      info.ModifiedAt.Format(time.RFC3339),
+			"checksum":        info.Checksum,
+			"processingState": info.ProcessingState,
+			"queueItemId":     info.QueueItemID,
+		})
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i]["path"].(string) < files[j]["path"].(string)
+	})
+
+	return map[string]interface{}{
+		"dealName":       dealName,
+		"folderPath":     mirror.FolderPath,
+		"syncStatus":     string(mirror.SyncStatus),
+		"fileCount":      mirror.FileCount,
+		"processedFiles": mirror.ProcessedFiles,
+		"conflictFiles":  mirror.ConflictFiles,
+		"files":          files,
+		"watched":        a.dealWatcher != nil && a.dealWatcher.IsWatching(dealName),
+		"lastSynced":     mirror.LastSynced.Format(time.RFC3339),
+	}, nil
+}
+
+// SetDealFolderWatching turns automatic ingestion of new files in a deal
+// folder on or off
+func (a *App) SetDealFolderWatching(dealName string, enabled bool) error {
+	if a.dealWatcher == nil {
+		return fmt.Errorf("deal folder watcher not initialized")
+	}
+
+	if enabled {
+		if err := a.dealWatcher.EnableDeal(dealName); err != nil {
+			return err
+		}
+	} else {
+		a.dealWatcher.DisableDeal(dealName)
+	}
+
+	if a.configService != nil {
+		if err := a.configService.SetDealWatched(dealName, enabled); err != nil {
+			return fmt.Errorf("failed to save watched deals: %w", err)
+		}
+	}
+	return nil
+}
+
+// GetDealFolderWatcherStatus returns the watcher mode and watched deals
+func (a *App) GetDealFolderWatcherStatus() (map[string]interface{}, error) {
+	if a.dealWatcher == nil {
+		return nil, fmt.Errorf("deal folder watcher not initialized")
+	}
+
 	return map[string]interface{}{
-		"dealName":   dealName,
-		"syncStatus": "synced", // Placeholder
-		"fileCount":  0,        // Placeholder
-		"lastSynced": time.Now().Format(time.RFC3339),
+		"mode":         a.dealWatcher.Mode(),
+		"watchedDeals": a.dealWatcher.WatchedDeals(),
 	}, nil
 }
 
@@ -3197,14 +3863,9 @@ func (a *App) GetAuthManagerConfiguration() (map[string]interface{}, error) {
 			"keyRotation":      false, // Not fully implemented
 			"ipWhitelisting":   true,
 		},
-		"supportedTiers": []string{"basic", "premium", "unlimited"},
-		"supportedPermissions": []string{
-			"webhook:receive",
-			"webhook:send",
-			"documents:process",
-			"jobs:query",
-			"admin:manage",
-		},
+		"supportedTiers":       []string{"basic", "premium", "unlimited"},
+		"supportedPermissions": append([]string{ScopeAll}, Scopes...),
+		"routeScopes":          a.webhookRouteScopes(),
 	}, nil
 }
 
@@ -3595,6 +4256,91 @@ func (a *App) ApplyLearningToDocument(documentData map[string]interface{}, conte
 	return a.correctionProcessor.ApplyLearning(documentData, context)
 }
 
+// SuggestFieldMappingsFromCorrections returns mappings learned from
+// corrections on similarly named fields in earlier deals
+func (a *App) SuggestFieldMappingsFromCorrections(fieldName string, maxResults int) ([]LearningRecommendation, error) {
+	if a.correctionProcessor == nil {
+		return nil, fmt.Errorf("correction processor not initialized")
+	}
+
+	return a.correctionProcessor.SuggestFieldMappings(fieldName, maxResults)
+}
+
+// ConfigureEmbeddings selects the embedding provider used for correction
+// retrieval: "local" (default), "openai" or "voyage". The provider and model
+// are saved and used again at startup, but the key is not; without a key the
+// OpenAI key of the AI settings or VOYAGE_API_KEY is used.
+func (a *App) ConfigureEmbeddings(provider, apiKey, model string) error {
+	if a.correctionProcessor == nil {
+		return fmt.Errorf("correction processor not initialized")
+	}
+
+	embedder, err := a.newEmbedder(provider, apiKey, model)
+	if err != nil {
+		return err
+	}
+	if err := a.correctionProcessor.SetEmbedder(embedder); err != nil {
+		return err
+	}
+
+	if a.aiConfigManager != nil {
+		if err := a.aiConfigManager.SetEmbeddings(provider, model); err != nil {
+			return fmt.Errorf("failed to save embedding settings: %w", err)
+		}
+	}
+	return nil
+}
+
+// newEmbedder creates the embedder for provider. Remote embedders are
+// refused in local-only mode and otherwise screened by the outbound policy.
+func (a *App) newEmbedder(provider, apiKey, model string) (Embedder, error) {
+	if apiKey == "" {
+		apiKey = a.embeddingKey(provider)
+	}
+	embedder, err := NewEmbedderForProvider(provider, apiKey, model, DefaultEmbeddingDimensions)
+	if err != nil {
+		return nil, err
+	}
+	if remote, ok := embedder.(*HTTPEmbedder); ok {
+		if a.aiConfigManager != nil && a.aiConfigManager.GetConfig().LocalOnly {
+			return nil, fmt.Errorf("remote embeddings are not allowed while AI processing is local-only")
+		}
+		// Correction text sent for embedding is screened like any AI request
+		if a.aiService != nil {
+			remote.SetOutboundPolicy(a.aiService.OutboundPolicy())
+		}
+	}
+	return embedder, nil
+}
+
+// embeddingKey returns the stored API key for a remote embedding provider
+func (a *App) embeddingKey(provider string) string {
+	switch strings.ToLower(provider) {
+	case "openai":
+		if a.aiConfigManager != nil {
+			return a.aiConfigManager.GetConfig().OpenAIKey
+		}
+	case "voyage", "claude", "anthropic":
+		return os.Getenv("VOYAGE_API_KEY")
+	}
+	return ""
+}
+
+// savedEmbedder returns the embedder saved by ConfigureEmbeddings, or nil
+// for local embeddings
+func (a *App) savedEmbedder() Embedder {
+	settings := a.aiConfigManager.GetConfig().Embeddings
+	if settings.Provider == "" || strings.EqualFold(settings.Provider, "local") {
+		return nil
+	}
+	embedder, err := a.newEmbedder(settings.Provider, "", settings.Model)
+	if err != nil {
+		fmt.Printf("Warning: Using local embeddings instead of %s: %v\n", settings.Provider, err)
+		return nil
+	}
+	return embedder
+}
+
 // GetCorrectionHistory returns the history of corrections for a specific deal or field
 func (a *App) GetCorrectionHistory(filters CorrectionHistoryFilters) ([]*CorrectionEntry, error) {
 	if a.correctionProcessor == nil {
@@ -4037,6 +4783,12 @@ func (a *App) getRequiredFields(fields []TemplateField) []string {
 
 // ExtractDocumentFields extracts fields from documents for template mapping
 func (a *App) ExtractDocumentFields(mappingParams map[string]interface{}, dealName string) (map[string]interface{}, error) {
+	return a.extractDocumentFields(context.Background(), mappingParams, dealName)
+}
+
+// extractDocumentFields is ExtractDocumentFields with the AI calls stopped
+// when ctx is done
+func (a *App) extractDocumentFields(ctx context.Context, mappingParams map[string]interface{}, dealName string) (map[string]interface{}, error) {
 	if a.documentProcessor == nil {
 		return nil, fmt.Errorf("document processor not initialized")
 	}
@@ -4053,19 +4805,19 @@ func (a *App) ExtractDocumentFields(mappingParams map[string]interface{}, dealNa
 	}
 
 	// Process the document to extract structured data
-	docInfo, err := a.documentProcessor.ProcessDocument(filePath)
+	docInfo, err := a.documentProcessor.ProcessDocumentContext(ctx, filePath, dealName)
 	if err != nil {
 		return nil, fmt.Errorf("failed to process document: %w", err)
 	}
 
 	// Extract financial data if available
-	financialData, err := a.ExtractFinancialData(filePath)
+	financialData, err := a.extractFinancialData(ctx, filePath)
 	if err != nil {
 		fmt.Printf("Warning: Financial data extraction failed for %s: %v\n", filePath, err)
 	}
 
 	// Extract entities
-	entities, err := a.ExtractDocumentEntities(filePath)
+	entities, err := a.extractDocumentEntities(ctx, filePath)
 	if err != nil {
 		fmt.Printf("Warning: Entity extraction failed for %s: %v\n", filePath, err)
 	}
@@ -4375,6 +5127,15 @@ func (a *App) PopulateTemplateWithData(templateId string, fieldMappings []map[st
 		"populationTime":        time.Now().Unix(),
 	}
 
+	// Recalculate the model and run its accounting checks; a failed check
+	// is reported, not treated as a population failure
+	report, err := a.templatePopulator.CheckPopulatedModel(analysisTemplatePath)
+	if err != nil {
+		log.Printf("Model integrity check failed for %s: %v", analysisTemplatePath, err)
+	} else if report != nil {
+		response["integrityReport"] = report
+	}
+
 	return response, nil
 }
 
@@ -4534,7 +5295,7 @@ func (a *App) AnalyzeDocumentsAndPopulateTemplates(dealName string, documentPath
 		fmt.Printf("Pre-analyzing documents to determine types for template copying...\n")
 		documentTypes := make(map[string]string)
 		for _, docPath := range documentPaths {
-			docInfo, err := a.documentProcessor.ProcessDocument(docPath)
+			docInfo, err := a.documentProcessor.ProcessDocumentForDeal(docPath, dealName)
 			if err != nil {
 				result.Errors = append(result.Errors, fmt.Sprintf("Failed to process %s: %v", docPath, err))
 				continue
@@ -4610,7 +5371,7 @@ func (a *App) AnalyzeDocumentsAndPopulateTemplates(dealName string, documentPath
 			if a.jobTracker != nil {
 				a.jobTracker.FailJob(jobID, fmt.Sprintf("n8n workflow failed: %v", err))
 			}
-			return a.legacyAnalyzeDocumentsAndPopulateTemplates(dealName, documentPaths)
+			return a.legacyAnalyzeDocumentsAndPopulateTemplates(context.Background(), dealName, documentPaths)
 		}
 
 		// Update job status
@@ -4637,11 +5398,12 @@ func (a *App) AnalyzeDocumentsAndPopulateTemplates(dealName string, documentPath
 
 	// Fallback to legacy processing if n8n is not available
 	fmt.Printf("Warning: n8n integration not available, using legacy processing\n")
-	return a.legacyAnalyzeDocumentsAndPopulateTemplates(dealName, documentPaths)
+	return a.legacyAnalyzeDocumentsAndPopulateTemplates(context.Background(), dealName, documentPaths)
 }
 
-// legacyAnalyzeDocumentsAndPopulateTemplates is the original implementation for fallback
-func (a *App) legacyAnalyzeDocumentsAndPopulateTemplates(dealName string, documentPaths []string) (*TemplateAnalysisResult, error) {
+// legacyAnalyzeDocumentsAndPopulateTemplates is the original implementation
+// for fallback. It stops before the next document once ctx is done.
+func (a *App) legacyAnalyzeDocumentsAndPopulateTemplates(ctx context.Context, dealName string, documentPaths []string) (*TemplateAnalysisResult, error) {
 	result := &TemplateAnalysisResult{
 		DealName:           dealName,
 		ProcessedDocuments: make([]string, 0),
@@ -4654,7 +5416,10 @@ func (a *App) legacyAnalyzeDocumentsAndPopulateTemplates(dealName string, docume
 	// Step 1: Analyze each document to determine types
 	documentTypes := make(map[string]string)
 	for _, docPath := range documentPaths {
-		docInfo, err := a.documentProcessor.ProcessDocument(docPath)
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		docInfo, err := a.documentProcessor.ProcessDocumentContext(ctx, docPath, dealName)
 		if err != nil {
 			result.Errors = append(result.Errors, fmt.Sprintf("Failed to process %s: %v", docPath, err))
 			continue
@@ -4685,6 +5450,10 @@ func (a *App) legacyAnalyzeDocumentsAndPopulateTemplates(dealName string, docume
 	// Step 4: For each document, try to find and populate relevant templates
 	// Only process actual source documents (PDFs), not template files
 	for _, docPath := range result.ProcessedDocuments {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
 		// Skip template files - only process source documents
 		fileName := filepath.Base(docPath)
 		if strings.Contains(strings.ToLower(fileName), "template") {
@@ -4729,7 +5498,7 @@ func (a *App) legacyAnalyzeDocumentsAndPopulateTemplates(dealName string, docume
 			"templateInfo": bestTemplate,
 		}
 
-		extractedFields, err := a.ExtractDocumentFields(mappingParams, dealName)
+		extractedFields, err := a.extractDocumentFields(ctx, mappingParams, dealName)
 		if err != nil {
 			result.Errors = append(result.Errors, fmt.Sprintf("Field extraction failed for %s: %v", docPath, err))
 			continue
@@ -4919,8 +5688,8 @@ func (a *App) extractSampleDataFromTemplate(templateData *TemplateData) []map[st
 			return a.extractSampleDataFromSheet(&sheet)
 		}
 
-	case "text":
-		// For text templates, show headers as placeholders
+	case "text", "docx", "pptx":
+		// For text, Word and PowerPoint templates, show headers as placeholders
 		if len(templateData.Headers) > 0 {
 			fieldData := make(map[string]interface{})
 			for _, header := range templateData.Headers {
@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"net"
 	"os"
 	"path/filepath"
 	"sync"
@@ -18,10 +19,11 @@ import (
 // AuthManager handles authentication and API key management
 type AuthManager struct {
 	keys           map[string]*APIKeyInfo
-	keyStorage     string
+	repo           APIKeyRepository
 	mu             sync.RWMutex
 	config         *AuthConfig
-	rateLimiter    *RateLimiter
+	keyLimiters    map[string]*RateLimiter
+	limiterMu      sync.Mutex
 	auditLogger    *AuditLogger
 	encryptionKey  []byte
 	lastRotation   time.Time
@@ -29,6 +31,12 @@ type AuthManager struct {
 	stopRotation   chan bool
 }
 
+// APIKeyRepository persists API keys
+type APIKeyRepository interface {
+	LoadAPIKeys() (map[string]*APIKeyInfo, error)
+	SaveAPIKeys(keys map[string]*APIKeyInfo) error
+}
+
 // APIKeyInfo contains information about an API key
 type APIKeyInfo struct {
 	KeyID           string                 `json:"keyId"`
@@ -44,6 +52,7 @@ type APIKeyInfo struct {
 	RateLimitTier   string                 `json:"rateLimitTier"` // "basic", "premium", "unlimited"
 	Tags            []string               `json:"tags,omitempty"`
 	IPWhitelist     []string               `json:"ipWhitelist,omitempty"`
+	AllowedDeals    []string               `json:"allowedDeals,omitempty"` // Empty allows every deal
 	Metadata        map[string]interface{} `json:"metadata,omitempty"`
 	RotationHistory []KeyRotationEvent     `json:"rotationHistory,omitempty"`
 }
@@ -71,6 +80,7 @@ type AuthConfig struct {
 	HashAlgorithm       string            `json:"hashAlgorithm"`
 	EncryptionAlgorithm string            `json:"encryptionAlgorithm"`
 	RateLimitEnabled    bool              `json:"rateLimitEnabled"`
+	RateLimitTiers      map[string]int    `json:"rateLimitTiers,omitempty"` // Requests per minute by tier
 	SecurityPolicies    *SecurityPolicies `json:"securityPolicies"`
 }
 
@@ -106,6 +116,7 @@ type AuthenticationResult struct {
 	KeyID         string                 `json:"keyId,omitempty"`
 	Permissions   []string               `json:"permissions,omitempty"`
 	RateLimitTier string                 `json:"rateLimitTier,omitempty"`
+	AllowedDeals  []string               `json:"allowedDeals,omitempty"`
 	ExpiresAt     *time.Time             `json:"expiresAt,omitempty"`
 	ErrorCode     string                 `json:"errorCode,omitempty"`
 	ErrorMessage  string                 `json:"errorMessage,omitempty"`
@@ -122,6 +133,7 @@ type KeyGenerationRequest struct {
 	RateLimitTier  string                 `json:"rateLimitTier"`
 	Tags           []string               `json:"tags,omitempty"`
 	IPWhitelist    []string               `json:"ipWhitelist,omitempty"`
+	AllowedDeals   []string               `json:"allowedDeals,omitempty"`
 	Metadata       map[string]interface{} `json:"metadata,omitempty"`
 	AutoRotate     bool                   `json:"autoRotate"`
 }
@@ -157,8 +169,21 @@ type AuditLogger struct {
 	retention   time.Duration
 }
 
-// NewAuthManager creates a new authentication manager
+// NewAuthManager creates an authentication manager persisted in a state
+// store beside keyStoragePath, importing the key file written by earlier
+// versions
 func NewAuthManager(keyStoragePath string, config *AuthConfig) (*AuthManager, error) {
+	dir := filepath.Dir(keyStoragePath)
+	repo := openComponentStore(dir)
+	if err := repo.importLegacyAPIKeys(keyStoragePath); err != nil {
+		log.Printf("Warning: Failed to import API keys: %v", err)
+	}
+	return NewAuthManagerWithRepository(repo, dir, config)
+}
+
+// NewAuthManagerWithRepository creates an authentication manager that keeps
+// API keys in repo and its audit log in auditDir
+func NewAuthManagerWithRepository(repo APIKeyRepository, auditDir string, config *AuthConfig) (*AuthManager, error) {
 	if config == nil {
 		config = &AuthConfig{
 			DefaultExpiration:   24 * time.Hour * 30,  // 30 days
@@ -192,7 +217,7 @@ func NewAuthManager(keyStoragePath string, config *AuthConfig) (*AuthManager, er
 	// Initialize audit logger
 	var auditLogger *AuditLogger
 	if config.EnableAuditLogging {
-		auditLogPath := filepath.Join(filepath.Dir(keyStoragePath), "auth_audit.log")
+		auditLogPath := filepath.Join(auditDir, "auth_audit.log")
 		logger, err := NewAuditLogger(auditLogPath)
 		if err != nil {
 			log.Printf("Warning: Failed to initialize audit logger: %v", err)
@@ -201,17 +226,11 @@ func NewAuthManager(keyStoragePath string, config *AuthConfig) (*AuthManager, er
 		}
 	}
 
-	// Initialize rate limiter
-	var rateLimiter *RateLimiter
-	if config.RateLimitEnabled {
-		rateLimiter = NewRateLimiter(60) // 60 requests per minute default
-	}
-
 	am := &AuthManager{
 		keys:          make(map[string]*APIKeyInfo),
-		keyStorage:    keyStoragePath,
+		repo:          repo,
 		config:        config,
-		rateLimiter:   rateLimiter,
+		keyLimiters:   make(map[string]*RateLimiter),
 		auditLogger:   auditLogger,
 		encryptionKey: encryptionKey,
 		stopRotation:  make(chan bool),
@@ -273,6 +292,7 @@ func (am *AuthManager) GenerateAPIKey(req *KeyGenerationRequest) (*KeyGeneration
 		RateLimitTier: req.RateLimitTier,
 		Tags:          req.Tags,
 		IPWhitelist:   req.IPWhitelist,
+		AllowedDeals:  req.AllowedDeals,
 		Metadata:      req.Metadata,
 		UsageCount:    0,
 	}
@@ -296,6 +316,7 @@ func (am *AuthManager) GenerateAPIKey(req *KeyGenerationRequest) (*KeyGeneration
 				"name":        req.Name,
 				"permissions": req.Permissions,
 				"tier":        req.RateLimitTier,
+				"deals":       req.AllowedDeals,
 			},
 			Timestamp: time.Now(),
 			Severity:  "info",
@@ -367,15 +388,9 @@ func (am *AuthManager) AuthenticateRequest(req *AuthenticationRequest) (*Authent
 	}
 
 	// Check IP whitelist
-	if len(keyInfo.IPWhitelist) > 0 && req.ClientIP != "" {
-		allowed := false
-		for _, ip := range keyInfo.IPWhitelist {
-			if ip == req.ClientIP {
-				allowed = true
-				break
-			}
-		}
-		if !allowed {
+	requireWhitelist := am.config.SecurityPolicies != nil && am.config.SecurityPolicies.RequireIPWhitelist
+	if len(keyInfo.IPWhitelist) > 0 || requireWhitelist {
+		if !ipAllowed(keyInfo.IPWhitelist, req.ClientIP) {
 			result.ErrorCode = "IP_NOT_WHITELISTED"
 			result.ErrorMessage = "Client IP not in whitelist"
 			result.KeyID = keyID
@@ -384,12 +399,13 @@ func (am *AuthManager) AuthenticateRequest(req *AuthenticationRequest) (*Authent
 		}
 	}
 
-	// Check rate limiting
-	if am.rateLimiter != nil && am.config.RateLimitEnabled {
-		if !am.rateLimiter.TryAcquire() {
+	// Check the key's rate limit tier
+	if am.config.RateLimitEnabled {
+		if !am.allowKeyRequest(keyID, keyInfo.RateLimitTier) {
 			result.ErrorCode = "RATE_LIMIT_EXCEEDED"
 			result.ErrorMessage = "Rate limit exceeded"
 			result.KeyID = keyID
+			result.RateLimitTier = keyInfo.RateLimitTier
 			am.logAuthEvent("rate_limit_exceeded", keyID, req, result)
 			return result, nil
 		}
@@ -411,6 +427,7 @@ func (am *AuthManager) AuthenticateRequest(req *AuthenticationRequest) (*Authent
 	result.KeyID = keyID
 	result.Permissions = keyInfo.Permissions
 	result.RateLimitTier = keyInfo.RateLimitTier
+	result.AllowedDeals = keyInfo.AllowedDeals
 	result.ExpiresAt = keyInfo.ExpiresAt
 
 	// Update usage statistics
@@ -496,18 +513,21 @@ func (am *AuthManager) validateKeyGenerationRequest(req *KeyGenerationRequest) e
 		req.RateLimitTier = "basic"
 	}
 
-	validTiers := []string{"basic", "premium", "unlimited"}
-	tierValid := false
-	for _, tier := range validTiers {
-		if req.RateLimitTier == tier {
-			tierValid = true
-			break
-		}
+	tiers := am.config.RateLimitTiers
+	if tiers == nil {
+		tiers = defaultRateLimitTiers
 	}
-	if !tierValid {
+	if _, ok := tiers[req.RateLimitTier]; !ok {
 		return fmt.Errorf("invalid rate limit tier: %s", req.RateLimitTier)
 	}
 
+	for _, entry := range req.IPWhitelist {
+		_, _, cidrErr := net.ParseCIDR(entry)
+		if cidrErr != nil && net.ParseIP(entry) == nil {
+			return fmt.Errorf("invalid IP whitelist entry: %s", entry)
+		}
+	}
+
 	return nil
 }
 
@@ -579,23 +599,9 @@ func (am *AuthManager) logAuthEvent(eventType, keyID string, req *Authentication
 }
 
 func (am *AuthManager) loadKeys() error {
-	if _, err := os.Stat(am.keyStorage); os.IsNotExist(err) {
-		// File doesn't exist, start with empty key store
-		return nil
-	}
-
-	data, err := os.ReadFile(am.keyStorage)
+	keys, err := am.repo.LoadAPIKeys()
 	if err != nil {
-		return fmt.Errorf("failed to read key storage file: %w", err)
-	}
-
-	if len(data) == 0 {
-		return nil
-	}
-
-	var keys map[string]*APIKeyInfo
-	if err := json.Unmarshal(data, &keys); err != nil {
-		return fmt.Errorf("failed to unmarshal keys: %w", err)
+		return err
 	}
 
 	am.keys = keys
@@ -603,22 +609,7 @@ func (am *AuthManager) loadKeys() error {
 }
 
 func (am *AuthManager) saveKeys() error {
-	// Ensure directory exists
-	dir := filepath.Dir(am.keyStorage)
-	if err := os.MkdirAll(dir, 0700); err != nil {
-		return fmt.Errorf("failed to create key storage directory: %w", err)
-	}
-
-	data, err := json.MarshalIndent(am.keys, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal keys: %w", err)
-	}
-
-	if err := os.WriteFile(am.keyStorage, data, 0600); err != nil {
-		return fmt.Errorf("failed to write key storage file: %w", err)
-	}
-
-	return nil
+	return am.repo.SaveAPIKeys(am.keys)
 }
 
 func (am *AuthManager) startAutoRotation() {
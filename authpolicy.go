@@ -0,0 +1,351 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// Scopes an API key can be granted. A permission of "*" grants every scope
+// and a permission such as "read:*" grants every scope with that prefix.
+const (
+	ScopeReadJobs       = "read:jobs"
+	ScopeWriteJobs      = "write:jobs"
+	ScopeReadTemplates  = "read:templates"
+	ScopeWriteTemplates = "write:templates"
+	ScopeReadDocuments  = "read:documents"
+	ScopeWriteDocuments = "write:documents"
+	ScopeReadAnalytics  = "read:analytics"
+	ScopeAdminConfig    = "admin:config"
+	ScopeAll            = "*"
+)
+
+// Scopes lists every scope a route can require
+var Scopes = []string{
+	ScopeReadJobs,
+	ScopeWriteJobs,
+	ScopeReadTemplates,
+	ScopeWriteTemplates,
+	ScopeReadDocuments,
+	ScopeWriteDocuments,
+	ScopeReadAnalytics,
+	ScopeAdminConfig,
+}
+
+// legacyPermissionScopes maps the permissions issued before route scopes
+// existed to the scopes they grant, so existing n8n keys keep working
+var legacyPermissionScopes = map[string][]string{
+	"webhook:receive":   {ScopeWriteJobs},
+	"webhook:send":      {ScopeReadJobs},
+	"documents:process": {ScopeReadDocuments, ScopeWriteDocuments, ScopeReadTemplates, ScopeWriteTemplates},
+	"jobs:query":        {ScopeReadJobs},
+	"admin:manage":      {ScopeAll},
+}
+
+// defaultRateLimitTiers is requests per minute by tier; zero is unlimited
+var defaultRateLimitTiers = map[string]int{
+	"basic":     60,
+	"premium":   600,
+	"unlimited": 0,
+}
+
+// DealAccess describes how a route relates to deal restrictions on a key
+type DealAccess int
+
+const (
+	// DealScoped routes act on the deals a request names. Keys restricted
+	// to particular deals must name only those deals.
+	DealScoped DealAccess = iota
+	// NoDealData routes touch no deal data, so restrictions do not apply
+	NoDealData
+	// AllDeals routes read or change data spanning every deal and are
+	// closed to keys restricted to particular deals
+	AllDeals
+)
+
+// RoutePolicy is what a webhook route requires of the calling API key
+type RoutePolicy struct {
+	Scope        string
+	MethodScopes map[string]string // Overrides Scope for particular methods
+	Deals        DealAccess
+	Public       bool // Served without authentication
+}
+
+// RequiredScope returns the scope a request with method needs
+func (p RoutePolicy) RequiredScope(method string) string {
+	if scope, ok := p.MethodScopes[method]; ok {
+		return scope
+	}
+	return p.Scope
+}
+
+// HasScope reports whether permissions grant scope
+func HasScope(permissions []string, scope string) bool {
+	for _, permission := range permissions {
+		granted := []string{permission}
+		if legacy, ok := legacyPermissionScopes[permission]; ok {
+			granted = legacy
+		}
+		for _, g := range granted {
+			if g == ScopeAll || g == scope {
+				return true
+			}
+			if strings.HasSuffix(g, ":*") && strings.HasPrefix(scope, strings.TrimSuffix(g, "*")) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// AuthorizeRequest checks an authenticated key against the route policy and
+// the deals the request names. Denials are recorded in the audit log.
+func (am *AuthManager) AuthorizeRequest(auth *AuthenticationResult, req *AuthenticationRequest, policy RoutePolicy, deals []string) *AuthenticationResult {
+	result := &AuthenticationResult{Success: false, KeyID: auth.KeyID}
+
+	scope := policy.RequiredScope(req.Method)
+	if !HasScope(auth.Permissions, scope) {
+		result.ErrorCode = "INSUFFICIENT_SCOPE"
+		result.ErrorMessage = fmt.Sprintf("API key lacks the %s scope", scope)
+		am.logAccessDenied(req, result, map[string]interface{}{"requiredScope": scope})
+		return result
+	}
+
+	if len(auth.AllowedDeals) > 0 && policy.Deals != NoDealData {
+		if denied := deniedDeal(auth.AllowedDeals, policy, deals); denied != "" {
+			result.ErrorCode = "DEAL_NOT_ALLOWED"
+			result.ErrorMessage = denied
+			am.logAccessDenied(req, result, map[string]interface{}{"deals": deals, "allowedDeals": auth.AllowedDeals})
+			return result
+		}
+	}
+
+	return auth
+}
+
+// AuthorizeDeal checks a deal-restricted key against the deal a handler
+// resolved from the request, and the files it names, which must lie in that
+// deal's folder under dealsPath. Denials are recorded in the audit log.
+func (am *AuthManager) AuthorizeDeal(auth *AuthenticationResult, req *AuthenticationRequest, dealsPath, deal string, paths []string) *AuthenticationResult {
+	if len(auth.AllowedDeals) == 0 {
+		return auth
+	}
+
+	var deals []string
+	if deal != "" {
+		deals = []string{deal}
+	}
+	denied := deniedDeal(auth.AllowedDeals, RoutePolicy{Deals: DealScoped}, deals)
+	for _, path := range paths {
+		if denied != "" {
+			break
+		}
+		if path != "" && !pathInDeal(dealsPath, deal, path) {
+			denied = fmt.Sprintf("%s is outside the folder of deal %q", path, deal)
+		}
+	}
+	if denied == "" {
+		return auth
+	}
+
+	result := &AuthenticationResult{Success: false, KeyID: auth.KeyID, ErrorCode: "DEAL_NOT_ALLOWED", ErrorMessage: denied}
+	am.logAccessDenied(req, result, map[string]interface{}{"deal": deal, "paths": paths, "allowedDeals": auth.AllowedDeals})
+	return result
+}
+
+// deniedDeal explains why a deal-restricted key may not make a request, or
+// returns "" when it may
+func deniedDeal(allowed []string, policy RoutePolicy, deals []string) string {
+	if policy.Deals == AllDeals {
+		return "API key is restricted to particular deals and this endpoint spans all deals"
+	}
+	if len(deals) == 0 {
+		return "API key is restricted to particular deals; the request must name one"
+	}
+	if len(deals) > 1 {
+		return "API key is restricted to particular deals; the request must name only one"
+	}
+	for _, deal := range deals {
+		if !contains(allowed, deal) {
+			return fmt.Sprintf("API key may not access deal %q", deal)
+		}
+	}
+	return ""
+}
+
+func (am *AuthManager) logAccessDenied(req *AuthenticationRequest, result *AuthenticationResult, details map[string]interface{}) {
+	if am.auditLogger == nil {
+		return
+	}
+
+	details["method"] = req.Method
+	details["path"] = req.Path
+	details["errorCode"] = result.ErrorCode
+	details["success"] = false
+	am.auditLogger.LogEvent(&AuditEvent{
+		EventID:   am.generateEventID(),
+		EventType: "access_denied",
+		KeyID:     result.KeyID,
+		ClientIP:  req.ClientIP,
+		UserAgent: req.UserAgent,
+		RequestID: req.RequestID,
+		Details:   details,
+		Timestamp: time.Now(),
+		Severity:  "warning",
+	})
+}
+
+// allowKeyRequest takes a token from the key's tier rate limiter
+func (am *AuthManager) allowKeyRequest(keyID, tier string) bool {
+	tiers := am.config.RateLimitTiers
+	if tiers == nil {
+		tiers = defaultRateLimitTiers
+	}
+	limit, ok := tiers[tier]
+	if !ok {
+		limit = tiers["basic"]
+	}
+	if limit <= 0 {
+		return true
+	}
+
+	am.limiterMu.Lock()
+	limiter := am.keyLimiters[keyID]
+	if limiter == nil {
+		limiter = NewRateLimiter(limit)
+		am.keyLimiters[keyID] = limiter
+	}
+	am.limiterMu.Unlock()
+	return limiter.TryAcquire()
+}
+
+// retryAfterSeconds is how long a key on tier waits for its next request
+func (am *AuthManager) retryAfterSeconds(tier string) int {
+	tiers := am.config.RateLimitTiers
+	if tiers == nil {
+		tiers = defaultRateLimitTiers
+	}
+	if limit := tiers[tier]; limit > 0 {
+		return int(math.Ceil(60 / float64(limit)))
+	}
+	return 1
+}
+
+// ipAllowed reports whether clientIP matches a whitelist entry, which may be
+// a single address or a CIDR range
+func ipAllowed(whitelist []string, clientIP string) bool {
+	ip := net.ParseIP(clientIP)
+	if ip == nil {
+		return false
+	}
+	for _, entry := range whitelist {
+		if _, network, err := net.ParseCIDR(entry); err == nil {
+			if network.Contains(ip) {
+				return true
+			}
+		} else if allowed := net.ParseIP(entry); allowed != nil && allowed.Equal(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP returns the address of the peer that sent r, without the port
+func remoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// dealParams are the query and body fields that name a deal
+var dealParams = []string{"dealName", "deal_name", "dealId"}
+
+// isDealParam reports whether key names a deal. Keys match without regard
+// to case, as encoding/json matches them when handlers decode the body.
+func isDealParam(key string) bool {
+	for _, param := range dealParams {
+		if strings.EqualFold(key, param) {
+			return true
+		}
+	}
+	return false
+}
+
+// requestDeals returns the deals named in the query string or in the
+// top-level fields of a JSON body
+func requestDeals(r *http.Request, body []byte) []string {
+	var deals []string
+	add := func(deal string) {
+		if deal != "" && !contains(deals, deal) {
+			deals = append(deals, deal)
+		}
+	}
+
+	for key, values := range r.URL.Query() {
+		if isDealParam(key) {
+			for _, value := range values {
+				add(value)
+			}
+		}
+	}
+
+	// Decode key by key so that repeated keys are all seen; a map keeps
+	// only the last value, and that is the one a handler would use
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	if token, err := decoder.Token(); err != nil || token != json.Delim('{') {
+		return deals
+	}
+	for decoder.More() {
+		token, err := decoder.Token()
+		if err != nil {
+			break
+		}
+		var value json.RawMessage
+		if err := decoder.Decode(&value); err != nil {
+			break
+		}
+		var deal string
+		if key, _ := token.(string); isDealParam(key) && json.Unmarshal(value, &deal) == nil {
+			add(deal)
+		}
+	}
+	return deals
+}
+
+// pathInDeal reports whether path lies inside the folder of deal under
+// dealsPath
+func pathInDeal(dealsPath, deal, path string) bool {
+	if dealsPath == "" || deal == "" {
+		return false
+	}
+	dealPath, err := filepath.Abs(filepath.Join(dealsPath, deal))
+	if err != nil {
+		return false
+	}
+	target, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	rel, err := filepath.Rel(dealPath, target)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// authFailureStatus is the HTTP status for an authentication error code
+func authFailureStatus(code string) int {
+	switch code {
+	case "RATE_LIMIT_EXCEEDED":
+		return http.StatusTooManyRequests
+	case "IP_NOT_WHITELISTED", "INSUFFICIENT_SCOPE", "DEAL_NOT_ALLOWED":
+		return http.StatusForbidden
+	default:
+		return http.StatusUnauthorized
+	}
+}
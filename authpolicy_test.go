@@ -0,0 +1,259 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newPolicyTestApp(t *testing.T, tiers map[string]int) (*App, string) {
+	t.Helper()
+	auditDir := t.TempDir()
+	am, err := NewAuthManagerWithRepository(NewMemoryStateStore(), auditDir, &AuthConfig{
+		EnableAuditLogging: true,
+		RateLimitEnabled:   true,
+		RateLimitTiers:     tiers,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { am.Close() })
+
+	app := &App{authManager: am}
+	app.webhookHandlers = NewWebhookHandlers(app, nil)
+	return app, filepath.Join(auditDir, "auth_audit.log")
+}
+
+func generateTestKey(t *testing.T, app *App, req *KeyGenerationRequest) string {
+	t.Helper()
+	req.Name = "test"
+	result, err := app.authManager.GenerateAPIKey(req)
+	require.NoError(t, err)
+	return result.APIKey
+}
+
+func callWithKey(handler http.HandlerFunc, method, target, key, remoteAddr, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	req.Header.Set("X-API-Key", key)
+	if remoteAddr != "" {
+		req.RemoteAddr = remoteAddr
+	}
+	w := httptest.NewRecorder()
+	handler(w, req)
+	return w
+}
+
+func TestHasScope(t *testing.T) {
+	assert.True(t, HasScope([]string{ScopeReadJobs}, ScopeReadJobs))
+	assert.False(t, HasScope([]string{ScopeReadJobs}, ScopeWriteJobs))
+	assert.True(t, HasScope([]string{"read:*"}, ScopeReadAnalytics))
+	assert.False(t, HasScope([]string{"read:*"}, ScopeAdminConfig))
+	assert.True(t, HasScope([]string{ScopeAll}, ScopeAdminConfig))
+	assert.False(t, HasScope(nil, ScopeReadJobs))
+
+	// Permissions issued before scopes map onto them
+	assert.True(t, HasScope([]string{"documents:process"}, ScopeWriteTemplates))
+	assert.False(t, HasScope([]string{"webhook:receive", "webhook:send"}, ScopeAdminConfig))
+}
+
+func TestWebhookRoutes_EveryRouteHasAScope(t *testing.T) {
+	app, _ := newPolicyTestApp(t, nil)
+	seen := make(map[string]bool)
+	for _, route := range app.webhookHandlers.Routes() {
+		assert.False(t, seen[route.Path], "%s is registered twice", route.Path)
+		seen[route.Path] = true
+		if !route.Policy.Public {
+			assert.Contains(t, Scopes, route.Policy.Scope, route.Path)
+		}
+	}
+
+	scopes := app.webhookRouteScopes()
+	assert.Equal(t, ScopeAdminConfig, scopes["/api/v1/update-validation-rules"])
+	assert.Equal(t, ScopeAdminConfig, scopes["/api/v1/configure-performance-settings"])
+	assert.Equal(t, ScopeAdminConfig, scopes["POST /api/v1/ai-budgets"])
+	assert.NotContains(t, scopes, "/api/v1/health")
+
+	// Both servers register the table without conflicts
+	assert.NotPanics(t, func() { app.createAuthenticatedWebhookServer(&WebhookServerConfig{Port: 0}) })
+	assert.NotPanics(t, func() { app.webhookHandlers.CreateHTTPServer(0) })
+}
+
+func TestWebhookRoutes_DealScopedBodiesNameADeal(t *testing.T) {
+	app, _ := newPolicyTestApp(t, nil)
+	for _, route := range app.webhookHandlers.Routes() {
+		if route.Policy.Deals != DealScoped || route.Request == nil || route.Request.Type == nil || route.Request.Type.Kind() != reflect.Struct {
+			continue
+		}
+		// Keys restricted to particular deals must be able to name one
+		named := false
+		for i := 0; i < route.Request.Type.NumField(); i++ {
+			name := strings.Split(route.Request.Type.Field(i).Tag.Get("json"), ",")[0]
+			named = named || isDealParam(name) || name == "jobId"
+		}
+		assert.True(t, named, "%s is deal scoped but %s names no deal", route.Path, route.Request.Type)
+	}
+
+	// Content-only routes take the deal the content belongs to
+	key := generateTestKey(t, app, &KeyGenerationRequest{Permissions: []string{ScopeAll}, AllowedDeals: []string{"Acme"}})
+	for _, route := range app.webhookHandlers.Routes() {
+		if route.Legacy != "/webhook/entity-extraction/company-and-deal-names" {
+			continue
+		}
+		handler := app.withAuthentication(route.Policy, route.Handler)
+		assert.Equal(t, http.StatusBadRequest, callWithKey(handler, http.MethodPost, route.Path, key, "", `{"dealName":"Acme"}`).Code, "content is still required")
+		assert.Equal(t, http.StatusForbidden, callWithKey(handler, http.MethodPost, route.Path, key, "", `{"dealName":"Beta","content":"x"}`).Code)
+		assert.Equal(t, http.StatusForbidden, callWithKey(handler, http.MethodPost, route.Path, key, "", `{"content":"x"}`).Code)
+	}
+}
+
+func TestWithAuthentication_EnforcesScopes(t *testing.T) {
+	app, auditPath := newPolicyTestApp(t, nil)
+	key := generateTestKey(t, app, &KeyGenerationRequest{Permissions: []string{ScopeReadAnalytics}})
+
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	budgets := app.withAuthentication(RoutePolicy{
+		Scope:        ScopeReadAnalytics,
+		MethodScopes: map[string]string{http.MethodPost: ScopeAdminConfig},
+	}, ok)
+
+	assert.Equal(t, http.StatusOK, callWithKey(budgets, http.MethodGet, "/webhook/ai-budgets", key, "", "").Code)
+	w := callWithKey(budgets, http.MethodPost, "/webhook/ai-budgets", key, "", `{"dealName":"Acme"}`)
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), ScopeAdminConfig)
+	assert.Equal(t, http.StatusUnauthorized, callWithKey(budgets, http.MethodGet, "/webhook/ai-budgets", "wrong", "", "").Code)
+
+	audit, err := os.ReadFile(auditPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(audit), `"eventType":"access_denied"`)
+	assert.Contains(t, string(audit), `"errorCode":"INSUFFICIENT_SCOPE"`)
+}
+
+func TestWithAuthentication_DealRestrictions(t *testing.T) {
+	app, auditPath := newPolicyTestApp(t, nil)
+	key := generateTestKey(t, app, &KeyGenerationRequest{Permissions: []string{ScopeAll}, AllowedDeals: []string{"Acme"}})
+
+	var handled string
+	record := func(w http.ResponseWriter, r *http.Request) {
+		// The handler still sees the body the middleware read
+		body, err := io.ReadAll(r.Body)
+		require.NoError(t, err)
+		handled = string(body)
+	}
+	dealRoute := app.withAuthentication(RoutePolicy{Scope: ScopeWriteTemplates}, record)
+
+	assert.Equal(t, http.StatusOK, callWithKey(dealRoute, http.MethodPost, "/populate-template", key, "", `{"dealName":"Acme"}`).Code)
+	assert.Equal(t, `{"dealName":"Acme"}`, handled)
+	assert.Equal(t, http.StatusForbidden, callWithKey(dealRoute, http.MethodPost, "/populate-template", key, "", `{"dealName":"Beta"}`).Code)
+	assert.Equal(t, http.StatusForbidden, callWithKey(dealRoute, http.MethodPost, "/populate-template?dealName=Beta", key, "", `{"dealName":"Acme"}`).Code)
+	assert.Equal(t, http.StatusForbidden, callWithKey(dealRoute, http.MethodPost, "/populate-template", key, "", `{}`).Code, "a deal must be named")
+
+	allDeals := app.withAuthentication(RoutePolicy{Scope: ScopeReadAnalytics, Deals: AllDeals}, record)
+	assert.Equal(t, http.StatusForbidden, callWithKey(allDeals, http.MethodGet, "/webhook/ai-usage?dealName=Acme", key, "", "").Code)
+
+	noDeals := app.withAuthentication(RoutePolicy{Scope: ScopeReadTemplates, Deals: NoDealData}, record)
+	assert.Equal(t, http.StatusOK, callWithKey(noDeals, http.MethodPost, "/webhook/format-date", key, "", `{}`).Code)
+
+	audit, err := os.ReadFile(auditPath)
+	require.NoError(t, err)
+	assert.Equal(t, 4, strings.Count(string(audit), `"errorCode":"DEAL_NOT_ALLOWED"`))
+}
+
+func TestWithAuthentication_DealKeysInAnyCase(t *testing.T) {
+	app, _ := newPolicyTestApp(t, nil)
+	key := generateTestKey(t, app, &KeyGenerationRequest{Permissions: []string{ScopeAll}, AllowedDeals: []string{"Acme"}})
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	dealRoute := app.withAuthentication(RoutePolicy{Scope: ScopeWriteTemplates}, ok)
+
+	// Handlers decode keys without regard to case, and the last one wins
+	for _, body := range []string{
+		`{"dealName":"Acme","DEALNAME":"Beta"}`,
+		`{"DealName":"Beta"}`,
+		`{"dealName":"Acme","dealName":"Beta"}`,
+		`{"dealName":"Acme","deal_name":"Beta"}`,
+	} {
+		assert.Equal(t, http.StatusForbidden, callWithKey(dealRoute, http.MethodPost, "/populate-template", key, "", body).Code, body)
+	}
+	assert.Equal(t, http.StatusForbidden, callWithKey(dealRoute, http.MethodGet, "/search?DEALNAME=Beta&dealName=Acme", key, "", "").Code)
+	assert.Equal(t, http.StatusOK, callWithKey(dealRoute, http.MethodPost, "/populate-template", key, "", `{"DEALNAME":"Acme","dealName":"Acme"}`).Code)
+}
+
+func TestWebhookHandlers_AuthorizeResolvedDeal(t *testing.T) {
+	app, auditPath := newPolicyTestApp(t, nil)
+	app.configService = &ConfigService{config: &Config{DealDoneRoot: t.TempDir()}}
+	app.jobTracker = NewJobTrackerWithRepository(nil)
+	app.jobTracker.CreateJob("job-beta", "Beta", TriggerFileChange, nil)
+	key := generateTestKey(t, app, &KeyGenerationRequest{Permissions: []string{ScopeAll}, AllowedDeals: []string{"Acme"}})
+	wh := app.webhookHandlers
+
+	// Naming an allowed deal does not open another deal's job
+	status := app.withAuthentication(RoutePolicy{Scope: ScopeReadJobs}, wh.HandleStatusQuery)
+	w := callWithKey(status, http.MethodGet, "/webhook/status?jobId=job-beta&dealName=Acme", key, "", "")
+	assert.Equal(t, http.StatusForbidden, w.Code)
+	assert.Contains(t, w.Body.String(), `"Beta"`)
+	w = callWithKey(status, http.MethodGet, "/webhook/status?jobId=unknown&dealName=Acme", key, "", "")
+	assert.Equal(t, http.StatusForbidden, w.Code, "jobs that cannot be traced to a deal are closed to restricted keys")
+
+	results := app.withAuthentication(RoutePolicy{Scope: ScopeWriteJobs}, wh.HandleProcessingResults)
+	assert.Equal(t, http.StatusForbidden, callWithKey(results, http.MethodPost, "/webhook/results", key, "", `{"jobId":"job-beta","dealName":"Acme"}`).Code)
+
+	// Files a request names must lie in the deal's folder
+	dealsPath := app.configService.GetDealsPath()
+	discover := app.withAuthentication(RoutePolicy{Scope: ScopeReadTemplates}, wh.HandleDiscoverTemplates)
+	for _, path := range []string{
+		filepath.Join(dealsPath, "Beta", "cim.pdf"),
+		filepath.Join(dealsPath, "Acme", "..", "Beta", "cim.pdf"),
+		filepath.Join(dealsPath, "Acme Holdings", "cim.pdf"),
+	} {
+		body := fmt.Sprintf(`{"dealName":"Acme","documentPath":%q}`, path)
+		assert.Equal(t, http.StatusForbidden, callWithKey(discover, http.MethodPost, "/discover-templates", key, "", body).Code, path)
+	}
+	assert.True(t, pathInDeal(dealsPath, "Acme", filepath.Join(dealsPath, "Acme", "data", "cim.pdf")))
+	assert.False(t, pathInDeal(dealsPath, "", filepath.Join(dealsPath, "cim.pdf")))
+
+	audit, err := os.ReadFile(auditPath)
+	require.NoError(t, err)
+	assert.Equal(t, 6, strings.Count(string(audit), `"errorCode":"DEAL_NOT_ALLOWED"`))
+}
+
+func TestWithAuthentication_IPWhitelist(t *testing.T) {
+	app, _ := newPolicyTestApp(t, nil)
+	key := generateTestKey(t, app, &KeyGenerationRequest{Permissions: []string{ScopeReadJobs}, IPWhitelist: []string{"10.0.0.0/24", "192.168.1.7"}})
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	status := app.withAuthentication(RoutePolicy{Scope: ScopeReadJobs, Deals: NoDealData}, ok)
+
+	assert.Equal(t, http.StatusOK, callWithKey(status, http.MethodGet, "/webhook/status", key, "10.0.0.5:41000", "").Code)
+	assert.Equal(t, http.StatusOK, callWithKey(status, http.MethodGet, "/webhook/status", key, "192.168.1.7:41000", "").Code)
+	assert.Equal(t, http.StatusForbidden, callWithKey(status, http.MethodGet, "/webhook/status", key, "10.0.1.5:41000", "").Code)
+
+	_, err := app.authManager.GenerateAPIKey(&KeyGenerationRequest{Name: "bad", IPWhitelist: []string{"not-an-ip"}})
+	assert.Error(t, err)
+}
+
+func TestWithAuthentication_RateLimitsPerKeyTier(t *testing.T) {
+	app, _ := newPolicyTestApp(t, map[string]int{"basic": 2, "premium": 5, "unlimited": 0})
+	basic := generateTestKey(t, app, &KeyGenerationRequest{Permissions: []string{ScopeReadJobs}, RateLimitTier: "basic"})
+	other := generateTestKey(t, app, &KeyGenerationRequest{Permissions: []string{ScopeReadJobs}, RateLimitTier: "basic"})
+	unlimited := generateTestKey(t, app, &KeyGenerationRequest{Permissions: []string{ScopeReadJobs}, RateLimitTier: "unlimited"})
+	ok := func(w http.ResponseWriter, r *http.Request) { w.WriteHeader(http.StatusOK) }
+	status := app.withAuthentication(RoutePolicy{Scope: ScopeReadJobs, Deals: NoDealData}, ok)
+
+	for i := 0; i < 2; i++ {
+		assert.Equal(t, http.StatusOK, callWithKey(status, http.MethodGet, "/webhook/status", basic, "", "").Code)
+	}
+	w := callWithKey(status, http.MethodGet, "/webhook/status", basic, "", "")
+	assert.Equal(t, http.StatusTooManyRequests, w.Code)
+	assert.Equal(t, "30", w.Header().Get("Retry-After"))
+
+	// Each key has its own bucket
+	assert.Equal(t, http.StatusOK, callWithKey(status, http.MethodGet, "/webhook/status", other, "", "").Code)
+	for i := 0; i < 10; i++ {
+		assert.Equal(t, http.StatusOK, callWithKey(status, http.MethodGet, "/webhook/status", unlimited, "", "").Code)
+	}
+}
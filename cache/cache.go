@@ -0,0 +1,153 @@
+// Package cache stores AI responses under content-addressed keys so the same
+// document is not sent to a provider twice, including across restarts.
+package cache
+
+import (
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// Store holds encoded AI responses. Implementations are safe for concurrent
+// use and evict the least recently used entries to stay within their bounds.
+type Store interface {
+	Get(key string) ([]byte, bool)
+	Set(key string, value []byte, ttl time.Duration) error // ttl <= 0 never expires
+	Delete(key string)
+	Clear() error
+	Stats() Stats
+}
+
+// Stats describes the contents and effectiveness of a store
+type Stats struct {
+	Backend    string  `json:"backend"`
+	Entries    int     `json:"entries"`
+	SizeBytes  int64   `json:"sizeBytes"`
+	MaxEntries int     `json:"maxEntries"` // 0 means unbounded
+	MaxBytes   int64   `json:"maxBytes"`   // 0 means unbounded
+	Hits       int64   `json:"hits"`
+	Misses     int64   `json:"misses"`
+	Evictions  int64   `json:"evictions"`
+	HitRate    float64 `json:"hitRate"`
+}
+
+// KeyParts identifies a cached response. A response is only reused for the
+// same operation on the same content with the same provider, model and
+// prompts.
+type KeyParts struct {
+	Operation     string
+	Provider      string
+	Model         string
+	PromptVersion string
+	Content       string
+	Params        map[string]interface{}
+}
+
+// Key returns the SHA-256 key for a response
+func Key(parts KeyParts) string {
+	contentHash := sha256.Sum256([]byte(parts.Content))
+
+	h := sha256.New()
+	for _, field := range []string{parts.Operation, parts.Provider, parts.Model, parts.PromptVersion, hex.EncodeToString(contentHash[:])} {
+		h.Write([]byte(field))
+		h.Write([]byte{0})
+	}
+	if len(parts.Params) > 0 {
+		params, _ := json.Marshal(parts.Params) // Map keys are sorted
+		h.Write(params)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// lruIndex tracks entry sizes in recency order for eviction
+type lruIndex struct {
+	order   *list.List // Most recently used at the front
+	entries map[string]*list.Element
+	size    int64
+}
+
+type lruEntry struct {
+	key       string
+	size      int64
+	expiresAt time.Time // Zero when unknown or never
+}
+
+func newLRUIndex() *lruIndex {
+	return &lruIndex{order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+func (idx *lruIndex) get(key string) (*lruEntry, bool) {
+	element, ok := idx.entries[key]
+	if !ok {
+		return nil, false
+	}
+	return element.Value.(*lruEntry), true
+}
+
+// put adds or replaces an entry as the most recently used
+func (idx *lruIndex) put(entry *lruEntry) {
+	idx.remove(entry.key)
+	idx.entries[entry.key] = idx.order.PushFront(entry)
+	idx.size += entry.size
+}
+
+// touch marks an entry as the most recently used
+func (idx *lruIndex) touch(key string) {
+	if element, ok := idx.entries[key]; ok {
+		idx.order.MoveToFront(element)
+	}
+}
+
+func (idx *lruIndex) remove(key string) {
+	element, ok := idx.entries[key]
+	if !ok {
+		return
+	}
+	idx.size -= element.Value.(*lruEntry).size
+	idx.order.Remove(element)
+	delete(idx.entries, key)
+}
+
+// oldest returns the least recently used entry
+func (idx *lruIndex) oldest() (*lruEntry, bool) {
+	element := idx.order.Back()
+	if element == nil {
+		return nil, false
+	}
+	return element.Value.(*lruEntry), true
+}
+
+// overLimit reports whether the index exceeds either bound
+func (idx *lruIndex) overLimit(maxEntries int, maxBytes int64) bool {
+	return (maxEntries > 0 && len(idx.entries) > maxEntries) || (maxBytes > 0 && idx.size > maxBytes)
+}
+
+func (idx *lruIndex) stats(backend string, maxEntries int, maxBytes int64, hits, misses, evictions int64) Stats {
+	stats := Stats{
+		Backend:    backend,
+		Entries:    len(idx.entries),
+		SizeBytes:  idx.size,
+		MaxEntries: maxEntries,
+		MaxBytes:   maxBytes,
+		Hits:       hits,
+		Misses:     misses,
+		Evictions:  evictions,
+	}
+	if hits+misses > 0 {
+		stats.HitRate = float64(hits) / float64(hits+misses)
+	}
+	return stats
+}
+
+func expiry(ttl time.Duration) time.Time {
+	if ttl <= 0 {
+		return time.Time{}
+	}
+	return time.Now().Add(ttl)
+}
+
+func expired(expiresAt time.Time) bool {
+	return !expiresAt.IsZero() && time.Now().After(expiresAt)
+}
@@ -0,0 +1,164 @@
+package cache
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKey(t *testing.T) {
+	base := KeyParts{Operation: "classify", Provider: "openai", Model: "gpt-4", PromptVersion: "v1", Content: "NDA text"}
+	key := Key(base)
+	assert.Len(t, key, 64)
+	assert.Equal(t, key, Key(base))
+
+	for name, change := range map[string]func(p *KeyParts){
+		"operation": func(p *KeyParts) { p.Operation = "extract" },
+		"provider":  func(p *KeyParts) { p.Provider = "claude" },
+		"model":     func(p *KeyParts) { p.Model = "gpt-4o" },
+		"prompts":   func(p *KeyParts) { p.PromptVersion = "v2" },
+		"content":   func(p *KeyParts) { p.Content = "Other text" },
+		"params":    func(p *KeyParts) { p.Params = map[string]interface{}{"dealName": "Acme"} },
+	} {
+		parts := base
+		change(&parts)
+		assert.NotEqual(t, key, Key(parts), name)
+	}
+
+	// Field boundaries are unambiguous
+	assert.NotEqual(t,
+		Key(KeyParts{Operation: "ab", Provider: "c"}),
+		Key(KeyParts{Operation: "a", Provider: "bc"}))
+}
+
+func testStore(t *testing.T, store Store) {
+	t.Helper()
+
+	_, ok := store.Get("missing")
+	assert.False(t, ok)
+
+	require.NoError(t, store.Set("a", []byte("alpha"), 0))
+	value, ok := store.Get("a")
+	require.True(t, ok)
+	assert.Equal(t, "alpha", string(value))
+
+	require.NoError(t, store.Set("a", []byte("updated"), 0))
+	value, _ = store.Get("a")
+	assert.Equal(t, "updated", string(value))
+
+	require.NoError(t, store.Set("expired", []byte("x"), time.Nanosecond))
+	time.Sleep(time.Millisecond)
+	_, ok = store.Get("expired")
+	assert.False(t, ok)
+
+	store.Delete("a")
+	_, ok = store.Get("a")
+	assert.False(t, ok)
+
+	require.NoError(t, store.Set("b", []byte("beta"), time.Hour))
+	require.NoError(t, store.Clear())
+	_, ok = store.Get("b")
+	assert.False(t, ok)
+	assert.Equal(t, 0, store.Stats().Entries)
+
+	stats := store.Stats()
+	assert.Equal(t, int64(2), stats.Hits)
+	assert.Greater(t, stats.Misses, int64(0))
+	assert.InDelta(t, float64(stats.Hits)/float64(stats.Hits+stats.Misses), stats.HitRate, 0.0001)
+}
+
+func testEviction(t *testing.T, store Store) {
+	t.Helper()
+
+	for _, key := range []string{"a", "b", "c"} {
+		require.NoError(t, store.Set(key, []byte(key), 0))
+	}
+	store.Get("a") // b is now the least recently used
+	require.NoError(t, store.Set("d", []byte("d"), 0))
+
+	_, ok := store.Get("b")
+	assert.False(t, ok)
+	for _, key := range []string{"a", "c", "d"} {
+		_, ok := store.Get(key)
+		assert.True(t, ok, key)
+	}
+	assert.Equal(t, 3, store.Stats().Entries)
+	assert.Equal(t, int64(1), store.Stats().Evictions)
+}
+
+func TestMemoryStore(t *testing.T) {
+	testStore(t, NewMemoryStore(0, 0))
+	testEviction(t, NewMemoryStore(3, 0))
+
+	store := NewMemoryStore(0, 10)
+	require.NoError(t, store.Set("a", []byte("123456"), 0))
+	require.NoError(t, store.Set("b", []byte("123456"), 0))
+	_, ok := store.Get("a")
+	assert.False(t, ok)
+	assert.Equal(t, int64(6), store.Stats().SizeBytes)
+}
+
+func TestDiskStore(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir(), 0, 0)
+	require.NoError(t, err)
+	testStore(t, store)
+
+	store, err = NewDiskStore(t.TempDir(), 0, 3)
+	require.NoError(t, err)
+	testEviction(t, store)
+}
+
+func TestDiskStore_Persistence(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewDiskStore(dir, 0, 0)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, store.Set(fmt.Sprintf("key-%d", i), []byte(fmt.Sprintf("value-%d", i)), 0))
+	}
+	// Make key-0 the oldest file regardless of timestamp resolution
+	old := time.Now().Add(-time.Hour)
+	require.NoError(t, os.Chtimes(store.path(fileName("key-0")), old, old))
+
+	// A leftover temp file from an interrupted write is cleaned up
+	tmp := filepath.Join(dir, "ab", "partial.tmp")
+	require.NoError(t, os.MkdirAll(filepath.Dir(tmp), 0755))
+	require.NoError(t, os.WriteFile(tmp, []byte("x"), 0644))
+
+	reopened, err := NewDiskStore(dir, 0, 0)
+	require.NoError(t, err)
+	assert.Equal(t, 3, reopened.Stats().Entries)
+	assert.Equal(t, store.Stats().SizeBytes, reopened.Stats().SizeBytes)
+	assert.NoFileExists(t, tmp)
+
+	value, ok := reopened.Get("key-1")
+	require.True(t, ok)
+	assert.Equal(t, "value-1", string(value))
+
+	// Reopening with a smaller bound evicts the least recently used file
+	bounded, err := NewDiskStore(dir, 0, 2)
+	require.NoError(t, err)
+	_, ok = bounded.Get("key-0")
+	assert.False(t, ok)
+	_, ok = bounded.Get("key-2")
+	assert.True(t, ok)
+}
+
+func TestDiskStore_CorruptEntry(t *testing.T) {
+	store, err := NewDiskStore(t.TempDir(), 0, 0)
+	require.NoError(t, err)
+	require.NoError(t, store.Set("key", []byte("value"), 0))
+
+	path := store.path(fileName("key"))
+	require.NoError(t, os.WriteFile(path, []byte("{not json"), 0644))
+
+	_, ok := store.Get("key")
+	assert.False(t, ok)
+	assert.NoFileExists(t, path)
+	assert.Equal(t, 0, store.Stats().Entries)
+}
@@ -0,0 +1,204 @@
+package cache
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DiskStore keeps one file per response under a directory so responses
+// survive restarts. Recency is tracked through file modification times.
+type DiskStore struct {
+	mu         sync.Mutex
+	dir        string
+	index      *lruIndex
+	maxEntries int
+	maxBytes   int64
+	hits       int64
+	misses     int64
+	evictions  int64
+}
+
+// diskRecord is the file format of a cached response
+type diskRecord struct {
+	Key       string    `json:"key"`
+	ExpiresAt time.Time `json:"expiresAt,omitempty"`
+	Value     []byte    `json:"value"`
+}
+
+// NewDiskStore opens or creates a store in dir bounded by total size and
+// entry count; a zero bound is unlimited
+func NewDiskStore(dir string, maxBytes int64, maxEntries int) (*DiskStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create cache directory: %w", err)
+	}
+
+	s := &DiskStore{
+		dir:        dir,
+		index:      newLRUIndex(),
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+	}
+	if err := s.loadIndex(); err != nil {
+		return nil, err
+	}
+	s.evict()
+	return s, nil
+}
+
+// loadIndex rebuilds the index from the files on disk, oldest first so the
+// most recently used files end up at the front
+func (s *DiskStore) loadIndex() error {
+	type found struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}
+	var files []found
+
+	err := filepath.WalkDir(s.dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		if strings.HasSuffix(d.Name(), ".tmp") {
+			os.Remove(path) // Left behind by an interrupted write
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || len(d.Name()) != sha256.Size*2 {
+			return nil
+		}
+		files = append(files, found{name: d.Name(), size: info.Size(), modTime: info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read cache directory: %w", err)
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.Before(files[j].modTime) })
+	for _, f := range files {
+		s.index.put(&lruEntry{key: f.name, size: f.size})
+	}
+	return nil
+}
+
+// fileName is the index key and file name for a cache key
+func fileName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+func (s *DiskStore) path(name string) string {
+	return filepath.Join(s.dir, name[:2], name)
+}
+
+func (s *DiskStore) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := fileName(key)
+	if _, ok := s.index.get(name); !ok {
+		s.misses++
+		return nil, false
+	}
+
+	path := s.path(name)
+	data, err := os.ReadFile(path)
+	var record diskRecord
+	if err == nil {
+		err = json.Unmarshal(data, &record)
+	}
+	if err != nil || record.Key != key || expired(record.ExpiresAt) {
+		s.removeFile(name)
+		s.misses++
+		return nil, false
+	}
+
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	s.index.touch(name)
+	s.hits++
+	return record.Value, true
+}
+
+func (s *DiskStore) Set(key string, value []byte, ttl time.Duration) error {
+	data, err := json.Marshal(diskRecord{Key: key, ExpiresAt: expiry(ttl), Value: value})
+	if err != nil {
+		return fmt.Errorf("failed to encode cache entry: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	name := fileName(key)
+	path := s.path(name)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write cache entry: %w", err)
+	}
+
+	s.index.put(&lruEntry{key: name, size: int64(len(data))})
+	s.evict()
+	return nil
+}
+
+func (s *DiskStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.removeFile(fileName(key))
+}
+
+func (s *DiskStore) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := os.RemoveAll(s.dir); err != nil {
+		return fmt.Errorf("failed to clear cache: %w", err)
+	}
+	s.index = newLRUIndex()
+	if err := os.MkdirAll(s.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create cache directory: %w", err)
+	}
+	return nil
+}
+
+func (s *DiskStore) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.index.stats("disk", s.maxEntries, s.maxBytes, s.hits, s.misses, s.evictions)
+}
+
+// evict removes least recently used files until the store is within bounds
+func (s *DiskStore) evict() {
+	for s.index.overLimit(s.maxEntries, s.maxBytes) {
+		oldest, _ := s.index.oldest()
+		s.removeFile(oldest.key)
+		s.evictions++
+	}
+}
+
+func (s *DiskStore) removeFile(name string) {
+	os.Remove(s.path(name))
+	s.index.remove(name)
+}
@@ -0,0 +1,88 @@
+package cache
+
+import (
+	"sync"
+	"time"
+)
+
+// MemoryStore keeps responses in memory for the life of the process
+type MemoryStore struct {
+	mu         sync.Mutex
+	values     map[string][]byte
+	index      *lruIndex
+	maxEntries int
+	maxBytes   int64
+	hits       int64
+	misses     int64
+	evictions  int64
+}
+
+// NewMemoryStore creates a store bounded by entry count and total size;
+// a zero bound is unlimited
+func NewMemoryStore(maxEntries int, maxBytes int64) *MemoryStore {
+	return &MemoryStore{
+		values:     make(map[string][]byte),
+		index:      newLRUIndex(),
+		maxEntries: maxEntries,
+		maxBytes:   maxBytes,
+	}
+}
+
+func (s *MemoryStore) Get(key string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entry, ok := s.index.get(key)
+	if !ok || expired(entry.expiresAt) {
+		if ok {
+			s.index.remove(key)
+			delete(s.values, key)
+		}
+		s.misses++
+		return nil, false
+	}
+
+	s.index.touch(key)
+	s.hits++
+	return s.values[key], true
+}
+
+func (s *MemoryStore) Set(key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values[key] = value
+	s.index.put(&lruEntry{key: key, size: int64(len(value)), expiresAt: expiry(ttl)})
+
+	for s.index.overLimit(s.maxEntries, s.maxBytes) {
+		oldest, _ := s.index.oldest()
+		s.index.remove(oldest.key)
+		delete(s.values, oldest.key)
+		s.evictions++
+	}
+	return nil
+}
+
+func (s *MemoryStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.index.remove(key)
+	delete(s.values, key)
+}
+
+func (s *MemoryStore) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values = make(map[string][]byte)
+	s.index = newLRUIndex()
+	return nil
+}
+
+func (s *MemoryStore) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.index.stats("memory", s.maxEntries, s.maxBytes, s.hits, s.misses, s.evictions)
+}
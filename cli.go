@@ -0,0 +1,693 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"time"
+)
+
+// cliCommand is a headless subcommand. Commands run against the same
+// services the desktop app builds, without opening a window.
+type cliCommand struct {
+	name    string // One or two words, e.g. "route" or "deal create"
+	usage   string
+	summary string
+	run     func(c *cliContext, args []string) error
+}
+
+// cliContext carries the options shared by every command
+type cliContext struct {
+	app    *App
+	out    io.Writer
+	root   string
+	format string
+}
+
+// cliUsageError reports a command used incorrectly
+type cliUsageError struct {
+	message string
+}
+
+func (e *cliUsageError) Error() string {
+	return e.message
+}
+
+func usageErrorf(format string, args ...interface{}) error {
+	return &cliUsageError{message: fmt.Sprintf(format, args...)}
+}
+
+var cliCommands = []cliCommand{
+	{"init", "init [path]", "Create the DealDone folder structure and save it as the root", runCLIInit},
+	{"deal create", "deal create <name>...", "Create deal folders", runCLIDealCreate},
+	{"deal ls", "deal ls", "List deals", runCLIDealList},
+	{"route", "route <folder|file>... --deal <name>", "Route documents into a deal's folders", runCLIRoute},
+	{"extract", "extract [file]... [--deal <name>] [--tables]", "Extract financial data from documents", runCLIExtract},
+	{"populate", "populate --template <template> --deal <name> [document]...", "Populate a template from a deal's documents", runCLIPopulate},
+	{"valuation", "valuation --deal <name> [--revenue n --ebitda n --net-income n]", "Value a deal", runCLIValuation},
+	{"jobs ls", "jobs ls [--deal <name>] [--status <status>]", "List workflow jobs", runCLIJobsList},
+	{"queue ls", "queue ls [--deal <name>] [--status <status>]", "List queued documents", runCLIQueueList},
+	{"serve", "serve [--port 8080]", "Run the webhook server, queue workers and folder watcher", runCLIServe},
+}
+
+// isCLICommand reports whether the first program argument selects a CLI
+// command rather than the desktop app
+func isCLICommand(arg string) bool {
+	switch arg {
+	case "help", "-h", "-help", "--help":
+		return true
+	}
+	for _, cmd := range cliCommands {
+		if strings.Fields(cmd.name)[0] == arg {
+			return true
+		}
+	}
+	return false
+}
+
+// runCLI runs a command and returns the process exit code. Results go to
+// stdout as a table or JSON; errors go to stderr.
+func runCLI(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] == "help" || args[0] == "-h" || args[0] == "-help" || args[0] == "--help" {
+		printCLIUsage(stdout)
+		return 0
+	}
+
+	cmd, rest := findCLICommand(args)
+	if cmd == nil {
+		fmt.Fprintf(stderr, "Error: unknown command %q\n\n", strings.Join(args[:min(2, len(args))], " "))
+		printCLIUsage(stderr)
+		return 2
+	}
+
+	c := &cliContext{out: stdout, root: os.Getenv("DEALDONE_ROOT"), format: "table"}
+	err := cmd.run(c, rest)
+
+	var usageErr *cliUsageError
+	switch {
+	case err == nil, errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.As(err, &usageErr):
+		fmt.Fprintf(stderr, "Error: %v\nUsage: dealdone %s\n", err, cmd.usage)
+		return 2
+	default:
+		fmt.Fprintf(stderr, "Error: %v\n", err)
+		return 1
+	}
+}
+
+// findCLICommand matches the longest command name at the start of args
+func findCLICommand(args []string) (*cliCommand, []string) {
+	for _, words := range []int{2, 1} {
+		if len(args) < words {
+			continue
+		}
+		name := strings.Join(args[:words], " ")
+		for i := range cliCommands {
+			if cliCommands[i].name == name {
+				return &cliCommands[i], args[words:]
+			}
+		}
+	}
+	return nil, nil
+}
+
+func printCLIUsage(w io.Writer) {
+	fmt.Fprintln(w, "Usage: dealdone <command> [flags]")
+	fmt.Fprintln(w, "Run without a command to open the desktop app.")
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Commands:")
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for _, cmd := range cliCommands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.usage, cmd.summary)
+	}
+	tw.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "Global flags:")
+	fmt.Fprintln(w, "  --root <path>    DealDone root folder for this run (default: saved config or $DEALDONE_ROOT)")
+	fmt.Fprintln(w, "  -o, --output     Output format: table or json (default table)")
+}
+
+// parse adds the global flags to fs and parses args, allowing flags before
+// and after positional arguments
+func (c *cliContext) parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	fs.SetOutput(io.Discard)
+	fs.StringVar(&c.root, "root", c.root, "DealDone root folder")
+	fs.StringVar(&c.format, "output", c.format, "output format")
+	fs.StringVar(&c.format, "o", c.format, "output format")
+
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, usageErrorf("%v", err)
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+
+	if c.format != "table" && c.format != "json" {
+		return nil, usageErrorf("unknown output format %q", c.format)
+	}
+	return positional, nil
+}
+
+// start builds the application services. requireReady fails when the root
+// folder has not been initialized.
+func (c *cliContext) start(requireReady bool) error {
+	if c.root != "" {
+		root, err := filepath.Abs(c.root)
+		if err != nil {
+			return fmt.Errorf("invalid root folder: %w", err)
+		}
+		c.root = root
+	}
+
+	c.app = NewApp()
+	c.app.rootOverride = c.root
+	c.app.initServices(context.Background())
+
+	if requireReady && !c.app.folderManager.IsDealDoneReady() {
+		return fmt.Errorf("DealDone is not initialized at %s; run \"dealdone init\" first", c.app.GetDealDoneRoot())
+	}
+	return nil
+}
+
+// requireDeal checks that a deal was named and exists
+func (c *cliContext) requireDeal(dealName string) error {
+	if dealName == "" {
+		return usageErrorf("--deal is required")
+	}
+	if !c.app.DealExists(dealName) {
+		return fmt.Errorf("deal not found: %s", dealName)
+	}
+	return nil
+}
+
+// print writes value as JSON, or calls table to write it as aligned columns
+func (c *cliContext) print(value interface{}, table func(w io.Writer)) error {
+	if c.format == "json" {
+		encoder := json.NewEncoder(c.out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	}
+
+	tw := tabwriter.NewWriter(c.out, 0, 4, 2, ' ', 0)
+	table(tw)
+	return tw.Flush()
+}
+
+func runCLIInit(c *cliContext, args []string) error {
+	positional, err := c.parse(flag.NewFlagSet("init", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	if len(positional) > 1 {
+		return usageErrorf("expected at most one path")
+	}
+	if len(positional) == 1 {
+		c.root = positional[0]
+	}
+	if err := c.start(false); err != nil {
+		return err
+	}
+
+	root := c.app.GetDealDoneRoot()
+	if err := c.app.SetDealDoneRoot(root); err != nil {
+		return err
+	}
+
+	result := map[string]string{
+		"root":          root,
+		"dealsPath":     c.app.GetConfiguredDealsPath(),
+		"templatesPath": c.app.GetConfiguredTemplatesPath(),
+	}
+	return c.print(result, func(w io.Writer) {
+		fmt.Fprintf(w, "Initialized DealDone at %s\n", root)
+	})
+}
+
+func runCLIDealCreate(c *cliContext, args []string) error {
+	names, err := c.parse(flag.NewFlagSet("deal create", flag.ContinueOnError), args)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		return usageErrorf("expected a deal name")
+	}
+	if err := c.start(true); err != nil {
+		return err
+	}
+
+	deals := make([]DealInfo, 0, len(names))
+	for _, name := range names {
+		if strings.ContainsAny(name, `/\`) || name == "." || name == ".." {
+			return fmt.Errorf("invalid deal name: %q", name)
+		}
+		path, err := c.app.folderManager.CreateDealFolder(name)
+		if err != nil {
+			return err
+		}
+		deals = append(deals, DealInfo{Name: name, Path: path, CreatedAt: time.Now()})
+	}
+
+	return c.print(deals, func(w io.Writer) {
+		fmt.Fprintln(w, "DEAL\tPATH")
+		for _, deal := range deals {
+			fmt.Fprintf(w, "%s\t%s\n", deal.Name, deal.Path)
+		}
+	})
+}
+
+func runCLIDealList(c *cliContext, args []string) error {
+	if _, err := c.parse(flag.NewFlagSet("deal ls", flag.ContinueOnError), args); err != nil {
+		return err
+	}
+	if err := c.start(true); err != nil {
+		return err
+	}
+
+	deals, err := c.app.GetDealsList()
+	if err != nil {
+		return err
+	}
+	sort.Slice(deals, func(i, j int) bool { return deals[i].Name < deals[j].Name })
+
+	return c.print(deals, func(w io.Writer) {
+		fmt.Fprintln(w, "DEAL\tDOCUMENTS\tPATH")
+		for _, deal := range deals {
+			fmt.Fprintf(w, "%s\t%d\t%s\n", deal.Name, deal.DocumentCount, deal.Path)
+		}
+	})
+}
+
+func runCLIRoute(c *cliContext, args []string) error {
+	fs := flag.NewFlagSet("route", flag.ContinueOnError)
+	dealName := fs.String("deal", "", "deal to route into")
+	paths, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(paths) == 0 {
+		return usageErrorf("expected a folder or file to route")
+	}
+	if err := c.start(true); err != nil {
+		return err
+	}
+	if err := c.requireDeal(*dealName); err != nil {
+		return err
+	}
+
+	results := make([]*RoutingResult, 0)
+	for _, path := range paths {
+		var routed []*RoutingResult
+		if isDirectory(path) {
+			routed, err = c.app.documentRouter.RouteFolder(path, *dealName)
+		} else {
+			var result *RoutingResult
+			result, err = c.app.documentRouter.RouteDocument(path, *dealName)
+			if result != nil {
+				routed = []*RoutingResult{result}
+			}
+		}
+		if err != nil && len(routed) == 0 {
+			return fmt.Errorf("failed to route %s: %w", path, err)
+		}
+		results = append(results, routed...)
+	}
+
+	failed := 0
+	for _, result := range results {
+		if !result.Success {
+			failed++
+		}
+	}
+
+	err = c.print(results, func(w io.Writer) {
+		fmt.Fprintln(w, "STATUS\tTYPE\tSOURCE\tDESTINATION")
+		for _, result := range results {
+			status, destination := "routed", result.DestinationPath
+			switch {
+			case !result.Success:
+				status, destination = "failed", result.Error
+			case result.Duplicate:
+				status = "duplicate"
+			case result.AlreadyProcessed:
+				status = "skipped"
+			case result.Version > 1:
+				status = fmt.Sprintf("routed v%d", result.Version)
+			}
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", status, result.DocumentType, result.SourcePath, destination)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d documents failed to route", failed, len(results))
+	}
+	return nil
+}
+
+// cliExtraction is the extract result for one document
+type cliExtraction struct {
+	File       string             `json:"file"`
+	Financials *FinancialAnalysis `json:"financials,omitempty"`
+	Tables     []FinancialTable   `json:"tables,omitempty"`
+	Error      string             `json:"error,omitempty"`
+}
+
+func runCLIExtract(c *cliContext, args []string) error {
+	fs := flag.NewFlagSet("extract", flag.ContinueOnError)
+	dealName := fs.String("deal", "", "extract from the deal's financial documents")
+	tables := fs.Bool("tables", false, "extract statement tables instead of AI financial data")
+	files, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 && *dealName == "" {
+		return usageErrorf("expected files or --deal")
+	}
+	if err := c.start(*dealName != ""); err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		if err := c.requireDeal(*dealName); err != nil {
+			return err
+		}
+		files = dealDocumentPaths(c.app.GetDealFolderPath(*dealName), "financial")
+		if len(files) == 0 {
+			return fmt.Errorf("no financial documents in deal %s", *dealName)
+		}
+	}
+
+	results := make([]cliExtraction, 0, len(files))
+	failed := 0
+	for _, file := range files {
+		result := cliExtraction{File: file}
+		if *tables {
+			result.Tables, err = c.app.ExtractFinancialTables(file)
+		} else {
+			result.Financials, err = c.app.ExtractFinancialData(file)
+		}
+		if err != nil {
+			result.Error = err.Error()
+			failed++
+		}
+		results = append(results, result)
+	}
+
+	err = c.print(results, func(w io.Writer) {
+		if *tables {
+			fmt.Fprintln(w, "FILE\tSTATEMENT\tPERIODS\tROWS\tUNIT")
+			for _, result := range results {
+				if result.Error != "" {
+					fmt.Fprintf(w, "%s\terror: %s\t\t\t\n", result.File, result.Error)
+				}
+				for _, table := range result.Tables {
+					fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\n", result.File, table.Statement, len(table.Periods), len(table.Rows), table.Unit)
+				}
+			}
+			return
+		}
+
+		fmt.Fprintln(w, "FILE\tPERIOD\tREVENUE\tEBITDA\tNET INCOME\tCONFIDENCE")
+		for _, result := range results {
+			if result.Error != "" {
+				fmt.Fprintf(w, "%s\terror: %s\t\t\t\t\n", result.File, result.Error)
+				continue
+			}
+			f := result.Financials
+			fmt.Fprintf(w, "%s\t%s\t%.0f\t%.0f\t%.0f\t%.2f\n", result.File, f.Period, f.Revenue, f.EBITDA, f.NetIncome, f.Confidence)
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if failed == len(results) {
+		return fmt.Errorf("extraction failed for every document")
+	}
+	return nil
+}
+
+func runCLIPopulate(c *cliContext, args []string) error {
+	fs := flag.NewFlagSet("populate", flag.ContinueOnError)
+	templateName := fs.String("template", "", "template file or name in the Templates folder")
+	dealName := fs.String("deal", "", "deal whose documents populate the template")
+	outputPath := fs.String("out", "", "output file (default: the deal's analysis folder)")
+	documents, err := c.parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if *templateName == "" {
+		return usageErrorf("--template is required")
+	}
+	if err := c.start(true); err != nil {
+		return err
+	}
+	if err := c.requireDeal(*dealName); err != nil {
+		return err
+	}
+
+	templatePath := *templateName
+	if _, err := os.Stat(templatePath); err != nil {
+		templatePath = filepath.Join(c.app.GetConfiguredTemplatesPath(), *templateName)
+		if _, err := os.Stat(templatePath); err != nil {
+			return fmt.Errorf("template not found: %s", *templateName)
+		}
+	}
+
+	dealPath := c.app.GetDealFolderPath(*dealName)
+	if len(documents) == 0 {
+		documents = dealDocumentPaths(dealPath, "legal", "financial", "general")
+		if len(documents) == 0 {
+			return fmt.Errorf("no documents in deal %s", *dealName)
+		}
+	}
+	if *outputPath == "" {
+		*outputPath = filepath.Join(dealPath, "analysis", filepath.Base(templatePath))
+	}
+
+	mappedData, err := c.app.MapDataToTemplate(templatePath, documents, *dealName)
+	if err != nil {
+		return fmt.Errorf("failed to map data: %w", err)
+	}
+	if err := c.app.PopulateTemplate(templatePath, mappedData, *outputPath); err != nil {
+		return fmt.Errorf("failed to populate template: %w", err)
+	}
+
+	result := map[string]interface{}{
+		"template":     templatePath,
+		"output":       *outputPath,
+		"documents":    documents,
+		"mappedFields": len(mappedData.Fields),
+		"confidence":   mappedData.Confidence,
+		"warnings":     mappedData.Warnings,
+	}
+	return c.print(result, func(w io.Writer) {
+		fmt.Fprintf(w, "Populated %s\n", *outputPath)
+		fmt.Fprintf(w, "Fields mapped:\t%d\n", len(mappedData.Fields))
+		fmt.Fprintf(w, "Confidence:\t%.2f\n", mappedData.Confidence)
+		fmt.Fprintf(w, "Documents:\t%d\n", len(documents))
+		for _, warning := range mappedData.Warnings {
+			fmt.Fprintf(w, "Warning:\t%s\n", warning)
+		}
+	})
+}
+
+func runCLIValuation(c *cliContext, args []string) error {
+	fs := flag.NewFlagSet("valuation", flag.ContinueOnError)
+	dealName := fs.String("deal", "", "deal to value")
+	revenue := fs.Float64("revenue", 0, "revenue for a quick valuation")
+	ebitda := fs.Float64("ebitda", 0, "EBITDA for a quick valuation")
+	netIncome := fs.Float64("net-income", 0, "net income for a quick valuation")
+	if _, err := c.parse(fs, args); err != nil {
+		return err
+	}
+
+	// Explicit figures give a quick multiples range without touching documents
+	if *revenue != 0 || *ebitda != 0 || *netIncome != 0 {
+		if err := c.start(false); err != nil {
+			return err
+		}
+		valuation, err := c.app.CalculateQuickValuation(*revenue, *ebitda, *netIncome)
+		if err != nil {
+			return err
+		}
+		return c.print(valuation, func(w io.Writer) {
+			fmt.Fprintln(w, "LOW\tMID\tHIGH\tCURRENCY")
+			fmt.Fprintf(w, "%.0f\t%.0f\t%.0f\t%s\n", valuation.Low, valuation.Mid, valuation.High, valuation.Currency)
+		})
+	}
+
+	if err := c.start(true); err != nil {
+		return err
+	}
+	if err := c.requireDeal(*dealName); err != nil {
+		return err
+	}
+
+	// Value the deal on the most confident extraction from its financials
+	var financials *FinancialAnalysis
+	for _, file := range dealDocumentPaths(c.app.GetDealFolderPath(*dealName), "financial") {
+		data, err := c.app.ExtractFinancialData(file)
+		if err != nil {
+			fmt.Printf("Warning: Financial data extraction failed for %s: %v\n", file, err)
+			continue
+		}
+		if data.Revenue != 0 && (financials == nil || data.Confidence > financials.Confidence) {
+			financials = data
+		}
+	}
+	if financials == nil {
+		return fmt.Errorf("no financial data found for deal %s; pass --revenue, --ebitda and --net-income instead", *dealName)
+	}
+
+	result, err := c.app.CalculateDealValuation(*dealName, financials, nil)
+	if err != nil {
+		return err
+	}
+	report, err := c.app.GenerateValuationReport(result)
+	if err != nil {
+		return err
+	}
+	return c.print(result, func(w io.Writer) {
+		fmt.Fprint(w, report)
+	})
+}
+
+func runCLIJobsList(c *cliContext, args []string) error {
+	fs := flag.NewFlagSet("jobs ls", flag.ContinueOnError)
+	dealName := fs.String("deal", "", "only jobs for this deal")
+	status := fs.String("status", "", "only jobs with this status")
+	limit := fs.Int("limit", 50, "maximum number of jobs")
+	if _, err := c.parse(fs, args); err != nil {
+		return err
+	}
+	if err := c.start(true); err != nil {
+		return err
+	}
+
+	jobs, err := c.app.jobTracker.QueryJobs(&JobQuery{
+		DealName:  *dealName,
+		Status:    JobStatus(*status),
+		Limit:     *limit,
+		SortBy:    "updatedAt",
+		SortOrder: "desc",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to query jobs: %w", err)
+	}
+
+	return c.print(jobs, func(w io.Writer) {
+		fmt.Fprintln(w, "JOB\tDEAL\tSTATUS\tPROGRESS\tSTEP\tUPDATED")
+		for _, job := range jobs {
+			updated := time.UnixMilli(job.UpdatedAt).Format(time.RFC3339)
+			fmt.Fprintf(w, "%s\t%s\t%s\t%.0f%%\t%s\t%s\n", job.JobID, job.DealName, job.Status, job.Progress*100, job.CurrentStep, updated)
+		}
+	})
+}
+
+func runCLIQueueList(c *cliContext, args []string) error {
+	fs := flag.NewFlagSet("queue ls", flag.ContinueOnError)
+	dealName := fs.String("deal", "", "only items for this deal")
+	status := fs.String("status", "", "only items with this status")
+	limit := fs.Int("limit", 50, "maximum number of items")
+	if _, err := c.parse(fs, args); err != nil {
+		return err
+	}
+	if err := c.start(true); err != nil {
+		return err
+	}
+
+	items, err := c.app.queueManager.QueryQueue(QueueQuery{
+		DealName:  *dealName,
+		Status:    QueueItemStatus(*status),
+		Limit:     *limit,
+		SortBy:    "queuedAt",
+		SortOrder: "desc",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to query queue: %w", err)
+	}
+
+	return c.print(items, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tDEAL\tDOCUMENT\tSTATUS\tRETRIES\tQUEUED")
+		for _, item := range items {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", item.ID, item.DealName, item.DocumentName, item.Status, item.RetryCount, item.QueuedAt.Format(time.RFC3339))
+		}
+	})
+}
+
+func runCLIServe(c *cliContext, args []string) error {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	port := fs.Int("port", 8080, "webhook server port")
+	if _, err := c.parse(fs, args); err != nil {
+		return err
+	}
+	if err := c.start(true); err != nil {
+		return err
+	}
+
+	c.app.startBackgroundServices()
+	defer c.app.shutdown(context.Background())
+	if err := c.app.StartWebhookServer(*port); err != nil {
+		return err
+	}
+	defer c.app.StopWebhookServer()
+
+	status := map[string]interface{}{"port": *port, "root": c.app.GetDealDoneRoot()}
+	if err := c.print(status, func(w io.Writer) {
+		fmt.Fprintf(w, "Serving webhooks on port %d; press Ctrl+C to stop\n", *port)
+	}); err != nil {
+		return err
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+	<-signals
+	return nil
+}
+
+// dealDocumentPaths lists the documents under the given subfolders of a deal,
+// skipping temporary and hidden files
+func dealDocumentPaths(dealPath string, subfolders ...string) []string {
+	var paths []string
+	for _, subfolder := range subfolders {
+		root := filepath.Join(dealPath, subfolder)
+		filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return nil
+			}
+			if d.IsDir() {
+				if path != root && strings.HasPrefix(d.Name(), ".") {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !isIgnoredDealFile(d.Name()) {
+				paths = append(paths, path)
+			}
+			return nil
+		})
+	}
+	return paths
+}
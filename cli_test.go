@@ -0,0 +1,122 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// runTestCLI runs a command with an isolated config directory and returns
+// its exit code, stdout and stderr
+func runTestCLI(t *testing.T, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := runCLI(args, &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func setupCLITest(t *testing.T) string {
+	configDir := t.TempDir()
+	originalGetConfigDir := getConfigDir
+	getConfigDir = func() (string, error) { return configDir, nil }
+	t.Cleanup(func() { getConfigDir = originalGetConfigDir })
+	t.Setenv("DEALDONE_ROOT", "")
+	return filepath.Join(t.TempDir(), "DealDone")
+}
+
+func TestFindCLICommand(t *testing.T) {
+	cmd, rest := findCLICommand([]string{"deal", "create", "Acme"})
+	require.NotNil(t, cmd)
+	assert.Equal(t, "deal create", cmd.name)
+	assert.Equal(t, []string{"Acme"}, rest)
+
+	cmd, rest = findCLICommand([]string{"route", "inbox", "--deal", "Acme"})
+	require.NotNil(t, cmd)
+	assert.Equal(t, "route", cmd.name)
+	assert.Equal(t, []string{"inbox", "--deal", "Acme"}, rest)
+
+	cmd, _ = findCLICommand([]string{"deal", "archive"})
+	assert.Nil(t, cmd)
+
+	assert.True(t, isCLICommand("jobs"))
+	assert.True(t, isCLICommand("--help"))
+	assert.False(t, isCLICommand("-psn_0_12345"))
+}
+
+func TestCLIContext_Parse(t *testing.T) {
+	c := &cliContext{format: "table"}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	deal := fs.String("deal", "", "")
+	positional, err := c.parse(fs, []string{"inbox", "--deal", "Acme", "extra.pdf", "-o", "json", "--root", "/data"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"inbox", "extra.pdf"}, positional)
+	assert.Equal(t, "Acme", *deal)
+	assert.Equal(t, "json", c.format)
+	assert.Equal(t, "/data", c.root)
+
+	c = &cliContext{format: "table"}
+	_, err = c.parse(flag.NewFlagSet("test", flag.ContinueOnError), []string{"-o", "xml"})
+	var usageErr *cliUsageError
+	assert.ErrorAs(t, err, &usageErr)
+}
+
+func TestRunCLI(t *testing.T) {
+	root := setupCLITest(t)
+
+	code, _, stderr := runTestCLI(t, "deal", "ls", "--root", root)
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "not initialized")
+
+	code, stdout, _ := runTestCLI(t, "init", root, "-o", "json")
+	require.Equal(t, 0, code)
+	var initResult map[string]string
+	require.NoError(t, json.Unmarshal([]byte(stdout), &initResult))
+	assert.Equal(t, filepath.Join(root, "Deals"), initResult["dealsPath"])
+
+	// init saves the root, so later commands need no --root
+	code, stdout, _ = runTestCLI(t, "deal", "create", "Acme")
+	require.Equal(t, 0, code)
+	assert.Contains(t, stdout, filepath.Join(root, "Deals", "Acme"))
+
+	inbox := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(inbox, "nda.txt"), []byte("Non-disclosure agreement between the parties"), 0644))
+	code, stdout, stderr = runTestCLI(t, "route", inbox, "--deal", "Acme", "-o", "json")
+	require.Equal(t, 0, code, stderr)
+	var routed []RoutingResult
+	require.NoError(t, json.Unmarshal([]byte(stdout), &routed))
+	require.Len(t, routed, 1)
+	assert.True(t, routed[0].Success)
+	assert.FileExists(t, routed[0].DestinationPath)
+
+	code, stdout, _ = runTestCLI(t, "deal", "ls")
+	require.Equal(t, 0, code)
+	assert.Regexp(t, `Acme\s+1\s+`, stdout)
+
+	code, _, stderr = runTestCLI(t, "route", inbox)
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "--deal is required")
+
+	code, _, stderr = runTestCLI(t, "route", inbox, "--deal", "Missing")
+	assert.Equal(t, 1, code)
+	assert.Contains(t, stderr, "deal not found")
+
+	code, stdout, _ = runTestCLI(t, "valuation", "--ebitda", "200000", "-o", "json")
+	require.Equal(t, 0, code)
+	var valuation ValuationRange
+	require.NoError(t, json.Unmarshal([]byte(stdout), &valuation))
+	assert.Greater(t, valuation.Mid, 0.0)
+
+	code, stdout, _ = runTestCLI(t, "queue", "ls", "-o", "json")
+	require.Equal(t, 0, code)
+	assert.JSONEq(t, "[]", stdout)
+
+	code, _, stderr = runTestCLI(t, "deal", "archive")
+	assert.Equal(t, 2, code)
+	assert.Contains(t, stderr, "unknown command")
+}
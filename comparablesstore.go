@@ -0,0 +1,647 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ComparableKind distinguishes trading comparables from precedent transactions
+type ComparableKind string
+
+const (
+	ComparableTrading     ComparableKind = "trading"
+	ComparableTransaction ComparableKind = "transaction"
+)
+
+// comparablesStoreFile is the file analysts' edits are saved to; any other
+// CSV or JSON file in the store directory is loaded read-only
+const comparablesStoreFile = "comparables.json"
+
+// ComparableRecord is a single trading comp or precedent transaction
+type ComparableRecord struct {
+	ID              string         `json:"id"`
+	Kind            ComparableKind `json:"kind"`
+	Name            string         `json:"name"`
+	Ticker          string         `json:"ticker,omitempty"`
+	Acquirer        string         `json:"acquirer,omitempty"` // Precedent transactions only
+	Industry        string         `json:"industry"`
+	Geography       string         `json:"geography"`
+	SizeBand        string         `json:"sizeBand"`
+	Revenue         float64        `json:"revenue"`
+	EBITDA          float64        `json:"ebitda"`
+	EnterpriseValue float64        `json:"enterpriseValue"`
+	MarketCap       float64        `json:"marketCap,omitempty"`
+	EVToRevenue     float64        `json:"evToRevenue,omitempty"`
+	EVToEBITDA      float64        `json:"evToEBITDA,omitempty"`
+	AsOfDate        time.Time      `json:"asOfDate"`
+	Notes           string         `json:"notes,omitempty"`
+	Source          string         `json:"source,omitempty"` // File the record was loaded from
+}
+
+// ComparableCriteria describes the target when selecting peers
+type ComparableCriteria struct {
+	Kind          ComparableKind `json:"kind,omitempty"`
+	Industry      string         `json:"industry,omitempty"`
+	Geography     string         `json:"geography,omitempty"`
+	SizeBand      string         `json:"sizeBand,omitempty"`
+	Revenue       float64        `json:"revenue,omitempty"`
+	EBITDA        float64        `json:"ebitda,omitempty"`
+	AsOfAfter     time.Time      `json:"asOfAfter,omitempty"`
+	MinSimilarity float64        `json:"minSimilarity,omitempty"`
+	Limit         int            `json:"limit,omitempty"`
+}
+
+// ScoredComparable is a comparable with its similarity to the target
+type ScoredComparable struct {
+	ComparableRecord
+	Similarity float64 `json:"similarity"`
+}
+
+// ComparablesStore holds the local comparables dataset
+type ComparablesStore struct {
+	dir     string
+	records map[string]*ComparableRecord
+	mu      sync.RWMutex
+}
+
+// NewComparablesStore creates a store rooted at dir
+func NewComparablesStore(dir string) *ComparablesStore {
+	return &ComparablesStore{
+		dir:     dir,
+		records: make(map[string]*ComparableRecord),
+	}
+}
+
+// Load reads every CSV and JSON file in the store directory. A missing
+// directory is an empty store.
+func (cs *ComparablesStore) Load() error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.records = make(map[string]*ComparableRecord)
+	entries, err := os.ReadDir(cs.dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("failed to read comparables directory: %w", err)
+	}
+
+	var loadErrors []string
+	for _, entry := range entries {
+		ext := strings.ToLower(filepath.Ext(entry.Name()))
+		if entry.IsDir() || (ext != ".csv" && ext != ".json") {
+			continue
+		}
+
+		records, err := readComparablesFile(filepath.Join(cs.dir, entry.Name()))
+		if err != nil {
+			loadErrors = append(loadErrors, fmt.Sprintf("%s: %v", entry.Name(), err))
+			continue
+		}
+		for _, record := range records {
+			cs.records[record.ID] = record
+		}
+	}
+
+	if len(loadErrors) > 0 {
+		return fmt.Errorf("failed to load comparables: %s", strings.Join(loadErrors, "; "))
+	}
+	return nil
+}
+
+// List returns all comparables of the given kind, or all when kind is empty
+func (cs *ComparablesStore) List(kind ComparableKind) []ComparableRecord {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	list := make([]ComparableRecord, 0, len(cs.records))
+	for _, record := range cs.records {
+		if kind == "" || record.Kind == kind {
+			list = append(list, *record)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].AsOfDate.After(list[j].AsOfDate)
+	})
+	return list
+}
+
+// Get returns a comparable by ID
+func (cs *ComparablesStore) Get(id string) (*ComparableRecord, error) {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	record, exists := cs.records[id]
+	if !exists {
+		return nil, fmt.Errorf("comparable not found: %s", id)
+	}
+	copied := *record
+	return &copied, nil
+}
+
+// Add validates and saves a new comparable
+func (cs *ComparablesStore) Add(record ComparableRecord) (*ComparableRecord, error) {
+	record.ID = uuid.New().String()
+	record.Source = comparablesStoreFile
+	if err := normalizeComparable(&record); err != nil {
+		return nil, err
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	cs.records[record.ID] = &record
+	if err := cs.save(); err != nil {
+		delete(cs.records, record.ID)
+		return nil, err
+	}
+	copied := record
+	return &copied, nil
+}
+
+// Update replaces an existing comparable. Records loaded from other files
+// must be changed in that file or imported first.
+func (cs *ComparablesStore) Update(record ComparableRecord) (*ComparableRecord, error) {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	existing, exists := cs.records[record.ID]
+	if !exists {
+		return nil, fmt.Errorf("comparable not found: %s", record.ID)
+	}
+	if existing.Source != comparablesStoreFile {
+		return nil, fmt.Errorf("comparable %s is read-only; it is loaded from %s", record.ID, existing.Source)
+	}
+
+	record.Source = comparablesStoreFile
+	if err := normalizeComparable(&record); err != nil {
+		return nil, err
+	}
+
+	previous := *existing
+	cs.records[record.ID] = &record
+	if err := cs.save(); err != nil {
+		cs.records[record.ID] = &previous
+		return nil, err
+	}
+	copied := record
+	return &copied, nil
+}
+
+// Delete removes a comparable saved in the store file
+func (cs *ComparablesStore) Delete(id string) error {
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	existing, exists := cs.records[id]
+	if !exists {
+		return fmt.Errorf("comparable not found: %s", id)
+	}
+	if existing.Source != comparablesStoreFile {
+		return fmt.Errorf("comparable %s is read-only; it is loaded from %s", id, existing.Source)
+	}
+
+	delete(cs.records, id)
+	if err := cs.save(); err != nil {
+		cs.records[id] = existing
+		return err
+	}
+	return nil
+}
+
+// Import copies the comparables in a CSV or JSON file into the store file,
+// where they can be edited, and returns how many were imported
+func (cs *ComparablesStore) Import(filePath string) (int, error) {
+	records, err := readComparablesFile(filePath)
+	if err != nil {
+		return 0, fmt.Errorf("failed to import %s: %w", filepath.Base(filePath), err)
+	}
+
+	cs.mu.Lock()
+	defer cs.mu.Unlock()
+
+	for _, record := range records {
+		record.ID = uuid.New().String()
+		record.Source = comparablesStoreFile
+		cs.records[record.ID] = record
+	}
+	if err := cs.save(); err != nil {
+		for _, record := range records {
+			delete(cs.records, record.ID)
+		}
+		return 0, err
+	}
+	return len(records), nil
+}
+
+// Select returns the comparables most similar to the criteria, best first
+func (cs *ComparablesStore) Select(criteria ComparableCriteria) []ScoredComparable {
+	cs.mu.RLock()
+	defer cs.mu.RUnlock()
+
+	sizeBand := criteria.SizeBand
+	if sizeBand == "" && criteria.Revenue > 0 {
+		sizeBand = revenueSizeBand(criteria.Revenue)
+	}
+
+	selected := make([]ScoredComparable, 0)
+	for _, record := range cs.records {
+		if criteria.Kind != "" && record.Kind != criteria.Kind {
+			continue
+		}
+		if !criteria.AsOfAfter.IsZero() && record.AsOfDate.Before(criteria.AsOfAfter) {
+			continue
+		}
+
+		score := comparableSimilarity(record, criteria, sizeBand)
+		if score < criteria.MinSimilarity {
+			continue
+		}
+		selected = append(selected, ScoredComparable{ComparableRecord: *record, Similarity: score})
+	}
+
+	sort.Slice(selected, func(i, j int) bool {
+		if selected[i].Similarity != selected[j].Similarity {
+			return selected[i].Similarity > selected[j].Similarity
+		}
+		return selected[i].AsOfDate.After(selected[j].AsOfDate)
+	})
+	if criteria.Limit > 0 && len(selected) > criteria.Limit {
+		selected = selected[:criteria.Limit]
+	}
+	return selected
+}
+
+// save writes the records owned by the store file atomically
+func (cs *ComparablesStore) save() error {
+	owned := make([]*ComparableRecord, 0)
+	for _, record := range cs.records {
+		if record.Source == comparablesStoreFile {
+			owned = append(owned, record)
+		}
+	}
+	sort.Slice(owned, func(i, j int) bool { return owned[i].ID < owned[j].ID })
+
+	if err := os.MkdirAll(cs.dir, 0755); err != nil {
+		return fmt.Errorf("failed to create comparables directory: %w", err)
+	}
+	data, err := json.MarshalIndent(map[string]interface{}{"comparables": owned}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode comparables: %w", err)
+	}
+
+	path := filepath.Join(cs.dir, comparablesStoreFile)
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write comparables: %w", err)
+	}
+	if err := os.Rename(tmpPath, path); err != nil {
+		return fmt.Errorf("failed to write comparables: %w", err)
+	}
+	return nil
+}
+
+// comparableSimilarity scores a record against the target on industry,
+// geography, size, margin and recency, each weighted into a 0-1 score
+func comparableSimilarity(record *ComparableRecord, criteria ComparableCriteria, sizeBand string) float64 {
+	score, weights := 0.0, 0.0
+	add := func(value, weight float64) {
+		score += value * weight
+		weights += weight
+	}
+
+	if criteria.Industry != "" {
+		add(textMatchScore(criteria.Industry, record.Industry), 3)
+	}
+	if criteria.Geography != "" {
+		add(geographyMatchScore(criteria.Geography, record.Geography), 1.5)
+	}
+	if sizeBand != "" {
+		distance := math.Abs(float64(sizeBandIndex(sizeBand) - sizeBandIndex(record.SizeBand)))
+		add(math.Max(0, 1-distance*0.5), 1.5)
+	}
+	if criteria.Revenue > 0 && criteria.EBITDA != 0 && record.Revenue > 0 && record.EBITDA != 0 {
+		marginDiff := math.Abs(criteria.EBITDA/criteria.Revenue - record.EBITDA/record.Revenue)
+		add(1-math.Min(marginDiff*2, 1), 1)
+	}
+	if !record.AsOfDate.IsZero() {
+		// Full credit for data under a year old, none past five years
+		age := time.Since(record.AsOfDate).Hours() / (24 * 365)
+		add(math.Max(0, math.Min(1, 1-(age-1)/4)), 1)
+	}
+
+	if weights == 0 {
+		return 0.5
+	}
+	return score / weights
+}
+
+// textMatchScore compares free-text classifications such as industries
+func textMatchScore(target, candidate string) float64 {
+	target = strings.ToLower(strings.TrimSpace(target))
+	candidate = strings.ToLower(strings.TrimSpace(candidate))
+	switch {
+	case target == "" || candidate == "":
+		return 0
+	case target == candidate:
+		return 1
+	case strings.Contains(candidate, target) || strings.Contains(target, candidate):
+		return 0.75
+	}
+
+	targetWords := strings.FieldsFunc(target, func(r rune) bool { return !isASCIILetter(byte(r)) })
+	shared := 0
+	for _, word := range targetWords {
+		if len(word) > 3 && strings.Contains(candidate, word) {
+			shared++
+		}
+	}
+	if len(targetWords) == 0 {
+		return 0
+	}
+	return 0.5 * float64(shared) / float64(len(targetWords))
+}
+
+// geographyMatchScore gives partial credit to global peers
+func geographyMatchScore(target, candidate string) float64 {
+	if score := textMatchScore(target, candidate); score > 0 {
+		return score
+	}
+	switch strings.ToLower(strings.TrimSpace(candidate)) {
+	case "global", "worldwide", "international":
+		return 0.5
+	}
+	return 0
+}
+
+// sizeBands are revenue bands from smallest to largest
+var sizeBands = []struct {
+	name       string
+	maxRevenue float64
+}{
+	{"micro", 10e6},
+	{"small", 50e6},
+	{"mid", 250e6},
+	{"large", 1e9},
+	{"mega", math.Inf(1)},
+}
+
+// revenueSizeBand classifies revenue into a size band
+func revenueSizeBand(revenue float64) string {
+	for _, band := range sizeBands {
+		if revenue < band.maxRevenue {
+			return band.name
+		}
+	}
+	return sizeBands[len(sizeBands)-1].name
+}
+
+// sizeBandIndex returns the position of a band, or the middle if unknown
+func sizeBandIndex(band string) int {
+	band = strings.ToLower(strings.TrimSpace(band))
+	band = strings.TrimSuffix(strings.TrimSuffix(band, "-cap"), " cap")
+	if band == "middle" || band == "mid-market" {
+		band = "mid"
+	}
+	for i, candidate := range sizeBands {
+		if candidate.name == band {
+			return i
+		}
+	}
+	return len(sizeBands) / 2
+}
+
+// normalizeComparable validates a record and fills derived fields
+func normalizeComparable(record *ComparableRecord) error {
+	record.Name = strings.TrimSpace(record.Name)
+	if record.Name == "" {
+		return fmt.Errorf("comparable name is required")
+	}
+
+	switch ComparableKind(strings.ToLower(string(record.Kind))) {
+	case "", ComparableTrading, "trading comps", "public":
+		record.Kind = ComparableTrading
+	case ComparableTransaction, "precedent", "precedent transaction", "deal":
+		record.Kind = ComparableTransaction
+	default:
+		return fmt.Errorf("unknown comparable kind: %s", record.Kind)
+	}
+
+	if record.EnterpriseValue == 0 {
+		switch {
+		case record.EVToEBITDA > 0 && record.EBITDA > 0:
+			record.EnterpriseValue = record.EVToEBITDA * record.EBITDA
+		case record.EVToRevenue > 0 && record.Revenue > 0:
+			record.EnterpriseValue = record.EVToRevenue * record.Revenue
+		default:
+			record.EnterpriseValue = record.MarketCap
+		}
+	}
+	if record.EVToEBITDA == 0 && record.EBITDA > 0 && record.EnterpriseValue > 0 {
+		record.EVToEBITDA = record.EnterpriseValue / record.EBITDA
+	}
+	if record.EVToRevenue == 0 && record.Revenue > 0 && record.EnterpriseValue > 0 {
+		record.EVToRevenue = record.EnterpriseValue / record.Revenue
+	}
+	if record.SizeBand == "" && record.Revenue > 0 {
+		record.SizeBand = revenueSizeBand(record.Revenue)
+	}
+	return nil
+}
+
+// readComparablesFile parses a CSV or JSON comparables file
+func readComparablesFile(path string) ([]*ComparableRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []*ComparableRecord
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		records, err = parseComparablesCSV(file)
+	case ".json":
+		records, err = parseComparablesJSON(file)
+	default:
+		return nil, fmt.Errorf("unsupported comparables file type: %s", filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	source := filepath.Base(path)
+	for i, record := range records {
+		if err := normalizeComparable(record); err != nil {
+			return nil, fmt.Errorf("record %d: %w", i+1, err)
+		}
+		if record.ID == "" {
+			record.ID = fmt.Sprintf("%s#%d", source, i+1)
+		}
+		record.Source = source
+	}
+	return records, nil
+}
+
+// parseComparablesJSON accepts either an array of records or an object
+// with a "comparables" array
+func parseComparablesJSON(r io.Reader) ([]*ComparableRecord, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var records []*ComparableRecord
+	if err := json.Unmarshal(data, &records); err == nil {
+		return records, nil
+	}
+
+	var wrapped struct {
+		Comparables []*ComparableRecord `json:"comparables"`
+	}
+	if err := json.Unmarshal(data, &wrapped); err != nil {
+		return nil, fmt.Errorf("invalid comparables JSON: %w", err)
+	}
+	return wrapped.Comparables, nil
+}
+
+// comparableColumns maps normalized CSV headers to record fields
+var comparableColumns = map[string]string{
+	"id": "id", "kind": "kind", "type": "kind",
+	"name": "name", "company": "name", "target": "name",
+	"ticker": "ticker", "symbol": "ticker", "acquirer": "acquirer", "buyer": "acquirer",
+	"industry": "industry", "sector": "industry",
+	"geography": "geography", "region": "geography", "country": "geography",
+	"size band": "sizeBand", "size": "sizeBand",
+	"revenue": "revenue", "sales": "revenue", "ltm revenue": "revenue",
+	"ebitda": "ebitda", "ltm ebitda": "ebitda",
+	"enterprise value": "enterpriseValue", "ev": "enterpriseValue", "transaction value": "enterpriseValue",
+	"market cap": "marketCap", "market capitalization": "marketCap",
+	"ev/revenue": "evToRevenue", "ev / revenue": "evToRevenue", "ev/sales": "evToRevenue",
+	"ev/ebitda": "evToEBITDA", "ev / ebitda": "evToEBITDA",
+	"as of date": "asOfDate", "as of": "asOfDate", "date": "asOfDate", "announced": "asOfDate",
+	"notes": "notes",
+}
+
+// parseComparablesCSV reads a headed CSV of comparables
+func parseComparablesCSV(r io.Reader) ([]*ComparableRecord, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.TrimLeadingSpace = true
+
+	rows, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("invalid comparables CSV: %w", err)
+	}
+	if len(rows) == 0 {
+		return nil, nil
+	}
+
+	fields := make([]string, len(rows[0]))
+	hasName := false
+	for i, header := range rows[0] {
+		normalized := strings.ToLower(strings.Join(strings.Fields(strings.ReplaceAll(header, "_", " ")), " "))
+		fields[i] = comparableColumns[normalized]
+		hasName = hasName || fields[i] == "name"
+	}
+	if !hasName {
+		return nil, fmt.Errorf("comparables CSV needs a name column")
+	}
+
+	records := make([]*ComparableRecord, 0, len(rows)-1)
+	for rowIndex, row := range rows[1:] {
+		record := &ComparableRecord{}
+		empty := true
+		for i, cell := range row {
+			cell = strings.TrimSpace(cell)
+			if i >= len(fields) || fields[i] == "" || cell == "" {
+				continue
+			}
+			empty = false
+			if err := setComparableField(record, fields[i], cell); err != nil {
+				return nil, fmt.Errorf("row %d: %w", rowIndex+2, err)
+			}
+		}
+		if !empty {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+// setComparableField assigns one CSV cell to a record
+func setComparableField(record *ComparableRecord, field, cell string) error {
+	number := func() (float64, error) {
+		if isEmptyValue(cell) {
+			return 0, nil
+		}
+		value, _, ok := parseFinancialNumber(cell)
+		if !ok {
+			return 0, fmt.Errorf("invalid %s: %q", field, cell)
+		}
+		return value, nil
+	}
+
+	var err error
+	switch field {
+	case "id":
+		record.ID = cell
+	case "kind":
+		record.Kind = ComparableKind(cell)
+	case "name":
+		record.Name = cell
+	case "ticker":
+		record.Ticker = cell
+	case "acquirer":
+		record.Acquirer = cell
+	case "industry":
+		record.Industry = cell
+	case "geography":
+		record.Geography = cell
+	case "sizeBand":
+		record.SizeBand = strings.ToLower(cell)
+	case "notes":
+		record.Notes = cell
+	case "revenue":
+		record.Revenue, err = number()
+	case "ebitda":
+		record.EBITDA, err = number()
+	case "enterpriseValue":
+		record.EnterpriseValue, err = number()
+	case "marketCap":
+		record.MarketCap, err = number()
+	case "evToRevenue":
+		record.EVToRevenue, err = number()
+	case "evToEBITDA":
+		record.EVToEBITDA, err = number()
+	case "asOfDate":
+		record.AsOfDate, err = parseComparableDate(cell)
+	}
+	return err
+}
+
+// parseComparableDate accepts the date layouts analysts commonly export
+func parseComparableDate(value string) (time.Time, error) {
+	layouts := []string{"2006-01-02", "01/02/2006", "1/2/2006", "2006/01/02", "Jan 2006", "January 2006", "Jan-06", "2006-01", "2006"}
+	for _, layout := range layouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid date: %q", value)
+}
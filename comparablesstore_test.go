@@ -0,0 +1,202 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testTradingCompsCSV = "Company,Ticker,Sector,Region,Revenue,EBITDA,EV,As Of Date\n" +
+	"Hydro Systems,HYD,Water Technology,North America,$40m,$8m,$88m,2026-06-30\n" +
+	"Clearwater Inc,CLW,Water Technology,Europe,$45m,$9m,$90m,2026-06-30\n" +
+	"FlowTech,FLT,Water Treatment,North America,$35m,$7m,$84m,2026-03-31\n" +
+	"Aqua Global,AQG,Water Technology,Global,$60m,$12m,$156m,2026-06-30\n" +
+	"Frothy Corp,FRO,Water Technology,North America,$30m,$3m,$150m,2026-06-30\n" +
+	"Steel Works,STW,Industrial Metals,Asia,$900m,$150m,$900m,2019-12-31\n"
+
+func writeComparablesFixture(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func TestComparablesStoreLoad(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Comparables")
+	writeComparablesFixture(t, dir, "trading.csv", testTradingCompsCSV)
+	writeComparablesFixture(t, dir, "precedents.json", `[
+		{"kind": "precedent", "name": "PureFlow", "acquirer": "Big Water", "industry": "Water Technology",
+		 "geography": "North America", "revenue": 50000000, "ebitda": 10000000, "evToEBITDA": 12,
+		 "asOfDate": "2025-11-01T00:00:00Z"}
+	]`)
+
+	store := NewComparablesStore(dir)
+	require.NoError(t, store.Load())
+
+	trading := store.List(ComparableTrading)
+	require.Len(t, trading, 6)
+	assert.Equal(t, "Aqua Global", trading[0].Name)
+	assert.Equal(t, "trading.csv", trading[0].Source)
+	assert.Equal(t, 60000000.0, trading[0].Revenue)
+	assert.InDelta(t, 13.0, trading[0].EVToEBITDA, 0.001)
+	assert.Equal(t, "large", trading[len(trading)-1].SizeBand)
+	assert.Equal(t, 2026, trading[0].AsOfDate.Year())
+
+	transactions := store.List(ComparableTransaction)
+	require.Len(t, transactions, 1)
+	assert.Equal(t, 120000000.0, transactions[0].EnterpriseValue)
+	assert.Equal(t, "mid", transactions[0].SizeBand)
+
+	// Missing directories are an empty store
+	empty := NewComparablesStore(filepath.Join(t.TempDir(), "missing"))
+	require.NoError(t, empty.Load())
+	assert.Empty(t, empty.List(""))
+}
+
+func TestComparablesStoreCRUD(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Comparables")
+	writeComparablesFixture(t, dir, "trading.csv", testTradingCompsCSV)
+
+	store := NewComparablesStore(dir)
+	require.NoError(t, store.Load())
+
+	added, err := store.Add(ComparableRecord{
+		Name:       "Tidewater Analytics",
+		Industry:   "Water Technology",
+		Geography:  "North America",
+		Revenue:    20000000,
+		EBITDA:     4000000,
+		EVToEBITDA: 10,
+		AsOfDate:   time.Date(2026, 9, 30, 0, 0, 0, 0, time.UTC),
+		Notes:      "Analyst estimate",
+	})
+	require.NoError(t, err)
+	assert.NotEmpty(t, added.ID)
+	assert.Equal(t, ComparableTrading, added.Kind)
+	assert.Equal(t, 40000000.0, added.EnterpriseValue)
+	assert.Equal(t, "small", added.SizeBand)
+
+	added.EBITDA = 5000000
+	added.EVToEBITDA = 0
+	updated, err := store.Update(*added)
+	require.NoError(t, err)
+	assert.Equal(t, 8.0, updated.EVToEBITDA)
+
+	// Edits survive a reload
+	reloaded := NewComparablesStore(dir)
+	require.NoError(t, reloaded.Load())
+	saved, err := reloaded.Get(added.ID)
+	require.NoError(t, err)
+	assert.Equal(t, 5000000.0, saved.EBITDA)
+
+	// Records from drop-in files are read-only
+	var csvRecord ComparableRecord
+	for _, record := range reloaded.List("") {
+		if record.Source == "trading.csv" {
+			csvRecord = record
+			break
+		}
+	}
+	_, err = reloaded.Update(csvRecord)
+	assert.Error(t, err)
+	assert.Error(t, reloaded.Delete(csvRecord.ID))
+
+	require.NoError(t, reloaded.Delete(added.ID))
+	_, err = reloaded.Get(added.ID)
+	assert.Error(t, err)
+
+	_, err = reloaded.Add(ComparableRecord{Revenue: 1})
+	assert.Error(t, err, "name is required")
+}
+
+func TestComparablesStoreImport(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Comparables")
+	source := writeComparablesFixture(t, t.TempDir(), "export.csv", testTradingCompsCSV)
+
+	store := NewComparablesStore(dir)
+	imported, err := store.Import(source)
+	require.NoError(t, err)
+	assert.Equal(t, 6, imported)
+
+	// Imported records are owned by the store and editable
+	records := store.List("")
+	require.Len(t, records, 6)
+	assert.Equal(t, comparablesStoreFile, records[0].Source)
+	records[0].Notes = "reviewed"
+	_, err = store.Update(records[0])
+	require.NoError(t, err)
+
+	_, err = store.Import(writeComparablesFixture(t, t.TempDir(), "bad.csv", "Ticker,Revenue\nABC,10\n"))
+	assert.Error(t, err)
+}
+
+func TestComparablesStoreSelect(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Comparables")
+	writeComparablesFixture(t, dir, "trading.csv", testTradingCompsCSV)
+
+	store := NewComparablesStore(dir)
+	require.NoError(t, store.Load())
+
+	peers := store.Select(ComparableCriteria{
+		Industry:      "Water Technology",
+		Geography:     "North America",
+		Revenue:       42000000,
+		EBITDA:        8400000,
+		MinSimilarity: 0.5,
+	})
+	require.NotEmpty(t, peers)
+	assert.Equal(t, "Hydro Systems", peers[0].Name)
+	for _, peer := range peers {
+		assert.NotEqual(t, "Steel Works", peer.Name, "unrelated industry should be filtered out")
+	}
+
+	limited := store.Select(ComparableCriteria{Industry: "Water Technology", Limit: 2})
+	assert.Len(t, limited, 2)
+
+	recent := store.Select(ComparableCriteria{AsOfAfter: time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)})
+	for _, peer := range recent {
+		assert.NotEqual(t, "FlowTech", peer.Name)
+	}
+}
+
+func TestComparableAnalysisUsesStore(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "Comparables")
+	writeComparablesFixture(t, dir, "trading.csv", testTradingCompsCSV)
+
+	store := NewComparablesStore(dir)
+	require.NoError(t, store.Load())
+
+	calc := NewDealValuationCalculator(nil)
+	calc.SetComparablesStore(store)
+
+	financial := &FinancialAnalysis{Revenue: 42000000, EBITDA: 8400000}
+	marketData := map[string]interface{}{
+		"industry":  "Water Technology",
+		"geography": "North America",
+	}
+
+	comps := calc.performComparableAnalysis(financial, marketData)
+	assert.Equal(t, "comparablesStore", comps.Source)
+	require.Len(t, comps.ComparableCompanies, 5)
+
+	// Frothy Corp trades at 50x and is trimmed before the median
+	assert.Equal(t, 1, comps.OutliersExcluded)
+	for _, comp := range comps.ComparableCompanies {
+		assert.Equal(t, comp.Name == "Frothy Corp", comp.Excluded, comp.Name)
+	}
+	assert.InDelta(t, 11.5, comps.MedianMultiple, 0.001)
+	assert.InDelta(t, 8400000*11.5, comps.ImpliedValue, 1)
+
+	// Without a store or market comparables no peers are invented
+	bare := NewDealValuationCalculator(nil)
+	result, err := bare.CalculateValuation("No Comps", financial, map[string]interface{}{})
+	require.NoError(t, err)
+	assert.Empty(t, result.Comps.ComparableCompanies)
+	assert.Zero(t, result.Comps.ImpliedValue)
+	assert.Contains(t, result.Warnings, "No comparable companies available; add peers to the comparables store")
+}
@@ -10,16 +10,18 @@ import (
 
 // Config represents the application configuration
 type Config struct {
-	DealDoneRoot    string `json:"dealdone_root"`
-	FirstRun        bool   `json:"first_run"`
-	DefaultTemplate string `json:"default_template"`
-	LastOpenedDeal  string `json:"last_opened_deal"`
+	DealDoneRoot    string   `json:"dealdone_root"`
+	FirstRun        bool     `json:"first_run"`
+	DefaultTemplate string   `json:"default_template"`
+	LastOpenedDeal  string   `json:"last_opened_deal"`
+	WatchedDeals    []string `json:"watched_deals,omitempty"` // Deals whose folders are auto-ingested
 }
 
 // ConfigService handles configuration management
 type ConfigService struct {
-	configPath string
-	config     *Config
+	configPath   string
+	config       *Config
+	rootOverride string // Takes precedence over config.DealDoneRoot; never saved
 }
 
 // NewConfigService creates a new configuration service
@@ -133,6 +135,7 @@ func (cs *ConfigService) GetConfig() *Config {
 // SetDealDoneRoot updates the DealDone root folder path
 func (cs *ConfigService) SetDealDoneRoot(path string) error {
 	cs.config.DealDoneRoot = path
+	cs.rootOverride = ""
 	return cs.Save()
 }
 
@@ -142,8 +145,32 @@ func (cs *ConfigService) SetFirstRun(firstRun bool) error {
 	return cs.Save()
 }
 
+// SetDealWatched records whether a deal folder is auto-ingested
+func (cs *ConfigService) SetDealWatched(dealName string, watched bool) error {
+	deals := make([]string, 0, len(cs.config.WatchedDeals)+1)
+	for _, deal := range cs.config.WatchedDeals {
+		if deal != dealName {
+			deals = append(deals, deal)
+		}
+	}
+	if watched {
+		deals = append(deals, dealName)
+	}
+	cs.config.WatchedDeals = deals
+	return cs.Save()
+}
+
+// OverrideDealDoneRoot uses path as the DealDone root for this process
+// without changing the saved configuration
+func (cs *ConfigService) OverrideDealDoneRoot(path string) {
+	cs.rootOverride = path
+}
+
 // GetDealDoneRoot returns the DealDone root folder path
 func (cs *ConfigService) GetDealDoneRoot() string {
+	if cs.rootOverride != "" {
+		return cs.rootOverride
+	}
 	return cs.config.DealDoneRoot
 }
 
@@ -154,10 +181,15 @@ func (cs *ConfigService) IsFirstRun() bool {
 
 // GetTemplatesPath returns the path to the Templates folder
 func (cs *ConfigService) GetTemplatesPath() string {
-	return filepath.Join(cs.config.DealDoneRoot, "Templates")
+	return filepath.Join(cs.GetDealDoneRoot(), "Templates")
 }
 
 // GetDealsPath returns the path to the Deals folder
 func (cs *ConfigService) GetDealsPath() string {
-	return filepath.Join(cs.config.DealDoneRoot, "Deals")
+	return filepath.Join(cs.GetDealDoneRoot(), "Deals")
+}
+
+// GetComparablesPath returns the path to the Comparables folder
+func (cs *ConfigService) GetComparablesPath() string {
+	return filepath.Join(cs.GetDealDoneRoot(), "Comparables")
 }
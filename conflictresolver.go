@@ -2,12 +2,8 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"math"
-	"os"
-	"path/filepath"
 	"sort"
 	"strconv"
 	"strings"
@@ -32,10 +28,16 @@ type ConflictResolver struct {
 	auditTrail           []*ConflictAuditEntry
 	resolutionStrategies map[string]ResolutionStrategy
 	config               *ConflictResolutionConfig
-	persistencePath      string
+	repo                 ConflictRepository
 	logger               Logger
 }
 
+// ConflictRepository persists conflict history and the audit trail
+type ConflictRepository interface {
+	LoadConflicts() (map[string][]*ConflictResolutionRecord, []*ConflictAuditEntry, error)
+	SaveConflicts(history map[string][]*ConflictResolutionRecord, audit []*ConflictAuditEntry) error
+}
+
 // ConflictResolutionRecord tracks details of conflict resolution
 type ConflictResolutionRecord struct {
 	ID                 string                 `json:"id"`
@@ -103,13 +105,28 @@ type ConflictResolutionConfig struct {
 	DebugMode                 bool              `json:"debugMode"`
 }
 
-// NewConflictResolver creates a new conflict resolver with default configuration
+// NewConflictResolver creates a conflict resolver persisted in a state store
+// in persistencePath; an empty path keeps conflicts in memory only
 func NewConflictResolver(persistencePath string, logger Logger) *ConflictResolver {
+	if persistencePath == "" {
+		return NewConflictResolverWithRepository(nil, logger)
+	}
+
+	repo := openComponentStore(persistencePath)
+	if err := repo.importLegacyConflicts(persistencePath); err != nil && logger != nil {
+		logger.Warn("Failed to import conflict history: %v", err)
+	}
+	return NewConflictResolverWithRepository(repo, logger)
+}
+
+// NewConflictResolverWithRepository creates a conflict resolver with default
+// configuration that persists through repo
+func NewConflictResolverWithRepository(repo ConflictRepository, logger Logger) *ConflictResolver {
 	resolver := &ConflictResolver{
 		conflictHistory:      make(map[string][]*ConflictResolutionRecord),
 		auditTrail:           make([]*ConflictAuditEntry, 0),
 		resolutionStrategies: make(map[string]ResolutionStrategy),
-		persistencePath:      persistencePath,
+		repo:                 repo,
 		logger:               logger,
 		config: &ConflictResolutionConfig{
 			MinConfidenceThreshold:    0.7,
@@ -754,66 +771,35 @@ func (cr *ConflictResolver) GetConflictStatistics() map[string]interface{} {
 
 // Persistence methods
 
-// loadPersistedData loads conflict history and audit trail from disk
+// loadPersistedData loads conflict history and the audit trail
 func (cr *ConflictResolver) loadPersistedData() error {
-	if cr.persistencePath == "" {
+	if cr.repo == nil {
 		return nil
 	}
 
-	// Create directory if it doesn't exist
-	if err := os.MkdirAll(cr.persistencePath, 0755); err != nil {
-		return fmt.Errorf("failed to create persistence directory: %w", err)
-	}
-
-	// Load conflict history
-	historyPath := filepath.Join(cr.persistencePath, "conflict_history.json")
-	if data, err := ioutil.ReadFile(historyPath); err == nil {
-		if err := json.Unmarshal(data, &cr.conflictHistory); err != nil {
-			if cr.logger != nil {
-				cr.logger.Warn("Failed to load conflict history: %v", err)
-			}
+	history, audit, err := cr.repo.LoadConflicts()
+	if err != nil {
+		if cr.logger != nil {
+			cr.logger.Warn("Failed to load conflict history: %v", err)
 		}
+		return err
 	}
-
-	// Load audit trail
-	auditPath := filepath.Join(cr.persistencePath, "audit_trail.json")
-	if data, err := ioutil.ReadFile(auditPath); err == nil {
-		if err := json.Unmarshal(data, &cr.auditTrail); err != nil {
-			if cr.logger != nil {
-				cr.logger.Warn("Failed to load audit trail: %v", err)
-			}
-		}
+	cr.conflictHistory = history
+	if audit != nil {
+		cr.auditTrail = audit
 	}
-
 	return nil
 }
 
-// SaveState persists conflict resolution data to disk
+// SaveState persists conflict history and the audit trail
 func (cr *ConflictResolver) SaveState() error {
 	cr.mutex.RLock()
 	defer cr.mutex.RUnlock()
 
-	if cr.persistencePath == "" {
+	if cr.repo == nil {
 		return nil
 	}
-
-	// Save conflict history
-	if data, err := json.Marshal(cr.conflictHistory); err == nil {
-		historyPath := filepath.Join(cr.persistencePath, "conflict_history.json")
-		if err := ioutil.WriteFile(historyPath, data, 0644); err != nil {
-			return fmt.Errorf("failed to save conflict history: %w", err)
-		}
-	}
-
-	// Save audit trail
-	if data, err := json.Marshal(cr.auditTrail); err == nil {
-		auditPath := filepath.Join(cr.persistencePath, "audit_trail.json")
-		if err := ioutil.WriteFile(auditPath, data, 0644); err != nil {
-			return fmt.Errorf("failed to save audit trail: %w", err)
-		}
-	}
-
-	return nil
+	return cr.repo.SaveConflicts(cr.conflictHistory, cr.auditTrail)
 }
 
 // UpdateConfiguration updates the conflict resolver configuration
@@ -4,9 +4,7 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"strings"
@@ -127,6 +125,20 @@ type CorrectionDetectionConfig struct {
 	StoragePath                string        `json:"storage_path"`
 	BackupInterval             time.Duration `json:"backup_interval"`
 	MaxCorrectionHistory       int           `json:"max_correction_history"`
+
+	// Repository persists corrections; when nil they are kept in a state
+	// store under StoragePath
+	Repository CorrectionRepository `json:"-"`
+
+	// Embedder embeds corrections for retrieval; when nil they are embedded
+	// locally
+	Embedder Embedder `json:"-"`
+}
+
+// CorrectionRepository persists corrections and the learning model
+type CorrectionRepository interface {
+	LoadCorrections() (map[string]*CorrectionEntry, *LearningModel, error)
+	SaveCorrections(corrections map[string]*CorrectionEntry, model *LearningModel) error
 }
 
 // CorrectionProcessor handles user correction detection and learning
@@ -156,6 +168,7 @@ type RAGLearningEngine struct {
 	vectorStore    map[string][]float64
 	contextWindow  int
 	embeddingCache map[string][]float64
+	embedder       Embedder
 	learningRate   float64
 	mutex          sync.RWMutex
 }
@@ -205,6 +218,7 @@ func NewCorrectionProcessor(config CorrectionDetectionConfig, logger Logger) *Co
 		EnableKnowledgeGraph:     true,
 		EnableUserProfiling:      true,
 		CacheSize:                1000,
+		Embedder:                 config.Embedder,
 	}
 
 	processor := &CorrectionProcessor{
@@ -223,6 +237,13 @@ func NewCorrectionProcessor(config CorrectionDetectionConfig, logger Logger) *Co
 	if err := os.MkdirAll(config.StoragePath, 0755); err != nil {
 		logger.Error("Failed to create storage directory: %v", err)
 	}
+	if processor.config.Repository == nil {
+		repo := openComponentStore(config.StoragePath)
+		if err := repo.importLegacyCorrections(filepath.Join(config.StoragePath, "correction_processor_state.json")); err != nil {
+			logger.Warn("Failed to import correction state: %v", err)
+		}
+		processor.config.Repository = repo
+	}
 
 	// Load existing state
 	if err := processor.loadState(); err != nil {
@@ -638,67 +659,25 @@ func (cp *CorrectionProcessor) saveState() error {
 	cp.mutex.RLock()
 	defer cp.mutex.RUnlock()
 
-	state := struct {
-		Corrections   map[string]*CorrectionEntry `json:"corrections"`
-		LearningModel *LearningModel              `json:"learning_model"`
-		LastSaved     time.Time                   `json:"last_saved"`
-	}{
-		Corrections:   cp.corrections,
-		LearningModel: cp.learningModel,
-		LastSaved:     time.Now(),
-	}
-
-	data, err := json.MarshalIndent(state, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal state: %v", err)
-	}
-
-	statePath := filepath.Join(cp.config.StoragePath, "correction_processor_state.json")
-	tempPath := statePath + ".tmp"
-
-	if err := ioutil.WriteFile(tempPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write temp state file: %v", err)
-	}
-
-	if err := os.Rename(tempPath, statePath); err != nil {
-		return fmt.Errorf("failed to rename temp state file: %v", err)
-	}
-
-	return nil
+	return cp.config.Repository.SaveCorrections(cp.corrections, cp.learningModel)
 }
 
 func (cp *CorrectionProcessor) loadState() error {
-	statePath := filepath.Join(cp.config.StoragePath, "correction_processor_state.json")
-
-	data, err := ioutil.ReadFile(statePath)
+	corrections, model, err := cp.config.Repository.LoadCorrections()
 	if err != nil {
-		if os.IsNotExist(err) {
-			cp.logger.Info("No existing correction processor state found, starting fresh")
-			return nil
-		}
-		return fmt.Errorf("failed to read state file: %v", err)
-	}
-
-	var state struct {
-		Corrections   map[string]*CorrectionEntry `json:"corrections"`
-		LearningModel *LearningModel              `json:"learning_model"`
-		LastSaved     time.Time                   `json:"last_saved"`
-	}
-
-	if err := json.Unmarshal(data, &state); err != nil {
-		return fmt.Errorf("failed to unmarshal state: %v", err)
+		return err
 	}
 
-	cp.corrections = state.Corrections
+	cp.corrections = corrections
 	if cp.corrections == nil {
 		cp.corrections = make(map[string]*CorrectionEntry)
 	}
 
-	if state.LearningModel != nil {
-		cp.learningModel = state.LearningModel
+	if model != nil {
+		cp.learningModel = model
 	}
 
-	cp.logger.Info("Correction processor state loaded successfully (last saved: %v)", state.LastSaved)
+	cp.logger.Info("Correction processor state loaded (%d corrections)", len(cp.corrections))
 	return nil
 }
 
@@ -714,6 +693,13 @@ func (cp *CorrectionProcessor) Shutdown() error {
 		return err
 	}
 
+	if cp.ragLearning != nil {
+		if err := cp.ragLearning.Shutdown(); err != nil {
+			cp.logger.Error("Failed to shut down RAG learning: %v", err)
+			return err
+		}
+	}
+
 	cp.logger.Info("CorrectionProcessor shutdown complete")
 	return nil
 }
@@ -913,6 +899,7 @@ func NewRAGLearningEngine() *RAGLearningEngine {
 		vectorStore:    make(map[string][]float64),
 		contextWindow:  512,
 		embeddingCache: make(map[string][]float64),
+		embedder:       NewLocalEmbedder(64),
 		learningRate:   0.01,
 		mutex:          sync.RWMutex{},
 	}
@@ -1054,18 +1041,17 @@ func (rag *RAGLearningEngine) EnhanceProcessing(data map[string]interface{}, con
 }
 
 func (rag *RAGLearningEngine) generateSimpleEmbedding(correction *CorrectionEntry) []float64 {
-	// Simple embedding generation - in practice would use proper embedding model
-	text := fmt.Sprintf("%s %s %v %v", correction.CorrectionType, correction.FieldName,
-		correction.OriginalValue, correction.CorrectedValue)
-
-	// Create a simple hash-based embedding
-	hash := sha256.Sum256([]byte(text))
-	embedding := make([]float64, 64)
+	// Embed the corrected label so similarly named fields get similar vectors
+	if cached, exists := rag.embeddingCache[correction.FieldName]; exists {
+		return cached
+	}
 
-	for i := 0; i < 64; i++ {
-		embedding[i] = float64(hash[i%32]) / 255.0
+	embedding, err := embedOne(context.Background(), rag.embedder, correction.FieldName)
+	if err != nil {
+		return nil
 	}
 
+	rag.embeddingCache[correction.FieldName] = embedding
 	return embedding
 }
 
@@ -1175,6 +1161,27 @@ func (cp *CorrectionProcessor) GetSemanticInsights(query string, userProfile Use
 	return cp.ragLearning.advancedEngine.RetrieveRelevantKnowledge(query, context, 10)
 }
 
+// SuggestFieldMappings returns target mappings learned from corrections on
+// fields named like fieldName
+func (cp *CorrectionProcessor) SuggestFieldMappings(fieldName string, maxResults int) ([]LearningRecommendation, error) {
+	context := LearningContext{
+		ProcessingStage:     "mapping",
+		ConfidenceThreshold: 0.7,
+	}
+
+	return cp.ragLearning.advancedEngine.SuggestFieldMappings(fieldName, context, maxResults)
+}
+
+// SetEmbedder switches the embedding model used for correction retrieval
+func (cp *CorrectionProcessor) SetEmbedder(embedder Embedder) error {
+	return cp.ragLearning.advancedEngine.SetEmbedder(embedder)
+}
+
+// Embedder returns the embedding model used for correction retrieval
+func (cp *CorrectionProcessor) Embedder() Embedder {
+	return cp.ragLearning.advancedEngine.Embedder()
+}
+
 // UpdateUserLearningProfile updates a user's learning profile
 func (cp *CorrectionProcessor) UpdateUserLearningProfile(userID string, updates map[string]interface{}) error {
 	return cp.ragLearning.advancedEngine.UpdateUserLearningProfile(userID, updates)
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -483,9 +484,8 @@ func TestCorrectionProcessor_Persistence(t *testing.T) {
 	err = processor.saveState()
 	assert.NoError(t, err)
 
-	// Verify state file exists
-	statePath := filepath.Join(tempDir, "correction_processor_state.json")
-	assert.FileExists(t, statePath)
+	// Verify the state store was written
+	assert.FileExists(t, filepath.Join(tempDir, "state", "wal.log"))
 
 	// Shutdown processor
 	err = processor.Shutdown()
@@ -726,3 +726,126 @@ func correctionStringContains(s, substr string) bool {
 	}
 	return false
 }
+
+func TestCorrectionProcessor_SemanticMappingRetrieval(t *testing.T) {
+	processor, _, tempDir := createTestCorrectionProcessor(t)
+	defer os.RemoveAll(tempDir)
+
+	// A user fixes the mapping of "Net Revenue" on the first deal
+	correction := &CorrectionEntry{
+		DealID:         "deal_001",
+		FieldName:      "Net Revenue",
+		OriginalValue:  "other_income",
+		CorrectedValue: "revenue",
+		CorrectionType: FieldMappingCorrection,
+		UserID:         "user_001",
+	}
+	require.NoError(t, processor.DetectCorrection(correction))
+	require.NoError(t, processor.Shutdown())
+
+	// The index is on disk
+	_, err := os.Stat(filepath.Join(tempDir, "rag", "vector_index.json"))
+	require.NoError(t, err)
+
+	// The next deal uses a differently worded label
+	next := NewCorrectionProcessor(processor.config, &TestCorrectionLogger{})
+	defer next.Shutdown()
+
+	suggestions, err := next.SuggestFieldMappings("Total Net Sales", 3)
+	require.NoError(t, err)
+	require.Len(t, suggestions, 1)
+	assert.Equal(t, "revenue", suggestions[0].SuggestedValue)
+	assert.Equal(t, "field_mapping", suggestions[0].Type)
+	assert.Equal(t, "Net Revenue", suggestions[0].Context["source_field"])
+
+	insights, err := next.GetSemanticInsights("Total Net Sales", UserProfile{})
+	require.NoError(t, err)
+	require.NotEmpty(t, insights)
+	assert.Equal(t, "Net Revenue", insights[0].Node.Content["field_name"])
+	assert.Greater(t, insights[0].Similarity, 0.7)
+
+	// Unrelated labels do not pick up the correction
+	suggestions, err = next.SuggestFieldMappings("Purchase Price", 3)
+	require.NoError(t, err)
+	assert.Empty(t, suggestions)
+
+	enhancement, err := next.EnhanceDocumentWithLearning(map[string]interface{}{"Total Net Sales": 1250000.0}, UserProfile{})
+	require.NoError(t, err)
+	require.Len(t, enhancement.Recommendations, 1)
+	assert.Equal(t, "revenue", enhancement.Recommendations[0].SuggestedValue)
+	assert.Equal(t, 1250000.0, enhancement.EnhancedData["Total Net Sales"], "values are left untouched")
+}
+
+// blockingEmbedder holds each call until it is released
+type blockingEmbedder struct {
+	*LocalEmbedder
+	started chan struct{}
+	release chan struct{}
+}
+
+func (b *blockingEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	b.started <- struct{}{}
+	<-b.release
+	return b.LocalEmbedder.Embed(ctx, texts)
+}
+
+func TestCorrectionProcessor_EmbedsOutsideLock(t *testing.T) {
+	processor, _, tempDir := createTestCorrectionProcessor(t)
+	defer os.RemoveAll(tempDir)
+	defer processor.Shutdown()
+
+	engine := processor.ragLearning.advancedEngine
+	embedder := &blockingEmbedder{LocalEmbedder: NewLocalEmbedder(128), started: make(chan struct{}), release: make(chan struct{})}
+	require.NoError(t, engine.SetEmbedder(embedder))
+
+	correction := &CorrectionEntry{ID: "c1", FieldName: "Net Revenue", CorrectedValue: "revenue", CorrectionType: FieldMappingCorrection}
+	done := make(chan error, 1)
+	go func() {
+		_, err := engine.ProcessCorrectionWithRAG(correction, LearningContext{})
+		done <- err
+	}()
+
+	// A slow embedding request does not block the engine
+	<-embedder.started
+	require.True(t, engine.mutex.TryLock(), "the engine is locked while embedding")
+	engine.mutex.Unlock()
+
+	close(embedder.release)
+	require.NoError(t, <-done)
+	assert.Equal(t, 1, engine.vectorIndex.Len())
+}
+
+func TestConfigureEmbeddingsIsSaved(t *testing.T) {
+	processor, _, tempDir := createTestCorrectionProcessor(t)
+	defer os.RemoveAll(tempDir)
+	defer processor.Shutdown()
+
+	manager := &AIConfigManager{config: &AIConfig{OpenAIKey: "sk-test"}, configPath: filepath.Join(t.TempDir(), "ai_config.json")}
+	app := &App{aiConfigManager: manager, correctionProcessor: processor}
+
+	// The OpenAI key of the AI settings is used when none is given
+	require.NoError(t, app.ConfigureEmbeddings("openai", "", "text-embedding-3-large"))
+	remote, ok := processor.Embedder().(*HTTPEmbedder)
+	require.True(t, ok)
+	assert.Equal(t, "sk-test", remote.apiKey)
+
+	// The provider and model are saved, but not the key
+	require.NoError(t, app.ConfigureEmbeddings("voyage", "pa-secret", "voyage-3-lite"))
+	data, err := os.ReadFile(manager.configPath)
+	require.NoError(t, err)
+	assert.NotContains(t, string(data), "pa-secret")
+
+	// Startup restores the choice with the key from the environment
+	t.Setenv("VOYAGE_API_KEY", "pa-env")
+	reloaded := &AIConfigManager{configPath: manager.configPath}
+	require.NoError(t, reloaded.Load())
+	restarted := &App{aiConfigManager: reloaded}
+	saved, ok := restarted.savedEmbedder().(*HTTPEmbedder)
+	require.True(t, ok)
+	assert.Equal(t, "voyage:voyage-3-lite", saved.Name())
+	assert.Equal(t, "pa-env", saved.apiKey)
+
+	// Local-only deployments keep embedding locally
+	require.NoError(t, reloaded.SetLocalOnly(true))
+	assert.Nil(t, restarted.savedEmbedder())
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"regexp"
@@ -13,6 +14,7 @@ import (
 type DataMapper struct {
 	aiService      *AIService
 	templateParser *TemplateParser
+	tableExtractor *FinancialTableExtractor
 }
 
 // NewDataMapper creates a new data mapper
@@ -20,9 +22,15 @@ func NewDataMapper(aiService *AIService, templateParser *TemplateParser) *DataMa
 	return &DataMapper{
 		aiService:      aiService,
 		templateParser: templateParser,
+		tableExtractor: NewFinancialTableExtractor(nil),
 	}
 }
 
+// SetTableExtractor sets the extractor used to read financial statement tables
+func (dm *DataMapper) SetTableExtractor(extractor *FinancialTableExtractor) {
+	dm.tableExtractor = extractor
+}
+
 // MappedData represents data mapped to template fields
 type MappedData struct {
 	TemplateID  string                            `json:"templateId"`
@@ -38,7 +46,7 @@ type MappedData struct {
 // MappedField represents a single mapped field
 type MappedField struct {
 	FieldName    string      `json:"fieldName"`
-	Value        interface{} `json:"value"`
+	Value        interface{} `json:"value"` // A list field holds a slice of items, usually maps
 	Source       string      `json:"source"`
 	SourceType   string      `json:"sourceType"` // "ai", "ocr", "extracted", "calculated"
 	Confidence   float64     `json:"confidence"`
@@ -66,6 +74,14 @@ func (dm *DataMapper) ExtractAndMapData(templateData *TemplateData, documents []
 
 	// Create a data extraction context
 	extractionContext := dm.createExtractionContext(documents)
+	for _, field := range fields {
+		if field.DataType == "list" {
+			var warnings []string
+			extractionContext.Personnel, warnings = dm.extractPersonnelFromDocuments(documents, dealName)
+			mappedData.Warnings = append(mappedData.Warnings, warnings...)
+			break
+		}
+	}
 
 	// Map each field
 	totalConfidence := 0.0
@@ -103,7 +119,9 @@ type ExtractionContext struct {
 	AIAnalysis      map[string]interface{}
 	ExtractedText   map[string]string
 	FinancialData   *FinancialAnalysis
+	LineItems       []FinancialLineItem
 	Entities        *EntityExtraction
+	Personnel       *PersonnelRoleExtraction // Only extracted for templates with list fields
 	DocumentsByType map[string][]DocumentInfo
 }
 
@@ -123,6 +141,7 @@ func (dm *DataMapper) createExtractionContext(documents []DocumentInfo) *Extract
 
 	// Extract real financial data from documents
 	context.FinancialData = dm.extractFinancialDataFromDocuments(documents)
+	context.LineItems = context.FinancialData.LineItems
 
 	// Extract real entities from documents
 	context.Entities = dm.extractEntitiesFromDocuments(documents)
@@ -132,6 +151,11 @@ func (dm *DataMapper) createExtractionContext(documents []DocumentInfo) *Extract
 
 // extractFinancialDataFromDocuments extracts actual financial data from document content
 func (dm *DataMapper) extractFinancialDataFromDocuments(documents []DocumentInfo) *FinancialAnalysis {
+	// Prefer typed line items read from statement tables
+	if financial := dm.extractFinancialDataFromTables(documents); financial != nil {
+		return financial
+	}
+
 	financial := &FinancialAnalysis{
 		Currency:   "USD",
 		Confidence: 0.0,
@@ -145,8 +169,7 @@ func (dm *DataMapper) extractFinancialDataFromDocuments(documents []DocumentInfo
 			continue
 		}
 
-		// Extract text content from document name patterns for now
-		// In a real implementation, you would use DocumentProcessor.ExtractText()
+		// Fall back to document name keywords when no tables were found
 		content := strings.ToLower(doc.Name)
 
 		// Extract revenue (using document name keywords as fallback)
@@ -184,6 +207,129 @@ func (dm *DataMapper) extractFinancialDataFromDocuments(documents []DocumentInfo
 	return financial
 }
 
+// extractFinancialDataFromTables builds a FinancialAnalysis from statement
+// tables in the deal's financial documents. It returns nil if no recognized
+// line items were found.
+func (dm *DataMapper) extractFinancialDataFromTables(documents []DocumentInfo) *FinancialAnalysis {
+	if dm.tableExtractor == nil {
+		return nil
+	}
+
+	items := make([]FinancialLineItem, 0)
+	warnings := make([]string, 0)
+	for _, doc := range documents {
+		if doc.Type != DocTypeFinancial || doc.Path == "" {
+			continue
+		}
+		docItems, err := dm.tableExtractor.ExtractLineItems(doc.Path)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("Table extraction failed for %s: %v", doc.Name, err))
+			continue
+		}
+		items = append(items, docItems...)
+	}
+
+	latest := LatestLineItems(items)
+	if len(latest) == 0 {
+		return nil
+	}
+
+	financial := &FinancialAnalysis{
+		Currency:   "USD",
+		DataPoints: make(map[string]float64),
+		LineItems:  items,
+		Warnings:   warnings,
+	}
+
+	assign := map[string]*float64{
+		"revenue":             &financial.Revenue,
+		"ebitda":              &financial.EBITDA,
+		"net_income":          &financial.NetIncome,
+		"total_assets":        &financial.TotalAssets,
+		"total_liabilities":   &financial.TotalLiabilities,
+		"operating_cash_flow": &financial.CashFlow,
+		"gross_margin":        &financial.GrossMargin,
+	}
+	for canonical, item := range latest {
+		if target, ok := assign[canonical]; ok {
+			*target = item.Value
+		}
+		financial.DataPoints[canonical] = item.Value
+	}
+
+	if revenue, ok := latest["revenue"]; ok {
+		financial.Period = revenue.Period.Label
+		if revenue.Unit != "" && revenue.Unit != "%" && revenue.Unit != "x" {
+			financial.Currency = revenue.Unit
+		}
+		if financial.GrossMargin == 0 {
+			if grossProfit, ok := latest["gross_profit"]; ok && revenue.Value != 0 && grossProfit.Period.Label == revenue.Period.Label {
+				financial.GrossMargin = grossProfit.Value / revenue.Value * 100
+			}
+		}
+		if ebit, ok := latest["ebit"]; ok && revenue.Value != 0 && ebit.Period.Label == revenue.Period.Label {
+			financial.OperatingMargin = ebit.Value / revenue.Value * 100
+		}
+	}
+
+	// Period-tagged data points let templates ask for a specific year
+	conflicts := make(map[string]bool)
+	for _, item := range items {
+		if item.Canonical == "" {
+			continue
+		}
+		key := item.Canonical + "_" + strings.ToLower(strings.ReplaceAll(item.Period.Label, " ", ""))
+		if existing, ok := financial.DataPoints[key]; ok && existing != item.Value && !conflicts[key] {
+			conflicts[key] = true
+			financial.Warnings = append(financial.Warnings, fmt.Sprintf("Conflicting values for %s %s: %.2f vs %.2f (%s)",
+				item.Canonical, item.Period.Label, existing, item.Value, item.Source.Document))
+			continue
+		}
+		financial.DataPoints[key] = item.Value
+	}
+
+	// Spreadsheet cells are more reliable than text-layer tables
+	confidence := 0.8
+	for _, item := range latest {
+		if item.Source.Sheet == "" {
+			confidence = 0.75
+			break
+		}
+	}
+	if len(conflicts) > 0 {
+		confidence -= 0.1
+	}
+	financial.Confidence = confidence
+
+	return financial
+}
+
+// mapPeriodField maps fields that name a specific period ("Revenue FY2022")
+// to the matching line item
+func (dm *DataMapper) mapPeriodField(fieldName string, items []FinancialLineItem) (*FinancialLineItem, bool) {
+	labels := periodSearchPattern.FindAllString(fieldName, -1)
+	if len(labels) != 1 {
+		return nil, false
+	}
+	period, ok := parsePeriodLabel(labels[0])
+	if !ok {
+		return nil, false
+	}
+	name := strings.TrimSpace(periodSearchPattern.ReplaceAllString(fieldName, ""))
+	canonical := canonicalLineItem(name)
+	if canonical == "" {
+		return nil, false
+	}
+
+	for i := range items {
+		item := items[i]
+		if item.Canonical == canonical && item.Period.SortKey() == period.SortKey() && item.Period.Projected == period.Projected {
+			return &item, true
+		}
+	}
+	return nil, false
+}
+
 // extractEntitiesFromDocuments extracts actual entities from document content
 func (dm *DataMapper) extractEntitiesFromDocuments(documents []DocumentInfo) *EntityExtraction {
 	entities := &EntityExtraction{
@@ -228,9 +374,26 @@ func (dm *DataMapper) extractEntitiesFromDocuments(documents []DocumentInfo) *En
 
 // mapField maps a single field using available data sources
 func (dm *DataMapper) mapField(field DataField, context *ExtractionContext) (*MappedField, error) {
+	// Lists come from extracted people and never take a default
+	if field.DataType == "list" {
+		return dm.mapListField(field, context), nil
+	}
+
 	// Try different mapping strategies based on field type and name
 	fieldLower := strings.ToLower(field.Name)
 
+	// Strategy 0: Period-specific statement line items
+	if item, ok := dm.mapPeriodField(field.Name, context.LineItems); ok {
+		return &MappedField{
+			FieldName:    field.Name,
+			Value:        item.Value,
+			Source:       describeLineItemSource(item.Source),
+			SourceType:   "extracted",
+			Confidence:   0.85,
+			OriginalText: item.RawValue,
+		}, nil
+	}
+
 	// Strategy 1: Direct financial data mapping
 	if field.DataType == "number" || field.DataType == "currency" || strings.Contains(fieldLower, "revenue") || strings.Contains(fieldLower, "ebitda") || strings.Contains(fieldLower, "amount") {
 		if value, confidence := dm.mapFinancialField(field.Name, context.FinancialData); value != nil {
@@ -282,6 +445,140 @@ func (dm *DataMapper) mapField(field DataField, context *ExtractionContext) (*Ma
 	return nil, nil
 }
 
+// personnelListNames maps the list field names templates use for people to
+// the lists of PersonnelListFields. Personnel is the only list extraction
+// produces; other lists, such as customers, cap table holders and debt
+// tranches, are filled only from field mappings.
+var personnelListNames = map[string]string{
+	"management":      "management",
+	"management_team": "management",
+	"executives":      "management",
+	"leadership":      "management",
+	"leadership_team": "management",
+	"key_people":      "management",
+	"key_personnel":   "management",
+	"personnel":       "management",
+	"people":          "management",
+	"team":            "management",
+	"advisors":        "advisors",
+	"advisers":        "advisors",
+	"contacts":        "contacts",
+}
+
+// mapListField fills a list field of people from the personnel extracted
+// from the deal's documents
+func (dm *DataMapper) mapListField(field DataField, context *ExtractionContext) *MappedField {
+	list, ok := personnelListNames[canonicalFieldName(field.Name)]
+	if !ok || context.Personnel == nil {
+		return nil
+	}
+	items := PersonnelListFields(context.Personnel)[list]
+	if len(items) == 0 {
+		return nil
+	}
+	return &MappedField{
+		FieldName:  field.Name,
+		Value:      items,
+		Source:     "personnel_extraction",
+		SourceType: "ai",
+		Confidence: context.Personnel.Confidence,
+	}
+}
+
+// PersonnelListFields arranges extracted personnel as the list fields
+// templates repeat rows for: management (everyone but advisors), advisors
+// and contacts. Each item is keyed by name, title, company, role,
+// department, email and phone, or email, phone, address and company for
+// contacts.
+func PersonnelListFields(extraction *PersonnelRoleExtraction) map[string][]map[string]interface{} {
+	lists := map[string][]map[string]interface{}{
+		"management": {},
+		"advisors":   {},
+		"contacts":   {},
+	}
+	if extraction == nil {
+		return lists
+	}
+	for _, person := range extraction.Personnel {
+		list := "management"
+		if person.Role == "advisor" {
+			list = "advisors"
+		}
+		lists[list] = append(lists[list], map[string]interface{}{
+			"name":       person.Name,
+			"title":      person.Title,
+			"company":    person.Company,
+			"role":       person.Role,
+			"department": person.Department,
+			"email":      person.Contact.Email,
+			"phone":      person.Contact.Phone,
+		})
+	}
+	for _, contact := range extraction.Contacts {
+		lists["contacts"] = append(lists["contacts"], map[string]interface{}{
+			"email":   contact.Email,
+			"phone":   contact.Phone,
+			"address": contact.Address,
+			"company": contact.Company,
+		})
+	}
+	return lists
+}
+
+// extractPersonnelFromDocuments extracts the people named in the deal's
+// non-financial documents, merging people found in more than one. The
+// requests are billed to the deal and capped per document.
+func (dm *DataMapper) extractPersonnelFromDocuments(documents []DocumentInfo, dealName string) (*PersonnelRoleExtraction, []string) {
+	if dm.aiService == nil {
+		return nil, nil
+	}
+	ctx, cancel := context.WithTimeout(WithAIDeal(context.Background(), dealName), 2*time.Minute)
+	defer cancel()
+
+	merged := &PersonnelRoleExtraction{}
+	var warnings []string
+	seen := make(map[string]bool)
+	for _, doc := range documents {
+		if doc.Type == DocTypeFinancial || doc.Path == "" {
+			continue
+		}
+		text, err := extractNativeText(doc.Path)
+		if err != nil || !text.HasText() {
+			continue
+		}
+		extraction, err := dm.aiService.ExtractPersonnelAndRoles(WithAIDocument(ctx, doc.Path), text.Text(), string(doc.Type))
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("Personnel extraction failed for %s: %v", doc.Name, err))
+			continue
+		}
+		for _, person := range extraction.Personnel {
+			key := strings.ToLower(strings.TrimSpace(person.Name))
+			if key == "" || seen[key] {
+				continue
+			}
+			seen[key] = true
+			merged.Personnel = append(merged.Personnel, person)
+		}
+		merged.Contacts = append(merged.Contacts, extraction.Contacts...)
+		merged.Confidence = max(merged.Confidence, extraction.Confidence)
+	}
+	if len(merged.Personnel) == 0 && len(merged.Contacts) == 0 {
+		return nil, warnings
+	}
+	return merged, warnings
+}
+
+// describeLineItemSource formats a line item's provenance
+func describeLineItemSource(source LineItemSource) string {
+	switch {
+	case source.Sheet != "" && source.Cell != "":
+		return fmt.Sprintf("%s!%s!%s", source.Document, source.Sheet, source.Cell)
+	case source.Page > 0:
+		return fmt.Sprintf("%s (page %d)", source.Document, source.Page)
+	}
+	return source.Document
+}
+
 // mapSpecificField maps specific field names to appropriate values
 func (dm *DataMapper) mapSpecificField(fieldName string) (interface{}, float64) {
 	fieldLower := strings.ToLower(fieldName)
@@ -621,6 +918,8 @@ func (dm *DataMapper) isValidType(value interface{}, expectedType string) bool {
 		}
 	case "string":
 		return true // Everything can be a string
+	case "list":
+		return bindingListValues(value) != nil
 	}
 	return false
 }
@@ -0,0 +1,466 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+)
+
+// TerminalValueMethod selects how the DCF terminal value is calculated
+type TerminalValueMethod string
+
+const (
+	TerminalGordonGrowth TerminalValueMethod = "gordon"
+	TerminalExitMultiple TerminalValueMethod = "exit_multiple"
+)
+
+// defaultRevenueGrowth is used when no growth schedule is supplied
+var defaultRevenueGrowth = []float64{0.15, 0.12, 0.10, 0.08, 0.05}
+
+// Rates used when the assumptions leave them unset
+const (
+	defaultDCFTaxRate        = 0.25
+	defaultDCFTerminalGrowth = 0.03
+)
+
+// DCFAssumptions are the inputs to the discounted cash flow model. Schedules
+// hold one rate per projection year; a shorter schedule carries its last rate
+// forward. Percentages of revenue are expressed as fractions (0.05 = 5%).
+type DCFAssumptions struct {
+	ProjectionYears   int                 `json:"projectionYears"`
+	BaseRevenue       float64             `json:"baseRevenue,omitempty"` // Defaults to the target's revenue
+	RevenueGrowth     []float64           `json:"revenueGrowth,omitempty"`
+	EBITDAMargin      []float64           `json:"ebitdaMargin,omitempty"`
+	DAPercent         []float64           `json:"daPercentOfRevenue,omitempty"`
+	CapexPercent      []float64           `json:"capexPercentOfRevenue,omitempty"`
+	NWCPercent        []float64           `json:"nwcPercentOfRevenue,omitempty"` // Net working capital balance
+	TaxRate           *float64            `json:"taxRate,omitempty"`             // 25% when nil; zero is a valid rate
+	WACC              float64             `json:"wacc"`
+	MidYearConvention bool                `json:"midYearConvention"`
+	NetDebt           *float64            `json:"netDebt,omitempty"` // Estimated from the balance sheet when nil
+	TerminalMethod    TerminalValueMethod `json:"terminalMethod"`
+	TerminalGrowth    *float64            `json:"terminalGrowth,omitempty"` // 3% when nil; zero is a valid rate
+	ExitMultiple      float64             `json:"exitMultiple,omitempty"`   // EV / terminal-year EBITDA
+
+	// Sensitivity grid: SensitivitySteps values either side of the base case
+	SensitivitySteps      int     `json:"sensitivitySteps,omitempty"`
+	SensitivityWACCStep   float64 `json:"sensitivityWaccStep,omitempty"`
+	SensitivityGrowthStep float64 `json:"sensitivityGrowthStep,omitempty"`
+}
+
+// DCFProjectionYear is one year of the unlevered free cash flow build
+type DCFProjectionYear struct {
+	Year           int     `json:"year"`
+	Revenue        float64 `json:"revenue"`
+	EBITDA         float64 `json:"ebitda"`
+	DA             float64 `json:"depreciationAmortization"`
+	EBIT           float64 `json:"ebit"`
+	Taxes          float64 `json:"taxes"`
+	Capex          float64 `json:"capex"`
+	NWCChange      float64 `json:"nwcChange"`
+	FreeCashFlow   float64 `json:"freeCashFlow"`
+	DiscountPeriod float64 `json:"discountPeriod"`
+	PresentValue   float64 `json:"presentValue"`
+}
+
+// DCFSensitivity is a grid of values across WACC (rows) and terminal growth
+// or exit multiple (columns). Cells where the model is undefined are zero.
+type DCFSensitivity struct {
+	ColumnMetric     string      `json:"columnMetric"` // "terminalGrowth" or "exitMultiple"
+	WACCValues       []float64   `json:"waccValues"`
+	ColumnValues     []float64   `json:"columnValues"`
+	EnterpriseValues [][]float64 `json:"enterpriseValues"`
+	EquityValues     [][]float64 `json:"equityValues"`
+}
+
+// DefaultDCFAssumptions returns the assumptions used when none are given,
+// with operating ratios taken from the target's financials where possible
+func DefaultDCFAssumptions(financial *FinancialAnalysis) DCFAssumptions {
+	taxRate, terminalGrowth := defaultDCFTaxRate, defaultDCFTerminalGrowth
+	assumptions := DCFAssumptions{
+		ProjectionYears: len(defaultRevenueGrowth),
+		RevenueGrowth:   append([]float64(nil), defaultRevenueGrowth...),
+		DAPercent:       []float64{0.03},
+		CapexPercent:    []float64{0.03},
+		NWCPercent:      []float64{0.10},
+		TaxRate:         &taxRate,
+		WACC:            0.10,
+		TerminalMethod:  TerminalGordonGrowth,
+		TerminalGrowth:  &terminalGrowth,
+	}
+	if financial != nil && financial.Revenue > 0 {
+		assumptions.EBITDAMargin = []float64{financial.EBITDA / financial.Revenue}
+	}
+	return assumptions
+}
+
+// dcfAssumptionsFromMarketData starts from the defaults and applies a
+// "dcfAssumptions" entry plus the legacy wacc, terminalGrowth, taxRate,
+// netDebt and exitMultiple keys
+func dcfAssumptionsFromMarketData(financial *FinancialAnalysis, marketData map[string]interface{}) (DCFAssumptions, error) {
+	assumptions := DefaultDCFAssumptions(financial)
+
+	switch raw := marketData["dcfAssumptions"].(type) {
+	case nil:
+	case DCFAssumptions:
+		assumptions = mergeDCFAssumptions(assumptions, raw)
+	case *DCFAssumptions:
+		if raw != nil {
+			assumptions = mergeDCFAssumptions(assumptions, *raw)
+		}
+	default:
+		data, err := json.Marshal(raw)
+		if err != nil {
+			return assumptions, fmt.Errorf("invalid dcfAssumptions: %w", err)
+		}
+		var parsed DCFAssumptions
+		if err := json.Unmarshal(data, &parsed); err != nil {
+			return assumptions, fmt.Errorf("invalid dcfAssumptions: %w", err)
+		}
+		assumptions = mergeDCFAssumptions(assumptions, parsed)
+	}
+
+	if w, ok := marketData["wacc"].(float64); ok {
+		assumptions.WACC = w
+	}
+	if g, ok := marketData["terminalGrowth"].(float64); ok {
+		assumptions.TerminalGrowth = &g
+	}
+	if t, ok := marketData["taxRate"].(float64); ok {
+		assumptions.TaxRate = &t
+	}
+	if d, ok := marketData["netDebt"].(float64); ok {
+		assumptions.NetDebt = &d
+	}
+	if m, ok := marketData["exitMultiple"].(float64); ok && m > 0 {
+		assumptions.ExitMultiple = m
+		assumptions.TerminalMethod = TerminalExitMultiple
+	}
+	return assumptions, nil
+}
+
+// mergeDCFAssumptions overlays the non-zero fields of override on base. The
+// tax rate, terminal growth and net debt override base whenever they are set,
+// including to zero.
+func mergeDCFAssumptions(base, override DCFAssumptions) DCFAssumptions {
+	if override.ProjectionYears > 0 {
+		base.ProjectionYears = override.ProjectionYears
+	}
+	if override.BaseRevenue > 0 {
+		base.BaseRevenue = override.BaseRevenue
+	}
+	if len(override.RevenueGrowth) > 0 {
+		base.RevenueGrowth = override.RevenueGrowth
+	}
+	if len(override.EBITDAMargin) > 0 {
+		base.EBITDAMargin = override.EBITDAMargin
+	}
+	if len(override.DAPercent) > 0 {
+		base.DAPercent = override.DAPercent
+	}
+	if len(override.CapexPercent) > 0 {
+		base.CapexPercent = override.CapexPercent
+	}
+	if len(override.NWCPercent) > 0 {
+		base.NWCPercent = override.NWCPercent
+	}
+	if override.TaxRate != nil {
+		base.TaxRate = override.TaxRate
+	}
+	if override.WACC > 0 {
+		base.WACC = override.WACC
+	}
+	if override.MidYearConvention {
+		base.MidYearConvention = true
+	}
+	if override.NetDebt != nil {
+		base.NetDebt = override.NetDebt
+	}
+	if override.TerminalMethod != "" {
+		base.TerminalMethod = override.TerminalMethod
+	}
+	if override.TerminalGrowth != nil {
+		base.TerminalGrowth = override.TerminalGrowth
+	}
+	if override.ExitMultiple > 0 {
+		base.ExitMultiple = override.ExitMultiple
+	}
+	if override.SensitivitySteps > 0 {
+		base.SensitivitySteps = override.SensitivitySteps
+	}
+	if override.SensitivityWACCStep > 0 {
+		base.SensitivityWACCStep = override.SensitivityWACCStep
+	}
+	if override.SensitivityGrowthStep > 0 {
+		base.SensitivityGrowthStep = override.SensitivityGrowthStep
+	}
+	return base
+}
+
+// taxRate returns TaxRate, or the default when it is unset
+func (a DCFAssumptions) taxRate() float64 {
+	if a.TaxRate == nil {
+		return defaultDCFTaxRate
+	}
+	return *a.TaxRate
+}
+
+// terminalGrowth returns TerminalGrowth, or the default when it is unset
+func (a DCFAssumptions) terminalGrowth() float64 {
+	if a.TerminalGrowth == nil {
+		return defaultDCFTerminalGrowth
+	}
+	return *a.TerminalGrowth
+}
+
+// Validate checks that the assumptions describe a solvable model
+func (a DCFAssumptions) Validate() error {
+	if a.ProjectionYears < 1 || a.ProjectionYears > 30 {
+		return fmt.Errorf("projection horizon must be between 1 and 30 years, got %d", a.ProjectionYears)
+	}
+	if a.WACC <= 0 || a.WACC >= 1 {
+		return fmt.Errorf("WACC must be between 0%% and 100%%, got %.2f%%", a.WACC*100)
+	}
+	if taxRate := a.taxRate(); taxRate < 0 || taxRate >= 1 {
+		return fmt.Errorf("tax rate must be between 0%% and 100%%, got %.2f%%", taxRate*100)
+	}
+	switch a.TerminalMethod {
+	case TerminalGordonGrowth:
+		if growth := a.terminalGrowth(); growth >= a.WACC {
+			return fmt.Errorf("terminal growth (%.2f%%) must be below WACC (%.2f%%)", growth*100, a.WACC*100)
+		}
+	case TerminalExitMultiple:
+		if a.ExitMultiple <= 0 {
+			return fmt.Errorf("exit multiple terminal value requires a positive exit multiple")
+		}
+	default:
+		return fmt.Errorf("unknown terminal value method: %s", a.TerminalMethod)
+	}
+	if len(a.EBITDAMargin) == 0 {
+		return fmt.Errorf("EBITDA margin schedule is required")
+	}
+	return nil
+}
+
+// scheduleValue returns the rate for a zero-based projection year
+func scheduleValue(schedule []float64, year int) float64 {
+	if len(schedule) == 0 {
+		return 0
+	}
+	if year >= len(schedule) {
+		return schedule[len(schedule)-1]
+	}
+	return schedule[year]
+}
+
+// dcfModel is a solved projection, reusable across discount rates
+type dcfModel struct {
+	assumptions DCFAssumptions
+	years       []DCFProjectionYear
+	netDebt     float64
+}
+
+// buildDCFModel projects unlevered free cash flow:
+// FCF = EBIT x (1 - tax) + D&A - capex - increase in NWC
+func buildDCFModel(assumptions DCFAssumptions, netDebt float64) *dcfModel {
+	model := &dcfModel{assumptions: assumptions, netDebt: netDebt}
+
+	revenue := assumptions.BaseRevenue
+	nwc := revenue * scheduleValue(assumptions.NWCPercent, 0)
+	for i := 0; i < assumptions.ProjectionYears; i++ {
+		revenue *= 1 + scheduleValue(assumptions.RevenueGrowth, i)
+
+		year := DCFProjectionYear{Year: i + 1, Revenue: revenue}
+		year.EBITDA = revenue * scheduleValue(assumptions.EBITDAMargin, i)
+		year.DA = revenue * scheduleValue(assumptions.DAPercent, i)
+		year.EBIT = year.EBITDA - year.DA
+		year.Taxes = math.Max(year.EBIT, 0) * assumptions.taxRate()
+		year.Capex = revenue * scheduleValue(assumptions.CapexPercent, i)
+
+		newNWC := revenue * scheduleValue(assumptions.NWCPercent, i)
+		year.NWCChange = newNWC - nwc
+		nwc = newNWC
+
+		year.FreeCashFlow = year.EBIT - year.Taxes + year.DA - year.Capex - year.NWCChange
+		year.DiscountPeriod = float64(i + 1)
+		if assumptions.MidYearConvention {
+			year.DiscountPeriod -= 0.5
+		}
+		model.years = append(model.years, year)
+	}
+	return model
+}
+
+// value discounts the projection at wacc with the given terminal growth or
+// exit multiple, returning the enterprise value, terminal value and the
+// present value of each year. ok is false when the model is undefined.
+func (m *dcfModel) value(wacc, terminal float64) (enterpriseValue, terminalValue float64, presentValues []float64, ok bool) {
+	last := m.years[len(m.years)-1]
+
+	switch m.assumptions.TerminalMethod {
+	case TerminalExitMultiple:
+		terminalValue = last.EBITDA * terminal
+	default:
+		if wacc <= terminal {
+			return 0, 0, nil, false
+		}
+		terminalValue = last.FreeCashFlow * (1 + terminal) / (wacc - terminal)
+	}
+
+	presentValues = make([]float64, len(m.years))
+	for i, year := range m.years {
+		presentValues[i] = year.FreeCashFlow / math.Pow(1+wacc, year.DiscountPeriod)
+		enterpriseValue += presentValues[i]
+	}
+	// The terminal value is as at the end of the final projection year
+	enterpriseValue += terminalValue / math.Pow(1+wacc, float64(len(m.years)))
+	return enterpriseValue, terminalValue, presentValues, true
+}
+
+// sensitivity evaluates the model across a grid centred on the base case
+func (m *dcfModel) sensitivity() *DCFSensitivity {
+	a := m.assumptions
+	steps := a.SensitivitySteps
+	if steps <= 0 {
+		steps = 2
+	}
+	waccStep := a.SensitivityWACCStep
+	if waccStep <= 0 {
+		waccStep = 0.01
+	}
+
+	grid := &DCFSensitivity{ColumnMetric: "terminalGrowth"}
+	base, columnStep := a.terminalGrowth(), a.SensitivityGrowthStep
+	if columnStep <= 0 {
+		columnStep = 0.005
+	}
+	if a.TerminalMethod == TerminalExitMultiple {
+		grid.ColumnMetric = "exitMultiple"
+		base, columnStep = a.ExitMultiple, 1.0
+	}
+
+	for i := -steps; i <= steps; i++ {
+		if wacc := a.WACC + float64(i)*waccStep; wacc > 0 {
+			grid.WACCValues = append(grid.WACCValues, roundTo(wacc, 6))
+		}
+		if column := base + float64(i)*columnStep; a.TerminalMethod != TerminalExitMultiple || column > 0 {
+			grid.ColumnValues = append(grid.ColumnValues, roundTo(column, 6))
+		}
+	}
+
+	for _, wacc := range grid.WACCValues {
+		evRow := make([]float64, len(grid.ColumnValues))
+		equityRow := make([]float64, len(grid.ColumnValues))
+		for j, column := range grid.ColumnValues {
+			if ev, _, _, ok := m.value(wacc, column); ok {
+				evRow[j] = ev
+				equityRow[j] = ev - m.netDebt
+			}
+		}
+		grid.EnterpriseValues = append(grid.EnterpriseValues, evRow)
+		grid.EquityValues = append(grid.EquityValues, equityRow)
+	}
+	return grid
+}
+
+// roundTo rounds away floating point noise from grid axis values
+func roundTo(value float64, places int) float64 {
+	scale := math.Pow(10, float64(places))
+	return math.Round(value*scale) / scale
+}
+
+// estimateNetDebt uses reported debt and cash when available, falling back
+// to 60% of total liabilities
+func estimateNetDebt(financial *FinancialAnalysis) (float64, string) {
+	if financial == nil {
+		return 0, "none"
+	}
+	if debt, ok := financial.DataPoints["total_debt"]; ok {
+		return debt - financial.DataPoints["cash"], "reported"
+	}
+	return financial.TotalLiabilities * 0.6, "estimated"
+}
+
+// CalculateDCF runs the DCF model for the given assumptions
+func (dvc *DealValuationCalculator) CalculateDCF(financial *FinancialAnalysis, assumptions DCFAssumptions) (*DCFResult, error) {
+	if financial == nil {
+		return nil, fmt.Errorf("financial data is required")
+	}
+	if assumptions.BaseRevenue == 0 {
+		assumptions.BaseRevenue = financial.Revenue
+	}
+	if assumptions.BaseRevenue <= 0 {
+		return nil, fmt.Errorf("DCF requires base revenue")
+	}
+	if err := assumptions.Validate(); err != nil {
+		return nil, err
+	}
+
+	netDebtSource := "assumption"
+	var netDebt float64
+	if assumptions.NetDebt != nil {
+		netDebt = *assumptions.NetDebt
+	} else {
+		netDebt, netDebtSource = estimateNetDebt(financial)
+	}
+
+	model := buildDCFModel(assumptions, netDebt)
+	terminal := assumptions.terminalGrowth()
+	if assumptions.TerminalMethod == TerminalExitMultiple {
+		terminal = assumptions.ExitMultiple
+	}
+	enterpriseValue, terminalValue, presentValues, _ := model.value(assumptions.WACC, terminal)
+
+	dcf := &DCFResult{
+		EnterpriseValue: enterpriseValue,
+		EquityValue:     enterpriseValue - netDebt,
+		TerminalValue:   terminalValue,
+		WACC:            assumptions.WACC,
+		GrowthRate:      assumptions.terminalGrowth(),
+		ProjectedCF:     make([]float64, len(model.years)),
+		PresentValues:   presentValues,
+		Assumptions:     make(map[string]float64),
+		TerminalMethod:  assumptions.TerminalMethod,
+		NetDebt:         netDebt,
+		NetDebtSource:   netDebtSource,
+		Projections:     model.years,
+		Sensitivity:     model.sensitivity(),
+		Inputs:          &assumptions,
+	}
+	for i, year := range model.years {
+		dcf.ProjectedCF[i] = year.FreeCashFlow
+		dcf.Projections[i].PresentValue = presentValues[i]
+	}
+	if assumptions.TerminalMethod == TerminalExitMultiple {
+		dcf.ExitMultiple = assumptions.ExitMultiple
+	}
+
+	// Store assumptions
+	dcf.Assumptions["baseRevenue"] = assumptions.BaseRevenue
+	dcf.Assumptions["avgGrowthRate"] = calculateMean(assumptionSchedule(assumptions.RevenueGrowth, assumptions.ProjectionYears))
+	dcf.Assumptions["taxRate"] = assumptions.taxRate()
+	dcf.Assumptions["netDebt"] = netDebt
+	if enterpriseValue != 0 {
+		dcf.Assumptions["terminalValueShare"] = (enterpriseValue - sumValues(presentValues)) / enterpriseValue
+	}
+
+	return dcf, nil
+}
+
+// assumptionSchedule expands a schedule to one rate per projection year
+func assumptionSchedule(schedule []float64, years int) []float64 {
+	expanded := make([]float64, years)
+	for i := range expanded {
+		expanded[i] = scheduleValue(schedule, i)
+	}
+	return expanded
+}
+
+// sumValues adds a slice of values
+func sumValues(values []float64) float64 {
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
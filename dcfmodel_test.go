@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// simpleDCFAssumptions has no taxes, reinvestment or working capital so
+// free cash flow equals EBITDA and values can be checked by hand
+func simpleDCFAssumptions() DCFAssumptions {
+	netDebt, taxRate, terminalGrowth := 40.0, 0.0, 0.0
+	return DCFAssumptions{
+		ProjectionYears: 2,
+		BaseRevenue:     100,
+		RevenueGrowth:   []float64{0.10},
+		EBITDAMargin:    []float64{0.20},
+		DAPercent:       []float64{0},
+		CapexPercent:    []float64{0},
+		NWCPercent:      []float64{0},
+		TaxRate:         &taxRate,
+		WACC:            0.10,
+		TerminalMethod:  TerminalGordonGrowth,
+		TerminalGrowth:  &terminalGrowth,
+		NetDebt:         &netDebt,
+	}
+}
+
+func TestCalculateDCFWithAssumptions(t *testing.T) {
+	calc := NewDealValuationCalculator(nil)
+	financial := &FinancialAnalysis{Revenue: 100, EBITDA: 20}
+
+	dcf, err := calc.CalculateDCF(financial, simpleDCFAssumptions())
+	require.NoError(t, err)
+
+	// FCF 22 and 24.2 discount to 20 each; TV 242 discounts to 200
+	require.Len(t, dcf.Projections, 2)
+	assert.InDelta(t, 22.0, dcf.Projections[0].FreeCashFlow, 1e-9)
+	assert.InDelta(t, 24.2, dcf.Projections[1].FreeCashFlow, 1e-9)
+	assert.InDelta(t, 20.0, dcf.Projections[1].PresentValue, 1e-9)
+	assert.InDelta(t, 242.0, dcf.TerminalValue, 1e-9)
+	assert.InDelta(t, 240.0, dcf.EnterpriseValue, 1e-9)
+	assert.InDelta(t, 200.0, dcf.EquityValue, 1e-9)
+	assert.Equal(t, "assumption", dcf.NetDebtSource)
+
+	// An exit multiple of 10x terminal EBITDA gives the same terminal value
+	exit := simpleDCFAssumptions()
+	exit.TerminalMethod = TerminalExitMultiple
+	exit.ExitMultiple = 10
+	exitDCF, err := calc.CalculateDCF(financial, exit)
+	require.NoError(t, err)
+	assert.InDelta(t, 240.0, exitDCF.EnterpriseValue, 1e-9)
+	assert.Equal(t, "exitMultiple", exitDCF.Sensitivity.ColumnMetric)
+
+	// Mid-year discounting pulls cash flows forward half a year
+	midYear := simpleDCFAssumptions()
+	midYear.MidYearConvention = true
+	midYearDCF, err := calc.CalculateDCF(financial, midYear)
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, midYearDCF.Projections[0].DiscountPeriod)
+	assert.Greater(t, midYearDCF.EnterpriseValue, dcf.EnterpriseValue)
+}
+
+func TestDCFCashFlowBuild(t *testing.T) {
+	calc := NewDealValuationCalculator(nil)
+	assumptions := simpleDCFAssumptions()
+	assumptions.ProjectionYears = 1
+	assumptions.DAPercent = []float64{0.05}
+	assumptions.CapexPercent = []float64{0.08}
+	assumptions.NWCPercent = []float64{0.10}
+	taxRate := 0.25
+	assumptions.TaxRate = &taxRate
+
+	dcf, err := calc.CalculateDCF(&FinancialAnalysis{Revenue: 100}, assumptions)
+	require.NoError(t, err)
+
+	year := dcf.Projections[0]
+	assert.InDelta(t, 110.0, year.Revenue, 1e-9)
+	assert.InDelta(t, 16.5, year.EBIT, 1e-9)     // 22 EBITDA - 5.5 D&A
+	assert.InDelta(t, 4.125, year.Taxes, 1e-9)   // 25% of EBIT
+	assert.InDelta(t, 1.0, year.NWCChange, 1e-9) // 11 - 10
+	assert.InDelta(t, 8.8, year.Capex, 1e-9)     // 8% of revenue
+	assert.InDelta(t, 8.075, year.FreeCashFlow, 1e-9)
+}
+
+func TestDCFSensitivityGrid(t *testing.T) {
+	calc := NewDealValuationCalculator(nil)
+	assumptions := simpleDCFAssumptions()
+	terminalGrowth := 0.02
+	assumptions.TerminalGrowth = &terminalGrowth
+	assumptions.WACC = 0.03
+	assumptions.SensitivityGrowthStep = 0.01
+
+	dcf, err := calc.CalculateDCF(&FinancialAnalysis{Revenue: 100}, assumptions)
+	require.NoError(t, err)
+
+	grid := dcf.Sensitivity
+	require.NotNil(t, grid)
+	assert.Equal(t, "terminalGrowth", grid.ColumnMetric)
+	assert.Equal(t, []float64{0.01, 0.02, 0.03, 0.04, 0.05}, grid.WACCValues)
+	assert.Equal(t, []float64{0, 0.01, 0.02, 0.03, 0.04}, grid.ColumnValues)
+	require.Len(t, grid.EnterpriseValues, 5)
+
+	// The centre cell is the base case
+	assert.InDelta(t, dcf.EnterpriseValue, grid.EnterpriseValues[2][2], 1e-6)
+	assert.InDelta(t, dcf.EquityValue, grid.EquityValues[2][2], 1e-6)
+	// Growth at or above WACC is undefined
+	assert.Zero(t, grid.EnterpriseValues[0][1])
+	// Higher WACC lowers value
+	assert.Greater(t, grid.EnterpriseValues[3][0], grid.EnterpriseValues[4][0])
+}
+
+func TestDCFAssumptionsValidation(t *testing.T) {
+	calc := NewDealValuationCalculator(nil)
+	financial := &FinancialAnalysis{Revenue: 100, EBITDA: 20}
+
+	invalid := simpleDCFAssumptions()
+	terminalGrowth := 0.12
+	invalid.TerminalGrowth = &terminalGrowth
+	_, err := calc.CalculateDCF(financial, invalid)
+	assert.ErrorContains(t, err, "terminal growth")
+
+	invalid = simpleDCFAssumptions()
+	invalid.TerminalMethod = TerminalExitMultiple
+	_, err = calc.CalculateDCF(financial, invalid)
+	assert.ErrorContains(t, err, "exit multiple")
+
+	invalid = simpleDCFAssumptions()
+	invalid.ProjectionYears = 0
+	_, err = calc.CalculateDCF(financial, invalid)
+	assert.Error(t, err)
+
+	_, err = calc.CalculateDCF(&FinancialAnalysis{}, DefaultDCFAssumptions(nil))
+	assert.ErrorContains(t, err, "base revenue")
+}
+
+func TestDCFAssumptionsFromMarketData(t *testing.T) {
+	financial := &FinancialAnalysis{
+		Revenue:          10000000,
+		EBITDA:           2000000,
+		TotalLiabilities: 5000000,
+		DataPoints:       map[string]float64{"total_debt": 3000000.0, "cash": 1000000.0},
+	}
+	marketData := map[string]interface{}{
+		"wacc": 0.09,
+		"dcfAssumptions": map[string]interface{}{
+			"projectionYears":   7,
+			"revenueGrowth":     []interface{}{0.2, 0.1},
+			"midYearConvention": true,
+		},
+	}
+
+	assumptions, err := dcfAssumptionsFromMarketData(financial, marketData)
+	require.NoError(t, err)
+	assert.Equal(t, 7, assumptions.ProjectionYears)
+	assert.Equal(t, []float64{0.2, 0.1}, assumptions.RevenueGrowth)
+	assert.True(t, assumptions.MidYearConvention)
+	assert.Equal(t, 0.09, assumptions.WACC)
+	assert.Equal(t, []float64{0.2}, assumptions.EBITDAMargin)
+
+	dcf, err := NewDealValuationCalculator(nil).calculateDCF(financial, marketData)
+	require.NoError(t, err)
+	assert.Len(t, dcf.ProjectedCF, 7)
+	assert.Equal(t, 2000000.0, dcf.NetDebt, "reported debt less cash")
+	assert.Equal(t, "reported", dcf.NetDebtSource)
+}
+
+func TestDCFAssumptionsZeroOverrides(t *testing.T) {
+	financial := &FinancialAnalysis{Revenue: 100, EBITDA: 20}
+
+	// Explicit zeros replace the defaults; omitted rates keep them
+	assumptions, err := dcfAssumptionsFromMarketData(financial, map[string]interface{}{
+		"dcfAssumptions": map[string]interface{}{"taxRate": 0.0, "terminalGrowth": 0.0},
+	})
+	require.NoError(t, err)
+	require.NotNil(t, assumptions.TaxRate)
+	require.NotNil(t, assumptions.TerminalGrowth)
+	assert.Equal(t, 0.0, *assumptions.TaxRate)
+	assert.Equal(t, 0.0, *assumptions.TerminalGrowth)
+
+	assumptions, err = dcfAssumptionsFromMarketData(financial, map[string]interface{}{
+		"dcfAssumptions": map[string]interface{}{"projectionYears": 3},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 0.25, *assumptions.TaxRate)
+	assert.Equal(t, 0.03, *assumptions.TerminalGrowth)
+
+	// A tax-free model pays no taxes
+	zero := 0.0
+	merged := mergeDCFAssumptions(DefaultDCFAssumptions(financial), DCFAssumptions{TaxRate: &zero})
+	dcf, err := NewDealValuationCalculator(nil).CalculateDCF(financial, merged)
+	require.NoError(t, err)
+	assert.Zero(t, dcf.Projections[0].Taxes)
+	assert.Zero(t, dcf.Assumptions["taxRate"])
+	assert.Equal(t, 0.03, dcf.GrowthRate)
+}
+
+func TestValuationExportIncludesSensitivity(t *testing.T) {
+	calc := NewDealValuationCalculator(nil)
+	financial := &FinancialAnalysis{Revenue: 20000000, EBITDA: 4000000, TotalLiabilities: 5000000}
+
+	result, err := calc.CalculateValuation("Export Deal", financial, map[string]interface{}{"wacc": 0.11})
+	require.NoError(t, err)
+	require.NotNil(t, result.DCFValuation)
+
+	report := calc.GenerateValuationReport(result)
+	assert.Contains(t, report, "Enterprise Value Sensitivity ($M):")
+	assert.Contains(t, report, "g=3.0%")
+	assert.Contains(t, report, "11.0%")
+
+	path := filepath.Join(t.TempDir(), "exports", "valuation.csv")
+	app := &App{}
+	require.NoError(t, app.ExportValuationToCSV(result, path))
+
+	file, err := os.Open(path)
+	require.NoError(t, err)
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	rows, err := reader.ReadAll()
+	require.NoError(t, err)
+
+	var sensitivityHeader []string
+	for _, row := range rows {
+		if len(row) > 0 && strings.HasPrefix(row[0], "Enterprise Value Sensitivity") {
+			sensitivityHeader = row
+		}
+	}
+	require.NotNil(t, sensitivityHeader)
+	assert.Len(t, sensitivityHeader, 6)
+	assert.Equal(t, "0.0300", sensitivityHeader[3])
+
+	assert.Equal(t, []string{"Summary", "Deal", "Export Deal"}, rows[1])
+	assert.Equal(t, time.Now().Format("2006-01-02"), rows[2][2])
+}
@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"math"
+	"strconv"
 	"time"
 )
 
@@ -10,6 +11,7 @@ import (
 type DealValuationCalculator struct {
 	aiService      *AIService
 	financialCache map[string]*FinancialAnalysis
+	comparables    *ComparablesStore
 }
 
 // NewDealValuationCalculator creates a new deal valuation calculator
@@ -20,6 +22,12 @@ func NewDealValuationCalculator(aiService *AIService) *DealValuationCalculator {
 	}
 }
 
+// SetComparablesStore sets the dataset peers are selected from when the
+// market data does not list comparables
+func (dvc *DealValuationCalculator) SetComparablesStore(store *ComparablesStore) {
+	dvc.comparables = store
+}
+
 // ValuationResult contains the results of various valuation methods
 type ValuationResult struct {
 	DealName      string                 `json:"dealName"`
@@ -36,14 +44,21 @@ type ValuationResult struct {
 
 // DCFResult contains discounted cash flow analysis results
 type DCFResult struct {
-	EnterpriseValue float64            `json:"enterpriseValue"`
-	EquityValue     float64            `json:"equityValue"`
-	TerminalValue   float64            `json:"terminalValue"`
-	WACC            float64            `json:"wacc"`
-	GrowthRate      float64            `json:"growthRate"`
-	ProjectedCF     []float64          `json:"projectedCashFlows"`
-	PresentValues   []float64          `json:"presentValues"`
-	Assumptions     map[string]float64 `json:"assumptions"`
+	EnterpriseValue float64             `json:"enterpriseValue"`
+	EquityValue     float64             `json:"equityValue"`
+	TerminalValue   float64             `json:"terminalValue"`
+	WACC            float64             `json:"wacc"`
+	GrowthRate      float64             `json:"growthRate"`
+	ProjectedCF     []float64           `json:"projectedCashFlows"`
+	PresentValues   []float64           `json:"presentValues"`
+	Assumptions     map[string]float64  `json:"assumptions"`
+	TerminalMethod  TerminalValueMethod `json:"terminalMethod,omitempty"`
+	ExitMultiple    float64             `json:"exitMultiple,omitempty"`
+	NetDebt         float64             `json:"netDebt"`
+	NetDebtSource   string              `json:"netDebtSource,omitempty"` // "assumption", "reported" or "estimated"
+	Projections     []DCFProjectionYear `json:"projections,omitempty"`
+	Sensitivity     *DCFSensitivity     `json:"sensitivity,omitempty"`
+	Inputs          *DCFAssumptions     `json:"inputs,omitempty"`
 }
 
 // MultiplesValuation contains valuation based on financial multiples
@@ -68,17 +83,24 @@ type ComparableAnalysis struct {
 	MedianMultiple      float64             `json:"medianMultiple"`
 	ImpliedValue        float64             `json:"impliedValue"`
 	Adjustments         map[string]float64  `json:"adjustments"`
+	Source              string              `json:"source"` // "marketData", "comparablesStore" or "" when none found
+	OutliersExcluded    int                 `json:"outliersExcluded"`
 }
 
 // ComparableCompany represents a comparable company
 type ComparableCompany struct {
-	Name       string  `json:"name"`
-	Ticker     string  `json:"ticker,omitempty"`
-	EVMultiple float64 `json:"evMultiple"`
-	Revenue    float64 `json:"revenue"`
-	EBITDA     float64 `json:"ebitda"`
-	MarketCap  float64 `json:"marketCap"`
-	Similarity float64 `json:"similarityScore"`
+	Name            string    `json:"name"`
+	Ticker          string    `json:"ticker,omitempty"`
+	EVMultiple      float64   `json:"evMultiple"`
+	Revenue         float64   `json:"revenue"`
+	EBITDA          float64   `json:"ebitda"`
+	MarketCap       float64   `json:"marketCap"`
+	Similarity      float64   `json:"similarityScore"`
+	Industry        string    `json:"industry,omitempty"`
+	Geography       string    `json:"geography,omitempty"`
+	AsOfDate        time.Time `json:"asOfDate,omitempty"`
+	Excluded        bool      `json:"excluded,omitempty"` // Trimmed as an outlier
+	ExclusionReason string    `json:"exclusionReason,omitempty"`
 }
 
 // AssetBasedValuation contains asset-based valuation
@@ -131,6 +153,9 @@ func (dvc *DealValuationCalculator) CalculateValuation(dealName string, financia
 	// Perform comparable analysis
 	comps := dvc.performComparableAnalysis(financialData, marketData)
 	result.Comps = comps
+	if len(comps.ComparableCompanies) == 0 {
+		result.Warnings = append(result.Warnings, "No comparable companies available; add peers to the comparables store")
+	}
 
 	// Calculate asset-based valuation
 	assetBased := dvc.calculateAssetBased(financialData)
@@ -148,73 +173,15 @@ func (dvc *DealValuationCalculator) CalculateValuation(dealName string, financia
 	return result, nil
 }
 
-// calculateDCF performs discounted cash flow analysis
+// calculateDCF performs discounted cash flow analysis using the assumptions
+// in the market data, falling back to DefaultDCFAssumptions
 func (dvc *DealValuationCalculator) calculateDCF(financial *FinancialAnalysis, marketData map[string]interface{}) (*DCFResult, error) {
-	dcf := &DCFResult{
-		Assumptions: make(map[string]float64),
-	}
-
-	// Extract or calculate WACC
-	wacc := 0.10 // Default 10%
-	if w, ok := marketData["wacc"].(float64); ok {
-		wacc = w
-	}
-	dcf.WACC = wacc
-
-	// Terminal growth rate
-	growthRate := 0.03 // Default 3%
-	if g, ok := marketData["terminalGrowth"].(float64); ok {
-		growthRate = g
-	}
-	dcf.GrowthRate = growthRate
-
-	// Project cash flows (5 years)
-	baseCashFlow := financial.CashFlow
-	if baseCashFlow == 0 {
-		// Estimate from EBITDA if cash flow not available
-		baseCashFlow = financial.EBITDA * 0.7 // Rough conversion
-	}
-
-	// Growth assumptions
-	yearlyGrowth := []float64{0.15, 0.12, 0.10, 0.08, 0.05} // Declining growth
-
-	dcf.ProjectedCF = make([]float64, 5)
-	dcf.PresentValues = make([]float64, 5)
-
-	totalPV := 0.0
-	for i := 0; i < 5; i++ {
-		if i == 0 {
-			dcf.ProjectedCF[i] = baseCashFlow * (1 + yearlyGrowth[i])
-		} else {
-			dcf.ProjectedCF[i] = dcf.ProjectedCF[i-1] * (1 + yearlyGrowth[i])
-		}
-
-		// Calculate present value
-		discountFactor := math.Pow(1+wacc, float64(i+1))
-		dcf.PresentValues[i] = dcf.ProjectedCF[i] / discountFactor
-		totalPV += dcf.PresentValues[i]
+	assumptions, err := dcfAssumptionsFromMarketData(financial, marketData)
+	if err != nil {
+		return nil, err
 	}
 
-	// Calculate terminal value
-	terminalCF := dcf.ProjectedCF[4] * (1 + growthRate)
-	dcf.TerminalValue = terminalCF / (wacc - growthRate)
-
-	// Present value of terminal value
-	terminalPV := dcf.TerminalValue / math.Pow(1+wacc, 5)
-
-	// Enterprise value
-	dcf.EnterpriseValue = totalPV + terminalPV
-
-	// Calculate equity value (EV - Net Debt)
-	netDebt := financial.TotalLiabilities * 0.6 // Assume 60% is debt
-	dcf.EquityValue = dcf.EnterpriseValue - netDebt
-
-	// Store assumptions
-	dcf.Assumptions["baseCashFlow"] = baseCashFlow
-	dcf.Assumptions["avgGrowthRate"] = 0.10
-	dcf.Assumptions["netDebt"] = netDebt
-
-	return dcf, nil
+	return dvc.CalculateDCF(financial, assumptions)
 }
 
 // calculateMultiples calculates valuation based on financial multiples
@@ -309,7 +276,8 @@ func (dvc *DealValuationCalculator) calculateMultiples(financial *FinancialAnaly
 	return multiples
 }
 
-// performComparableAnalysis performs comparable company analysis
+// performComparableAnalysis performs comparable company analysis using the
+// comparables in the market data, or peers selected from the comparables store
 func (dvc *DealValuationCalculator) performComparableAnalysis(financial *FinancialAnalysis, marketData map[string]interface{}) *ComparableAnalysis {
 	comps := &ComparableAnalysis{
 		ComparableCompanies: make([]ComparableCompany, 0),
@@ -328,9 +296,13 @@ func (dvc *DealValuationCalculator) performComparableAnalysis(financial *Financi
 					MarketCap: getFloatValue(compMap, "marketCap"),
 				}
 
-				// Calculate EV multiple
+				// Calculate EV multiple, preferring enterprise value when given
+				enterpriseValue := getFloatValue(compMap, "enterpriseValue")
+				if enterpriseValue == 0 {
+					enterpriseValue = comparable.MarketCap
+				}
 				if comparable.EBITDA > 0 {
-					comparable.EVMultiple = comparable.MarketCap / comparable.EBITDA
+					comparable.EVMultiple = enterpriseValue / comparable.EBITDA
 				}
 
 				// Calculate similarity score
@@ -339,18 +311,26 @@ func (dvc *DealValuationCalculator) performComparableAnalysis(financial *Financi
 				comps.ComparableCompanies = append(comps.ComparableCompanies, comparable)
 			}
 		}
+		comps.Source = "marketData"
 	}
 
-	// If no comparables provided, use default industry comparables
+	// Otherwise select the closest peers from the comparables store
 	if len(comps.ComparableCompanies) == 0 {
-		comps.ComparableCompanies = dvc.getDefaultComparables(financial)
+		comps.ComparableCompanies = dvc.selectStoredComparables(financial, marketData)
+		comps.Source = ""
+		if len(comps.ComparableCompanies) > 0 {
+			comps.Source = "comparablesStore"
+		}
 	}
 
+	// Trim outlying multiples before taking the median
+	comps.OutliersExcluded = trimOutlierMultiples(comps.ComparableCompanies)
+
 	// Calculate median multiple
 	if len(comps.ComparableCompanies) > 0 {
 		multiples := make([]float64, 0)
 		for _, comp := range comps.ComparableCompanies {
-			if comp.EVMultiple > 0 {
+			if comp.EVMultiple > 0 && !comp.Excluded {
 				multiples = append(multiples, comp.EVMultiple)
 			}
 		}
@@ -368,6 +348,86 @@ func (dvc *DealValuationCalculator) performComparableAnalysis(financial *Financi
 	return comps
 }
 
+// selectStoredComparables picks peers from the comparables store using the
+// target's financials and any industry, geography or size hints in market data
+func (dvc *DealValuationCalculator) selectStoredComparables(financial *FinancialAnalysis, marketData map[string]interface{}) []ComparableCompany {
+	if dvc.comparables == nil {
+		return nil
+	}
+
+	criteria := ComparableCriteria{
+		Kind:          ComparableKind(getStringValue(marketData, "comparableKind")),
+		Industry:      getStringValue(marketData, "industry"),
+		Geography:     getStringValue(marketData, "geography"),
+		SizeBand:      getStringValue(marketData, "sizeBand"),
+		Revenue:       financial.Revenue,
+		EBITDA:        financial.EBITDA,
+		MinSimilarity: 0.4,
+		Limit:         10,
+	}
+	if minSimilarity := getFloatValue(marketData, "minSimilarity"); minSimilarity > 0 {
+		criteria.MinSimilarity = minSimilarity
+	}
+	if limit := getFloatValue(marketData, "maxComparables"); limit > 0 {
+		criteria.Limit = int(limit)
+	}
+
+	peers := dvc.comparables.Select(criteria)
+	companies := make([]ComparableCompany, 0, len(peers))
+	for _, peer := range peers {
+		companies = append(companies, ComparableCompany{
+			Name:       peer.Name,
+			Ticker:     peer.Ticker,
+			EVMultiple: peer.EVToEBITDA,
+			Revenue:    peer.Revenue,
+			EBITDA:     peer.EBITDA,
+			MarketCap:  peer.MarketCap,
+			Similarity: peer.Similarity,
+			Industry:   peer.Industry,
+			Geography:  peer.Geography,
+			AsOfDate:   peer.AsOfDate,
+		})
+	}
+	return companies
+}
+
+// trimOutlierMultiples marks comparables whose EV multiple is more than
+// three scaled median absolute deviations from the median. Fewer than four
+// multiples are left alone.
+func trimOutlierMultiples(companies []ComparableCompany) int {
+	multiples := make([]float64, 0, len(companies))
+	for _, comp := range companies {
+		if comp.EVMultiple > 0 {
+			multiples = append(multiples, comp.EVMultiple)
+		}
+	}
+	if len(multiples) < 4 {
+		return 0
+	}
+
+	median := calculateMedian(multiples)
+	deviations := make([]float64, len(multiples))
+	for i, multiple := range multiples {
+		deviations[i] = math.Abs(multiple - median)
+	}
+	mad := 1.4826 * calculateMedian(deviations) // Consistent with the standard deviation
+	if mad == 0 {
+		return 0
+	}
+
+	excluded := 0
+	for i := range companies {
+		multiple := companies[i].EVMultiple
+		if multiple <= 0 || math.Abs(multiple-median)/mad <= 3 {
+			continue
+		}
+		companies[i].Excluded = true
+		companies[i].ExclusionReason = fmt.Sprintf("EV/EBITDA %.1fx is an outlier against the %.1fx median", multiple, median)
+		excluded++
+	}
+	return excluded
+}
+
 // calculateAssetBased performs asset-based valuation
 func (dvc *DealValuationCalculator) calculateAssetBased(financial *FinancialAnalysis) *AssetBasedValuation {
 	assetBased := &AssetBasedValuation{
@@ -562,42 +622,6 @@ func (dvc *DealValuationCalculator) calculateSimilarity(target *FinancialAnalysi
 	return 0.5 // Default medium similarity
 }
 
-// getDefaultComparables returns default comparable companies
-func (dvc *DealValuationCalculator) getDefaultComparables(financial *FinancialAnalysis) []ComparableCompany {
-	// In a real implementation, this would fetch from a database or API
-	// For now, return synthetic comparables based on the target
-
-	baseRevenue := financial.Revenue
-	baseEBITDA := financial.EBITDA
-
-	return []ComparableCompany{
-		{
-			Name:       "Industry Peer A",
-			Revenue:    baseRevenue * 1.2,
-			EBITDA:     baseEBITDA * 1.1,
-			MarketCap:  baseEBITDA * 12,
-			EVMultiple: 12,
-			Similarity: 0.85,
-		},
-		{
-			Name:       "Industry Peer B",
-			Revenue:    baseRevenue * 0.8,
-			EBITDA:     baseEBITDA * 0.9,
-			MarketCap:  baseEBITDA * 10,
-			EVMultiple: 10,
-			Similarity: 0.80,
-		},
-		{
-			Name:       "Industry Peer C",
-			Revenue:    baseRevenue * 1.5,
-			EBITDA:     baseEBITDA * 1.4,
-			MarketCap:  baseEBITDA * 14,
-			EVMultiple: 14,
-			Similarity: 0.75,
-		},
-	}
-}
-
 // Helper functions
 
 func calculateMedian(values []float64) float64 {
@@ -717,7 +741,19 @@ func (dvc *DealValuationCalculator) GenerateValuationReport(result *ValuationRes
 		report += fmt.Sprintf("  Enterprise Value: $%.2fM\n", result.DCFValuation.EnterpriseValue/1000000)
 		report += fmt.Sprintf("  Equity Value: $%.2fM\n", result.DCFValuation.EquityValue/1000000)
 		report += fmt.Sprintf("  WACC: %.1f%%\n", result.DCFValuation.WACC*100)
-		report += fmt.Sprintf("  Terminal Growth: %.1f%%\n\n", result.DCFValuation.GrowthRate*100)
+		if result.DCFValuation.TerminalMethod == TerminalExitMultiple {
+			report += fmt.Sprintf("  Exit Multiple: %.1fx EBITDA\n", result.DCFValuation.ExitMultiple)
+		} else {
+			report += fmt.Sprintf("  Terminal Growth: %.1f%%\n", result.DCFValuation.GrowthRate*100)
+		}
+		if result.DCFValuation.NetDebtSource != "" {
+			report += fmt.Sprintf("  Net Debt: $%.2fM (%s)\n", result.DCFValuation.NetDebt/1000000, result.DCFValuation.NetDebtSource)
+		}
+		if sensitivity := result.DCFValuation.Sensitivity; sensitivity != nil && len(sensitivity.ColumnValues) > 0 {
+			report += "\n  Enterprise Value Sensitivity ($M):\n"
+			report += formatSensitivityTable(sensitivity)
+		}
+		report += "\n"
 	}
 
 	// Multiples
@@ -740,6 +776,9 @@ func (dvc *DealValuationCalculator) GenerateValuationReport(result *ValuationRes
 	if result.Comps != nil && len(result.Comps.ComparableCompanies) > 0 {
 		report += fmt.Sprintf("Comparable Company Analysis:\n")
 		report += fmt.Sprintf("  Number of Comparables: %d\n", len(result.Comps.ComparableCompanies))
+		if result.Comps.OutliersExcluded > 0 {
+			report += fmt.Sprintf("  Outliers Excluded: %d\n", result.Comps.OutliersExcluded)
+		}
 		report += fmt.Sprintf("  Median Multiple: %.1fx\n", result.Comps.MedianMultiple)
 		report += fmt.Sprintf("  Implied Value: $%.2fM\n\n", result.Comps.ImpliedValue/1000000)
 	}
@@ -754,3 +793,131 @@ func (dvc *DealValuationCalculator) GenerateValuationReport(result *ValuationRes
 
 	return report
 }
+
+// formatSensitivityTable renders the sensitivity grid with WACC down the
+// side and terminal growth or exit multiple across the top
+func formatSensitivityTable(sensitivity *DCFSensitivity) string {
+	table := fmt.Sprintf("  %10s", "WACC")
+	for _, column := range sensitivity.ColumnValues {
+		table += fmt.Sprintf("%10s", formatSensitivityColumn(sensitivity.ColumnMetric, column))
+	}
+	table += "\n"
+
+	for i, wacc := range sensitivity.WACCValues {
+		table += fmt.Sprintf("  %9.1f%%", wacc*100)
+		for _, value := range sensitivity.EnterpriseValues[i] {
+			if value == 0 {
+				table += fmt.Sprintf("%10s", "n/a")
+			} else {
+				table += fmt.Sprintf("%10.1f", value/1000000)
+			}
+		}
+		table += "\n"
+	}
+	return table
+}
+
+// formatSensitivityColumn labels a sensitivity column
+func formatSensitivityColumn(metric string, value float64) string {
+	if metric == "exitMultiple" {
+		return fmt.Sprintf("%.1fx", value)
+	}
+	return fmt.Sprintf("g=%.1f%%", value*100)
+}
+
+// ValuationCSVRows flattens a valuation into CSV rows: a summary section,
+// the DCF projection, and the sensitivity grid
+func ValuationCSVRows(result *ValuationResult) [][]string {
+	money := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+	rate := func(v float64) string { return strconv.FormatFloat(v, 'f', 4, 64) }
+
+	rows := [][]string{
+		{"Section", "Metric", "Value"},
+		{"Summary", "Deal", result.DealName},
+		{"Summary", "Valuation Date", result.ValuationDate.Format("2006-01-02")},
+		{"Summary", "Confidence", rate(result.Confidence)},
+	}
+	if result.SummaryRange != nil {
+		rows = append(rows,
+			[]string{"Summary", "Low", money(result.SummaryRange.Low)},
+			[]string{"Summary", "Mid", money(result.SummaryRange.Mid)},
+			[]string{"Summary", "High", money(result.SummaryRange.High)},
+		)
+	}
+
+	if result.Multiples != nil {
+		if m := result.Multiples.EVToEBITDA; m != nil {
+			rows = append(rows, []string{"Multiples", "EV/EBITDA Implied Value", money(m.ImpliedValue)})
+		}
+		if m := result.Multiples.EVToRevenue; m != nil {
+			rows = append(rows, []string{"Multiples", "EV/Revenue Implied Value", money(m.ImpliedValue)})
+		}
+	}
+	if result.Comps != nil {
+		rows = append(rows,
+			[]string{"Comparables", "Median Multiple", rate(result.Comps.MedianMultiple)},
+			[]string{"Comparables", "Implied Value", money(result.Comps.ImpliedValue)},
+			[]string{"Comparables", "Outliers Excluded", strconv.Itoa(result.Comps.OutliersExcluded)},
+		)
+	}
+
+	dcf := result.DCFValuation
+	if dcf == nil {
+		return rows
+	}
+
+	rows = append(rows,
+		[]string{"DCF", "Enterprise Value", money(dcf.EnterpriseValue)},
+		[]string{"DCF", "Equity Value", money(dcf.EquityValue)},
+		[]string{"DCF", "Terminal Value", money(dcf.TerminalValue)},
+		[]string{"DCF", "WACC", rate(dcf.WACC)},
+		[]string{"DCF", "Terminal Growth", rate(dcf.GrowthRate)},
+		[]string{"DCF", "Net Debt", money(dcf.NetDebt)},
+	)
+	if dcf.TerminalMethod != "" {
+		rows = append(rows, []string{"DCF", "Terminal Method", string(dcf.TerminalMethod)})
+	}
+	if dcf.TerminalMethod == TerminalExitMultiple {
+		rows = append(rows, []string{"DCF", "Exit Multiple", rate(dcf.ExitMultiple)})
+	}
+
+	if len(dcf.Projections) > 0 {
+		rows = append(rows, []string{}, []string{"Year", "Revenue", "EBITDA", "D&A", "EBIT", "Taxes", "Capex", "NWC Change", "Free Cash Flow", "Discount Period", "Present Value"})
+		for _, year := range dcf.Projections {
+			rows = append(rows, []string{
+				strconv.Itoa(year.Year), money(year.Revenue), money(year.EBITDA), money(year.DA), money(year.EBIT),
+				money(year.Taxes), money(year.Capex), money(year.NWCChange), money(year.FreeCashFlow),
+				strconv.FormatFloat(year.DiscountPeriod, 'f', 1, 64), money(year.PresentValue),
+			})
+		}
+	}
+
+	if sensitivity := dcf.Sensitivity; sensitivity != nil && len(sensitivity.ColumnValues) > 0 {
+		for _, grid := range []struct {
+			title  string
+			values [][]float64
+		}{
+			{"Enterprise Value Sensitivity", sensitivity.EnterpriseValues},
+			{"Equity Value Sensitivity", sensitivity.EquityValues},
+		} {
+			header := []string{grid.title + " (rows WACC, columns " + sensitivity.ColumnMetric + ")"}
+			for _, column := range sensitivity.ColumnValues {
+				header = append(header, rate(column))
+			}
+			rows = append(rows, []string{}, header)
+			for i, wacc := range sensitivity.WACCValues {
+				row := []string{rate(wacc)}
+				for _, value := range grid.values[i] {
+					if value == 0 {
+						row = append(row, "")
+					} else {
+						row = append(row, money(value))
+					}
+				}
+				rows = append(rows, row)
+			}
+		}
+	}
+
+	return rows
+}
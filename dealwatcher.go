@@ -0,0 +1,385 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultWatchDebounce     = 2 * time.Second
+	DefaultWatchPollInterval = 30 * time.Second
+	watchSafetyRescan        = 5 * time.Minute // Full rescan even when notifications work
+)
+
+// fileNotifier reports paths that changed under watched directories. An
+// empty path means events were lost and everything should be rescanned.
+type fileNotifier interface {
+	Watch(dir string) error
+	Unwatch(root string) // Stops watching root and every directory below it
+	Events() <-chan string
+	Close() error
+}
+
+// newDealNotifier is a variable for testability
+var newDealNotifier = newFileNotifier
+
+// DealFolderWatcher queues documents that analysts drop into deal folders.
+// It uses filesystem notifications where the platform supports them and
+// polls otherwise; either way a deal is only scanned once it has been quiet
+// for the debounce period.
+type DealFolderWatcher struct {
+	queue        *QueueManager
+	dealsPath    string
+	debounce     time.Duration
+	pollInterval time.Duration
+	notifier     fileNotifier
+	deals        map[string]bool
+	dirty        map[string]time.Time // Deal -> last change seen
+	lastPoll     time.Time
+	mutex        sync.Mutex
+	cancel       context.CancelFunc
+	done         chan struct{}
+}
+
+// NewDealFolderWatcher creates a watcher for deals under dealsPath
+func NewDealFolderWatcher(queue *QueueManager, dealsPath string) *DealFolderWatcher {
+	return &DealFolderWatcher{
+		queue:        queue,
+		dealsPath:    dealsPath,
+		debounce:     DefaultWatchDebounce,
+		pollInterval: DefaultWatchPollInterval,
+		deals:        make(map[string]bool),
+		dirty:        make(map[string]time.Time),
+	}
+}
+
+// Start begins watching enabled deals
+func (w *DealFolderWatcher) Start() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	if w.done != nil {
+		return fmt.Errorf("deal folder watcher already running")
+	}
+
+	notifier, err := newDealNotifier()
+	if err != nil {
+		fmt.Printf("Deal folder watcher polling every %s: %v\n", w.pollInterval, err)
+		notifier = nil
+	}
+	w.notifier = notifier
+	w.lastPoll = time.Now()
+
+	var events <-chan string
+	if notifier != nil {
+		events = notifier.Events()
+		for deal := range w.deals {
+			w.watchTree(w.dealPath(deal))
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	w.cancel = cancel
+	w.done = make(chan struct{})
+	go w.run(ctx, events, w.done)
+	return nil
+}
+
+// Stop stops watching; enabled deals are kept for the next Start
+func (w *DealFolderWatcher) Stop() error {
+	w.mutex.Lock()
+	if w.done == nil {
+		w.mutex.Unlock()
+		return fmt.Errorf("deal folder watcher not running")
+	}
+	w.cancel()
+	done := w.done
+	w.done = nil
+	notifier := w.notifier
+	w.notifier = nil
+	w.mutex.Unlock()
+
+	<-done
+	if notifier != nil {
+		return notifier.Close()
+	}
+	return nil
+}
+
+// EnableDeal starts watching a deal folder. Files already in the folder are
+// recorded as the baseline; only files added or changed afterwards are
+// queued, including those changed while the app was closed.
+func (w *DealFolderWatcher) EnableDeal(dealName string) error {
+	dealPath := w.dealPath(dealName)
+	if dealName == "" || strings.ContainsAny(dealName, `/\`) {
+		return fmt.Errorf("invalid deal name: %q", dealName)
+	}
+	if !isDirectory(dealPath) {
+		return fmt.Errorf("deal folder not found: %s", dealName)
+	}
+
+	_, tracked := w.queue.GetDealFolderMirror(dealName)
+	w.queue.TrackDealFolder(dealName, dealPath)
+	if !tracked {
+		if err := w.queue.SyncDealFolder(dealName); err != nil {
+			return fmt.Errorf("failed to record deal folder baseline: %w", err)
+		}
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	w.deals[dealName] = true
+	w.dirty[dealName] = time.Time{} // Catch up on changes straight away
+	if w.notifier != nil {
+		w.watchTree(dealPath)
+	}
+	return nil
+}
+
+// DisableDeal stops watching a deal folder
+func (w *DealFolderWatcher) DisableDeal(dealName string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	delete(w.deals, dealName)
+	delete(w.dirty, dealName)
+	if w.notifier != nil {
+		w.notifier.Unwatch(w.dealPath(dealName))
+	}
+}
+
+// IsWatching reports whether a deal folder is being watched
+func (w *DealFolderWatcher) IsWatching(dealName string) bool {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	return w.deals[dealName]
+}
+
+// WatchedDeals returns the watched deals in name order
+func (w *DealFolderWatcher) WatchedDeals() []string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	deals := make([]string, 0, len(w.deals))
+	for deal := range w.deals {
+		deals = append(deals, deal)
+	}
+	sort.Strings(deals)
+	return deals
+}
+
+// Mode returns "notify" when filesystem notifications are in use, "polling"
+// when running without them and "stopped" otherwise
+func (w *DealFolderWatcher) Mode() string {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	switch {
+	case w.done == nil:
+		return "stopped"
+	case w.notifier != nil:
+		return "notify"
+	default:
+		return "polling"
+	}
+}
+
+func (w *DealFolderWatcher) run(ctx context.Context, events <-chan string, done chan struct{}) {
+	defer close(done)
+
+	tick := w.debounce / 2
+	if tick < 50*time.Millisecond {
+		tick = 50 * time.Millisecond
+	}
+	ticker := time.NewTicker(tick)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case path, ok := <-events:
+			if !ok {
+				events = nil
+				continue
+			}
+			w.markChanged(path)
+		case <-ticker.C:
+			w.scanQuietDeals(ctx)
+		}
+	}
+}
+
+// markChanged records a change for the deal containing path
+func (w *DealFolderWatcher) markChanged(path string) {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	now := time.Now()
+	if path == "" {
+		for deal := range w.deals {
+			w.dirty[deal] = now
+		}
+		return
+	}
+
+	if !isWithinDir(w.dealsPath, path) {
+		return
+	}
+	rel, _ := filepath.Rel(w.dealsPath, path)
+	deal := strings.Split(filepath.ToSlash(rel), "/")[0]
+	if w.deals[deal] && !isIgnoredDealFile(filepath.Base(path)) {
+		w.dirty[deal] = now
+	}
+}
+
+// scanQuietDeals ingests deals whose last change is older than the debounce
+// period, and schedules periodic rescans
+func (w *DealFolderWatcher) scanQuietDeals(ctx context.Context) {
+	w.mutex.Lock()
+	now := time.Now()
+	interval := w.pollInterval
+	if w.notifier != nil {
+		interval = watchSafetyRescan
+	}
+	if now.Sub(w.lastPoll) >= interval {
+		w.lastPoll = now
+		for deal := range w.deals {
+			if _, pending := w.dirty[deal]; !pending {
+				w.dirty[deal] = time.Time{}
+			}
+		}
+	}
+
+	var ready []string
+	for deal, changed := range w.dirty {
+		if now.Sub(changed) >= w.debounce {
+			ready = append(ready, deal)
+			delete(w.dirty, deal)
+		}
+	}
+	w.mutex.Unlock()
+
+	sort.Strings(ready)
+	for _, deal := range ready {
+		if ctx.Err() != nil {
+			return
+		}
+		w.ingest(deal)
+	}
+}
+
+func (w *DealFolderWatcher) ingest(dealName string) {
+	// Watch directories created since the last scan before scanning, so a
+	// file is either seen by the scan or reported by a later event
+	w.mutex.Lock()
+	if !w.deals[dealName] {
+		w.mutex.Unlock()
+		return
+	}
+	if w.notifier != nil {
+		w.watchTree(w.dealPath(dealName))
+	}
+	w.mutex.Unlock()
+
+	queued, rescan, err := w.queue.IngestDealFolder(dealName, w.debounce)
+	if err != nil {
+		fmt.Printf("Warning: Failed to scan deal folder %s: %v\n", dealName, err)
+		return
+	}
+	if len(queued) > 0 {
+		fmt.Printf("Deal folder watcher queued %d file(s) for %s\n", len(queued), dealName)
+	}
+
+	if rescan {
+		w.mutex.Lock()
+		if _, pending := w.dirty[dealName]; w.deals[dealName] && !pending {
+			w.dirty[dealName] = time.Now()
+		}
+		w.mutex.Unlock()
+	}
+}
+
+// watchTree adds notifications for root and its subdirectories; callers
+// hold w.mutex
+func (w *DealFolderWatcher) watchTree(root string) {
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || !d.IsDir() {
+			return nil
+		}
+		if path != root && skipDealDir(root, path) {
+			return filepath.SkipDir
+		}
+		if err := w.notifier.Watch(path); err != nil {
+			fmt.Printf("Warning: Failed to watch %s: %v\n", path, err)
+		}
+		return nil
+	})
+}
+
+func (w *DealFolderWatcher) dealPath(dealName string) string {
+	return filepath.Join(w.dealsPath, dealName)
+}
+
+// skipDealDir reports whether a directory inside a deal folder holds no
+// source documents: hidden folders and the analysis output folder
+func skipDealDir(root, path string) bool {
+	name := filepath.Base(path)
+	if strings.HasPrefix(name, ".") {
+		return true
+	}
+	return name == "analysis" && filepath.Dir(path) == filepath.Clean(root)
+}
+
+// isIgnoredDealFile reports whether a file is a temporary, lock or system
+// file that should never be processed
+func isIgnoredDealFile(name string) bool {
+	lower := strings.ToLower(name)
+	switch {
+	case strings.HasPrefix(name, "."), // Hidden files, .DS_Store, .~lock.*# (LibreOffice)
+		strings.HasPrefix(name, "~$"), // Office owner files
+		strings.HasPrefix(name, "~"),
+		strings.HasSuffix(name, "~"),
+		lower == "thumbs.db",
+		lower == "desktop.ini":
+		return true
+	}
+
+	switch filepath.Ext(lower) {
+	case ".tmp", ".temp", ".part", ".partial", ".crdownload", ".download", ".swp", ".lock", ".lck":
+		return true
+	}
+	return false
+}
+
+// fileChecksum returns the SHA-256 of a file's contents
+func fileChecksum(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// isWithinDir reports whether path is dir or below it
+func isWithinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
@@ -0,0 +1,147 @@
+//go:build linux
+
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_MOVED_TO | syscall.IN_MOVED_FROM |
+	syscall.IN_CREATE | syscall.IN_DELETE | syscall.IN_ATTRIB
+
+// inotifyNotifier reports changes using Linux inotify
+type inotifyNotifier struct {
+	file    *os.File
+	fd      int
+	mutex   sync.Mutex
+	watches map[int]string // Watch descriptor -> directory
+	dirs    map[string]int
+	events  chan string
+	done    chan struct{}
+}
+
+func newFileNotifier() (fileNotifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, fmt.Errorf("inotify unavailable: %w", err)
+	}
+
+	// A non-blocking descriptor goes through the runtime poller, so Close
+	// interrupts a pending Read
+	n := &inotifyNotifier{
+		file:    os.NewFile(uintptr(fd), "inotify"),
+		fd:      fd,
+		watches: make(map[int]string),
+		dirs:    make(map[string]int),
+		events:  make(chan string, 256),
+		done:    make(chan struct{}),
+	}
+	go n.readEvents()
+	return n, nil
+}
+
+func (n *inotifyNotifier) Watch(dir string) error {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	dir = filepath.Clean(dir)
+	if _, exists := n.dirs[dir]; exists {
+		return nil
+	}
+
+	wd, err := syscall.InotifyAddWatch(n.fd, dir, inotifyMask)
+	if err != nil {
+		return err
+	}
+	n.watches[wd] = dir
+	n.dirs[dir] = wd
+	return nil
+}
+
+func (n *inotifyNotifier) Unwatch(root string) {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+
+	root = filepath.Clean(root)
+	for dir, wd := range n.dirs {
+		if isWithinDir(root, dir) {
+			syscall.InotifyRmWatch(n.fd, uint32(wd))
+			delete(n.dirs, dir)
+			delete(n.watches, wd)
+		}
+	}
+}
+
+func (n *inotifyNotifier) Events() <-chan string {
+	return n.events
+}
+
+func (n *inotifyNotifier) Close() error {
+	close(n.done)
+	return n.file.Close()
+}
+
+func (n *inotifyNotifier) readEvents() {
+	defer close(n.events)
+
+	buf := make([]byte, 64*(syscall.SizeofInotifyEvent+syscall.NAME_MAX+1))
+	for {
+		count, err := n.file.Read(buf)
+		if err != nil {
+			if !errors.Is(err, os.ErrClosed) {
+				n.send("")
+			}
+			return
+		}
+
+		for offset := 0; offset+syscall.SizeofInotifyEvent <= count; {
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[offset]))
+			nameStart := offset + syscall.SizeofInotifyEvent
+			nameEnd := nameStart + int(event.Len)
+			offset = nameEnd
+			if nameEnd > count {
+				break
+			}
+
+			if event.Mask&syscall.IN_Q_OVERFLOW != 0 {
+				n.send("")
+				continue
+			}
+
+			n.mutex.Lock()
+			dir, known := n.watches[int(event.Wd)]
+			if event.Mask&syscall.IN_IGNORED != 0 {
+				delete(n.watches, int(event.Wd))
+				if n.dirs[dir] == int(event.Wd) {
+					delete(n.dirs, dir)
+				}
+			}
+			n.mutex.Unlock()
+			if !known {
+				continue
+			}
+
+			name := string(bytes.TrimRight(buf[nameStart:nameEnd], "\x00"))
+			if !n.send(filepath.Join(dir, name)) {
+				return
+			}
+		}
+	}
+}
+
+// send delivers a path unless the notifier is closing
+func (n *inotifyNotifier) send(path string) bool {
+	select {
+	case n.events <- path:
+		return true
+	case <-n.done:
+		return false
+	}
+}
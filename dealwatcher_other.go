@@ -0,0 +1,14 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// newFileNotifier reports that notifications are unavailable, so the deal
+// folder watcher falls back to polling
+func newFileNotifier() (fileNotifier, error) {
+	return nil, fmt.Errorf("file notifications are not supported on %s", runtime.GOOS)
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newWatchedDeal creates Deals/<deal> with the standard subfolders and a
+// queue manager that stores its state next to it
+func newWatchedDeal(t *testing.T, dealName string) (*QueueManager, string, string) {
+	root := t.TempDir()
+	dealsPath := filepath.Join(root, "Deals")
+	dealPath := filepath.Join(dealsPath, dealName)
+	for _, sub := range []string{"legal", "financial", "general", "analysis"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(dealPath, sub), 0755))
+	}
+	return NewQueueManager(filepath.Join(root, "data")), dealsPath, dealPath
+}
+
+// writeAged writes a file and backdates it so it counts as settled
+func writeAged(t *testing.T, path, content string) {
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	old := time.Now().Add(-time.Minute)
+	require.NoError(t, os.Chtimes(path, old, old))
+}
+
+func queuedPaths(items []*QueueItem) []string {
+	paths := make([]string, 0, len(items))
+	for _, item := range items {
+		paths = append(paths, filepath.Base(item.DocumentPath))
+	}
+	return paths
+}
+
+func TestIsIgnoredDealFile(t *testing.T) {
+	for _, name := range []string{"~$Model.xlsx", ".~lock.CIM.docx#", ".DS_Store", "Thumbs.db", "upload.pdf.part", "report.crdownload", "notes.txt~", "data.tmp"} {
+		assert.True(t, isIgnoredDealFile(name), name)
+	}
+	for _, name := range []string{"CIM.pdf", "Model v2.xlsx", "term-sheet.docx"} {
+		assert.False(t, isIgnoredDealFile(name), name)
+	}
+}
+
+func TestQueueManager_IngestDealFolder(t *testing.T) {
+	qm, _, dealPath := newWatchedDeal(t, "Acme")
+	writeAged(t, filepath.Join(dealPath, "financial", "model.xlsx"), "model v1")
+	writeAged(t, filepath.Join(dealPath, "legal", "nda.pdf"), "nda")
+
+	// Baseline: existing files are recorded but not queued
+	qm.TrackDealFolder("Acme", dealPath)
+	require.NoError(t, qm.SyncDealFolder("Acme"))
+	mirror, _ := qm.GetDealFolderMirror("Acme")
+	assert.Equal(t, 2, mirror.FileCount)
+	assert.Equal(t, SyncStatusSynced, mirror.SyncStatus)
+	assert.Empty(t, qm.queue)
+
+	writeAged(t, filepath.Join(dealPath, "cim.pdf"), "cim")
+	writeAged(t, filepath.Join(dealPath, "general", "cim copy.pdf"), "cim")
+	writeAged(t, filepath.Join(dealPath, "financial", "model.xlsx"), "model v2")
+	writeAged(t, filepath.Join(dealPath, "~$model.xlsx"), "lock")
+	writeAged(t, filepath.Join(dealPath, "analysis", "populated.xlsx"), "output")
+	require.NoError(t, os.Remove(filepath.Join(dealPath, "legal", "nda.pdf")))
+
+	queued, rescan, err := qm.IngestDealFolder("Acme", time.Second)
+	require.NoError(t, err)
+	assert.False(t, rescan)
+	assert.ElementsMatch(t, []string{"cim.pdf", "model.xlsx"}, queuedPaths(queued))
+	assert.Equal(t, "folder_watcher", queued[0].Metadata["source"])
+
+	mirror, _ = qm.GetDealFolderMirror("Acme")
+	assert.Equal(t, 3, mirror.FileCount, "lock, output and deleted files are not tracked")
+	copyInfo := mirror.FileStructure[filepath.Join(dealPath, "general", "cim copy.pdf")]
+	assert.Equal(t, "duplicate", copyInfo.ProcessingState)
+	modelInfo := mirror.FileStructure[filepath.Join(dealPath, "financial", "model.xlsx")]
+	assert.Equal(t, "queued", modelInfo.ProcessingState)
+	assert.Len(t, modelInfo.Checksum, 64)
+	assert.Equal(t, SyncStatusOutOfSync, mirror.SyncStatus)
+
+	// Nothing changed, nothing queued
+	queued, _, err = qm.IngestDealFolder("Acme", time.Second)
+	require.NoError(t, err)
+	assert.Empty(t, queued)
+}
+
+func TestQueueManager_IngestDealFolderConflictsAndPartialWrites(t *testing.T) {
+	qm, _, dealPath := newWatchedDeal(t, "Acme")
+	modelPath := filepath.Join(dealPath, "model.xlsx")
+	qm.TrackDealFolder("Acme", dealPath)
+
+	writeAged(t, modelPath, "model v1")
+	queued, _, err := qm.IngestDealFolder("Acme", time.Second)
+	require.NoError(t, err)
+	require.Len(t, queued, 1)
+	require.NoError(t, qm.SynchronizeWorkflowState(queued[0].JobID, "processing"))
+
+	// Changed while a worker has it
+	writeAged(t, modelPath, "model v2")
+	queued, rescan, err := qm.IngestDealFolder("Acme", time.Second)
+	require.NoError(t, err)
+	assert.Empty(t, queued)
+	assert.True(t, rescan)
+	mirror, _ := qm.GetDealFolderMirror("Acme")
+	assert.Equal(t, []string{modelPath}, mirror.ConflictFiles)
+	assert.Equal(t, SyncStatusConflict, mirror.SyncStatus)
+
+	// Still being written: skipped until it settles
+	require.NoError(t, os.WriteFile(filepath.Join(dealPath, "upload.pdf"), []byte("partial"), 0644))
+	_, rescan, err = qm.IngestDealFolder("Acme", time.Hour)
+	require.NoError(t, err)
+	assert.True(t, rescan)
+	mirror, _ = qm.GetDealFolderMirror("Acme")
+	assert.NotContains(t, mirror.FileStructure, filepath.Join(dealPath, "upload.pdf"))
+
+	// Once processing finishes the new version is queued
+	item, _ := qm.QueryQueue(QueueQuery{DealName: "Acme"})
+	require.NoError(t, qm.SynchronizeWorkflowState(item[0].JobID, "completed"))
+	queued, _, err = qm.IngestDealFolder("Acme", time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"model.xlsx"}, queuedPaths(queued))
+	mirror, _ = qm.GetDealFolderMirror("Acme")
+	assert.Empty(t, mirror.ConflictFiles)
+}
+
+func TestQueueManager_IngestDealFolderRetriesUnqueuedFiles(t *testing.T) {
+	qm, _, dealPath := newWatchedDeal(t, "Acme")
+	qm.TrackDealFolder("Acme", dealPath)
+	require.NoError(t, qm.SyncDealFolder("Acme"))
+
+	// A file that failed to queue is left out of the baseline
+	cimPath := filepath.Join(dealPath, "cim.pdf")
+	writeAged(t, cimPath, "cim")
+	scan, err := qm.scanDealFolder("Acme", time.Second)
+	require.NoError(t, err)
+	qm.applyDealFolderScan("Acme", scan, nil, nil, []string{cimPath})
+	mirror, _ := qm.GetDealFolderMirror("Acme")
+	assert.NotContains(t, mirror.FileStructure, cimPath)
+
+	queued, _, err := qm.IngestDealFolder("Acme", time.Second)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"cim.pdf"}, queuedPaths(queued))
+
+	// Files already waiting are not failures
+	writeAged(t, cimPath, "cim v2")
+	queued, rescan, err := qm.IngestDealFolder("Acme", time.Second)
+	require.NoError(t, err)
+	assert.Empty(t, queued)
+	assert.False(t, rescan)
+	mirror, _ = qm.GetDealFolderMirror("Acme")
+	assert.Empty(t, mirror.SyncErrors)
+}
+
+func TestDealFolderWatcher(t *testing.T) {
+	for _, mode := range []string{"notify", "polling"} {
+		t.Run(mode, func(t *testing.T) {
+			if mode == "polling" {
+				original := newDealNotifier
+				newDealNotifier = func() (fileNotifier, error) { return nil, fmt.Errorf("disabled for test") }
+				defer func() { newDealNotifier = original }()
+			} else if _, err := newFileNotifier(); err != nil {
+				t.Skipf("notifications unavailable: %v", err)
+			}
+
+			qm, dealsPath, dealPath := newWatchedDeal(t, "Acme")
+			writeAged(t, filepath.Join(dealPath, "existing.pdf"), "existing")
+
+			watcher := NewDealFolderWatcher(qm, dealsPath)
+			watcher.debounce = 100 * time.Millisecond
+			watcher.pollInterval = 100 * time.Millisecond
+			require.NoError(t, watcher.Start())
+			defer watcher.Stop()
+			assert.Equal(t, mode, watcher.Mode())
+
+			assert.Error(t, watcher.EnableDeal("Missing"))
+			require.NoError(t, watcher.EnableDeal("Acme"))
+			assert.Equal(t, []string{"Acme"}, watcher.WatchedDeals())
+
+			// New folders are picked up as well
+			require.NoError(t, os.MkdirAll(filepath.Join(dealPath, "general", "data room"), 0755))
+			time.Sleep(150 * time.Millisecond)
+			require.NoError(t, os.WriteFile(filepath.Join(dealPath, "general", "data room", "cim.pdf"), []byte("cim"), 0644))
+			require.NoError(t, os.WriteFile(filepath.Join(dealPath, "general", "cim.pdf.part"), []byte("partial"), 0644))
+
+			require.Eventually(t, func() bool {
+				items, _ := qm.QueryQueue(QueueQuery{DealName: "Acme"})
+				return len(items) == 1
+			}, 5*time.Second, 20*time.Millisecond)
+
+			items, _ := qm.QueryQueue(QueueQuery{DealName: "Acme"})
+			assert.Equal(t, "cim.pdf", items[0].DocumentName)
+
+			watcher.DisableDeal("Acme")
+			assert.False(t, watcher.IsWatching("Acme"))
+			require.NoError(t, os.WriteFile(filepath.Join(dealPath, "late.pdf"), []byte("late"), 0644))
+			time.Sleep(400 * time.Millisecond)
+			items, _ = qm.QueryQueue(QueueQuery{DealName: "Acme"})
+			assert.Len(t, items, 1)
+		})
+	}
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ManifestEntry records one distinct document content within a deal
+type ManifestEntry struct {
+	Checksum      string       `json:"checksum"`      // SHA-256 of the content
+	CanonicalPath string       `json:"canonicalPath"` // Empty once the file was overwritten or removed
+	OriginalNames []string     `json:"originalNames"`
+	DocumentKey   string       `json:"documentKey"` // Shared by every version of a document
+	Version       int          `json:"version"`
+	DocumentType  DocumentType `json:"documentType"`
+	Size          int64        `json:"size"`
+	FirstSeen     time.Time    `json:"firstSeen"`
+	LastSeen      time.Time    `json:"lastSeen"`
+}
+
+// DealManifest is a deal's content-addressed record of routed documents
+type DealManifest struct {
+	DealName  string                    `json:"dealName"`
+	Entries   map[string]*ManifestEntry `json:"entries"` // Keyed by checksum
+	UpdatedAt time.Time                 `json:"updatedAt"`
+}
+
+// dealManifestPath returns where a deal's manifest is stored. The hidden
+// folder keeps it out of document listings and the folder watcher.
+func dealManifestPath(dealPath string) string {
+	return filepath.Join(dealPath, ".dealdone", "manifest.json")
+}
+
+// loadDealManifest reads a deal manifest, returning an empty one if none
+// exists. An unreadable manifest is set aside and rebuilt as documents are
+// routed again.
+func loadDealManifest(path, dealName string) (*DealManifest, error) {
+	manifest := &DealManifest{
+		DealName: dealName,
+		Entries:  make(map[string]*ManifestEntry),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return manifest, nil
+		}
+		return nil, fmt.Errorf("failed to read deal manifest: %w", err)
+	}
+
+	if err := json.Unmarshal(data, manifest); err != nil {
+		fmt.Printf("Warning: Deal manifest for %s is corrupt, starting a new one: %v\n", dealName, err)
+		os.Rename(path, path+".corrupt")
+		return &DealManifest{DealName: dealName, Entries: make(map[string]*ManifestEntry)}, nil
+	}
+	if manifest.Entries == nil {
+		manifest.Entries = make(map[string]*ManifestEntry)
+	}
+	return manifest, nil
+}
+
+// save writes the manifest durably
+func (m *DealManifest) save(path string) error {
+	m.UpdatedAt = time.Now()
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal deal manifest: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("failed to create manifest folder: %w", err)
+	}
+	return writeFileDurable(path, data, 0644)
+}
+
+// Versions returns every version of a document, oldest first
+func (m *DealManifest) Versions(documentKey string) []*ManifestEntry {
+	var versions []*ManifestEntry
+	for _, entry := range m.Entries {
+		if entry.DocumentKey == documentKey {
+			versions = append(versions, entry)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version < versions[j].Version })
+	return versions
+}
+
+// entryAtPath returns the entry whose canonical file is path
+func (m *DealManifest) entryAtPath(path string) *ManifestEntry {
+	for _, entry := range m.Entries {
+		if entry.CanonicalPath == path {
+			return entry
+		}
+	}
+	return nil
+}
+
+// record adds or replaces the entry for a content checksum, keeping the
+// names and first-seen time of an earlier entry for the same content
+func (m *DealManifest) record(checksum, path, documentKey string, version int, docType DocumentType, fileName string) *ManifestEntry {
+	now := time.Now()
+	entry := &ManifestEntry{
+		Checksum:      checksum,
+		CanonicalPath: path,
+		DocumentKey:   documentKey,
+		Version:       version,
+		DocumentType:  docType,
+		FirstSeen:     now,
+		LastSeen:      now,
+	}
+	if previous, ok := m.Entries[checksum]; ok {
+		entry.OriginalNames = previous.OriginalNames
+		entry.FirstSeen = previous.FirstSeen
+	}
+	entry.addOriginalName(fileName)
+	if info, err := os.Stat(path); err == nil {
+		entry.Size = info.Size()
+	}
+
+	m.Entries[checksum] = entry
+	return entry
+}
+
+// latestVersion returns the highest version recorded for a document
+func (m *DealManifest) latestVersion(documentKey string) int {
+	latest := 0
+	for _, entry := range m.Entries {
+		if entry.DocumentKey == documentKey && entry.Version > latest {
+			latest = entry.Version
+		}
+	}
+	return latest
+}
+
+// addOriginalName records another name the content was received under
+func (e *ManifestEntry) addOriginalName(name string) {
+	for _, existing := range e.OriginalNames {
+		if existing == name {
+			return
+		}
+	}
+	e.OriginalNames = append(e.OriginalNames, name)
+}
+
+// manifestDocumentKey identifies a document across versions by its folder
+// and case-insensitive name
+func manifestDocumentKey(subfolder, fileName string) string {
+	return subfolder + "/" + strings.ToLower(fileName)
+}
+
+// versionedFileName names version n of a document: the original name for
+// the first version and "<name>_v<n><ext>" after that
+func versionedFileName(fileName string, version int) string {
+	if version <= 1 {
+		return fileName
+	}
+	ext := filepath.Ext(fileName)
+	return fmt.Sprintf("%s_v%d%s", strings.TrimSuffix(fileName, ext), version, ext)
+}
@@ -62,6 +62,7 @@ func NewDocumentProcessor(aiService *AIService) *DocumentProcessor {
 			".jpeg": true,
 			".png":  true,
 			".tiff": true,
+			".tif":  true,
 			".bmp":  true,
 		},
 	}
@@ -74,6 +75,18 @@ func (dp *DocumentProcessor) SetOCRService(ocrService *OCRService) {
 
 // ProcessDocument analyzes a document and returns its information
 func (dp *DocumentProcessor) ProcessDocument(filePath string) (*DocumentInfo, error) {
+	return dp.ProcessDocumentForDeal(filePath, "")
+}
+
+// ProcessDocumentForDeal analyzes a document, billing any AI classification
+// to dealName
+func (dp *DocumentProcessor) ProcessDocumentForDeal(filePath, dealName string) (*DocumentInfo, error) {
+	return dp.ProcessDocumentContext(context.Background(), filePath, dealName)
+}
+
+// ProcessDocumentContext is ProcessDocumentForDeal with AI classification
+// stopped when ctx is done
+func (dp *DocumentProcessor) ProcessDocumentContext(ctx context.Context, filePath, dealName string) (*DocumentInfo, error) {
 	// Basic file info
 	info, err := os.Stat(filePath)
 	if err != nil {
@@ -109,6 +122,16 @@ func (dp *DocumentProcessor) ProcessDocument(filePath string) (*DocumentInfo, er
 		docInfo.IsScanned = true
 	}
 
+	// PDFs without a text layer are scans that need OCR. The PDF is parsed
+	// once here and the text reused for AI classification.
+	var native *TextExtraction
+	if ext == ".pdf" {
+		if extraction, err := extractNativeText(filePath); err == nil {
+			native = extraction
+			docInfo.IsScanned = extraction.Scanned
+		}
+	}
+
 	// First try rule-based classification for obvious cases
 	ruleBasedType := dp.detectDocumentTypeByRules(fileName, ext)
 	fmt.Printf("Document classification for %s: rule-based=%s\n", fileName, ruleBasedType)
@@ -123,7 +146,7 @@ func (dp *DocumentProcessor) ProcessDocument(filePath string) (*DocumentInfo, er
 
 	// Otherwise, try AI classification for general documents
 	if dp.aiService != nil {
-		aiResult, err := dp.detectDocumentTypeWithAI(filePath, docInfo)
+		aiResult, err := dp.detectDocumentTypeWithAI(ctx, filePath, docInfo, dealName, native)
 		if err == nil {
 			docInfo.Type = aiResult.Type
 			docInfo.Confidence = aiResult.Confidence
@@ -152,17 +175,15 @@ type AIDetectionResult struct {
 	Keywords   []string
 }
 
-// detectDocumentTypeWithAI uses AI service to detect document type
-func (dp *DocumentProcessor) detectDocumentTypeWithAI(filePath string, docInfo *DocumentInfo) (*AIDetectionResult, error) {
-	// Extract text from the document
-	text, err := dp.ExtractTextWithOCR(filePath)
+// detectDocumentTypeWithAI uses AI service to detect document type. native
+// is the document's native extraction when it has already been made.
+func (dp *DocumentProcessor) detectDocumentTypeWithAI(ctx context.Context, filePath string, docInfo *DocumentInfo, dealName string, native *TextExtraction) (*AIDetectionResult, error) {
+	// Extract text from the document, falling back to OCR for scans
+	extraction, err := dp.extractPages(filePath, native)
 	if err != nil {
-		// If text extraction fails, try without OCR
-		text, err = dp.ExtractText(filePath)
-		if err != nil {
-			return nil, err
-		}
+		return nil, err
 	}
+	text := extraction.Text()
 
 	// Use AI to classify based on extracted text
 	if text != "" && dp.aiService != nil && dp.aiService.IsAvailable() {
@@ -173,7 +194,7 @@ func (dp *DocumentProcessor) detectDocumentTypeWithAI(filePath string, docInfo *
 		}
 
 		// Create a context with timeout
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+		ctx, cancel := context.WithTimeout(WithAIDocument(WithAIDeal(ctx, dealName), filePath), time.Second*30)
 		defer cancel()
 
 		result, err := dp.aiService.ClassifyDocument(ctx, text, metadata)
@@ -298,6 +319,7 @@ func (dp *DocumentProcessor) isImageFile(ext string) bool {
 		".jpeg": true,
 		".png":  true,
 		".tiff": true,
+		".tif":  true,
 		".bmp":  true,
 		".gif":  true,
 	}
@@ -327,36 +349,90 @@ func (dp *DocumentProcessor) ProcessBatch(filePaths []string) ([]*DocumentInfo,
 
 // ExtractText extracts text content from a document
 func (dp *DocumentProcessor) ExtractText(filePath string) (string, error) {
+	extraction, err := dp.ExtractPages(filePath)
+	if err != nil {
+		return "", err
+	}
+	return extraction.Text(), nil
+}
+
+// ExtractPages extracts text page by page. Born-digital documents are read
+// natively; OCR is only used for images and documents without a text layer.
+func (dp *DocumentProcessor) ExtractPages(filePath string) (*TextExtraction, error) {
+	return dp.extractPages(filePath, nil)
+}
+
+// extractPages is ExtractPages starting from native, the native extraction of
+// filePath, when the caller already has it
+func (dp *DocumentProcessor) extractPages(filePath string, native *TextExtraction) (*TextExtraction, error) {
 	ext := strings.ToLower(filepath.Ext(filePath))
 
-	switch ext {
-	case ".txt", ".md":
-		content, err := os.ReadFile(filePath)
-		if err != nil {
-			return "", fmt.Errorf("failed to read text file: %w", err)
-		}
-		return string(content), nil
+	// Images never have a text layer
+	if dp.isImageFile(ext) {
+		return dp.extractPagesWithOCR(filePath)
+	}
 
-	case ".pdf", ".doc", ".docx":
-		// Use OCR if available for these document types
+	switch ext {
+	case ".doc":
+		// Legacy binary Word documents have no native extractor
 		if dp.ocrService != nil && dp.ocrService.IsEnabled() {
-			return dp.ExtractTextWithOCR(filePath)
+			return dp.extractPagesWithOCR(filePath)
 		}
-		return "", fmt.Errorf("text extraction for %s requires OCR service", ext)
+		return nil, fmt.Errorf("text extraction for %s requires OCR service", ext)
+	case ".xls", ".ppt":
+		return nil, fmt.Errorf("text extraction not supported for legacy %s files", ext)
+	}
 
-	default:
-		// For images, always use OCR
-		if dp.isImageFile(ext) {
-			return dp.ExtractTextWithOCR(filePath)
+	extraction := native
+	if extraction == nil {
+		var err error
+		if extraction, err = extractNativeText(filePath); err != nil {
+			return nil, err
 		}
-		return "", fmt.Errorf("text extraction not supported for %s files", ext)
 	}
+
+	// Scanned PDFs have no text layer; fall back to OCR when it is configured
+	if extraction.Scanned && dp.ocrService != nil && dp.ocrService.IsEnabled() {
+		return dp.extractPagesWithOCR(filePath)
+	}
+
+	return extraction, nil
+}
+
+// extractPagesWithOCR wraps OCR output in a TextExtraction with one page per
+// recognized page, TIFF frame or PDF page
+func (dp *DocumentProcessor) extractPagesWithOCR(filePath string) (*TextExtraction, error) {
+	result, err := dp.recognize(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	pages := make([]ExtractedPage, 0, len(result.Pages))
+	for _, page := range result.Pages {
+		// Skipped pages stay, empty, so page numbers match the document
+		pages = append(pages, ExtractedPage{Number: page.Number, Text: page.Text, Confidence: page.Confidence})
+	}
+	return &TextExtraction{
+		Path:    filePath,
+		Method:  "ocr",
+		Pages:   pages,
+		Scanned: true,
+	}, nil
 }
 
 // ExtractTextWithOCR uses OCR to extract text from images or scanned documents
 func (dp *DocumentProcessor) ExtractTextWithOCR(filePath string) (string, error) {
+	result, err := dp.recognize(filePath)
+	if err != nil {
+		return "", err
+	}
+	return result.Text, nil
+}
+
+// recognize runs OCR on an image or scanned PDF
+func (dp *DocumentProcessor) recognize(filePath string) (*OCRResult, error) {
 	if dp.ocrService == nil || !dp.ocrService.IsEnabled() {
-		return "", fmt.Errorf("OCR service not available")
+		return nil, fmt.Errorf("OCR service not available")
 	}
 
 	ext := strings.ToLower(filepath.Ext(filePath))
@@ -365,9 +441,12 @@ func (dp *DocumentProcessor) ExtractTextWithOCR(filePath string) (string, error)
 	if ext == ".pdf" {
 		result, err := dp.ocrService.ProcessPDF(filePath)
 		if err != nil {
-			return "", fmt.Errorf("OCR failed for PDF: %w", err)
+			return nil, fmt.Errorf("OCR failed for PDF: %w", err)
+		}
+		for _, warning := range result.Warnings {
+			fmt.Printf("Warning: OCR of %s skipped %s\n", filepath.Base(filePath), warning)
 		}
-		return result.Text, nil
+		return result, nil
 	}
 
 	// Handle images
@@ -378,15 +457,18 @@ func (dp *DocumentProcessor) ExtractTextWithOCR(filePath string) (string, error)
 			// Continue with original if preprocessing fails
 			processedPath = filePath
 		}
+		if processedPath != filePath {
+			defer os.Remove(processedPath)
+		}
 
 		result, err := dp.ocrService.ProcessImage(processedPath)
 		if err != nil {
-			return "", fmt.Errorf("OCR failed for image: %w", err)
+			return nil, fmt.Errorf("OCR failed for image: %w", err)
 		}
-		return result.Text, nil
+		return result, nil
 	}
 
-	return "", fmt.Errorf("file type %s not supported for OCR", ext)
+	return nil, fmt.Errorf("file type %s not supported for OCR", ext)
 }
 
 // GetDocumentMetadata extracts metadata from a document
@@ -403,8 +485,11 @@ func (dp *DocumentProcessor) GetDocumentMetadata(filePath string) (map[string]in
 	metadata["modified"] = info.ModTime()
 	metadata["name"] = info.Name()
 
-	// Add more metadata based on file type
-	// This is a placeholder for actual implementation
+	// Add page and text layer details for formats we can read natively
+	if extraction, err := extractNativeText(filePath); err == nil {
+		metadata["pageCount"] = len(extraction.Pages)
+		metadata["hasTextLayer"] = extraction.HasText()
+	}
 
 	return metadata, nil
 }
@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -13,6 +15,8 @@ import (
 type DocumentRouter struct {
 	folderManager     *FolderManager
 	documentProcessor *DocumentProcessor
+	searchIndex       *SearchIndex
+	manifestMutex     sync.Mutex // Serializes manifest updates across queue workers
 }
 
 // NewDocumentRouter creates a new document router
@@ -23,6 +27,11 @@ func NewDocumentRouter(folderManager *FolderManager, documentProcessor *Document
 	}
 }
 
+// SetSearchIndex sets the index routed documents are added to
+func (dr *DocumentRouter) SetSearchIndex(searchIndex *SearchIndex) {
+	dr.searchIndex = searchIndex
+}
+
 // RoutingResult represents the result of routing a document
 type RoutingResult struct {
 	SourcePath       string       `json:"sourcePath"`
@@ -32,10 +41,19 @@ type RoutingResult struct {
 	Error            string       `json:"error,omitempty"`
 	ProcessingTime   int64        `json:"processingTimeMs"`
 	AlreadyProcessed bool         `json:"alreadyProcessed"`
+	Duplicate        bool         `json:"duplicate,omitempty"` // Same content is already in the deal
+	Checksum         string       `json:"checksum,omitempty"`
+	Version          int          `json:"version,omitempty"`
 }
 
 // RouteDocument processes and routes a single document to the appropriate folder
 func (dr *DocumentRouter) RouteDocument(filePath string, dealName string) (*RoutingResult, error) {
+	return dr.RouteDocumentContext(context.Background(), filePath, dealName)
+}
+
+// RouteDocumentContext is RouteDocument with classification stopped when ctx
+// is done
+func (dr *DocumentRouter) RouteDocumentContext(ctx context.Context, filePath string, dealName string) (*RoutingResult, error) {
 	startTime := time.Now()
 
 	result := &RoutingResult{
@@ -53,7 +71,7 @@ func (dr *DocumentRouter) RouteDocument(filePath string, dealName string) (*Rout
 	}
 
 	// Process document to determine type
-	docInfo, err := dr.documentProcessor.ProcessDocument(filePath)
+	docInfo, err := dr.documentProcessor.ProcessDocumentContext(ctx, filePath, dealName)
 	if err != nil {
 		result.Error = fmt.Sprintf("failed to process document: %v", err)
 		result.ProcessingTime = time.Since(startTime).Milliseconds()
@@ -79,36 +97,119 @@ func (dr *DocumentRouter) RouteDocument(filePath string, dealName string) (*Rout
 		return result, err
 	}
 
-	// Check if file already exists in destination
-	fileName := filepath.Base(filePath)
-	destPath := filepath.Join(destFolder, fileName)
-
-	if _, err := os.Stat(destPath); err == nil {
-		// File already exists in the correct location
-		result.DestinationPath = destPath
+	entry, duplicate, err := dr.placeDocument(filePath, dealName, subfolder, destFolder, docInfo.Type)
+	if err != nil {
+		result.Error = err.Error()
 		result.DocumentType = docInfo.Type
-		result.Success = true
 		result.ProcessingTime = time.Since(startTime).Milliseconds()
-		result.AlreadyProcessed = true
-		return result, nil
+		return result, err
 	}
 
-	// Copy file to destination
-	if err := dr.copyFile(filePath, destPath); err != nil {
-		result.Error = fmt.Sprintf("failed to copy file: %v", err)
-		result.ProcessingTime = time.Since(startTime).Milliseconds()
-		return result, err
+	// A document whose text cannot be extracted is still filed
+	if dr.searchIndex != nil {
+		if err := dr.searchIndex.IndexDocument(dealName, entry.CanonicalPath, docInfo.Type); err != nil {
+			fmt.Printf("Warning: %s will not appear in content search: %v\n", filepath.Base(entry.CanonicalPath), err)
+		}
 	}
 
 	// Update result
-	result.DestinationPath = destPath
+	result.DestinationPath = entry.CanonicalPath
 	result.DocumentType = docInfo.Type
 	result.Success = true
+	result.AlreadyProcessed = duplicate
+	result.Duplicate = duplicate
+	result.Checksum = entry.Checksum
+	result.Version = entry.Version
 	result.ProcessingTime = time.Since(startTime).Milliseconds()
 
 	return result, nil
 }
 
+// placeDocument files a document in destFolder using the deal manifest.
+// Content already in the deal is reported as a duplicate and not copied; a
+// changed file with the name of an earlier document is kept alongside it as
+// the next version.
+func (dr *DocumentRouter) placeDocument(filePath, dealName, subfolder, destFolder string, docType DocumentType) (*ManifestEntry, bool, error) {
+	dr.manifestMutex.Lock()
+	defer dr.manifestMutex.Unlock()
+
+	checksum, err := fileChecksum(filePath)
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to hash document: %w", err)
+	}
+
+	manifestPath := dealManifestPath(dr.folderManager.GetDealPath(dealName))
+	manifest, err := loadDealManifest(manifestPath, dealName)
+	if err != nil {
+		return nil, false, err
+	}
+
+	fileName := filepath.Base(filePath)
+	sourcePath, _ := filepath.Abs(filePath)
+	destFolder, _ = filepath.Abs(destFolder)
+
+	if entry, ok := manifest.Entries[checksum]; ok && entry.CanonicalPath != "" {
+		if current, err := fileChecksum(entry.CanonicalPath); err == nil && current == checksum {
+			entry.addOriginalName(fileName)
+			entry.LastSeen = time.Now()
+			return entry, true, manifest.save(manifestPath)
+		}
+	}
+
+	// A file already in its folder, such as one queued by the folder watcher,
+	// is recorded where it is. If it replaced an earlier version in place,
+	// that version's content is gone.
+	inPlace := filepath.Dir(sourcePath) == destFolder
+	documentKey := manifestDocumentKey(subfolder, fileName)
+	if inPlace {
+		if previous := manifest.entryAtPath(sourcePath); previous != nil {
+			documentKey = previous.DocumentKey
+			previous.CanonicalPath = ""
+		}
+	}
+
+	// Adopt a file routed before the deal had a manifest as the first version
+	existingPath := filepath.Join(destFolder, fileName)
+	if !inPlace && manifest.latestVersion(documentKey) == 0 {
+		if existing, err := fileChecksum(existingPath); err == nil && manifest.Entries[existing] == nil {
+			adopted := manifest.record(existing, existingPath, documentKey, 1, docType, fileName)
+			if existing == checksum {
+				return adopted, true, manifest.save(manifestPath)
+			}
+		}
+	}
+
+	version := manifest.latestVersion(documentKey) + 1
+	destPath := sourcePath
+	if !inPlace {
+		// Skip names taken by files the manifest does not know about
+		for {
+			destPath = filepath.Join(destFolder, versionedFileName(fileName, version))
+			if _, err := os.Stat(destPath); os.IsNotExist(err) {
+				break
+			}
+			version++
+		}
+		if err := dr.copyFile(filePath, destPath); err != nil {
+			return nil, false, fmt.Errorf("failed to copy file: %w", err)
+		}
+	}
+
+	entry := manifest.record(checksum, destPath, documentKey, version, docType, fileName)
+	if err := manifest.save(manifestPath); err != nil {
+		return nil, false, err
+	}
+	return entry, false, nil
+}
+
+// GetManifest returns a deal's document manifest
+func (dr *DocumentRouter) GetManifest(dealName string) (*DealManifest, error) {
+	dr.manifestMutex.Lock()
+	defer dr.manifestMutex.Unlock()
+
+	return loadDealManifest(dealManifestPath(dr.folderManager.GetDealPath(dealName)), dealName)
+}
+
 // RouteDocuments processes and routes multiple documents
 func (dr *DocumentRouter) RouteDocuments(filePaths []string, dealName string) ([]*RoutingResult, error) {
 	results := make([]*RoutingResult, 0, len(filePaths))
@@ -259,6 +360,7 @@ func (dr *DocumentRouter) GetRoutingSummary(results []*RoutingResult) map[string
 		"total":      len(results),
 		"successful": 0,
 		"failed":     0,
+		"duplicates": 0,
 		"byType": map[string]int{
 			"legal":     0,
 			"financial": 0,
@@ -274,6 +376,9 @@ func (dr *DocumentRouter) GetRoutingSummary(results []*RoutingResult) map[string
 	for _, result := range results {
 		if result.Success {
 			summary["successful"] = summary["successful"].(int) + 1
+			if result.Duplicate {
+				summary["duplicates"] = summary["duplicates"].(int) + 1
+			}
 		} else {
 			summary["failed"] = summary["failed"].(int) + 1
 		}
@@ -75,7 +75,7 @@ func TestDocumentRouter(t *testing.T) {
 
 		for _, tc := range testCases {
 			testFile := filepath.Join(tempDir, tc.filename)
-			os.WriteFile(testFile, []byte("test"), 0644)
+			os.WriteFile(testFile, []byte("test "+tc.filename), 0644) // Distinct content, or later files are duplicates
 
 			result, err := dr.RouteDocument(testFile, dealName)
 			if err != nil {
@@ -279,3 +279,85 @@ func TestDocumentRouter(t *testing.T) {
 		}
 	})
 }
+
+func TestDocumentRouter_ContentManifest(t *testing.T) {
+	tempDir := t.TempDir()
+	cs := &ConfigService{config: &Config{DealDoneRoot: filepath.Join(tempDir, "DealDone")}}
+	fm := NewFolderManager(cs)
+	fm.InitializeFolderStructure()
+	dr := NewDocumentRouter(fm, NewDocumentProcessor(nil))
+
+	inbox := filepath.Join(tempDir, "inbox")
+	os.MkdirAll(inbox, 0755)
+	write := func(name, content string) string {
+		path := filepath.Join(inbox, name)
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write %s: %v", name, err)
+		}
+		return path
+	}
+
+	first, err := dr.RouteDocument(write("Financials.txt", "Income statement revenue 100 EBITDA 20"), "Acme")
+	if err != nil {
+		t.Fatalf("Failed to route document: %v", err)
+	}
+	if first.Duplicate || first.Version != 1 || len(first.Checksum) != 64 {
+		t.Errorf("Expected first version, got %+v", first)
+	}
+
+	// Same content under another name is not copied again
+	copyResult, _ := dr.RouteDocument(write("Financials (1).txt", "Income statement revenue 100 EBITDA 20"), "Acme")
+	if !copyResult.Duplicate || !copyResult.AlreadyProcessed || copyResult.DestinationPath != first.DestinationPath {
+		t.Errorf("Expected duplicate of %s, got %+v", first.DestinationPath, copyResult)
+	}
+
+	// A revised file with the same name is kept as v2 alongside v1
+	revised, _ := dr.RouteDocument(write("Financials.txt", "Income statement revenue 120 EBITDA 25"), "Acme")
+	if revised.Duplicate || revised.Version != 2 {
+		t.Errorf("Expected second version, got %+v", revised)
+	}
+	if filepath.Base(revised.DestinationPath) != "Financials_v2.txt" {
+		t.Errorf("Expected Financials_v2.txt, got %s", revised.DestinationPath)
+	}
+	if data, _ := os.ReadFile(first.DestinationPath); string(data) != "Income statement revenue 100 EBITDA 20" {
+		t.Errorf("Version 1 was modified: %q", data)
+	}
+
+	// Routing a filed document again finds it in place
+	again, _ := dr.RouteDocument(revised.DestinationPath, "Acme")
+	if !again.Duplicate || again.DestinationPath != revised.DestinationPath {
+		t.Errorf("Expected filed document to be a duplicate, got %+v", again)
+	}
+
+	manifest, err := dr.GetManifest("Acme")
+	if err != nil {
+		t.Fatalf("Failed to load manifest: %v", err)
+	}
+	if len(manifest.Entries) != 2 {
+		t.Errorf("Expected 2 manifest entries, got %d", len(manifest.Entries))
+	}
+	entry := manifest.Entries[first.Checksum]
+	if entry == nil || len(entry.OriginalNames) != 2 {
+		t.Errorf("Expected both original names on the first entry, got %+v", entry)
+	}
+	versions := manifest.Versions(entry.DocumentKey)
+	if len(versions) != 2 || versions[1].CanonicalPath != revised.DestinationPath {
+		t.Errorf("Expected two versions ending with %s, got %+v", revised.DestinationPath, versions)
+	}
+
+	t.Run("adopts files routed before the manifest", func(t *testing.T) {
+		destFolder := filepath.Dir(first.DestinationPath)
+		legacy := filepath.Join(destFolder, "Budget.txt")
+		os.WriteFile(legacy, []byte("Budget revenue forecast cash flow"), 0644)
+
+		same, _ := dr.RouteDocument(write("Budget.txt", "Budget revenue forecast cash flow"), "Acme")
+		if !same.Duplicate || same.DestinationPath != legacy || same.Version != 1 {
+			t.Errorf("Expected existing file adopted as v1, got %+v", same)
+		}
+
+		changed, _ := dr.RouteDocument(write("Budget.txt", "Budget revenue forecast cash flow revised"), "Acme")
+		if changed.Version != 2 || filepath.Base(changed.DestinationPath) != "Budget_v2.txt" {
+			t.Errorf("Expected Budget_v2.txt, got %+v", changed)
+		}
+	})
+}
@@ -0,0 +1,404 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// Embedder turns text into fixed-length vectors for semantic retrieval
+type Embedder interface {
+	// Name identifies the embedding model; vectors from different models
+	// are not comparable
+	Name() string
+	Dimensions() int
+	Embed(ctx context.Context, texts []string) ([][]float64, error)
+}
+
+// DefaultEmbeddingDimensions is used when a config leaves dimensions unset
+const DefaultEmbeddingDimensions = 128
+
+// Feature weights for the local embedder. Canonical line item concepts carry
+// the most weight so that "Net Revenue" and "Total Net Sales" land close
+// together even though they share only one word.
+const (
+	localConceptWeight = 3.0
+	localWordWeight    = 1.0
+	localBigramWeight  = 0.5
+	localTrigramWeight = 0.25
+)
+
+// maxConceptWords bounds the phrases checked against line item synonyms
+const maxConceptWords = 6
+
+// embeddingStopWords are dropped before hashing word features
+var embeddingStopWords = map[string]bool{
+	"the": true, "a": true, "an": true, "and": true, "or": true, "of": true,
+	"for": true, "to": true, "in": true, "on": true, "at": true, "by": true,
+	"with": true, "is": true, "are": true, "was": true, "were": true,
+}
+
+// LocalEmbedder is a deterministic embedder that hashes words, word bigrams,
+// character trigrams and recognized financial concepts into a fixed number of
+// dimensions. It needs no network access and always produces the same vector
+// for the same text.
+type LocalEmbedder struct {
+	dimensions int
+}
+
+// NewLocalEmbedder creates a local embedder with the given dimensions
+func NewLocalEmbedder(dimensions int) *LocalEmbedder {
+	if dimensions <= 0 {
+		dimensions = DefaultEmbeddingDimensions
+	}
+	return &LocalEmbedder{dimensions: dimensions}
+}
+
+// Name returns the model name, which includes the dimensions
+func (le *LocalEmbedder) Name() string {
+	return fmt.Sprintf("local-ngram-%d", le.dimensions)
+}
+
+// Dimensions returns the vector length
+func (le *LocalEmbedder) Dimensions() int {
+	return le.dimensions
+}
+
+// Embed returns one L2-normalized vector per text
+func (le *LocalEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	vectors := make([][]float64, len(texts))
+	for i, text := range texts {
+		vectors[i] = le.embed(text)
+	}
+	return vectors, nil
+}
+
+func (le *LocalEmbedder) embed(text string) []float64 {
+	vector := make([]float64, le.dimensions)
+	for feature, count := range embeddingFeatures(text) {
+		// Sublinear term frequency keeps repeated words from dominating
+		weight := count.weight * (1 + math.Log(float64(count.occurrences)))
+		index, sign := le.bucket(feature)
+		vector[index] += sign * weight
+	}
+	return normalizeVector(vector)
+}
+
+// bucket hashes a feature to a dimension and a sign; the sign halves the
+// bias introduced by collisions
+func (le *LocalEmbedder) bucket(feature string) (int, float64) {
+	hasher := fnv.New64a()
+	hasher.Write([]byte(feature))
+	sum := hasher.Sum64()
+	sign := 1.0
+	if sum&1 == 1 {
+		sign = -1.0
+	}
+	return int((sum >> 1) % uint64(le.dimensions)), sign
+}
+
+type embeddingFeature struct {
+	weight      float64
+	occurrences int
+}
+
+// embeddingFeatures extracts the weighted features hashed by LocalEmbedder
+func embeddingFeatures(text string) map[string]embeddingFeature {
+	features := make(map[string]embeddingFeature)
+	add := func(feature string, weight float64) {
+		current := features[feature]
+		current.weight = math.Max(current.weight, weight)
+		current.occurrences++
+		features[feature] = current
+	}
+
+	tokens := embeddingTokens(text)
+	words := make([]string, 0, len(tokens))
+	for _, token := range tokens {
+		if !embeddingStopWords[token] {
+			words = append(words, token)
+		}
+	}
+	for i, word := range words {
+		add("w:"+word, localWordWeight)
+		if i > 0 {
+			add("b:"+words[i-1]+"_"+word, localBigramWeight)
+		}
+		padded := " " + word + " "
+		runes := []rune(padded)
+		for j := 0; j+3 <= len(runes); j++ {
+			add("c:"+string(runes[j:j+3]), localTrigramWeight)
+		}
+	}
+
+	for _, concept := range embeddingConcepts(tokens) {
+		add("k:"+concept, localConceptWeight)
+	}
+
+	return features
+}
+
+// embeddingTokens lowercases text and splits it on anything that is not a
+// letter or digit, which also splits snake_case field names
+func embeddingTokens(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// embeddingConcepts finds canonical line items named by any run of words in
+// the text, so synonyms share a concept feature
+func embeddingConcepts(words []string) []string {
+	seen := make(map[string]bool)
+	concepts := make([]string, 0)
+	for start := 0; start < len(words); start++ {
+		for end := start + 1; end <= len(words) && end-start <= maxConceptWords; end++ {
+			canonical := canonicalLineItem(strings.Join(words[start:end], " "))
+			if canonical != "" && !seen[canonical] {
+				seen[canonical] = true
+				concepts = append(concepts, canonical)
+			}
+		}
+	}
+	sort.Strings(concepts)
+	return concepts
+}
+
+// normalizeVector scales a vector to unit length in place
+func normalizeVector(vector []float64) []float64 {
+	magnitude := 0.0
+	for _, val := range vector {
+		magnitude += val * val
+	}
+	magnitude = math.Sqrt(magnitude)
+	if magnitude > 0 {
+		for i := range vector {
+			vector[i] /= magnitude
+		}
+	}
+	return vector
+}
+
+// cosineSimilarity returns the cosine of the angle between two vectors, or 0
+// when their lengths differ or either is empty
+func cosineSimilarity(a, b []float64) float64 {
+	if len(a) != len(b) || len(a) == 0 {
+		return 0.0
+	}
+
+	dotProduct, normA, normB := 0.0, 0.0, 0.0
+	for i := range a {
+		dotProduct += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0.0
+	}
+	return dotProduct / (math.Sqrt(normA) * math.Sqrt(normB))
+}
+
+// HTTPEmbedder calls an OpenAI-style /embeddings endpoint. OpenAI, Voyage AI
+// (the embedding provider recommended for Claude) and most local
+// OpenAI-compatible servers share the same request and response shape.
+type HTTPEmbedder struct {
+	provider   string
+	endpoint   string
+	apiKey     string
+	model      string
+	dimensions int // learned from the first response when zero
+	httpClient *http.Client
+	policy     *OutboundPolicy // Screens the texts sent for embedding
+	mutex      sync.RWMutex
+}
+
+// NewHTTPEmbedder creates an embedder for an OpenAI-compatible endpoint.
+// Dimensions may be zero, in which case they are learned from the first
+// response.
+func NewHTTPEmbedder(provider, endpoint, apiKey, model string, dimensions int) *HTTPEmbedder {
+	return &HTTPEmbedder{
+		provider:   provider,
+		endpoint:   strings.TrimRight(endpoint, "/"),
+		apiKey:     apiKey,
+		model:      model,
+		dimensions: dimensions,
+		httpClient: &http.Client{
+			Timeout: time.Second * 30,
+		},
+	}
+}
+
+// NewOpenAIEmbedder creates an embedder backed by the OpenAI embeddings API
+func NewOpenAIEmbedder(apiKey, model string) *HTTPEmbedder {
+	if model == "" {
+		model = "text-embedding-3-small"
+	}
+	return NewHTTPEmbedder("openai", "https://api.openai.com/v1", apiKey, model, 0)
+}
+
+// NewVoyageEmbedder creates an embedder backed by the Voyage AI embeddings
+// API, which Anthropic recommends for use alongside Claude
+func NewVoyageEmbedder(apiKey, model string) *HTTPEmbedder {
+	if model == "" {
+		model = "voyage-3"
+	}
+	return NewHTTPEmbedder("voyage", "https://api.voyageai.com/v1", apiKey, model, 0)
+}
+
+// NewEmbedderForProvider returns the embedder for a provider name. "local" or
+// an empty name returns the deterministic local embedder.
+func NewEmbedderForProvider(provider, apiKey, model string, dimensions int) (Embedder, error) {
+	switch strings.ToLower(provider) {
+	case "", "local":
+		return NewLocalEmbedder(dimensions), nil
+	case "openai":
+		if apiKey == "" {
+			return nil, fmt.Errorf("openai embeddings require an API key")
+		}
+		return NewOpenAIEmbedder(apiKey, model), nil
+	case "voyage", "claude", "anthropic":
+		if apiKey == "" {
+			return nil, fmt.Errorf("voyage embeddings require an API key")
+		}
+		return NewVoyageEmbedder(apiKey, model), nil
+	default:
+		return nil, fmt.Errorf("unknown embedding provider: %s", provider)
+	}
+}
+
+// Name returns the provider and model
+func (he *HTTPEmbedder) Name() string {
+	return he.provider + ":" + he.model
+}
+
+// Dimensions returns the vector length, or 0 before the first response when
+// it was not configured
+func (he *HTTPEmbedder) Dimensions() int {
+	he.mutex.RLock()
+	defer he.mutex.RUnlock()
+	return he.dimensions
+}
+
+// SetOutboundPolicy screens every embedding request with policy, as for the
+// AI providers
+func (he *HTTPEmbedder) SetOutboundPolicy(policy *OutboundPolicy) {
+	he.mutex.Lock()
+	defer he.mutex.Unlock()
+	he.policy = policy
+}
+
+// expectDimensions returns the vector length responses must have, taking n
+// as the length when none is known yet
+func (he *HTTPEmbedder) expectDimensions(n int) int {
+	he.mutex.Lock()
+	defer he.mutex.Unlock()
+	if he.dimensions == 0 {
+		he.dimensions = n
+	}
+	return he.dimensions
+}
+
+type embeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float64 `json:"embedding"`
+	} `json:"data"`
+	Error *struct {
+		Message string `json:"message"`
+	} `json:"error,omitempty"`
+}
+
+// Embed sends all texts in one request and returns vectors in input order
+func (he *HTTPEmbedder) Embed(ctx context.Context, texts []string) ([][]float64, error) {
+	if len(texts) == 0 {
+		return [][]float64{}, nil
+	}
+
+	he.mutex.RLock()
+	policy := he.policy
+	he.mutex.RUnlock()
+	texts, _, err := screenOutbound(policy.attach(ctx, "embed"), AIProvider(he.provider), he.endpoint, texts)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := json.Marshal(embeddingRequest{Model: he.model, Input: texts})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal embedding request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", he.endpoint+"/embeddings", bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embedding request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if he.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+he.apiKey)
+	}
+
+	resp, err := he.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("embedding request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embedding response: %w", err)
+	}
+
+	var parsed embeddingResponse
+	if err := json.Unmarshal(respBody, &parsed); err != nil {
+		return nil, fmt.Errorf("failed to parse embedding response (status %d): %w", resp.StatusCode, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		if parsed.Error != nil {
+			return nil, fmt.Errorf("embedding API error (status %d): %s", resp.StatusCode, parsed.Error.Message)
+		}
+		return nil, fmt.Errorf("embedding API error: status %d", resp.StatusCode)
+	}
+	if len(parsed.Data) != len(texts) {
+		return nil, fmt.Errorf("embedding API returned %d vectors for %d inputs", len(parsed.Data), len(texts))
+	}
+
+	dimensions := he.expectDimensions(len(parsed.Data[0].Embedding))
+	vectors := make([][]float64, len(texts))
+	for _, item := range parsed.Data {
+		if item.Index < 0 || item.Index >= len(texts) {
+			return nil, fmt.Errorf("embedding API returned out-of-range index %d", item.Index)
+		}
+		if len(item.Embedding) != dimensions {
+			return nil, fmt.Errorf("embedding has %d dimensions, expected %d", len(item.Embedding), dimensions)
+		}
+		vectors[item.Index] = normalizeVector(item.Embedding)
+	}
+
+	return vectors, nil
+}
+
+// embedOne is a convenience wrapper for embedding a single text
+func embedOne(ctx context.Context, embedder Embedder, text string) ([]float64, error) {
+	vectors, err := embedder.Embed(ctx, []string{text})
+	if err != nil {
+		return nil, err
+	}
+	if len(vectors) != 1 {
+		return nil, fmt.Errorf("embedder returned %d vectors for 1 input", len(vectors))
+	}
+	return vectors[0], nil
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalEmbedderSimilarity(t *testing.T) {
+	embedder := NewLocalEmbedder(128)
+	assert.Equal(t, "local-ngram-128", embedder.Name())
+
+	vectors, err := embedder.Embed(context.Background(), []string{
+		"Net Revenue", "Total Net Sales", "Net Income", "Purchase Price", "Net Revenue",
+	})
+	require.NoError(t, err)
+	require.Len(t, vectors, 5)
+	assert.Len(t, vectors[0], 128)
+
+	// Deterministic and unit length
+	assert.Equal(t, vectors[0], vectors[4])
+	assert.InDelta(t, 1.0, cosineSimilarity(vectors[0], vectors[0]), 1e-9)
+
+	synonyms := cosineSimilarity(vectors[0], vectors[1])
+	assert.Greater(t, synonyms, 0.7, "revenue synonyms should be close")
+	assert.Greater(t, synonyms, cosineSimilarity(vectors[0], vectors[2]))
+	assert.Less(t, cosineSimilarity(vectors[0], vectors[3]), 0.3)
+
+	// snake_case field names match their labels
+	snake, err := embedOne(context.Background(), embedder, "net_income")
+	require.NoError(t, err)
+	assert.Greater(t, cosineSimilarity(snake, vectors[2]), 0.9)
+}
+
+func TestHTTPEmbedder(t *testing.T) {
+	var request embeddingRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/embeddings", r.URL.Path)
+		assert.Equal(t, "Bearer test-key", r.Header.Get("Authorization"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+
+		// Return vectors out of order to check they are placed by index
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"data": [
+			{"index": 1, "embedding": [0, 3, 4]},
+			{"index": 0, "embedding": [2, 0, 0]}
+		]}`))
+	}))
+	defer server.Close()
+
+	embedder := NewHTTPEmbedder("openai", server.URL+"/v1/", "test-key", "text-embedding-3-small", 0)
+	vectors, err := embedder.Embed(context.Background(), []string{"Net Revenue", "EBITDA"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "text-embedding-3-small", request.Model)
+	assert.Equal(t, []string{"Net Revenue", "EBITDA"}, request.Input)
+	assert.Equal(t, []float64{1, 0, 0}, vectors[0])
+	assert.Equal(t, []float64{0, 0.6, 0.8}, vectors[1])
+	assert.Equal(t, 3, embedder.Dimensions())
+	assert.Equal(t, "openai:text-embedding-3-small", embedder.Name())
+}
+
+func TestHTTPEmbedderConcurrentCalls(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"data": [{"index": 0, "embedding": [3, 4]}]}`))
+	}))
+	defer server.Close()
+
+	// The first responses learn the dimensions while other calls read them
+	embedder := NewHTTPEmbedder("openai", server.URL, "", "text-embedding-3-small", 0)
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := embedder.Embed(context.Background(), []string{"Net Revenue"})
+			assert.NoError(t, err)
+			embedder.Dimensions()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 2, embedder.Dimensions())
+}
+
+func TestHTTPEmbedderErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		w.Write([]byte(`{"error": {"message": "invalid api key"}}`))
+	}))
+	defer server.Close()
+
+	_, err := NewHTTPEmbedder("voyage", server.URL, "bad", "voyage-3", 0).Embed(context.Background(), []string{"x"})
+	assert.ErrorContains(t, err, "invalid api key")
+
+	_, err = NewEmbedderForProvider("openai", "", "", 0)
+	assert.Error(t, err)
+	_, err = NewEmbedderForProvider("unknown", "key", "", 0)
+	assert.Error(t, err)
+
+	local, err := NewEmbedderForProvider("", "", "", 64)
+	require.NoError(t, err)
+	assert.Equal(t, 64, local.Dimensions())
+}
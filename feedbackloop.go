@@ -2,7 +2,6 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
 	"math"
 	"os"
@@ -112,6 +111,24 @@ type FeedbackLoopConfig struct {
 	EnableBatchProcessing    bool                         `json:"enable_batch_processing"`
 	UserTrustWeighting       float64                      `json:"user_trust_weighting"`
 	SeverityMultipliers      map[FeedbackSeverity]float64 `json:"severity_multipliers"`
+
+	// Repository persists feedback; when nil it is kept in a state store
+	// under StoragePath
+	Repository FeedbackRepository `json:"-"`
+}
+
+// FeedbackRepository persists the feedback loop's state
+type FeedbackRepository interface {
+	LoadFeedbackState() (*FeedbackLoopState, error)
+	SaveFeedbackState(state *FeedbackLoopState) error
+}
+
+// FeedbackLoopState is the persisted part of the feedback loop
+type FeedbackLoopState struct {
+	FeedbackHistory      map[string]*UserFeedback        `json:"feedback_history"`
+	UserFeedbackProfiles map[string]*UserFeedbackProfile `json:"user_feedback_profiles"`
+	LearningAdjustments  map[string]*LearningAdjustment  `json:"learning_adjustments"`
+	Metrics              FeedbackMetrics                 `json:"metrics"`
 }
 
 // UserFeedbackProfile tracks a user's feedback patterns
@@ -382,6 +399,13 @@ func NewFeedbackLoop(config FeedbackLoopConfig, correctionProcessor *CorrectionP
 	if err := os.MkdirAll(config.StoragePath, 0755); err != nil {
 		logger.Error("Failed to create feedback storage directory: %v", err)
 	}
+	if loop.config.Repository == nil {
+		repo := openComponentStore(config.StoragePath)
+		if err := repo.importLegacyFeedback(filepath.Join(config.StoragePath, "feedback_state.json")); err != nil {
+			logger.Warn("Failed to import feedback state: %v", err)
+		}
+		loop.config.Repository = repo
+	}
 
 	// Load existing state
 	if err := loop.loadState(); err != nil {
@@ -891,7 +915,10 @@ func (fl *FeedbackLoop) startFeedbackProcessing() {
 
 	for {
 		select {
-		case feedback := <-fl.feedbackQueue:
+		case feedback, ok := <-fl.feedbackQueue:
+			if !ok {
+				return
+			}
 			if err := fl.processFeedback(feedback); err != nil {
 				fl.logger.Error("Failed to process feedback %s: %v", feedback.ID, err)
 			}
@@ -1101,70 +1128,32 @@ func (fl *FeedbackLoop) Shutdown() error {
 }
 
 func (fl *FeedbackLoop) saveState() error {
-	statePath := filepath.Join(fl.config.StoragePath, "feedback_state.json")
-	tempPath := statePath + ".tmp"
-
-	// Create state snapshot
-	state := struct {
-		FeedbackHistory      map[string]*UserFeedback        `json:"feedback_history"`
-		UserFeedbackProfiles map[string]*UserFeedbackProfile `json:"user_feedback_profiles"`
-		LearningAdjustments  map[string]*LearningAdjustment  `json:"learning_adjustments"`
-		Metrics              FeedbackMetrics                 `json:"metrics"`
-		Timestamp            time.Time                       `json:"timestamp"`
-	}{
+	fl.mutex.RLock()
+	defer fl.mutex.RUnlock()
+
+	err := fl.config.Repository.SaveFeedbackState(&FeedbackLoopState{
 		FeedbackHistory:      fl.feedbackHistory,
 		UserFeedbackProfiles: fl.userFeedbackProfiles,
 		LearningAdjustments:  fl.learningAdjustments,
 		Metrics:              fl.metrics,
-		Timestamp:            time.Now(),
-	}
-
-	// Marshal to JSON
-	data, err := json.MarshalIndent(state, "", "  ")
+	})
 	if err != nil {
-		return fmt.Errorf("failed to marshal state: %w", err)
-	}
-
-	// Write to temporary file first
-	if err := os.WriteFile(tempPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write temporary state file: %w", err)
-	}
-
-	// Atomic rename
-	if err := os.Rename(tempPath, statePath); err != nil {
-		return fmt.Errorf("failed to rename state file: %w", err)
+		return err
 	}
 
 	fl.logger.Debug("Feedback loop state saved successfully")
 	return nil
 }
 
-// loadState loads the feedback loop state from disk
+// loadState loads the feedback loop state from the state store
 func (fl *FeedbackLoop) loadState() error {
-	statePath := filepath.Join(fl.config.StoragePath, "feedback_state.json")
-
-	// Check if state file exists
-	if _, err := os.Stat(statePath); os.IsNotExist(err) {
-		fl.logger.Info("No existing feedback state found, starting fresh")
-		return nil
-	}
-
-	// Read state file
-	data, err := os.ReadFile(statePath)
+	state, err := fl.config.Repository.LoadFeedbackState()
 	if err != nil {
-		return fmt.Errorf("failed to read state file: %w", err)
-	}
-
-	// Parse state
-	var state struct {
-		FeedbackHistory      map[string]*UserFeedback        `json:"feedback_history"`
-		UserFeedbackProfiles map[string]*UserFeedbackProfile `json:"user_feedback_profiles"`
-		LearningAdjustments  map[string]*LearningAdjustment  `json:"learning_adjustments"`
-		Metrics              FeedbackMetrics                 `json:"metrics"`
+		return err
 	}
-
-	if err := json.Unmarshal(data, &state); err != nil {
-		return fmt.Errorf("failed to parse state file: %w", err)
+	if state == nil {
+		fl.logger.Info("No existing feedback state found, starting fresh")
+		return nil
 	}
 
 	// Restore state
@@ -0,0 +1,845 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// StatementType identifies the financial statement a table belongs to
+type StatementType string
+
+const (
+	StatementIncome   StatementType = "income_statement"
+	StatementBalance  StatementType = "balance_sheet"
+	StatementCashFlow StatementType = "cash_flow"
+	StatementUnknown  StatementType = "unknown"
+)
+
+// PeriodInfo is a parsed reporting period label such as "FY2023" or "Q1 2024"
+type PeriodInfo struct {
+	Label     string `json:"label"`
+	Year      int    `json:"year"`
+	Quarter   int    `json:"quarter,omitempty"`
+	Half      int    `json:"half,omitempty"`
+	Month     int    `json:"month,omitempty"`
+	Projected bool   `json:"projected,omitempty"` // Estimate, budget or forecast column
+}
+
+// SortKey orders periods chronologically
+func (p PeriodInfo) SortKey() int {
+	switch {
+	case p.Month > 0:
+		return p.Year*100 + p.Month
+	case p.Quarter > 0:
+		return p.Year*100 + p.Quarter*3
+	case p.Half > 0:
+		return p.Year*100 + p.Half*6
+	default:
+		return p.Year*100 + 12
+	}
+}
+
+// IsAnnual reports whether the period covers a full year
+func (p PeriodInfo) IsAnnual() bool {
+	return p.Quarter == 0 && p.Half == 0 && p.Month == 0
+}
+
+// LineItemSource records where a value was read from
+type LineItemSource struct {
+	Document string `json:"document"`
+	Page     int    `json:"page,omitempty"`
+	Sheet    string `json:"sheet,omitempty"`
+	Cell     string `json:"cell,omitempty"`
+	Row      int    `json:"row,omitempty"`
+}
+
+// FinancialLineItem is a single typed value from a financial statement table
+type FinancialLineItem struct {
+	LineItem  string         `json:"lineItem"`
+	Canonical string         `json:"canonical,omitempty"` // Normalized name, e.g. "revenue"
+	Statement StatementType  `json:"statement"`
+	Period    PeriodInfo     `json:"period"`
+	Value     float64        `json:"value"` // Value after applying Scale
+	RawValue  string         `json:"rawValue"`
+	Unit      string         `json:"unit"`  // Currency code, "%" or "x"
+	Scale     float64        `json:"scale"` // 1, 1e3, 1e6 or 1e9
+	Source    LineItemSource `json:"source"`
+}
+
+// FinancialTable is a statement table with its period columns and rows
+type FinancialTable struct {
+	Title     string              `json:"title,omitempty"`
+	Statement StatementType       `json:"statement"`
+	Periods   []PeriodInfo        `json:"periods"`
+	Unit      string              `json:"unit"`
+	Scale     float64             `json:"scale"`
+	Rows      []FinancialLineItem `json:"rows"`
+	Source    LineItemSource      `json:"source"`
+}
+
+// FinancialTableExtractor turns statement tables in spreadsheets, PDFs and
+// scans into typed line items
+type FinancialTableExtractor struct {
+	documentProcessor *DocumentProcessor
+}
+
+// NewFinancialTableExtractor creates a table extractor. The document
+// processor is optional and enables OCR for scanned statements.
+func NewFinancialTableExtractor(documentProcessor *DocumentProcessor) *FinancialTableExtractor {
+	return &FinancialTableExtractor{
+		documentProcessor: documentProcessor,
+	}
+}
+
+// ExtractTables finds financial statement tables in a document
+func (fte *FinancialTableExtractor) ExtractTables(filePath string) ([]FinancialTable, error) {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	document := filepath.Base(filePath)
+
+	switch ext {
+	case ".xlsx", ".xlsm":
+		return fte.extractFromWorkbook(filePath)
+	case ".csv":
+		grid, err := readCSVGrid(filePath)
+		if err != nil {
+			return nil, err
+		}
+		return extractTablesFromGrid(grid, LineItemSource{Document: document}, true), nil
+	case ".jpg", ".jpeg", ".png", ".tif", ".tiff", ".bmp":
+		if fte.documentProcessor == nil || fte.documentProcessor.ocrService == nil || !fte.documentProcessor.ocrService.IsEnabled() {
+			return nil, fmt.Errorf("table extraction from images requires OCR service")
+		}
+		grid, err := fte.documentProcessor.ocrService.ExtractTables(filePath)
+		if err != nil {
+			return nil, err
+		}
+		return extractTablesFromGrid(grid, LineItemSource{Document: document, Page: 1}, false), nil
+	}
+
+	var extraction *TextExtraction
+	var err error
+	if fte.documentProcessor != nil {
+		extraction, err = fte.documentProcessor.ExtractPages(filePath)
+	} else {
+		extraction, err = extractNativeText(filePath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	tables := make([]FinancialTable, 0)
+	for _, page := range extraction.Pages {
+		source := LineItemSource{Document: document, Page: page.Number}
+		tables = append(tables, extractTablesFromText(page.Text, source)...)
+	}
+	return tables, nil
+}
+
+// ExtractLineItems returns every line item found in a document
+func (fte *FinancialTableExtractor) ExtractLineItems(filePath string) ([]FinancialLineItem, error) {
+	tables, err := fte.ExtractTables(filePath)
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]FinancialLineItem, 0)
+	for _, table := range tables {
+		items = append(items, table.Rows...)
+	}
+	return items, nil
+}
+
+// extractFromWorkbook reads each worksheet as a cell grid
+func (fte *FinancialTableExtractor) extractFromWorkbook(filePath string) ([]FinancialTable, error) {
+	f, err := excelize.OpenFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spreadsheet: %w", err)
+	}
+	defer f.Close()
+
+	tables := make([]FinancialTable, 0)
+	for _, sheet := range f.GetSheetList() {
+		rows, err := f.GetRows(sheet)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sheet %s: %w", sheet, err)
+		}
+		source := LineItemSource{Document: filepath.Base(filePath), Sheet: sheet}
+		sheetTables := extractTablesFromGrid(rows, source, true)
+
+		// Worksheet names often carry the statement type ("P&L", "BS")
+		for i := range sheetTables {
+			if sheetTables[i].Statement == StatementUnknown {
+				if statement := detectStatementType(sheet); statement != StatementUnknown {
+					sheetTables[i].setStatement(statement)
+				}
+			}
+		}
+		tables = append(tables, sheetTables...)
+	}
+	return tables, nil
+}
+
+// setStatement updates the statement type of the table and its rows
+func (ft *FinancialTable) setStatement(statement StatementType) {
+	ft.Statement = statement
+	for i := range ft.Rows {
+		ft.Rows[i].Statement = statement
+	}
+}
+
+// readCSVGrid reads a CSV file into a string grid
+func readCSVGrid(filePath string) ([][]string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CSV file: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	grid, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CSV file: %w", err)
+	}
+	return grid, nil
+}
+
+// tableBuilder accumulates rows for the table currently being read
+type tableBuilder struct {
+	table       FinancialTable
+	periodCols  map[int]PeriodInfo // Column index to period for aligned grids
+	context     []string           // Text seen above the header (titles, unit notes)
+	hasExplicit bool               // Statement type came from a title
+}
+
+// extractTablesFromGrid finds statement tables in a grid of cells. When
+// aligned is true, values are matched to periods by column index (spreadsheets);
+// otherwise trailing numeric cells are right-aligned to the period columns.
+func extractTablesFromGrid(grid [][]string, source LineItemSource, aligned bool) []FinancialTable {
+	tables := make([]FinancialTable, 0)
+	var current *tableBuilder
+	context := make([]string, 0)
+	// A unit note ("in millions") usually applies to later tables as well
+	lastScale := 1.0
+
+	flush := func() {
+		if current != nil && len(current.table.Rows) > 0 {
+			current.finish()
+			tables = append(tables, current.table)
+		}
+		current = nil
+	}
+
+	for rowIndex, row := range grid {
+		cells := trimCells(row)
+		if len(cells) == 0 {
+			continue
+		}
+
+		if periods := headerPeriods(row); len(periods) > 0 {
+			flush()
+			current = newTableBuilder(periods, context, source, lastScale)
+			lastScale = current.table.Scale
+			context = context[:0]
+			continue
+		}
+
+		if current == nil {
+			context = appendContext(context, strings.Join(cells, " "))
+			continue
+		}
+
+		label, values := splitLabelAndValues(row, current, aligned)
+		if label == "" {
+			continue
+		}
+		if len(values) == 0 {
+			// Section headings inside a table ("Operating activities") and
+			// new statement titles
+			if statement := detectStatementType(label); statement != StatementUnknown && isStatementTitle(label) {
+				flush()
+				context = appendContext(context[:0], label)
+			}
+			continue
+		}
+
+		for col, value := range values {
+			period := current.periodForColumn(col)
+			cellSource := source
+			cellSource.Row = rowIndex + 1
+			if aligned && source.Sheet != "" {
+				cellSource.Cell, _ = excelize.CoordinatesToCellName(col+1, rowIndex+1)
+			}
+			current.addValue(label, period, value, cellSource)
+		}
+	}
+	flush()
+
+	return tables
+}
+
+// extractTablesFromText splits extracted page text into a grid and finds
+// statement tables in it
+func extractTablesFromText(text string, source LineItemSource) []FinancialTable {
+	grid := make([][]string, 0)
+	for _, line := range strings.Split(text, "\n") {
+		grid = append(grid, splitTextRow(line))
+	}
+	return extractTablesFromGrid(grid, source, false)
+}
+
+var multiSpacePattern = regexp.MustCompile(`\t|\s{2,}`)
+
+// splitTextRow splits a line of text into cells. Lines without column gaps
+// are split into a label followed by trailing numeric tokens.
+func splitTextRow(line string) []string {
+	line = strings.TrimSpace(line)
+	if line == "" {
+		return nil
+	}
+	if multiSpacePattern.MatchString(line) {
+		return multiSpacePattern.Split(line, -1)
+	}
+
+	// Period header lines ("FY2022 FY2023", "Q1 2024 Q2 2024")
+	if periods := findPeriodLabels(line); len(periods) > 0 {
+		return periods
+	}
+
+	tokens := strings.Fields(line)
+	split := len(tokens)
+	for split > 0 {
+		if _, _, ok := parseFinancialNumber(tokens[split-1]); !ok && !isEmptyValue(tokens[split-1]) {
+			break
+		}
+		split--
+	}
+	cells := make([]string, 0, len(tokens)-split+1)
+	if split > 0 {
+		cells = append(cells, strings.Join(tokens[:split], " "))
+	}
+	return append(cells, tokens[split:]...)
+}
+
+func trimCells(row []string) []string {
+	cells := make([]string, 0, len(row))
+	for _, cell := range row {
+		if trimmed := strings.TrimSpace(cell); trimmed != "" {
+			cells = append(cells, trimmed)
+		}
+	}
+	return cells
+}
+
+func appendContext(context []string, text string) []string {
+	context = append(context, text)
+	if len(context) > 5 {
+		context = context[len(context)-5:]
+	}
+	return context
+}
+
+func newTableBuilder(periods map[int]PeriodInfo, context []string, source LineItemSource, defaultScale float64) *tableBuilder {
+	builder := &tableBuilder{
+		periodCols: periods,
+		context:    append([]string(nil), context...),
+	}
+
+	cols := make([]int, 0, len(periods))
+	for col := range periods {
+		cols = append(cols, col)
+	}
+	sort.Ints(cols)
+	for _, col := range cols {
+		builder.table.Periods = append(builder.table.Periods, periods[col])
+	}
+
+	contextText := strings.Join(context, " ")
+	builder.table.Source = source
+	builder.table.Scale = detectScale(contextText)
+	if builder.table.Scale == 1 {
+		builder.table.Scale = defaultScale
+	}
+	builder.table.Unit = detectCurrency(contextText)
+	builder.table.Statement = detectStatementType(contextText)
+	builder.hasExplicit = builder.table.Statement != StatementUnknown
+	if len(context) > 0 {
+		builder.table.Title = context[0]
+		for _, line := range context {
+			if detectStatementType(line) != StatementUnknown {
+				builder.table.Title = line
+				break
+			}
+		}
+	}
+	return builder
+}
+
+// periodForColumn returns the period of a value column
+func (tb *tableBuilder) periodForColumn(col int) PeriodInfo {
+	if period, ok := tb.periodCols[col]; ok {
+		return period
+	}
+	return PeriodInfo{}
+}
+
+// addValue appends a line item for a parsed cell
+func (tb *tableBuilder) addValue(label string, period PeriodInfo, raw string, source LineItemSource) {
+	number, unit, ok := parseFinancialNumber(raw)
+	if !ok || period.Year == 0 {
+		return
+	}
+
+	item := FinancialLineItem{
+		LineItem:  label,
+		Canonical: canonicalLineItem(label),
+		Statement: tb.table.Statement,
+		Period:    period,
+		RawValue:  raw,
+		Unit:      tb.table.Unit,
+		Scale:     tb.table.Scale,
+		Source:    source,
+	}
+
+	switch {
+	case unit == "%" || unit == "x":
+		item.Unit = unit
+		item.Scale = 1
+		item.Value = number
+	case strings.Contains(strings.ToLower(label), "margin") || strings.Contains(label, "%"):
+		item.Unit = "%"
+		item.Scale = 1
+		item.Value = number
+	default:
+		if unit != "" {
+			item.Unit = unit
+		}
+		item.Value = number * tb.table.Scale
+	}
+
+	tb.table.Rows = append(tb.table.Rows, item)
+}
+
+// finish infers the statement type from line items when no title named it
+func (tb *tableBuilder) finish() {
+	if tb.hasExplicit {
+		return
+	}
+	votes := map[StatementType]int{}
+	for _, row := range tb.table.Rows {
+		if statement, ok := canonicalStatements[row.Canonical]; ok {
+			votes[statement]++
+		}
+	}
+	best, bestVotes := StatementUnknown, 0
+	for _, statement := range []StatementType{StatementIncome, StatementBalance, StatementCashFlow} {
+		if votes[statement] > bestVotes {
+			best, bestVotes = statement, votes[statement]
+		}
+	}
+	tb.table.setStatement(best)
+}
+
+// headerPeriods returns column index to period for a header row, or nil if
+// the row is not a period header
+func headerPeriods(row []string) map[int]PeriodInfo {
+	periods := make(map[int]PeriodInfo)
+	for col, cell := range row {
+		cell = strings.TrimSpace(cell)
+		if cell == "" {
+			continue
+		}
+		if period, ok := parsePeriodLabel(cell); ok {
+			periods[col] = period
+			continue
+		}
+		// A non-period number means this is a data row
+		if _, _, ok := parseFinancialNumber(cell); ok {
+			return nil
+		}
+	}
+	return periods
+}
+
+// splitLabelAndValues separates the row label from its value cells, keyed
+// by the column of the period each value belongs to
+func splitLabelAndValues(row []string, tb *tableBuilder, aligned bool) (string, map[int]string) {
+	values := make(map[int]string)
+	labelParts := make([]string, 0)
+	numericCols := make([]int, 0)
+
+	// Value slots include placeholders such as "-" so that alignment is kept
+	for col, cell := range row {
+		cell = strings.TrimSpace(cell)
+		if cell == "" {
+			continue
+		}
+		if _, _, ok := parseFinancialNumber(cell); ok || isEmptyValue(cell) {
+			numericCols = append(numericCols, col)
+			continue
+		}
+		if len(numericCols) == 0 {
+			labelParts = append(labelParts, cell)
+		}
+	}
+	label := strings.Join(labelParts, " ")
+
+	if aligned {
+		for _, col := range numericCols {
+			if _, ok := tb.periodCols[col]; ok && !isEmptyValue(row[col]) {
+				values[col] = strings.TrimSpace(row[col])
+			}
+		}
+		return label, values
+	}
+
+	// Right-align trailing values to the period columns
+	periodCols := make([]int, 0, len(tb.periodCols))
+	for col := range tb.periodCols {
+		periodCols = append(periodCols, col)
+	}
+	sort.Ints(periodCols)
+	offset := len(periodCols) - len(numericCols)
+	for i, col := range numericCols {
+		target := offset + i
+		if target < 0 || target >= len(periodCols) || isEmptyValue(row[col]) {
+			continue
+		}
+		values[periodCols[target]] = strings.TrimSpace(row[col])
+	}
+	return label, values
+}
+
+var (
+	periodFiscalPattern  = regexp.MustCompile(`(?i)^(?:FY|CY)\s*'?(\d{2}|\d{4})\s*([AEBFP])?$`)
+	periodYearPattern    = regexp.MustCompile(`^((?:19|20)\d{2})\s*([AEBFP])?$`)
+	periodQuarterPattern = regexp.MustCompile(`(?i)^Q([1-4])\s*(?:FY|CY)?\s*'?(\d{2}|\d{4})\s*([AEBFP])?$`)
+	periodYearQPattern   = regexp.MustCompile(`(?i)^((?:19|20)\d{2})\s*-?\s*Q([1-4])\s*([AEBFP])?$`)
+	periodHalfPattern    = regexp.MustCompile(`(?i)^H([12])\s*(?:FY|CY)?\s*'?(\d{2}|\d{4})\s*([AEBFP])?$`)
+	periodMonthPattern   = regexp.MustCompile(`(?i)^(jan|feb|mar|apr|may|jun|jul|aug|sep|oct|nov|dec)[a-z]*\.?[\s\-']*(\d{2}|\d{4})$`)
+	periodEndedPattern   = regexp.MustCompile(`(?i)^(?:fiscal\s+)?(?:year|twelve months|12 months)\s+end(?:ed|ing)\b.*?((?:19|20)\d{2})$`)
+	periodSearchPattern  = regexp.MustCompile(`(?i)\b(?:(?:FY|CY)\s*'?\d{2,4}[AEBFP]?|Q[1-4]\s*'?\d{2,4}|H[12]\s*'?\d{2,4}|(?:19|20)\d{2}\s*-?\s*Q[1-4]|(?:19|20)\d{2}[AEBFP]?)\b`)
+)
+
+var monthNumbers = map[string]int{
+	"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+	"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+}
+
+// parsePeriodLabel parses a column header into a period
+func parsePeriodLabel(label string) (PeriodInfo, bool) {
+	label = strings.TrimSpace(label)
+	period := PeriodInfo{Label: label}
+
+	projected := func(suffix string) bool {
+		return suffix != "" && strings.ToUpper(suffix) != "A"
+	}
+
+	if m := periodFiscalPattern.FindStringSubmatch(label); m != nil {
+		period.Year = normalizeYear(m[1])
+		period.Projected = projected(m[2])
+		return period, true
+	}
+	if m := periodYearPattern.FindStringSubmatch(label); m != nil {
+		period.Year = normalizeYear(m[1])
+		period.Projected = projected(m[2])
+		return period, true
+	}
+	if m := periodQuarterPattern.FindStringSubmatch(label); m != nil {
+		period.Quarter, _ = strconv.Atoi(m[1])
+		period.Year = normalizeYear(m[2])
+		period.Projected = projected(m[3])
+		return period, true
+	}
+	if m := periodYearQPattern.FindStringSubmatch(label); m != nil {
+		period.Year = normalizeYear(m[1])
+		period.Quarter, _ = strconv.Atoi(m[2])
+		period.Projected = projected(m[3])
+		return period, true
+	}
+	if m := periodHalfPattern.FindStringSubmatch(label); m != nil {
+		period.Half, _ = strconv.Atoi(m[1])
+		period.Year = normalizeYear(m[2])
+		period.Projected = projected(m[3])
+		return period, true
+	}
+	if m := periodMonthPattern.FindStringSubmatch(label); m != nil {
+		period.Month = monthNumbers[strings.ToLower(m[1])]
+		period.Year = normalizeYear(m[2])
+		return period, true
+	}
+	if m := periodEndedPattern.FindStringSubmatch(label); m != nil {
+		period.Year = normalizeYear(m[1])
+		return period, true
+	}
+	return PeriodInfo{}, false
+}
+
+// findPeriodLabels returns the period labels on a line if the line is made
+// up of period headers and little else
+func findPeriodLabels(line string) []string {
+	matches := periodSearchPattern.FindAllString(line, -1)
+	if len(matches) == 0 {
+		return nil
+	}
+	rest := periodSearchPattern.ReplaceAllString(line, "")
+	if len(strings.Fields(rest)) > 3 {
+		return nil
+	}
+	for _, match := range matches {
+		if _, ok := parsePeriodLabel(match); !ok {
+			return nil
+		}
+	}
+	return matches
+}
+
+func normalizeYear(value string) int {
+	year, _ := strconv.Atoi(value)
+	if year < 100 {
+		year += 2000
+	}
+	return year
+}
+
+var (
+	numberCleanPattern = regexp.MustCompile(`^[\$€£¥]?\s*-?[\d,]*\.?\d+$`)
+	numberSuffixScales = map[string]float64{"k": 1e3, "m": 1e6, "mm": 1e6, "bn": 1e9, "b": 1e9}
+)
+
+// parseFinancialNumber parses a statement cell such as "(1,234.5)", "$25m",
+// "34.2%" or "8.5x". It returns the number, any unit found in the cell and
+// whether the cell was numeric.
+func parseFinancialNumber(cell string) (float64, string, bool) {
+	s := strings.TrimSpace(cell)
+	if s == "" {
+		return 0, "", false
+	}
+
+	negative := false
+	if strings.HasPrefix(s, "(") && strings.HasSuffix(s, ")") {
+		negative = true
+		s = strings.TrimSpace(s[1 : len(s)-1])
+	}
+	if strings.HasPrefix(s, "-") || strings.HasPrefix(s, "−") {
+		negative = !negative
+		s = strings.TrimLeft(s, "-−")
+	}
+
+	unit := ""
+	switch {
+	case strings.HasPrefix(s, "$"):
+		unit = "USD"
+	case strings.HasPrefix(s, "€"):
+		unit = "EUR"
+	case strings.HasPrefix(s, "£"):
+		unit = "GBP"
+	}
+	s = strings.TrimLeft(s, "$€£¥ ")
+
+	multiplier := 1.0
+	lower := strings.ToLower(s)
+	switch {
+	case strings.HasSuffix(lower, "%"):
+		unit = "%"
+		s = strings.TrimSpace(s[:len(s)-1])
+	case strings.HasSuffix(lower, "x") && len(s) > 1:
+		unit = "x"
+		s = strings.TrimSpace(s[:len(s)-1])
+	default:
+		for suffix, scale := range numberSuffixScales {
+			if strings.HasSuffix(lower, suffix) && len(lower) > len(suffix) && isASCIIDigit(lower[len(lower)-len(suffix)-1]) {
+				multiplier = scale
+				s = s[:len(s)-len(suffix)]
+				break
+			}
+		}
+	}
+
+	if !numberCleanPattern.MatchString(s) {
+		return 0, "", false
+	}
+	value, err := strconv.ParseFloat(strings.ReplaceAll(s, ",", ""), 64)
+	if err != nil {
+		return 0, "", false
+	}
+	if negative {
+		value = -value
+	}
+	return value * multiplier, unit, true
+}
+
+// isEmptyValue reports whether a cell is a placeholder for no value
+func isEmptyValue(cell string) bool {
+	switch strings.ToLower(strings.TrimSpace(cell)) {
+	case "-", "–", "—", "n/a", "na", "n.a.", "nm", "n.m.", "--":
+		return true
+	}
+	return false
+}
+
+var (
+	scaleThousandsPattern = regexp.MustCompile(`(?i)in thousands|\(\s*[\$€£]?\s*'?000s?\s*\)|[\$€£]\s*'?000s?|usd\s*'?000|eur\s*'?000|gbp\s*'?000|\(\s*[\$€£]?k\s*\)`)
+	scaleMillionsPattern  = regexp.MustCompile(`(?i)in millions|\(\s*[\$€£]?\s*(?:m|mm|mn)\s*\)|[\$€£]\s*(?:m|mm|mn)\b|usd\s*(?:m|mm|mn)\b|eur\s*(?:m|mm|mn)\b|gbp\s*(?:m|mm|mn)\b|millions`)
+	scaleBillionsPattern  = regexp.MustCompile(`(?i)in billions|\(\s*[\$€£]?\s*bn\s*\)|[\$€£]\s*bn\b|billions`)
+)
+
+// detectScale reads the unit scale from table titles and notes
+func detectScale(text string) float64 {
+	switch {
+	case scaleBillionsPattern.MatchString(text):
+		return 1e9
+	case scaleMillionsPattern.MatchString(text):
+		return 1e6
+	case scaleThousandsPattern.MatchString(text):
+		return 1e3
+	}
+	return 1
+}
+
+// detectCurrency reads the currency from table titles and notes
+func detectCurrency(text string) string {
+	lower := strings.ToLower(text)
+	switch {
+	case strings.Contains(text, "€") || strings.Contains(lower, "eur"):
+		return "EUR"
+	case strings.Contains(text, "£") || strings.Contains(lower, "gbp"):
+		return "GBP"
+	}
+	return "USD"
+}
+
+var statementTitlePatterns = map[StatementType]*regexp.Regexp{
+	StatementIncome:   regexp.MustCompile(`(?i)income statement|statements? of (?:operations|income|comprehensive income|earnings)|profit and loss|profit & loss|\bp&l\b|\bp ?& ?l\b|\bpnl\b`),
+	StatementBalance:  regexp.MustCompile(`(?i)balance sheet|statements? of financial position|financial position|\bbs\b`),
+	StatementCashFlow: regexp.MustCompile(`(?i)cash ?flows?(?: statement)?|statements? of cash flows`),
+}
+
+// detectStatementType identifies the statement named in a title
+func detectStatementType(text string) StatementType {
+	for _, statement := range []StatementType{StatementCashFlow, StatementBalance, StatementIncome} {
+		if statementTitlePatterns[statement].MatchString(text) {
+			return statement
+		}
+	}
+	return StatementUnknown
+}
+
+// isStatementTitle distinguishes statement titles from line items that
+// merely mention cash flow ("Free cash flow")
+func isStatementTitle(label string) bool {
+	lower := strings.ToLower(label)
+	return strings.Contains(lower, "statement") || strings.Contains(lower, "balance sheet") ||
+		strings.Contains(lower, "profit and loss") || strings.Contains(lower, "p&l")
+}
+
+// lineItemSynonyms maps canonical line items to the labels they appear under
+var lineItemSynonyms = map[string][]string{
+	"revenue":             {"revenue", "revenues", "net revenue", "net revenues", "total revenue", "total revenues", "net sales", "total net sales", "sales", "turnover", "total sales"},
+	"cogs":                {"cost of goods sold", "cost of sales", "cost of revenue", "cost of revenues", "cogs"},
+	"gross_profit":        {"gross profit", "gross margin $"},
+	"operating_expenses":  {"operating expenses", "total operating expenses", "opex", "total opex"},
+	"ebitda":              {"ebitda", "adjusted ebitda", "adj. ebitda", "adj ebitda", "reported ebitda"},
+	"ebit":                {"ebit", "operating income", "operating profit", "income from operations"},
+	"net_income":          {"net income", "net profit", "net earnings", "profit for the year", "profit for the period", "net income (loss)", "net loss"},
+	"gross_margin":        {"gross margin", "gross margin %"},
+	"ebitda_margin":       {"ebitda margin", "ebitda margin %"},
+	"total_assets":        {"total assets"},
+	"total_liabilities":   {"total liabilities"},
+	"total_equity":        {"total equity", "total shareholders' equity", "total stockholders' equity", "shareholders' equity", "stockholders' equity"},
+	"cash":                {"cash", "cash and cash equivalents", "cash & cash equivalents"},
+	"total_debt":          {"total debt", "net debt"},
+	"operating_cash_flow": {"net cash from operating activities", "net cash provided by operating activities", "cash flow from operations", "operating cash flow", "cash from operations"},
+	"capex":               {"capital expenditures", "capital expenditure", "capex", "purchases of property and equipment", "purchase of property, plant and equipment"},
+	"free_cash_flow":      {"free cash flow", "fcf"},
+	"customers":           {"customers", "customer count", "number of customers", "total customers", "active customers"},
+}
+
+// canonicalStatements maps canonical line items to their usual statement
+var canonicalStatements = map[string]StatementType{
+	"revenue": StatementIncome, "cogs": StatementIncome, "gross_profit": StatementIncome,
+	"operating_expenses": StatementIncome, "ebitda": StatementIncome, "ebit": StatementIncome,
+	"net_income": StatementIncome, "total_assets": StatementBalance, "total_liabilities": StatementBalance,
+	"total_equity": StatementBalance, "cash": StatementBalance, "total_debt": StatementBalance,
+	"operating_cash_flow": StatementCashFlow, "capex": StatementCashFlow, "free_cash_flow": StatementCashFlow,
+}
+
+var lineItemNoisePattern = regexp.MustCompile(`\s*\(\d+\)$|\s*\[\d+\]$|[:*]+$`)
+
+// canonicalLineItem normalizes a row label to a canonical line item name,
+// returning "" for labels we do not recognize
+func canonicalLineItem(label string) string {
+	normalized := strings.ToLower(strings.TrimSpace(label))
+	normalized = lineItemNoisePattern.ReplaceAllString(normalized, "")
+	normalized = strings.Join(strings.Fields(normalized), " ")
+
+	for canonical, synonyms := range lineItemSynonyms {
+		for _, synonym := range synonyms {
+			if normalized == synonym {
+				return canonical
+			}
+		}
+	}
+	return ""
+}
+
+// LatestLineItems returns, for each canonical line item, the value for the
+// most recent actual annual period, falling back to the most recent period
+func LatestLineItems(items []FinancialLineItem) map[string]FinancialLineItem {
+	latest := make(map[string]FinancialLineItem)
+	for _, item := range items {
+		if item.Canonical == "" {
+			continue
+		}
+		current, exists := latest[item.Canonical]
+		if !exists || preferLineItem(item, current) {
+			latest[item.Canonical] = item
+		}
+	}
+	return latest
+}
+
+// preferLineItem ranks actual annual figures above projections and partial
+// periods, then prefers the later period
+func preferLineItem(candidate, current FinancialLineItem) bool {
+	rank := func(item FinancialLineItem) int {
+		score := 0
+		if !item.Period.Projected {
+			score += 2
+		}
+		if item.Period.IsAnnual() {
+			score++
+		}
+		return score
+	}
+	if rank(candidate) != rank(current) {
+		return rank(candidate) > rank(current)
+	}
+	return candidate.Period.SortKey() > current.Period.SortKey()
+}
+
+// GroupLineItemSeries groups line items by canonical name, ordered by period
+func GroupLineItemSeries(items []FinancialLineItem) map[string][]FinancialLineItem {
+	series := make(map[string][]FinancialLineItem)
+	for _, item := range items {
+		if item.Canonical == "" {
+			continue
+		}
+		series[item.Canonical] = append(series[item.Canonical], item)
+	}
+	for key := range series {
+		sort.SliceStable(series[key], func(i, j int) bool {
+			return series[key][i].Period.SortKey() < series[key][j].Period.SortKey()
+		})
+	}
+	return series
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+func findLineItem(items []FinancialLineItem, canonical, period string) *FinancialLineItem {
+	for i := range items {
+		if items[i].Canonical == canonical && items[i].Period.Label == period {
+			return &items[i]
+		}
+	}
+	return nil
+}
+
+func TestParsePeriodLabel(t *testing.T) {
+	tests := []struct {
+		label     string
+		year      int
+		quarter   int
+		month     int
+		projected bool
+	}{
+		{"FY2023", 2023, 0, 0, false},
+		{"FY23", 2023, 0, 0, false},
+		{"2024E", 2024, 0, 0, true},
+		{"2022A", 2022, 0, 0, false},
+		{"Q1 2024", 2024, 1, 0, false},
+		{"2023 Q4", 2023, 4, 0, false},
+		{"Dec-23", 2023, 0, 12, false},
+		{"Year ended December 31, 2022", 2022, 0, 0, false},
+	}
+
+	for _, tt := range tests {
+		period, ok := parsePeriodLabel(tt.label)
+		require.True(t, ok, "expected %q to parse", tt.label)
+		assert.Equal(t, tt.year, period.Year, tt.label)
+		assert.Equal(t, tt.quarter, period.Quarter, tt.label)
+		assert.Equal(t, tt.month, period.Month, tt.label)
+		assert.Equal(t, tt.projected, period.Projected, tt.label)
+	}
+
+	for _, label := range []string{"Revenue", "1,234", "Total"} {
+		_, ok := parsePeriodLabel(label)
+		assert.False(t, ok, "expected %q not to parse", label)
+	}
+}
+
+func TestParseFinancialNumber(t *testing.T) {
+	tests := []struct {
+		cell  string
+		value float64
+		unit  string
+	}{
+		{"1,234.5", 1234.5, ""},
+		{"(1,234)", -1234, ""},
+		{"$25m", 25000000, "USD"},
+		{"34.2%", 34.2, "%"},
+		{"8.5x", 8.5, "x"},
+		{"-500", -500, ""},
+	}
+	for _, tt := range tests {
+		value, unit, ok := parseFinancialNumber(tt.cell)
+		require.True(t, ok, tt.cell)
+		assert.InDelta(t, tt.value, value, 0.001, tt.cell)
+		assert.Equal(t, tt.unit, unit, tt.cell)
+	}
+
+	for _, cell := range []string{"-", "n/a", "Revenue", "Tax"} {
+		_, _, ok := parseFinancialNumber(cell)
+		assert.False(t, ok, cell)
+	}
+}
+
+func TestExtractTablesFromWorkbook(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "financials.xlsx")
+	f := excelize.NewFile()
+	f.SetSheetName("Sheet1", "P&L")
+	rows := [][]interface{}{
+		{"AquaFlow Technologies"},
+		{"($ in thousands)"},
+		{"Line Item", "FY2022", "FY2023", "FY2024E"},
+		{"Net Revenue", "20,000", "25,000", "30,000"},
+		{"Cost of Sales", "(8,000)", "(10,000)", "(12,000)"},
+		{"EBITDA", "6,500", "8,500", "10,000"},
+		{"EBITDA Margin", "32.5%", "34.0%", "33.3%"},
+	}
+	for i, row := range rows {
+		cell, _ := excelize.CoordinatesToCellName(1, i+1)
+		require.NoError(t, f.SetSheetRow("P&L", cell, &row))
+	}
+	require.NoError(t, f.SaveAs(path))
+
+	extractor := NewFinancialTableExtractor(nil)
+	tables, err := extractor.ExtractTables(path)
+	require.NoError(t, err)
+	require.Len(t, tables, 1)
+
+	table := tables[0]
+	assert.Equal(t, StatementIncome, table.Statement)
+	assert.Equal(t, 1e3, table.Scale)
+	require.Len(t, table.Periods, 3)
+	assert.True(t, table.Periods[2].Projected)
+
+	revenue2022 := findLineItem(table.Rows, "revenue", "FY2022")
+	revenue2023 := findLineItem(table.Rows, "revenue", "FY2023")
+	require.NotNil(t, revenue2022)
+	require.NotNil(t, revenue2023)
+	assert.Equal(t, 20000000.0, revenue2022.Value)
+	assert.Equal(t, 25000000.0, revenue2023.Value)
+	assert.Equal(t, "C4", revenue2023.Source.Cell)
+	assert.Equal(t, "P&L", revenue2023.Source.Sheet)
+
+	cogs := findLineItem(table.Rows, "cogs", "FY2023")
+	require.NotNil(t, cogs)
+	assert.Equal(t, -10000000.0, cogs.Value)
+
+	margin := findLineItem(table.Rows, "ebitda_margin", "FY2023")
+	require.NotNil(t, margin)
+	assert.Equal(t, "%", margin.Unit)
+	assert.Equal(t, 34.0, margin.Value)
+
+	latest := LatestLineItems(table.Rows)
+	assert.Equal(t, "FY2023", latest["revenue"].Period.Label, "projections should not be preferred over actuals")
+}
+
+func TestExtractTablesFromText(t *testing.T) {
+	text := "Consolidated Balance Sheet\n" +
+		"(in millions)\n" +
+		"2023 2022\n" +
+		"Cash and cash equivalents 12.5 10.0\n" +
+		"Total assets 140.2 120.0\n" +
+		"Total liabilities (60.0) 55.1\n" +
+		"\n" +
+		"Statement of Cash Flows\n" +
+		"FY2023    FY2022\n" +
+		"Net cash from operating activities    9.1    7.4\n" +
+		"Capital expenditures    (2.0)    -\n"
+
+	tables := extractTablesFromText(text, LineItemSource{Document: "cim.pdf", Page: 42})
+	require.Len(t, tables, 2)
+
+	balance := tables[0]
+	assert.Equal(t, StatementBalance, balance.Statement)
+	assert.Equal(t, 1e6, balance.Scale)
+	assets := findLineItem(balance.Rows, "total_assets", "2022")
+	require.NotNil(t, assets)
+	assert.InDelta(t, 120000000.0, assets.Value, 0.01)
+	assert.Equal(t, 42, assets.Source.Page)
+
+	cashFlow := tables[1]
+	assert.Equal(t, StatementCashFlow, cashFlow.Statement)
+	ocf := findLineItem(cashFlow.Rows, "operating_cash_flow", "FY2023")
+	require.NotNil(t, ocf)
+	assert.InDelta(t, 9100000.0, ocf.Value, 0.01)
+
+	// The dash is an empty cell, so only FY2023 capex is present
+	assert.NotNil(t, findLineItem(cashFlow.Rows, "capex", "FY2023"))
+	assert.Nil(t, findLineItem(cashFlow.Rows, "capex", "FY2022"))
+}
+
+func TestDataMapperUsesStatementTables(t *testing.T) {
+	tempDir := t.TempDir()
+	path := filepath.Join(tempDir, "financials.csv")
+	content := "Income Statement (USD in thousands),,\n" +
+		"Line Item,FY2022,FY2023\n" +
+		"Total Net Sales,\"20,000\",\"25,000\"\n" +
+		"Net Income,\"4,000\",\"6,000\"\n"
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	mapper := NewDataMapper(nil, &TemplateParser{})
+	documents := []DocumentInfo{{Path: path, Name: "financials.csv", Type: DocTypeFinancial}}
+
+	financial := mapper.extractFinancialDataFromDocuments(documents)
+	assert.Equal(t, 25000000.0, financial.Revenue)
+	assert.Equal(t, 6000000.0, financial.NetIncome)
+	assert.Equal(t, "FY2023", financial.Period)
+	assert.Equal(t, 20000000.0, financial.DataPoints["revenue_fy2022"])
+	assert.NotEmpty(t, financial.LineItems)
+
+	context := mapper.createExtractionContext(documents)
+	mapped, err := mapper.mapField(DataField{Name: "Revenue FY2022", DataType: "currency"}, context)
+	require.NoError(t, err)
+	require.NotNil(t, mapped)
+	assert.Equal(t, 20000000.0, mapped.Value)
+	assert.Equal(t, "extracted", mapped.SourceType)
+}
@@ -2,9 +2,7 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"os"
 	"path/filepath"
 	"sort"
 	"sync"
@@ -29,33 +27,40 @@ type JobTracker struct {
 	jobs       map[string]*JobInfo
 	history    []string // Job IDs in chronological order
 	mu         sync.RWMutex
-	configPath string
+	repo       JobRepository
 	maxHistory int
 }
 
+// JobRepository persists tracked jobs and the order they were created in
+type JobRepository interface {
+	LoadJobs() (map[string]*JobInfo, []string, error)
+	SaveJobs(jobs map[string]*JobInfo, history []string) error
+}
+
 // JobInfo represents detailed information about a processing job
 type JobInfo struct {
-	JobID              string                 `json:"jobId"`
-	DealName           string                 `json:"dealName"`
-	Status             JobStatus              `json:"status"`
-	TriggerType        WebhookTriggerType     `json:"triggerType"`
-	FilePaths          []string               `json:"filePaths"`
-	CreatedAt          int64                  `json:"createdAt"`
-	UpdatedAt          int64                  `json:"updatedAt"`
-	StartedAt          int64                  `json:"startedAt,omitempty"`
-	CompletedAt        int64                  `json:"completedAt,omitempty"`
-	Progress           float64                `json:"progress"`
-	CurrentStep        string                 `json:"currentStep"`
-	EstimatedTime      int64                  `json:"estimatedTimeMs"`
-	ProcessedDocuments int                    `json:"processedDocuments"`
-	TotalDocuments     int                    `json:"totalDocuments"`
-	ProcessingResults  *WebhookResultPayload  `json:"processingResults,omitempty"`
-	Errors             []string               `json:"errors,omitempty"`
-	RetryCount         int                    `json:"retryCount"`
-	MaxRetries         int                    `json:"maxRetries"`
-	QueuePosition      int                    `json:"queuePosition"`
-	ProcessingHistory  []JobHistoryEntry      `json:"processingHistory"`
-	Metadata           map[string]interface{} `json:"metadata,omitempty"`
+	JobID              string                  `json:"jobId"`
+	DealName           string                  `json:"dealName"`
+	Status             JobStatus               `json:"status"`
+	TriggerType        WebhookTriggerType      `json:"triggerType"`
+	FilePaths          []string                `json:"filePaths"`
+	CreatedAt          int64                   `json:"createdAt"`
+	UpdatedAt          int64                   `json:"updatedAt"`
+	StartedAt          int64                   `json:"startedAt,omitempty"`
+	CompletedAt        int64                   `json:"completedAt,omitempty"`
+	Progress           float64                 `json:"progress"`
+	CurrentStep        string                  `json:"currentStep"`
+	EstimatedTime      int64                   `json:"estimatedTimeMs"`
+	ProcessedDocuments int                     `json:"processedDocuments"`
+	TotalDocuments     int                     `json:"totalDocuments"`
+	ProcessingResults  *WebhookResultPayload   `json:"processingResults,omitempty"`
+	Errors             []string                `json:"errors,omitempty"`
+	RetryCount         int                     `json:"retryCount"`
+	MaxRetries         int                     `json:"maxRetries"`
+	QueuePosition      int                     `json:"queuePosition"`
+	ProcessingHistory  []JobHistoryEntry       `json:"processingHistory"`
+	Metadata           map[string]interface{}  `json:"metadata,omitempty"`
+	IntegrityReports   []*ModelIntegrityReport `json:"integrityReports,omitempty"`
 }
 
 // JobHistoryEntry represents a single entry in job processing history
@@ -91,24 +96,36 @@ type JobSummary struct {
 	RecentActivity  []JobHistoryEntry `json:"recentActivity"`
 }
 
-// NewJobTracker creates a new job tracker instance
+// NewJobTracker creates a job tracker persisted in the app's state store
 func NewJobTracker(configService *ConfigService) *JobTracker {
-	configPath := ""
-	if configService != nil {
-		configPath = filepath.Join(configService.GetDealDoneRoot(), ".dealdone", "job_tracker.json")
+	if configService == nil {
+		return NewJobTrackerWithRepository(nil)
+	}
+
+	root := configService.GetDealDoneRoot()
+	repo, err := OpenStateStore(stateStorePath(root))
+	if err != nil {
+		fmt.Printf("Warning: Job history will not persist: %v\n", err)
+		return NewJobTrackerWithRepository(nil)
+	}
+	if err := repo.importLegacyJobs(filepath.Join(root, ".dealdone", "job_tracker.json")); err != nil {
+		fmt.Printf("Warning: Failed to import job history: %v\n", err)
 	}
+	return NewJobTrackerWithRepository(repo)
+}
 
+// NewJobTrackerWithRepository creates a job tracker that loads and saves
+// jobs through repo; a nil repo keeps jobs in memory only
+func NewJobTrackerWithRepository(repo JobRepository) *JobTracker {
 	tracker := &JobTracker{
 		jobs:       make(map[string]*JobInfo),
 		history:    make([]string, 0),
-		configPath: configPath,
+		repo:       repo,
 		maxHistory: 1000, // Keep last 1000 jobs in history
 	}
 
 	// Load existing data
-	if configPath != "" {
-		tracker.loadFromDisk()
-	}
+	tracker.loadFromDisk()
 
 	return tracker
 }
@@ -299,6 +316,42 @@ func (jt *JobTracker) FailJob(jobID string, errorMsg string) error {
 	return nil
 }
 
+// AttachIntegrityReport records the integrity report of a workbook the job
+// populated, replacing an earlier report for the same workbook
+func (jt *JobTracker) AttachIntegrityReport(jobID string, report *ModelIntegrityReport) error {
+	jt.mu.Lock()
+	defer jt.mu.Unlock()
+
+	job, exists := jt.jobs[jobID]
+	if !exists {
+		return fmt.Errorf("job not found: %s", jobID)
+	}
+
+	reports := job.IntegrityReports[:0:0]
+	for _, existing := range job.IntegrityReports {
+		if existing.Path != report.Path {
+			reports = append(reports, existing)
+		}
+	}
+	job.IntegrityReports = append(reports, report)
+	job.UpdatedAt = time.Now().UnixMilli()
+
+	message := fmt.Sprintf("Model integrity checked for %s: passed", filepath.Base(report.Path))
+	if !report.Passed {
+		message = fmt.Sprintf("Model integrity checked for %s: %d errors, %d warnings", filepath.Base(report.Path), report.Errors, report.Warnings)
+	}
+	job.ProcessingHistory = append(job.ProcessingHistory, JobHistoryEntry{
+		Timestamp: job.UpdatedAt,
+		Status:    string(job.Status),
+		Step:      job.CurrentStep,
+		Message:   message,
+		Progress:  job.Progress,
+	})
+
+	jt.saveToDisk()
+	return nil
+}
+
 // GetJob retrieves job information by ID
 func (jt *JobTracker) GetJob(jobID string) (*JobInfo, error) {
 	jt.mu.RLock()
@@ -482,64 +535,30 @@ func (jt *JobTracker) sortJobs(jobs []*JobInfo, sortBy, sortOrder string) {
 }
 
 func (jt *JobTracker) saveToDisk() {
-	if jt.configPath == "" {
-		return
-	}
-
-	// Ensure directory exists
-	dir := filepath.Dir(jt.configPath)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+	if jt.repo == nil {
 		return
 	}
 
-	// Prepare data for saving
-	data := map[string]interface{}{
-		"jobs":     jt.jobs,
-		"history":  jt.history,
-		"saved_at": time.Now().UnixMilli(),
-	}
-
-	// Write to file
-	if jsonData, err := json.MarshalIndent(data, "", "  "); err == nil {
-		os.WriteFile(jt.configPath, jsonData, 0644)
+	if err := jt.repo.SaveJobs(jt.jobs, jt.history); err != nil {
+		fmt.Printf("Warning: Failed to save job history: %v\n", err)
 	}
 }
 
 func (jt *JobTracker) loadFromDisk() {
-	if jt.configPath == "" {
+	if jt.repo == nil {
 		return
 	}
 
-	data, err := os.ReadFile(jt.configPath)
+	jobs, history, err := jt.repo.LoadJobs()
 	if err != nil {
+		fmt.Printf("Warning: Failed to load job history: %v\n", err)
 		return
 	}
-
-	var savedData map[string]interface{}
-	if err := json.Unmarshal(data, &savedData); err != nil {
-		return
-	}
-
-	// Load jobs
-	if jobsData, ok := savedData["jobs"].(map[string]interface{}); ok {
-		for jobID, jobDataInterface := range jobsData {
-			if jobDataBytes, err := json.Marshal(jobDataInterface); err == nil {
-				var job JobInfo
-				if err := json.Unmarshal(jobDataBytes, &job); err == nil {
-					jt.jobs[jobID] = &job
-				}
-			}
-		}
+	for jobID, job := range jobs {
+		jt.jobs[jobID] = job
 	}
-
-	// Load history
-	if historyData, ok := savedData["history"].([]interface{}); ok {
-		jt.history = make([]string, len(historyData))
-		for i, item := range historyData {
-			if jobID, ok := item.(string); ok {
-				jt.history[i] = jobID
-			}
-		}
+	if history != nil {
+		jt.history = history
 	}
 }
 
@@ -600,13 +619,5 @@ func (jt *JobTracker) IsHealthy(ctx context.Context) error {
 		return fmt.Errorf("job tracker not initialized")
 	}
 
-	// Check file system access if config path is set
-	if jt.configPath != "" {
-		dir := filepath.Dir(jt.configPath)
-		if _, err := os.Stat(dir); err != nil {
-			return fmt.Errorf("cannot access job tracker storage: %w", err)
-		}
-	}
-
 	return nil
 }
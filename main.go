@@ -2,6 +2,7 @@ package main
 
 import (
 	"embed"
+	"os"
 
 	"github.com/wailsapp/wails/v2"
 	"github.com/wailsapp/wails/v2/pkg/options"
@@ -12,6 +13,14 @@ import (
 var assets embed.FS
 
 func main() {
+	// Run headless when a CLI command is given. Services report progress
+	// with fmt.Printf, so stdout is kept for command output only.
+	if len(os.Args) > 1 && isCLICommand(os.Args[1]) {
+		stdout := os.Stdout
+		os.Stdout = os.Stderr
+		os.Exit(runCLI(os.Args[1:], stdout, os.Stderr))
+	}
+
 	// Create an instance of the app structure
 	app := NewApp()
 
@@ -25,6 +34,7 @@ func main() {
 		},
 		BackgroundColour: &options.RGBA{R: 27, G: 38, B: 54, A: 1},
 		OnStartup:        app.startup,
+		OnShutdown:       app.shutdown,
 		Bind: []interface{}{
 			app,
 		},
@@ -0,0 +1,937 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Built-in checks run on every populated workbook unless the template's
+// check configuration leaves them out
+const (
+	ModelCheckBalanceSheet = "balance_sheet"
+	ModelCheckEBITDA       = "ebitda"
+	ModelCheckPercentages  = "percentages"
+)
+
+// Kinds of problems an integrity report lists
+const (
+	IntegrityFormulaError       = "formula_error"
+	IntegrityCircularReference  = "circular_reference"
+	IntegrityUnsupportedFormula = "unsupported_formula"
+	IntegrityCheckFailed        = "check_failed"
+	IntegrityInvalidCheck       = "invalid_check"
+)
+
+// defaultModelTolerance is the largest difference equality checks accept
+const defaultModelTolerance = 0.01
+
+// formulaErrorValues are the error values Excel shows in a cell
+var formulaErrorValues = []string{"#REF!", "#DIV/0!", "#VALUE!", "#NAME?", "#N/A", "#NUM!", "#NULL!"}
+
+// ModelCheckConfig configures the accounting checks run on a populated
+// workbook. It is read from a sidecar next to the template
+// (<name>.checks.json, .yaml or .yml) or from the checks property of the
+// template's .meta.json.
+type ModelCheckConfig struct {
+	Tolerance float64      `json:"tolerance,omitempty"` // Largest difference equality checks accept; defaults to 0.01
+	Defaults  *[]string    `json:"defaults,omitempty"`  // Built-in checks to run; all of them when left out
+	Checks    []ModelCheck `json:"checks,omitempty"`
+	Source    string       `json:"-"` // File the configuration was read from
+}
+
+// ModelCheck is a configured check: an equation between cells, or cells
+// that must hold percentages
+type ModelCheck struct {
+	Name     string `json:"name,omitempty"`
+	Assert   string `json:"assert,omitempty"`   // e.g. "BS!B20:F20 = BS!B35:F35 + BS!B40:F40"; ranges are compared cell by cell
+	Percent  string `json:"percent,omitempty"`  // e.g. "Model!B2:F2, Model!B9"; values must lie within 0-100%
+	Whole    bool   `json:"whole,omitempty"`    // Percent cells hold 15 rather than 0.15 for 15%
+	Severity string `json:"severity,omitempty"` // error (default) or warning
+}
+
+// ModelIntegrityReport is the outcome of recalculating and checking a
+// populated workbook
+type ModelIntegrityReport struct {
+	Path         string                `json:"path"`
+	CheckedAt    time.Time             `json:"checkedAt"`
+	Passed       bool                  `json:"passed"` // No errors were found; warnings are allowed
+	Formulas     int                   `json:"formulas"`
+	Errors       int                   `json:"errors"`
+	Warnings     int                   `json:"warnings"`
+	Checks       []ModelCheckResult    `json:"checks"`
+	Issues       []ModelIntegrityIssue `json:"issues,omitempty"`
+	ConfigSource string                `json:"configSource,omitempty"`
+}
+
+// ModelCheckResult summarises one check
+type ModelCheckResult struct {
+	Name     string `json:"name"`
+	Compared int    `json:"compared"` // Cells or equations evaluated
+	Failed   int    `json:"failed"`
+	Skipped  string `json:"skipped,omitempty"` // Why nothing was evaluated
+}
+
+// ModelIntegrityIssue is one problem found in a workbook
+type ModelIntegrityIssue struct {
+	Kind     string   `json:"kind"`
+	Severity string   `json:"severity"` // error or warning
+	Check    string   `json:"check,omitempty"`
+	Cells    []string `json:"cells,omitempty"` // Sheet-qualified, e.g. "Model!B4"
+	Formula  string   `json:"formula,omitempty"`
+	Value    string   `json:"value,omitempty"`
+	Message  string   `json:"message"`
+}
+
+// LoadModelCheckConfig reads the check configuration of a template. It
+// returns nil when the template has none.
+func LoadModelCheckConfig(templatePath string) (*ModelCheckConfig, error) {
+	var config ModelCheckConfig
+	source, err := readTemplateSidecar(templatePath, "checks", &config)
+	if err != nil || source == "" {
+		return nil, err
+	}
+	config.Source = source
+	return &config, nil
+}
+
+// copyModelCheckConfig gives a copy of a template the check configuration
+// of its source
+func copyModelCheckConfig(templatePath, copyPath string) error {
+	config, err := LoadModelCheckConfig(templatePath)
+	if err != nil || config == nil {
+		return err
+	}
+	data, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode template checks: %w", err)
+	}
+	return writeFileDurable(templateSidecarPaths(copyPath, "checks")[0], data, 0644)
+}
+
+// runs reports whether a built-in check is enabled
+func (c *ModelCheckConfig) runs(check string) bool {
+	return c == nil || c.Defaults == nil || contains(*c.Defaults, check)
+}
+
+func (c *ModelCheckConfig) tolerance() float64 {
+	if c == nil || c.Tolerance <= 0 {
+		return defaultModelTolerance
+	}
+	return c.Tolerance
+}
+
+// add records an issue and counts it
+func (r *ModelIntegrityReport) add(issue ModelIntegrityIssue) {
+	if issue.Severity == "" {
+		issue.Severity = "error"
+	}
+	if issue.Severity == "warning" {
+		r.Warnings++
+	} else {
+		r.Errors++
+	}
+	r.Issues = append(r.Issues, issue)
+}
+
+// modelWorkbook is a workbook with its formulas recalculated
+type modelWorkbook struct {
+	f        *excelize.File
+	sheets   []string
+	formulas map[string]string  // Sheet-qualified cell -> formula
+	values   map[string]float64 // Numeric results of recalculated formulas
+	failed   map[string]bool    // Formula cells without a usable result
+}
+
+// CheckModelIntegrity recalculates every formula of a populated workbook,
+// reporting error values and circular references, and runs the accounting
+// checks. The built-in checks find balance sheet and P&L rows by their
+// labels; config adds equations between specific cells and may turn the
+// built-in checks off. A nil config runs the built-in checks only.
+func (tp *TemplatePopulator) CheckModelIntegrity(path string, config *ModelCheckConfig) (*ModelIntegrityReport, error) {
+	f, err := excelize.OpenFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open workbook: %w", err)
+	}
+	defer f.Close()
+
+	report := &ModelIntegrityReport{Path: path, CheckedAt: time.Now(), Checks: []ModelCheckResult{}}
+	if config != nil {
+		report.ConfigSource = config.Source
+	}
+
+	wb := &modelWorkbook{
+		f:        f,
+		sheets:   f.GetSheetList(),
+		formulas: make(map[string]string),
+		values:   make(map[string]float64),
+		failed:   make(map[string]bool),
+	}
+	for _, sheet := range wb.sheets {
+		sheetData := SheetData{Name: sheet, Formulas: make(map[string]string)}
+		tp.templateParser.extractFormulas(f, sheet, &sheetData)
+		for cell, formula := range sheetData.Formulas {
+			wb.formulas[sheet+"!"+cell] = formula
+		}
+	}
+	report.Formulas = len(wb.formulas)
+
+	wb.checkCircularReferences(report)
+	wb.recalculate(report)
+	tolerance := config.tolerance()
+	if config.runs(ModelCheckBalanceSheet) {
+		wb.checkBalanceSheet(report, tolerance)
+	}
+	if config.runs(ModelCheckEBITDA) {
+		wb.checkEBITDA(report, tolerance)
+	}
+	if config.runs(ModelCheckPercentages) {
+		wb.checkPercentFormats(report)
+	}
+	if config != nil {
+		for i, check := range config.Checks {
+			wb.runCheck(report, i, check, tolerance)
+		}
+	}
+
+	report.Passed = report.Errors == 0
+	return report, nil
+}
+
+// CheckPopulatedModel checks a populated workbook against the check
+// configuration copied alongside it. Other formats have no report.
+func (tp *TemplatePopulator) CheckPopulatedModel(path string) (*ModelIntegrityReport, error) {
+	if strings.ToLower(filepath.Ext(path)) != ".xlsx" {
+		return nil, nil
+	}
+	config, err := LoadModelCheckConfig(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load template checks: %w", err)
+	}
+	return tp.CheckModelIntegrity(path, config)
+}
+
+// checkCircularReferences finds formulas that depend on themselves
+func (wb *modelWorkbook) checkCircularReferences(report *ModelIntegrityReport) {
+	cycles := findCircularReferences(wb.formulas)
+	for _, cycle := range cycles {
+		for _, cell := range cycle {
+			wb.failed[cell] = true
+		}
+		report.add(ModelIntegrityIssue{
+			Kind:    IntegrityCircularReference,
+			Cells:   cycle,
+			Formula: wb.formulas[cycle[0]],
+			Message: "circular reference through " + strings.Join(cycle, ", "),
+		})
+	}
+	report.Checks = append(report.Checks, ModelCheckResult{Name: "circular_references", Compared: len(wb.formulas), Failed: len(cycles)})
+}
+
+// recalculate evaluates every formula outside a cycle
+func (wb *modelWorkbook) recalculate(report *ModelIntegrityReport) {
+	result := ModelCheckResult{Name: "recalculation"}
+	for _, ref := range sortedFormulaCells(wb.formulas) {
+		if wb.failed[ref] {
+			continue
+		}
+		sheet, cell := splitBoundCell(ref)
+		formula := wb.formulas[ref]
+		value, err := wb.f.CalcCellValue(sheet, cell, excelize.Options{RawCellValue: true})
+		result.Compared++
+
+		if err != nil && strings.HasPrefix(err.Error(), "not support") {
+			wb.failed[ref] = true
+			report.add(ModelIntegrityIssue{
+				Kind:     IntegrityUnsupportedFormula,
+				Severity: "warning",
+				Cells:    []string{ref},
+				Formula:  formula,
+				Message:  fmt.Sprintf("%s could not be recalculated: %v", ref, err),
+			})
+			continue
+		}
+		if code := formulaErrorCode(formula, value, err); code != "" {
+			wb.failed[ref] = true
+			result.Failed++
+			report.add(ModelIntegrityIssue{
+				Kind:    IntegrityFormulaError,
+				Cells:   []string{ref},
+				Formula: formula,
+				Value:   code,
+				Message: fmt.Sprintf("%s evaluates to %s", ref, code),
+			})
+			continue
+		}
+		if n, err := strconv.ParseFloat(value, 64); err == nil {
+			wb.values[ref] = n
+		}
+	}
+	report.Checks = append(report.Checks, result)
+}
+
+// formulaErrorCode returns the Excel error value a formula evaluates to, or
+// "" when it evaluates cleanly
+func formulaErrorCode(formula, value string, err error) string {
+	candidates := []string{value}
+	if err != nil {
+		candidates = append(candidates, err.Error())
+	}
+	for _, candidate := range candidates {
+		for _, code := range formulaErrorValues {
+			if strings.TrimSpace(candidate) == code {
+				return code
+			}
+		}
+	}
+	if strings.Contains(strings.ToUpper(formula), "#REF!") {
+		return "#REF!"
+	}
+	if err != nil {
+		return "#VALUE!"
+	}
+	return ""
+}
+
+// number returns the numeric value of a sheet-qualified cell, using the
+// recalculated result for formulas
+func (wb *modelWorkbook) number(ref string) (float64, bool) {
+	if _, isFormula := wb.formulas[ref]; isFormula {
+		n, ok := wb.values[ref]
+		return n, ok
+	}
+	sheet, cell := splitBoundCell(ref)
+	value, err := wb.f.GetCellValue(sheet, cell, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return 0, false
+	}
+	n, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+	return n, err == nil
+}
+
+// rowLabels maps the normalized label of each row of a sheet to its
+// row number, and returns the widest row
+func (wb *modelWorkbook) rowLabels(sheet string) (map[string]int, int) {
+	rows, err := wb.f.GetRows(sheet, excelize.Options{RawCellValue: true})
+	if err != nil {
+		return nil, 0
+	}
+	labels := make(map[string]int)
+	width := 0
+	for i, row := range rows {
+		width = max(width, len(row))
+		for _, value := range row {
+			value = strings.TrimSpace(value)
+			if value == "" {
+				continue
+			}
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				if label := normalizeModelLabel(value); label != "" {
+					if _, seen := labels[label]; !seen {
+						labels[label] = i + 1
+					}
+				}
+			}
+			break
+		}
+	}
+	return labels, width
+}
+
+// normalizeModelLabel lowercases a row label and removes the wording that
+// varies between models, so "Total Liabilities & Shareholders' Equity"
+// reads "total liabilities and equity"
+func normalizeModelLabel(label string) string {
+	label = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(label), ":"))
+	label = strings.NewReplacer("&", " and ", "'", "", "’", "").Replace(label)
+	var words []string
+	for _, word := range strings.Fields(label) {
+		switch word {
+		case "shareholders", "stockholders", "shareholder", "stockholder", "owners":
+			continue
+		}
+		words = append(words, word)
+	}
+	return strings.Join(words, " ")
+}
+
+// findRow returns the row of the first label present
+func findRow(labels map[string]int, candidates ...string) (int, string) {
+	for _, candidate := range candidates {
+		if row, ok := labels[candidate]; ok {
+			return row, candidate
+		}
+	}
+	return 0, ""
+}
+
+// compareRows checks an equation between labelled rows column by column.
+// expected computes the left-hand side's expected value from the others.
+func (wb *modelWorkbook) compareRows(report *ModelIntegrityReport, result *ModelCheckResult, sheet string, width int, target int, others []int, expected func([]float64) float64, describe func(cell string, actual, want float64) string, tolerance float64) {
+	for col := 1; col <= width; col++ {
+		ref := func(row int) string {
+			cell, _ := excelize.CoordinatesToCellName(col, row)
+			return sheet + "!" + cell
+		}
+		actual, ok := wb.number(ref(target))
+		if !ok {
+			continue
+		}
+		inputs := make([]float64, len(others))
+		cells := []string{ref(target)}
+		for i, row := range others {
+			if inputs[i], ok = wb.number(ref(row)); !ok {
+				break
+			}
+			cells = append(cells, ref(row))
+		}
+		if !ok {
+			continue
+		}
+
+		result.Compared++
+		if want := expected(inputs); !withinTolerance(actual, want, tolerance) {
+			result.Failed++
+			report.add(ModelIntegrityIssue{
+				Kind:    IntegrityCheckFailed,
+				Check:   result.Name,
+				Cells:   cells,
+				Message: describe(ref(target), actual, want),
+			})
+		}
+	}
+}
+
+// checkBalanceSheet checks that total assets equal total liabilities and
+// equity on every sheet that labels them
+func (wb *modelWorkbook) checkBalanceSheet(report *ModelIntegrityReport, tolerance float64) {
+	result := ModelCheckResult{Name: ModelCheckBalanceSheet}
+	for _, sheet := range wb.sheets {
+		labels, width := wb.rowLabels(sheet)
+		assets, _ := findRow(labels, "total assets")
+		if assets == 0 {
+			continue
+		}
+		describe := func(cell string, actual, want float64) string {
+			return fmt.Sprintf("total assets in %s are %s but liabilities and equity total %s", cell, formatModelNumber(actual), formatModelNumber(want))
+		}
+		sum := func(values []float64) float64 {
+			total := 0.0
+			for _, v := range values {
+				total += v
+			}
+			return total
+		}
+		if combined, _ := findRow(labels, "total liabilities and equity", "total equity and liabilities"); combined != 0 {
+			wb.compareRows(report, &result, sheet, width, assets, []int{combined}, sum, describe, tolerance)
+			continue
+		}
+		liabilities, _ := findRow(labels, "total liabilities")
+		equity, _ := findRow(labels, "total equity", "equity")
+		if liabilities != 0 && equity != 0 {
+			wb.compareRows(report, &result, sheet, width, assets, []int{liabilities, equity}, sum, describe, tolerance)
+		}
+	}
+	if result.Compared == 0 {
+		result.Skipped = "no balance sheet totals found"
+	}
+	report.Checks = append(report.Checks, result)
+}
+
+// checkEBITDA checks that EBITDA equals revenue less operating expenses on
+// every sheet that labels them. Expenses may be entered as positive or
+// negative numbers.
+func (wb *modelWorkbook) checkEBITDA(report *ModelIntegrityReport, tolerance float64) {
+	result := ModelCheckResult{Name: ModelCheckEBITDA}
+	for _, sheet := range wb.sheets {
+		labels, width := wb.rowLabels(sheet)
+		ebitda, _ := findRow(labels, "ebitda")
+		revenue, _ := findRow(labels, "revenue", "revenues", "total revenue", "total revenues", "net revenue", "net revenues", "sales", "net sales")
+		opex, _ := findRow(labels, "operating expenses", "total operating expenses", "opex", "total opex")
+		if ebitda == 0 || revenue == 0 || opex == 0 {
+			continue
+		}
+		wb.compareRows(report, &result, sheet, width, ebitda, []int{revenue, opex},
+			func(values []float64) float64 { return values[0] - math.Abs(values[1]) },
+			func(cell string, actual, want float64) string {
+				return fmt.Sprintf("EBITDA in %s is %s but revenue less operating expenses is %s", cell, formatModelNumber(actual), formatModelNumber(want))
+			}, tolerance)
+	}
+	if result.Compared == 0 {
+		result.Skipped = "no EBITDA, revenue and operating expense rows found"
+	}
+	report.Checks = append(report.Checks, result)
+}
+
+// checkPercentFormats checks that cells formatted as percentages hold
+// values within 0-100%
+func (wb *modelWorkbook) checkPercentFormats(report *ModelIntegrityReport) {
+	result := ModelCheckResult{Name: ModelCheckPercentages}
+	percentStyles := make(map[int]bool)
+	for _, sheet := range wb.sheets {
+		rows, err := wb.f.GetRows(sheet, excelize.Options{RawCellValue: true})
+		if err != nil {
+			continue
+		}
+		for r, row := range rows {
+			for c := range row {
+				cell, _ := excelize.CoordinatesToCellName(c+1, r+1)
+				styleID, err := wb.f.GetCellStyle(sheet, cell)
+				if err != nil || styleID == 0 {
+					continue
+				}
+				isPercent, seen := percentStyles[styleID]
+				if !seen {
+					style, err := wb.f.GetStyle(styleID)
+					isPercent = err == nil && (style.NumFmt == 9 || style.NumFmt == 10 ||
+						(style.CustomNumFmt != nil && strings.Contains(*style.CustomNumFmt, "%")))
+					percentStyles[styleID] = isPercent
+				}
+				if !isPercent {
+					continue
+				}
+				wb.checkPercent(report, &result, sheet+"!"+cell, false, "")
+			}
+		}
+	}
+	if result.Compared == 0 {
+		result.Skipped = "no percentage cells found"
+	}
+	report.Checks = append(report.Checks, result)
+}
+
+// checkPercent checks one percentage cell
+func (wb *modelWorkbook) checkPercent(report *ModelIntegrityReport, result *ModelCheckResult, ref string, whole bool, severity string) {
+	value, ok := wb.number(ref)
+	if !ok {
+		return
+	}
+	result.Compared++
+	percent := value
+	if !whole {
+		percent *= 100
+	}
+	if percent >= -1e-9 && percent <= 100+1e-9 {
+		return
+	}
+	result.Failed++
+	report.add(ModelIntegrityIssue{
+		Kind:     IntegrityCheckFailed,
+		Severity: severity,
+		Check:    result.Name,
+		Cells:    []string{ref},
+		Value:    formatModelNumber(value),
+		Message:  fmt.Sprintf("%s holds %s%%, outside 0-100%%", ref, formatModelNumber(percent)),
+	})
+}
+
+// runCheck runs a configured check
+func (wb *modelWorkbook) runCheck(report *ModelIntegrityReport, index int, check ModelCheck, tolerance float64) {
+	result := ModelCheckResult{Name: check.Name}
+	if result.Name == "" {
+		result.Name = fmt.Sprintf("check %d", index+1)
+	}
+	invalid := func(format string, args ...interface{}) {
+		result.Skipped = "invalid check"
+		report.add(ModelIntegrityIssue{Kind: IntegrityInvalidCheck, Check: result.Name, Message: result.Name + ": " + fmt.Sprintf(format, args...)})
+		report.Checks = append(report.Checks, result)
+	}
+
+	switch check.Severity {
+	case "", "error", "warning":
+	default:
+		invalid("unknown severity %q", check.Severity)
+		return
+	}
+	if (check.Assert == "") == (check.Percent == "") {
+		invalid("exactly one of assert or percent is required")
+		return
+	}
+
+	if check.Percent != "" {
+		for _, ref := range strings.Split(check.Percent, ",") {
+			cells, err := wb.cells(strings.TrimSpace(ref))
+			if err != nil {
+				invalid("%v", err)
+				return
+			}
+			for _, cell := range cells {
+				wb.checkPercent(report, &result, cell, check.Whole, check.Severity)
+			}
+		}
+		report.Checks = append(report.Checks, result)
+		return
+	}
+
+	left, right, found := strings.Cut(check.Assert, "=")
+	if !found || strings.Contains(right, "=") {
+		invalid("assert must be a single equation such as \"A1 = B1 + C1\"")
+		return
+	}
+	lhs, err := wb.parseTerms(left)
+	if err != nil {
+		invalid("%v", err)
+		return
+	}
+	rhs, err := wb.parseTerms(right)
+	if err != nil {
+		invalid("%v", err)
+		return
+	}
+	size := 1
+	for _, term := range append(append([]modelTerm{}, lhs...), rhs...) {
+		if len(term.cells) > 1 {
+			if size > 1 && len(term.cells) != size {
+				invalid("ranges in %q differ in size", check.Assert)
+				return
+			}
+			size = len(term.cells)
+		}
+	}
+
+	for i := 0; i < size; i++ {
+		l, lok := wb.evaluate(lhs, i)
+		r, rok := wb.evaluate(rhs, i)
+		if !lok || !rok {
+			continue
+		}
+		result.Compared++
+		if withinTolerance(l, r, tolerance) {
+			continue
+		}
+		result.Failed++
+		var cells []string
+		for _, term := range append(append([]modelTerm{}, lhs...), rhs...) {
+			if cell := term.at(i); cell != "" {
+				cells = append(cells, cell)
+			}
+		}
+		report.add(ModelIntegrityIssue{
+			Kind:     IntegrityCheckFailed,
+			Severity: check.Severity,
+			Check:    result.Name,
+			Cells:    cells,
+			Message:  fmt.Sprintf("%s: %s is %s but %s is %s", result.Name, strings.TrimSpace(left), formatModelNumber(l), strings.TrimSpace(right), formatModelNumber(r)),
+		})
+	}
+	report.Checks = append(report.Checks, result)
+}
+
+// modelTerm is a signed cell, range or constant in a check equation
+type modelTerm struct {
+	sign     float64
+	cells    []string
+	constant float64
+}
+
+// at returns the cell a term contributes to the i-th comparison
+func (t modelTerm) at(i int) string {
+	switch len(t.cells) {
+	case 0:
+		return ""
+	case 1:
+		return t.cells[0]
+	}
+	return t.cells[i]
+}
+
+// parseTerms splits one side of an equation into signed terms
+func (wb *modelWorkbook) parseTerms(expression string) ([]modelTerm, error) {
+	var terms []modelTerm
+	sign := 1.0
+	var current strings.Builder
+	quoted := false
+	flush := func() error {
+		text := strings.TrimSpace(current.String())
+		current.Reset()
+		if text == "" {
+			return fmt.Errorf("missing term in %q", strings.TrimSpace(expression))
+		}
+		if n, err := strconv.ParseFloat(text, 64); err == nil {
+			terms = append(terms, modelTerm{sign: sign, constant: n})
+			return nil
+		}
+		cells, err := wb.cells(text)
+		if err != nil {
+			return err
+		}
+		terms = append(terms, modelTerm{sign: sign, cells: cells})
+		return nil
+	}
+
+	for _, r := range expression {
+		switch {
+		case r == '\'':
+			quoted = !quoted
+			current.WriteRune(r)
+		case (r == '+' || r == '-') && !quoted:
+			if strings.TrimSpace(current.String()) == "" && len(terms) == 0 {
+				// A leading sign
+				if r == '-' {
+					sign = -sign
+				}
+				continue
+			}
+			if err := flush(); err != nil {
+				return nil, err
+			}
+			sign = 1
+			if r == '-' {
+				sign = -1
+			}
+		default:
+			current.WriteRune(r)
+		}
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	return terms, nil
+}
+
+// cells resolves a cell or range reference to sheet-qualified cells, as
+// binding targets are resolved
+func (wb *modelWorkbook) cells(ref string) ([]string, error) {
+	sheets := make([]SheetData, len(wb.sheets))
+	for i, sheet := range wb.sheets {
+		sheets[i] = SheetData{Name: sheet}
+	}
+	return bindingCells(TemplateBinding{Range: ref}, &TemplateData{Format: "excel", Sheets: sheets})
+}
+
+// evaluate sums the terms of one side of an equation for the i-th
+// comparison
+func (wb *modelWorkbook) evaluate(terms []modelTerm, i int) (float64, bool) {
+	total := 0.0
+	for _, term := range terms {
+		if term.cells == nil {
+			total += term.sign * term.constant
+			continue
+		}
+		value, ok := wb.number(term.at(i))
+		if !ok {
+			return 0, false
+		}
+		total += term.sign * value
+	}
+	return total, true
+}
+
+func withinTolerance(a, b, tolerance float64) bool {
+	return math.Abs(a-b) <= tolerance+1e-9*math.Max(math.Abs(a), math.Abs(b))
+}
+
+func formatModelNumber(value float64) string {
+	return strconv.FormatFloat(math.Round(value*100)/100, 'f', -1, 64)
+}
+
+// formulaRefPattern matches cell and range references in a formula, with
+// an optional sheet name
+var formulaRefPattern = regexp.MustCompile(`(?:('(?:[^']|'')+'|[A-Za-z_][A-Za-z0-9_.]*)!)?(\$?)([A-Z]{1,3})(\$?)([0-9]+)(?::(\$?)([A-Z]{1,3})(\$?)([0-9]+))?`)
+
+// formulaStringPattern matches string literals, whose text is not a reference
+var formulaStringPattern = regexp.MustCompile(`"(?:[^"]|"")*"`)
+
+// formulaRange is a rectangle of cells a formula refers to
+type formulaRange struct {
+	sheet                          string
+	fromCol, fromRow, toCol, toRow int
+	absolute                       [4]bool // $ before fromCol, fromRow, toCol and toRow
+	isRange                        bool    // Written as A1:B2 rather than A1
+}
+
+// String writes the reference without its sheet name
+func (r formulaRange) String() string {
+	cell := func(col, row int, absCol, absRow bool) string {
+		name, _ := excelize.ColumnNumberToName(col)
+		if absCol {
+			name = "$" + name
+		}
+		if absRow {
+			name += "$"
+		}
+		return name + strconv.Itoa(row)
+	}
+	text := cell(r.fromCol, r.fromRow, r.absolute[0], r.absolute[1])
+	if r.isRange {
+		text += ":" + cell(r.toCol, r.toRow, r.absolute[2], r.absolute[3])
+	}
+	return text
+}
+
+// formulaReferences returns the cells and ranges a formula on sheet refers
+// to. Whole-column references and defined names are not resolved.
+func formulaReferences(formula, sheet string) []formulaRange {
+	var refs []formulaRange
+	rewriteFormulaReferences(formula, sheet, func(ref *formulaRange) bool {
+		refs = append(refs, *ref)
+		return false
+	})
+	return refs
+}
+
+// rewriteFormulaReferences passes each reference of a formula on sheet to
+// rewrite, and writes back the references it reports changing
+func rewriteFormulaReferences(formula, sheet string, rewrite func(ref *formulaRange) bool) string {
+	masked := formulaStringPattern.ReplaceAllStringFunc(formula, func(s string) string { return strings.Repeat(" ", len(s)) })
+	var sb strings.Builder
+	last := 0
+	for _, m := range formulaRefPattern.FindAllStringSubmatchIndex(masked, -1) {
+		// References are whole words and are not function names
+		if m[0] > 0 && isFormulaNameChar(masked[m[0]-1]) {
+			continue
+		}
+		if m[1] < len(masked) && (masked[m[1]] == '(' || isFormulaNameChar(masked[m[1]])) {
+			continue
+		}
+		ref := formulaRange{sheet: sheet, isRange: m[12] >= 0}
+		cellStart := m[0]
+		if m[2] >= 0 {
+			ref.sheet = strings.ReplaceAll(strings.Trim(formula[m[2]:m[3]], "'"), "''", "'")
+			cellStart = m[3] + 1
+		}
+		from := formula[m[6]:m[7]] + formula[m[10]:m[11]]
+		to := from
+		ref.absolute[0], ref.absolute[1] = m[5] > m[4], m[9] > m[8]
+		ref.absolute[2], ref.absolute[3] = ref.absolute[0], ref.absolute[1]
+		if ref.isRange {
+			to = formula[m[14]:m[15]] + formula[m[18]:m[19]]
+			ref.absolute[2], ref.absolute[3] = m[13] > m[12], m[17] > m[16]
+		}
+		var err error
+		if ref.fromCol, ref.fromRow, err = excelize.CellNameToCoordinates(from); err != nil {
+			continue
+		}
+		if ref.toCol, ref.toRow, err = excelize.CellNameToCoordinates(to); err != nil {
+			continue
+		}
+		if rewrite(&ref) {
+			sb.WriteString(formula[last:cellStart])
+			sb.WriteString(ref.String())
+			last = m[1]
+		}
+	}
+	if last == 0 {
+		return formula
+	}
+	sb.WriteString(formula[last:])
+	return sb.String()
+}
+
+func isFormulaNameChar(c byte) bool {
+	return c == '_' || c == '.' || isASCIILetter(c) || isASCIIDigit(c)
+}
+
+// findCircularReferences returns each set of formula cells that depend on
+// one another, including cells that refer to themselves
+func findCircularReferences(formulas map[string]string) [][]string {
+	type position struct{ col, row int }
+	bySheet := make(map[string]map[string]position)
+	for ref := range formulas {
+		sheet, cell := splitBoundCell(ref)
+		col, row, err := excelize.CellNameToCoordinates(cell)
+		if err != nil {
+			continue
+		}
+		if bySheet[sheet] == nil {
+			bySheet[sheet] = make(map[string]position)
+		}
+		bySheet[sheet][ref] = position{col, row}
+	}
+
+	edges := make(map[string][]string)
+	for ref, formula := range formulas {
+		sheet, _ := splitBoundCell(ref)
+		for _, r := range formulaReferences(formula, sheet) {
+			for target, p := range bySheet[r.sheet] {
+				if p.col >= r.fromCol && p.col <= r.toCol && p.row >= r.fromRow && p.row <= r.toRow {
+					edges[ref] = append(edges[ref], target)
+				}
+			}
+		}
+	}
+
+	// Tarjan's strongly connected components
+	index := make(map[string]int)
+	low := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	var cycles [][]string
+	var visit func(string)
+	visit = func(ref string) {
+		index[ref] = len(index)
+		low[ref] = index[ref]
+		stack = append(stack, ref)
+		onStack[ref] = true
+		for _, next := range edges[ref] {
+			if _, seen := index[next]; !seen {
+				visit(next)
+				low[ref] = min(low[ref], low[next])
+			} else if onStack[next] {
+				low[ref] = min(low[ref], index[next])
+			}
+		}
+		if low[ref] != index[ref] {
+			return
+		}
+		var component []string
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top] = false
+			component = append(component, top)
+			if top == ref {
+				break
+			}
+		}
+		if len(component) > 1 || contains(edges[ref], ref) {
+			cycles = append(cycles, sortedCellRefs(component))
+		}
+	}
+	for _, ref := range sortedFormulaCells(formulas) {
+		if _, seen := index[ref]; !seen {
+			visit(ref)
+		}
+	}
+	sort.Slice(cycles, func(i, j int) bool { return cycles[i][0] < cycles[j][0] })
+	return cycles
+}
+
+// sortedFormulaCells returns the cells of a formula map in sheet order
+func sortedFormulaCells(formulas map[string]string) []string {
+	refs := make([]string, 0, len(formulas))
+	for ref := range formulas {
+		refs = append(refs, ref)
+	}
+	return sortedCellRefs(refs)
+}
+
+// sortedCellRefs orders sheet-qualified cells by sheet, row and column
+func sortedCellRefs(refs []string) []string {
+	list := append([]string(nil), refs...)
+	key := func(ref string) (string, int, int) {
+		sheet, cell := splitBoundCell(ref)
+		col, row, _ := excelize.CellNameToCoordinates(cell)
+		return sheet, row, col
+	}
+	sort.Slice(list, func(i, j int) bool {
+		si, ri, ci := key(list[i])
+		sj, rj, cj := key(list[j])
+		if si != sj {
+			return si < sj
+		}
+		if ri != rj {
+			return ri < rj
+		}
+		return ci < cj
+	})
+	return list
+}
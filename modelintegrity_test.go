@@ -0,0 +1,180 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+// newIntegrityTestWorkbook writes a model with a formula error in each
+// common form, a circular pair, and statements that do not add up
+func newIntegrityTestWorkbook(t *testing.T, dir string) string {
+	t.Helper()
+	f := excelize.NewFile()
+	defer f.Close()
+	require.NoError(t, f.SetSheetName("Sheet1", "Model"))
+	_, err := f.NewSheet("Balance Sheet")
+	require.NoError(t, err)
+
+	set := func(sheet string, cells map[string]interface{}) {
+		for cell, value := range cells {
+			require.NoError(t, f.SetCellValue(sheet, cell, value))
+		}
+	}
+	formula := func(sheet string, cells map[string]string) {
+		for cell, value := range cells {
+			require.NoError(t, f.SetCellFormula(sheet, cell, value))
+		}
+	}
+
+	set("Model", map[string]interface{}{
+		"A1": "Revenue", "B1": 1000, "C1": 1200,
+		"A2": "Operating Expenses", "B2": -600, "C2": 700,
+		"A3": "EBITDA",
+		"A4": "EBITDA margin",
+		"A5": "Units", "B5": 0,
+		"A6": "Price per unit",
+		"A7": "Adjustment", "A8": "Adjusted EBITDA",
+		"A9": "Lookup",
+	})
+	formula("Model", map[string]string{
+		"B3": "B1+B2", "C3": "C1-C2+50",
+		"B4": "B3/B1", "C4": "C3/C1*10",
+		"B6": "B1/B5",
+		"B7": "B8*0.1", "B8": "B3+B7",
+		"B9":  "#REF!+1",
+		"B10": "SUM(B1:C1)",
+	})
+	percent, err := f.NewStyle(&excelize.Style{NumFmt: 10})
+	require.NoError(t, err)
+	require.NoError(t, f.SetCellStyle("Model", "B4", "C4", percent))
+
+	set("Balance Sheet", map[string]interface{}{
+		"A1": "Cash", "B1": 300, "C1": 400,
+		"A2": "Total Assets",
+		"A3": "Total Liabilities", "B3": 100, "C3": 150,
+		"A4": "Total Shareholders' Equity", "B4": 200, "C4": 200,
+	})
+	formula("Balance Sheet", map[string]string{"B2": "B1", "C2": "C1"})
+
+	path := filepath.Join(dir, "Model.xlsx")
+	require.NoError(t, f.SaveAs(path))
+	return path
+}
+
+func TestCheckModelIntegrity(t *testing.T) {
+	dir := t.TempDir()
+	path := newIntegrityTestWorkbook(t, dir)
+	populator := NewTemplatePopulator(NewTemplateParser(dir))
+
+	report, err := populator.CheckModelIntegrity(path, nil)
+	require.NoError(t, err)
+	assert.False(t, report.Passed)
+	assert.Equal(t, 11, report.Formulas)
+
+	issues := make(map[string]ModelIntegrityIssue)
+	for _, issue := range report.Issues {
+		issues[issue.Cells[0]] = issue
+	}
+
+	assert.Equal(t, IntegrityCircularReference, issues["Model!B7"].Kind)
+	assert.Equal(t, []string{"Model!B7", "Model!B8"}, issues["Model!B7"].Cells)
+	assert.Equal(t, "#DIV/0!", issues["Model!B6"].Value)
+	assert.Equal(t, "#REF!", issues["Model!B9"].Value)
+
+	// Operating expenses count against revenue whatever their sign
+	assert.Equal(t, IntegrityCheckFailed, issues["Model!C3"].Kind)
+	assert.Equal(t, "EBITDA in Model!C3 is 550 but revenue less operating expenses is 500", issues["Model!C3"].Message)
+	assert.NotContains(t, issues, "Model!B3")
+
+	assert.Equal(t, "Model!C4 holds 458.33%, outside 0-100%", issues["Model!C4"].Message)
+	assert.NotContains(t, issues, "Model!B4")
+
+	assert.Equal(t, "total assets in Balance Sheet!C2 are 400 but liabilities and equity total 350", issues["Balance Sheet!C2"].Message)
+	assert.NotContains(t, issues, "Balance Sheet!B2")
+	assert.Equal(t, 6, report.Errors)
+
+	results := make(map[string]ModelCheckResult)
+	for _, result := range report.Checks {
+		results[result.Name] = result
+	}
+	assert.Equal(t, ModelCheckResult{Name: ModelCheckBalanceSheet, Compared: 2, Failed: 1}, results[ModelCheckBalanceSheet])
+	assert.Equal(t, ModelCheckResult{Name: ModelCheckEBITDA, Compared: 2, Failed: 1}, results[ModelCheckEBITDA])
+}
+
+func TestCheckModelIntegrity_ConfiguredChecks(t *testing.T) {
+	dir := t.TempDir()
+	path := newIntegrityTestWorkbook(t, dir)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Model.checks.yaml"), []byte(`
+tolerance: 60
+defaults: [ebitda]
+checks:
+  - name: assets cover liabilities
+    assert: "'Balance Sheet'!B2:C2 = 'Balance Sheet'!B3:C3 + 'Balance Sheet'!B4:C4 + 0"
+  - name: growth
+    percent: Model!B1
+    whole: true
+    severity: warning
+  - name: broken
+    assert: Model!B1 = Missing!B1
+`), 0644))
+
+	config, err := LoadModelCheckConfig(path)
+	require.NoError(t, err)
+	require.NotNil(t, config)
+	report, err := NewTemplatePopulator(NewTemplateParser(dir)).CheckModelIntegrity(path, config)
+	require.NoError(t, err)
+
+	var checks []string
+	for _, result := range report.Checks {
+		checks = append(checks, result.Name)
+	}
+	assert.Equal(t, []string{"circular_references", "recalculation", ModelCheckEBITDA, "assets cover liabilities", "growth", "broken"}, checks)
+	assert.Equal(t, ModelCheckResult{Name: "assets cover liabilities", Compared: 2}, report.Checks[3], "differences within the tolerance pass")
+	assert.Equal(t, ModelCheckResult{Name: "broken", Skipped: "invalid check"}, report.Checks[5])
+
+	var messages []string
+	for _, issue := range report.Issues {
+		if issue.Check != "" {
+			messages = append(messages, issue.Severity+": "+issue.Message)
+		}
+	}
+	assert.Equal(t, []string{
+		"warning: Model!B1 holds 1000%, outside 0-100%",
+		`error: broken: sheet "Missing" does not exist`,
+	}, messages)
+	assert.Equal(t, 1, report.Warnings)
+}
+
+func TestModelIntegrityReportAttachedToJob(t *testing.T) {
+	tempDir := t.TempDir()
+	cs := &ConfigService{config: &Config{DealDoneRoot: filepath.Join(tempDir, "DealDone")}}
+	tm := NewTemplateManager(cs)
+	require.NoError(t, os.MkdirAll(cs.GetTemplatesPath(), 0755))
+	templatePath := newIntegrityTestWorkbook(t, cs.GetTemplatesPath())
+	require.NoError(t, os.WriteFile(filepath.Join(cs.GetTemplatesPath(), "Model.checks.json"), []byte(`{"defaults": []}`), 0644))
+
+	copyPath, err := tm.CopyTemplateToAnalysis(templatePath, "Acme")
+	require.NoError(t, err)
+	report, err := NewTemplatePopulator(NewTemplateParser(cs.GetTemplatesPath())).CheckPopulatedModel(copyPath)
+	require.NoError(t, err)
+	require.NotNil(t, report)
+	assert.Len(t, report.Checks, 2, "the copy keeps the template's checks")
+	assert.Equal(t, 3, report.Errors)
+
+	tracker := NewJobTrackerWithRepository(nil)
+	job := tracker.CreateJob("job-1", "Acme", TriggerFileChange, []string{copyPath})
+	require.NoError(t, tracker.AttachIntegrityReport(job.JobID, report))
+	require.NoError(t, tracker.AttachIntegrityReport(job.JobID, report))
+
+	stored, err := tracker.GetJob(job.JobID)
+	require.NoError(t, err)
+	require.Len(t, stored.IntegrityReports, 1, "a new report replaces the old one")
+	assert.Equal(t, "Model integrity checked for "+filepath.Base(copyPath)+": 3 errors, 0 warnings",
+		stored.ProcessingHistory[len(stored.ProcessingHistory)-1].Message)
+	assert.Error(t, tracker.AttachIntegrityReport("missing", report))
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"sort"
+	"strings"
+)
+
+// OCREngine performs character recognition on behalf of OCRService
+type OCREngine interface {
+	// Name returns the engine identifier (e.g. "tesseract")
+	Name() string
+
+	// IsAvailable reports whether the engine can run on this machine
+	IsAvailable() bool
+
+	// Recognize runs OCR on an image, multi-page TIFF or scanned PDF and
+	// returns one result per page
+	Recognize(ctx context.Context, path string, options OCROptions) ([]OCRPage, error)
+
+	// DetectOrientation returns the clockwise rotation in degrees (0, 90,
+	// 180 or 270) needed to make the text upright
+	DetectOrientation(ctx context.Context, imagePath string) (int, error)
+}
+
+// OCROptions controls a single recognition run
+type OCROptions struct {
+	Language    string `json:"language"`    // ISO 639-1 code, e.g. "en"
+	DPI         int    `json:"dpi"`         // Rasterization resolution for PDFs
+	PageSegMode int    `json:"pageSegMode"` // Engine-specific layout mode, 0 for default
+}
+
+// OCRPage is the recognition result for a single page
+type OCRPage struct {
+	Number     int       `json:"number"`
+	Text       string    `json:"text"`
+	Confidence float64   `json:"confidence"` // 0-1
+	Words      []OCRWord `json:"words,omitempty"`
+	Warning    string    `json:"warning,omitempty"` // Why the page could not be recognized
+}
+
+// OCRWord is a recognized word with its bounding box in pixels
+type OCRWord struct {
+	Text       string  `json:"text"`
+	Left       int     `json:"left"`
+	Top        int     `json:"top"`
+	Width      int     `json:"width"`
+	Height     int     `json:"height"`
+	Confidence float64 `json:"confidence"` // 0-1
+	Block      int     `json:"block"`
+	Line       int     `json:"line"`
+}
+
+// ocrLine is a group of words sharing a baseline
+type ocrLine struct {
+	top   int
+	words []OCRWord
+}
+
+// groupWordsIntoLines clusters words into lines by vertical overlap and sorts
+// each line left to right
+func groupWordsIntoLines(words []OCRWord) []ocrLine {
+	sorted := make([]OCRWord, len(words))
+	copy(sorted, words)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		if sorted[i].Top != sorted[j].Top {
+			return sorted[i].Top < sorted[j].Top
+		}
+		return sorted[i].Left < sorted[j].Left
+	})
+
+	lines := make([]ocrLine, 0)
+	for _, word := range sorted {
+		center := word.Top + word.Height/2
+		placed := false
+		for i := range lines {
+			ref := lines[i].words[0]
+			if center >= ref.Top && center <= ref.Top+ref.Height {
+				lines[i].words = append(lines[i].words, word)
+				placed = true
+				break
+			}
+		}
+		if !placed {
+			lines = append(lines, ocrLine{top: word.Top, words: []OCRWord{word}})
+		}
+	}
+
+	for i := range lines {
+		sort.SliceStable(lines[i].words, func(a, b int) bool {
+			return lines[i].words[a].Left < lines[i].words[b].Left
+		})
+	}
+	sort.SliceStable(lines, func(i, j int) bool { return lines[i].top < lines[j].top })
+
+	return lines
+}
+
+// buildTableFromWords reconstructs table rows from word positions. Words
+// separated by a gap wider than twice the line height start a new cell;
+// lines with fewer than two cells are not considered part of a table.
+func buildTableFromWords(words []OCRWord) [][]string {
+	table := make([][]string, 0)
+
+	for _, line := range groupWordsIntoLines(words) {
+		cells := make([]string, 0)
+		var current []string
+		prevRight := -1
+		for _, word := range line.words {
+			gapLimit := word.Height * 2
+			if gapLimit <= 0 {
+				gapLimit = 20
+			}
+			if prevRight >= 0 && word.Left-prevRight > gapLimit {
+				cells = append(cells, strings.Join(current, " "))
+				current = nil
+			}
+			current = append(current, word.Text)
+			prevRight = word.Left + word.Width
+		}
+		if len(current) > 0 {
+			cells = append(cells, strings.Join(current, " "))
+		}
+		if len(cells) >= 2 {
+			table = append(table, cells)
+		}
+	}
+
+	return table
+}
+
+// ocrLanguageCodes maps ISO 639-1 codes to tesseract language packs
+var ocrLanguageCodes = map[string]string{
+	"en": "eng",
+	"es": "spa",
+	"fr": "fra",
+	"de": "deu",
+	"it": "ita",
+	"pt": "por",
+	"zh": "chi_sim",
+	"ja": "jpn",
+	"ko": "kor",
+}
@@ -0,0 +1,660 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// TesseractEngine runs OCR by shelling out to a local tesseract binary.
+// Scanned PDFs are rasterized with pdftoppm when it is installed, otherwise
+// the embedded page images are extracted directly.
+type TesseractEngine struct {
+	binaryPath     string
+	rasterizerPath string
+}
+
+// NewTesseractEngine creates a tesseract engine. An empty binaryPath uses
+// $TESSERACT_PATH or the tesseract binary on PATH.
+func NewTesseractEngine(binaryPath string) *TesseractEngine {
+	if binaryPath == "" {
+		binaryPath = os.Getenv("TESSERACT_PATH")
+	}
+	if binaryPath == "" {
+		binaryPath = "tesseract"
+	}
+	return &TesseractEngine{
+		binaryPath:     binaryPath,
+		rasterizerPath: "pdftoppm",
+	}
+}
+
+// Name returns the engine identifier
+func (te *TesseractEngine) Name() string {
+	return "tesseract"
+}
+
+// IsAvailable checks that the tesseract binary can be found
+func (te *TesseractEngine) IsAvailable() bool {
+	_, err := exec.LookPath(te.binaryPath)
+	return err == nil
+}
+
+// Recognize runs tesseract on an image, multi-page TIFF or scanned PDF
+func (te *TesseractEngine) Recognize(ctx context.Context, path string, options OCROptions) ([]OCRPage, error) {
+	if strings.ToLower(filepath.Ext(path)) != ".pdf" {
+		// tesseract reports each frame of a multi-page TIFF as its own page
+		return te.recognizeImage(ctx, path, options)
+	}
+
+	tempDir, err := os.MkdirTemp("", "dealdone-ocr-*")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create OCR work directory: %w", err)
+	}
+	defer os.RemoveAll(tempDir)
+
+	images, err := te.rasterizePDF(ctx, path, tempDir, options.DPI)
+	if err != nil {
+		return nil, err
+	}
+
+	pages := make([]OCRPage, 0, len(images))
+	recognized := 0
+	for _, image := range images {
+		if image.Path == "" {
+			pages = append(pages, OCRPage{Number: image.Page, Warning: image.Warning})
+			continue
+		}
+		result, err := te.recognizeImage(ctx, image.Path, options)
+		if err != nil {
+			return nil, fmt.Errorf("OCR failed on page %d: %w", image.Page, err)
+		}
+		page := mergeOCRPages(result)
+		page.Number = image.Page
+		pages = append(pages, page)
+		recognized++
+	}
+	if recognized == 0 {
+		if len(pages) > 0 {
+			return nil, fmt.Errorf("no readable page images in %s: page %d: %s", filepath.Base(path), pages[0].Number, pages[0].Warning)
+		}
+		return nil, fmt.Errorf("no page images found in %s", filepath.Base(path))
+	}
+
+	return pages, nil
+}
+
+// recognizeImage runs tesseract with TSV output and parses the result
+func (te *TesseractEngine) recognizeImage(ctx context.Context, imagePath string, options OCROptions) ([]OCRPage, error) {
+	args := []string{imagePath, "stdout", "-l", tesseractLanguage(options.Language)}
+	if options.PageSegMode > 0 {
+		args = append(args, "--psm", strconv.Itoa(options.PageSegMode))
+	}
+	if options.DPI > 0 {
+		args = append(args, "--dpi", strconv.Itoa(options.DPI))
+	}
+	args = append(args, "tsv")
+
+	output, err := te.run(ctx, te.binaryPath, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	return parseTesseractTSV(output)
+}
+
+// DetectOrientation uses tesseract's orientation and script detection
+func (te *TesseractEngine) DetectOrientation(ctx context.Context, imagePath string) (int, error) {
+	output, err := te.run(ctx, te.binaryPath, imagePath, "stdout", "--psm", "0")
+	if err != nil {
+		return 0, err
+	}
+	return parseTesseractOrientation(output)
+}
+
+// run executes a command and returns its standard output
+func (te *TesseractEngine) run(ctx context.Context, name string, args ...string) ([]byte, error) {
+	cmd := exec.CommandContext(ctx, name, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		message := strings.TrimSpace(stderr.String())
+		if message == "" {
+			message = err.Error()
+		}
+		return nil, fmt.Errorf("%s failed: %s", filepath.Base(name), message)
+	}
+	return stdout.Bytes(), nil
+}
+
+// rasterizePDF renders each PDF page to an image in dir and returns the
+// images in page order
+func (te *TesseractEngine) rasterizePDF(ctx context.Context, pdfPath, dir string, dpi int) ([]pdfPageImage, error) {
+	if dpi <= 0 {
+		dpi = 300
+	}
+
+	if _, err := exec.LookPath(te.rasterizerPath); err == nil {
+		prefix := filepath.Join(dir, "page")
+		if _, err := te.run(ctx, te.rasterizerPath, "-r", strconv.Itoa(dpi), "-png", pdfPath, prefix); err != nil {
+			return nil, err
+		}
+		images, err := filepath.Glob(prefix + "-*.png")
+		if err != nil {
+			return nil, err
+		}
+		// pdftoppm zero-pads page numbers, so a lexical sort is page order
+		sort.Strings(images)
+		pages := make([]pdfPageImage, len(images))
+		for i, image := range images {
+			pages[i] = pdfPageImage{Page: i + 1, Path: image}
+		}
+		return pages, nil
+	}
+
+	return extractPDFPageImages(pdfPath, dir)
+}
+
+// parseTesseractTSV converts tesseract TSV output into pages of words
+func parseTesseractTSV(output []byte) ([]OCRPage, error) {
+	scanner := bufio.NewScanner(bytes.NewReader(output))
+	scanner.Buffer(make([]byte, 0, 64*1024), 4*1024*1024)
+
+	pageWords := make(map[int][]OCRWord)
+	pageOrder := make([]int, 0)
+	columns := map[string]int{}
+	header := true
+
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+		if header {
+			for i, name := range fields {
+				columns[name] = i
+			}
+			header = false
+			if _, ok := columns["level"]; !ok {
+				return nil, fmt.Errorf("unexpected tesseract output: missing TSV header")
+			}
+			continue
+		}
+		if len(fields) < len(columns) {
+			continue
+		}
+
+		field := func(name string) int {
+			value, _ := strconv.Atoi(fields[columns[name]])
+			return value
+		}
+
+		page := field("page_num")
+		if _, seen := pageWords[page]; !seen {
+			pageWords[page] = make([]OCRWord, 0)
+			pageOrder = append(pageOrder, page)
+		}
+
+		if field("level") != 5 {
+			continue
+		}
+		text := strings.TrimSpace(fields[columns["text"]])
+		conf, _ := strconv.ParseFloat(fields[columns["conf"]], 64)
+		if text == "" || conf < 0 {
+			continue
+		}
+
+		pageWords[page] = append(pageWords[page], OCRWord{
+			Text:       text,
+			Left:       field("left"),
+			Top:        field("top"),
+			Width:      field("width"),
+			Height:     field("height"),
+			Confidence: conf / 100,
+			Block:      field("block_num"),
+			Line:       field("par_num")*1000 + field("line_num"),
+		})
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read tesseract output: %w", err)
+	}
+
+	pages := make([]OCRPage, 0, len(pageOrder))
+	for _, number := range pageOrder {
+		words := pageWords[number]
+		pages = append(pages, OCRPage{
+			Number:     number,
+			Text:       tesseractWordsToText(words),
+			Confidence: averageWordConfidence(words),
+			Words:      words,
+		})
+	}
+	return pages, nil
+}
+
+// tesseractWordsToText rebuilds text from words using tesseract's own
+// block and line numbering
+func tesseractWordsToText(words []OCRWord) string {
+	var sb strings.Builder
+	prevBlock, prevLine := -1, -1
+	for _, word := range words {
+		switch {
+		case prevBlock == -1:
+		case word.Block != prevBlock:
+			sb.WriteString("\n\n")
+		case word.Line != prevLine:
+			sb.WriteString("\n")
+		default:
+			sb.WriteString(" ")
+		}
+		sb.WriteString(word.Text)
+		prevBlock, prevLine = word.Block, word.Line
+	}
+	return sb.String()
+}
+
+// averageWordConfidence returns the mean word confidence, or 0 for no words
+func averageWordConfidence(words []OCRWord) float64 {
+	if len(words) == 0 {
+		return 0
+	}
+	total := 0.0
+	for _, word := range words {
+		total += word.Confidence
+	}
+	return total / float64(len(words))
+}
+
+// mergeOCRPages combines pages into one, used when a single rasterized PDF
+// page is reported by the engine as several frames
+func mergeOCRPages(pages []OCRPage) OCRPage {
+	if len(pages) == 1 {
+		return pages[0]
+	}
+	merged := OCRPage{Number: 1}
+	texts := make([]string, 0, len(pages))
+	for _, page := range pages {
+		texts = append(texts, page.Text)
+		merged.Words = append(merged.Words, page.Words...)
+	}
+	merged.Text = strings.Join(texts, "\n\n")
+	merged.Confidence = averageWordConfidence(merged.Words)
+	return merged
+}
+
+var tesseractRotatePattern = regexp.MustCompile(`Rotate:\s*(\d+)`)
+
+// parseTesseractOrientation reads the rotation from --psm 0 output
+func parseTesseractOrientation(output []byte) (int, error) {
+	match := tesseractRotatePattern.FindSubmatch(output)
+	if match == nil {
+		return 0, fmt.Errorf("orientation not reported by tesseract")
+	}
+	rotation, _ := strconv.Atoi(string(match[1]))
+	return rotation % 360, nil
+}
+
+// tesseractLanguage converts an ISO 639-1 code to a tesseract language pack
+func tesseractLanguage(language string) string {
+	if code, ok := ocrLanguageCodes[language]; ok {
+		return code
+	}
+	if language == "" {
+		return "eng"
+	}
+	return language
+}
+
+var (
+	pdfXObjectDictRef      = regexp.MustCompile(`/XObject\s+(\d+)\s+\d+\s+R`)
+	pdfXObjectDictInner    = regexp.MustCompile(`/XObject\s*<<([^>]*)>>`)
+	pdfImageWidth          = regexp.MustCompile(`/Width\s+(\d+)`)
+	pdfImageHeight         = regexp.MustCompile(`/Height\s+(\d+)`)
+	pdfImageBits           = regexp.MustCompile(`/BitsPerComponent\s+(\d+)`)
+	pdfImageInverted       = regexp.MustCompile(`/Decode\s*\[\s*1(\.0*)?\s+0(\.0*)?\s*\]`)
+	pdfDecodePredictor     = regexp.MustCompile(`/Predictor\s+(\d+)`)
+	pdfDecodeColors        = regexp.MustCompile(`/Colors\s+(\d+)`)
+	pdfDecodeColumns       = regexp.MustCompile(`/Columns\s+(\d+)`)
+	pdfDecodeRows          = regexp.MustCompile(`/Rows\s+(\d+)`)
+	pdfFaxK                = regexp.MustCompile(`/K\s+(-?\d+)`)
+	pdfFaxEndOfLine        = regexp.MustCompile(`/EndOfLine\s+true`)
+	pdfFaxEncodedByteAlign = regexp.MustCompile(`/EncodedByteAlign\s+true`)
+)
+
+// pdfPageImage is the image extracted for one page of a scanned PDF. Path is
+// empty, and Warning says why, when the page's image could not be written.
+type pdfPageImage struct {
+	Page    int
+	Path    string
+	Warning string
+}
+
+// extractPDFPageImages writes the largest embedded image of each PDF page to
+// dir. It is the fallback used when no rasterizer is installed, and covers
+// the common case of scanners that store one JPEG, fax or raw bitmap image
+// per page. A page whose image cannot be written is reported with a warning
+// rather than failing the document.
+func extractPDFPageImages(pdfPath, dir string) ([]pdfPageImage, error) {
+	data, err := os.ReadFile(pdfPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF file: %w", err)
+	}
+
+	objects := parsePDFObjects(data)
+	images := make([]pdfPageImage, 0)
+
+	for i, page := range orderPDFPages(objects) {
+		resources := page.dict
+		if match := pdfResourcesRef.FindStringSubmatch(page.dict); match != nil {
+			number, _ := strconv.Atoi(match[1])
+			if obj, ok := objects[number]; ok {
+				resources = obj.dict
+			}
+		}
+
+		xobjects := ""
+		if match := pdfXObjectDictRef.FindStringSubmatch(resources); match != nil {
+			number, _ := strconv.Atoi(match[1])
+			if obj, ok := objects[number]; ok {
+				xobjects = obj.dict
+			}
+		} else if match := pdfXObjectDictInner.FindStringSubmatch(resources); match != nil {
+			xobjects = match[1]
+		}
+
+		var best *pdfObject
+		for _, entry := range pdfFontEntry.FindAllStringSubmatch(xobjects, -1) {
+			number, _ := strconv.Atoi(entry[2])
+			obj, ok := objects[number]
+			if !ok || obj.raw == nil {
+				continue
+			}
+			if best == nil || len(obj.raw) > len(best.raw) {
+				best = obj
+			}
+		}
+		if best == nil {
+			continue
+		}
+
+		path, err := writePDFImage(best, filepath.Join(dir, fmt.Sprintf("page-%04d", i+1)))
+		if err != nil {
+			images = append(images, pdfPageImage{Page: i + 1, Warning: fmt.Sprintf("page image not readable: %v", err)})
+			continue
+		}
+		images = append(images, pdfPageImage{Page: i + 1, Path: path})
+	}
+
+	return images, nil
+}
+
+// writePDFImage saves an image XObject in a format tesseract can read and
+// returns the written path
+func writePDFImage(obj *pdfObject, basePath string) (string, error) {
+	switch {
+	case strings.Contains(obj.dict, "/DCTDecode"):
+		path := basePath + ".jpg"
+		return path, os.WriteFile(path, obj.raw, 0644)
+	case strings.Contains(obj.dict, "/JPXDecode"):
+		path := basePath + ".jp2"
+		return path, os.WriteFile(path, obj.raw, 0644)
+	case strings.Contains(obj.dict, "/CCITTFaxDecode"):
+		return writePDFFaxAsTIFF(obj.dict, obj.raw, basePath)
+	case isPDFFlate(obj.dict):
+		bitmap := inflatePDFStream(obj.raw)
+		if bitmap == nil {
+			return "", fmt.Errorf("invalid FlateDecode data")
+		}
+		return writePDFBitmapAsPGM(obj.dict, bitmap, basePath)
+	case !strings.Contains(obj.dict, "/Filter"):
+		return writePDFBitmapAsPGM(obj.dict, obj.raw, basePath)
+	}
+	return "", fmt.Errorf("unsupported image encoding")
+}
+
+// pdfImageComponents returns the color components of an image's color
+// space, or 0 when the dictionary does not say
+func pdfImageComponents(dict string) int {
+	switch {
+	case strings.Contains(dict, "/DeviceGray"), strings.Contains(dict, "/CalGray"), strings.Contains(dict, "/ImageMask true"):
+		return 1
+	case strings.Contains(dict, "/DeviceRGB"), strings.Contains(dict, "/CalRGB"):
+		return 3
+	case strings.Contains(dict, "/DeviceCMYK"):
+		return 4
+	}
+	return 0
+}
+
+// pdfIntParam returns the integer a pattern captures in dict, or fallback
+func pdfIntParam(pattern *regexp.Regexp, dict string, fallback int) int {
+	if match := pattern.FindStringSubmatch(dict); match != nil {
+		if value, err := strconv.Atoi(match[1]); err == nil {
+			return value
+		}
+	}
+	return fallback
+}
+
+// writePDFBitmapAsPGM writes 1-bit or 8-bit grayscale, RGB or CMYK bitmap
+// data as a portable graymap, which leptonica reads without extra libraries
+func writePDFBitmapAsPGM(dict string, data []byte, basePath string) (string, error) {
+	width := pdfIntParam(pdfImageWidth, dict, 0)
+	height := pdfIntParam(pdfImageHeight, dict, 0)
+	bits := pdfIntParam(pdfImageBits, dict, 8)
+	if strings.Contains(dict, "/Indexed") {
+		return "", fmt.Errorf("unsupported indexed color space")
+	}
+	if width <= 0 || height <= 0 || (bits != 1 && bits != 8) {
+		return "", fmt.Errorf("unsupported bitmap layout")
+	}
+
+	components := pdfImageComponents(dict)
+	if predictor := pdfIntParam(pdfDecodePredictor, dict, 1); predictor >= 10 {
+		colors := pdfIntParam(pdfDecodeColors, dict, max(components, 1))
+		columns := pdfIntParam(pdfDecodeColumns, dict, width)
+		var err error
+		if data, err = undoPNGPredictor(data, (columns*colors*bits+7)/8, (colors*bits+7)/8); err != nil {
+			return "", err
+		}
+		components = colors
+	} else if predictor != 1 {
+		return "", fmt.Errorf("unsupported predictor %d", predictor)
+	}
+
+	stride := func(c int) int { return (width*c*bits + 7) / 8 }
+	if components == 0 {
+		// ICC-based and other color spaces: go by the data length
+		for _, c := range []int{1, 3, 4} {
+			if len(data) == stride(c)*height {
+				components = c
+				break
+			}
+		}
+	}
+	if components == 0 || (bits == 1 && components != 1) || len(data) < stride(components)*height {
+		return "", fmt.Errorf("unsupported bitmap color space")
+	}
+
+	inverted := pdfImageInverted.MatchString(dict)
+	gray := make([]byte, width*height)
+	for y := 0; y < height; y++ {
+		row := data[y*stride(components) : (y+1)*stride(components)]
+		for x := 0; x < width; x++ {
+			var value int
+			switch {
+			case bits == 1:
+				if row[x/8]&(0x80>>(x%8)) != 0 {
+					value = 255
+				}
+			case components == 1:
+				value = int(row[x])
+			case components == 3:
+				r, g, b := int(row[x*3]), int(row[x*3+1]), int(row[x*3+2])
+				value = (299*r + 587*g + 114*b) / 1000
+			case components == 4:
+				c, m, ye, k := int(row[x*4]), int(row[x*4+1]), int(row[x*4+2]), int(row[x*4+3])
+				value = 255 - min(255, (299*c+587*m+114*ye)/1000+k)
+			}
+			if inverted {
+				value = 255 - value
+			}
+			gray[y*width+x] = byte(value)
+		}
+	}
+
+	path := basePath + ".pgm"
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "P5\n%d %d\n255\n", width, height)
+	buf.Write(gray)
+	return path, os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// undoPNGPredictor reverses the PNG row filters that a /Predictor of 10 or
+// more applies. Each row of rowLen bytes is preceded by its filter type and
+// bpp is the number of bytes per pixel.
+func undoPNGPredictor(data []byte, rowLen, bpp int) ([]byte, error) {
+	if rowLen <= 0 || bpp <= 0 {
+		return nil, fmt.Errorf("invalid predictor parameters")
+	}
+
+	rows := len(data) / (rowLen + 1)
+	out := make([]byte, rows*rowLen)
+	prev := make([]byte, rowLen)
+	for r := 0; r < rows; r++ {
+		filter := data[r*(rowLen+1)]
+		in := data[r*(rowLen+1)+1 : (r+1)*(rowLen+1)]
+		cur := out[r*rowLen : (r+1)*rowLen]
+		for i := range cur {
+			var left, upLeft byte
+			if i >= bpp {
+				left, upLeft = cur[i-bpp], prev[i-bpp]
+			}
+			switch filter {
+			case 0:
+				cur[i] = in[i]
+			case 1:
+				cur[i] = in[i] + left
+			case 2:
+				cur[i] = in[i] + prev[i]
+			case 3:
+				cur[i] = in[i] + byte((int(left)+int(prev[i]))/2)
+			case 4:
+				cur[i] = in[i] + paethPredictor(left, prev[i], upLeft)
+			default:
+				return nil, fmt.Errorf("unknown PNG filter type %d", filter)
+			}
+		}
+		prev = cur
+	}
+	return out, nil
+}
+
+// paethPredictor picks whichever of the left, upper and upper-left bytes is
+// closest to their linear estimate
+func paethPredictor(a, b, c byte) byte {
+	p := int(a) + int(b) - int(c)
+	pa, pb, pc := p-int(a), p-int(b), p-int(c)
+	if pa < 0 {
+		pa = -pa
+	}
+	if pb < 0 {
+		pb = -pb
+	}
+	if pc < 0 {
+		pc = -pc
+	}
+	switch {
+	case pa <= pb && pa <= pc:
+		return a
+	case pb <= pc:
+		return b
+	}
+	return c
+}
+
+// writePDFFaxAsTIFF wraps CCITT fax data in a single-strip TIFF, which
+// leptonica decodes through libtiff. The fax codes themselves say which runs
+// are black, so BlackIs1 needs no translation; only a [1 0] decode array
+// inverts the image.
+func writePDFFaxAsTIFF(dict string, data []byte, basePath string) (string, error) {
+	columns := pdfIntParam(pdfDecodeColumns, dict, pdfIntParam(pdfImageWidth, dict, 1728))
+	rows := pdfIntParam(pdfDecodeRows, dict, pdfIntParam(pdfImageHeight, dict, 0))
+	if columns <= 0 || rows <= 0 {
+		return "", fmt.Errorf("unsupported fax image size")
+	}
+
+	// Group 4 for K < 0; Group 3 needs end-of-line codes unless the rows
+	// are byte-aligned one-dimensional runs
+	var compression, t4Options uint32
+	k := pdfIntParam(pdfFaxK, dict, 0)
+	switch {
+	case k < 0:
+		compression = 4
+	case pdfFaxEndOfLine.MatchString(dict):
+		compression = 3
+		if k > 0 {
+			t4Options |= 1
+		}
+		if pdfFaxEncodedByteAlign.MatchString(dict) {
+			t4Options |= 4
+		}
+	case k == 0 && pdfFaxEncodedByteAlign.MatchString(dict):
+		compression = 2
+	default:
+		return "", fmt.Errorf("unsupported CCITT Group 3 layout")
+	}
+
+	var photometric uint32
+	if pdfImageInverted.MatchString(dict) {
+		photometric = 1
+	}
+
+	type tiffEntry struct {
+		tag, kind uint16
+		value     uint32
+	}
+	const tiffShort, tiffLong = 3, 4
+	entries := []tiffEntry{
+		{256, tiffLong, uint32(columns)},
+		{257, tiffLong, uint32(rows)},
+		{258, tiffShort, 1},
+		{259, tiffShort, compression},
+		{262, tiffShort, photometric},
+		{273, tiffLong, 0}, // Strip offset, set below
+		{277, tiffShort, 1},
+		{278, tiffLong, uint32(rows)},
+		{279, tiffLong, uint32(len(data))},
+	}
+	if compression == 3 {
+		entries = append(entries, tiffEntry{292, tiffLong, t4Options})
+	}
+	entries[5].value = uint32(8 + 2 + 12*len(entries) + 4)
+
+	var buf bytes.Buffer
+	buf.WriteString("II*\x00")
+	binary.Write(&buf, binary.LittleEndian, uint32(8))
+	binary.Write(&buf, binary.LittleEndian, uint16(len(entries)))
+	for _, entry := range entries {
+		binary.Write(&buf, binary.LittleEndian, []uint16{entry.tag, entry.kind})
+		binary.Write(&buf, binary.LittleEndian, uint32(1))
+		if entry.kind == tiffShort {
+			binary.Write(&buf, binary.LittleEndian, []uint16{uint16(entry.value), 0})
+		} else {
+			binary.Write(&buf, binary.LittleEndian, entry.value)
+		}
+	}
+	binary.Write(&buf, binary.LittleEndian, uint32(0))
+	buf.Write(data)
+
+	path := basePath + ".tif"
+	return path, os.WriteFile(path, buf.Bytes(), 0644)
+}
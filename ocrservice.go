@@ -1,36 +1,81 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"image"
+	"image/color"
+	_ "image/jpeg"
+	"image/png"
+	"os"
 	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"time"
 )
 
 // OCRService handles optical character recognition for scanned documents
 type OCRService struct {
 	enabled  bool
 	provider string // "tesseract", "cloud", etc.
+	engine   OCREngine
+	language string
+	dpi      int
+	timeout  time.Duration
+	mu       sync.RWMutex
 }
 
 // NewOCRService creates a new OCR service
 func NewOCRService(provider string) *OCRService {
+	var engine OCREngine
+	switch provider {
+	case "tesseract":
+		engine = NewTesseractEngine("")
+	}
+
 	return &OCRService{
 		enabled:  provider != "",
 		provider: provider,
+		engine:   engine,
+		language: "en",
+		dpi:      300,
+		timeout:  2 * time.Minute,
+	}
+}
+
+// NewOCRServiceWithEngine creates an OCR service backed by the given engine
+func NewOCRServiceWithEngine(engine OCREngine) *OCRService {
+	ocr := NewOCRService(engine.Name())
+	ocr.engine = engine
+	return ocr
+}
+
+// SetEngine replaces the OCR engine
+func (os *OCRService) SetEngine(engine OCREngine) {
+	os.mu.Lock()
+	defer os.mu.Unlock()
+	os.engine = engine
+	if engine != nil {
+		os.provider = engine.Name()
+		os.enabled = true
 	}
 }
 
 // OCRResult represents the result of OCR processing
 type OCRResult struct {
-	Text       string  `json:"text"`
-	Confidence float64 `json:"confidence"`
-	Language   string  `json:"language"`
-	PageCount  int     `json:"pageCount"`
-	HasErrors  bool    `json:"hasErrors"`
-	Error      string  `json:"error,omitempty"`
+	Text       string    `json:"text"`
+	Confidence float64   `json:"confidence"`
+	Language   string    `json:"language"`
+	PageCount  int       `json:"pageCount"`
+	Pages      []OCRPage `json:"pages,omitempty"`
+	HasErrors  bool      `json:"hasErrors"`
+	Error      string    `json:"error,omitempty"`
+	Warnings   []string  `json:"warnings,omitempty"` // Pages that could not be recognized
 }
 
-// ProcessImage performs OCR on an image file
+// ProcessImage performs OCR on an image file. Multi-page TIFFs produce one
+// page per frame.
 func (os *OCRService) ProcessImage(imagePath string) (*OCRResult, error) {
 	if !os.enabled {
 		return nil, fmt.Errorf("OCR service is not enabled")
@@ -41,35 +86,82 @@ func (os *OCRService) ProcessImage(imagePath string) (*OCRResult, error) {
 		return nil, fmt.Errorf("unsupported image format: %s", filepath.Ext(imagePath))
 	}
 
-	// In a real implementation, this would call the actual OCR provider
-	// For now, return a placeholder result
-	return &OCRResult{
-		Text:       fmt.Sprintf("Placeholder OCR text from %s", filepath.Base(imagePath)),
-		Confidence: 0.95,
-		Language:   "en",
-		PageCount:  1,
-		HasErrors:  false,
-	}, nil
+	return os.recognize(imagePath)
 }
 
-// ProcessPDF performs OCR on a scanned PDF
+// ProcessPDF performs OCR on a scanned PDF page by page
 func (os *OCRService) ProcessPDF(pdfPath string) (*OCRResult, error) {
 	if !os.enabled {
 		return nil, fmt.Errorf("OCR service is not enabled")
 	}
 
-	// In a real implementation, this would:
-	// 1. Check if PDF contains text already
-	// 2. If not, extract images and run OCR
-	// 3. Combine results from all pages
+	return os.recognize(pdfPath)
+}
+
+// recognize dispatches to the engine and aggregates per-page results
+func (os *OCRService) recognize(path string) (*OCRResult, error) {
+	engine, err := os.availableEngine()
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), os.timeout)
+	defer cancel()
+
+	options := os.options()
+	pages, err := engine.Recognize(ctx, path, options)
+	if err != nil {
+		return nil, fmt.Errorf("%s OCR failed for %s: %w", engine.Name(), filepath.Base(path), err)
+	}
+
+	texts := make([]string, 0, len(pages))
+	var warnings []string
+	totalConfidence := 0.0
+	for _, page := range pages {
+		if page.Warning != "" {
+			warnings = append(warnings, fmt.Sprintf("page %d: %s", page.Number, page.Warning))
+			continue
+		}
+		texts = append(texts, page.Text)
+		totalConfidence += page.Confidence
+	}
+
+	result := &OCRResult{
+		Text:      strings.Join(texts, "\n\n"),
+		Language:  options.Language,
+		PageCount: len(pages),
+		Pages:     pages,
+		Warnings:  warnings,
+	}
+	if len(texts) > 0 {
+		result.Confidence = totalConfidence / float64(len(texts))
+	}
 
-	return &OCRResult{
-		Text:       fmt.Sprintf("Placeholder OCR text from PDF %s", filepath.Base(pdfPath)),
-		Confidence: 0.92,
-		Language:   "en",
-		PageCount:  5, // Placeholder
-		HasErrors:  false,
-	}, nil
+	return result, nil
+}
+
+// availableEngine returns the configured engine if it can run
+func (os *OCRService) availableEngine() (OCREngine, error) {
+	os.mu.RLock()
+	defer os.mu.RUnlock()
+
+	if os.engine == nil {
+		return nil, fmt.Errorf("no OCR engine available for provider %q", os.provider)
+	}
+	if !os.engine.IsAvailable() {
+		return nil, fmt.Errorf("OCR engine %s is not installed", os.engine.Name())
+	}
+	return os.engine, nil
+}
+
+// options returns the recognition options for the current configuration
+func (os *OCRService) options() OCROptions {
+	os.mu.RLock()
+	defer os.mu.RUnlock()
+	return OCROptions{
+		Language: os.language,
+		DPI:      os.dpi,
+	}
 }
 
 // isSupportedImageFormat checks if the image format is supported for OCR
@@ -93,44 +185,81 @@ func (os *OCRService) DetectTextOrientation(imagePath string) (int, error) {
 		return 0, fmt.Errorf("OCR service is not enabled")
 	}
 
-	// Placeholder - in real implementation would detect orientation
+	engine, err := os.availableEngine()
+	if err != nil {
+		return 0, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), os.timeout)
+	defer cancel()
+
 	// Returns rotation needed in degrees (0, 90, 180, 270)
-	return 0, nil
+	return engine.DetectOrientation(ctx, imagePath)
 }
 
-// PreprocessImage improves image quality for OCR
+// PreprocessImage improves image quality for OCR by rotating the page
+// upright, converting to grayscale and stretching contrast. It returns the
+// original path if the image cannot be decoded; otherwise the returned file
+// is temporary and the caller removes it.
 func (os *OCRService) PreprocessImage(imagePath string) (string, error) {
 	if !os.enabled {
 		return "", fmt.Errorf("OCR service is not enabled")
 	}
 
-	// In real implementation would:
-	// - Convert to grayscale
-	// - Adjust contrast
-	// - Remove noise
-	// - Deskew
-	// Return path to processed image
+	img, err := decodeImageFile(imagePath)
+	if err != nil {
+		// Formats without a Go decoder (TIFF, BMP) are passed through as-is
+		return imagePath, nil
+	}
+
+	rotation := 0
+	if detected, err := os.DetectTextOrientation(imagePath); err == nil {
+		rotation = detected
+	}
+
+	processed := stretchContrast(rotateGray(toGray(img), rotation))
+
+	outFile, err := createTempImage(imagePath)
+	if err != nil {
+		return imagePath, nil
+	}
+	defer outFile.Close()
+
+	if err := png.Encode(outFile, processed); err != nil {
+		outFile.Close()
+		removeTempImage(outFile.Name())
+		return imagePath, nil
+	}
 
-	return imagePath, nil
+	return outFile.Name(), nil
 }
 
-// ExtractTables extracts tabular data from images
+// ExtractTables extracts tabular data from images by grouping recognized
+// words into rows and splitting cells on wide horizontal gaps
 func (os *OCRService) ExtractTables(imagePath string) ([][]string, error) {
 	if !os.enabled {
 		return nil, fmt.Errorf("OCR service is not enabled")
 	}
 
-	// Placeholder for table extraction
-	// In real implementation would detect and extract tables
-	return [][]string{
-		{"Header1", "Header2", "Header3"},
-		{"Data1", "Data2", "Data3"},
-	}, nil
+	result, err := os.recognize(imagePath)
+	if err != nil {
+		return nil, err
+	}
+
+	table := make([][]string, 0)
+	for _, page := range result.Pages {
+		table = append(table, buildTableFromWords(page.Words)...)
+	}
+	return table, nil
 }
 
-// IsEnabled returns whether OCR service is configured
+// IsEnabled returns whether OCR service is configured and its engine can run
 func (os *OCRService) IsEnabled() bool {
-	return os.enabled
+	if !os.enabled {
+		return false
+	}
+	_, err := os.availableEngine()
+	return err == nil
 }
 
 // GetProvider returns the OCR provider name
@@ -145,18 +274,27 @@ func (os *OCRService) BatchProcess(imagePaths []string) ([]*OCRResult, error) {
 	}
 
 	results := make([]*OCRResult, len(imagePaths))
+	semaphore := make(chan struct{}, runtime.NumCPU())
+	var wg sync.WaitGroup
 
-	// In real implementation, this would process in parallel
 	for i, path := range imagePaths {
-		result, err := os.ProcessImage(path)
-		if err != nil {
-			result = &OCRResult{
-				HasErrors: true,
-				Error:     err.Error(),
+		wg.Add(1)
+		go func(i int, path string) {
+			defer wg.Done()
+			semaphore <- struct{}{}
+			defer func() { <-semaphore }()
+
+			result, err := os.ProcessImage(path)
+			if err != nil {
+				result = &OCRResult{
+					HasErrors: true,
+					Error:     err.Error(),
+				}
 			}
-		}
-		results[i] = result
+			results[i] = result
+		}(i, path)
 	}
+	wg.Wait()
 
 	return results, nil
 }
@@ -181,9 +319,104 @@ func (os *OCRService) ConfigureLanguage(language string) error {
 	supported := os.GetSupportedLanguages()
 	for _, lang := range supported {
 		if lang == language {
-			// In real implementation, would configure the OCR engine
+			os.mu.Lock()
+			os.language = language
+			os.mu.Unlock()
 			return nil
 		}
 	}
 	return fmt.Errorf("unsupported language: %s", language)
 }
+
+// GetLanguage returns the configured OCR language
+func (os *OCRService) GetLanguage() string {
+	os.mu.RLock()
+	defer os.mu.RUnlock()
+	return os.language
+}
+
+// decodeImageFile decodes a JPEG or PNG image
+func decodeImageFile(path string) (image.Image, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	img, _, err := image.Decode(file)
+	return img, err
+}
+
+// createTempImage creates a temporary PNG file named after the source image
+func createTempImage(sourcePath string) (*os.File, error) {
+	base := strings.TrimSuffix(filepath.Base(sourcePath), filepath.Ext(sourcePath))
+	return os.CreateTemp("", "dealdone-ocr-"+base+"-*.png")
+}
+
+// removeTempImage deletes a temporary image
+func removeTempImage(path string) {
+	os.Remove(path)
+}
+
+// toGray converts an image to 8-bit grayscale
+func toGray(img image.Image) *image.Gray {
+	bounds := img.Bounds()
+	gray := image.NewGray(image.Rect(0, 0, bounds.Dx(), bounds.Dy()))
+	for y := bounds.Min.Y; y < bounds.Max.Y; y++ {
+		for x := bounds.Min.X; x < bounds.Max.X; x++ {
+			gray.Set(x-bounds.Min.X, y-bounds.Min.Y, color.GrayModel.Convert(img.At(x, y)))
+		}
+	}
+	return gray
+}
+
+// rotateGray rotates a grayscale image clockwise by 90, 180 or 270 degrees
+func rotateGray(src *image.Gray, degrees int) *image.Gray {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	switch degrees {
+	case 90, 270:
+		dst := image.NewGray(image.Rect(0, 0, h, w))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				if degrees == 90 {
+					dst.SetGray(h-1-y, x, src.GrayAt(x, y))
+				} else {
+					dst.SetGray(y, w-1-x, src.GrayAt(x, y))
+				}
+			}
+		}
+		return dst
+	case 180:
+		dst := image.NewGray(image.Rect(0, 0, w, h))
+		for y := 0; y < h; y++ {
+			for x := 0; x < w; x++ {
+				dst.SetGray(w-1-x, h-1-y, src.GrayAt(x, y))
+			}
+		}
+		return dst
+	}
+	return src
+}
+
+// stretchContrast expands the gray levels to the full 0-255 range, which
+// helps faded photocopies
+func stretchContrast(img *image.Gray) *image.Gray {
+	low, high := uint8(255), uint8(0)
+	for _, v := range img.Pix {
+		if v < low {
+			low = v
+		}
+		if v > high {
+			high = v
+		}
+	}
+	if high <= low {
+		return img
+	}
+
+	scale := 255.0 / float64(high-low)
+	for i, v := range img.Pix {
+		img.Pix[i] = uint8(float64(v-low) * scale)
+	}
+	return img
+}
@@ -1,6 +1,13 @@
 package main
 
 import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -35,7 +42,7 @@ func TestOCRService(t *testing.T) {
 	})
 
 	t.Run("ProcessImage validates image format", func(t *testing.T) {
-		ocr := NewOCRService("tesseract")
+		ocr := NewOCRServiceWithEngine(NewFakeOCREngine())
 
 		// Unsupported format
 		_, err := ocr.ProcessImage("document.txt")
@@ -68,7 +75,7 @@ func TestOCRService(t *testing.T) {
 	})
 
 	t.Run("ProcessPDF handles PDF files", func(t *testing.T) {
-		ocr := NewOCRService("tesseract")
+		ocr := NewOCRServiceWithEngine(NewFakeOCREngine())
 
 		result, err := ocr.ProcessPDF("scanned.pdf")
 		if err != nil {
@@ -85,7 +92,7 @@ func TestOCRService(t *testing.T) {
 	})
 
 	t.Run("isSupportedImageFormat checks formats", func(t *testing.T) {
-		ocr := NewOCRService("tesseract")
+		ocr := NewOCRServiceWithEngine(NewFakeOCREngine())
 
 		supportedFormats := []string{
 			"test.jpg", "test.jpeg", "test.png",
@@ -110,7 +117,7 @@ func TestOCRService(t *testing.T) {
 	})
 
 	t.Run("GetSupportedLanguages returns languages", func(t *testing.T) {
-		ocr := NewOCRService("tesseract")
+		ocr := NewOCRServiceWithEngine(NewFakeOCREngine())
 
 		languages := ocr.GetSupportedLanguages()
 		if len(languages) == 0 {
@@ -132,7 +139,7 @@ func TestOCRService(t *testing.T) {
 	})
 
 	t.Run("ConfigureLanguage validates language", func(t *testing.T) {
-		ocr := NewOCRService("tesseract")
+		ocr := NewOCRServiceWithEngine(NewFakeOCREngine())
 
 		// Valid language
 		err := ocr.ConfigureLanguage("en")
@@ -148,7 +155,7 @@ func TestOCRService(t *testing.T) {
 	})
 
 	t.Run("BatchProcess handles multiple images", func(t *testing.T) {
-		ocr := NewOCRService("tesseract")
+		ocr := NewOCRServiceWithEngine(NewFakeOCREngine())
 
 		images := []string{"scan1.jpg", "scan2.png", "scan3.tiff"}
 		results, err := ocr.BatchProcess(images)
@@ -169,7 +176,7 @@ func TestOCRService(t *testing.T) {
 	})
 
 	t.Run("ExtractTables returns table data", func(t *testing.T) {
-		ocr := NewOCRService("tesseract")
+		ocr := NewOCRServiceWithEngine(NewFakeOCREngine())
 
 		tables, err := ocr.ExtractTables("table.jpg")
 		if err != nil {
@@ -186,7 +193,7 @@ func TestOCRService(t *testing.T) {
 	})
 
 	t.Run("PreprocessImage returns processed path", func(t *testing.T) {
-		ocr := NewOCRService("tesseract")
+		ocr := NewOCRServiceWithEngine(NewFakeOCREngine())
 
 		processedPath, err := ocr.PreprocessImage("original.jpg")
 		if err != nil {
@@ -199,7 +206,7 @@ func TestOCRService(t *testing.T) {
 	})
 
 	t.Run("DetectTextOrientation returns rotation", func(t *testing.T) {
-		ocr := NewOCRService("tesseract")
+		ocr := NewOCRServiceWithEngine(NewFakeOCREngine())
 
 		rotation, err := ocr.DetectTextOrientation("rotated.jpg")
 		if err != nil {
@@ -212,3 +219,227 @@ func TestOCRService(t *testing.T) {
 		}
 	})
 }
+
+func TestOCRServiceEngineDispatch(t *testing.T) {
+	t.Run("aggregates per-page results and honours language", func(t *testing.T) {
+		engine := NewFakeOCREngine()
+		engine.SetPages("nda_signed.tiff",
+			OCRPage{Number: 1, Text: "MUTUAL NON-DISCLOSURE AGREEMENT", Confidence: 0.96},
+			OCRPage{Number: 2, Text: "Signed by the parties", Confidence: 0.80},
+		)
+		ocr := NewOCRServiceWithEngine(engine)
+
+		if err := ocr.ConfigureLanguage("de"); err != nil {
+			t.Fatalf("ConfigureLanguage failed: %v", err)
+		}
+
+		result, err := ocr.ProcessImage("nda_signed.tiff")
+		if err != nil {
+			t.Fatalf("ProcessImage failed: %v", err)
+		}
+		if result.PageCount != 2 || len(result.Pages) != 2 {
+			t.Fatalf("Expected 2 pages, got %d", result.PageCount)
+		}
+		if result.Pages[1].Confidence != 0.80 {
+			t.Errorf("Expected per-page confidence to be preserved, got %f", result.Pages[1].Confidence)
+		}
+		if result.Confidence < 0.879 || result.Confidence > 0.881 {
+			t.Errorf("Expected mean confidence 0.88, got %f", result.Confidence)
+		}
+		if result.Language != "de" {
+			t.Errorf("Expected result language 'de', got %s", result.Language)
+		}
+
+		calls := engine.Calls()
+		if len(calls) != 1 || calls[0].Language != "de" {
+			t.Errorf("Expected engine to receive configured language, got %+v", calls)
+		}
+	})
+
+	t.Run("ExtractTables splits cells on word gaps", func(t *testing.T) {
+		engine := NewFakeOCREngine()
+		engine.SetPages("pl.png", OCRPage{Number: 1, Words: []OCRWord{
+			{Text: "Net", Left: 0, Top: 10, Width: 30, Height: 12},
+			{Text: "Revenue", Left: 35, Top: 10, Width: 60, Height: 12},
+			{Text: "25,000", Left: 300, Top: 11, Width: 50, Height: 12},
+			{Text: "EBITDA", Left: 0, Top: 40, Width: 50, Height: 12},
+			{Text: "8,500", Left: 305, Top: 40, Width: 45, Height: 12},
+			{Text: "Footnote", Left: 0, Top: 80, Width: 60, Height: 12},
+		}})
+		ocr := NewOCRServiceWithEngine(engine)
+
+		table, err := ocr.ExtractTables("pl.png")
+		if err != nil {
+			t.Fatalf("ExtractTables failed: %v", err)
+		}
+		if len(table) != 2 {
+			t.Fatalf("Expected 2 table rows, got %v", table)
+		}
+		if table[0][0] != "Net Revenue" || table[0][1] != "25,000" {
+			t.Errorf("Unexpected first row: %v", table[0])
+		}
+		if table[1][0] != "EBITDA" || table[1][1] != "8,500" {
+			t.Errorf("Unexpected second row: %v", table[1])
+		}
+	})
+
+	t.Run("unavailable engine disables service", func(t *testing.T) {
+		ocr := NewOCRServiceWithEngine(NewTesseractEngine("/nonexistent/tesseract"))
+
+		if ocr.IsEnabled() {
+			t.Error("Expected service to report disabled when engine binary is missing")
+		}
+		if _, err := ocr.ProcessImage("scan.png"); err == nil {
+			t.Error("Expected error when engine binary is missing")
+		}
+	})
+}
+
+func TestParseTesseractTSV(t *testing.T) {
+	output := "level\tpage_num\tblock_num\tpar_num\tline_num\tword_num\tleft\ttop\twidth\theight\tconf\ttext\n" +
+		"1\t1\t0\t0\t0\t0\t0\t0\t2480\t3508\t-1\t\n" +
+		"5\t1\t1\t1\t1\t1\t100\t100\t80\t30\t96.5\tPurchase\n" +
+		"5\t1\t1\t1\t1\t2\t190\t100\t90\t30\t91.5\tAgreement\n" +
+		"5\t1\t1\t1\t2\t1\t100\t140\t60\t30\t88\tDated\n" +
+		"1\t2\t0\t0\t0\t0\t0\t0\t2480\t3508\t-1\t\n" +
+		"5\t2\t1\t1\t1\t1\t100\t100\t80\t30\t70\tSignature\n"
+
+	pages, err := parseTesseractTSV([]byte(output))
+	if err != nil {
+		t.Fatalf("parseTesseractTSV failed: %v", err)
+	}
+	if len(pages) != 2 {
+		t.Fatalf("Expected 2 pages, got %d", len(pages))
+	}
+	if pages[0].Text != "Purchase Agreement\nDated" {
+		t.Errorf("Unexpected page 1 text: %q", pages[0].Text)
+	}
+	if pages[0].Confidence < 0.919 || pages[0].Confidence > 0.921 {
+		t.Errorf("Expected page 1 confidence 0.92, got %f", pages[0].Confidence)
+	}
+	if pages[1].Number != 2 || pages[1].Text != "Signature" {
+		t.Errorf("Unexpected page 2: %+v", pages[1])
+	}
+
+	if _, err := parseTesseractTSV([]byte("garbage")); err == nil {
+		t.Error("Expected error for output without TSV header")
+	}
+
+	rotation, err := parseTesseractOrientation([]byte("Page number: 0\nOrientation in degrees: 270\nRotate: 90\n"))
+	if err != nil || rotation != 90 {
+		t.Errorf("Expected rotation 90, got %d (err %v)", rotation, err)
+	}
+}
+
+// writeScannedTestPDF builds a PDF with one image XObject per page from the
+// given image dictionaries and stream bodies
+func writeScannedTestPDF(t *testing.T, path string, images []string, streams [][]byte) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+	kids := make([]string, len(images))
+	for i := range images {
+		kids[i] = fmt.Sprintf("%d 0 R", 3+i*2)
+	}
+	buf.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	buf.WriteString(fmt.Sprintf("2 0 obj\n<< /Type /Pages /Kids [%s] /Count %d >>\nendobj\n", strings.Join(kids, " "), len(images)))
+	for i, dict := range images {
+		pageNum := 3 + i*2
+		buf.WriteString(fmt.Sprintf("%d 0 obj\n<< /Type /Page /Parent 2 0 R /Resources << /XObject << /Im0 %d 0 R >> >> >>\nendobj\n", pageNum, pageNum+1))
+		buf.WriteString(fmt.Sprintf("%d 0 obj\n<< /Type /XObject /Subtype /Image %s /Length %d >>\nstream\n", pageNum+1, dict, len(streams[i])))
+		buf.Write(streams[i])
+		buf.WriteString("\nendstream\nendobj\n")
+	}
+	buf.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write PDF: %v", err)
+	}
+}
+
+func deflate(data []byte) []byte {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write(data)
+	zw.Close()
+	return buf.Bytes()
+}
+
+func TestExtractPDFPageImages(t *testing.T) {
+	dir := t.TempDir()
+	pdfPath := filepath.Join(dir, "scan.pdf")
+	fax := []byte{0x26, 0xa0, 0x11, 0x80, 0x08, 0x00, 0x80}
+	writeScannedTestPDF(t, pdfPath, []string{
+		// 4x2 grayscale with PNG Sub and Up row filters
+		"/Width 4 /Height 2 /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /FlateDecode /DecodeParms << /Predictor 15 /Colors 1 /Columns 4 >>",
+		"/Width 4 /Height 1 /ColorSpace /DeviceGray /BitsPerComponent 8 /Filter /RunLengthDecode",
+		// 10x1 bilevel, black where bits are 0
+		"/Width 10 /Height 1 /ColorSpace /DeviceGray /BitsPerComponent 1 /Filter /FlateDecode",
+		"/Width 2 /Height 1 /ColorSpace /DeviceRGB /BitsPerComponent 8 /Filter /FlateDecode",
+		"/Width 16 /Height 2 /ColorSpace /DeviceGray /BitsPerComponent 1 /Filter /CCITTFaxDecode /DecodeParms << /K -1 /Columns 16 /Rows 2 /BlackIs1 false >>",
+	}, [][]byte{
+		deflate([]byte{1, 10, 10, 10, 10, 2, 5, 5, 5, 5}),
+		{0x03, 1, 2, 3, 4, 0x80},
+		deflate([]byte{0xf0, 0x40}),
+		deflate([]byte{255, 0, 0, 0, 0, 255}),
+		fax,
+	})
+
+	images, err := extractPDFPageImages(pdfPath, dir)
+	if err != nil {
+		t.Fatalf("extractPDFPageImages failed: %v", err)
+	}
+	if len(images) != 5 {
+		t.Fatalf("Expected an entry for each of 5 pages, got %+v", images)
+	}
+
+	readPGM := func(image pdfPageImage) string {
+		t.Helper()
+		if image.Path == "" {
+			t.Fatalf("Page %d was not written: %s", image.Page, image.Warning)
+		}
+		data, err := os.ReadFile(image.Path)
+		if err != nil {
+			t.Fatalf("Failed to read page image: %v", err)
+		}
+		return string(data)
+	}
+	if got := readPGM(images[0]); got != "P5\n4 2\n255\n"+string([]byte{10, 20, 30, 40, 15, 25, 35, 45}) {
+		t.Errorf("Unexpected grayscale page: %q", got)
+	}
+	if images[1].Page != 2 || images[1].Path != "" || !strings.Contains(images[1].Warning, "unsupported image encoding") {
+		t.Errorf("Expected page 2 to be skipped with a warning, got %+v", images[1])
+	}
+	if got := readPGM(images[2]); got != "P5\n10 1\n255\n"+string([]byte{255, 255, 255, 255, 0, 0, 0, 0, 0, 255}) {
+		t.Errorf("Unexpected bilevel page: %q", got)
+	}
+	if got := readPGM(images[3]); got != "P5\n2 1\n255\n"+string([]byte{76, 29}) {
+		t.Errorf("Unexpected RGB page: %q", got)
+	}
+
+	// Fax data is wrapped in a Group 4 TIFF for libtiff to decode
+	if images[4].Path == "" || filepath.Ext(images[4].Path) != ".tif" {
+		t.Fatalf("Expected a TIFF for the fax page, got %+v", images[4])
+	}
+	tiff, err := os.ReadFile(images[4].Path)
+	if err != nil {
+		t.Fatalf("Failed to read TIFF: %v", err)
+	}
+	tags := make(map[uint16]uint32)
+	count := int(binary.LittleEndian.Uint16(tiff[8:]))
+	for i := 0; i < count; i++ {
+		entry := tiff[10+i*12:]
+		value := binary.LittleEndian.Uint32(entry[8:])
+		if binary.LittleEndian.Uint16(entry[2:]) == 3 {
+			value = uint32(binary.LittleEndian.Uint16(entry[8:]))
+		}
+		tags[binary.LittleEndian.Uint16(entry)] = value
+	}
+	if string(tiff[:4]) != "II*\x00" || tags[256] != 16 || tags[257] != 2 || tags[259] != 4 || tags[262] != 0 {
+		t.Errorf("Unexpected TIFF header or tags: %v", tags)
+	}
+	if !bytes.Equal(tiff[tags[273]:tags[273]+tags[279]], fax) {
+		t.Errorf("Expected the fax data as the TIFF strip")
+	}
+}
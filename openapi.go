@@ -0,0 +1,370 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// apiV1Prefix is where the versioned webhook API is mounted
+const apiV1Prefix = "/api/v1"
+
+// apiV1Path returns the versioned path of a route first served at legacy
+func apiV1Path(legacy string) string {
+	return apiV1Prefix + "/" + strings.TrimPrefix(strings.TrimPrefix(legacy, "/webhook"), "/")
+}
+
+// SchemaRef binds a route's request or response body either to a schema
+// registered with the WebhookSchemaValidator or to a Go type
+type SchemaRef struct {
+	Name string
+	Type reflect.Type
+}
+
+// bodyType binds a body to the Go type T
+func bodyType[T any]() *SchemaRef {
+	return &SchemaRef{Type: reflect.TypeOf((*T)(nil)).Elem()}
+}
+
+// namedSchema binds a body to a WebhookSchemaValidator schema
+func namedSchema(name string) *SchemaRef {
+	return &SchemaRef{Name: name}
+}
+
+// OpenAPIDocument is an OpenAPI 3 description of the webhook API
+type OpenAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       OpenAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*OpenAPIOperation `json:"paths"`
+	Components OpenAPIComponents                       `json:"components"`
+}
+
+// OpenAPIInfo describes the API as a whole
+type OpenAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// OpenAPIOperation is one method on one path
+type OpenAPIOperation struct {
+	OperationID   string                      `json:"operationId"`
+	Summary       string                      `json:"summary,omitempty"`
+	Tags          []string                    `json:"tags,omitempty"`
+	Parameters    []OpenAPIParameter          `json:"parameters,omitempty"`
+	RequestBody   *OpenAPIRequestBody         `json:"requestBody,omitempty"`
+	Responses     map[string]*OpenAPIResponse `json:"responses"`
+	Security      []map[string][]string       `json:"security"`
+	RequiredScope string                      `json:"x-required-scope,omitempty"`
+	LegacyPath    string                      `json:"x-legacy-path,omitempty"`
+}
+
+// OpenAPIParameter is a query parameter
+type OpenAPIParameter struct {
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required,omitempty"`
+	Schema   *OpenAPISchema `json:"schema"`
+}
+
+// OpenAPIRequestBody is a JSON request body
+type OpenAPIRequestBody struct {
+	Required bool                        `json:"required"`
+	Content  map[string]OpenAPIMediaType `json:"content"`
+}
+
+// OpenAPIResponse is one response status of an operation
+type OpenAPIResponse struct {
+	Description string                      `json:"description"`
+	Content     map[string]OpenAPIMediaType `json:"content,omitempty"`
+}
+
+// OpenAPIMediaType holds the schema of a body
+type OpenAPIMediaType struct {
+	Schema *OpenAPISchema `json:"schema"`
+}
+
+// OpenAPIComponents holds the schemas operations refer to
+type OpenAPIComponents struct {
+	Schemas         map[string]*OpenAPISchema        `json:"schemas"`
+	SecuritySchemes map[string]OpenAPISecurityScheme `json:"securitySchemes"`
+}
+
+// OpenAPISecurityScheme describes how requests authenticate
+type OpenAPISecurityScheme struct {
+	Type        string `json:"type"`
+	In          string `json:"in"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// OpenAPISchema is the subset of the OpenAPI schema object the webhook API
+// uses
+type OpenAPISchema struct {
+	Ref                  string                    `json:"$ref,omitempty"`
+	Type                 string                    `json:"type,omitempty"`
+	Format               string                    `json:"format,omitempty"`
+	Title                string                    `json:"title,omitempty"`
+	Description          string                    `json:"description,omitempty"`
+	Properties           map[string]*OpenAPISchema `json:"properties,omitempty"`
+	Required             []string                  `json:"required,omitempty"`
+	Items                *OpenAPISchema            `json:"items,omitempty"`
+	AdditionalProperties interface{}               `json:"additionalProperties,omitempty"`
+	Enum                 []interface{}             `json:"enum,omitempty"`
+	Minimum              *float64                  `json:"minimum,omitempty"`
+	Maximum              *float64                  `json:"maximum,omitempty"`
+	MinLength            *int                      `json:"minLength,omitempty"`
+	MaxLength            *int                      `json:"maxLength,omitempty"`
+	Pattern              string                    `json:"pattern,omitempty"`
+	OneOf                []*OpenAPISchema          `json:"oneOf,omitempty"`
+	AnyOf                []*OpenAPISchema          `json:"anyOf,omitempty"`
+}
+
+// BuildOpenAPIDocument describes routes, resolving named bodies against
+// validator
+func BuildOpenAPIDocument(routes []WebhookRoute, validator *WebhookSchemaValidator) *OpenAPIDocument {
+	version := validator.GetAPIVersion()
+	gen := &schemaGenerator{validator: validator, schemas: make(map[string]*OpenAPISchema)}
+	doc := &OpenAPIDocument{
+		OpenAPI: "3.0.3",
+		Info: OpenAPIInfo{
+			Title:       "DealDone Webhook API",
+			Version:     fmt.Sprintf("%d.%d.%d", version.Major, version.Minor, version.Patch),
+			Description: "Routes are served under " + apiV1Prefix + "; each is also reachable at its x-legacy-path, which is deprecated.",
+		},
+		Paths: make(map[string]map[string]*OpenAPIOperation),
+		Components: OpenAPIComponents{
+			Schemas: gen.schemas,
+			SecuritySchemes: map[string]OpenAPISecurityScheme{
+				"apiKey": {
+					Type:        "apiKey",
+					In:          "header",
+					Name:        "X-API-Key",
+					Description: "Requests may also be signed with X-Signature, an HMAC-SHA256 of method|path|timestamp|body, and X-Timestamp",
+				},
+			},
+		},
+	}
+
+	for _, route := range routes {
+		operations := make(map[string]*OpenAPIOperation)
+		for _, method := range route.Methods {
+			operations[strings.ToLower(method)] = gen.operation(route, method, len(route.Methods) > 1)
+		}
+		doc.Paths[route.Path] = operations
+	}
+	return doc
+}
+
+func (g *schemaGenerator) operation(route WebhookRoute, method string, qualify bool) *OpenAPIOperation {
+	op := &OpenAPIOperation{
+		OperationID: operationID(route.Path, method, qualify),
+		Summary:     route.Summary,
+		Parameters:  []OpenAPIParameter{},
+		Responses: map[string]*OpenAPIResponse{
+			"200": {Description: "Success"},
+			"400": {Description: "Invalid request"},
+			"405": {Description: "Method not allowed"},
+		},
+		Security:   []map[string][]string{},
+		LegacyPath: route.Legacy,
+	}
+
+	if route.Policy.Public {
+		op.Tags = []string{"system"}
+	} else {
+		scope := route.Policy.RequiredScope(method)
+		op.RequiredScope = scope
+		op.Tags = []string{scope[strings.Index(scope, ":")+1:]}
+		op.Security = append(op.Security, map[string][]string{"apiKey": {}})
+		op.Responses["401"] = &OpenAPIResponse{Description: "Missing or invalid API key"}
+		op.Responses["403"] = &OpenAPIResponse{Description: "API key lacks " + scope + ", is restricted to other deals or is not allowed from this address"}
+		op.Responses["429"] = &OpenAPIResponse{Description: "Rate limit for the key's tier exceeded"}
+	}
+
+	for _, param := range route.Query {
+		op.Parameters = append(op.Parameters, OpenAPIParameter{
+			Name:     param.Name,
+			In:       "query",
+			Required: param.Required,
+			Schema:   &OpenAPISchema{Type: "string"},
+		})
+	}
+
+	if route.Request != nil && method != http.MethodGet && method != http.MethodDelete {
+		op.RequestBody = &OpenAPIRequestBody{
+			Required: true,
+			Content:  map[string]OpenAPIMediaType{"application/json": {Schema: g.ref(route.Request)}},
+		}
+	}
+	response := &OpenAPISchema{Type: "object"}
+	if route.Response != nil {
+		response = g.ref(route.Response)
+	}
+	op.Responses["200"].Content = map[string]OpenAPIMediaType{"application/json": {Schema: response}}
+	return op
+}
+
+// operationID derives a camel-case operation name from a versioned path
+func operationID(path, method string, qualify bool) string {
+	words := strings.FieldsFunc(strings.TrimPrefix(path, apiV1Prefix), func(r rune) bool {
+		return r == '/' || r == '-' || r == '.'
+	})
+	if qualify {
+		words = append([]string{strings.ToLower(method)}, words...)
+	}
+	for i := 1; i < len(words); i++ {
+		words[i] = strings.ToUpper(words[i][:1]) + words[i][1:]
+	}
+	return strings.Join(words, "")
+}
+
+// schemaGenerator collects component schemas as operations refer to them
+type schemaGenerator struct {
+	validator *WebhookSchemaValidator
+	schemas   map[string]*OpenAPISchema
+}
+
+func (g *schemaGenerator) ref(body *SchemaRef) *OpenAPISchema {
+	if body.Type != nil {
+		return g.typeSchema(body.Type)
+	}
+	if _, ok := g.schemas[body.Name]; !ok {
+		schema, err := g.validator.GetSchema(body.Name)
+		if err != nil {
+			return &OpenAPISchema{Type: "object", Description: err.Error()}
+		}
+		g.schemas[body.Name] = fromJSONSchema(schema)
+	}
+	return &OpenAPISchema{Ref: "#/components/schemas/" + body.Name}
+}
+
+// typeSchema describes how encoding/json encodes t. Unlike the inline
+// schemas jsonSchemaForType builds for model output, named structs become
+// components so integrators' generated clients get named types.
+func (g *schemaGenerator) typeSchema(t reflect.Type) *OpenAPISchema {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch {
+	case t == timeType:
+		return &OpenAPISchema{Type: "string", Format: "date-time"}
+	case t.Kind() == reflect.Struct && t.Name() != "":
+		if _, ok := g.schemas[t.Name()]; !ok {
+			g.schemas[t.Name()] = &OpenAPISchema{} // Placeholder for recursion
+			*g.schemas[t.Name()] = *g.structSchema(t)
+		}
+		return &OpenAPISchema{Ref: "#/components/schemas/" + t.Name()}
+	}
+
+	switch t.Kind() {
+	case reflect.Struct:
+		return g.structSchema(t)
+	case reflect.Bool:
+		return &OpenAPISchema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return &OpenAPISchema{Type: "integer"}
+	case reflect.Float32, reflect.Float64:
+		return &OpenAPISchema{Type: "number"}
+	case reflect.String:
+		return &OpenAPISchema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return &OpenAPISchema{Type: "string", Format: "byte"}
+		}
+		return &OpenAPISchema{Type: "array", Items: g.typeSchema(t.Elem())}
+	case reflect.Map:
+		if t.Elem().Kind() == reflect.Interface {
+			return &OpenAPISchema{Type: "object", AdditionalProperties: true}
+		}
+		return &OpenAPISchema{Type: "object", AdditionalProperties: g.typeSchema(t.Elem())}
+	default:
+		return &OpenAPISchema{} // Any value
+	}
+}
+
+func (g *schemaGenerator) structSchema(t reflect.Type) *OpenAPISchema {
+	schema := &OpenAPISchema{Type: "object", Properties: make(map[string]*OpenAPISchema)}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		if field.Anonymous && name == "" {
+			embedded := g.structSchema(field.Type)
+			for key, prop := range embedded.Properties {
+				schema.Properties[key] = prop
+			}
+			schema.Required = append(schema.Required, embedded.Required...)
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		schema.Properties[name] = g.typeSchema(field.Type)
+		if strings.Contains(field.Tag.Get("validate"), "required") {
+			schema.Required = append(schema.Required, name)
+		}
+	}
+	sort.Strings(schema.Required)
+	return schema
+}
+
+// fromJSONSchema converts a validator schema to its OpenAPI form
+func fromJSONSchema(schema *JSONSchema) *OpenAPISchema {
+	converted := &OpenAPISchema{
+		Type:                 schema.Type,
+		Title:                schema.Title,
+		Description:          schema.Description,
+		Properties:           make(map[string]*OpenAPISchema),
+		Required:             schema.Required,
+		AdditionalProperties: schema.AdditionalProperties,
+	}
+	for name, prop := range schema.Properties {
+		converted.Properties[name] = fromProperty(prop)
+	}
+	return converted
+}
+
+func fromProperty(prop *Property) *OpenAPISchema {
+	if prop == nil {
+		return nil
+	}
+	converted := &OpenAPISchema{
+		Type:        prop.Type,
+		Format:      prop.Format,
+		Description: prop.Description,
+		Enum:        prop.Enum,
+		Minimum:     prop.Minimum,
+		Maximum:     prop.Maximum,
+		MinLength:   prop.MinLength,
+		MaxLength:   prop.MaxLength,
+		Pattern:     prop.Pattern,
+		Items:       fromProperty(prop.Items),
+	}
+	if converted.Type == "array" {
+		// The validator reuses string lengths for array sizes
+		converted.MinLength, converted.MaxLength = nil, nil
+	}
+	if len(prop.Properties) > 0 {
+		converted.Properties = make(map[string]*OpenAPISchema)
+		for name, child := range prop.Properties {
+			converted.Properties[name] = fromProperty(child)
+		}
+	}
+	for _, option := range prop.OneOf {
+		converted.OneOf = append(converted.OneOf, fromProperty(option))
+	}
+	for _, option := range prop.AnyOf {
+		converted.AnyOf = append(converted.AnyOf, fromProperty(option))
+	}
+	return converted
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAPIV1Path(t *testing.T) {
+	assert.Equal(t, "/api/v1/results", apiV1Path("/webhook/results"))
+	assert.Equal(t, "/api/v1/n8n/enhanced/analyze-document", apiV1Path("/webhook/n8n/enhanced/analyze-document"))
+	assert.Equal(t, "/api/v1/populate-template", apiV1Path("/populate-template"))
+}
+
+func TestOpenAPISpec_ServedWithoutKey(t *testing.T) {
+	app, _ := newPolicyTestApp(t, nil)
+	app.schemaValidator = NewWebhookSchemaValidator()
+	server := app.createAuthenticatedWebhookServer(&WebhookServerConfig{Port: 0})
+
+	w := httptest.NewRecorder()
+	server.Handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/v1/openapi.json", nil))
+	require.Equal(t, http.StatusOK, w.Code)
+
+	var doc OpenAPIDocument
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &doc))
+	assert.Equal(t, "3.0.3", doc.OpenAPI)
+	assert.Len(t, doc.Paths, len(app.webhookHandlers.Routes()))
+
+	// Bodies bound to validator schemas and to Go types both resolve
+	results := doc.Paths["/api/v1/results"]["post"]
+	require.NotNil(t, results)
+	assert.Equal(t, "#/components/schemas/webhook-result-payload", results.RequestBody.Content["application/json"].Schema.Ref)
+	assert.Equal(t, "/webhook/results", results.LegacyPath)
+	assert.Equal(t, ScopeWriteJobs, results.RequiredScope)
+	assert.Contains(t, doc.Components.Schemas["webhook-result-payload"].Required, "jobId")
+
+	rules := doc.Components.Schemas["UpdateValidationRulesRequest"]
+	require.NotNil(t, rules)
+	assert.Equal(t, []string{"dealName", "ruleCategory", "rules"}, rules.Required)
+	assert.Equal(t, "array", rules.Properties["rules"].Type)
+
+	budgets := doc.Paths["/api/v1/ai-budgets"]
+	assert.Equal(t, ScopeReadAnalytics, budgets["get"].RequiredScope)
+	assert.Equal(t, ScopeAdminConfig, budgets["post"].RequiredScope)
+	assert.Equal(t, "#/components/schemas/DealBudget", doc.Components.Schemas["SetDealBudgetRequest"].Properties["budget"].Ref)
+
+	status := doc.Paths["/api/v1/status"]["get"]
+	require.Len(t, status.Parameters, 2)
+	assert.True(t, status.Parameters[0].Required)
+	assert.Empty(t, doc.Paths["/api/v1/health"]["get"].Security)
+}
+
+func TestLegacyAliases(t *testing.T) {
+	app, _ := newPolicyTestApp(t, nil)
+	key := generateTestKey(t, app, &KeyGenerationRequest{Permissions: []string{ScopeReadAnalytics}})
+	server := app.createAuthenticatedWebhookServer(&WebhookServerConfig{Port: 0})
+
+	call := func(method, path, key string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("X-API-Key", key)
+		w := httptest.NewRecorder()
+		server.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	// The alias reaches the same authenticated handler and points at its successor
+	w := call(http.MethodPost, "/webhook/ai-usage", key)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Equal(t, "true", w.Header().Get("Deprecation"))
+	assert.Equal(t, `</api/v1/ai-usage>; rel="successor-version"`, w.Header().Get("Link"))
+
+	w = call(http.MethodPost, "/api/v1/ai-usage", key)
+	assert.Equal(t, http.StatusMethodNotAllowed, w.Code)
+	assert.Empty(t, w.Header().Get("Deprecation"))
+
+	assert.Equal(t, http.StatusUnauthorized, call(http.MethodGet, "/api/v1/ai-usage", "").Code)
+	assert.Equal(t, http.StatusForbidden, call(http.MethodPost, "/webhook/update-validation-rules", key).Code)
+}
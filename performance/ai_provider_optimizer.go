@@ -2,12 +2,12 @@ package performance
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"sync"
 	"time"
+
+	"DealDone/cache"
 )
 
 // AIProviderOptimizer optimizes AI provider usage through caching and optimization
@@ -21,27 +21,11 @@ type AIProviderOptimizer struct {
 	mu                sync.RWMutex
 }
 
-// AIResponseCache implements intelligent caching for AI responses
+// AIResponseCache implements intelligent caching for AI responses on top of
+// a shared cache store
 type AIResponseCache struct {
-	entries    map[string]*CacheEntry
-	ttlIndex   map[time.Time][]string
-	maxSize    int
+	store      cache.Store
 	defaultTTL time.Duration
-	hitCount   int64
-	missCount  int64
-	mu         sync.RWMutex
-}
-
-// CacheEntry represents a cached AI response
-type CacheEntry struct {
-	Key         string                 `json:"key"`
-	Response    interface{}            `json:"response"`
-	Confidence  float64                `json:"confidence"`
-	CreatedAt   time.Time              `json:"createdAt"`
-	ExpiresAt   time.Time              `json:"expiresAt"`
-	AccessCount int                    `json:"accessCount"`
-	LastAccess  time.Time              `json:"lastAccess"`
-	Metadata    map[string]interface{} `json:"metadata"`
 }
 
 // CallDeduplicator prevents redundant AI calls
@@ -187,6 +171,7 @@ type AIOptimizerConfig struct {
 	EnableParallelProcessing bool               `json:"enableParallelProcessing"`
 	TokenLimits              map[string]int     `json:"tokenLimits"`
 	CostLimits               map[string]float64 `json:"costLimits"`
+	CacheStore               cache.Store        `json:"-"` // Optional; defaults to an in-memory store
 }
 
 // NewAIProviderOptimizer creates a new AI provider optimizer
@@ -206,8 +191,13 @@ func NewAIProviderOptimizer(config *AIOptimizerConfig) *AIProviderOptimizer {
 		}
 	}
 
+	responseCache := NewAIResponseCache(config.CacheMaxSize, config.CacheDefaultTTL)
+	if config.CacheStore != nil {
+		responseCache = NewAIResponseCacheWithStore(config.CacheStore, config.CacheDefaultTTL)
+	}
+
 	return &AIProviderOptimizer{
-		cache:             NewAIResponseCache(config.CacheMaxSize, config.CacheDefaultTTL),
+		cache:             responseCache,
 		callDeduplicator:  NewCallDeduplicator(config.SimilarityThreshold),
 		promptOptimizer:   NewPromptOptimizer(),
 		parallelProcessor: NewParallelProcessor(config.MaxConcurrency),
@@ -216,19 +206,17 @@ func NewAIProviderOptimizer(config *AIOptimizerConfig) *AIProviderOptimizer {
 	}
 }
 
-// NewAIResponseCache creates a new AI response cache
+// NewAIResponseCache creates a new in-memory AI response cache
 func NewAIResponseCache(maxSize int, defaultTTL time.Duration) *AIResponseCache {
-	cache := &AIResponseCache{
-		entries:    make(map[string]*CacheEntry),
-		ttlIndex:   make(map[time.Time][]string),
-		maxSize:    maxSize,
+	return NewAIResponseCacheWithStore(cache.NewMemoryStore(maxSize, 0), defaultTTL)
+}
+
+// NewAIResponseCacheWithStore creates an AI response cache backed by store
+func NewAIResponseCacheWithStore(store cache.Store, defaultTTL time.Duration) *AIResponseCache {
+	return &AIResponseCache{
+		store:      store,
 		defaultTTL: defaultTTL,
 	}
-
-	// Start cleanup goroutine
-	go cache.cleanupExpiredEntries()
-
-	return cache
 }
 
 // NewCallDeduplicator creates a new call deduplicator
@@ -400,16 +388,11 @@ func (apo *AIProviderOptimizer) executeAICall(ctx context.Context, requestType,
 
 // generateCacheKey generates a cache key for the request
 func (apo *AIProviderOptimizer) generateCacheKey(requestType, content string, parameters map[string]interface{}) string {
-	hasher := sha256.New()
-	hasher.Write([]byte(requestType))
-	hasher.Write([]byte(content))
-
-	if parameters != nil {
-		paramBytes, _ := json.Marshal(parameters)
-		hasher.Write(paramBytes)
-	}
-
-	return hex.EncodeToString(hasher.Sum(nil))
+	return cache.Key(cache.KeyParts{
+		Operation: requestType,
+		Content:   content,
+		Params:    parameters,
+	})
 }
 
 // updateMetrics updates optimization metrics
@@ -431,103 +414,36 @@ func (apo *AIProviderOptimizer) updateMetrics(duration time.Duration) {
 
 // Cache methods
 
-// Get retrieves a value from the cache
-func (cache *AIResponseCache) Get(key string) (interface{}, bool) {
-	cache.mu.RLock()
-	defer cache.mu.RUnlock()
-
-	entry, exists := cache.entries[key]
-	if !exists {
-		cache.missCount++
+// Get retrieves a value from the cache. Values are returned as decoded JSON.
+func (rc *AIResponseCache) Get(key string) (interface{}, bool) {
+	data, ok := rc.store.Get(key)
+	if !ok {
 		return nil, false
 	}
 
-	// Check if expired
-	if time.Now().After(entry.ExpiresAt) {
-		cache.mu.RUnlock()
-		cache.mu.Lock()
-		delete(cache.entries, key)
-		cache.mu.Unlock()
-		cache.mu.RLock()
-		cache.missCount++
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		rc.store.Delete(key)
 		return nil, false
 	}
-
-	// Update access information
-	entry.AccessCount++
-	entry.LastAccess = time.Now()
-	cache.hitCount++
-
-	return entry.Response, true
-}
-
-// Set stores a value in the cache
-func (cache *AIResponseCache) Set(key string, value interface{}, ttl time.Duration) {
-	cache.mu.Lock()
-	defer cache.mu.Unlock()
-
-	// Check cache size and evict if necessary
-	if len(cache.entries) >= cache.maxSize {
-		cache.evictLRU()
-	}
-
-	expiresAt := time.Now().Add(ttl)
-	entry := &CacheEntry{
-		Key:         key,
-		Response:    value,
-		Confidence:  1.0, // Default confidence
-		CreatedAt:   time.Now(),
-		ExpiresAt:   expiresAt,
-		AccessCount: 0,
-		LastAccess:  time.Now(),
-		Metadata:    make(map[string]interface{}),
-	}
-
-	cache.entries[key] = entry
-
-	// Add to TTL index
-	if _, exists := cache.ttlIndex[expiresAt]; !exists {
-		cache.ttlIndex[expiresAt] = make([]string, 0)
-	}
-	cache.ttlIndex[expiresAt] = append(cache.ttlIndex[expiresAt], key)
+	return value, true
 }
 
-// evictLRU evicts the least recently used entry
-func (cache *AIResponseCache) evictLRU() {
-	var oldestKey string
-	var oldestTime time.Time
-
-	for key, entry := range cache.entries {
-		if oldestKey == "" || entry.LastAccess.Before(oldestTime) {
-			oldestKey = key
-			oldestTime = entry.LastAccess
-		}
+// Set stores a value in the cache, using the default TTL when ttl is zero
+func (rc *AIResponseCache) Set(key string, value interface{}, ttl time.Duration) {
+	if ttl == 0 {
+		ttl = rc.defaultTTL
 	}
-
-	if oldestKey != "" {
-		delete(cache.entries, oldestKey)
+	data, err := json.Marshal(value)
+	if err != nil {
+		return
 	}
+	rc.store.Set(key, data, ttl)
 }
 
-// cleanupExpiredEntries periodically removes expired entries
-func (cache *AIResponseCache) cleanupExpiredEntries() {
-	ticker := time.NewTicker(5 * time.Minute)
-	defer ticker.Stop()
-
-	for range ticker.C {
-		cache.mu.Lock()
-		now := time.Now()
-
-		for expireTime, keys := range cache.ttlIndex {
-			if now.After(expireTime) {
-				for _, key := range keys {
-					delete(cache.entries, key)
-				}
-				delete(cache.ttlIndex, expireTime)
-			}
-		}
-		cache.mu.Unlock()
-	}
+// Stats returns the statistics of the underlying store
+func (rc *AIResponseCache) Stats() cache.Stats {
+	return rc.store.Stats()
 }
 
 // Deduplicator methods
@@ -842,21 +758,17 @@ func (apo *AIProviderOptimizer) calculateTokenSavings() int64 {
 
 // GetCacheStats returns cache statistics
 func (apo *AIProviderOptimizer) GetCacheStats() map[string]interface{} {
-	apo.cache.mu.RLock()
-	defer apo.cache.mu.RUnlock()
-
-	total := apo.cache.hitCount + apo.cache.missCount
-	hitRate := 0.0
-	if total > 0 {
-		hitRate = float64(apo.cache.hitCount) / float64(total)
-	}
+	stats := apo.cache.Stats()
 
 	return map[string]interface{}{
-		"hitCount":     apo.cache.hitCount,
-		"missCount":    apo.cache.missCount,
-		"hitRate":      hitRate,
-		"entriesCount": len(apo.cache.entries),
-		"maxSize":      apo.cache.maxSize,
+		"hitCount":     stats.Hits,
+		"missCount":    stats.Misses,
+		"hitRate":      stats.HitRate,
+		"entriesCount": stats.Entries,
+		"maxSize":      stats.MaxEntries,
+		"sizeBytes":    stats.SizeBytes,
+		"evictions":    stats.Evictions,
+		"backend":      stats.Backend,
 	}
 }
 
@@ -2,37 +2,104 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
 	"path/filepath"
+	"sort"
 	"sync"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+const (
+	maxSyncErrors         = 20
+	queueStateVersion     = "1"
+	queuePollInterval     = time.Second    // How often retry and dependency waits are re-checked
+	completedItemLifetime = 24 * time.Hour // Completed items stay queryable this long
+)
+
+// QueueProcessor runs one processing stage for a queue item. It receives a
+// copy of the item; results of earlier stages are in
+// item.Metadata["stageResults"] keyed by stage name.
+type QueueProcessor func(ctx context.Context, item QueueItem) (map[string]interface{}, error)
+
+type queueStage struct {
+	name      string
+	processor QueueProcessor
+}
+
+// nonRetryableError marks a processing failure that a retry cannot fix
+type nonRetryableError struct {
+	err error
+}
+
+func (e *nonRetryableError) Error() string { return e.err.Error() }
+func (e *nonRetryableError) Unwrap() error { return e.err }
+
+// NonRetryable wraps err so the queue fails the item instead of retrying it
+func NonRetryable(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &nonRetryableError{err: err}
+}
+
 // QueueManager handles document processing queue with persistence and state tracking
 type QueueManager struct {
 	queue             []*QueueItem
 	dealFolders       map[string]*DealFolderMirror
 	processingHistory map[string]*ProcessingHistory
 	config            QueueConfiguration
+	stages            []queueStage
 	mutex             sync.RWMutex
 	folderMutex       sync.RWMutex
 	historyMutex      sync.RWMutex
+	persistMutex      sync.Mutex
 	processingCount   int
-	persistenceFile   string
+	running           map[string]queueRun
+	repo              QueueRepository
 	ctx               context.Context
 	cancel            context.CancelFunc
 	isRunning         bool
+	wake              chan struct{}
+	workers           sync.WaitGroup
+}
+
+// queueRun identifies the worker run of a processing item
+type queueRun struct {
+	started time.Time
+	cancel  context.CancelFunc
+}
+
+// QueueRepository persists the queue, folder mirrors and history
+type QueueRepository interface {
+	LoadQueueState() (*StateSnapshot, error)
+	SaveQueueState(snapshot *StateSnapshot) error
 }
 
-// NewQueueManager creates a new queue manager with default configuration
+// NewQueueManager creates a queue manager persisted in a state store in
+// dataDir, importing the queue_state.json written by earlier versions
 func NewQueueManager(dataDir string) *QueueManager {
+	repo := openComponentStore(dataDir)
+	if err := repo.importLegacyQueue(filepath.Join(dataDir, "queue_state.json")); err != nil {
+		fmt.Printf("Warning: Failed to import queue state: %v\n", err)
+	}
+	return NewQueueManagerWithRepository(repo)
+}
+
+// NewQueueManagerWithRepository creates a queue manager with default
+// configuration that persists through repo
+func NewQueueManagerWithRepository(repo QueueRepository) *QueueManager {
 	ctx, cancel := context.WithCancel(context.Background())
 
 	config := QueueConfiguration{
 		MaxConcurrentJobs:      3,
 		MaxRetryAttempts:       3,
+		InitialRetryBackoff:    30 * time.Second,
 		RetryBackoffMultiplier: 2.0,
 		MaxRetryBackoff:        30 * time.Minute,
 		QueueTimeout:           5 * time.Minute,
@@ -47,28 +114,79 @@ func NewQueueManager(dataDir string) *QueueManager {
 		queue:             make([]*QueueItem, 0),
 		dealFolders:       make(map[string]*DealFolderMirror),
 		processingHistory: make(map[string]*ProcessingHistory),
+		running:           make(map[string]queueRun),
 		config:            config,
-		persistenceFile:   filepath.Join(dataDir, "queue_state.json"),
+		repo:              repo,
 		ctx:               ctx,
 		cancel:            cancel,
+		wake:              make(chan struct{}, 1),
 	}
 
 	// Load persisted state
-	qm.loadPersistedState()
+	if err := qm.loadPersistedState(); err != nil {
+		fmt.Printf("Warning: Failed to load queue state: %v\n", err)
+	}
 
 	return qm
 }
 
+// RegisterProcessor appends a processing stage. Stages run in registration
+// order for every item; the queue only dispatches once a stage is registered.
+func (qm *QueueManager) RegisterProcessor(stage string, processor QueueProcessor) {
+	qm.mutex.Lock()
+	defer qm.mutex.Unlock()
+
+	for i, existing := range qm.stages {
+		if existing.name == stage {
+			qm.stages[i].processor = processor
+			return
+		}
+	}
+	qm.stages = append(qm.stages, queueStage{name: stage, processor: processor})
+	qm.notify()
+}
+
+// ErrDocumentAlreadyQueued is returned when a document is enqueued while it
+// is still waiting or being processed
+var ErrDocumentAlreadyQueued = errors.New("document already queued for processing")
+
 // Task 3.1: FIFO processing with job metadata tracking
 func (qm *QueueManager) EnqueueDocument(dealName, documentPath, documentName string, priority ProcessingPriority, metadata map[string]interface{}) (*QueueItem, error) {
+	return qm.EnqueueDependentDocument(dealName, documentPath, documentName, priority, metadata, nil)
+}
+
+// EnqueueDependentDocument queues a document that is only processed once the
+// queue items listed in dependencies have completed
+func (qm *QueueManager) EnqueueDependentDocument(dealName, documentPath, documentName string, priority ProcessingPriority, metadata map[string]interface{}, dependencies []string) (*QueueItem, error) {
+	item, err := qm.enqueue(dealName, documentPath, documentName, priority, metadata, dependencies)
+	if err != nil {
+		return nil, err
+	}
+
+	// Persist state (Task 3.3)
+	if err := qm.persistState(); err != nil {
+		fmt.Printf("Warning: Failed to persist queue state: %v\n", err)
+	}
+	qm.notify()
+
+	return item, nil
+}
+
+func (qm *QueueManager) enqueue(dealName, documentPath, documentName string, priority ProcessingPriority, metadata map[string]interface{}, dependencies []string) (*QueueItem, error) {
 	qm.mutex.Lock()
 	defer qm.mutex.Unlock()
 
 	// Check for duplicate processing (race condition prevention - Task 3.4)
 	for _, item := range qm.queue {
 		if item.DealName == dealName && item.DocumentPath == documentPath &&
-			(item.Status == QueueStatusPending || item.Status == QueueStatusProcessing) {
-			return nil, fmt.Errorf("document already queued for processing: %s", documentPath)
+			(item.Status == QueueStatusPending || item.Status == QueueStatusProcessing || item.Status == QueueStatusRetrying) {
+			return nil, fmt.Errorf("%w: %s", ErrDocumentAlreadyQueued, documentPath)
+		}
+	}
+
+	for _, dependency := range dependencies {
+		if qm.findItem(dependency) == nil {
+			return nil, fmt.Errorf("unknown dependency: %s", dependency)
 		}
 	}
 
@@ -82,6 +200,7 @@ func (qm *QueueManager) EnqueueDocument(dealName, documentPath, documentName str
 		QueuedAt:          time.Now(),
 		Status:            QueueStatusPending,
 		Metadata:          metadata,
+		Dependencies:      dependencies,
 		RetryCount:        0,
 		EstimatedDuration: qm.estimateProcessingDuration(documentName),
 	}
@@ -99,10 +218,7 @@ func (qm *QueueManager) EnqueueDocument(dealName, documentPath, documentName str
 	qm.queue = append(qm.queue[:insertIndex], append([]*QueueItem{item}, qm.queue[insertIndex:]...)...)
 
 	// Update deal folder mirror (Task 3.2)
-	qm.updateDealFolderMirror(dealName, documentPath)
-
-	// Persist state (Task 3.3)
-	go qm.persistState()
+	qm.updateDealFolderMirror(dealName, documentPath, item.ID)
 
 	return item, nil
 }
@@ -195,29 +311,519 @@ func (qm *QueueManager) estimateProcessingDuration(documentName string) time.Dur
 	}
 }
 
+// Start launches the dispatcher, which runs queued items through the
+// registered processors with at most MaxConcurrentJobs in flight
 func (qm *QueueManager) Start() error {
+	qm.mutex.Lock()
+	defer qm.mutex.Unlock()
+
 	if qm.isRunning {
 		return fmt.Errorf("queue manager already running")
 	}
+	if qm.ctx.Err() != nil {
+		qm.ctx, qm.cancel = context.WithCancel(context.Background())
+	}
 	qm.isRunning = true
+
+	qm.workers.Add(1)
+	go qm.run(qm.ctx)
 	return nil
 }
 
+// Stop cancels in-flight items, waits for the workers to return and
+// persists the queue. Interrupted items resume on the next start.
 func (qm *QueueManager) Stop() error {
+	qm.mutex.Lock()
 	if !qm.isRunning {
+		qm.mutex.Unlock()
 		return fmt.Errorf("queue manager not running")
 	}
 	qm.cancel()
 	qm.isRunning = false
+	qm.mutex.Unlock()
+
+	qm.workers.Wait()
 	return qm.persistState()
 }
 
+// notify wakes the dispatcher without blocking
+func (qm *QueueManager) notify() {
+	select {
+	case qm.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (qm *QueueManager) run(ctx context.Context) {
+	defer qm.workers.Done()
+
+	poll := time.NewTicker(queuePollInterval)
+	defer poll.Stop()
+	health := time.NewTicker(intervalOrDefault(qm.config.HealthCheckInterval, time.Minute))
+	defer health.Stop()
+	persist := time.NewTicker(intervalOrDefault(qm.config.PersistenceInterval, 5*time.Minute))
+	defer persist.Stop()
+	cleanup := time.NewTicker(intervalOrDefault(qm.config.CleanupInterval, time.Hour))
+	defer cleanup.Stop()
+
+	for {
+		qm.dispatch(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-qm.wake:
+		case <-poll.C:
+		case <-health.C:
+			qm.performHealthCheck()
+		case <-persist.C:
+			if err := qm.persistState(); err != nil {
+				fmt.Printf("Warning: Failed to persist queue state: %v\n", err)
+			}
+		case <-cleanup.C:
+			qm.cleanupCompletedItems()
+		}
+	}
+}
+
+func intervalOrDefault(interval, fallback time.Duration) time.Duration {
+	if interval <= 0 {
+		return fallback
+	}
+	return interval
+}
+
+// dispatch starts as many runnable items as there are free worker slots.
+// Items are taken in queue order, so priority and FIFO ordering hold. The
+// processing state is persisted before the workers start, so a crash never
+// leaves a running item recorded as pending.
+func (qm *QueueManager) dispatch(ctx context.Context) {
+	qm.mutex.Lock()
+
+	if len(qm.stages) == 0 || ctx.Err() != nil {
+		qm.mutex.Unlock()
+		return
+	}
+
+	maxJobs := qm.config.MaxConcurrentJobs
+	if maxJobs <= 0 {
+		maxJobs = 1
+	}
+
+	type launch struct {
+		item *QueueItem
+		work QueueItem
+	}
+
+	stages := append([]queueStage(nil), qm.stages...)
+	now := time.Now()
+	changed := false
+	var launches []launch
+	for _, item := range qm.queue {
+		if qm.processingCount >= maxJobs {
+			break
+		}
+		if !qm.isRunnable(item, now) {
+			continue
+		}
+
+		ready, failedDependency := qm.dependenciesReady(item)
+		if failedDependency != "" {
+			item.Status = QueueStatusBlocked
+			item.LastError = &QueueError{
+				ErrorType:  "dependency_failed",
+				Message:    fmt.Sprintf("dependency %s did not complete", failedDependency),
+				OccurredAt: now,
+			}
+			qm.setMirrorState(item, "blocked")
+			changed = true
+			continue
+		}
+		if !ready {
+			continue
+		}
+
+		started := now
+		item.Status = QueueStatusProcessing
+		item.ProcessingStarted = &started
+		item.ProcessingEnded = nil
+		item.NextAttemptAt = nil
+		qm.processingCount++
+		qm.setMirrorState(item, "processing")
+		changed = true
+
+		qm.workers.Add(1)
+		launches = append(launches, launch{item: item, work: cloneQueueItem(item)})
+	}
+
+	qm.mutex.Unlock()
+
+	if changed {
+		if err := qm.persistState(); err != nil {
+			fmt.Printf("Warning: Failed to persist queue state: %v\n", err)
+		}
+	}
+
+	for _, l := range launches {
+		go qm.process(ctx, l.item, l.work, stages, now)
+	}
+}
+
+func (qm *QueueManager) isRunnable(item *QueueItem, now time.Time) bool {
+	switch item.Status {
+	case QueueStatusPending:
+		return true
+	case QueueStatusRetrying:
+		return item.NextAttemptAt == nil || !item.NextAttemptAt.After(now)
+	default:
+		return false
+	}
+}
+
+// dependenciesReady reports whether every dependency has completed, or the
+// ID of a dependency that never will. Dependencies no longer in the queue
+// completed and were cleaned up.
+func (qm *QueueManager) dependenciesReady(item *QueueItem) (bool, string) {
+	ready := true
+	for _, id := range item.Dependencies {
+		dependency := qm.findItem(id)
+		if dependency == nil {
+			continue
+		}
+		switch dependency.Status {
+		case QueueStatusCompleted:
+		case QueueStatusFailed, QueueStatusCanceled, QueueStatusBlocked:
+			return false, id
+		default:
+			ready = false
+		}
+	}
+	return ready, ""
+}
+
+// findItem returns the queue item with the given ID; callers hold qm.mutex
+func (qm *QueueManager) findItem(id string) *QueueItem {
+	for _, item := range qm.queue {
+		if item.ID == id {
+			return item
+		}
+	}
+	return nil
+}
+
+// process runs the stages for one item on a worker goroutine
+func (qm *QueueManager) process(ctx context.Context, item *QueueItem, work QueueItem, stages []queueStage, started time.Time) {
+	defer qm.workers.Done()
+
+	runCtx, cancel := context.WithTimeout(ctx, intervalOrDefault(qm.config.ProcessingTimeout, 30*time.Minute))
+	defer cancel()
+
+	// The health check cancels runs that outlive ProcessingTimeout
+	qm.mutex.Lock()
+	qm.running[item.ID] = queueRun{started: started, cancel: cancel}
+	qm.mutex.Unlock()
+
+	err := qm.runStages(runCtx, &work, stages)
+	if err != nil && runCtx.Err() != nil && ctx.Err() == nil {
+		err = fmt.Errorf("processing timed out after %s: %w", qm.config.ProcessingTimeout, context.DeadlineExceeded)
+	}
+	qm.finish(ctx, item, work, started, err)
+}
+
+// runStages runs each stage that has no result yet, so a retry resumes after
+// the last stage that succeeded
+func (qm *QueueManager) runStages(ctx context.Context, work *QueueItem, stages []queueStage) error {
+	results, _ := work.Metadata["stageResults"].(map[string]interface{})
+	if results == nil {
+		results = make(map[string]interface{})
+		work.Metadata["stageResults"] = results
+	}
+
+	for _, stage := range stages {
+		if _, done := results[stage.name]; done {
+			continue
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		result, err := runQueueProcessor(ctx, stage, *work)
+		if err != nil {
+			return fmt.Errorf("%s: %w", stage.name, err)
+		}
+		if result == nil {
+			result = map[string]interface{}{}
+		}
+		results[stage.name] = result
+	}
+	return nil
+}
+
+// runQueueProcessor turns a processor panic into a non-retryable error
+func runQueueProcessor(ctx context.Context, stage queueStage, item QueueItem) (result map[string]interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = NonRetryable(fmt.Errorf("processor panicked: %v", r))
+		}
+	}()
+	return stage.processor(ctx, item)
+}
+
+// finish records the outcome of a worker run and schedules any retry
+func (qm *QueueManager) finish(ctx context.Context, item *QueueItem, work QueueItem, started time.Time, err error) {
+	qm.mutex.Lock()
+	if run, ok := qm.running[item.ID]; ok && run.started.Equal(started) {
+		delete(qm.running, item.ID)
+	}
+
+	// The item may have been canceled or reset while this run was going
+	if item.Status != QueueStatusProcessing || item.ProcessingStarted == nil || !item.ProcessingStarted.Equal(started) {
+		qm.mutex.Unlock()
+		return
+	}
+
+	now := time.Now()
+	item.Metadata = work.Metadata
+	item.ProcessingEnded = &now
+	item.ActualDuration = now.Sub(started)
+	qm.processingCount--
+
+	var nonRetryable *nonRetryableError
+	switch {
+	case err == nil:
+		item.Status = QueueStatusCompleted
+		item.LastError = nil
+		qm.setMirrorState(item, "completed")
+
+	case ctx.Err() != nil:
+		// Shutdown interrupted the item; it resumes without using a retry
+		item.Status = QueueStatusRetrying
+		item.LastError = &QueueError{ErrorType: "interrupted", Message: err.Error(), OccurredAt: now, IsRetryable: true}
+		qm.setMirrorState(item, "queued")
+
+	case errors.As(err, &nonRetryable):
+		item.Status = QueueStatusFailed
+		item.LastError = &QueueError{ErrorType: "processing_error", Message: err.Error(), OccurredAt: now}
+		qm.setMirrorState(item, "failed")
+
+	default:
+		errorType := "processing_error"
+		if errors.Is(err, context.DeadlineExceeded) {
+			errorType = "timeout"
+		}
+		qm.scheduleRetry(item, &QueueError{ErrorType: errorType, Message: err.Error(), OccurredAt: now, IsRetryable: true}, now)
+	}
+
+	var history *ProcessingHistory
+	if item.Status == QueueStatusCompleted || item.Status == QueueStatusFailed {
+		history = queueItemHistory(item, started)
+	}
+	qm.mutex.Unlock()
+
+	if history != nil {
+		qm.historyMutex.Lock()
+		qm.processingHistory[history.ID] = history
+		qm.historyMutex.Unlock()
+	}
+
+	if err := qm.persistState(); err != nil {
+		fmt.Printf("Warning: Failed to persist queue state: %v\n", err)
+	}
+	qm.notify()
+}
+
+// scheduleRetry retries a failed item after its backoff, or fails it once it
+// has used MaxRetryAttempts. Callers hold qm.mutex.
+func (qm *QueueManager) scheduleRetry(item *QueueItem, lastError *QueueError, now time.Time) {
+	item.LastError = lastError
+	if item.RetryCount >= qm.config.MaxRetryAttempts {
+		item.Status = QueueStatusFailed
+		item.LastError.Details = fmt.Sprintf("gave up after %d retries", item.RetryCount)
+		qm.setMirrorState(item, "failed")
+		return
+	}
+	item.RetryCount++
+	next := now.Add(qm.retryBackoff(item.RetryCount))
+	item.Status = QueueStatusRetrying
+	item.NextAttemptAt = &next
+	qm.setMirrorState(item, "queued")
+}
+
+// retryBackoff returns the delay before the given retry, growing by
+// RetryBackoffMultiplier up to MaxRetryBackoff
+func (qm *QueueManager) retryBackoff(retry int) time.Duration {
+	backoff := float64(qm.config.InitialRetryBackoff)
+	multiplier := qm.config.RetryBackoffMultiplier
+	if multiplier < 1 {
+		multiplier = 1
+	}
+	for i := 1; i < retry; i++ {
+		backoff *= multiplier
+		if qm.config.MaxRetryBackoff > 0 && backoff >= float64(qm.config.MaxRetryBackoff) {
+			return qm.config.MaxRetryBackoff
+		}
+	}
+	if qm.config.MaxRetryBackoff > 0 && backoff > float64(qm.config.MaxRetryBackoff) {
+		return qm.config.MaxRetryBackoff
+	}
+	return time.Duration(backoff)
+}
+
+// queueItemHistory summarises a finished item. Stage results are merged so
+// fields such as templatesUsed are picked up whichever stage reported them.
+func queueItemHistory(item *QueueItem, started time.Time) *ProcessingHistory {
+	results := make(map[string]interface{})
+	if stageResults, ok := item.Metadata["stageResults"].(map[string]interface{}); ok {
+		for _, result := range stageResults {
+			if values, ok := result.(map[string]interface{}); ok {
+				for key, value := range values {
+					results[key] = value
+				}
+			}
+		}
+	}
+
+	history := newProcessingHistory(item.DealName, item.DocumentPath, "queue", results)
+	history.StartTime = started
+	history.EndTime = item.ProcessingEnded
+	history.Status = string(item.Status)
+	if item.LastError != nil {
+		history.ProcessingNotes = item.LastError.Message
+	}
+	return history
+}
+
+// cloneQueueItem copies an item for a worker so processors never share maps
+// with the queue
+func cloneQueueItem(item *QueueItem) QueueItem {
+	clone := *item
+	clone.Metadata = make(map[string]interface{}, len(item.Metadata)+1)
+	for key, value := range item.Metadata {
+		clone.Metadata[key] = value
+	}
+	if results, ok := item.Metadata["stageResults"].(map[string]interface{}); ok {
+		copied := make(map[string]interface{}, len(results))
+		for stage, result := range results {
+			copied[stage] = result
+		}
+		clone.Metadata["stageResults"] = copied
+	}
+	clone.Dependencies = append([]string(nil), item.Dependencies...)
+	return clone
+}
+
+// persistState commits the queue, folder mirrors and history to the state
+// store in one transaction, so a crash leaves either the previous or the
+// new state.
 func (qm *QueueManager) persistState() error {
-	return nil // Placeholder implementation
+	qm.persistMutex.Lock()
+	defer qm.persistMutex.Unlock()
+
+	data, err := qm.marshalState()
+	if err != nil {
+		return fmt.Errorf("failed to marshal queue state: %w", err)
+	}
+
+	// Decoding the copy taken under the locks gives the store a snapshot
+	// that shares nothing with the live queue
+	var snapshot StateSnapshot
+	if err := json.Unmarshal(data, &snapshot); err != nil {
+		return fmt.Errorf("failed to marshal queue state: %w", err)
+	}
+	return qm.repo.SaveQueueState(&snapshot)
+}
+
+func (qm *QueueManager) marshalState() ([]byte, error) {
+	qm.mutex.RLock()
+	defer qm.mutex.RUnlock()
+	qm.folderMutex.RLock()
+	defer qm.folderMutex.RUnlock()
+	qm.historyMutex.RLock()
+	defer qm.historyMutex.RUnlock()
+
+	snapshot := StateSnapshot{
+		Timestamp:         time.Now(),
+		QueueItems:        make([]QueueItem, 0, len(qm.queue)),
+		DealFolders:       make(map[string]DealFolderMirror, len(qm.dealFolders)),
+		ProcessingHistory: make([]ProcessingHistory, 0, len(qm.processingHistory)),
+		Configuration:     qm.config,
+		Version:           queueStateVersion,
+	}
+	for _, item := range qm.queue {
+		snapshot.QueueItems = append(snapshot.QueueItems, *item)
+	}
+	for name, mirror := range qm.dealFolders {
+		snapshot.DealFolders[name] = *mirror
+	}
+	for _, history := range qm.processingHistory {
+		snapshot.ProcessingHistory = append(snapshot.ProcessingHistory, *history)
+	}
+
+	// Marshal while the locks are held; items share metadata maps with the queue
+	return json.Marshal(snapshot)
 }
 
+// loadPersistedState restores the queue from the state store. Items that
+// were processing when the app stopped are recovered as retrying.
 func (qm *QueueManager) loadPersistedState() error {
-	return nil // Placeholder implementation
+	snapshot, err := qm.repo.LoadQueueState()
+	if err != nil || snapshot == nil {
+		return err
+	}
+
+	qm.mutex.Lock()
+	defer qm.mutex.Unlock()
+	qm.folderMutex.Lock()
+	defer qm.folderMutex.Unlock()
+	qm.historyMutex.Lock()
+	defer qm.historyMutex.Unlock()
+
+	now := time.Now()
+	qm.queue = make([]*QueueItem, 0, len(snapshot.QueueItems))
+	for i := range snapshot.QueueItems {
+		item := &snapshot.QueueItems[i]
+		if item.Metadata == nil {
+			item.Metadata = make(map[string]interface{})
+		}
+		if item.Status == QueueStatusProcessing {
+			qm.recoverInterrupted(item, now)
+		}
+		qm.queue = append(qm.queue, item)
+	}
+
+	for name, mirror := range snapshot.DealFolders {
+		mirror := mirror
+		if mirror.FileStructure == nil {
+			mirror.FileStructure = make(map[string]FileStructInfo)
+		}
+		qm.dealFolders[name] = &mirror
+	}
+	for i := range snapshot.ProcessingHistory {
+		history := &snapshot.ProcessingHistory[i]
+		qm.processingHistory[history.ID] = history
+	}
+
+	return nil
+}
+
+// recoverInterrupted requeues an item whose worker did not finish because
+// the app stopped. The interruption counts as a retry so a document that
+// crashes the app is eventually failed.
+func (qm *QueueManager) recoverInterrupted(item *QueueItem, now time.Time) {
+	item.LastError = &QueueError{
+		ErrorType:   "interrupted",
+		Message:     "processing was interrupted by a restart",
+		OccurredAt:  now,
+		IsRetryable: true,
+	}
+	if item.RetryCount >= qm.config.MaxRetryAttempts {
+		item.Status = QueueStatusFailed
+		item.LastError.IsRetryable = false
+		return
+	}
+	item.RetryCount++
+	item.Status = QueueStatusRetrying
+	item.NextAttemptAt = &now
 }
 
 // QueryQueue searches queue items based on criteria
@@ -255,18 +861,332 @@ func (qm *QueueManager) QueryQueue(query QueueQuery) ([]*QueueItem, error) {
 	return results[start:end], nil
 }
 
-// SyncDealFolder synchronizes a deal folder structure
+// SyncDealFolder reconciles a deal's folder mirror with the files on disk
+// without queueing anything
 func (qm *QueueManager) SyncDealFolder(dealName string) error {
-	return fmt.Errorf("sync deal folder not implemented yet")
+	scan, err := qm.scanDealFolder(dealName, 0)
+	if err != nil {
+		return err
+	}
+	qm.applyDealFolderScan(dealName, scan, nil, nil, nil)
+
+	if err := qm.persistState(); err != nil {
+		fmt.Printf("Warning: Failed to persist queue state: %v\n", err)
+	}
+	return nil
+}
+
+// TrackDealFolder sets the folder a deal's mirror reflects, creating the
+// mirror if needed
+func (qm *QueueManager) TrackDealFolder(dealName, folderPath string) {
+	qm.folderMutex.Lock()
+	defer qm.folderMutex.Unlock()
+
+	mirror, exists := qm.dealFolders[dealName]
+	if !exists {
+		mirror = &DealFolderMirror{
+			DealName:      dealName,
+			FileStructure: make(map[string]FileStructInfo),
+			SyncStatus:    SyncStatusOutOfSync,
+		}
+		qm.dealFolders[dealName] = mirror
+	}
+	mirror.FolderPath = folderPath
+}
+
+// GetDealFolderMirror returns a copy of a deal's folder mirror
+func (qm *QueueManager) GetDealFolderMirror(dealName string) (DealFolderMirror, bool) {
+	qm.folderMutex.RLock()
+	defer qm.folderMutex.RUnlock()
+
+	mirror, exists := qm.dealFolders[dealName]
+	if !exists {
+		return DealFolderMirror{}, false
+	}
+
+	copied := *mirror
+	copied.FileStructure = make(map[string]FileStructInfo, len(mirror.FileStructure))
+	for path, info := range mirror.FileStructure {
+		copied.FileStructure[path] = info
+	}
+	copied.ConflictFiles = append([]string(nil), mirror.ConflictFiles...)
+	copied.SyncErrors = append([]SyncError(nil), mirror.SyncErrors...)
+	return copied, true
+}
+
+// IngestDealFolder queues new and changed files in a deal folder. Copies of
+// content already in the deal are recorded but not queued. Files modified
+// within settle, and files changed while being processed, are left for a
+// later scan, which the second return value asks for; the latter are listed
+// in ConflictFiles until they can be queued again. Files that fail to queue
+// are left for the next scan too.
+func (qm *QueueManager) IngestDealFolder(dealName string, settle time.Duration) ([]*QueueItem, bool, error) {
+	scan, err := qm.scanDealFolder(dealName, settle)
+	if err != nil {
+		return nil, false, err
+	}
+
+	changed := make(map[string]bool, len(scan.changed))
+	for _, path := range scan.changed {
+		changed[path] = true
+	}
+	contents := make(map[string]bool)
+	for path, info := range scan.files {
+		if !changed[path] && info.Checksum != "" {
+			contents[info.Checksum] = true
+		}
+	}
+
+	var queued []*QueueItem
+	var conflicts, unqueued []string
+	states := make(map[string]string)
+	for _, path := range scan.changed {
+		checksum := scan.files[path].Checksum
+		if contents[checksum] {
+			states[path] = "duplicate"
+			continue
+		}
+		contents[checksum] = true
+
+		if qm.isProcessing(dealName, path) {
+			conflicts = append(conflicts, path)
+			continue
+		}
+
+		metadata := map[string]interface{}{"source": "folder_watcher", "checksum": checksum}
+		item, err := qm.EnqueueDocument(dealName, path, filepath.Base(path), PriorityNormal, metadata)
+		if errors.Is(err, ErrDocumentAlreadyQueued) {
+			// Still waiting in the queue, so it will pick up the new content
+			continue
+		}
+		if err != nil {
+			fmt.Printf("Warning: Failed to queue %s: %v\n", path, err)
+			qm.recordSyncError(dealName, path, "enqueue_failed", err)
+			unqueued = append(unqueued, path)
+			continue
+		}
+		queued = append(queued, item)
+	}
+
+	qm.applyDealFolderScan(dealName, scan, states, conflicts, unqueued)
+
+	if err := qm.persistState(); err != nil {
+		fmt.Printf("Warning: Failed to persist queue state: %v\n", err)
+	}
+	if len(queued) > 0 {
+		qm.notify()
+	}
+	return queued, scan.unsettled || len(conflicts) > 0 || len(unqueued) > 0, nil
+}
+
+// dealFolderScan is the result of walking a deal folder
+type dealFolderScan struct {
+	root      string
+	files     map[string]FileStructInfo // Settled files keyed by path
+	changed   []string                  // New or modified files in walk order
+	unsettled bool                      // Files still being written were skipped
+}
+
+// scanDealFolder walks a deal folder and hashes files that are new or whose
+// size or modification time changed since the last scan
+func (qm *QueueManager) scanDealFolder(dealName string, settle time.Duration) (*dealFolderScan, error) {
+	qm.folderMutex.RLock()
+	mirror, exists := qm.dealFolders[dealName]
+	var root string
+	known := make(map[string]FileStructInfo)
+	if exists {
+		root = mirror.FolderPath
+		for path, info := range mirror.FileStructure {
+			known[path] = info
+		}
+	}
+	qm.folderMutex.RUnlock()
+
+	if !exists || root == "" {
+		return nil, fmt.Errorf("deal folder not tracked: %s", dealName)
+	}
+
+	scan := &dealFolderScan{root: root, files: make(map[string]FileStructInfo)}
+	now := time.Now()
+	err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if path == root {
+				return err
+			}
+			return nil // Picked up again on the next scan
+		}
+		if d.IsDir() {
+			if path != root && skipDealDir(root, path) {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() || isIgnoredDealFile(d.Name()) {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return nil
+		}
+		previous, seen := known[path]
+
+		// Wait for writes to finish before hashing
+		if now.Sub(info.ModTime()) < settle {
+			scan.unsettled = true
+			if seen {
+				scan.files[path] = previous
+			}
+			return nil
+		}
+		if seen && previous.Checksum != "" && previous.Size == info.Size() && previous.ModifiedAt.Equal(info.ModTime()) {
+			scan.files[path] = previous
+			return nil
+		}
+
+		checksum, err := fileChecksum(path)
+		if err != nil {
+			scan.unsettled = true
+			if seen {
+				scan.files[path] = previous
+			}
+			return nil
+		}
+
+		entry := previous
+		if !seen {
+			entry = FileStructInfo{Path: path, ProcessingState: "detected"}
+		}
+		entry.Size = info.Size()
+		entry.ModifiedAt = info.ModTime()
+		entry.Checksum = checksum
+		scan.files[path] = entry
+
+		// Files queued before they were hashed only gain a checksum
+		if !seen || (previous.Checksum != "" && previous.Checksum != checksum) {
+			scan.changed = append(scan.changed, path)
+		}
+		return nil
+	})
+	if err != nil {
+		qm.recordSyncError(dealName, root, "scan_failed", err)
+		return nil, fmt.Errorf("failed to scan deal folder: %w", err)
+	}
+
+	return scan, nil
+}
+
+// applyDealFolderScan writes a scan into the deal's mirror. Queue states set
+// since the scan started are kept; conflicting files and files that could not
+// be queued keep their previous entry so the change is detected again.
+func (qm *QueueManager) applyDealFolderScan(dealName string, scan *dealFolderScan, states map[string]string, conflicts, unqueued []string) {
+	qm.folderMutex.Lock()
+	defer qm.folderMutex.Unlock()
+
+	mirror, exists := qm.dealFolders[dealName]
+	if !exists {
+		return
+	}
+
+	structure := make(map[string]FileStructInfo, len(scan.files))
+	for path, current := range mirror.FileStructure {
+		// Documents queued from outside the folder are not the scan's to remove
+		if !isWithinDir(scan.root, path) {
+			structure[path] = current
+		}
+	}
+	for path, entry := range scan.files {
+		if current, ok := mirror.FileStructure[path]; ok {
+			entry.ProcessingState = current.ProcessingState
+			entry.QueueItemID = current.QueueItemID
+		}
+		if state, ok := states[path]; ok {
+			entry.ProcessingState = state
+		}
+		structure[path] = entry
+	}
+	// Files that were not queued keep their previous entry, or none, so the
+	// next scan sees them as changed again
+	for _, paths := range [][]string{conflicts, unqueued} {
+		for _, path := range paths {
+			if current, ok := mirror.FileStructure[path]; ok {
+				structure[path] = current
+			} else {
+				delete(structure, path)
+			}
+		}
+	}
+
+	mirror.FileStructure = structure
+	mirror.FileCount = len(structure)
+	mirror.ProcessedFiles = 0
+	for _, info := range structure {
+		if info.ProcessingState == "completed" {
+			mirror.ProcessedFiles++
+		}
+	}
+	mirror.ConflictFiles = conflicts
+	mirror.LastSynced = time.Now()
+
+	refreshSyncStatus(mirror)
+	if len(conflicts) > 0 {
+		mirror.SyncStatus = SyncStatusConflict
+	}
+}
+
+func (qm *QueueManager) recordSyncError(dealName, path, errorType string, err error) {
+	qm.folderMutex.Lock()
+	defer qm.folderMutex.Unlock()
+
+	mirror, exists := qm.dealFolders[dealName]
+	if !exists {
+		return
+	}
+	mirror.SyncStatus = SyncStatusError
+	mirror.SyncErrors = append(mirror.SyncErrors, SyncError{
+		FilePath:   path,
+		ErrorType:  errorType,
+		Message:    err.Error(),
+		OccurredAt: time.Now(),
+	})
+	if len(mirror.SyncErrors) > maxSyncErrors {
+		mirror.SyncErrors = mirror.SyncErrors[len(mirror.SyncErrors)-maxSyncErrors:]
+	}
+}
+
+// isProcessing reports whether a worker currently has the document
+func (qm *QueueManager) isProcessing(dealName, documentPath string) bool {
+	qm.mutex.RLock()
+	defer qm.mutex.RUnlock()
+
+	for _, item := range qm.queue {
+		if item.DealName == dealName && item.DocumentPath == documentPath && item.Status == QueueStatusProcessing {
+			return true
+		}
+	}
+	return false
 }
 
 // SynchronizeWorkflowState updates queue item status based on workflow progress
 func (qm *QueueManager) SynchronizeWorkflowState(jobId, workflowStatus string) error {
+	if err := qm.synchronizeWorkflowState(jobId, workflowStatus); err != nil {
+		return err
+	}
+
+	if err := qm.persistState(); err != nil {
+		fmt.Printf("Warning: Failed to persist queue state: %v\n", err)
+	}
+	qm.notify()
+	return nil
+}
+
+func (qm *QueueManager) synchronizeWorkflowState(jobId, workflowStatus string) error {
 	qm.mutex.Lock()
 	defer qm.mutex.Unlock()
 
 	for _, item := range qm.queue {
 		if item.JobID == jobId {
+			wasProcessing := item.Status == QueueStatusProcessing
 			switch workflowStatus {
 			case "processing":
 				item.Status = QueueStatusProcessing
@@ -290,7 +1210,13 @@ func (qm *QueueManager) SynchronizeWorkflowState(jobId, workflowStatus string) e
 				item.Status = QueueStatusRetrying
 			}
 
-			go qm.persistState()
+			// Externally driven items hold a worker slot while processing
+			isProcessing := item.Status == QueueStatusProcessing
+			if isProcessing && !wasProcessing {
+				qm.processingCount++
+			} else if wasProcessing && !isProcessing && qm.processingCount > 0 {
+				qm.processingCount--
+			}
 			return nil
 		}
 	}
@@ -329,9 +1255,19 @@ func (qm *QueueManager) GetProcessingHistory(dealName string, limit int) []*Proc
 
 // RecordProcessingHistory adds a processing history entry
 func (qm *QueueManager) RecordProcessingHistory(dealName, documentPath, processingType string, results map[string]interface{}) {
+	historyItem := newProcessingHistory(dealName, documentPath, processingType, results)
+
 	qm.historyMutex.Lock()
-	defer qm.historyMutex.Unlock()
+	qm.processingHistory[historyItem.ID] = historyItem
+	qm.historyMutex.Unlock()
+
+	// Persist state
+	if err := qm.persistState(); err != nil {
+		fmt.Printf("Warning: Failed to persist queue state: %v\n", err)
+	}
+}
 
+func newProcessingHistory(dealName, documentPath, processingType string, results map[string]interface{}) *ProcessingHistory {
 	historyItem := &ProcessingHistory{
 		ID:              uuid.New().String(),
 		DealName:        dealName,
@@ -367,10 +1303,7 @@ func (qm *QueueManager) RecordProcessingHistory(dealName, documentPath, processi
 	endTime := time.Now()
 	historyItem.EndTime = &endTime
 
-	qm.processingHistory[historyItem.ID] = historyItem
-
-	// Persist state
-	go qm.persistState()
+	return historyItem
 }
 
 func (qm *QueueManager) matchesQuery(item *QueueItem, query QueueQuery) bool {
@@ -393,18 +1326,110 @@ func (qm *QueueManager) matchesQuery(item *QueueItem, query QueueQuery) bool {
 }
 
 func (qm *QueueManager) sortQueueItems(items []*QueueItem, sortBy, sortOrder string) {
-	// Placeholder implementation
+	less := func(a, b *QueueItem) bool {
+		switch sortBy {
+		case "priority":
+			return a.Priority < b.Priority
+		case "status":
+			return a.Status < b.Status
+		case "dealName":
+			return a.DealName < b.DealName
+		case "documentName":
+			return a.DocumentName < b.DocumentName
+		default: // "queuedAt"
+			return a.QueuedAt.Before(b.QueuedAt)
+		}
+	}
+
+	sort.SliceStable(items, func(i, j int) bool {
+		if sortOrder == "desc" {
+			return less(items[j], items[i])
+		}
+		return less(items[i], items[j])
+	})
 }
 
+// performHealthCheck stops items that have been processing for longer than
+// ProcessingTimeout. A worker run is canceled and keeps its slot until it
+// returns, so a processor that ignores cancellation cannot push the queue over
+// MaxConcurrentJobs; finish then retries it as a timeout. Externally driven
+// jobs that never report back have no worker and are retried here.
 func (qm *QueueManager) performHealthCheck() {
-	// Placeholder implementation
+	qm.mutex.Lock()
+
+	now := time.Now()
+	timedOut := 0
+	for _, item := range qm.queue {
+		if item.Status != QueueStatusProcessing || item.ProcessingStarted == nil {
+			continue
+		}
+		if now.Sub(*item.ProcessingStarted) <= qm.config.ProcessingTimeout {
+			continue
+		}
+
+		if run, ok := qm.running[item.ID]; ok && run.started.Equal(*item.ProcessingStarted) {
+			run.cancel()
+			continue
+		}
+
+		item.ProcessingEnded = &now
+		item.ActualDuration = now.Sub(*item.ProcessingStarted)
+		if qm.processingCount > 0 {
+			qm.processingCount--
+		}
+		qm.scheduleRetry(item, &QueueError{
+			ErrorType:   "timeout",
+			Message:     fmt.Sprintf("no result after %s", qm.config.ProcessingTimeout),
+			OccurredAt:  now,
+			IsRetryable: true,
+		}, now)
+		timedOut++
+	}
+
+	qm.mutex.Unlock()
+
+	if timedOut > 0 {
+		if err := qm.persistState(); err != nil {
+			fmt.Printf("Warning: Failed to persist queue state: %v\n", err)
+		}
+		qm.notify()
+	}
 }
 
+// cleanupCompletedItems drops completed and canceled items after a day and
+// processing history older than MaxHistoryDays. Failed items are kept until
+// they are retried or removed by the user.
 func (qm *QueueManager) cleanupCompletedItems() {
-	// Placeholder implementation
+	now := time.Now()
+
+	qm.mutex.Lock()
+	kept := qm.queue[:0]
+	for _, item := range qm.queue {
+		finished := item.Status == QueueStatusCompleted || item.Status == QueueStatusCanceled
+		if finished && item.ProcessingEnded != nil && now.Sub(*item.ProcessingEnded) > completedItemLifetime {
+			continue
+		}
+		kept = append(kept, item)
+	}
+	for i := len(kept); i < len(qm.queue); i++ {
+		qm.queue[i] = nil
+	}
+	qm.queue = kept
+	qm.mutex.Unlock()
+
+	if qm.config.MaxHistoryDays > 0 {
+		cutoff := now.AddDate(0, 0, -qm.config.MaxHistoryDays)
+		qm.historyMutex.Lock()
+		for id, history := range qm.processingHistory {
+			if history.StartTime.Before(cutoff) {
+				delete(qm.processingHistory, id)
+			}
+		}
+		qm.historyMutex.Unlock()
+	}
 }
 
-func (qm *QueueManager) updateDealFolderMirror(dealName, documentPath string) {
+func (qm *QueueManager) updateDealFolderMirror(dealName, documentPath, itemID string) {
 	qm.folderMutex.Lock()
 	defer qm.folderMutex.Unlock()
 
@@ -421,21 +1446,55 @@ func (qm *QueueManager) updateDealFolderMirror(dealName, documentPath string) {
 		qm.dealFolders[dealName] = mirror
 	}
 
-	// Add file to structure
-	fileInfo := FileStructInfo{
-		Path:            documentPath,
-		ModifiedAt:      time.Now(),
-		Size:            0,  // Would need to stat file for real size
-		Checksum:        "", // Would compute actual checksum in production
-		ProcessingState: "queued",
-		QueueItemID:     "", // Would be set when processing starts
+	// Add file to structure, keeping what a folder scan already recorded
+	fileInfo, known := mirror.FileStructure[documentPath]
+	if !known {
+		fileInfo = FileStructInfo{Path: documentPath, ModifiedAt: time.Now()}
+		if info, err := os.Stat(documentPath); err == nil {
+			fileInfo.Size = info.Size()
+			fileInfo.ModifiedAt = info.ModTime()
+		}
 	}
+	fileInfo.ProcessingState = "queued"
+	fileInfo.QueueItemID = itemID
 
 	mirror.FileStructure[documentPath] = fileInfo
 	mirror.FileCount = len(mirror.FileStructure)
 	mirror.LastSynced = time.Now()
 
-	// Update overall sync status based on any processing states
+	refreshSyncStatus(mirror)
+}
+
+// setMirrorState records an item's processing state in its deal folder
+// mirror; callers hold qm.mutex
+func (qm *QueueManager) setMirrorState(item *QueueItem, state string) {
+	qm.folderMutex.Lock()
+	defer qm.folderMutex.Unlock()
+
+	mirror, exists := qm.dealFolders[item.DealName]
+	if !exists {
+		return
+	}
+	info, exists := mirror.FileStructure[item.DocumentPath]
+	if !exists {
+		return
+	}
+
+	info.ProcessingState = state
+	info.QueueItemID = item.ID
+	mirror.FileStructure[item.DocumentPath] = info
+
+	mirror.ProcessedFiles = 0
+	for _, file := range mirror.FileStructure {
+		if file.ProcessingState == "completed" {
+			mirror.ProcessedFiles++
+		}
+	}
+	refreshSyncStatus(mirror)
+}
+
+// refreshSyncStatus updates overall sync status based on any processing states
+func refreshSyncStatus(mirror *DealFolderMirror) {
 	mirror.SyncStatus = SyncStatusSynced
 	for _, info := range mirror.FileStructure {
 		if info.ProcessingState == "queued" || info.ProcessingState == "processing" {
@@ -1,8 +1,13 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"os"
 	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -455,9 +460,13 @@ func TestQueueManager_HealthCheck(t *testing.T) {
 	// Run health check
 	qm.performHealthCheck()
 
-	// Check that item was marked as failed
-	if item.Status != QueueStatusFailed {
-		t.Errorf("Expected status %s, got %s", QueueStatusFailed, item.Status)
+	// An item without a worker is retried with backoff
+	if item.Status != QueueStatusRetrying {
+		t.Errorf("Expected status %s, got %s", QueueStatusRetrying, item.Status)
+	}
+
+	if item.RetryCount != 1 || item.NextAttemptAt == nil {
+		t.Errorf("Expected a scheduled retry, got %d retries", item.RetryCount)
 	}
 
 	if item.LastError == nil {
@@ -535,3 +544,415 @@ func TestQueueManager_CleanupCompletedItems(t *testing.T) {
 		t.Error("Recent completed item should not have been cleaned up")
 	}
 }
+
+// newTestQueue returns a queue manager with short retry delays and one test
+// file per name
+func newTestQueue(t *testing.T, names ...string) (*QueueManager, []string) {
+	tempDir := t.TempDir()
+	qm := NewQueueManager(tempDir)
+	qm.config.InitialRetryBackoff = 10 * time.Millisecond
+	qm.config.MaxRetryBackoff = 40 * time.Millisecond
+
+	paths := make([]string, 0, len(names))
+	for _, name := range names {
+		path := filepath.Join(tempDir, name)
+		if err := os.WriteFile(path, []byte("content"), 0644); err != nil {
+			t.Fatalf("Failed to create test file: %v", err)
+		}
+		paths = append(paths, path)
+	}
+	return qm, paths
+}
+
+// waitForStatus polls until the item reaches status or the test times out
+func waitForStatus(t *testing.T, qm *QueueManager, id string, status QueueItemStatus) QueueItem {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		qm.mutex.RLock()
+		item := qm.findItem(id)
+		var current QueueItem
+		if item != nil {
+			current = *item
+		}
+		qm.mutex.RUnlock()
+
+		if current.Status == status {
+			return current
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Fatalf("Item %s did not reach status %s", id, status)
+	return QueueItem{}
+}
+
+func stopQueue(t *testing.T, qm *QueueManager) {
+	if err := qm.Stop(); err != nil {
+		t.Errorf("Failed to stop queue manager: %v", err)
+	}
+}
+
+func TestQueueManager_WorkerPool(t *testing.T) {
+	qm, paths := newTestQueue(t, "a.pdf", "b.pdf", "c.pdf", "d.pdf", "e.pdf")
+	qm.config.MaxConcurrentJobs = 2
+
+	var running, peak int32
+	var order []string
+	var orderMutex sync.Mutex
+	release := make(chan struct{})
+
+	qm.RegisterProcessor("classify", func(ctx context.Context, item QueueItem) (map[string]interface{}, error) {
+		current := atomic.AddInt32(&running, 1)
+		defer atomic.AddInt32(&running, -1)
+		for {
+			seen := atomic.LoadInt32(&peak)
+			if current <= seen || atomic.CompareAndSwapInt32(&peak, seen, current) {
+				break
+			}
+		}
+
+		orderMutex.Lock()
+		order = append(order, item.DocumentName)
+		orderMutex.Unlock()
+
+		<-release
+		return map[string]interface{}{"documentType": "financial"}, nil
+	})
+	qm.RegisterProcessor("extract", func(ctx context.Context, item QueueItem) (map[string]interface{}, error) {
+		classify := item.Metadata["stageResults"].(map[string]interface{})["classify"].(map[string]interface{})
+		if classify["documentType"] != "financial" {
+			return nil, fmt.Errorf("classification result not passed to extract")
+		}
+		return map[string]interface{}{"fieldsExtracted": float64(4)}, nil
+	})
+
+	var ids []string
+	for i, path := range paths {
+		priority := PriorityNormal
+		if i == len(paths)-1 {
+			priority = PriorityHigh
+		}
+		item, err := qm.EnqueueDocument("TestDeal", path, filepath.Base(path), priority, nil)
+		if err != nil {
+			t.Fatalf("Failed to enqueue document: %v", err)
+		}
+		ids = append(ids, item.ID)
+	}
+
+	if err := qm.Start(); err != nil {
+		t.Fatalf("Failed to start queue manager: %v", err)
+	}
+	defer stopQueue(t, qm)
+
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	for _, id := range ids {
+		item := waitForStatus(t, qm, id, QueueStatusCompleted)
+		if item.ActualDuration <= 0 {
+			t.Errorf("Expected actual duration to be recorded for %s", item.DocumentName)
+		}
+	}
+
+	if peak != 2 {
+		t.Errorf("Expected at most 2 concurrent jobs and full use of the pool, peak was %d", peak)
+	}
+	if order[0] != "e.pdf" && order[1] != "e.pdf" {
+		t.Errorf("Expected high priority item in the first batch, got %v", order[:2])
+	}
+
+	history := qm.GetProcessingHistory("TestDeal", 0)
+	if len(history) != len(paths) {
+		t.Fatalf("Expected %d history entries, got %d", len(paths), len(history))
+	}
+	if history[0].FieldsExtracted != 4 {
+		t.Errorf("Expected stage results in history, got %d fields", history[0].FieldsExtracted)
+	}
+
+	qm.folderMutex.RLock()
+	processed := qm.dealFolders["TestDeal"].ProcessedFiles
+	qm.folderMutex.RUnlock()
+	if processed != len(paths) {
+		t.Errorf("Expected %d processed files in mirror, got %d", len(paths), processed)
+	}
+}
+
+func TestQueueManager_RetryBackoff(t *testing.T) {
+	qm, paths := newTestQueue(t, "flaky.pdf", "broken.pdf", "invalid.pdf")
+
+	var extractCalls, routeCalls int32
+	qm.RegisterProcessor("route", func(ctx context.Context, item QueueItem) (map[string]interface{}, error) {
+		atomic.AddInt32(&routeCalls, 1)
+		if item.DocumentName == "invalid.pdf" {
+			return nil, NonRetryable(fmt.Errorf("unsupported file"))
+		}
+		return nil, nil
+	})
+	qm.RegisterProcessor("extract", func(ctx context.Context, item QueueItem) (map[string]interface{}, error) {
+		if item.DocumentName == "broken.pdf" {
+			return nil, fmt.Errorf("provider unavailable")
+		}
+		if atomic.AddInt32(&extractCalls, 1) < 3 {
+			return nil, fmt.Errorf("rate limited")
+		}
+		return nil, nil
+	})
+
+	flaky, _ := qm.EnqueueDocument("TestDeal", paths[0], "flaky.pdf", PriorityNormal, nil)
+	broken, _ := qm.EnqueueDocument("TestDeal", paths[1], "broken.pdf", PriorityNormal, nil)
+	invalid, _ := qm.EnqueueDocument("TestDeal", paths[2], "invalid.pdf", PriorityNormal, nil)
+
+	if err := qm.Start(); err != nil {
+		t.Fatalf("Failed to start queue manager: %v", err)
+	}
+	defer stopQueue(t, qm)
+
+	item := waitForStatus(t, qm, flaky.ID, QueueStatusCompleted)
+	if item.RetryCount != 2 {
+		t.Errorf("Expected 2 retries, got %d", item.RetryCount)
+	}
+
+	item = waitForStatus(t, qm, broken.ID, QueueStatusFailed)
+	if item.RetryCount != qm.config.MaxRetryAttempts {
+		t.Errorf("Expected %d retries, got %d", qm.config.MaxRetryAttempts, item.RetryCount)
+	}
+	if item.LastError == nil || !item.LastError.IsRetryable || item.LastError.Details == "" {
+		t.Errorf("Expected exhausted retry error, got %+v", item.LastError)
+	}
+
+	item = waitForStatus(t, qm, invalid.ID, QueueStatusFailed)
+	if item.RetryCount != 0 || item.LastError.IsRetryable {
+		t.Errorf("Expected non-retryable failure without retries, got %d retries", item.RetryCount)
+	}
+
+	// Retries resume after the last successful stage
+	if routeCalls != 3 {
+		t.Errorf("Expected route to run once per item, ran %d times", routeCalls)
+	}
+}
+
+func TestQueueManager_RetryBackoffSchedule(t *testing.T) {
+	qm := NewQueueManager(t.TempDir())
+	qm.config.InitialRetryBackoff = time.Second
+	qm.config.RetryBackoffMultiplier = 2
+	qm.config.MaxRetryBackoff = 5 * time.Second
+
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second}
+	for i, want := range expected {
+		if got := qm.retryBackoff(i + 1); got != want {
+			t.Errorf("Retry %d: expected backoff %s, got %s", i+1, want, got)
+		}
+	}
+}
+
+func TestQueueManager_Dependencies(t *testing.T) {
+	qm, paths := newTestQueue(t, "cim.pdf", "model.xlsx", "bad.pdf", "after_bad.pdf")
+
+	var completed sync.Map
+	qm.RegisterProcessor("populate", func(ctx context.Context, item QueueItem) (map[string]interface{}, error) {
+		for _, dependency := range item.Dependencies {
+			if _, ok := completed.Load(dependency); !ok {
+				return nil, NonRetryable(fmt.Errorf("ran before dependency %s", dependency))
+			}
+		}
+		if item.DocumentName == "bad.pdf" {
+			return nil, NonRetryable(fmt.Errorf("corrupt document"))
+		}
+		completed.Store(item.ID, true)
+		return nil, nil
+	})
+
+	cim, _ := qm.EnqueueDocument("TestDeal", paths[0], "cim.pdf", PriorityLow, nil)
+	model, err := qm.EnqueueDependentDocument("TestDeal", paths[1], "model.xlsx", PriorityHigh, nil, []string{cim.ID})
+	if err != nil {
+		t.Fatalf("Failed to enqueue dependent document: %v", err)
+	}
+	bad, _ := qm.EnqueueDocument("TestDeal", paths[2], "bad.pdf", PriorityNormal, nil)
+	afterBad, _ := qm.EnqueueDependentDocument("TestDeal", paths[3], "after_bad.pdf", PriorityNormal, nil, []string{bad.ID})
+
+	if _, err := qm.EnqueueDependentDocument("TestDeal", paths[0]+".copy", "copy.pdf", PriorityNormal, nil, []string{"missing"}); err == nil {
+		t.Error("Expected error for unknown dependency")
+	}
+
+	if err := qm.Start(); err != nil {
+		t.Fatalf("Failed to start queue manager: %v", err)
+	}
+	defer stopQueue(t, qm)
+
+	waitForStatus(t, qm, model.ID, QueueStatusCompleted)
+	waitForStatus(t, qm, bad.ID, QueueStatusFailed)
+
+	item := waitForStatus(t, qm, afterBad.ID, QueueStatusBlocked)
+	if item.LastError == nil || item.LastError.ErrorType != "dependency_failed" {
+		t.Errorf("Expected dependency_failed error, got %+v", item.LastError)
+	}
+}
+
+func TestQueueManager_ProcessingTimeout(t *testing.T) {
+	qm, paths := newTestQueue(t, "slow.pdf")
+	qm.config.ProcessingTimeout = 20 * time.Millisecond
+	qm.config.MaxRetryAttempts = 1
+
+	var calls int32
+	qm.RegisterProcessor("extract", func(ctx context.Context, item QueueItem) (map[string]interface{}, error) {
+		atomic.AddInt32(&calls, 1)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	slow, _ := qm.EnqueueDocument("TestDeal", paths[0], "slow.pdf", PriorityNormal, nil)
+	if err := qm.Start(); err != nil {
+		t.Fatalf("Failed to start queue manager: %v", err)
+	}
+	defer stopQueue(t, qm)
+
+	item := waitForStatus(t, qm, slow.ID, QueueStatusFailed)
+	if item.LastError == nil || item.LastError.ErrorType != "timeout" {
+		t.Errorf("Expected timeout error, got %+v", item.LastError)
+	}
+	if atomic.LoadInt32(&calls) != 2 {
+		t.Errorf("Expected one retry after the timeout, got %d calls", calls)
+	}
+}
+
+func TestQueueManager_HealthCheckCancelsWorker(t *testing.T) {
+	qm, paths := newTestQueue(t, "hung.pdf")
+
+	canceled := make(chan struct{})
+	release := make(chan struct{})
+	qm.RegisterProcessor("extract", func(ctx context.Context, item QueueItem) (map[string]interface{}, error) {
+		<-ctx.Done()
+		close(canceled)
+		<-release
+		return nil, ctx.Err()
+	})
+
+	hung, _ := qm.EnqueueDocument("TestDeal", paths[0], "hung.pdf", PriorityNormal, nil)
+
+	// Start a run that is already past ProcessingTimeout
+	started := time.Now().Add(-2 * qm.config.ProcessingTimeout)
+	qm.mutex.Lock()
+	hung.Status = QueueStatusProcessing
+	hung.ProcessingStarted = &started
+	qm.processingCount = 1
+	qm.workers.Add(1)
+	go qm.process(qm.ctx, hung, cloneQueueItem(hung), qm.stages, started)
+	qm.mutex.Unlock()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		qm.mutex.RLock()
+		_, registered := qm.running[hung.ID]
+		qm.mutex.RUnlock()
+		if registered {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Worker did not start")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	qm.performHealthCheck()
+	<-canceled
+
+	// The slot stays held until the worker returns
+	qm.mutex.RLock()
+	status, count := hung.Status, qm.processingCount
+	qm.mutex.RUnlock()
+	if status != QueueStatusProcessing || count != 1 {
+		t.Errorf("Expected the running item to keep its slot, got %s with %d processing", status, count)
+	}
+
+	close(release)
+	item := waitForStatus(t, qm, hung.ID, QueueStatusRetrying)
+	if item.LastError == nil || item.LastError.ErrorType != "timeout" {
+		t.Errorf("Expected timeout error, got %+v", item.LastError)
+	}
+	qm.mutex.RLock()
+	count = qm.processingCount
+	qm.mutex.RUnlock()
+	if count != 0 {
+		t.Errorf("Expected processing count 0, got %d", count)
+	}
+	qm.workers.Wait()
+}
+
+func TestQueueManager_RecoversInFlightItems(t *testing.T) {
+	qm, paths := newTestQueue(t, "a.pdf", "b.pdf")
+
+	started := make(chan struct{})
+	qm.RegisterProcessor("extract", func(ctx context.Context, item QueueItem) (map[string]interface{}, error) {
+		close(started)
+		<-ctx.Done()
+		return nil, ctx.Err()
+	})
+
+	inFlight, _ := qm.EnqueueDocument("TestDeal", paths[0], "a.pdf", PriorityHigh, nil)
+	pending, _ := qm.EnqueueDocument("TestDeal", paths[1], "b.pdf", PriorityNormal, map[string]interface{}{"source": "upload"})
+	qm.config.MaxConcurrentJobs = 1
+	if err := qm.Start(); err != nil {
+		t.Fatalf("Failed to start queue manager: %v", err)
+	}
+	<-started
+	waitForStatus(t, qm, inFlight.ID, QueueStatusProcessing)
+
+	// Simulate a crash: the stored state still shows the item processing
+	crashed := NewQueueManagerWithRepository(qm.repo)
+	stopQueue(t, qm)
+
+	crashed.mutex.RLock()
+	defer crashed.mutex.RUnlock()
+	recovered := crashed.findItem(inFlight.ID)
+	if recovered == nil || recovered.Status != QueueStatusRetrying {
+		t.Fatalf("Expected in-flight item to be recovered as retrying, got %+v", recovered)
+	}
+	if recovered.LastError == nil || recovered.LastError.ErrorType != "interrupted" {
+		t.Errorf("Expected interrupted error, got %+v", recovered.LastError)
+	}
+	if crashed.processingCount != 0 {
+		t.Errorf("Expected no items processing after recovery, got %d", crashed.processingCount)
+	}
+
+	waiting := crashed.findItem(pending.ID)
+	if waiting == nil || waiting.Status != QueueStatusPending || waiting.Metadata["source"] != "upload" {
+		t.Errorf("Expected pending item to be restored unchanged, got %+v", waiting)
+	}
+
+	// A graceful stop requeues without using up a retry
+	qm.mutex.RLock()
+	stopped := *qm.findItem(inFlight.ID)
+	qm.mutex.RUnlock()
+	if stopped.Status != QueueStatusRetrying || stopped.RetryCount != 0 {
+		t.Errorf("Expected interrupted item to be retrying with no retries used, got %s/%d", stopped.Status, stopped.RetryCount)
+	}
+}
+
+func TestQueueManager_CorruptStateFile(t *testing.T) {
+	tempDir := t.TempDir()
+	stateFile := filepath.Join(tempDir, "queue_state.json")
+	if err := os.WriteFile(stateFile, []byte("{\"queueItems\": ["), 0644); err != nil {
+		t.Fatalf("Failed to write state file: %v", err)
+	}
+
+	qm := NewQueueManager(tempDir)
+	if len(qm.queue) != 0 {
+		t.Errorf("Expected empty queue, got %d items", len(qm.queue))
+	}
+	if _, err := os.Stat(stateFile + ".corrupt"); err != nil {
+		t.Errorf("Expected corrupt state file to be kept: %v", err)
+	}
+	if err := qm.persistState(); err != nil {
+		t.Fatalf("Failed to persist state: %v", err)
+	}
+
+	entries, _ := os.ReadDir(tempDir)
+	for _, entry := range entries {
+		if filepath.Ext(entry.Name()) == ".tmp" {
+			t.Errorf("Temporary file left behind: %s", entry.Name())
+		}
+	}
+	if !errors.Is(NonRetryable(context.Canceled), context.Canceled) {
+		t.Error("NonRetryable should wrap the original error")
+	}
+}
@@ -22,6 +22,7 @@ type SemanticEmbedding struct {
 	Source         string            `json:"source"`
 	Confidence     float64           `json:"confidence"`
 	DimensionCount int               `json:"dimension_count"`
+	Model          string            `json:"model,omitempty"`
 }
 
 // KnowledgeNode represents a node in the knowledge graph
@@ -100,7 +101,10 @@ type AdvancedRAGEngine struct {
 	contextAnalyzer      *ContextAnalyzer
 	patternMatcher       *SemanticPatternMatcher
 	recommendationEngine *RecommendationEngine
+	embedder             Embedder
+	vectorIndex          *VectorIndex
 	mutex                sync.RWMutex
+	saveMutex            sync.Mutex
 	logger               Logger
 	ctx                  context.Context
 	cancel               context.CancelFunc
@@ -122,6 +126,10 @@ type RAGConfig struct {
 	EnableKnowledgeGraph     bool          `json:"enable_knowledge_graph"`
 	EnableUserProfiling      bool          `json:"enable_user_profiling"`
 	CacheSize                int           `json:"cache_size"`
+
+	// Embedder embeds corrections; when nil a local embedder with
+	// EmbeddingDimensions is used
+	Embedder Embedder `json:"-"`
 }
 
 // LearningMemory manages episodic and semantic memory
@@ -202,6 +210,10 @@ type RecommendationEngine struct {
 func NewAdvancedRAGEngine(config RAGConfig, logger Logger) *AdvancedRAGEngine {
 	ctx, cancel := context.WithCancel(context.Background())
 
+	embedder := config.Embedder
+	if embedder == nil {
+		embedder = NewLocalEmbedder(config.EmbeddingDimensions)
+	}
 	engine := &AdvancedRAGEngine{
 		config:          config,
 		knowledgeGraph:  make(map[string]*KnowledgeNode),
@@ -211,6 +223,8 @@ func NewAdvancedRAGEngine(config RAGConfig, logger Logger) *AdvancedRAGEngine {
 		learningMemory:  NewLearningMemory(),
 		contextAnalyzer: NewContextAnalyzer(),
 		patternMatcher:  NewSemanticPatternMatcher(),
+		embedder:        embedder,
+		vectorIndex:     NewVectorIndex(filepath.Join(config.StoragePath, "vector_index.json"), embedder.Name(), embedder.Dimensions()),
 		logger:          logger,
 		ctx:             ctx,
 		cancel:          cancel,
@@ -228,6 +242,18 @@ func NewAdvancedRAGEngine(config RAGConfig, logger Logger) *AdvancedRAGEngine {
 		logger.Warn("Failed to load existing RAG state: %v", err)
 	}
 
+	// Load the vector index, rebuilding it when it is missing or was built by
+	// another embedding model
+	current, err := engine.vectorIndex.Load()
+	if err != nil {
+		logger.Warn("Failed to load RAG vector index: %v", err)
+	}
+	if !current || (engine.vectorIndex.Len() == 0 && len(engine.knowledgeGraph) > 0) {
+		if err := engine.reindex(); err != nil {
+			logger.Warn("Failed to rebuild RAG vector index: %v", err)
+		}
+	}
+
 	// Start background processing
 	go engine.startBackgroundProcessing()
 
@@ -236,8 +262,25 @@ func NewAdvancedRAGEngine(config RAGConfig, logger Logger) *AdvancedRAGEngine {
 
 // ProcessCorrectionWithRAG processes a correction using advanced RAG techniques
 func (rag *AdvancedRAGEngine) ProcessCorrectionWithRAG(correction *CorrectionEntry, context LearningContext) (*LearningResult, error) {
-	rag.mutex.Lock()
-	defer rag.mutex.Unlock()
+	startTime := time.Now()
+
+	// 1. Create semantic embedding for the correction. A remote embedder
+	// can take seconds, so the label is embedded before taking the lock and
+	// again if the embedder was switched in the meantime.
+	var embedding *SemanticEmbedding
+	for {
+		embedder := rag.Embedder()
+		vector, err := embedOne(rag.ctx, embedder, correction.FieldName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create semantic embedding: %w", err)
+		}
+		rag.mutex.Lock()
+		if rag.embedder == embedder {
+			embedding = rag.createSemanticEmbedding(correction, context, vector)
+			break
+		}
+		rag.mutex.Unlock()
+	}
 
 	result := &LearningResult{
 		CorrectionID:    correction.ID,
@@ -249,14 +292,6 @@ func (rag *AdvancedRAGEngine) ProcessCorrectionWithRAG(correction *CorrectionEnt
 		ProcessingTime:  0,
 	}
 
-	startTime := time.Now()
-
-	// 1. Create semantic embedding for the correction
-	embedding, err := rag.createSemanticEmbedding(correction, context)
-	if err != nil {
-		return nil, fmt.Errorf("failed to create semantic embedding: %v", err)
-	}
-
 	// 2. Find similar corrections in knowledge graph
 	similarNodes := rag.findSimilarNodes(embedding, 5)
 
@@ -264,9 +299,11 @@ func (rag *AdvancedRAGEngine) ProcessCorrectionWithRAG(correction *CorrectionEnt
 	contextInsights := rag.contextAnalyzer.AnalyzeContext(correction, context)
 	result.Insights = append(result.Insights, contextInsights...)
 
-	// 4. Update knowledge graph
+	// 4. Update knowledge graph and index
 	nodeID := rag.updateKnowledgeGraph(correction, embedding, context)
-	_ = nodeID // Mark as used for now - could be returned or logged
+	if err := rag.vectorIndex.Upsert(embedding.ID, embedding.Vector, ragIndexMetadata(rag.knowledgeGraph[nodeID])); err != nil {
+		rag.logger.Warn("Failed to index embedding %s: %v", embedding.ID, err)
+	}
 
 	// 5. Update user profile
 	if context.UserProfile.UserID != "" {
@@ -305,6 +342,13 @@ func (rag *AdvancedRAGEngine) ProcessCorrectionWithRAG(correction *CorrectionEnt
 	result.ConfidenceScore = rag.calculateOverallConfidence(similarNodes, patterns, context)
 
 	result.ProcessingTime = time.Since(startTime)
+	rag.mutex.Unlock()
+
+	// Persist the graph and index so the correction is available to the
+	// next deal even if the app exits
+	if err := rag.saveState(); err != nil {
+		rag.logger.Warn("Failed to save RAG state: %v", err)
+	}
 
 	rag.logger.Info("Processed correction %s with RAG learning (confidence: %.2f, patterns: %d, recommendations: %d)",
 		correction.ID, result.ConfidenceScore, len(patterns), len(recommendations))
@@ -377,29 +421,23 @@ func (rag *AdvancedRAGEngine) RetrieveRelevantKnowledge(query string, context Le
 		return nil, fmt.Errorf("failed to create query embedding: %v", err)
 	}
 
-	// Find similar embeddings
-	similarEmbeddings := rag.findSimilarEmbeddings(queryEmbedding, maxResults*2)
-
-	// Retrieve corresponding knowledge nodes
+	// Search the vector index and resolve hits to knowledge nodes
+	matches := rag.vectorIndex.Search(queryEmbedding.Vector, maxResults*2, rag.config.SimilarityThreshold)
 	results := make([]*KnowledgeRetrievalResult, 0, maxResults)
 
-	for _, embedding := range similarEmbeddings {
-		nodes := rag.findNodesWithEmbedding(embedding.ID)
-		for _, node := range nodes {
-			if len(results) >= maxResults {
-				break
-			}
-
-			result := &KnowledgeRetrievalResult{
-				Node:       node,
-				Embedding:  embedding,
-				Similarity: rag.calculateSimilarity(queryEmbedding, embedding),
-				Relevance:  rag.calculateRelevance(node, context),
-				Context:    context,
-			}
-
-			results = append(results, result)
+	for _, match := range matches {
+		node, exists := rag.knowledgeGraph[match.Metadata["node_id"]]
+		if !exists || !node.IsActive {
+			continue
 		}
+
+		results = append(results, &KnowledgeRetrievalResult{
+			Node:       node,
+			Embedding:  rag.embeddings[match.ID],
+			Similarity: match.Score,
+			Relevance:  rag.calculateRelevance(node, context),
+			Context:    context,
+		})
 	}
 
 	// Sort by relevance and similarity
@@ -471,11 +509,10 @@ func (rag *AdvancedRAGEngine) UpdateUserLearningProfile(userID string, updates m
 // Additional helper methods
 
 func (rag *AdvancedRAGEngine) createQueryEmbedding(query string, context LearningContext) (*SemanticEmbedding, error) {
-	// Create a semantic representation of the query
-	content := fmt.Sprintf("query:%s context:%s", query, context.DocumentType)
-
-	// Generate embedding
-	vector := rag.generateEmbeddingVector(content)
+	vector, err := rag.embedText(query)
+	if err != nil {
+		return nil, err
+	}
 
 	embedding := &SemanticEmbedding{
 		ID:             fmt.Sprintf("query_%d", time.Now().UnixNano()),
@@ -485,6 +522,7 @@ func (rag *AdvancedRAGEngine) createQueryEmbedding(query string, context Learnin
 		Source:         "query",
 		Confidence:     1.0,
 		DimensionCount: len(vector),
+		Model:          rag.embedder.Name(),
 	}
 
 	// Add metadata
@@ -495,56 +533,6 @@ func (rag *AdvancedRAGEngine) createQueryEmbedding(query string, context Learnin
 	return embedding, nil
 }
 
-func (rag *AdvancedRAGEngine) findSimilarEmbeddings(queryEmbedding *SemanticEmbedding, maxResults int) []*SemanticEmbedding {
-	type embeddingWithSimilarity struct {
-		embedding  *SemanticEmbedding
-		similarity float64
-	}
-
-	similarities := make([]embeddingWithSimilarity, 0)
-
-	for _, embedding := range rag.embeddings {
-		similarity := rag.calculateSimilarity(queryEmbedding, embedding)
-		if similarity >= rag.config.SimilarityThreshold {
-			similarities = append(similarities, embeddingWithSimilarity{
-				embedding:  embedding,
-				similarity: similarity,
-			})
-		}
-	}
-
-	// Sort by similarity
-	sort.Slice(similarities, func(i, j int) bool {
-		return similarities[i].similarity > similarities[j].similarity
-	})
-
-	// Return top results
-	results := make([]*SemanticEmbedding, 0, maxResults)
-	for i, sim := range similarities {
-		if i >= maxResults {
-			break
-		}
-		results = append(results, sim.embedding)
-	}
-
-	return results
-}
-
-func (rag *AdvancedRAGEngine) findNodesWithEmbedding(embeddingID string) []*KnowledgeNode {
-	nodes := make([]*KnowledgeNode, 0)
-
-	for _, node := range rag.knowledgeGraph {
-		for _, nodeEmbeddingID := range node.Embeddings {
-			if nodeEmbeddingID == embeddingID {
-				nodes = append(nodes, node)
-				break
-			}
-		}
-	}
-
-	return nodes
-}
-
 func (rag *AdvancedRAGEngine) calculateRelevance(node *KnowledgeNode, context LearningContext) float64 {
 	relevance := node.Weight
 
@@ -722,15 +710,10 @@ func NewRecommendationEngine(ragEngine *AdvancedRAGEngine) *RecommendationEngine
 
 // Helper method implementations
 
-func (rag *AdvancedRAGEngine) createSemanticEmbedding(correction *CorrectionEntry, context LearningContext) (*SemanticEmbedding, error) {
-	// Create a semantic representation of the correction
-	content := fmt.Sprintf("correction_type:%s field:%s original:%v corrected:%v context:%s",
-		correction.CorrectionType, correction.FieldName, correction.OriginalValue,
-		correction.CorrectedValue, context.DocumentType)
-
-	// Generate embedding (simplified - in practice would use proper embedding model)
-	vector := rag.generateEmbeddingVector(content)
-
+// createSemanticEmbedding records the embedding of the label that was
+// corrected, so later documents using a differently worded label for the
+// same item find this correction. Callers hold the write lock.
+func (rag *AdvancedRAGEngine) createSemanticEmbedding(correction *CorrectionEntry, context LearningContext, vector []float64) *SemanticEmbedding {
 	embedding := &SemanticEmbedding{
 		ID:             fmt.Sprintf("emb_%s_%d", correction.ID, time.Now().UnixNano()),
 		Vector:         vector,
@@ -739,6 +722,7 @@ func (rag *AdvancedRAGEngine) createSemanticEmbedding(correction *CorrectionEntr
 		Source:         "correction",
 		Confidence:     correction.OriginalConfidence,
 		DimensionCount: len(vector),
+		Model:          rag.embedder.Name(),
 	}
 
 	// Add metadata
@@ -749,114 +733,234 @@ func (rag *AdvancedRAGEngine) createSemanticEmbedding(correction *CorrectionEntr
 
 	rag.embeddings[embedding.ID] = embedding
 
-	return embedding, nil
+	return embedding
+}
+
+// embedText embeds a single text with the configured embedder
+func (rag *AdvancedRAGEngine) embedText(content string) ([]float64, error) {
+	vector, err := embedOne(rag.ctx, rag.embedder, content)
+	if err != nil {
+		return nil, fmt.Errorf("embedding failed: %w", err)
+	}
+	return vector, nil
+}
+
+func (rag *AdvancedRAGEngine) findSimilarNodes(embedding *SemanticEmbedding, maxResults int) []*KnowledgeNode {
+	return rag.searchNodes(embedding.Vector, maxResults, "")
 }
 
-func (rag *AdvancedRAGEngine) generateEmbeddingVector(content string) []float64 {
-	// Simplified embedding generation - in practice would use transformer models
-	dimensions := rag.config.EmbeddingDimensions
-	vector := make([]float64, dimensions)
+// searchNodes returns active knowledge nodes whose embeddings are within the
+// similarity threshold of vector, best first, optionally limited to one
+// correction type
+func (rag *AdvancedRAGEngine) searchNodes(vector []float64, maxResults int, correctionType CorrectionType) []*KnowledgeNode {
+	scored := rag.searchScoredNodes(vector, maxResults, correctionType)
+	nodes := make([]*KnowledgeNode, len(scored))
+	for i, match := range scored {
+		nodes[i] = match.node
+	}
+	return nodes
+}
+
+type scoredKnowledgeNode struct {
+	node       *KnowledgeNode
+	similarity float64
+}
 
-	// Create hash-based vector
-	hash := 0
-	for _, char := range content {
-		hash = hash*31 + int(char)
+func (rag *AdvancedRAGEngine) searchScoredNodes(vector []float64, maxResults int, correctionType CorrectionType) []scoredKnowledgeNode {
+	// Over-fetch since several embeddings can resolve to the same node and
+	// filtered or inactive nodes are dropped
+	matches := rag.vectorIndex.Search(vector, maxResults*4, rag.config.SimilarityThreshold)
+
+	results := make([]scoredKnowledgeNode, 0, maxResults)
+	seen := make(map[string]bool)
+	for _, match := range matches {
+		if len(results) >= maxResults {
+			break
+		}
+		nodeID := match.Metadata["node_id"]
+		node, exists := rag.knowledgeGraph[nodeID]
+		if !exists || !node.IsActive || seen[nodeID] {
+			continue
+		}
+		if correctionType != "" && match.Metadata["correction_type"] != string(correctionType) {
+			continue
+		}
+		seen[nodeID] = true
+		results = append(results, scoredKnowledgeNode{node: node, similarity: match.Score})
 	}
+	return results
+}
 
-	for i := 0; i < dimensions; i++ {
-		vector[i] = math.Sin(float64(hash+i))*0.5 + 0.5
+func (rag *AdvancedRAGEngine) calculateSimilarity(embA, embB *SemanticEmbedding) float64 {
+	return cosineSimilarity(embA.Vector, embB.Vector)
+}
+
+// ragIndexMetadata is stored alongside each vector so search hits resolve to
+// knowledge nodes without scanning the graph
+func ragIndexMetadata(node *KnowledgeNode) map[string]string {
+	metadata := map[string]string{"node_id": node.ID}
+	if fieldName, ok := node.Content["field_name"].(string); ok {
+		metadata["field_name"] = fieldName
+	}
+	if correctionType, ok := node.Content["correction_type"].(string); ok {
+		metadata["correction_type"] = correctionType
 	}
+	return metadata
+}
+
+// Embedder returns the embedding model in use
+func (rag *AdvancedRAGEngine) Embedder() Embedder {
+	rag.mutex.RLock()
+	defer rag.mutex.RUnlock()
+	return rag.embedder
+}
 
-	// Normalize vector
-	magnitude := 0.0
-	for _, val := range vector {
-		magnitude += val * val
+// SetEmbedder switches the embedding model and re-embeds every knowledge
+// node so the vector index stays consistent
+func (rag *AdvancedRAGEngine) SetEmbedder(embedder Embedder) error {
+	if embedder == nil {
+		return fmt.Errorf("embedder is required")
 	}
-	magnitude = math.Sqrt(magnitude)
 
-	if magnitude > 0 {
-		for i := range vector {
-			vector[i] /= magnitude
+	rag.mutex.Lock()
+	defer rag.mutex.Unlock()
+
+	previous := rag.embedder
+	rag.embedder = embedder
+	if err := rag.reindex(); err != nil {
+		rag.embedder = previous
+		if restoreErr := rag.reindex(); restoreErr != nil {
+			rag.logger.Error("Failed to restore RAG vector index: %v", restoreErr)
 		}
+		return err
 	}
 
-	return vector
+	rag.logger.Info("RAG engine now uses embedder %s", embedder.Name())
+	return nil
 }
 
-func (rag *AdvancedRAGEngine) findSimilarNodes(embedding *SemanticEmbedding, maxResults int) []*KnowledgeNode {
-	type nodeWithSimilarity struct {
-		node       *KnowledgeNode
-		similarity float64
+// reindex re-embeds the corrected label of every knowledge node with the
+// current embedder and rebuilds the vector index. Callers hold the write
+// lock or have exclusive access.
+func (rag *AdvancedRAGEngine) reindex() error {
+	nodes := make([]*KnowledgeNode, 0, len(rag.knowledgeGraph))
+	for _, node := range rag.knowledgeGraph {
+		if len(node.Embeddings) > 0 {
+			nodes = append(nodes, node)
+		}
 	}
+	sort.Slice(nodes, func(i, j int) bool { return nodes[i].ID < nodes[j].ID })
 
-	similarities := make([]nodeWithSimilarity, 0)
+	batchSize := rag.config.BatchProcessingSize
+	if batchSize <= 0 {
+		batchSize = 100
+	}
 
-	for _, node := range rag.knowledgeGraph {
-		if !node.IsActive {
-			continue
+	vectors := make([][]float64, 0, len(nodes))
+	for start := 0; start < len(nodes); start += batchSize {
+		end := start + batchSize
+		if end > len(nodes) {
+			end = len(nodes)
 		}
+		texts := make([]string, 0, end-start)
+		for _, node := range nodes[start:end] {
+			fieldName, _ := node.Content["field_name"].(string)
+			texts = append(texts, fieldName)
+		}
+		batch, err := rag.embedder.Embed(rag.ctx, texts)
+		if err != nil {
+			return fmt.Errorf("failed to re-embed knowledge nodes: %w", err)
+		}
+		if len(batch) != len(texts) {
+			return fmt.Errorf("embedder returned %d vectors for %d inputs", len(batch), len(texts))
+		}
+		vectors = append(vectors, batch...)
+	}
 
-		// Calculate average similarity to all embeddings in the node
-		totalSimilarity := 0.0
-		embeddingCount := 0
+	dimensions := rag.embedder.Dimensions()
+	if dimensions == 0 && len(vectors) > 0 {
+		dimensions = len(vectors[0])
+	}
+	rag.vectorIndex.Reset(rag.embedder.Name(), dimensions)
 
+	for i, node := range nodes {
 		for _, embeddingID := range node.Embeddings {
-			if nodeEmbedding, exists := rag.embeddings[embeddingID]; exists {
-				similarity := rag.calculateSimilarity(embedding, nodeEmbedding)
-				totalSimilarity += similarity
-				embeddingCount++
+			embedding, exists := rag.embeddings[embeddingID]
+			if !exists {
+				embedding = &SemanticEmbedding{
+					ID:        embeddingID,
+					Metadata:  make(map[string]string),
+					Timestamp: node.CreatedAt,
+					Source:    "correction",
+				}
+				rag.embeddings[embeddingID] = embedding
 			}
-		}
+			embedding.Vector = vectors[i]
+			embedding.DimensionCount = len(vectors[i])
+			embedding.Model = rag.embedder.Name()
 
-		if embeddingCount > 0 {
-			avgSimilarity := totalSimilarity / float64(embeddingCount)
-			if avgSimilarity >= rag.config.SimilarityThreshold {
-				similarities = append(similarities, nodeWithSimilarity{
-					node:       node,
-					similarity: avgSimilarity,
-				})
+			if err := rag.vectorIndex.Upsert(embeddingID, vectors[i], ragIndexMetadata(node)); err != nil {
+				return err
 			}
 		}
 	}
 
-	// Sort by similarity
-	sort.Slice(similarities, func(i, j int) bool {
-		return similarities[i].similarity > similarities[j].similarity
-	})
+	return rag.vectorIndex.Save()
+}
 
-	// Return top results
-	results := make([]*KnowledgeNode, 0, maxResults)
-	for i, sim := range similarities {
-		if i >= maxResults {
-			break
-		}
-		results = append(results, sim.node)
-	}
+// SuggestFieldMappings returns mapping corrections made on labels similar to
+// fieldName, so a correction on "Net Revenue" informs "Total Net Sales"
+func (rag *AdvancedRAGEngine) SuggestFieldMappings(fieldName string, context LearningContext, maxResults int) ([]LearningRecommendation, error) {
+	rag.mutex.RLock()
+	defer rag.mutex.RUnlock()
 
-	return results
+	return rag.suggestFieldMappings(fieldName, nil, context, maxResults)
 }
 
-func (rag *AdvancedRAGEngine) calculateSimilarity(embA, embB *SemanticEmbedding) float64 {
-	if len(embA.Vector) != len(embB.Vector) {
-		return 0.0
+func (rag *AdvancedRAGEngine) suggestFieldMappings(fieldName string, value interface{}, context LearningContext, maxResults int) ([]LearningRecommendation, error) {
+	recommendations := make([]LearningRecommendation, 0)
+	if maxResults <= 0 || fieldName == "" {
+		return recommendations, nil
 	}
 
-	// Cosine similarity
-	dotProduct := 0.0
-	normA := 0.0
-	normB := 0.0
-
-	for i := 0; i < len(embA.Vector); i++ {
-		dotProduct += embA.Vector[i] * embB.Vector[i]
-		normA += embA.Vector[i] * embA.Vector[i]
-		normB += embB.Vector[i] * embB.Vector[i]
+	vector, err := rag.embedText(fieldName)
+	if err != nil {
+		return nil, err
 	}
 
-	if normA == 0 || normB == 0 {
-		return 0.0
-	}
+	// One recommendation per suggested target, backed by its best match
+	byTarget := make(map[string]int)
+	for _, match := range rag.searchScoredNodes(vector, maxResults*4, FieldMappingCorrection) {
+		target := fmt.Sprintf("%v", match.node.Content["corrected_value"])
+		sourceField, _ := match.node.Content["field_name"].(string)
 
-	return dotProduct / (math.Sqrt(normA) * math.Sqrt(normB))
+		if index, exists := byTarget[target]; exists {
+			recommendations[index].SupportingNodes = append(recommendations[index].SupportingNodes, match.node.ID)
+			continue
+		}
+		if len(recommendations) >= maxResults {
+			continue
+		}
+
+		byTarget[target] = len(recommendations)
+		recommendations = append(recommendations, LearningRecommendation{
+			ID:              fmt.Sprintf("rec_mapping_%s_%d", match.node.ID, len(recommendations)),
+			Type:            "field_mapping",
+			FieldName:       fieldName,
+			CurrentValue:    value,
+			SuggestedValue:  match.node.Content["corrected_value"],
+			Confidence:      math.Min(1.0, match.similarity*math.Max(rag.calculateRelevance(match.node, context), 0.5)),
+			Reasoning:       fmt.Sprintf("Mapping of %q was corrected to %s (similarity %.2f)", sourceField, target, match.similarity),
+			SupportingNodes: []string{match.node.ID},
+			Context: map[string]interface{}{
+				"source_field": sourceField,
+				"similarity":   match.similarity,
+			},
+			CreatedAt: time.Now(),
+		})
+	}
+
+	return recommendations, nil
 }
 
 func (rag *AdvancedRAGEngine) updateKnowledgeGraph(correction *CorrectionEntry, embedding *SemanticEmbedding, context LearningContext) string {
@@ -1073,6 +1177,7 @@ func (rag *AdvancedRAGEngine) cleanupOldEmbeddings() {
 	toRemove := len(embeddings) - rag.config.MaxEmbeddings
 	for i := 0; i < toRemove; i++ {
 		delete(rag.embeddings, embeddings[i].id)
+		rag.vectorIndex.Remove(embeddings[i].id)
 	}
 
 	rag.logger.Info("Cleaned up %d old embeddings", toRemove)
@@ -1125,10 +1230,14 @@ func (rag *AdvancedRAGEngine) cleanupSimilarityCache() {
 	}
 }
 
+// saveState persists the graph, embeddings, profiles and vector index. The
+// engine lock is held only while the state is encoded, not for the writes.
+// Saves run one at a time, so an older state never replaces a newer one.
 func (rag *AdvancedRAGEngine) saveState() error {
-	rag.mutex.RLock()
-	defer rag.mutex.RUnlock()
+	rag.saveMutex.Lock()
+	defer rag.saveMutex.Unlock()
 
+	rag.mutex.RLock()
 	state := struct {
 		KnowledgeGraph map[string]*KnowledgeNode     `json:"knowledge_graph"`
 		Embeddings     map[string]*SemanticEmbedding `json:"embeddings"`
@@ -1142,6 +1251,7 @@ func (rag *AdvancedRAGEngine) saveState() error {
 	}
 
 	data, err := json.MarshalIndent(state, "", "  ")
+	rag.mutex.RUnlock()
 	if err != nil {
 		return fmt.Errorf("failed to marshal RAG state: %v", err)
 	}
@@ -1157,7 +1267,7 @@ func (rag *AdvancedRAGEngine) saveState() error {
 		return fmt.Errorf("failed to rename temp RAG state file: %v", err)
 	}
 
-	return nil
+	return rag.vectorIndex.Save()
 }
 
 // Shutdown gracefully shuts down the RAG engine
@@ -1300,6 +1410,12 @@ func (re *RecommendationEngine) GenerateFieldRecommendations(fieldName string, v
 	re.mutex.RLock()
 	defer re.mutex.RUnlock()
 
-	// Placeholder for field-specific recommendations
-	return make([]LearningRecommendation, 0)
+	// Suggest mappings learned from corrections on similarly named fields;
+	// the caller holds the engine's read lock
+	recommendations, err := re.ragEngine.suggestFieldMappings(fieldName, value, context, 3)
+	if err != nil {
+		re.ragEngine.logger.Warn("Failed to suggest mappings for %s: %v", fieldName, err)
+		return make([]LearningRecommendation, 0)
+	}
+	return recommendations
 }
@@ -0,0 +1,544 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+)
+
+// searchIndexVersion changes whenever tokenization does, so indexes written
+// by earlier versions are rebuilt
+const searchIndexVersion = 1
+
+// defaultSearchLimit caps the hits returned when a search sets no limit
+const defaultSearchLimit = 50
+
+// searchableFolders are the deal subfolders documents are routed into
+var searchableFolders = []string{"legal", "financial", "general"}
+
+// IndexedDocument is a document's extracted text in a deal's search index
+type IndexedDocument struct {
+	Path         string          `json:"path"`   // Relative to the deal folder
+	Folder       string          `json:"folder"` // Subfolder of the deal holding the document
+	Name         string          `json:"name"`
+	DocumentType DocumentType    `json:"documentType"`
+	Checksum     string          `json:"checksum"`
+	Modified     time.Time       `json:"modified"`
+	Pages        []ExtractedPage `json:"pages"`
+	IndexedAt    time.Time       `json:"indexedAt"`
+}
+
+// searchIndexFile is what a deal's search index persists. Postings are
+// rebuilt from the document text when it is loaded.
+type searchIndexFile struct {
+	Version   int                         `json:"version"`
+	DealName  string                      `json:"dealName"`
+	Documents map[string]*IndexedDocument `json:"documents"` // Keyed by path
+	BuiltAt   time.Time                   `json:"builtAt"`   // Zero until every document in the deal was indexed
+	UpdatedAt time.Time                   `json:"updatedAt"`
+}
+
+// dealSearchIndex is a deal's inverted index: the positions of each term in
+// each document it occurs in
+type dealSearchIndex struct {
+	searchIndexFile
+	path     string
+	postings map[string]map[string][]int
+}
+
+// SearchIndexStatus describes a deal's search index
+type SearchIndexStatus struct {
+	DealName  string    `json:"dealName"`
+	Documents int       `json:"documents"`
+	Terms     int       `json:"terms"`
+	Skipped   []string  `json:"skipped,omitempty"` // Documents whose text could not be extracted
+	BuiltAt   time.Time `json:"builtAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// SearchSnippet is a passage of a matching document. Highlights are the
+// [start, end) character offsets of the matches within Text.
+type SearchSnippet struct {
+	Page       int      `json:"page"`
+	Label      string   `json:"label,omitempty"`
+	Text       string   `json:"text"`
+	Highlights [][2]int `json:"highlights"`
+}
+
+// ContentSearchHit is a document matching a content search
+type ContentSearchHit struct {
+	Path         string          `json:"path"`
+	Folder       string          `json:"folder"`
+	Name         string          `json:"name"`
+	DocumentType DocumentType    `json:"documentType"`
+	Modified     time.Time       `json:"modified"`
+	Score        float64         `json:"score"`
+	Matches      int             `json:"matches"`
+	Snippets     []SearchSnippet `json:"snippets"`
+}
+
+// ContentSearchResult is the outcome of searching a deal's documents
+type ContentSearchResult struct {
+	DealName   string             `json:"dealName"`
+	Query      string             `json:"query"`
+	Hits       []ContentSearchHit `json:"hits"`
+	TotalCount int                `json:"totalCount"` // Matching documents before the limit was applied
+	Searched   int                `json:"searched"`   // Documents in the deal's index
+}
+
+// SearchIndex keeps a full-text index of each deal's documents. The router
+// adds documents as they are filed; a deal indexed for the first time is
+// built from its folders when it is first searched.
+type SearchIndex struct {
+	folderManager     *FolderManager
+	documentProcessor *DocumentProcessor
+	mu                sync.Mutex
+	deals             map[string]*dealSearchIndex
+}
+
+// NewSearchIndex creates a search index over the deals of folderManager
+func NewSearchIndex(folderManager *FolderManager, documentProcessor *DocumentProcessor) *SearchIndex {
+	return &SearchIndex{
+		folderManager:     folderManager,
+		documentProcessor: documentProcessor,
+		deals:             make(map[string]*dealSearchIndex),
+	}
+}
+
+// SetDocumentProcessor sets the processor text is extracted with
+func (si *SearchIndex) SetDocumentProcessor(documentProcessor *DocumentProcessor) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	si.documentProcessor = documentProcessor
+}
+
+// dealSearchIndexPath returns where a deal's search index is stored
+func dealSearchIndexPath(dealPath string) string {
+	return filepath.Join(dealPath, ".dealdone", "search_index.json")
+}
+
+// dealIndex returns a deal's index, loading it on first use. The caller
+// holds si.mu.
+func (si *SearchIndex) dealIndex(dealName string) (*dealSearchIndex, error) {
+	if ix, ok := si.deals[dealName]; ok {
+		return ix, nil
+	}
+	ix, err := loadDealSearchIndex(dealSearchIndexPath(si.folderManager.GetDealPath(dealName)), dealName)
+	if err != nil {
+		return nil, err
+	}
+	si.deals[dealName] = ix
+	return ix, nil
+}
+
+// IndexDocument adds or refreshes a document of a deal. Unchanged documents
+// are not extracted again.
+func (si *SearchIndex) IndexDocument(dealName, path string, docType DocumentType) error {
+	dealPath := si.folderManager.GetDealPath(dealName)
+	rel, err := dealRelativePath(dealPath, path)
+	if err != nil {
+		return err
+	}
+	checksum, err := fileChecksum(path)
+	if err != nil {
+		return fmt.Errorf("failed to hash document: %w", err)
+	}
+
+	si.mu.Lock()
+	ix, err := si.dealIndex(dealName)
+	if err != nil {
+		si.mu.Unlock()
+		return err
+	}
+	if existing := ix.Documents[rel]; existing != nil && existing.Checksum == checksum && existing.DocumentType == docType {
+		si.mu.Unlock()
+		return nil
+	}
+	dp := si.documentProcessor
+	si.mu.Unlock()
+
+	// Extraction can be slow, so searches are not held up while it runs
+	doc, err := extractIndexedDocument(dp, path, rel, docType, checksum)
+	if err != nil {
+		return err
+	}
+
+	si.mu.Lock()
+	defer si.mu.Unlock()
+	ix.put(doc)
+	return ix.save()
+}
+
+// Rebuild indexes every document in a deal's document folders, reusing the
+// text of documents that have not changed and dropping removed ones
+func (si *SearchIndex) Rebuild(dealName string) (*SearchIndexStatus, error) {
+	if !si.folderManager.DealExists(dealName) {
+		return nil, fmt.Errorf("deal not found: %s", dealName)
+	}
+	dealPath := si.folderManager.GetDealPath(dealName)
+	started := time.Now()
+
+	// The manifest knows how routed documents were classified
+	types := make(map[string]DocumentType)
+	if manifest, err := loadDealManifest(dealManifestPath(dealPath), dealName); err == nil {
+		for _, entry := range manifest.Entries {
+			if rel, err := dealRelativePath(dealPath, entry.CanonicalPath); err == nil {
+				types[rel] = entry.DocumentType
+			}
+		}
+	}
+
+	si.mu.Lock()
+	ix, err := si.dealIndex(dealName)
+	if err != nil {
+		si.mu.Unlock()
+		return nil, err
+	}
+	previous := make(map[string]*IndexedDocument, len(ix.Documents))
+	for rel, doc := range ix.Documents {
+		previous[rel] = doc
+	}
+	dp := si.documentProcessor
+	si.mu.Unlock()
+
+	documents := make(map[string]*IndexedDocument)
+	var skipped []string
+	for _, folder := range searchableFolders {
+		for _, path := range searchableFiles(filepath.Join(dealPath, folder)) {
+			rel, err := dealRelativePath(dealPath, path)
+			if err != nil {
+				continue
+			}
+			docType, ok := types[rel]
+			if !ok {
+				docType = DocumentType(folder)
+			}
+			checksum, err := fileChecksum(path)
+			if err != nil {
+				skipped = append(skipped, rel)
+				continue
+			}
+			if doc := previous[rel]; doc != nil && doc.Checksum == checksum {
+				reused := *doc
+				reused.DocumentType = docType
+				documents[rel] = &reused
+				continue
+			}
+			doc, err := extractIndexedDocument(dp, path, rel, docType, checksum)
+			if err != nil {
+				skipped = append(skipped, rel)
+				continue
+			}
+			documents[rel] = doc
+		}
+	}
+
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	// Keep documents the router indexed while the folders were being read
+	for rel, doc := range ix.Documents {
+		if _, ok := documents[rel]; !ok && doc.IndexedAt.After(started) {
+			documents[rel] = doc
+		}
+	}
+	ix.Documents = documents
+	ix.BuiltAt = time.Now()
+	ix.reindex()
+	if err := ix.save(); err != nil {
+		return nil, err
+	}
+
+	status := ix.status()
+	status.Skipped = skipped
+	return status, nil
+}
+
+// Search finds the documents of a deal matching query, best first. See
+// parseSearchQuery for the query syntax. A limit of zero returns at most
+// defaultSearchLimit hits.
+func (si *SearchIndex) Search(dealName, query string, limit int) (*ContentSearchResult, error) {
+	node, err := parseSearchQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	if !si.folderManager.DealExists(dealName) {
+		return nil, fmt.Errorf("deal not found: %s", dealName)
+	}
+
+	si.mu.Lock()
+	ix, err := si.dealIndex(dealName)
+	built := err == nil && !ix.BuiltAt.IsZero()
+	si.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if !built {
+		if _, err := si.Rebuild(dealName); err != nil {
+			return nil, err
+		}
+	}
+
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	dealPath := si.folderManager.GetDealPath(dealName)
+	matches := node.eval(ix)
+	hits := make([]ContentSearchHit, 0, len(matches))
+	docs := make(map[string]*IndexedDocument, len(matches))
+	spans := make(map[string][]searchSpan, len(matches))
+	for rel, match := range matches {
+		doc := ix.Documents[rel]
+		path := filepath.Join(dealPath, filepath.FromSlash(rel))
+		// Skip documents removed since they were indexed
+		if _, err := os.Stat(path); err != nil {
+			continue
+		}
+		docs[path] = doc
+		spans[path] = distinctSpans(match.hits)
+		hits = append(hits, ContentSearchHit{
+			Path:         path,
+			Folder:       doc.Folder,
+			Name:         doc.Name,
+			DocumentType: doc.DocumentType,
+			Modified:     doc.Modified,
+			Score:        match.score,
+			Matches:      len(spans[path]),
+		})
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].Path < hits[j].Path
+	})
+
+	result := &ContentSearchResult{
+		DealName:   dealName,
+		Query:      query,
+		TotalCount: len(hits),
+		Searched:   len(ix.Documents),
+	}
+	if limit <= 0 {
+		limit = defaultSearchLimit
+	}
+	if len(hits) > limit {
+		hits = hits[:limit]
+	}
+	for i := range hits {
+		hits[i].Snippets = buildSnippets(docs[hits[i].Path], spans[hits[i].Path])
+	}
+	result.Hits = hits
+	return result, nil
+}
+
+// Status describes a deal's search index without building it
+func (si *SearchIndex) Status(dealName string) (*SearchIndexStatus, error) {
+	si.mu.Lock()
+	defer si.mu.Unlock()
+
+	ix, err := si.dealIndex(dealName)
+	if err != nil {
+		return nil, err
+	}
+	return ix.status(), nil
+}
+
+// loadDealSearchIndex reads a deal's search index, returning an empty one if
+// none exists. An index that is unreadable or from an earlier version is
+// discarded and rebuilt on the next search.
+func loadDealSearchIndex(path, dealName string) (*dealSearchIndex, error) {
+	ix := &dealSearchIndex{path: path}
+	ix.DealName = dealName
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read search index: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &ix.searchIndexFile); err != nil {
+			fmt.Printf("Warning: Search index for %s is corrupt and will be rebuilt: %v\n", dealName, err)
+			ix.searchIndexFile = searchIndexFile{DealName: dealName}
+		} else if ix.Version != searchIndexVersion {
+			ix.searchIndexFile = searchIndexFile{DealName: dealName}
+		}
+	}
+
+	ix.Version = searchIndexVersion
+	if ix.Documents == nil {
+		ix.Documents = make(map[string]*IndexedDocument)
+	}
+	ix.reindex()
+	return ix, nil
+}
+
+// save writes the index durably
+func (ix *dealSearchIndex) save() error {
+	ix.UpdatedAt = time.Now()
+	data, err := json.Marshal(&ix.searchIndexFile)
+	if err != nil {
+		return fmt.Errorf("failed to marshal search index: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(ix.path), 0755); err != nil {
+		return fmt.Errorf("failed to create search index folder: %w", err)
+	}
+	return writeFileDurable(ix.path, data, 0644)
+}
+
+// reindex rebuilds the postings from the documents
+func (ix *dealSearchIndex) reindex() {
+	ix.postings = make(map[string]map[string][]int)
+	for _, doc := range ix.Documents {
+		ix.addPostings(doc)
+	}
+}
+
+// put adds a document, replacing any earlier text at its path
+func (ix *dealSearchIndex) put(doc *IndexedDocument) {
+	if previous := ix.Documents[doc.Path]; previous != nil {
+		for _, token := range documentTokens(previous) {
+			if docs := ix.postings[token.term]; docs != nil {
+				delete(docs, previous.Path)
+				if len(docs) == 0 {
+					delete(ix.postings, token.term)
+				}
+			}
+		}
+	}
+	ix.Documents[doc.Path] = doc
+	ix.addPostings(doc)
+}
+
+func (ix *dealSearchIndex) addPostings(doc *IndexedDocument) {
+	for position, token := range documentTokens(doc) {
+		docs := ix.postings[token.term]
+		if docs == nil {
+			docs = make(map[string][]int)
+			ix.postings[token.term] = docs
+		}
+		docs[doc.Path] = append(docs[doc.Path], position)
+	}
+}
+
+func (ix *dealSearchIndex) status() *SearchIndexStatus {
+	return &SearchIndexStatus{
+		DealName:  ix.DealName,
+		Documents: len(ix.Documents),
+		Terms:     len(ix.postings),
+		BuiltAt:   ix.BuiltAt,
+		UpdatedAt: ix.UpdatedAt,
+	}
+}
+
+// extractIndexedDocument extracts the text of a document for the index
+func extractIndexedDocument(dp *DocumentProcessor, path, rel string, docType DocumentType, checksum string) (*IndexedDocument, error) {
+	if dp == nil {
+		return nil, fmt.Errorf("document processor not initialized")
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat document: %w", err)
+	}
+	extraction, err := dp.ExtractPages(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract text from %s: %w", filepath.Base(path), err)
+	}
+
+	return &IndexedDocument{
+		Path:         rel,
+		Folder:       filepath.ToSlash(filepath.Dir(filepath.FromSlash(rel))),
+		Name:         filepath.Base(path),
+		DocumentType: docType,
+		Checksum:     checksum,
+		Modified:     info.ModTime(),
+		Pages:        extraction.Pages,
+		IndexedAt:    time.Now(),
+	}, nil
+}
+
+// dealRelativePath returns path relative to the deal folder with forward
+// slashes, or an error when path is outside it
+func dealRelativePath(dealPath, path string) (string, error) {
+	absDeal, err := filepath.Abs(dealPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve deal path: %w", err)
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve document path: %w", err)
+	}
+	rel, err := filepath.Rel(absDeal, absPath)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("%s is not in the deal folder", path)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// searchableFiles lists the files under dir, skipping hidden files and
+// folders
+func searchableFiles(dir string) []string {
+	var files []string
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if isHiddenFile(info.Name()) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.IsDir() {
+			files = append(files, path)
+		}
+		return nil
+	})
+	return files
+}
+
+// searchToken is a lowercased word of a document with its byte offsets in
+// the text of its page
+type searchToken struct {
+	term       string
+	page       int // Index into the document's pages
+	start, end int
+}
+
+// tokenizeText appends the words of text to tokens. Words are runs of
+// letters and digits.
+func tokenizeText(text string, page int, tokens []searchToken) []searchToken {
+	start := -1
+	for i, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			tokens = append(tokens, searchToken{term: strings.ToLower(text[start:i]), page: page, start: start, end: i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, searchToken{term: strings.ToLower(text[start:]), page: page, start: start, end: len(text)})
+	}
+	return tokens
+}
+
+// documentTokens returns the words of every page of a document. A word's
+// position is its index in the result.
+func documentTokens(doc *IndexedDocument) []searchToken {
+	var tokens []searchToken
+	for i, page := range doc.Pages {
+		tokens = tokenizeText(page.Text, i, tokens)
+	}
+	return tokens
+}
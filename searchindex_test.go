@@ -0,0 +1,147 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newSearchTestRouter(t *testing.T) (*DocumentRouter, *SearchIndex, *FolderManager, string) {
+	t.Helper()
+	tempDir := t.TempDir()
+	fm := NewFolderManager(&ConfigService{config: &Config{DealDoneRoot: filepath.Join(tempDir, "DealDone")}})
+	require.NoError(t, fm.InitializeFolderStructure())
+
+	dp := NewDocumentProcessor(nil)
+	dr := NewDocumentRouter(fm, dp)
+	si := NewSearchIndex(fm, dp)
+	dr.SetSearchIndex(si)
+	return dr, si, fm, tempDir
+}
+
+func writeSearchTestFile(t *testing.T, dir, name, content string) string {
+	t.Helper()
+	path := filepath.Join(dir, name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
+func hitNames(result *ContentSearchResult) []string {
+	var names []string
+	for _, hit := range result.Hits {
+		names = append(names, hit.Name)
+	}
+	return names
+}
+
+func TestSearchIndex_IndexesRoutedDocuments(t *testing.T) {
+	dr, si, fm, tempDir := newSearchTestRouter(t)
+
+	spa := writeSearchTestFile(t, tempDir, "purchase_agreement.txt", "A Change of Control of the Seller requires the Buyer's consent.")
+	budget := writeSearchTestFile(t, tempDir, "budget_2024.txt", "Revenue forecast. Control costs.")
+	for _, path := range []string{spa, budget} {
+		_, err := dr.RouteDocument(path, "Acme")
+		require.NoError(t, err)
+	}
+
+	result, err := si.Search("Acme", `"change of control"`, 0)
+	require.NoError(t, err)
+	require.Equal(t, []string{"purchase_agreement.txt"}, hitNames(result))
+	hit := result.Hits[0]
+	assert.Equal(t, "legal", hit.Folder)
+	assert.Equal(t, DocTypeLegal, hit.DocumentType)
+	assert.Equal(t, filepath.Join(fm.GetDealPath("Acme"), "legal", "purchase_agreement.txt"), hit.Path)
+	require.Len(t, hit.Snippets, 1)
+	assert.Equal(t, [][2]int{{2, 19}}, hit.Snippets[0].Highlights)
+	assert.Equal(t, 2, result.Searched)
+
+	result, err = si.Search("Acme", "control type:financial", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"budget_2024.txt"}, hitNames(result))
+
+	// A new version is indexed as it is routed
+	require.NoError(t, os.WriteFile(spa, []byte("Assignment requires consent. Change of control is not restricted."), 0644))
+	routed, err := dr.RouteDocument(spa, "Acme")
+	require.NoError(t, err)
+	assert.Equal(t, 2, routed.Version)
+
+	result, err = si.Search("Acme", "assignment", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"purchase_agreement_v2.txt"}, hitNames(result))
+
+	// The index is persisted with the deal and reloaded
+	reloaded := NewSearchIndex(fm, NewDocumentProcessor(nil))
+	result, err = reloaded.Search("Acme", `"change of control"`, 1)
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.TotalCount)
+	assert.Len(t, result.Hits, 1)
+
+	status, err := reloaded.Status("Acme")
+	require.NoError(t, err)
+	assert.Equal(t, 3, status.Documents)
+}
+
+func TestSearchIndex_BuildsDealsIndexedBeforeSearchExisted(t *testing.T) {
+	_, si, fm, _ := newSearchTestRouter(t)
+	_, err := fm.CreateDealFolder("Beta")
+	require.NoError(t, err)
+
+	legal := fm.GetDealSubfolderPath("Beta", "legal")
+	writeSearchTestFile(t, legal, "nda.txt", "Neither party may assign this agreement without consent.")
+	writeSearchTestFile(t, legal, "notes.xls", "legacy")
+	writeSearchTestFile(t, fm.GetDealSubfolderPath("Beta", "analysis"), "summary.txt", "consent")
+
+	result, err := si.Search("Beta", "consent", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"nda.txt"}, hitNames(result), "only document folders are searched")
+
+	// Removed documents drop out of results and out of the index on rebuild
+	require.NoError(t, os.Remove(filepath.Join(legal, "nda.txt")))
+	result, err = si.Search("Beta", "consent", 0)
+	require.NoError(t, err)
+	assert.Empty(t, result.Hits)
+
+	status, err := si.Rebuild("Beta")
+	require.NoError(t, err)
+	assert.Equal(t, 0, status.Documents)
+	assert.Equal(t, []string{"legal/notes.xls"}, status.Skipped)
+
+	_, err = si.Search("Missing", "consent", 0)
+	assert.Error(t, err)
+}
+
+func TestHandleContentSearch(t *testing.T) {
+	app, _ := newPolicyTestApp(t, nil)
+	dr, si, _, tempDir := newSearchTestRouter(t)
+	app.documentRouter = dr
+	app.searchIndex = si
+
+	_, err := dr.RouteDocument(writeSearchTestFile(t, tempDir, "supply_contract.txt", "Termination on change of control."), "Acme")
+	require.NoError(t, err)
+
+	reader := generateTestKey(t, app, &KeyGenerationRequest{Permissions: []string{ScopeReadDocuments}, AllowedDeals: []string{"Acme"}})
+	server := app.createAuthenticatedWebhookServer(&WebhookServerConfig{Port: 0})
+	call := func(target string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		req.Header.Set("X-API-Key", reader)
+		w := httptest.NewRecorder()
+		server.Handler.ServeHTTP(w, req)
+		return w
+	}
+
+	w := call(`/api/v1/search?dealName=Acme&q=%22change+of+control%22`)
+	require.Equal(t, http.StatusOK, w.Code, w.Body.String())
+	var result ContentSearchResult
+	require.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.Equal(t, []string{"supply_contract.txt"}, hitNames(&result))
+
+	assert.Equal(t, http.StatusBadRequest, call("/api/v1/search?dealName=Acme&q=%28control").Code)
+	assert.Equal(t, http.StatusBadRequest, call("/api/v1/search?dealName=Acme&q=control&limit=-1").Code)
+	assert.Equal(t, http.StatusForbidden, call("/api/v1/search?dealName=Beta&q=control").Code)
+}
@@ -0,0 +1,658 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	maxSnippets     = 3
+	maxSnippetWords = 40
+	snippetContext  = 8 // Words shown either side of a match
+)
+
+// searchFields are the fields a query can filter documents by
+var searchFields = map[string]bool{"type": true, "folder": true, "date": true}
+
+// searchSpan is a run of words matching a query, by position and length
+type searchSpan struct {
+	pos, length int
+}
+
+// docMatch is how a document matched a query
+type docMatch struct {
+	score float64
+	hits  []searchSpan
+}
+
+func (m *docMatch) merge(other *docMatch) {
+	m.score += other.score
+	m.hits = append(m.hits, other.hits...)
+}
+
+// queryNode is a parsed search query, evaluated to the matching documents
+// keyed by path
+type queryNode interface {
+	eval(ix *dealSearchIndex) map[string]*docMatch
+}
+
+// termNode matches a word, or with prefix every word starting with it
+type termNode struct {
+	term   string
+	prefix bool
+}
+
+func (n termNode) eval(ix *dealSearchIndex) map[string]*docMatch {
+	terms := []string{n.term}
+	if n.prefix {
+		terms = terms[:0]
+		for term := range ix.postings {
+			if strings.HasPrefix(term, n.term) {
+				terms = append(terms, term)
+			}
+		}
+	}
+
+	matches := make(map[string]*docMatch)
+	for _, term := range terms {
+		docs := ix.postings[term]
+		idf := ix.idf(len(docs))
+		for path, positions := range docs {
+			match := &docMatch{score: termScore(len(positions), idf)}
+			for _, pos := range positions {
+				match.hits = append(match.hits, searchSpan{pos: pos, length: 1})
+			}
+			if existing := matches[path]; existing != nil {
+				existing.merge(match)
+			} else {
+				matches[path] = match
+			}
+		}
+	}
+	return matches
+}
+
+// phraseNode matches consecutive words
+type phraseNode struct {
+	terms []string
+}
+
+func (n phraseNode) eval(ix *dealSearchIndex) map[string]*docMatch {
+	matches := make(map[string]*docMatch)
+	for path, positions := range ix.postings[n.terms[0]] {
+		var hits []searchSpan
+		for _, pos := range positions {
+			if ix.hasPhraseAt(path, n.terms, pos) {
+				hits = append(hits, searchSpan{pos: pos, length: len(n.terms)})
+			}
+		}
+		if len(hits) > 0 {
+			matches[path] = &docMatch{hits: hits}
+		}
+	}
+
+	// Phrases outrank their words appearing apart
+	idf := ix.idf(len(matches))
+	for _, match := range matches {
+		match.score = termScore(len(match.hits), idf) * float64(len(n.terms))
+	}
+	return matches
+}
+
+// filterNode matches documents by their metadata
+type filterNode struct {
+	match func(doc *IndexedDocument) bool
+}
+
+func (n filterNode) eval(ix *dealSearchIndex) map[string]*docMatch {
+	matches := make(map[string]*docMatch)
+	for path, doc := range ix.Documents {
+		if n.match(doc) {
+			matches[path] = &docMatch{}
+		}
+	}
+	return matches
+}
+
+// andNode matches documents matching every child. Negated children only
+// exclude documents.
+type andNode struct {
+	children []queryNode
+}
+
+func (n andNode) eval(ix *dealSearchIndex) map[string]*docMatch {
+	var matches map[string]*docMatch
+	var excluded []map[string]*docMatch
+	for _, child := range n.children {
+		if not, ok := child.(notNode); ok {
+			excluded = append(excluded, not.child.eval(ix))
+			continue
+		}
+		childMatches := child.eval(ix)
+		if matches == nil {
+			matches = childMatches
+			continue
+		}
+		for path, match := range matches {
+			if other, ok := childMatches[path]; ok {
+				match.merge(other)
+			} else {
+				delete(matches, path)
+			}
+		}
+	}
+
+	if matches == nil {
+		matches = allDocuments(ix)
+	}
+	for _, exclude := range excluded {
+		for path := range exclude {
+			delete(matches, path)
+		}
+	}
+	return matches
+}
+
+// orNode matches documents matching any child
+type orNode struct {
+	children []queryNode
+}
+
+func (n orNode) eval(ix *dealSearchIndex) map[string]*docMatch {
+	matches := make(map[string]*docMatch)
+	for _, child := range n.children {
+		for path, match := range child.eval(ix) {
+			if existing := matches[path]; existing != nil {
+				existing.merge(match)
+			} else {
+				matches[path] = match
+			}
+		}
+	}
+	return matches
+}
+
+// notNode matches documents not matching its child
+type notNode struct {
+	child queryNode
+}
+
+func (n notNode) eval(ix *dealSearchIndex) map[string]*docMatch {
+	matches := allDocuments(ix)
+	for path := range n.child.eval(ix) {
+		delete(matches, path)
+	}
+	return matches
+}
+
+func allDocuments(ix *dealSearchIndex) map[string]*docMatch {
+	matches := make(map[string]*docMatch, len(ix.Documents))
+	for path := range ix.Documents {
+		matches[path] = &docMatch{}
+	}
+	return matches
+}
+
+// hasPhraseAt reports whether terms occur consecutively in a document from
+// position pos
+func (ix *dealSearchIndex) hasPhraseAt(path string, terms []string, pos int) bool {
+	for i, term := range terms[1:] {
+		positions := ix.postings[term][path]
+		want := pos + i + 1
+		if j := sort.SearchInts(positions, want); j == len(positions) || positions[j] != want {
+			return false
+		}
+	}
+	return true
+}
+
+// idf weighs a term by how few of the deal's documents contain it
+func (ix *dealSearchIndex) idf(documentFrequency int) float64 {
+	if documentFrequency == 0 {
+		return 0
+	}
+	return math.Log(1 + float64(len(ix.Documents))/float64(documentFrequency))
+}
+
+// termScore dampens repeated occurrences so one long document does not
+// crowd out the rest
+func termScore(occurrences int, idf float64) float64 {
+	return (1 + math.Log(float64(occurrences))) * idf
+}
+
+// parseSearchQuery parses a content search query:
+//
+//	change of control         every word, anywhere in the document
+//	"change of control"       the words in order
+//	indemnif*                 any word starting with indemnif
+//	consent OR waiver         either
+//	NOT draft, -draft         excludes documents containing draft
+//	(a OR b) c                parentheses group
+//	type:legal                document type
+//	folder:legal/contracts    deal subfolder, including the folders below it
+//	date:2024-03              modified within a day, month or year
+//	date:>=2024-01-01         also >, < and <=
+//	date:2024-01..2024-06     an inclusive range, open if a side is left empty
+//
+// Operators must be written in capitals; lowercase and, or and not are
+// searched for as words.
+func parseSearchQuery(query string) (queryNode, error) {
+	items := lexSearchQuery(query)
+	if len(items) == 0 {
+		return nil, fmt.Errorf("search query is empty")
+	}
+
+	p := &queryParser{items: items}
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.items) {
+		return nil, fmt.Errorf("unexpected %s in search query", p.items[p.pos])
+	}
+	return node, nil
+}
+
+type queryItemKind int
+
+const (
+	itemWord queryItemKind = iota
+	itemPhrase
+	itemField
+	itemOpen
+	itemClose
+	itemAnd
+	itemOr
+	itemNot
+)
+
+type queryItem struct {
+	kind  queryItemKind
+	field string
+	text  string
+}
+
+func (i queryItem) String() string {
+	switch i.kind {
+	case itemOpen:
+		return `"("`
+	case itemClose:
+		return `")"`
+	case itemAnd, itemOr, itemNot:
+		return i.text
+	}
+	return fmt.Sprintf("%q", i.text)
+}
+
+// lexSearchQuery splits a query into words, phrases, field filters,
+// parentheses and operators. An unterminated quote runs to the end.
+func lexSearchQuery(query string) []queryItem {
+	var items []queryItem
+	runes := []rune(query)
+	readQuoted := func(i int) (string, int) {
+		end := i + 1
+		for end < len(runes) && runes[end] != '"' {
+			end++
+		}
+		return string(runes[i+1 : min(end, len(runes))]), min(end+1, len(runes))
+	}
+
+	for i := 0; i < len(runes); {
+		r := runes[i]
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			items = append(items, queryItem{kind: itemOpen})
+			i++
+		case r == ')':
+			items = append(items, queryItem{kind: itemClose})
+			i++
+		case r == '"':
+			var text string
+			text, i = readQuoted(i)
+			items = append(items, queryItem{kind: itemPhrase, text: text})
+		case r == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]):
+			items = append(items, queryItem{kind: itemNot, text: "-"})
+			i++
+		default:
+			end := i
+			for end < len(runes) && !unicode.IsSpace(runes[end]) && !strings.ContainsRune(`()"`, runes[end]) {
+				end++
+			}
+			word := string(runes[i:end])
+			i = end
+
+			switch word {
+			case "AND":
+				items = append(items, queryItem{kind: itemAnd, text: word})
+				continue
+			case "OR":
+				items = append(items, queryItem{kind: itemOr, text: word})
+				continue
+			case "NOT":
+				items = append(items, queryItem{kind: itemNot, text: word})
+				continue
+			}
+
+			if field, value, ok := strings.Cut(word, ":"); ok && searchFields[strings.ToLower(field)] {
+				if value == "" && i < len(runes) && runes[i] == '"' {
+					value, i = readQuoted(i)
+				}
+				items = append(items, queryItem{kind: itemField, field: strings.ToLower(field), text: value})
+				continue
+			}
+			items = append(items, queryItem{kind: itemWord, text: word})
+		}
+	}
+	return items
+}
+
+// queryParser parses query items by recursive descent. OR binds loosest,
+// then AND, which is implied between adjacent terms, then NOT.
+type queryParser struct {
+	items []queryItem
+	pos   int
+}
+
+func (p *queryParser) accept(kind queryItemKind) bool {
+	if p.pos < len(p.items) && p.items[p.pos].kind == kind {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	var alternatives []queryNode
+	for {
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		alternatives = append(alternatives, node)
+		if !p.accept(itemOr) {
+			break
+		}
+	}
+	if len(alternatives) == 1 {
+		return alternatives[0], nil
+	}
+	return orNode{children: alternatives}, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	var children []queryNode
+	for p.pos < len(p.items) {
+		kind := p.items[p.pos].kind
+		if kind == itemOr || kind == itemClose {
+			break
+		}
+		if p.accept(itemAnd) {
+			continue
+		}
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		children = append(children, node)
+	}
+
+	switch len(children) {
+	case 0:
+		if p.pos < len(p.items) {
+			return nil, fmt.Errorf("expected a search term before %s", p.items[p.pos])
+		}
+		return nil, fmt.Errorf("expected a search term at the end of the query")
+	case 1:
+		return children[0], nil
+	}
+	return andNode{children: children}, nil
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	if p.accept(itemNot) {
+		if p.pos == len(p.items) {
+			return nil, fmt.Errorf("expected a search term after NOT")
+		}
+		child, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{child: child}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	item := p.items[p.pos]
+	p.pos++
+
+	switch item.kind {
+	case itemOpen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if !p.accept(itemClose) {
+			return nil, fmt.Errorf("missing closing parenthesis in search query")
+		}
+		return node, nil
+	case itemField:
+		return fieldFilter(item.field, item.text)
+	case itemWord:
+		prefix := strings.HasSuffix(item.text, "*")
+		terms := queryTerms(strings.TrimRight(item.text, "*"))
+		if prefix && len(terms) == 1 {
+			return termNode{term: terms[0], prefix: true}, nil
+		}
+		return wordsNode(item.text, terms)
+	case itemPhrase:
+		return wordsNode(item.text, queryTerms(item.text))
+	}
+	return nil, fmt.Errorf("unexpected %s in search query", item)
+}
+
+// wordsNode matches the words text was split into: one word by itself, or
+// several as a phrase, as "change-of-control" is
+func wordsNode(text string, terms []string) (queryNode, error) {
+	switch len(terms) {
+	case 0:
+		return nil, fmt.Errorf("%q has no words to search for", text)
+	case 1:
+		return termNode{term: terms[0]}, nil
+	}
+	return phraseNode{terms: terms}, nil
+}
+
+// queryTerms splits query text into words the way documents are split
+func queryTerms(text string) []string {
+	var terms []string
+	for _, token := range tokenizeText(text, 0, nil) {
+		terms = append(terms, token.term)
+	}
+	return terms
+}
+
+// fieldFilter builds the filter for a field:value term
+func fieldFilter(field, value string) (queryNode, error) {
+	if value == "" {
+		return nil, fmt.Errorf("%s: needs a value", field)
+	}
+
+	switch field {
+	case "type":
+		return filterNode{match: func(doc *IndexedDocument) bool {
+			return strings.EqualFold(string(doc.DocumentType), value)
+		}}, nil
+	case "folder":
+		folder := strings.ToLower(strings.Trim(filepath.ToSlash(value), "/"))
+		return filterNode{match: func(doc *IndexedDocument) bool {
+			docFolder := strings.ToLower(doc.Folder)
+			return docFolder == folder || strings.HasPrefix(docFolder, folder+"/")
+		}}, nil
+	default:
+		from, to, err := parseDateFilter(value)
+		if err != nil {
+			return nil, err
+		}
+		return filterNode{match: func(doc *IndexedDocument) bool {
+			return (from.IsZero() || !doc.Modified.Before(from)) && (to.IsZero() || doc.Modified.Before(to))
+		}}, nil
+	}
+}
+
+// parseDateFilter turns the value of a date: filter into the period
+// [from, to) it covers. A zero bound leaves that side open.
+func parseDateFilter(value string) (from, to time.Time, err error) {
+	switch {
+	case strings.Contains(value, ".."):
+		start, end, _ := strings.Cut(value, "..")
+		if start != "" {
+			from, _, err = datePeriod(start)
+		}
+		if end != "" && err == nil {
+			_, to, err = datePeriod(end)
+		}
+	case strings.HasPrefix(value, ">="):
+		from, _, err = datePeriod(value[2:])
+	case strings.HasPrefix(value, "<="):
+		_, to, err = datePeriod(value[2:])
+	case strings.HasPrefix(value, ">"):
+		_, from, err = datePeriod(value[1:])
+	case strings.HasPrefix(value, "<"):
+		to, _, err = datePeriod(value[1:])
+	default:
+		from, to, err = datePeriod(value)
+	}
+	return from, to, err
+}
+
+// datePeriod returns the day, month or year a date names in local time
+func datePeriod(value string) (start, end time.Time, err error) {
+	layouts := []struct {
+		layout string
+		next   func(time.Time) time.Time
+	}{
+		{"2006-01-02", func(t time.Time) time.Time { return t.AddDate(0, 0, 1) }},
+		{"2006-01", func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }},
+		{"2006", func(t time.Time) time.Time { return t.AddDate(1, 0, 0) }},
+	}
+	for _, l := range layouts {
+		if start, err := time.ParseInLocation(l.layout, value, time.Local); err == nil {
+			return start, l.next(start), nil
+		}
+	}
+	return time.Time{}, time.Time{}, fmt.Errorf("invalid date %q: use YYYY-MM-DD, YYYY-MM or YYYY", value)
+}
+
+// distinctSpans sorts spans and drops those overlapping an earlier one
+func distinctSpans(spans []searchSpan) []searchSpan {
+	sort.Slice(spans, func(i, j int) bool {
+		if spans[i].pos != spans[j].pos {
+			return spans[i].pos < spans[j].pos
+		}
+		return spans[i].length > spans[j].length
+	})
+
+	distinct := spans[:0]
+	end := -1
+	for _, span := range spans {
+		if span.pos > end {
+			distinct = append(distinct, span)
+			end = span.pos + span.length - 1
+		}
+	}
+	return distinct
+}
+
+// buildSnippets returns passages around the first matches in a document.
+// Matches close together share a passage, which never crosses a page.
+func buildSnippets(doc *IndexedDocument, spans []searchSpan) []SearchSnippet {
+	snippets := []SearchSnippet{}
+	if len(spans) == 0 {
+		return snippets
+	}
+
+	tokens := documentTokens(doc)
+	for i := 0; i < len(spans) && len(snippets) < maxSnippets; {
+		first := spans[i]
+		page := tokens[first.pos].page
+
+		from := max(first.pos-snippetContext, 0)
+		for tokens[from].page != page {
+			from++
+		}
+		limit := min(from+maxSnippetWords-1, len(tokens)-1)
+		for tokens[limit].page != page {
+			limit--
+		}
+		to := min(first.pos+first.length-1+snippetContext, limit)
+
+		// Later matches within reach extend the passage up to its limit
+		window := []searchSpan{first}
+		for i++; i < len(spans) && spans[i].pos <= to; i++ {
+			end := spans[i].pos + spans[i].length - 1
+			if end > limit {
+				to = spans[i].pos - 1
+				break
+			}
+			window = append(window, spans[i])
+			to = min(max(to, end+snippetContext), limit)
+		}
+		snippets = append(snippets, renderSnippet(doc.Pages[page], tokens, from, to, window))
+	}
+	return snippets
+}
+
+// renderSnippet writes the words from through to of a page with runs of
+// whitespace collapsed, marking where each span falls in the text
+func renderSnippet(page ExtractedPage, tokens []searchToken, from, to int, spans []searchSpan) SearchSnippet {
+	var b strings.Builder
+	length := 0
+	lastSpace := false
+	write := func(s string) {
+		for _, r := range s {
+			if unicode.IsSpace(r) {
+				if lastSpace {
+					continue
+				}
+				r = ' '
+				lastSpace = true
+			} else {
+				lastSpace = false
+			}
+			b.WriteRune(r)
+			length++
+		}
+	}
+
+	snippet := SearchSnippet{Page: page.Number, Label: page.Label, Highlights: [][2]int{}}
+	pageIndex := tokens[from].page
+	if from > 0 && tokens[from-1].page == pageIndex {
+		write("… ")
+	}
+
+	offset := tokens[from].start
+	for _, span := range spans {
+		last := min(span.pos+span.length-1, to)
+		start, end := tokens[span.pos].start, tokens[last].end
+		write(page.Text[offset:start])
+		highlight := length
+		write(page.Text[start:end])
+		snippet.Highlights = append(snippet.Highlights, [2]int{highlight, length})
+		offset = end
+	}
+	write(page.Text[offset:tokens[to].end])
+	if to < len(tokens)-1 && tokens[to+1].page == pageIndex {
+		write(" …")
+	}
+
+	snippet.Text = b.String()
+	return snippet
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestSearchIndex indexes documents given as page texts keyed by path
+func newTestSearchIndex(docs map[string][]string) *dealSearchIndex {
+	ix := &dealSearchIndex{}
+	ix.Documents = make(map[string]*IndexedDocument)
+	ix.reindex()
+	for path, pages := range docs {
+		doc := &IndexedDocument{Path: path, Folder: "legal", DocumentType: DocTypeLegal, Modified: time.Date(2024, 3, 15, 12, 0, 0, 0, time.Local)}
+		for i, text := range pages {
+			doc.Pages = append(doc.Pages, ExtractedPage{Number: i + 1, Text: text})
+		}
+		ix.put(doc)
+	}
+	return ix
+}
+
+func searchPaths(t *testing.T, ix *dealSearchIndex, query string) []string {
+	t.Helper()
+	node, err := parseSearchQuery(query)
+	require.NoError(t, err, query)
+	var paths []string
+	for path := range node.eval(ix) {
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func TestParseSearchQuery_Boolean(t *testing.T) {
+	ix := newTestSearchIndex(map[string][]string{
+		"spa.txt":     {"Upon a Change of Control the Buyer may terminate."},
+		"nda.txt":     {"Control of the information remains with the owner. No change is permitted."},
+		"lease.txt":   {"The landlord's consent is required for any assignment."},
+		"draft.txt":   {"DRAFT: change of control provisions to follow."},
+		"license.txt": {"Licensor may waive the change-of-control restriction."},
+	})
+
+	assert.ElementsMatch(t, []string{"spa.txt", "nda.txt", "draft.txt", "license.txt"}, searchPaths(t, ix, "change control"))
+	assert.ElementsMatch(t, []string{"spa.txt", "draft.txt", "license.txt"}, searchPaths(t, ix, `"change of control"`))
+	assert.ElementsMatch(t, []string{"spa.txt", "draft.txt", "license.txt"}, searchPaths(t, ix, "change-of-control"))
+	assert.ElementsMatch(t, []string{"spa.txt", "license.txt"}, searchPaths(t, ix, `"change of control" -draft`))
+	assert.ElementsMatch(t, []string{"spa.txt", "license.txt"}, searchPaths(t, ix, `"change of control" AND NOT draft`))
+	assert.ElementsMatch(t, []string{"lease.txt", "license.txt"}, searchPaths(t, ix, "consent OR waive"))
+	assert.ElementsMatch(t, []string{"lease.txt", "spa.txt"}, searchPaths(t, ix, "(consent OR terminate) NOT draft"))
+	assert.ElementsMatch(t, []string{"spa.txt"}, searchPaths(t, ix, "termin*"))
+	assert.ElementsMatch(t, []string{"nda.txt", "lease.txt"}, searchPaths(t, ix, `NOT "change of control"`))
+
+	// Lowercase operators are words
+	assert.Empty(t, searchPaths(t, ix, "consent or waive"))
+}
+
+func TestParseSearchQuery_Filters(t *testing.T) {
+	ix := newTestSearchIndex(map[string][]string{
+		"legal/spa.txt":              {"change of control"},
+		"financial/model.txt":        {"change of control"},
+		"legal/contracts/supply.txt": {"change of control"},
+	})
+	ix.Documents["financial/model.txt"].Folder = "financial"
+	ix.Documents["financial/model.txt"].DocumentType = DocTypeFinancial
+	ix.Documents["financial/model.txt"].Modified = time.Date(2023, 12, 31, 9, 0, 0, 0, time.Local)
+	ix.Documents["legal/contracts/supply.txt"].Folder = "legal/contracts"
+
+	assert.ElementsMatch(t, []string{"legal/spa.txt", "legal/contracts/supply.txt"}, searchPaths(t, ix, "control type:legal"))
+	assert.ElementsMatch(t, []string{"legal/contracts/supply.txt"}, searchPaths(t, ix, `folder:"legal/contracts"`))
+	assert.ElementsMatch(t, []string{"legal/spa.txt", "legal/contracts/supply.txt"}, searchPaths(t, ix, "folder:Legal"))
+	assert.ElementsMatch(t, []string{"financial/model.txt"}, searchPaths(t, ix, "date:2023"))
+	assert.ElementsMatch(t, []string{"financial/model.txt"}, searchPaths(t, ix, "date:<2024-01-01"))
+	assert.ElementsMatch(t, []string{"legal/spa.txt", "legal/contracts/supply.txt"}, searchPaths(t, ix, "date:>2023-12-31"))
+	assert.ElementsMatch(t, []string{"legal/spa.txt", "legal/contracts/supply.txt", "financial/model.txt"}, searchPaths(t, ix, "date:2023-12..2024-03"))
+	assert.ElementsMatch(t, []string{"financial/model.txt"}, searchPaths(t, ix, "-type:legal"))
+}
+
+func TestParseSearchQuery_Errors(t *testing.T) {
+	for _, query := range []string{"", "   ", "(control", "control)", "OR control", "control NOT", "date:last-week", "type:", "&"} {
+		_, err := parseSearchQuery(query)
+		assert.Error(t, err, query)
+	}
+}
+
+func TestParseDateFilter(t *testing.T) {
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.Local) }
+
+	from, to, err := parseDateFilter("2024-02")
+	require.NoError(t, err)
+	assert.Equal(t, day(2024, 2, 1), from)
+	assert.Equal(t, day(2024, 3, 1), to)
+
+	from, to, err = parseDateFilter("..2024-06-30")
+	require.NoError(t, err)
+	assert.True(t, from.IsZero())
+	assert.Equal(t, day(2024, 7, 1), to)
+
+	from, to, err = parseDateFilter(">=2024")
+	require.NoError(t, err)
+	assert.Equal(t, day(2024, 1, 1), from)
+	assert.True(t, to.IsZero())
+}
+
+func TestBuildSnippets(t *testing.T) {
+	ix := newTestSearchIndex(map[string][]string{
+		"spa.txt": {
+			"Cover page",
+			"Section 9.2   Change of\n  Control. If the Company undergoes a change of control, the Buyer may terminate this Agreement by notice in writing within thirty days of closing.",
+		},
+	})
+	node, err := parseSearchQuery(`"change of control"`)
+	require.NoError(t, err)
+	match := node.eval(ix)["spa.txt"]
+	require.NotNil(t, match)
+
+	snippets := buildSnippets(ix.Documents["spa.txt"], distinctSpans(match.hits))
+	require.Len(t, snippets, 1, "nearby matches share a passage")
+	snippet := snippets[0]
+	assert.Equal(t, 2, snippet.Page)
+	assert.Equal(t, "Section 9.2 Change of Control. If the Company undergoes a change of control, the Buyer may terminate this Agreement by notice …", snippet.Text)
+	require.Len(t, snippet.Highlights, 2)
+
+	runes := []rune(snippet.Text)
+	for _, h := range snippet.Highlights {
+		assert.Equal(t, "change of control", strings.ToLower(string(runes[h[0]:h[1]])))
+	}
+}
@@ -0,0 +1,598 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"DealDone/store"
+)
+
+// Buckets of the state store. Lists are kept as one row per item with
+// their order under the list's name in bucketState.
+const (
+	bucketState               = "state"
+	bucketJobs                = "jobs"
+	bucketQueueItems          = "queue_items"
+	bucketQueueFolders        = "queue_folders"
+	bucketQueueHistory        = "queue_history"
+	bucketConflictHistory     = "conflict_history"
+	bucketConflictAudit       = "conflict_audit"
+	bucketCorrections         = "corrections"
+	bucketFeedback            = "feedback"
+	bucketFeedbackProfiles    = "feedback_profiles"
+	bucketFeedbackAdjustments = "feedback_adjustments"
+	bucketWorkflowExecutions  = "workflow_executions"
+	bucketWorkflowHistory     = "workflow_history"
+	bucketAPIKeys             = "api_keys"
+)
+
+// stateMigrations upgrade the state store schema. Append new versions; never
+// edit one that has shipped.
+var stateMigrations = []store.Migration{
+	{Version: 1, Description: "component state buckets"},
+}
+
+// StateStore persists the state of the queue, job tracker, conflict
+// resolver, correction processor, feedback loop, workflow recovery and API
+// keys in one embedded transactional store. It implements the repository
+// interface of each of them.
+type StateStore struct {
+	db *store.DB
+}
+
+// stateStores shares one open store per directory so components opened on
+// the same directory see one another's writes
+var stateStores = struct {
+	sync.Mutex
+	open map[string]*StateStore
+}{open: make(map[string]*StateStore)}
+
+// stateStorePath returns where the app keeps its state store
+func stateStorePath(root string) string {
+	return filepath.Join(root, ".dealdone", "state")
+}
+
+// OpenStateStore opens the state store in dir and brings its schema up to
+// date. Stores stay open for the life of the process.
+func OpenStateStore(dir string) (*StateStore, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve state store path: %w", err)
+	}
+
+	stateStores.Lock()
+	defer stateStores.Unlock()
+
+	if s, ok := stateStores.open[dir]; ok {
+		return s, nil
+	}
+	db, err := store.Open(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state store: %w", err)
+	}
+	if err := db.Migrate(stateMigrations); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to migrate state store: %w", err)
+	}
+
+	s := &StateStore{db: db}
+	stateStores.open[dir] = s
+	return s, nil
+}
+
+// NewMemoryStateStore returns a state store that is not persisted
+func NewMemoryStateStore() *StateStore {
+	db := store.OpenMemory()
+	db.Migrate(stateMigrations)
+	return &StateStore{db: db}
+}
+
+// openComponentStore opens the state store a component keeps in its own
+// storage directory. The component runs without persistence when the store
+// cannot be opened.
+func openComponentStore(dir string) *StateStore {
+	if dir == "" {
+		return NewMemoryStateStore()
+	}
+	s, err := OpenStateStore(filepath.Join(dir, "state"))
+	if err != nil {
+		fmt.Printf("Warning: State in %s will not persist: %v\n", dir, err)
+		return NewMemoryStateStore()
+	}
+	return s
+}
+
+// ImportLegacyState moves the JSON state files written by earlier versions
+// under root into the store
+func (s *StateStore) ImportLegacyState(root string) error {
+	data := filepath.Join(root, "data")
+	imports := []error{
+		s.importLegacyJobs(filepath.Join(root, ".dealdone", "job_tracker.json")),
+		s.importLegacyQueue(filepath.Join(data, "queue_state.json")),
+		s.importLegacyConflicts(filepath.Join(data, "conflicts")),
+		s.importLegacyCorrections(filepath.Join(data, "corrections", "correction_processor_state.json")),
+		s.importLegacyFeedback(filepath.Join(data, "feedback", "feedback_state.json")),
+		s.importLegacyWorkflows(filepath.Join(data, "workflow_recovery", "workflow_recovery_state.json")),
+		s.importLegacyAPIKeys(filepath.Join(root, "config", "auth_keys.json")),
+	}
+	for _, err := range imports {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// importLegacyFile passes a legacy state file to load once. The file is
+// renamed to .imported afterwards, or to .corrupt when it cannot be read.
+func importLegacyFile(path string, load func(data []byte) error) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read %s: %w", filepath.Base(path), err)
+	}
+
+	if len(data) > 0 {
+		if err := load(data); err != nil {
+			os.Rename(path, path+".corrupt")
+			return fmt.Errorf("failed to import %s: %w", filepath.Base(path), err)
+		}
+	}
+	if err := os.Rename(path, path+".imported"); err != nil {
+		return fmt.Errorf("failed to retire %s: %w", filepath.Base(path), err)
+	}
+	return nil
+}
+
+// putJSON stores value under key
+func putJSON(tx *store.Tx, bucket, key string, value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s/%s: %w", bucket, key, err)
+	}
+	return tx.Put(bucket, key, data)
+}
+
+// getJSON loads the value under key into value, reporting whether it exists
+func getJSON(tx *store.Tx, bucket, key string, value interface{}) (bool, error) {
+	data, ok := tx.Get(bucket, key)
+	if !ok {
+		return false, nil
+	}
+	if err := json.Unmarshal(data, value); err != nil {
+		return false, fmt.Errorf("failed to parse %s/%s: %w", bucket, key, err)
+	}
+	return true, nil
+}
+
+// syncBucket makes bucket hold exactly rows. Unchanged rows are not
+// rewritten, so a save only logs what changed.
+func syncBucket[T any](tx *store.Tx, bucket string, rows map[string]T) error {
+	for _, key := range tx.Keys(bucket) {
+		if _, ok := rows[key]; !ok {
+			if err := tx.Delete(bucket, key); err != nil {
+				return err
+			}
+		}
+	}
+	for key, row := range rows {
+		if err := putJSON(tx, bucket, key, row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func loadBucket[T any](tx *store.Tx, bucket string) (map[string]T, error) {
+	rows := make(map[string]T)
+	err := tx.ForEach(bucket, func(key string, data []byte) error {
+		var row T
+		if err := json.Unmarshal(data, &row); err != nil {
+			return fmt.Errorf("failed to parse %s/%s: %w", bucket, key, err)
+		}
+		rows[key] = row
+		return nil
+	})
+	return rows, err
+}
+
+// saveList stores items as rows keyed by id, keeping their order
+func saveList[T any](tx *store.Tx, bucket string, items []T, id func(T) string) error {
+	rows := make(map[string]T, len(items))
+	order := make([]string, 0, len(items))
+	for _, item := range items {
+		key := id(item)
+		rows[key] = item
+		order = append(order, key)
+	}
+	if err := syncBucket(tx, bucket, rows); err != nil {
+		return err
+	}
+	return putJSON(tx, bucketState, bucket, order)
+}
+
+func loadList[T any](tx *store.Tx, bucket string) ([]T, error) {
+	rows, err := loadBucket[T](tx, bucket)
+	if err != nil {
+		return nil, err
+	}
+	var order []string
+	if _, err := getJSON(tx, bucketState, bucket, &order); err != nil {
+		return nil, err
+	}
+
+	items := make([]T, 0, len(order))
+	for _, key := range order {
+		if row, ok := rows[key]; ok {
+			items = append(items, row)
+		}
+	}
+	return items, nil
+}
+
+// Jobs
+
+func (s *StateStore) LoadJobs() (map[string]*JobInfo, []string, error) {
+	var jobs map[string]*JobInfo
+	var history []string
+	err := s.db.View(func(tx *store.Tx) error {
+		var err error
+		if jobs, err = loadBucket[*JobInfo](tx, bucketJobs); err != nil {
+			return err
+		}
+		_, err = getJSON(tx, bucketState, bucketJobs, &history)
+		return err
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load jobs: %w", err)
+	}
+	return jobs, history, nil
+}
+
+func (s *StateStore) SaveJobs(jobs map[string]*JobInfo, history []string) error {
+	err := s.db.Update(func(tx *store.Tx) error {
+		if err := syncBucket(tx, bucketJobs, jobs); err != nil {
+			return err
+		}
+		return putJSON(tx, bucketState, bucketJobs, history)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save jobs: %w", err)
+	}
+	return nil
+}
+
+func (s *StateStore) importLegacyJobs(path string) error {
+	return importLegacyFile(path, func(data []byte) error {
+		var legacy struct {
+			Jobs    map[string]*JobInfo `json:"jobs"`
+			History []string            `json:"history"`
+		}
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return err
+		}
+		return s.SaveJobs(legacy.Jobs, legacy.History)
+	})
+}
+
+// Queue
+
+// queueSettings is the part of a queue snapshot that is not a list
+type queueSettings struct {
+	Timestamp     time.Time          `json:"timestamp"`
+	Configuration QueueConfiguration `json:"configuration"`
+	Version       string             `json:"version"`
+}
+
+func (s *StateStore) LoadQueueState() (*StateSnapshot, error) {
+	var snapshot *StateSnapshot
+	err := s.db.View(func(tx *store.Tx) error {
+		var settings queueSettings
+		found, err := getJSON(tx, bucketState, "queue", &settings)
+		if err != nil || !found {
+			return err
+		}
+
+		snapshot = &StateSnapshot{
+			Timestamp:     settings.Timestamp,
+			Configuration: settings.Configuration,
+			Version:       settings.Version,
+		}
+		if snapshot.QueueItems, err = loadList[QueueItem](tx, bucketQueueItems); err != nil {
+			return err
+		}
+		if snapshot.DealFolders, err = loadBucket[DealFolderMirror](tx, bucketQueueFolders); err != nil {
+			return err
+		}
+		history, err := loadBucket[ProcessingHistory](tx, bucketQueueHistory)
+		for _, entry := range history {
+			snapshot.ProcessingHistory = append(snapshot.ProcessingHistory, entry)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load queue state: %w", err)
+	}
+	return snapshot, nil
+}
+
+func (s *StateStore) SaveQueueState(snapshot *StateSnapshot) error {
+	history := make(map[string]ProcessingHistory, len(snapshot.ProcessingHistory))
+	for _, entry := range snapshot.ProcessingHistory {
+		history[entry.ID] = entry
+	}
+
+	err := s.db.Update(func(tx *store.Tx) error {
+		if err := saveList(tx, bucketQueueItems, snapshot.QueueItems, func(item QueueItem) string { return item.ID }); err != nil {
+			return err
+		}
+		if err := syncBucket(tx, bucketQueueFolders, snapshot.DealFolders); err != nil {
+			return err
+		}
+		if err := syncBucket(tx, bucketQueueHistory, history); err != nil {
+			return err
+		}
+		return putJSON(tx, bucketState, "queue", queueSettings{
+			Timestamp:     snapshot.Timestamp,
+			Configuration: snapshot.Configuration,
+			Version:       snapshot.Version,
+		})
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save queue state: %w", err)
+	}
+	return nil
+}
+
+func (s *StateStore) importLegacyQueue(path string) error {
+	return importLegacyFile(path, func(data []byte) error {
+		var snapshot StateSnapshot
+		if err := json.Unmarshal(data, &snapshot); err != nil {
+			return err
+		}
+		return s.SaveQueueState(&snapshot)
+	})
+}
+
+// Conflicts
+
+func (s *StateStore) LoadConflicts() (map[string][]*ConflictResolutionRecord, []*ConflictAuditEntry, error) {
+	var history map[string][]*ConflictResolutionRecord
+	var audit []*ConflictAuditEntry
+	err := s.db.View(func(tx *store.Tx) error {
+		var err error
+		if history, err = loadBucket[[]*ConflictResolutionRecord](tx, bucketConflictHistory); err != nil {
+			return err
+		}
+		audit, err = loadList[*ConflictAuditEntry](tx, bucketConflictAudit)
+		return err
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load conflicts: %w", err)
+	}
+	return history, audit, nil
+}
+
+func (s *StateStore) SaveConflicts(history map[string][]*ConflictResolutionRecord, audit []*ConflictAuditEntry) error {
+	err := s.db.Update(func(tx *store.Tx) error {
+		if err := syncBucket(tx, bucketConflictHistory, history); err != nil {
+			return err
+		}
+		return saveList(tx, bucketConflictAudit, audit, func(entry *ConflictAuditEntry) string { return entry.ID })
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save conflicts: %w", err)
+	}
+	return nil
+}
+
+func (s *StateStore) importLegacyConflicts(dir string) error {
+	history, audit, err := s.LoadConflicts()
+	if err != nil {
+		return err
+	}
+	err = importLegacyFile(filepath.Join(dir, "conflict_history.json"), func(data []byte) error {
+		if err := json.Unmarshal(data, &history); err != nil {
+			return err
+		}
+		return s.SaveConflicts(history, audit)
+	})
+	if err != nil {
+		return err
+	}
+	return importLegacyFile(filepath.Join(dir, "audit_trail.json"), func(data []byte) error {
+		if err := json.Unmarshal(data, &audit); err != nil {
+			return err
+		}
+		return s.SaveConflicts(history, audit)
+	})
+}
+
+// Corrections
+
+func (s *StateStore) LoadCorrections() (map[string]*CorrectionEntry, *LearningModel, error) {
+	var corrections map[string]*CorrectionEntry
+	var model *LearningModel
+	err := s.db.View(func(tx *store.Tx) error {
+		var err error
+		if corrections, err = loadBucket[*CorrectionEntry](tx, bucketCorrections); err != nil {
+			return err
+		}
+		_, err = getJSON(tx, bucketState, "learning_model", &model)
+		return err
+	})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to load corrections: %w", err)
+	}
+	return corrections, model, nil
+}
+
+func (s *StateStore) SaveCorrections(corrections map[string]*CorrectionEntry, model *LearningModel) error {
+	err := s.db.Update(func(tx *store.Tx) error {
+		if err := syncBucket(tx, bucketCorrections, corrections); err != nil {
+			return err
+		}
+		return putJSON(tx, bucketState, "learning_model", model)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save corrections: %w", err)
+	}
+	return nil
+}
+
+func (s *StateStore) importLegacyCorrections(path string) error {
+	return importLegacyFile(path, func(data []byte) error {
+		var legacy struct {
+			Corrections   map[string]*CorrectionEntry `json:"corrections"`
+			LearningModel *LearningModel              `json:"learning_model"`
+		}
+		if err := json.Unmarshal(data, &legacy); err != nil {
+			return err
+		}
+		return s.SaveCorrections(legacy.Corrections, legacy.LearningModel)
+	})
+}
+
+// Feedback
+
+func (s *StateStore) LoadFeedbackState() (*FeedbackLoopState, error) {
+	var state *FeedbackLoopState
+	err := s.db.View(func(tx *store.Tx) error {
+		var metrics FeedbackMetrics
+		found, err := getJSON(tx, bucketState, "feedback_metrics", &metrics)
+		if err != nil || !found {
+			return err
+		}
+
+		state = &FeedbackLoopState{Metrics: metrics}
+		if state.FeedbackHistory, err = loadBucket[*UserFeedback](tx, bucketFeedback); err != nil {
+			return err
+		}
+		if state.UserFeedbackProfiles, err = loadBucket[*UserFeedbackProfile](tx, bucketFeedbackProfiles); err != nil {
+			return err
+		}
+		state.LearningAdjustments, err = loadBucket[*LearningAdjustment](tx, bucketFeedbackAdjustments)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load feedback state: %w", err)
+	}
+	return state, nil
+}
+
+func (s *StateStore) SaveFeedbackState(state *FeedbackLoopState) error {
+	err := s.db.Update(func(tx *store.Tx) error {
+		if err := syncBucket(tx, bucketFeedback, state.FeedbackHistory); err != nil {
+			return err
+		}
+		if err := syncBucket(tx, bucketFeedbackProfiles, state.UserFeedbackProfiles); err != nil {
+			return err
+		}
+		if err := syncBucket(tx, bucketFeedbackAdjustments, state.LearningAdjustments); err != nil {
+			return err
+		}
+		return putJSON(tx, bucketState, "feedback_metrics", state.Metrics)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save feedback state: %w", err)
+	}
+	return nil
+}
+
+func (s *StateStore) importLegacyFeedback(path string) error {
+	return importLegacyFile(path, func(data []byte) error {
+		var state FeedbackLoopState
+		if err := json.Unmarshal(data, &state); err != nil {
+			return err
+		}
+		return s.SaveFeedbackState(&state)
+	})
+}
+
+// Workflow executions
+
+func (s *StateStore) LoadWorkflowState() (*WorkflowRecoveryState, error) {
+	state := &WorkflowRecoveryState{}
+	err := s.db.View(func(tx *store.Tx) error {
+		var err error
+		if state.Executions, err = loadBucket[*WorkflowExecution](tx, bucketWorkflowExecutions); err != nil {
+			return err
+		}
+		if state.ExecutionHistory, err = loadList[*WorkflowExecution](tx, bucketWorkflowHistory); err != nil {
+			return err
+		}
+		_, err = getJSON(tx, bucketState, "workflow_error_stats", &state.ErrorStats)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load workflow executions: %w", err)
+	}
+	return state, nil
+}
+
+func (s *StateStore) SaveWorkflowState(state *WorkflowRecoveryState) error {
+	err := s.db.Update(func(tx *store.Tx) error {
+		if err := syncBucket(tx, bucketWorkflowExecutions, state.Executions); err != nil {
+			return err
+		}
+		if err := saveList(tx, bucketWorkflowHistory, state.ExecutionHistory, func(execution *WorkflowExecution) string { return execution.ID }); err != nil {
+			return err
+		}
+		return putJSON(tx, bucketState, "workflow_error_stats", state.ErrorStats)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save workflow executions: %w", err)
+	}
+	return nil
+}
+
+func (s *StateStore) importLegacyWorkflows(path string) error {
+	return importLegacyFile(path, func(data []byte) error {
+		var state WorkflowRecoveryState
+		if err := json.Unmarshal(data, &state); err != nil {
+			return err
+		}
+		return s.SaveWorkflowState(&state)
+	})
+}
+
+// API keys
+
+func (s *StateStore) LoadAPIKeys() (map[string]*APIKeyInfo, error) {
+	var keys map[string]*APIKeyInfo
+	err := s.db.View(func(tx *store.Tx) error {
+		var err error
+		keys, err = loadBucket[*APIKeyInfo](tx, bucketAPIKeys)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API keys: %w", err)
+	}
+	return keys, nil
+}
+
+func (s *StateStore) SaveAPIKeys(keys map[string]*APIKeyInfo) error {
+	err := s.db.Update(func(tx *store.Tx) error {
+		return syncBucket(tx, bucketAPIKeys, keys)
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save API keys: %w", err)
+	}
+	return nil
+}
+
+func (s *StateStore) importLegacyAPIKeys(path string) error {
+	return importLegacyFile(path, func(data []byte) error {
+		var keys map[string]*APIKeyInfo
+		if err := json.Unmarshal(data, &keys); err != nil {
+			return err
+		}
+		return s.SaveAPIKeys(keys)
+	})
+}
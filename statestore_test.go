@@ -0,0 +1,168 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeLegacyFile(t *testing.T, path, content string) {
+	t.Helper()
+	require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+}
+
+func TestOpenStateStore_SharedPerDirectory(t *testing.T) {
+	dir := t.TempDir()
+	first, err := OpenStateStore(dir)
+	require.NoError(t, err)
+	second, err := OpenStateStore(filepath.Join(dir, "."))
+	require.NoError(t, err)
+	assert.Same(t, first, second)
+
+	version, err := first.db.SchemaVersion()
+	require.NoError(t, err)
+	assert.Equal(t, stateMigrations[len(stateMigrations)-1].Version, version)
+}
+
+func TestStateStore_ImportLegacyState(t *testing.T) {
+	root := t.TempDir()
+	writeLegacyFile(t, filepath.Join(root, ".dealdone", "job_tracker.json"), `{
+		"jobs": {"job-1": {"jobId": "job-1", "dealName": "Acme", "status": "completed"}},
+		"history": ["job-1"],
+		"saved_at": 1700000000000
+	}`)
+	writeLegacyFile(t, filepath.Join(root, "data", "queue_state.json"), `{
+		"queueItems": [{"id": "q-2", "dealName": "Acme", "status": "pending"}, {"id": "q-1", "dealName": "Acme", "status": "pending"}],
+		"dealFolders": {"Acme": {"dealName": "Acme", "folderPath": "/deals/Acme"}},
+		"processingHistory": [{"id": "h-1", "dealName": "Acme"}],
+		"version": "1"
+	}`)
+	writeLegacyFile(t, filepath.Join(root, "data", "conflicts", "conflict_history.json"),
+		`{"Acme:model.xlsx:price": [{"id": "c-1", "dealName": "Acme", "fieldName": "price"}]}`)
+	writeLegacyFile(t, filepath.Join(root, "data", "conflicts", "audit_trail.json"),
+		`[{"id": "a-1", "conflictId": "c-1", "action": "resolved"}]`)
+	writeLegacyFile(t, filepath.Join(root, "data", "workflow_recovery", "workflow_recovery_state.json"), `{
+		"executions": {"w-1": {"id": "w-1", "workflow_type": "analysis"}},
+		"execution_history": [{"id": "w-0", "workflow_type": "analysis"}],
+		"error_stats": {"timeout": 2}
+	}`)
+	writeLegacyFile(t, filepath.Join(root, "data", "feedback", "feedback_state.json"),
+		`{"feedback_history": {"f-1": {"id": "f-1", "user_id": "analyst"}}}`)
+	writeLegacyFile(t, filepath.Join(root, "config", "auth_keys.json"), `{"key-1": {"keyId": "key-1", "name": "n8n"}}`)
+	writeLegacyFile(t, filepath.Join(root, "data", "corrections", "correction_processor_state.json"), `{"corrections": `)
+
+	s, err := OpenStateStore(stateStorePath(root))
+	require.NoError(t, err)
+	err = s.ImportLegacyState(root)
+	require.Error(t, err, "the truncated corrections file is reported")
+	assert.FileExists(t, filepath.Join(root, "data", "corrections", "correction_processor_state.json.corrupt"))
+
+	jobs, history, err := s.LoadJobs()
+	require.NoError(t, err)
+	assert.Equal(t, "Acme", jobs["job-1"].DealName)
+	assert.Equal(t, []string{"job-1"}, history)
+	assert.FileExists(t, filepath.Join(root, ".dealdone", "job_tracker.json.imported"))
+	assert.NoFileExists(t, filepath.Join(root, ".dealdone", "job_tracker.json"))
+
+	snapshot, err := s.LoadQueueState()
+	require.NoError(t, err)
+	require.Len(t, snapshot.QueueItems, 2)
+	assert.Equal(t, "q-2", snapshot.QueueItems[0].ID, "queue order is kept")
+	assert.Equal(t, "/deals/Acme", snapshot.DealFolders["Acme"].FolderPath)
+	assert.Len(t, snapshot.ProcessingHistory, 1)
+
+	conflicts, audit, err := s.LoadConflicts()
+	require.NoError(t, err)
+	assert.Len(t, conflicts["Acme:model.xlsx:price"], 1)
+	require.Len(t, audit, 1)
+	assert.Equal(t, "resolved", audit[0].Action)
+
+	workflows, err := s.LoadWorkflowState()
+	require.NoError(t, err)
+	assert.Contains(t, workflows.Executions, "w-1")
+	assert.Len(t, workflows.ExecutionHistory, 1)
+	assert.Equal(t, 2, workflows.ErrorStats["timeout"])
+
+	feedback, err := s.LoadFeedbackState()
+	require.NoError(t, err)
+	assert.Equal(t, "analyst", feedback.FeedbackHistory["f-1"].UserID)
+
+	keys, err := s.LoadAPIKeys()
+	require.NoError(t, err)
+	assert.Equal(t, "n8n", keys["key-1"].Name)
+
+	// Imported files are not imported again
+	require.NoError(t, s.SaveJobs(map[string]*JobInfo{}, nil))
+	require.NoError(t, s.ImportLegacyState(root))
+	jobs, _, err = s.LoadJobs()
+	require.NoError(t, err)
+	assert.Empty(t, jobs)
+}
+
+func TestStateStore_SavesOnlyChanges(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenStateStore(dir)
+	require.NoError(t, err)
+
+	jobs := map[string]*JobInfo{
+		"job-1": {JobID: "job-1", DealName: "Acme", Status: JobStatusCompleted},
+		"job-2": {JobID: "job-2", DealName: "Acme", Status: JobStatusProcessing},
+	}
+	require.NoError(t, s.SaveJobs(jobs, []string{"job-1", "job-2"}))
+	info, err := os.Stat(filepath.Join(dir, "wal.log"))
+	require.NoError(t, err)
+
+	// Saving the same jobs again writes nothing
+	require.NoError(t, s.SaveJobs(jobs, []string{"job-1", "job-2"}))
+	same, err := os.Stat(filepath.Join(dir, "wal.log"))
+	require.NoError(t, err)
+	assert.Equal(t, info.Size(), same.Size())
+
+	delete(jobs, "job-1")
+	jobs["job-2"].Status = JobStatusCompleted
+	require.NoError(t, s.SaveJobs(jobs, []string{"job-2"}))
+	loaded, history, err := s.LoadJobs()
+	require.NoError(t, err)
+	assert.Len(t, loaded, 1)
+	assert.Equal(t, JobStatusCompleted, loaded["job-2"].Status)
+	assert.Equal(t, []string{"job-2"}, history)
+}
+
+func TestJobTracker_PersistsThroughStateStore(t *testing.T) {
+	root := t.TempDir()
+	configService := &ConfigService{config: &Config{DealDoneRoot: root}}
+
+	tracker := NewJobTracker(configService)
+	tracker.CreateJob("job-1", "Acme", WebhookTriggerType("file_change"), []string{"a.pdf"})
+	require.NoError(t, tracker.UpdateJob("job-1", map[string]interface{}{"progress": 0.5}))
+
+	// A tracker started after a crash sees every committed update
+	restarted := NewJobTrackerWithRepository(tracker.repo)
+	job, err := restarted.GetJob("job-1")
+	require.NoError(t, err)
+	assert.Equal(t, 0.5, job.Progress)
+	assert.DirExists(t, stateStorePath(root))
+}
+
+func TestWorkflowRecoveryService_SharedRepository(t *testing.T) {
+	repo := NewMemoryStateStore()
+	config := createTestConfig("")
+	config.Repository = repo
+	config.PersistenceInterval = time.Hour
+
+	service := NewWorkflowRecoveryService(config, NewTestLogger(), &TestNotifier{})
+	execution, err := service.CreateExecution("analysis", "Acme", "doc-1", createTestSteps())
+	require.NoError(t, err)
+	require.NoError(t, service.Shutdown())
+
+	restarted := NewWorkflowRecoveryService(config, NewTestLogger(), &TestNotifier{})
+	defer restarted.Shutdown()
+	loaded, err := restarted.GetExecution(execution.ID)
+	require.NoError(t, err)
+	assert.Equal(t, "analysis", loaded.WorkflowType)
+}
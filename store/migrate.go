@@ -0,0 +1,81 @@
+package store
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+)
+
+const (
+	metaBucket       = "_meta"
+	schemaVersionKey = "schema_version"
+)
+
+// Migration upgrades stored data to a schema version. Apply may be nil for
+// a version that only establishes a layout.
+type Migration struct {
+	Version     int
+	Description string
+	Apply       func(tx *Tx) error
+}
+
+// SchemaVersion returns the version of the last migration applied
+func (db *DB) SchemaVersion() (int, error) {
+	version := 0
+	err := db.View(func(tx *Tx) error {
+		var err error
+		version, err = schemaVersion(tx)
+		return err
+	})
+	return version, err
+}
+
+func schemaVersion(tx *Tx) (int, error) {
+	value, ok := tx.Get(metaBucket, schemaVersionKey)
+	if !ok {
+		return 0, nil
+	}
+	version, err := strconv.Atoi(string(value))
+	if err != nil {
+		return 0, fmt.Errorf("invalid schema version %q", value)
+	}
+	return version, nil
+}
+
+// Migrate applies the migrations newer than the stored schema version in
+// order, each in its own transaction together with the version bump
+func (db *DB) Migrate(migrations []Migration) error {
+	sorted := append([]Migration(nil), migrations...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Version < sorted[j].Version })
+	for i, m := range sorted {
+		if m.Version <= 0 || (i > 0 && m.Version == sorted[i-1].Version) {
+			return fmt.Errorf("invalid migration version %d", m.Version)
+		}
+	}
+
+	current, err := db.SchemaVersion()
+	if err != nil {
+		return err
+	}
+	if len(sorted) > 0 && current > sorted[len(sorted)-1].Version {
+		return fmt.Errorf("store schema version %d is newer than this build supports (%d)", current, sorted[len(sorted)-1].Version)
+	}
+
+	for _, m := range sorted {
+		if m.Version <= current {
+			continue
+		}
+		err := db.Update(func(tx *Tx) error {
+			if m.Apply != nil {
+				if err := m.Apply(tx); err != nil {
+					return err
+				}
+			}
+			return tx.Put(metaBucket, schemaVersionKey, []byte(strconv.Itoa(m.Version)))
+		})
+		if err != nil {
+			return fmt.Errorf("migration %d (%s) failed: %w", m.Version, m.Description, err)
+		}
+	}
+	return nil
+}
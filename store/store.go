@@ -0,0 +1,447 @@
+// Package store is an embedded transactional key-value store for
+// application state. Values live in named buckets and are held in memory;
+// every committed transaction is appended to a write-ahead log and fsynced
+// before Update returns, and the log is folded into a snapshot once it
+// outgrows it. A crash at any point leaves the last committed transaction
+// intact.
+package store
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const (
+	snapshotFile = "snapshot.json"
+	walFile      = "wal.log"
+	lockFile     = "LOCK"
+
+	// The log is compacted once it is larger than both this and the snapshot
+	minCompactBytes = 1 << 20
+)
+
+var (
+	// ErrClosed is returned by transactions on a closed store
+	ErrClosed = errors.New("store is closed")
+	// ErrReadOnly is returned when a read-only transaction is written to
+	ErrReadOnly = errors.New("transaction is read-only")
+	// ErrLocked is returned by Open when another process has the store open
+	ErrLocked = errors.New("store is in use by another process")
+)
+
+// DB is an open store. It is safe for concurrent use; writers are
+// serialized and readers see only committed transactions.
+type DB struct {
+	mu       sync.RWMutex
+	dir      string // Empty for a store that is not persisted
+	buckets  map[string]map[string][]byte
+	wal      *os.File
+	lock     *os.File // Held for as long as the store is open
+	walSize  int64
+	snapSize int64
+	seq      uint64
+	closed   bool
+}
+
+// snapshot is the file format of a compacted store
+type snapshot struct {
+	Seq     uint64                       `json:"seq"`
+	Buckets map[string]map[string][]byte `json:"buckets"`
+}
+
+// walRecord is one committed transaction in the log
+type walRecord struct {
+	Seq      uint64 `json:"seq"`
+	Ops      []op   `json:"ops"`
+	Checksum uint32 `json:"crc"`
+}
+
+type op struct {
+	Bucket string `json:"b"`
+	Key    string `json:"k"`
+	Value  []byte `json:"v,omitempty"`
+	Delete bool   `json:"d,omitempty"`
+}
+
+// Open opens or creates a store in dir. Only one process can have a store
+// open; Open fails with ErrLocked while another holds it, since each process
+// would otherwise compact the shared log with only its own transactions.
+func Open(dir string) (*DB, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("failed to create store directory: %w", err)
+	}
+
+	lock, err := os.OpenFile(filepath.Join(dir, lockFile), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open store lock: %w", err)
+	}
+	if err := lockExclusive(lock); err != nil {
+		lock.Close()
+		return nil, err
+	}
+
+	db := &DB{dir: dir, buckets: make(map[string]map[string][]byte), lock: lock}
+	if err := db.open(); err != nil {
+		lock.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+func (db *DB) open() error {
+	if err := db.loadSnapshot(); err != nil {
+		return err
+	}
+	if err := db.replay(); err != nil {
+		return err
+	}
+
+	wal, err := os.OpenFile(filepath.Join(db.dir, walFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to open store log: %w", err)
+	}
+	db.wal = wal
+	return nil
+}
+
+// OpenMemory returns a store that keeps its data in memory only
+func OpenMemory() *DB {
+	return &DB{buckets: make(map[string]map[string][]byte)}
+}
+
+func (db *DB) loadSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(db.dir, snapshotFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read store snapshot: %w", err)
+	}
+
+	var snap snapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return fmt.Errorf("failed to parse store snapshot: %w", err)
+	}
+	if snap.Buckets != nil {
+		db.buckets = snap.Buckets
+	}
+	db.seq = snap.Seq
+	db.snapSize = int64(len(data))
+	return nil
+}
+
+// replay applies the transactions logged since the snapshot. A record torn
+// by a crash mid-write, and anything after it, is cut from the log.
+func (db *DB) replay() error {
+	path := filepath.Join(db.dir, walFile)
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open store log: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	var offset int64
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			break
+		}
+		if err != nil && err != io.EOF {
+			return fmt.Errorf("failed to read store log: %w", err)
+		}
+
+		record, ok := decodeRecord(line)
+		if err == io.EOF || !ok {
+			if err := os.Truncate(path, offset); err != nil {
+				return fmt.Errorf("failed to repair store log: %w", err)
+			}
+			break
+		}
+
+		offset += int64(len(line))
+		if record.Seq <= db.seq {
+			continue // Already in the snapshot
+		}
+		db.apply(record.Ops)
+		db.seq = record.Seq
+	}
+
+	db.walSize = offset
+	return nil
+}
+
+func decodeRecord(line []byte) (walRecord, bool) {
+	var record walRecord
+	if err := json.Unmarshal(line, &record); err != nil {
+		return record, false
+	}
+	data, err := json.Marshal(record.Ops)
+	if err != nil || crc32.ChecksumIEEE(data) != record.Checksum {
+		return record, false
+	}
+	return record, true
+}
+
+func (db *DB) apply(ops []op) {
+	for _, o := range ops {
+		bucket := db.buckets[o.Bucket]
+		if o.Delete {
+			delete(bucket, o.Key)
+			if len(bucket) == 0 {
+				delete(db.buckets, o.Bucket)
+			}
+			continue
+		}
+		if bucket == nil {
+			bucket = make(map[string][]byte)
+			db.buckets[o.Bucket] = bucket
+		}
+		bucket[o.Key] = o.Value
+	}
+}
+
+// View runs fn in a read-only transaction
+func (db *DB) View(fn func(tx *Tx) error) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+	return fn(&Tx{db: db})
+}
+
+// Update runs fn in a read-write transaction. The transaction is committed
+// when fn returns nil and discarded when it returns an error.
+func (db *DB) Update(fn func(tx *Tx) error) error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+	tx := &Tx{db: db, writable: true, pending: make(map[string]map[string]op)}
+	if err := fn(tx); err != nil {
+		return err
+	}
+	if len(tx.ops) == 0 {
+		return nil
+	}
+	return db.commit(tx.ops)
+}
+
+func (db *DB) commit(ops []op) error {
+	if db.wal != nil {
+		data, err := json.Marshal(ops)
+		if err != nil {
+			return fmt.Errorf("failed to encode transaction: %w", err)
+		}
+		line, err := json.Marshal(walRecord{Seq: db.seq + 1, Ops: ops, Checksum: crc32.ChecksumIEEE(data)})
+		if err != nil {
+			return fmt.Errorf("failed to encode transaction: %w", err)
+		}
+		line = append(line, '\n')
+
+		if _, err := db.wal.Write(line); err == nil {
+			err = db.wal.Sync()
+		}
+		if err != nil {
+			// Drop a partial record so later commits are not lost behind it
+			db.wal.Truncate(db.walSize)
+			return fmt.Errorf("failed to write transaction: %w", err)
+		}
+		db.walSize += int64(len(line))
+	}
+
+	db.seq++
+	db.apply(ops)
+
+	// The transaction is durable; a failed compaction is retried on the
+	// next commit
+	if db.wal != nil && db.walSize > minCompactBytes && db.walSize > db.snapSize {
+		db.compact()
+	}
+	return nil
+}
+
+// compact writes a snapshot of the store and empties the log. A crash
+// between the two is safe: replay skips records already in the snapshot.
+func (db *DB) compact() error {
+	data, err := json.Marshal(snapshot{Seq: db.seq, Buckets: db.buckets})
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot: %w", err)
+	}
+	if err := writeFileSync(filepath.Join(db.dir, snapshotFile), data); err != nil {
+		return err
+	}
+	if err := db.wal.Truncate(0); err != nil {
+		return fmt.Errorf("failed to truncate store log: %w", err)
+	}
+	if err := db.wal.Sync(); err != nil {
+		return fmt.Errorf("failed to truncate store log: %w", err)
+	}
+	db.walSize = 0
+	db.snapSize = int64(len(data))
+	return nil
+}
+
+// Compact folds the log into the snapshot
+func (db *DB) Compact() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return ErrClosed
+	}
+	if db.wal == nil {
+		return nil
+	}
+	return db.compact()
+}
+
+// Close closes the store; later transactions fail with ErrClosed
+func (db *DB) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	if db.closed {
+		return nil
+	}
+	db.closed = true
+	var err error
+	if db.wal != nil {
+		err = db.wal.Close()
+	}
+	if db.lock != nil {
+		// Closing the file releases the lock
+		db.lock.Close()
+	}
+	return err
+}
+
+// writeFileSync replaces path atomically with data
+func writeFileSync(path string, data []byte) error {
+	tmpPath := path + ".tmp"
+	file, err := os.OpenFile(tmpPath, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, path)
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("failed to write snapshot: %w", err)
+	}
+
+	// Persist the rename itself
+	if dir, err := os.Open(filepath.Dir(path)); err == nil {
+		dir.Sync()
+		dir.Close()
+	}
+	return nil
+}
+
+// Tx is a transaction. Reads see the transaction's own writes.
+type Tx struct {
+	db       *DB
+	writable bool
+	ops      []op
+	pending  map[string]map[string]op
+}
+
+// Get returns a copy of the value stored under key
+func (tx *Tx) Get(bucket, key string) ([]byte, bool) {
+	if o, ok := tx.pending[bucket][key]; ok {
+		if o.Delete {
+			return nil, false
+		}
+		return bytes.Clone(o.Value), true
+	}
+	value, ok := tx.db.buckets[bucket][key]
+	if !ok {
+		return nil, false
+	}
+	return bytes.Clone(value), true
+}
+
+// Put stores value under key. Writing a value that is already stored is a
+// no-op, so callers can rewrite whole buckets and only changes are logged.
+func (tx *Tx) Put(bucket, key string, value []byte) error {
+	if !tx.writable {
+		return ErrReadOnly
+	}
+	if current, ok := tx.Get(bucket, key); ok && bytes.Equal(current, value) {
+		return nil
+	}
+	tx.record(op{Bucket: bucket, Key: key, Value: bytes.Clone(value)})
+	return nil
+}
+
+// Delete removes key from bucket
+func (tx *Tx) Delete(bucket, key string) error {
+	if !tx.writable {
+		return ErrReadOnly
+	}
+	if _, ok := tx.Get(bucket, key); !ok {
+		return nil
+	}
+	tx.record(op{Bucket: bucket, Key: key, Delete: true})
+	return nil
+}
+
+func (tx *Tx) record(o op) {
+	tx.ops = append(tx.ops, o)
+	if tx.pending[o.Bucket] == nil {
+		tx.pending[o.Bucket] = make(map[string]op)
+	}
+	tx.pending[o.Bucket][o.Key] = o
+}
+
+// Keys returns the keys in bucket in sorted order
+func (tx *Tx) Keys(bucket string) []string {
+	keys := make([]string, 0, len(tx.db.buckets[bucket]))
+	for key := range tx.db.buckets[bucket] {
+		if o, ok := tx.pending[bucket][key]; !ok || !o.Delete {
+			keys = append(keys, key)
+		}
+	}
+	for key, o := range tx.pending[bucket] {
+		if _, committed := tx.db.buckets[bucket][key]; !committed && !o.Delete {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// ForEach calls fn for every key in bucket in sorted order
+func (tx *Tx) ForEach(bucket string, fn func(key string, value []byte) error) error {
+	for _, key := range tx.Keys(bucket) {
+		value, _ := tx.Get(bucket, key)
+		if err := fn(key, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,253 @@
+package store
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, db *DB, bucket, key string) (string, bool) {
+	t.Helper()
+	var value []byte
+	var ok bool
+	require.NoError(t, db.View(func(tx *Tx) error {
+		value, ok = tx.Get(bucket, key)
+		return nil
+	}))
+	return string(value), ok
+}
+
+func TestTransactions(t *testing.T) {
+	for name, open := range map[string]func() *DB{
+		"memory": OpenMemory,
+		"disk": func() *DB {
+			db, err := Open(t.TempDir())
+			require.NoError(t, err)
+			return db
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			db := open()
+			defer db.Close()
+
+			require.NoError(t, db.Update(func(tx *Tx) error {
+				require.NoError(t, tx.Put("jobs", "b", []byte("beta")))
+				require.NoError(t, tx.Put("jobs", "a", []byte("alpha")))
+				require.NoError(t, tx.Put("keys", "x", []byte("1")))
+
+				// Reads see the transaction's own writes
+				value, ok := tx.Get("jobs", "a")
+				assert.True(t, ok)
+				assert.Equal(t, "alpha", string(value))
+				return nil
+			}))
+
+			value, ok := get(t, db, "jobs", "a")
+			assert.True(t, ok)
+			assert.Equal(t, "alpha", value)
+
+			// A failed transaction leaves nothing behind
+			err := db.Update(func(tx *Tx) error {
+				tx.Put("jobs", "a", []byte("changed"))
+				tx.Delete("jobs", "b")
+				return errors.New("validation failed")
+			})
+			assert.EqualError(t, err, "validation failed")
+			value, _ = get(t, db, "jobs", "a")
+			assert.Equal(t, "alpha", value)
+
+			require.NoError(t, db.Update(func(tx *Tx) error {
+				require.NoError(t, tx.Delete("jobs", "a"))
+				require.NoError(t, tx.Put("jobs", "c", []byte("gamma")))
+				assert.Equal(t, []string{"b", "c"}, tx.Keys("jobs"))
+				return nil
+			}))
+
+			var seen []string
+			require.NoError(t, db.View(func(tx *Tx) error {
+				assert.ErrorIs(t, tx.Put("jobs", "d", nil), ErrReadOnly)
+				return tx.ForEach("jobs", func(key string, value []byte) error {
+					seen = append(seen, key+"="+string(value))
+					return nil
+				})
+			}))
+			assert.Equal(t, []string{"b=beta", "c=gamma"}, seen)
+
+			require.NoError(t, db.Close())
+			assert.ErrorIs(t, db.View(func(tx *Tx) error { return nil }), ErrClosed)
+		})
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir)
+	require.NoError(t, err)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, db.Update(func(tx *Tx) error {
+			return tx.Put("jobs", fmt.Sprintf("job-%d", i), []byte(fmt.Sprintf("v%d", i)))
+		}))
+	}
+	require.NoError(t, db.Update(func(tx *Tx) error { return tx.Delete("jobs", "job-0") }))
+
+	// Rewriting an unchanged value is not logged
+	info, err := os.Stat(filepath.Join(dir, walFile))
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(tx *Tx) error { return tx.Put("jobs", "job-1", []byte("v1")) }))
+	unchanged, err := os.Stat(filepath.Join(dir, walFile))
+	require.NoError(t, err)
+	assert.Equal(t, info.Size(), unchanged.Size())
+	require.NoError(t, db.Close())
+
+	reopened, err := Open(dir)
+	require.NoError(t, err)
+	_, ok := get(t, reopened, "jobs", "job-0")
+	assert.False(t, ok)
+	value, ok := get(t, reopened, "jobs", "job-2")
+	assert.True(t, ok)
+	assert.Equal(t, "v2", value)
+
+	// Compaction keeps the data and empties the log
+	require.NoError(t, reopened.Compact())
+	require.NoError(t, reopened.Update(func(tx *Tx) error { return tx.Put("jobs", "job-3", []byte("v3")) }))
+	require.NoError(t, reopened.Close())
+
+	compacted, err := Open(dir)
+	require.NoError(t, err)
+	defer compacted.Close()
+	assert.FileExists(t, filepath.Join(dir, snapshotFile))
+	for key, want := range map[string]string{"job-1": "v1", "job-2": "v2", "job-3": "v3"} {
+		value, ok := get(t, compacted, "jobs", key)
+		assert.True(t, ok, key)
+		assert.Equal(t, want, value, key)
+	}
+}
+
+func TestOpenLocksStore(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir)
+	require.NoError(t, err)
+
+	// A second writer would compact the log with only its own transactions
+	_, err = Open(dir)
+	assert.ErrorIs(t, err, ErrLocked)
+
+	require.NoError(t, db.Close())
+	reopened, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, reopened.Close())
+}
+
+func TestTornLogRecord(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(tx *Tx) error { return tx.Put("jobs", "a", []byte("committed")) }))
+	require.NoError(t, db.Close())
+
+	// Simulate a crash part way through writing the next transaction
+	path := filepath.Join(dir, walFile)
+	committed, err := os.ReadFile(path)
+	require.NoError(t, err)
+	file, err := os.OpenFile(path, os.O_APPEND|os.O_WRONLY, 0600)
+	require.NoError(t, err)
+	_, err = file.WriteString(`{"seq":2,"ops":[{"b":"jobs","k":"b"`)
+	require.NoError(t, err)
+	file.Close()
+
+	reopened, err := Open(dir)
+	require.NoError(t, err)
+	value, ok := get(t, reopened, "jobs", "a")
+	assert.True(t, ok)
+	assert.Equal(t, "committed", value)
+	_, ok = get(t, reopened, "jobs", "b")
+	assert.False(t, ok)
+
+	// The torn record is cut so later commits replay
+	repaired, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, committed, repaired)
+	require.NoError(t, reopened.Update(func(tx *Tx) error { return tx.Put("jobs", "c", []byte("after")) }))
+	require.NoError(t, reopened.Close())
+
+	again, err := Open(dir)
+	require.NoError(t, err)
+	defer again.Close()
+	value, _ = get(t, again, "jobs", "c")
+	assert.Equal(t, "after", value)
+}
+
+func TestCorruptLogRecord(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir)
+	require.NoError(t, err)
+	require.NoError(t, db.Update(func(tx *Tx) error { return tx.Put("jobs", "a", []byte("alpha")) }))
+	require.NoError(t, db.Update(func(tx *Tx) error { return tx.Put("jobs", "b", []byte("beta")) }))
+	require.NoError(t, db.Close())
+
+	// A flipped byte fails the checksum
+	path := filepath.Join(dir, walFile)
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.SplitAfter(string(data), "\n")
+	lines[1] = strings.Replace(lines[1], `"k":"b"`, `"k":"c"`, 1)
+	require.NoError(t, os.WriteFile(path, []byte(strings.Join(lines, "")), 0600))
+
+	reopened, err := Open(dir)
+	require.NoError(t, err)
+	defer reopened.Close()
+	_, ok := get(t, reopened, "jobs", "a")
+	assert.True(t, ok)
+	_, ok = get(t, reopened, "jobs", "c")
+	assert.False(t, ok)
+}
+
+func TestMigrate(t *testing.T) {
+	dir := t.TempDir()
+	db, err := Open(dir)
+	require.NoError(t, err)
+
+	var applied []int
+	migration := func(version int) Migration {
+		return Migration{Version: version, Description: fmt.Sprintf("v%d", version), Apply: func(tx *Tx) error {
+			applied = append(applied, version)
+			return tx.Put("data", "version", []byte(fmt.Sprint(version)))
+		}}
+	}
+
+	require.NoError(t, db.Migrate([]Migration{migration(2), migration(1)}))
+	assert.Equal(t, []int{1, 2}, applied)
+	version, err := db.SchemaVersion()
+	require.NoError(t, err)
+	assert.Equal(t, 2, version)
+
+	// Applied migrations are skipped
+	require.NoError(t, db.Migrate([]Migration{migration(1), migration(2), migration(3)}))
+	assert.Equal(t, []int{1, 2, 3}, applied)
+
+	// A failed migration leaves the version where it was
+	err = db.Migrate([]Migration{migration(3), {Version: 4, Description: "broken", Apply: func(tx *Tx) error {
+		tx.Put("data", "version", []byte("4"))
+		return errors.New("bad data")
+	}}})
+	assert.ErrorContains(t, err, "migration 4 (broken) failed")
+	version, _ = db.SchemaVersion()
+	assert.Equal(t, 3, version)
+	value, _ := get(t, db, "data", "version")
+	assert.Equal(t, "3", value)
+	require.NoError(t, db.Close())
+
+	// Older builds refuse a store migrated past what they know
+	reopened, err := Open(dir)
+	require.NoError(t, err)
+	defer reopened.Close()
+	assert.ErrorContains(t, reopened.Migrate([]Migration{migration(1)}), "newer than this build supports")
+	assert.Error(t, reopened.Migrate([]Migration{migration(5), migration(5)}))
+}
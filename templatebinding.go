@@ -0,0 +1,858 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/xuri/excelize/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// templateBindingsVersion is the newest manifest version this build reads
+const templateBindingsVersion = 1
+
+// Formats a binding may write its value in
+const (
+	BindingFormatText     = "text"
+	BindingFormatNumber   = "number"
+	BindingFormatCurrency = "currency"
+	BindingFormatPercent  = "percent"
+	BindingFormatDate     = "date"
+)
+
+// bindingScales divide values for templates kept in thousands, millions or
+// billions, and the suffix shown after scaled values in text
+var bindingScales = map[string]struct {
+	divisor float64
+	suffix  string
+}{
+	"":          {1, ""},
+	"units":     {1, ""},
+	"thousands": {1e3, "k"},
+	"millions":  {1e6, "m"},
+	"billions":  {1e9, "bn"},
+}
+
+// TemplateBindingManifest declares where each field goes in a template, so
+// population does not have to guess from headers and placeholder names. It is
+// read from a sidecar next to the template (<name>.bindings.json, .yaml or
+// .yml) or from the bindings property of the template's .meta.json.
+type TemplateBindingManifest struct {
+	Version  int               `json:"version"`
+	Strict   bool              `json:"strict,omitempty"` // Leave unbound fields out instead of placing them heuristically
+	Bindings []TemplateBinding `json:"bindings"`
+	Source   string            `json:"-"` // File the manifest was read from
+}
+
+// TemplateBinding binds one canonical field to a cell, range or placeholder
+type TemplateBinding struct {
+	Field       string      `json:"field"`
+	Cell        string      `json:"cell,omitempty"`        // e.g. "Summary!C4"; the sheet may be left out for CSVs and single-sheet workbooks
+	Range       string      `json:"range,omitempty"`       // e.g. "Summary!C4:C8"; lists fill it in order, single values fill every cell
+	Placeholder string      `json:"placeholder,omitempty"` // Text replaced wherever it appears, e.g. "{{deal_value}}"
+	Format      string      `json:"format,omitempty"`      // text, number, currency, percent or date; empty uses the professional formatter
+	Unit        string      `json:"unit,omitempty"`        // Currency code of currency values, e.g. "EUR"
+	Scale       string      `json:"scale,omitempty"`       // thousands, millions or billions
+	Decimals    *int        `json:"decimals,omitempty"`    // Decimal places shown in text
+	Default     interface{} `json:"default,omitempty"`     // Written when the field has no value
+	Required    bool        `json:"required,omitempty"`    // Population fails when the field has no value and no default
+}
+
+// target describes where a binding writes, for messages
+func (b TemplateBinding) target() string {
+	switch {
+	case b.Cell != "":
+		return "cell " + b.Cell
+	case b.Range != "":
+		return "range " + b.Range
+	default:
+		return fmt.Sprintf("placeholder %q", b.Placeholder)
+	}
+}
+
+// TemplateBindingError lists the problems found in a binding manifest
+type TemplateBindingError struct {
+	Source   string   `json:"source"`
+	Problems []string `json:"problems"`
+}
+
+func (e *TemplateBindingError) Error() string {
+	return fmt.Sprintf("invalid template bindings in %s: %s", filepath.Base(e.Source), strings.Join(e.Problems, "; "))
+}
+
+// templateSidecarPaths lists the sidecar files a template's name
+// configuration may be read from, in order of preference
+func templateSidecarPaths(templatePath, name string) []string {
+	base := strings.TrimSuffix(templatePath, filepath.Ext(templatePath))
+	return []string{base + "." + name + ".json", base + "." + name + ".yaml", base + "." + name + ".yml"}
+}
+
+// readTemplateSidecar decodes a template's name configuration from its
+// sidecar file, or from the name property of its .meta.json. It returns the
+// file read, or "" when the template has no such configuration.
+func readTemplateSidecar(templatePath, name string, v interface{}) (string, error) {
+	for _, path := range templateSidecarPaths(templatePath, name) {
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to read template %s: %w", name, err)
+		}
+		if err := decodeTemplateSidecar(data, filepath.Ext(path) != ".json", v); err != nil {
+			return "", fmt.Errorf("failed to parse %s: %w", filepath.Base(path), err)
+		}
+		return path, nil
+	}
+
+	metadataPath := strings.TrimSuffix(templatePath, filepath.Ext(templatePath)) + ".meta.json"
+	data, err := os.ReadFile(metadataPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to read template metadata: %w", err)
+	}
+	var metadata struct {
+		Properties map[string]json.RawMessage `json:"properties"`
+	}
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return "", fmt.Errorf("failed to decode metadata: %w", err)
+	}
+	raw := metadata.Properties[name]
+	if len(raw) == 0 || string(raw) == "null" {
+		return "", nil
+	}
+	if err := decodeTemplateSidecar(raw, false, v); err != nil {
+		return "", fmt.Errorf("failed to parse %s in %s: %w", name, filepath.Base(metadataPath), err)
+	}
+	return metadataPath, nil
+}
+
+// decodeTemplateSidecar decodes a sidecar configuration. YAML is converted
+// to JSON first so both share one set of field names, and unknown keys are
+// rejected so a misspelt key is reported rather than ignored.
+func decodeTemplateSidecar(data []byte, isYAML bool, v interface{}) error {
+	if isYAML {
+		var document interface{}
+		if err := yaml.Unmarshal(data, &document); err != nil {
+			return err
+		}
+		converted, err := json.Marshal(document)
+		if err != nil {
+			return err
+		}
+		data = converted
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// LoadTemplateBindings reads the binding manifest of a template. It returns
+// nil when the template has none.
+func LoadTemplateBindings(templatePath string) (*TemplateBindingManifest, error) {
+	var manifest TemplateBindingManifest
+	source, err := readTemplateSidecar(templatePath, "bindings", &manifest)
+	if err != nil || source == "" {
+		return nil, err
+	}
+	if manifest.Version == 0 {
+		manifest.Version = 1
+	}
+	manifest.Source = source
+	return &manifest, nil
+}
+
+// copyTemplateBindings gives a copy of a template the manifest of its
+// source, so the copy is populated the same way
+func copyTemplateBindings(templatePath, copyPath string) error {
+	manifest, err := LoadTemplateBindings(templatePath)
+	if err != nil || manifest == nil {
+		return err
+	}
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode template bindings: %w", err)
+	}
+	return writeFileDurable(templateSidecarPaths(copyPath, "bindings")[0], data, 0644)
+}
+
+// Validate checks the manifest against the template it binds. The returned
+// error is a *TemplateBindingError listing every problem found.
+func (m *TemplateBindingManifest) Validate(templateData *TemplateData) error {
+	var problems []string
+	if m.Version > templateBindingsVersion {
+		problems = append(problems, fmt.Sprintf("version %d is newer than the supported version %d", m.Version, templateBindingsVersion))
+	}
+	if len(m.Bindings) == 0 {
+		problems = append(problems, "no bindings")
+	}
+
+	targets := make(map[string]int)
+	for i, b := range m.Bindings {
+		name := fmt.Sprintf("binding %d", i+1)
+		if b.Field != "" {
+			name += fmt.Sprintf(" (%s)", b.Field)
+		}
+		report := func(format string, args ...interface{}) {
+			problems = append(problems, name+": "+fmt.Sprintf(format, args...))
+		}
+
+		if strings.TrimSpace(b.Field) == "" {
+			report("field is required")
+		}
+		set := 0
+		for _, target := range []string{b.Cell, b.Range, b.Placeholder} {
+			if target != "" {
+				set++
+			}
+		}
+		if set != 1 {
+			report("exactly one of cell, range or placeholder is required")
+			continue
+		}
+		switch b.Format {
+		case "", BindingFormatText, BindingFormatNumber, BindingFormatCurrency, BindingFormatPercent, BindingFormatDate:
+		default:
+			report("unknown format %q", b.Format)
+		}
+		if _, ok := bindingScales[b.Scale]; !ok {
+			report("unknown scale %q", b.Scale)
+		}
+		if b.Decimals != nil && (*b.Decimals < 0 || *b.Decimals > 10) {
+			report("decimals must be between 0 and 10")
+		}
+
+		if b.Placeholder != "" {
+			if !templateContains(templateData, b.Placeholder) {
+				report("placeholder %q does not appear in the template", b.Placeholder)
+			}
+			continue
+		}
+
+		cells, err := bindingCells(b, templateData)
+		if err != nil {
+			report("%v", err)
+			continue
+		}
+		for _, cell := range cells {
+			if previous, ok := targets[cell]; ok {
+				report("cell %s is also bound by binding %d", cell, previous+1)
+				break
+			}
+			targets[cell] = i
+			if formula := templateFormula(templateData, cell); formula != "" {
+				report("cell %s holds the formula %s", cell, formula)
+				break
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &TemplateBindingError{Source: m.Source, Problems: problems}
+	}
+	return nil
+}
+
+// bindingCells resolves a cell or range binding to sheet-qualified cell
+// names such as "Summary!C4". CSV cells have no sheet.
+func bindingCells(b TemplateBinding, templateData *TemplateData) ([]string, error) {
+	ref := b.Cell
+	if ref == "" {
+		ref = b.Range
+	}
+
+	sheet := ""
+	if i := strings.LastIndex(ref, "!"); i >= 0 {
+		sheet = strings.Trim(ref[:i], "'")
+		ref = ref[i+1:]
+	}
+
+	switch templateData.Format {
+	case "excel":
+		if sheet == "" {
+			if len(templateData.Sheets) != 1 {
+				return nil, fmt.Errorf("%s must name its sheet in a workbook with %d sheets", b.target(), len(templateData.Sheets))
+			}
+			sheet = templateData.Sheets[0].Name
+		}
+		found := false
+		for _, s := range templateData.Sheets {
+			found = found || s.Name == sheet
+		}
+		if !found {
+			return nil, fmt.Errorf("sheet %q does not exist", sheet)
+		}
+	case "csv":
+		if sheet != "" {
+			return nil, fmt.Errorf("CSV templates have no sheets")
+		}
+	default:
+		return nil, fmt.Errorf("%s templates can only bind placeholders", templateData.Format)
+	}
+
+	from, to, isRange := strings.Cut(strings.ToUpper(ref), ":")
+	if b.Cell != "" && isRange {
+		return nil, fmt.Errorf("cell %s is a range", b.Cell)
+	}
+	if !isRange {
+		to = from
+	}
+	fromCol, fromRow, err := excelize.CellNameToCoordinates(from)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cell %q", from)
+	}
+	toCol, toRow, err := excelize.CellNameToCoordinates(to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cell %q", to)
+	}
+	if toCol < fromCol || toRow < fromRow {
+		return nil, fmt.Errorf("range %s is reversed", b.Range)
+	}
+
+	var cells []string
+	for row := fromRow; row <= toRow; row++ {
+		for col := fromCol; col <= toCol; col++ {
+			cell, _ := excelize.CoordinatesToCellName(col, row)
+			if sheet != "" {
+				cell = sheet + "!" + cell
+			}
+			cells = append(cells, cell)
+		}
+	}
+	return cells, nil
+}
+
+// splitBoundCell splits a sheet-qualified cell name
+func splitBoundCell(cell string) (string, string) {
+	if i := strings.LastIndex(cell, "!"); i >= 0 {
+		return cell[:i], cell[i+1:]
+	}
+	return "", cell
+}
+
+// templateContains reports whether text appears anywhere in a template
+func templateContains(templateData *TemplateData, text string) bool {
+	if content, ok := templateData.Metadata["originalContent"].(string); ok {
+		return strings.Contains(content, text)
+	}
+	grids := [][][]string{append([][]string{templateData.Headers}, templateData.Data...)}
+	for _, sheet := range templateData.Sheets {
+		grids = append(grids, append([][]string{sheet.Headers}, sheet.Data...))
+	}
+	for _, grid := range grids {
+		for _, row := range grid {
+			for _, cell := range row {
+				if strings.Contains(cell, text) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// templateFormula returns the formula in a bound cell, if any
+func templateFormula(templateData *TemplateData, boundCell string) string {
+	sheet, cell := splitBoundCell(boundCell)
+	if sheet == "" {
+		return templateData.Formulas[cell]
+	}
+	for _, s := range templateData.Sheets {
+		if s.Name == sheet {
+			return s.Formulas[cell]
+		}
+	}
+	return ""
+}
+
+// resolvedBinding is a binding with the value it writes
+type resolvedBinding struct {
+	TemplateBinding
+	value interface{}
+}
+
+// resolveBindings looks up the value of each binding. Bindings without a
+// value or default are left out; missing required fields are an error.
+func resolveBindings(manifest *TemplateBindingManifest, mappedData *MappedData) ([]resolvedBinding, error) {
+	var resolved []resolvedBinding
+	var missing []string
+	for _, b := range manifest.Bindings {
+		value, ok := lookupBoundField(mappedData, b.Field)
+		if !ok {
+			value, ok = b.Default, b.Default != nil
+		}
+		if !ok {
+			if b.Required && !contains(missing, b.Field) {
+				missing = append(missing, b.Field)
+			}
+			continue
+		}
+		resolved = append(resolved, resolvedBinding{TemplateBinding: b, value: value})
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("required template fields have no value: %s", strings.Join(missing, ", "))
+	}
+	return resolved, nil
+}
+
+// lookupBoundField finds a field by its canonical name, ignoring case and
+// the difference between spaces, hyphens and underscores. Empty values count
+// as missing.
+func lookupBoundField(mappedData *MappedData, field string) (interface{}, bool) {
+	if mappedData == nil {
+		return nil, false
+	}
+	mf, ok := mappedData.Fields[field]
+	if !ok {
+		key := canonicalFieldName(field)
+		for name, candidate := range mappedData.Fields {
+			if canonicalFieldName(name) == key {
+				mf, ok = candidate, true
+				break
+			}
+		}
+	}
+	if !ok || mf.Value == nil || mf.Value == "" {
+		return nil, false
+	}
+	return mf.Value, true
+}
+
+func canonicalFieldName(name string) string {
+	return strings.NewReplacer(" ", "_", "-", "_").Replace(strings.ToLower(strings.TrimSpace(name)))
+}
+
+// unboundFields returns the mapped data without the fields the manifest
+// binds, for heuristic placement. It returns nil for strict manifests.
+func unboundFields(manifest *TemplateBindingManifest, mappedData *MappedData) *MappedData {
+	if manifest.Strict || mappedData == nil {
+		return nil
+	}
+	bound := make(map[string]bool)
+	for _, b := range manifest.Bindings {
+		bound[canonicalFieldName(b.Field)] = true
+	}
+	remaining := *mappedData
+	remaining.Fields = make(map[string]MappedField)
+	for name, field := range mappedData.Fields {
+		if !bound[canonicalFieldName(name)] {
+			remaining.Fields[name] = field
+		}
+	}
+	return &remaining
+}
+
+// bindingListValues returns the elements of a list value, or nil for
+// single values
+func bindingListValues(value interface{}) []interface{} {
+	v := reflect.ValueOf(value)
+	if v.Kind() != reflect.Slice || v.Type().Elem().Kind() == reflect.Uint8 {
+		return nil
+	}
+	values := make([]interface{}, v.Len())
+	for i := range values {
+		values[i] = v.Index(i).Interface()
+	}
+	return values
+}
+
+// bindingNumber reads a number, accepting text such as "$2.5m" or "(1,200)".
+// Percentages are returned as fractions.
+func bindingNumber(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case float32:
+		return float64(v), true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		n, err := v.Float64()
+		return n, err == nil
+	case string:
+		n, unit, ok := parseFinancialNumber(v)
+		if ok && unit == "%" {
+			n /= 100
+		}
+		return n, ok
+	}
+	return 0, false
+}
+
+// bindingPercent reads a percentage as a fraction. Numbers above 1 are taken
+// as percentages, so both 0.15 and 15 mean 15%.
+func bindingPercent(value interface{}) (float64, bool) {
+	n, ok := bindingNumber(value)
+	if !ok {
+		return 0, false
+	}
+	if s, isString := value.(string); isString && strings.HasSuffix(strings.TrimSpace(s), "%") {
+		return n, true
+	}
+	if n > 1 || n < -1 {
+		n /= 100
+	}
+	return n, true
+}
+
+func bindingDate(value interface{}) (time.Time, bool) {
+	switch v := value.(type) {
+	case time.Time:
+		return v, true
+	case string:
+		t, err := parseFlexibleDate(strings.TrimSpace(v))
+		return t, err == nil
+	}
+	return time.Time{}, false
+}
+
+// bindingDecimals returns the decimal places a binding shows in text
+func bindingDecimals(b TemplateBinding) int {
+	if b.Decimals != nil {
+		return *b.Decimals
+	}
+	if b.Format == BindingFormatPercent || bindingScales[b.Scale].divisor > 1 {
+		return 1
+	}
+	return 0
+}
+
+func (tp *TemplatePopulator) bindingContext(b TemplateBinding, templateType string) FormattingContext {
+	context := FormattingContext{
+		FieldName:    b.Field,
+		FieldType:    b.Format,
+		TemplateType: templateType,
+		Metadata:     make(map[string]interface{}),
+	}
+	if b.Unit != "" {
+		context.Metadata["currency"] = b.Unit
+	}
+	return context
+}
+
+// bindingCellValue converts a value to what a bound cell holds: numbers for
+// numeric formats, times for dates and text otherwise
+func (tp *TemplatePopulator) bindingCellValue(b TemplateBinding, value interface{}) (interface{}, error) {
+	scale := bindingScales[b.Scale].divisor
+	switch b.Format {
+	case "":
+		if n, ok := bindingNumber(value); ok && scale > 1 {
+			return n / scale, nil
+		}
+		return tp.formatValueForExcelWithContext(value, tp.bindingContext(b, "excel")), nil
+	case BindingFormatText:
+		return fmt.Sprintf("%v", value), nil
+	case BindingFormatNumber, BindingFormatCurrency:
+		n, ok := bindingNumber(value)
+		if !ok {
+			return nil, fmt.Errorf("field %s: %v is not a number", b.Field, value)
+		}
+		return n / scale, nil
+	case BindingFormatPercent:
+		n, ok := bindingPercent(value)
+		if !ok {
+			return nil, fmt.Errorf("field %s: %v is not a percentage", b.Field, value)
+		}
+		return n, nil
+	case BindingFormatDate:
+		t, ok := bindingDate(value)
+		if !ok {
+			return nil, fmt.Errorf("field %s: %v is not a date", b.Field, value)
+		}
+		return t, nil
+	}
+	return nil, fmt.Errorf("field %s: unknown format %q", b.Field, b.Format)
+}
+
+// bindingText renders a value for a placeholder. Lists are joined with
+// commas.
+func (tp *TemplatePopulator) bindingText(b TemplateBinding, value interface{}, templateType string) (string, error) {
+	if values := bindingListValues(value); values != nil {
+		parts := make([]string, len(values))
+		for i, v := range values {
+			text, err := tp.bindingText(b, v, templateType)
+			if err != nil {
+				return "", err
+			}
+			parts[i] = text
+		}
+		return strings.Join(parts, ", "), nil
+	}
+
+	pf := tp.professionalFormatter
+	scale := bindingScales[b.Scale]
+	switch b.Format {
+	case "":
+		if n, ok := bindingNumber(value); ok && scale.divisor > 1 {
+			return pf.formatNumberWithSeparators(n/scale.divisor, bindingDecimals(b)) + scale.suffix, nil
+		}
+		return tp.formatValueWithContext(value, tp.bindingContext(b, templateType)), nil
+	case BindingFormatText:
+		return fmt.Sprintf("%v", value), nil
+	case BindingFormatNumber, BindingFormatCurrency:
+		n, ok := bindingNumber(value)
+		if !ok {
+			return "", fmt.Errorf("field %s: %v is not a number", b.Field, value)
+		}
+		text := pf.formatNumberWithSeparators(n/scale.divisor, bindingDecimals(b)) + scale.suffix
+		if b.Format == BindingFormatNumber {
+			return text, nil
+		}
+		currency := b.Unit
+		if currency == "" {
+			currency = pf.currencyConfig.DefaultCurrency
+		}
+		symbol := pf.currencyConfig.CurrencySymbols[currency]
+		if symbol == "" {
+			symbol = currency + " "
+		}
+		if pf.currencyConfig.CurrencyPlacements[currency] == "after" {
+			return text + " " + strings.TrimSpace(symbol), nil
+		}
+		if strings.HasPrefix(text, "-") {
+			return "-" + symbol + text[1:], nil
+		}
+		return symbol + text, nil
+	case BindingFormatPercent:
+		n, ok := bindingPercent(value)
+		if !ok {
+			return "", fmt.Errorf("field %s: %v is not a percentage", b.Field, value)
+		}
+		return fmt.Sprintf("%.*f%%", bindingDecimals(b), n*100), nil
+	case BindingFormatDate:
+		t, ok := bindingDate(value)
+		if !ok {
+			return "", fmt.Errorf("field %s: %v is not a date", b.Field, value)
+		}
+		return t.Format(pf.dateConfig.DefaultFormat), nil
+	}
+	return "", fmt.Errorf("field %s: unknown format %q", b.Field, b.Format)
+}
+
+// populateWithBindings writes every bound field to its target. Unless the
+// manifest is strict, the remaining fields are then placed heuristically
+// without overwriting bound targets.
+func (tp *TemplatePopulator) populateWithBindings(templatePath string, templateData *TemplateData, manifest *TemplateBindingManifest, mappedData *MappedData, outputPath string) error {
+	bindings, err := resolveBindings(manifest, mappedData)
+	if err != nil {
+		return err
+	}
+	remaining := unboundFields(manifest, mappedData)
+
+	switch templateData.Format {
+	case "excel":
+		f, err := excelize.OpenFile(templatePath)
+		if err != nil {
+			return fmt.Errorf("failed to open Excel template: %w", err)
+		}
+		defer f.Close()
+
+		bound, err := tp.applyExcelBindings(f, templateData, bindings)
+		if err != nil {
+			return err
+		}
+		if bound, err = tp.expandExcelRepeatRows(f, remaining, bound); err != nil {
+			return err
+		}
+		if remaining != nil {
+			for _, sheet := range templateData.Sheets {
+				if err := tp.populateExcelSheet(f, sheet, remaining, bound); err != nil {
+					return fmt.Errorf("failed to populate sheet %s: %w", sheet.Name, err)
+				}
+			}
+		}
+		if err := f.SaveAs(outputPath); err != nil {
+			return fmt.Errorf("failed to save populated template: %w", err)
+		}
+		return nil
+
+	case "csv":
+		records, err := readCSVTemplate(templatePath)
+		if err != nil {
+			return err
+		}
+		bound, err := tp.applyCSVBindings(records, templateData, bindings)
+		if err != nil {
+			return err
+		}
+		if remaining != nil {
+			updated := tp.updateCSVRecords(records, templateData, remaining)
+			for cell := range bound {
+				updated[cell[0]][cell[1]] = records[cell[0]][cell[1]]
+			}
+			records = updated
+		}
+		return writeCSVOutput(outputPath, records)
+
+	case "text":
+		content, err := readTextTemplate(templatePath, templateData)
+		if err != nil {
+			return err
+		}
+		content = tp.expandTextLoops(content, remaining)
+		for _, b := range bindings {
+			text, err := tp.bindingText(b.TemplateBinding, b.value, "text")
+			if err != nil {
+				return err
+			}
+			content = strings.ReplaceAll(content, b.Placeholder, text)
+		}
+		if remaining != nil {
+			content = tp.fillTextPlaceholders(content, remaining)
+		}
+		return writeTextOutput(outputPath, content)
+
+	case "docx", "pptx":
+		kind, _ := ooxmlKindFor(templateData.Format)
+		return tp.populateOfficeTemplate(templatePath, kind, bindings, remaining, outputPath)
+	}
+	return fmt.Errorf("unsupported template format: %s", templateData.Format)
+}
+
+// applyExcelBindings writes bound values into a workbook and returns the
+// sheet-qualified cells written
+func (tp *TemplatePopulator) applyExcelBindings(f *excelize.File, templateData *TemplateData, bindings []resolvedBinding) (map[string]bool, error) {
+	bound := make(map[string]bool)
+	for _, b := range bindings {
+		if b.Placeholder != "" {
+			if err := tp.replaceExcelPlaceholder(f, b, bound); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		cells, err := bindingCells(b.TemplateBinding, templateData)
+		if err != nil {
+			return nil, err
+		}
+		values := bindingListValues(b.value)
+		if values == nil {
+			values = make([]interface{}, len(cells))
+			for i := range values {
+				values[i] = b.value
+			}
+		} else if len(values) > len(cells) {
+			return nil, fmt.Errorf("field %s has %d values but %s holds %d cells", b.Field, len(values), b.target(), len(cells))
+		}
+
+		for i, value := range values {
+			cellValue, err := tp.bindingCellValue(b.TemplateBinding, value)
+			if err != nil {
+				return nil, err
+			}
+			sheet, cell := splitBoundCell(cells[i])
+			if err := f.SetCellValue(sheet, cell, cellValue); err != nil {
+				return nil, fmt.Errorf("failed to set %s: %w", cells[i], err)
+			}
+			bound[cells[i]] = true
+		}
+	}
+	return bound, nil
+}
+
+// replaceExcelPlaceholder fills every cell containing a placeholder. A cell
+// holding only the placeholder takes the typed value so numbers stay numeric.
+func (tp *TemplatePopulator) replaceExcelPlaceholder(f *excelize.File, b resolvedBinding, bound map[string]bool) error {
+	for _, sheet := range f.GetSheetList() {
+		rows, err := f.GetRows(sheet, excelize.Options{RawCellValue: true})
+		if err != nil {
+			return fmt.Errorf("failed to get rows: %w", err)
+		}
+		for rowIdx, row := range rows {
+			for colIdx, text := range row {
+				if !strings.Contains(text, b.Placeholder) {
+					continue
+				}
+				cell, _ := excelize.CoordinatesToCellName(colIdx+1, rowIdx+1)
+				if formula, _ := f.GetCellFormula(sheet, cell); formula != "" {
+					continue
+				}
+
+				var value interface{}
+				var err error
+				if strings.TrimSpace(text) == b.Placeholder && bindingListValues(b.value) == nil {
+					value, err = tp.bindingCellValue(b.TemplateBinding, b.value)
+				} else {
+					var replacement string
+					replacement, err = tp.bindingText(b.TemplateBinding, b.value, "excel")
+					value = strings.ReplaceAll(text, b.Placeholder, replacement)
+				}
+				if err != nil {
+					return err
+				}
+				if err := f.SetCellValue(sheet, cell, value); err != nil {
+					return fmt.Errorf("failed to set %s!%s: %w", sheet, cell, err)
+				}
+				bound[sheet+"!"+cell] = true
+			}
+		}
+	}
+	return nil
+}
+
+// applyCSVBindings writes bound values into CSV records and returns the
+// [row, column] cells written
+func (tp *TemplatePopulator) applyCSVBindings(records [][]string, templateData *TemplateData, bindings []resolvedBinding) (map[[2]int]bool, error) {
+	bound := make(map[[2]int]bool)
+	for _, b := range bindings {
+		if b.Placeholder != "" {
+			text, err := tp.bindingText(b.TemplateBinding, b.value, "csv")
+			if err != nil {
+				return nil, err
+			}
+			for r, record := range records {
+				for c, cell := range record {
+					if strings.Contains(cell, b.Placeholder) {
+						records[r][c] = strings.ReplaceAll(cell, b.Placeholder, text)
+						bound[[2]int{r, c}] = true
+					}
+				}
+			}
+			continue
+		}
+
+		cells, err := bindingCells(b.TemplateBinding, templateData)
+		if err != nil {
+			return nil, err
+		}
+		values := bindingListValues(b.value)
+		if values == nil {
+			values = make([]interface{}, len(cells))
+			for i := range values {
+				values[i] = b.value
+			}
+		} else if len(values) > len(cells) {
+			return nil, fmt.Errorf("field %s has %d values but %s holds %d cells", b.Field, len(values), b.target(), len(cells))
+		}
+
+		for i, value := range values {
+			text, err := tp.bindingText(b.TemplateBinding, value, "csv")
+			if err != nil {
+				return nil, err
+			}
+			col, row, _ := excelize.CellNameToCoordinates(cells[i])
+			r, c := row-1, col-1
+			if r >= len(records) {
+				return nil, fmt.Errorf("%s is outside the template's %d rows", b.target(), len(records))
+			}
+			for len(records[r]) <= c {
+				records[r] = append(records[r], "")
+			}
+			records[r][c] = text
+			bound[[2]int{r, c}] = true
+		}
+	}
+	return bound, nil
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+// newBindingTestWorkbook writes a two-sheet model whose headers would lead
+// heuristic population astray
+func newBindingTestWorkbook(t *testing.T, dir string) string {
+	t.Helper()
+	f := excelize.NewFile()
+	defer f.Close()
+	require.NoError(t, f.SetSheetName("Sheet1", "Summary"))
+	_, err := f.NewSheet("Model")
+	require.NoError(t, err)
+
+	for cell, value := range map[string]string{
+		"A1": "Company", "B1": "Revenue", "A4": "Deal value", "A6": "Project {{target}}",
+	} {
+		require.NoError(t, f.SetCellValue("Summary", cell, value))
+	}
+	for cell, value := range map[string]string{
+		"A1": "Revenue", "A2": "EBITDA margin", "A3": "Closing", "A5": "Revenue by year",
+	} {
+		require.NoError(t, f.SetCellValue("Model", cell, value))
+	}
+	require.NoError(t, f.SetCellFormula("Model", "E5", "SUM(B5:D5)"))
+
+	path := filepath.Join(dir, "LBO Model.xlsx")
+	require.NoError(t, f.SaveAs(path))
+	return path
+}
+
+func bindingTestData(fields map[string]interface{}) *MappedData {
+	data := &MappedData{Fields: make(map[string]MappedField)}
+	for name, value := range fields {
+		data.Fields[name] = MappedField{FieldName: name, Value: value}
+	}
+	return data
+}
+
+func TestPopulateTemplate_ExcelBindings(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := newBindingTestWorkbook(t, dir)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "LBO Model.bindings.yaml"), []byte(`
+version: 1
+bindings:
+  - field: target_company
+    placeholder: "{{target}}"
+  - field: deal_value
+    cell: Summary!C4
+    format: currency
+    scale: millions
+    required: true
+  - field: ebitda_margin
+    cell: Model!B2
+    format: percent
+  - field: closing_date
+    cell: Model!B3
+    format: date
+  - field: revenue_by_year
+    range: Model!B5:D5
+    format: number
+    scale: thousands
+  - field: currency
+    cell: Model!B1
+    default: USD
+  - field: enterprise_value
+    cell: Summary!B5
+    format: number
+`), 0644))
+
+	populator := NewTemplatePopulator(NewTemplateParser(dir))
+	outputPath := filepath.Join(dir, "out.xlsx")
+	data := bindingTestData(map[string]interface{}{
+		"Target Company":   "Acme Corp",
+		"deal_value":       "$2.5m",
+		"ebitda_margin":    18.5,
+		"closing_date":     "2024-06-30",
+		"revenue_by_year":  []interface{}{1200000.0, 1450000.0, 1700000.0},
+		"enterprise_value": 3000000,
+		"Revenue":          999.0,
+	})
+	require.NoError(t, populator.PopulateTemplate(templatePath, data, outputPath))
+
+	f, err := excelize.OpenFile(outputPath)
+	require.NoError(t, err)
+	defer f.Close()
+	get := func(sheet, cell string) string {
+		value, err := f.GetCellValue(sheet, cell, excelize.Options{RawCellValue: true})
+		require.NoError(t, err)
+		return value
+	}
+
+	assert.Equal(t, "Project Acme Corp", get("Summary", "A6"))
+	assert.Equal(t, "2.5", get("Summary", "C4"))
+	assert.Equal(t, "0.185", get("Model", "B2"))
+	assert.Equal(t, "45473", get("Model", "B3"))
+	assert.Equal(t, []string{"1200", "1450", "1700"}, []string{get("Model", "B5"), get("Model", "C5"), get("Model", "D5")})
+	assert.Equal(t, "USD", get("Model", "B1"), "defaults fill fields without a value")
+
+	formula, err := f.GetCellFormula("Model", "E5")
+	require.NoError(t, err)
+	assert.Equal(t, "SUM(B5:D5)", formula)
+
+	// Unbound fields are still placed under matching headers, but never
+	// over bound cells
+	assert.Equal(t, "999", get("Summary", "B2"))
+	assert.Equal(t, "3000000", get("Summary", "B5"))
+
+	// Required fields must have a value
+	delete(data.Fields, "deal_value")
+	err = populator.PopulateTemplate(templatePath, data, outputPath)
+	assert.ErrorContains(t, err, "required template fields have no value: deal_value")
+}
+
+func TestTemplateBindings_Validate(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := newBindingTestWorkbook(t, dir)
+	sidecar := filepath.Join(dir, "LBO Model.bindings.json")
+	require.NoError(t, os.WriteFile(sidecar, []byte(`{
+  "bindings": [
+    {"field": "deal_value", "cell": "C4"},
+    {"field": "revenue", "cell": "Forecast!B2"},
+    {"field": "total", "cell": "Model!E5"},
+    {"field": "margin", "cell": "Model!B2", "placeholder": "{{margin}}"},
+    {"field": "ebitda", "range": "Model!D5:B5"},
+    {"field": "close", "cell": "Model!B3", "format": "datetime"},
+    {"field": "sponsor", "placeholder": "{{sponsor}}"},
+    {"field": "net_debt", "cell": "Model!ZZZZ1"},
+    {"field": "ev", "cell": "Model!C7"},
+    {"field": "equity", "cell": "Model!C7"}
+  ]
+}`), 0644))
+
+	discovery := NewTemplateDiscovery(nil)
+	bindings, err := discovery.ValidateTemplateBindings(templatePath)
+	require.NotNil(t, bindings)
+	var bindingErr *TemplateBindingError
+	require.True(t, errors.As(err, &bindingErr), "%v", err)
+	assert.Equal(t, []string{
+		"binding 1 (deal_value): cell C4 must name its sheet in a workbook with 2 sheets",
+		`binding 2 (revenue): sheet "Forecast" does not exist`,
+		"binding 3 (total): cell Model!E5 holds the formula SUM(B5:D5)",
+		"binding 4 (margin): exactly one of cell, range or placeholder is required",
+		"binding 5 (ebitda): range Model!D5:B5 is reversed",
+		`binding 6 (close): unknown format "datetime"`,
+		`binding 7 (sponsor): placeholder "{{sponsor}}" does not appear in the template`,
+		`binding 8 (net_debt): invalid cell "ZZZZ1"`,
+		"binding 10 (equity): cell Model!C7 is also bound by binding 9",
+	}, bindingErr.Problems)
+
+	// Population refuses invalid manifests rather than guessing
+	err = NewTemplatePopulator(NewTemplateParser(dir)).PopulateTemplate(templatePath, bindingTestData(nil), filepath.Join(dir, "out.xlsx"))
+	assert.ErrorAs(t, err, &bindingErr)
+
+	// Misspelt keys are reported
+	require.NoError(t, os.WriteFile(sidecar, []byte(`{"bindings": [{"field": "deal_value", "cel": "Summary!C4"}]}`), 0644))
+	_, err = LoadTemplateBindings(templatePath)
+	assert.ErrorContains(t, err, `unknown field "cel"`)
+}
+
+func TestPopulateTemplate_TextBindingsFromMetadata(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "teaser.md")
+	require.NoError(t, os.WriteFile(templatePath, []byte("# {{target}}\n\nConsideration: {{price}} ({{margin}} EBITDA margin)\nSector: [Industry]\nClosing: {{closing}}\n"), 0644))
+
+	discovery := NewTemplateDiscovery(nil)
+	require.NoError(t, discovery.SaveTemplateMetadata(templatePath, &TemplateMetadata{
+		Name: "Teaser",
+		Properties: map[string]interface{}{
+			"bindings": map[string]interface{}{
+				"bindings": []map[string]interface{}{
+					{"field": "target company", "placeholder": "{{target}}", "format": "text"},
+					{"field": "purchase_price", "placeholder": "{{price}}", "format": "currency", "unit": "EUR", "scale": "millions"},
+					{"field": "ebitda_margin", "placeholder": "{{margin}}", "format": "percent"},
+					{"field": "closing_date", "placeholder": "{{closing}}", "format": "date"},
+				},
+			},
+		},
+	}))
+
+	outputPath := filepath.Join(dir, "out.md")
+	data := bindingTestData(map[string]interface{}{
+		"target_company": "Acme Corp",
+		"purchase_price": 1250000000.0,
+		"ebitda_margin":  0.215,
+		"closing_date":   time.Date(2024, 9, 30, 0, 0, 0, 0, time.UTC),
+		"industry":       "Industrial Software",
+	})
+	require.NoError(t, NewTemplatePopulator(NewTemplateParser(dir)).PopulateTemplate(templatePath, data, outputPath))
+
+	output, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	assert.Equal(t, "# Acme Corp\n\nConsideration: €1,250.0m (21.5% EBITDA margin)\nSector: Industrial Software\nClosing: September 30, 2024\n", string(output))
+}
+
+func TestPopulateTemplate_StrictCSVBindings(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "comps.csv")
+	require.NoError(t, os.WriteFile(templatePath, []byte("Company,Revenue,Multiple\n[To be filled],,\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "comps.bindings.yml"), []byte(`
+strict: true
+bindings:
+  - field: company_name
+    cell: A2
+  - field: ev_multiple
+    cell: C2
+    format: number
+    decimals: 1
+`), 0644))
+
+	outputPath := filepath.Join(dir, "out.csv")
+	data := bindingTestData(map[string]interface{}{"company_name": "Acme Corp", "ev_multiple": "8.26x", "Revenue": 5000000.0})
+	require.NoError(t, NewTemplatePopulator(NewTemplateParser(dir)).PopulateTemplate(templatePath, data, outputPath))
+
+	output, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	assert.Equal(t, "Company,Revenue,Multiple\nAcme Corp,,8.3\n", string(output), "strict manifests leave unbound fields out")
+}
+
+func TestTemplateBindingsFollowCopies(t *testing.T) {
+	tempDir := t.TempDir()
+	cs := &ConfigService{config: &Config{DealDoneRoot: filepath.Join(tempDir, "DealDone")}}
+	tm := NewTemplateManager(cs)
+	require.NoError(t, os.MkdirAll(cs.GetTemplatesPath(), 0755))
+
+	templatePath := newBindingTestWorkbook(t, cs.GetTemplatesPath())
+	require.NoError(t, os.WriteFile(filepath.Join(cs.GetTemplatesPath(), "LBO Model.bindings.yaml"), []byte("bindings:\n  - field: deal_value\n    cell: Summary!C4\n"), 0644))
+
+	templates, err := NewTemplateDiscovery(tm).DiscoverTemplates()
+	require.NoError(t, err)
+	require.Len(t, templates, 1)
+	require.NotNil(t, templates[0].Bindings)
+	assert.Empty(t, templates[0].BindingProblems)
+
+	copyPath, err := tm.CopyTemplateToAnalysis(templatePath, "Acme")
+	require.NoError(t, err)
+	bindings, err := LoadTemplateBindings(copyPath)
+	require.NoError(t, err)
+	require.NotNil(t, bindings)
+	assert.Equal(t, "Summary!C4", bindings.Bindings[0].Cell)
+	assert.True(t, strings.HasSuffix(bindings.Source, ".bindings.json"))
+}
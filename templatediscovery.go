@@ -2,6 +2,7 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
@@ -40,8 +41,10 @@ type TemplateField struct {
 // TemplateInfo combines file info with metadata
 type TemplateInfo struct {
 	Template
-	Metadata    *TemplateMetadata `json:"metadata,omitempty"`
-	HasMetadata bool              `json:"has_metadata"`
+	Metadata        *TemplateMetadata        `json:"metadata,omitempty"`
+	HasMetadata     bool                     `json:"has_metadata"`
+	Bindings        *TemplateBindingManifest `json:"bindings,omitempty"`
+	BindingProblems []string                 `json:"binding_problems,omitempty"` // Why the bindings cannot be used
 }
 
 // TemplateDiscovery handles advanced template discovery and management
@@ -85,6 +88,15 @@ func (td *TemplateDiscovery) DiscoverTemplates() ([]TemplateInfo, error) {
 			info.Metadata = td.generateBasicMetadata(&template)
 		}
 
+		bindings, err := td.ValidateTemplateBindings(template.Path)
+		info.Bindings = bindings
+		var bindingErr *TemplateBindingError
+		if errors.As(err, &bindingErr) {
+			info.BindingProblems = bindingErr.Problems
+		} else if err != nil {
+			info.BindingProblems = []string{err.Error()}
+		}
+
 		templateInfos = append(templateInfos, info)
 	}
 
@@ -116,6 +128,22 @@ func (td *TemplateDiscovery) loadTemplateMetadata(templatePath string) (*Templat
 	return &metadata, nil
 }
 
+// ValidateTemplateBindings loads a template's binding manifest and checks it
+// against the template. It returns nil when the template has no manifest;
+// invalid manifests are returned with a *TemplateBindingError.
+func (td *TemplateDiscovery) ValidateTemplateBindings(templatePath string) (*TemplateBindingManifest, error) {
+	bindings, err := LoadTemplateBindings(templatePath)
+	if err != nil || bindings == nil {
+		return nil, err
+	}
+
+	templateData, err := NewTemplateParser(filepath.Dir(templatePath)).ParseTemplate(templatePath)
+	if err != nil {
+		return bindings, fmt.Errorf("failed to parse template: %w", err)
+	}
+	return bindings, bindings.Validate(templateData)
+}
+
 // generateBasicMetadata creates basic metadata from file information
 func (td *TemplateDiscovery) generateBasicMetadata(template *Template) *TemplateMetadata {
 	// Determine category from path or name
@@ -348,6 +376,13 @@ func (td *TemplateDiscovery) ImportTemplate(sourcePath string, metadata *Templat
 		return fmt.Errorf("failed to copy file: %w", err)
 	}
 
+	if err := copyTemplateBindings(sourcePath, destPath); err != nil {
+		return fmt.Errorf("failed to copy template bindings: %w", err)
+	}
+	if err := copyModelCheckConfig(sourcePath, destPath); err != nil {
+		return fmt.Errorf("failed to copy template checks: %w", err)
+	}
+
 	// Save metadata if provided
 	if metadata != nil {
 		metadata.CreatedAt = time.Now()
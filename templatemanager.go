@@ -149,6 +149,15 @@ func (tm *TemplateManager) CopyTemplateToAnalysis(templatePath, dealName string)
 	analysisName := tm.generateAnalysisFilename(baseName, ext)
 	destPath := filepath.Join(analysisPath, analysisName)
 
+	// The copy is populated through the template's bindings and checked
+	// against its checks
+	if err := copyTemplateBindings(templatePath, destPath); err != nil {
+		return "", fmt.Errorf("failed to copy template bindings: %w", err)
+	}
+	if err := copyModelCheckConfig(templatePath, destPath); err != nil {
+		return "", fmt.Errorf("failed to copy template checks: %w", err)
+	}
+
 	// Check if file already exists - if so, skip copying to avoid duplicates
 	if _, err := os.Stat(destPath); err == nil {
 		// File already exists, return the existing path
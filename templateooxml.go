@@ -0,0 +1,602 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"html"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// ooxmlKind describes where a Word or PowerPoint package keeps its text.
+// Prefix is the namespace prefix of the paragraph markup: WordprocessingML
+// in Word, DrawingML in PowerPoint.
+type ooxmlKind struct {
+	format string
+	prefix string
+	parts  *regexp.Regexp // parts whose placeholders are filled
+	tags   *regexp.Regexp // paragraph and text element tags
+}
+
+var (
+	docxKind = newOOXMLKind("docx", "w", `^word/(document|header\d*|footer\d*|footnotes|endnotes)\.xml$`)
+	pptxKind = newOOXMLKind("pptx", "a", `^ppt/(slides/slide|notesSlides/notesSlide)\d+\.xml$`)
+)
+
+func newOOXMLKind(format, prefix, parts string) ooxmlKind {
+	return ooxmlKind{
+		format: format,
+		prefix: prefix,
+		parts:  regexp.MustCompile(parts),
+		tags:   regexp.MustCompile(`<(/?)` + prefix + `:(p|t)(?:\s[^>]*)?/?>`),
+	}
+}
+
+// ooxmlKindFor returns the kind of an OOXML template format
+func ooxmlKindFor(format string) (ooxmlKind, bool) {
+	switch format {
+	case docxKind.format:
+		return docxKind, true
+	case pptxKind.format:
+		return pptxKind, true
+	}
+	return ooxmlKind{}, false
+}
+
+// ooxmlPlaceholderPattern matches {{Field}}, {Field} and [Field] placeholders
+var ooxmlPlaceholderPattern = regexp.MustCompile(`\{\{[^{}]+\}\}|\{[^{}]+\}|\[[^\[\]]+\]`)
+
+// ooxmlParaIDPattern matches the paragraph ids Word expects to be unique
+var ooxmlParaIDPattern = regexp.MustCompile(`\s+w14:(?:paraId|textId)="[^"]*"`)
+
+// ooxmlTextNode is a text element (w:t or a:t) within a part
+type ooxmlTextNode struct {
+	tagStart int // offset of the opening tag
+	tagEnd   int // offset just past the opening tag, where the content starts
+	end      int // offset of the closing tag
+	text     string
+}
+
+// ooxmlParagraphs returns the text elements of each paragraph in document
+// order. Paragraphs nested in text boxes are returned separately.
+func ooxmlParagraphs(markup string, kind ooxmlKind) [][]ooxmlTextNode {
+	closeText := "</" + kind.prefix + ":t>"
+	var stack, paragraphs [][]ooxmlTextNode
+	for _, m := range kind.tags.FindAllStringSubmatchIndex(markup, -1) {
+		closing := m[3] > m[2]
+		selfClosing := markup[m[1]-2] == '/'
+		switch name := markup[m[4]:m[5]]; {
+		case name == "p" && closing:
+			if len(stack) > 0 {
+				if top := stack[len(stack)-1]; len(top) > 0 {
+					paragraphs = append(paragraphs, top)
+				}
+				stack = stack[:len(stack)-1]
+			}
+		case name == "p" && !selfClosing:
+			stack = append(stack, nil)
+		case name == "t" && !closing && !selfClosing && len(stack) > 0:
+			end := strings.Index(markup[m[1]:], closeText)
+			if end < 0 {
+				continue
+			}
+			stack[len(stack)-1] = append(stack[len(stack)-1], ooxmlTextNode{
+				tagStart: m[0],
+				tagEnd:   m[1],
+				end:      m[1] + end,
+				text:     html.UnescapeString(markup[m[1] : m[1]+end]),
+			})
+		}
+	}
+	return paragraphs
+}
+
+// ooxmlParagraphText joins the text of a paragraph's runs
+func ooxmlParagraphText(nodes []ooxmlTextNode) string {
+	var sb strings.Builder
+	for _, node := range nodes {
+		sb.WriteString(node.text)
+	}
+	return sb.String()
+}
+
+// ooxmlText returns the text of markup, one line per paragraph
+func ooxmlText(markup string, kind ooxmlKind) string {
+	paragraphs := ooxmlParagraphs(markup, kind)
+	lines := make([]string, len(paragraphs))
+	for i, nodes := range paragraphs {
+		lines[i] = ooxmlParagraphText(nodes)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ooxmlMatch is a span of paragraph text and what replaces it
+type ooxmlMatch struct {
+	start, end int
+	value      string
+}
+
+// ooxmlReplace rewrites the text of each paragraph in markup. Placeholders
+// may span several runs: the value goes into the run where the placeholder
+// starts, keeping that run's formatting, and the rest of the placeholder is
+// removed from the runs that follow.
+func ooxmlReplace(markup string, kind ooxmlKind, find func(text string) []ooxmlMatch) string {
+	type edit struct {
+		start, end int
+		markup     string
+	}
+	var edits []edit
+
+	for _, nodes := range ooxmlParagraphs(markup, kind) {
+		matches := find(ooxmlParagraphText(nodes))
+		if len(matches) == 0 {
+			continue
+		}
+
+		texts := make([]string, len(nodes))
+		offsets := make([]int, len(nodes))
+		offset := 0
+		for i, node := range nodes {
+			texts[i] = node.text
+			offsets[i] = offset
+			offset += len(node.text)
+		}
+		nodeAt := func(pos int) int {
+			return sort.Search(len(offsets), func(i int) bool { return offsets[i] > pos }) - 1
+		}
+
+		// Later matches first, so the offsets of earlier ones stay valid
+		sort.Slice(matches, func(i, j int) bool { return matches[i].start > matches[j].start })
+		for _, m := range matches {
+			first, last := nodeAt(m.start), nodeAt(m.end-1)
+			tail := texts[last][m.end-offsets[last]:]
+			for k := first + 1; k <= last; k++ {
+				texts[k] = ""
+			}
+			texts[first] = texts[first][:m.start-offsets[first]] + m.value
+			if first == last {
+				texts[first] += tail
+			} else {
+				texts[last] = tail
+			}
+		}
+
+		for i, node := range nodes {
+			if texts[i] == node.text {
+				continue
+			}
+			tag := markup[node.tagStart:node.tagEnd]
+			if kind.prefix == "w" && texts[i] != strings.TrimSpace(texts[i]) && !strings.Contains(tag, "xml:space") {
+				tag = `<w:t xml:space="preserve">`
+			}
+			edits = append(edits, edit{node.tagStart, node.end, tag + ooxmlEscape(texts[i])})
+		}
+	}
+
+	if len(edits) == 0 {
+		return markup
+	}
+	sort.Slice(edits, func(i, j int) bool { return edits[i].start < edits[j].start })
+	var sb strings.Builder
+	last := 0
+	for _, e := range edits {
+		sb.WriteString(markup[last:e.start])
+		sb.WriteString(e.markup)
+		last = e.end
+	}
+	sb.WriteString(markup[last:])
+	return sb.String()
+}
+
+func ooxmlEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// ooxmlElements returns the spans of the outermost name elements in markup
+func ooxmlElements(markup, name string) [][2]int {
+	tag := regexp.MustCompile(`<(/?)` + regexp.QuoteMeta(name) + `(?:\s[^>]*)?/?>`)
+	var spans [][2]int
+	depth, start := 0, 0
+	for _, m := range tag.FindAllStringSubmatchIndex(markup, -1) {
+		switch {
+		case m[3] > m[2]:
+			if depth--; depth == 0 {
+				spans = append(spans, [2]int{start, m[1]})
+			}
+			depth = max(depth, 0)
+		case markup[m[1]-2] == '/':
+			if depth == 0 {
+				spans = append(spans, [2]int{m[0], m[1]})
+			}
+		default:
+			if depth == 0 {
+				start = m[0]
+			}
+			depth++
+		}
+	}
+	return spans
+}
+
+// replaceElements rewrites each outermost name element in markup
+func replaceElements(markup, name string, rewrite func(element string) string) string {
+	spans := ooxmlElements(markup, name)
+	var sb strings.Builder
+	last := 0
+	for _, span := range spans {
+		sb.WriteString(markup[last:span[0]])
+		sb.WriteString(rewrite(markup[span[0]:span[1]]))
+		last = span[1]
+	}
+	sb.WriteString(markup[last:])
+	return sb.String()
+}
+
+// parseOfficeTemplate parses a Word or PowerPoint template. Its placeholders
+// become the headers, as for text templates.
+func (tp *TemplateParser) parseOfficeTemplate(filePath string, kind ooxmlKind) (*TemplateData, error) {
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s template: %w", strings.ToUpper(kind.format), err)
+	}
+	defer reader.Close()
+
+	var texts, parts []string
+	tables := 0
+	for _, name := range sortedZipNames(&reader.Reader) {
+		if !kind.parts.MatchString(name) {
+			continue
+		}
+		data, err := readZipEntry(&reader.Reader, name)
+		if err != nil {
+			return nil, err
+		}
+		markup := string(data)
+		parts = append(parts, name)
+		texts = append(texts, ooxmlText(markup, kind))
+		tables += len(ooxmlElements(markup, kind.prefix+":tbl"))
+	}
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("%s template has no document content", strings.ToUpper(kind.format))
+	}
+	content := strings.Join(texts, "\n")
+
+	headers := []string{}
+	for _, placeholder := range ooxmlPlaceholderPattern.FindAllString(content, -1) {
+		name := strings.TrimSpace(strings.Trim(placeholder, "{}[]"))
+		if name != "" && !tp.containsString(headers, name) {
+			headers = append(headers, name)
+		}
+	}
+	data := [][]string{make([]string, len(headers))}
+	if len(headers) == 0 {
+		headers = []string{"Content"}
+		data = [][]string{{content}}
+	}
+
+	return &TemplateData{
+		Format:   kind.format,
+		Headers:  headers,
+		Data:     data,
+		Formulas: make(map[string]string),
+		Sheets:   []SheetData{},
+		Metadata: map[string]interface{}{
+			"fileName":        filepath.Base(filePath),
+			"originalContent": content,
+			"parts":           parts,
+			"tables":          tables,
+		},
+	}, nil
+}
+
+// ooxmlFiller fills the placeholders and tables of a Word or PowerPoint
+// package
+type ooxmlFiller struct {
+	tp       *TemplatePopulator
+	kind     ooxmlKind
+	bindings []resolvedBinding
+	data     *MappedData // fields placed heuristically; nil when none are
+	filled   map[string]string
+	err      error
+}
+
+// populateOfficeTemplate writes a copy of a Word or PowerPoint template with
+// its document, header, footer and slide text filled in. Every other part,
+// including styles, charts and their embedded workbooks, is copied as is.
+func (tp *TemplatePopulator) populateOfficeTemplate(templatePath string, kind ooxmlKind, bindings []resolvedBinding, mappedData *MappedData, outputPath string) error {
+	reader, err := zip.OpenReader(templatePath)
+	if err != nil {
+		return fmt.Errorf("failed to open %s template: %w", strings.ToUpper(kind.format), err)
+	}
+	defer reader.Close()
+
+	filler := &ooxmlFiller{tp: tp, kind: kind, bindings: bindings, data: mappedData, filled: make(map[string]string)}
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, file := range reader.File {
+		if !kind.parts.MatchString(file.Name) {
+			if err := zw.Copy(file); err != nil {
+				return fmt.Errorf("failed to copy %s: %w", file.Name, err)
+			}
+			continue
+		}
+
+		data, err := readZipEntry(&reader.Reader, file.Name)
+		if err != nil {
+			return err
+		}
+		markup := filler.fillPart(string(data))
+		if filler.err != nil {
+			return filler.err
+		}
+		w, err := zw.CreateHeader(&zip.FileHeader{Name: file.Name, Method: file.Method, Modified: file.Modified})
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.Name, err)
+		}
+		if _, err := io.WriteString(w, markup); err != nil {
+			return fmt.Errorf("failed to write %s: %w", file.Name, err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("failed to write populated template: %w", err)
+	}
+
+	return writeFileDurable(outputPath, buf.Bytes(), 0644)
+}
+
+// fillPart repeats list rows, fills labelled table cells and then replaces
+// the remaining placeholders of one part
+func (f *ooxmlFiller) fillPart(markup string) string {
+	markup = replaceElements(markup, f.kind.prefix+":tr", f.repeatRow)
+	markup = replaceElements(markup, f.kind.prefix+":tbl", func(table string) string {
+		// A table whose only rows were for empty lists goes too
+		if len(ooxmlElements(table, f.kind.prefix+":tr")) == 0 {
+			return ""
+		}
+		return table
+	})
+	if f.data != nil {
+		markup = replaceElements(markup, f.kind.prefix+":tr", f.fillLabelledCells)
+	}
+	return ooxmlReplace(markup, f.kind, func(text string) []ooxmlMatch { return f.find(text, nil) })
+}
+
+// repeatRow copies a table row once per item of the list fields its
+// {{list}} or {{list.key}} placeholders name. Rows for empty lists are
+// removed.
+func (f *ooxmlFiller) repeatRow(row string) string {
+	if f.data == nil {
+		return row
+	}
+	lists, count := rowLists(ooxmlText(row, f.kind), f.data)
+	if len(lists) == 0 {
+		return row
+	}
+
+	var sb strings.Builder
+	for i := 0; i < count; i++ {
+		repeated := ooxmlReplace(row, f.kind, func(text string) []ooxmlMatch {
+			return f.find(text, func(name, key string) (string, bool) {
+				items, ok := lists[canonicalFieldName(name)]
+				if !ok {
+					return "", false
+				}
+				if i >= len(items) {
+					return "", true
+				}
+				return f.itemText(items[i], name, key), true
+			})
+		})
+		if i > 0 && f.kind.prefix == "w" {
+			repeated = ooxmlParaIDPattern.ReplaceAllString(repeated, "")
+		}
+		sb.WriteString(repeated)
+	}
+	return sb.String()
+}
+
+// itemText renders a list item, or one of its fields
+func (f *ooxmlFiller) itemText(item interface{}, name, key string) string {
+	if key == "" {
+		return f.format(name, item)
+	}
+	if value, ok := listItemValue(item, key); ok {
+		return f.format(key, value)
+	}
+	return ""
+}
+
+// fillLabelledCells fills empty cells whose left neighbour is the label of
+// a mapped field, as in key terms tables
+func (f *ooxmlFiller) fillLabelledCells(row string) string {
+	cells := ooxmlElements(row, f.kind.prefix+":tc")
+	var sb strings.Builder
+	last := 0
+	for i := 1; i < len(cells); i++ {
+		cell := row[cells[i][0]:cells[i][1]]
+		if strings.TrimSpace(ooxmlText(cell, f.kind)) != "" {
+			continue
+		}
+		label := strings.TrimSpace(strings.TrimSuffix(strings.TrimSpace(ooxmlText(row[cells[i-1][0]:cells[i-1][1]], f.kind)), ":"))
+		if label == "" {
+			continue
+		}
+		value, ok := lookupBoundField(f.data, label)
+		if !ok {
+			continue
+		}
+		filled, ok := f.insertText(cell, f.format(label, value))
+		if !ok {
+			continue
+		}
+		sb.WriteString(row[last:cells[i][0]])
+		sb.WriteString(filled)
+		last = cells[i][1]
+	}
+	sb.WriteString(row[last:])
+	return sb.String()
+}
+
+// insertText adds a run holding text to the first paragraph of an empty
+// cell, formatted like the paragraph's own mark
+func (f *ooxmlFiller) insertText(cell, text string) (string, bool) {
+	p := f.kind.prefix
+	paragraphs := ooxmlElements(cell, p+":p")
+	if len(paragraphs) == 0 {
+		return cell, false
+	}
+	span := paragraphs[0]
+	paragraph := cell[span[0]:span[1]]
+
+	var props, run string
+	if p == "w" {
+		if spans := ooxmlElements(paragraph, "w:rPr"); len(spans) > 0 {
+			props = paragraph[spans[0][0]:spans[0][1]]
+		}
+		run = `<w:r>` + props + `<w:t xml:space="preserve">` + ooxmlEscape(text) + `</w:t></w:r>`
+	} else {
+		if spans := ooxmlElements(paragraph, "a:endParaRPr"); len(spans) > 0 {
+			props = paragraph[spans[0][0]:spans[0][1]]
+			props = "<a:rPr" + strings.TrimPrefix(props, "<a:endParaRPr")
+			props = strings.Replace(props, "</a:endParaRPr>", "</a:rPr>", 1)
+		}
+		run = `<a:r>` + props + `<a:t>` + ooxmlEscape(text) + `</a:t></a:r>`
+	}
+
+	switch {
+	case strings.HasSuffix(paragraph, "/>"):
+		paragraph = strings.TrimSuffix(paragraph, "/>") + ">" + run + "</" + p + ":p>"
+	case p == "a" && strings.Contains(paragraph, "<a:endParaRPr"):
+		i := strings.Index(paragraph, "<a:endParaRPr")
+		paragraph = paragraph[:i] + run + paragraph[i:]
+	default:
+		i := strings.LastIndex(paragraph, "</"+p+":p>")
+		paragraph = paragraph[:i] + run + paragraph[i:]
+	}
+	return cell[:span[0]] + paragraph + cell[span[1]:], true
+}
+
+// find locates the placeholders in a paragraph's text and what replaces
+// them: binding placeholders first, then list items of a repeated row, then
+// mapped fields
+func (f *ooxmlFiller) find(text string, item func(name, key string) (string, bool)) []ooxmlMatch {
+	var matches []ooxmlMatch
+	taken := func(start, end int) bool {
+		for _, m := range matches {
+			if start < m.end && m.start < end {
+				return true
+			}
+		}
+		return false
+	}
+
+	for _, b := range f.bindings {
+		if b.Placeholder == "" {
+			continue
+		}
+		for from := 0; ; {
+			i := strings.Index(text[from:], b.Placeholder)
+			if i < 0 {
+				break
+			}
+			start, end := from+i, from+i+len(b.Placeholder)
+			from = end
+			if taken(start, end) {
+				continue
+			}
+			value, err := f.tp.bindingText(b.TemplateBinding, b.value, f.kind.format)
+			if err != nil {
+				f.err = err
+				return nil
+			}
+			matches = append(matches, ooxmlMatch{start, end, value})
+		}
+	}
+
+	for _, span := range ooxmlPlaceholderPattern.FindAllStringIndex(text, -1) {
+		if taken(span[0], span[1]) {
+			continue
+		}
+		if value, ok := f.placeholderValue(text[span[0]:span[1]], item); ok {
+			matches = append(matches, ooxmlMatch{span[0], span[1], value})
+		}
+	}
+	return matches
+}
+
+// placeholderValue resolves a single placeholder
+func (f *ooxmlFiller) placeholderValue(placeholder string, item func(name, key string) (string, bool)) (string, bool) {
+	if item != nil {
+		if m := listPlaceholderPattern.FindStringSubmatch(placeholder); m != nil && m[0] == placeholder {
+			if value, ok := item(m[1], m[2]); ok {
+				return value, true
+			}
+		}
+	}
+	if f.data == nil {
+		return "", false
+	}
+
+	name := strings.TrimSpace(strings.Trim(placeholder, "{}[]"))
+	if value, ok := lookupBoundField(f.data, name); ok {
+		if items := bindingListValues(value); items != nil {
+			parts := make([]string, len(items))
+			for i, v := range items {
+				parts[i] = f.format(name, v)
+			}
+			return strings.Join(parts, ", "), true
+		}
+		return f.format(name, value), true
+	}
+
+	// The text heuristics know placeholders by their bracketed spelling
+	bracketed := "[" + name + "]"
+	value, ok := f.filled[bracketed]
+	if !ok {
+		value = f.tp.fillTextPlaceholders(bracketed, f.data)
+		f.filled[bracketed] = value
+	}
+	return value, value != bracketed
+}
+
+func (f *ooxmlFiller) format(name string, value interface{}) string {
+	return f.tp.formatValueWithContext(value, FormattingContext{
+		FieldName:    name,
+		TemplateType: f.kind.format,
+		Metadata:     make(map[string]interface{}),
+	})
+}
+
+// validateOfficeTemplate checks that the filled parts of a populated Word or
+// PowerPoint file are well-formed XML
+func (tp *TemplatePopulator) validateOfficeTemplate(filePath string, kind ooxmlKind) error {
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return fmt.Errorf("failed to open file for validation: %w", err)
+	}
+	defer reader.Close()
+
+	for _, file := range reader.File {
+		if !kind.parts.MatchString(file.Name) {
+			continue
+		}
+		data, err := readZipEntry(&reader.Reader, file.Name)
+		if err != nil {
+			return err
+		}
+		decoder := xml.NewDecoder(bytes.NewReader(data))
+		for {
+			if _, err := decoder.Token(); err == io.EOF {
+				break
+			} else if err != nil {
+				return fmt.Errorf("%s is not well-formed: %w", file.Name, err)
+			}
+		}
+	}
+	return nil
+}
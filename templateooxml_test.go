@@ -0,0 +1,221 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+const (
+	testWordNamespaces  = `xmlns:w="http://schemas.openxmlformats.org/wordprocessingml/2006/main" xmlns:w14="http://schemas.microsoft.com/office/word/2010/wordml"`
+	testSlideNamespaces = `xmlns:a="http://schemas.openxmlformats.org/drawingml/2006/main" xmlns:p="http://schemas.openxmlformats.org/presentationml/2006/main"`
+)
+
+// testChartWorkbook returns the bytes of a workbook embedded behind a chart
+func testChartWorkbook(t *testing.T) string {
+	t.Helper()
+	f := excelize.NewFile()
+	defer f.Close()
+	require.NoError(t, f.SetCellValue("Sheet1", "A1", "Year"))
+	require.NoError(t, f.SetCellValue("Sheet1", "B1", "Revenue"))
+	require.NoError(t, f.SetCellValue("Sheet1", "A2", 2023))
+	require.NoError(t, f.SetCellValue("Sheet1", "B2", 1450))
+	buf, err := f.WriteToBuffer()
+	require.NoError(t, err)
+	return buf.String()
+}
+
+// writeMemoFixture writes an IC memo whose placeholders are split across
+// runs the way Word saves them after editing
+func writeMemoFixture(t *testing.T, path string) map[string]string {
+	t.Helper()
+	entries := map[string]string{
+		"[Content_Types].xml": `<?xml version="1.0" encoding="UTF-8"?><Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types"/>`,
+		"word/styles.xml":     `<w:styles ` + testWordNamespaces + `><w:style w:styleId="Heading1"><w:name w:val="heading 1"/></w:style></w:styles>`,
+		"word/document.xml": `<?xml version="1.0" encoding="UTF-8" standalone="yes"?><w:document ` + testWordNamespaces + `><w:body>` +
+			`<w:p><w:pPr><w:pStyle w:val="Heading1"/></w:pPr><w:r><w:t xml:space="preserve">Project </w:t></w:r><w:r><w:rPr><w:b/></w:rPr><w:t>{{tar</w:t></w:r><w:proofErr w:type="spellStart"/><w:r><w:t>get_company</w:t></w:r><w:r><w:t>}} – IC Memo</w:t></w:r></w:p>` +
+			`<w:p><w:r><w:t>Sector: [</w:t></w:r><w:r><w:t>Industry] &amp; {{unknown}}</w:t></w:r></w:p>` +
+			`<w:tbl><w:tblPr><w:tblStyle w:val="TableGrid"/></w:tblPr>` +
+			`<w:tr><w:tc><w:p><w:r><w:t>Enterprise Value</w:t></w:r></w:p></w:tc><w:tc><w:p><w:pPr><w:jc w:val="right"/><w:rPr><w:i/></w:rPr></w:pPr></w:p></w:tc></w:tr>` +
+			`<w:tr><w:tc><w:p><w:r><w:t>Lead Partner:</w:t></w:r></w:p></w:tc><w:tc><w:p/></w:tc></w:tr>` +
+			`</w:tbl>` +
+			`<w:tbl><w:tr><w:tc><w:p><w:r><w:t>Name</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>Role</w:t></w:r></w:p></w:tc></w:tr>` +
+			`<w:tr><w:tc><w:p w14:paraId="1A2B3C4D"><w:r><w:t>{{management.</w:t></w:r><w:r><w:t>name}}</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>{{management.role}} ({{deal_name}})</w:t></w:r></w:p></w:tc></w:tr>` +
+			`</w:tbl>` +
+			`<w:tbl><w:tr><w:tc><w:p><w:r><w:t>{{advisors}}</w:t></w:r></w:p></w:tc></w:tr></w:tbl>` +
+			`<w:p><w:r><w:drawing><c:chart xmlns:c="http://schemas.openxmlformats.org/drawingml/2006/chart" r:id="rId5" xmlns:r="r"/></w:drawing></w:r></w:p>` +
+			`</w:body></w:document>`,
+		"word/header1.xml":                  `<w:hdr ` + testWordNamespaces + `><w:p><w:r><w:t>Strictly confidential – {{deal</w:t></w:r><w:r><w:t>_name}}</w:t></w:r></w:p></w:hdr>`,
+		"word/footer1.xml":                  `<w:ftr ` + testWordNamespaces + `><w:p><w:r><w:t>Prepared [Date]</w:t></w:r></w:p></w:ftr>`,
+		"word/charts/chart1.xml":            `<c:chartSpace xmlns:c="http://schemas.openxmlformats.org/drawingml/2006/chart"><c:chart><c:title><c:tx><c:rich><a:p xmlns:a="a"><a:r><a:t>{{target_company}} revenue</a:t></a:r></a:p></c:rich></c:tx></c:title></c:chart></c:chartSpace>`,
+		"word/embeddings/Workbook1.xlsx":    testChartWorkbook(t),
+		"word/charts/_rels/chart1.xml.rels": `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"><Relationship Id="rId1" Target="../embeddings/Workbook1.xlsx"/></Relationships>`,
+		"word/_rels/document.xml.rels":      `<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships"/>`,
+	}
+	writeTestZip(t, path, entries)
+	return entries
+}
+
+// readTestZip returns the entries of a zip file by name
+func readTestZip(t *testing.T, path string) map[string]string {
+	t.Helper()
+	reader, err := zip.OpenReader(path)
+	require.NoError(t, err)
+	defer reader.Close()
+	entries := make(map[string]string)
+	for _, file := range reader.File {
+		data, err := readZipEntry(&reader.Reader, file.Name)
+		require.NoError(t, err)
+		entries[file.Name] = string(data)
+	}
+	return entries
+}
+
+func memoTestData() *MappedData {
+	data := bindingTestData(map[string]interface{}{
+		"Target Company":   "Acme & Sons",
+		"deal_name":        "Project Falcon",
+		"industry":         "Industrial Software",
+		"enterprise_value": 250000000.0,
+		"lead_partner":     "Maria Lopez",
+		"date":             "2024-06-30",
+		"advisors":         []string{},
+	})
+	data.Fields["management"] = MappedField{FieldName: "management", Value: []struct {
+		Name string `json:"name"`
+		Role string `json:"role"`
+	}{{"Jane Smith", "CEO"}, {"Tom Brown", "CFO"}}}
+	return data
+}
+
+func TestParseTemplate_Word(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "IC Memo.docx")
+	writeMemoFixture(t, templatePath)
+
+	templateData, err := NewTemplateParser(dir).ParseTemplate(templatePath)
+	require.NoError(t, err)
+	assert.Equal(t, "docx", templateData.Format)
+	assert.Equal(t, []string{"target_company", "Industry", "unknown", "management.name", "management.role", "deal_name", "advisors", "Date"}, templateData.Headers)
+	assert.Equal(t, []string{"word/document.xml", "word/footer1.xml", "word/header1.xml"}, templateData.Metadata["parts"])
+	assert.Equal(t, 3, templateData.Metadata["tables"])
+	assert.Contains(t, templateData.Metadata["originalContent"], "Project {{target_company}} – IC Memo")
+	assert.NoError(t, NewTemplateParser(dir).ValidateTemplateStructure(templateData))
+}
+
+func TestPopulateTemplate_Word(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "IC Memo.docx")
+	original := writeMemoFixture(t, templatePath)
+	outputPath := filepath.Join(dir, "out.docx")
+
+	populator := NewTemplatePopulator(NewTemplateParser(dir))
+	require.NoError(t, populator.PopulateTemplate(templatePath, memoTestData(), outputPath))
+	require.NoError(t, populator.ValidatePopulatedTemplate(outputPath, &FormulaPreservation{}))
+
+	output := readTestZip(t, outputPath)
+	text := ooxmlText(output["word/document.xml"], docxKind)
+	assert.Contains(t, text, "Project Acme & Sons – IC Memo")
+	assert.Contains(t, text, "Sector: Industrial Software & {{unknown}}", "unknown placeholders are left for review")
+
+	// Split placeholders take the formatting of the run they start in
+	document := output["word/document.xml"]
+	assert.Contains(t, document, `<w:r><w:rPr><w:b/></w:rPr><w:t>Acme &amp; Sons</w:t></w:r><w:proofErr w:type="spellStart"/><w:r><w:t></w:t></w:r><w:r><w:t xml:space="preserve"> – IC Memo</w:t></w:r>`)
+
+	// Labelled cells are filled with the paragraph's formatting
+	assert.Contains(t, document, `<w:pPr><w:jc w:val="right"/><w:rPr><w:i/></w:rPr></w:pPr><w:r><w:rPr><w:i/></w:rPr><w:t xml:space="preserve">$250,000,000</w:t></w:r>`)
+	assert.Contains(t, document, `<w:p><w:r><w:t xml:space="preserve">Maria Lopez</w:t></w:r></w:p>`)
+
+	// List rows repeat per item; rows for empty lists are removed
+	assert.Contains(t, text, "Name\nRole\nJane Smith\nCEO (Project Falcon)\nTom Brown\nCFO (Project Falcon)")
+	assert.Equal(t, 1, strings.Count(document, "w14:paraId"), "repeated rows drop duplicate paragraph ids")
+	assert.NotContains(t, document, "advisors")
+	assert.Equal(t, 2, strings.Count(document, "<w:tbl>"), "tables left without rows are removed")
+
+	// Headers and footers are filled; styles and charts are untouched
+	assert.Equal(t, "Strictly confidential – Project Falcon", ooxmlText(output["word/header1.xml"], docxKind))
+	assert.Equal(t, "Prepared June 30, 2024", ooxmlText(output["word/footer1.xml"], docxKind))
+	for _, name := range []string{"[Content_Types].xml", "word/styles.xml", "word/charts/chart1.xml", "word/charts/_rels/chart1.xml.rels", "word/embeddings/Workbook1.xlsx"} {
+		assert.Equal(t, original[name], output[name], name)
+	}
+	workbook, err := excelize.OpenReader(bytes.NewReader([]byte(output["word/embeddings/Workbook1.xlsx"])))
+	require.NoError(t, err)
+	defer workbook.Close()
+	value, err := workbook.GetCellValue("Sheet1", "B2")
+	require.NoError(t, err)
+	assert.Equal(t, "1450", value)
+}
+
+// writeTeaserFixture writes a one-slide teaser with a financials table
+func writeTeaserFixture(t *testing.T, path string) {
+	t.Helper()
+	slide := `<?xml version="1.0" encoding="UTF-8" standalone="yes"?><p:sld ` + testSlideNamespaces + `><p:cSld><p:spTree>` +
+		`<p:sp><p:txBody><a:p><a:r><a:rPr lang="en-US" sz="2800" b="1"/><a:t>Project &lt;&lt;code</a:t></a:r><a:r><a:rPr lang="en-US" sz="2800"/><a:t>name&gt;&gt;</a:t></a:r></a:p>` +
+		`<a:p><a:r><a:t>Consideration: &lt;&lt;price&gt;&gt;</a:t></a:r></a:p></p:txBody></p:sp>` +
+		`<p:graphicFrame><a:graphic><a:graphicData><a:tbl><a:tblPr firstRow="1"/>` +
+		`<a:tr h="370840"><a:tc><a:txBody><a:bodyPr/><a:p><a:r><a:t>Year</a:t></a:r></a:p></a:txBody></a:tc><a:tc><a:txBody><a:bodyPr/><a:p><a:r><a:t>Revenue</a:t></a:r></a:p></a:txBody></a:tc></a:tr>` +
+		`<a:tr h="370840"><a:tc><a:txBody><a:bodyPr/><a:p><a:r><a:t>{{financials.year}}</a:t></a:r></a:p></a:txBody></a:tc><a:tc><a:txBody><a:bodyPr/><a:p><a:r><a:t>{{financials.revenue}}</a:t></a:r></a:p></a:txBody></a:tc></a:tr>` +
+		`<a:tr h="370840"><a:tc><a:txBody><a:bodyPr/><a:p><a:r><a:t>Sector</a:t></a:r></a:p></a:txBody></a:tc><a:tc><a:txBody><a:bodyPr/><a:p><a:endParaRPr lang="en-US" sz="1200"><a:solidFill><a:srgbClr val="1F4E79"/></a:solidFill></a:endParaRPr></a:p></a:txBody></a:tc></a:tr>` +
+		`</a:tbl></a:graphicData></a:graphic></p:graphicFrame>` +
+		`</p:spTree></p:cSld></p:sld>`
+	writeTestZip(t, path, map[string]string{
+		"ppt/presentation.xml":              `<p:presentation ` + testSlideNamespaces + `/>`,
+		"ppt/slides/slide1.xml":             slide,
+		"ppt/slideLayouts/slideLayout1.xml": `<p:sldLayout ` + testSlideNamespaces + `><p:cSld><p:spTree><p:sp><p:txBody><a:p><a:r><a:t>[Click to edit]</a:t></a:r></a:p></p:txBody></p:sp></p:spTree></p:cSld></p:sldLayout>`,
+	})
+}
+
+func TestPopulateTemplate_PowerPointWithBindings(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "Teaser.pptx")
+	writeTeaserFixture(t, templatePath)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Teaser.bindings.yaml"), []byte(`
+bindings:
+  - field: code_name
+    placeholder: "<<codename>>"
+  - field: purchase_price
+    placeholder: "<<price>>"
+    format: currency
+    unit: EUR
+    scale: millions
+`), 0644))
+
+	data := bindingTestData(map[string]interface{}{
+		"code_name":      "Falcon",
+		"purchase_price": 1250000000.0,
+		"sector":         "Industrial Software",
+		"financials": []map[string]interface{}{
+			{"year": "FY2023", "revenue": "€120m"},
+			{"year": "FY2024", "revenue": "€145m"},
+		},
+	})
+	outputPath := filepath.Join(dir, "out.pptx")
+	populator := NewTemplatePopulator(NewTemplateParser(dir))
+	require.NoError(t, populator.PopulateTemplate(templatePath, data, outputPath))
+	require.NoError(t, populator.ValidatePopulatedTemplate(outputPath, &FormulaPreservation{}))
+
+	output := readTestZip(t, outputPath)
+	slide := output["ppt/slides/slide1.xml"]
+	assert.Equal(t, "Project Falcon\nConsideration: €1,250.0m\nYear\nRevenue\nFY2023\n€120m\nFY2024\n€145m\nSector\nIndustrial Software", ooxmlText(slide, pptxKind))
+	assert.Contains(t, slide, `<a:rPr lang="en-US" sz="2800" b="1"/><a:t>Project Falcon</a:t>`)
+	assert.Contains(t, slide, `<a:r><a:rPr lang="en-US" sz="1200"><a:solidFill><a:srgbClr val="1F4E79"/></a:solidFill></a:rPr><a:t>Industrial Software</a:t></a:r><a:endParaRPr`)
+	assert.Equal(t, 4, strings.Count(slide, `<a:tr h="370840">`))
+	assert.Contains(t, output["ppt/slideLayouts/slideLayout1.xml"], "[Click to edit]", "layouts are not filled")
+
+	// Binding placeholders must exist in the slides
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Teaser.bindings.yaml"), []byte("bindings:\n  - field: sponsor\n    placeholder: \"<<sponsor>>\"\n  - field: ev\n    cell: A1\n"), 0644))
+	err := populator.PopulateTemplate(templatePath, data, outputPath)
+	var bindingErr *TemplateBindingError
+	require.ErrorAs(t, err, &bindingErr)
+	assert.Equal(t, []string{
+		`binding 1 (sponsor): placeholder "<<sponsor>>" does not appear in the template`,
+		"binding 2 (ev): pptx templates can only bind placeholders",
+	}, bindingErr.Problems)
+}
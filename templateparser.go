@@ -12,7 +12,7 @@ import (
 	"github.com/xuri/excelize/v2"
 )
 
-// TemplateParser handles parsing of Excel and CSV templates
+// TemplateParser handles parsing of Excel, CSV, text, Word and PowerPoint templates
 type TemplateParser struct {
 	templatesPath string
 }
@@ -26,7 +26,7 @@ func NewTemplateParser(templatesPath string) *TemplateParser {
 
 // TemplateData represents parsed template data
 type TemplateData struct {
-	Format   string                 `json:"format"` // "excel", "csv", or "text"
+	Format   string                 `json:"format"` // "excel", "csv", "text", "docx" or "pptx"
 	Headers  []string               `json:"headers"`
 	Data     [][]string             `json:"data"`
 	Formulas map[string]string      `json:"formulas"` // Cell -> Formula mapping
@@ -60,6 +60,10 @@ func (tp *TemplateParser) ParseTemplate(templatePath string) (*TemplateData, err
 		return tp.parseExcelTemplate(templatePath)
 	case ".txt", ".md":
 		return tp.parseTextTemplate(templatePath)
+	case ".docx":
+		return tp.parseOfficeTemplate(templatePath, docxKind)
+	case ".pptx":
+		return tp.parseOfficeTemplate(templatePath, pptxKind)
 	default:
 		return nil, fmt.Errorf("unsupported template format: %s", ext)
 	}
@@ -270,7 +274,18 @@ func (tp *TemplateParser) extractFormulas(f *excelize.File, sheetName string, sh
 	// Parse dimension (e.g., "A1:F30")
 	coords := strings.Split(dimension, ":")
 	if len(coords) != 2 {
-		return
+		// Some writers record only "A1"; fall back to the extent of the rows,
+		// which includes formula cells
+		rows, err := f.GetRows(sheetName)
+		if err != nil || len(rows) == 0 {
+			return
+		}
+		width := 1
+		for _, row := range rows {
+			width = max(width, len(row))
+		}
+		last, _ := excelize.CoordinatesToCellName(width, len(rows))
+		coords = []string{"A1", last}
 	}
 
 	startCol, startRow, _ := excelize.CellNameToCoordinates(coords[0])
@@ -291,11 +306,15 @@ func (tp *TemplateParser) extractFormulas(f *excelize.File, sheetName string, sh
 // ExtractDataFields extracts all data fields from a template
 func (tp *TemplateParser) ExtractDataFields(templateData *TemplateData) []DataField {
 	fields := []DataField{}
+	lists := templateListFields(templateData)
 
 	if len(templateData.Sheets) > 0 {
 		// Multi-sheet Excel file
 		for _, sheet := range templateData.Sheets {
 			for colIndex, header := range sheet.Headers {
+				if isListItemPlaceholder(header, lists) {
+					continue
+				}
 				field := DataField{
 					Name:       header,
 					Path:       fmt.Sprintf("%s.%s", sheet.Name, header),
@@ -309,6 +328,9 @@ func (tp *TemplateParser) ExtractDataFields(templateData *TemplateData) []DataFi
 	} else {
 		// Single sheet or CSV
 		for colIndex, header := range templateData.Headers {
+			if isListItemPlaceholder(header, lists) {
+				continue
+			}
 			field := DataField{
 				Name:       header,
 				Path:       header,
@@ -319,16 +341,18 @@ func (tp *TemplateParser) ExtractDataFields(templateData *TemplateData) []DataFi
 		}
 	}
 
-	return fields
+	// Repeated rows and loop blocks are filled from list fields
+	return append(fields, lists...)
 }
 
 // DataField represents a field in the template
 type DataField struct {
-	Name       string `json:"name"`
-	Path       string `json:"path"`     // Full path including sheet name
-	DataType   string `json:"dataType"` // "string", "number", "date", "currency"
-	IsRequired bool   `json:"isRequired"`
-	Sheet      string `json:"sheet,omitempty"`
+	Name       string   `json:"name"`
+	Path       string   `json:"path"`     // Full path including sheet name
+	DataType   string   `json:"dataType"` // "string", "number", "date", "currency" or "list"
+	IsRequired bool     `json:"isRequired"`
+	Sheet      string   `json:"sheet,omitempty"`
+	ItemFields []string `json:"itemFields,omitempty"` // Fields of each item of a list
 }
 
 // inferDataType attempts to infer the data type from sample data
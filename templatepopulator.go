@@ -36,6 +36,19 @@ func (tp *TemplatePopulator) PopulateTemplate(templatePath string, mappedData *M
 		return fmt.Errorf("failed to parse template: %w", err)
 	}
 
+	// A binding manifest says where fields go; heuristics only place what
+	// it leaves unbound
+	bindings, err := LoadTemplateBindings(templatePath)
+	if err != nil {
+		return err
+	}
+	if bindings != nil {
+		if err := bindings.Validate(templateData); err != nil {
+			return err
+		}
+		return tp.populateWithBindings(templatePath, templateData, bindings, mappedData, outputPath)
+	}
+
 	// Route to appropriate handler based on format
 	switch templateData.Format {
 	case "csv":
@@ -44,6 +57,10 @@ func (tp *TemplatePopulator) PopulateTemplate(templatePath string, mappedData *M
 		return tp.populateExcelTemplate(templatePath, templateData, mappedData, outputPath)
 	case "text":
 		return tp.populateTextTemplate(templatePath, templateData, mappedData, outputPath)
+	case "docx":
+		return tp.populateOfficeTemplate(templatePath, docxKind, nil, mappedData, outputPath)
+	case "pptx":
+		return tp.populateOfficeTemplate(templatePath, pptxKind, nil, mappedData, outputPath)
 	default:
 		return fmt.Errorf("unsupported template format: %s", templateData.Format)
 	}
@@ -52,9 +69,22 @@ func (tp *TemplatePopulator) PopulateTemplate(templatePath string, mappedData *M
 // populateCSVTemplate populates a CSV template
 func (tp *TemplatePopulator) populateCSVTemplate(templatePath string, templateData *TemplateData, mappedData *MappedData, outputPath string) error {
 	// Read the original CSV to preserve structure
+	records, err := readCSVTemplate(templatePath)
+	if err != nil {
+		return err
+	}
+
+	// Update records with mapped data
+	updatedRecords := tp.updateCSVRecords(records, templateData, mappedData)
+
+	return writeCSVOutput(outputPath, updatedRecords)
+}
+
+// readCSVTemplate reads every record of a CSV template
+func readCSVTemplate(templatePath string) ([][]string, error) {
 	file, err := os.Open(templatePath)
 	if err != nil {
-		return fmt.Errorf("failed to open template: %w", err)
+		return nil, fmt.Errorf("failed to open template: %w", err)
 	}
 	defer file.Close()
 
@@ -64,13 +94,13 @@ func (tp *TemplatePopulator) populateCSVTemplate(templatePath string, templateDa
 	// Read all records
 	records, err := reader.ReadAll()
 	if err != nil {
-		return fmt.Errorf("failed to read CSV: %w", err)
+		return nil, fmt.Errorf("failed to read CSV: %w", err)
 	}
+	return records, nil
+}
 
-	// Update records with mapped data
-	updatedRecords := tp.updateCSVRecords(records, templateData, mappedData)
-
-	// Write to output file
+// writeCSVOutput writes populated CSV records
+func writeCSVOutput(outputPath string, records [][]string) error {
 	outputFile, err := os.Create(outputPath)
 	if err != nil {
 		return fmt.Errorf("failed to create output file: %w", err)
@@ -78,15 +108,13 @@ func (tp *TemplatePopulator) populateCSVTemplate(templatePath string, templateDa
 	defer outputFile.Close()
 
 	writer := csv.NewWriter(outputFile)
-	defer writer.Flush()
-
-	for _, record := range updatedRecords {
+	for _, record := range records {
 		if err := writer.Write(record); err != nil {
 			return fmt.Errorf("failed to write record: %w", err)
 		}
 	}
-
-	return nil
+	writer.Flush()
+	return writer.Error()
 }
 
 // updateCSVRecords updates CSV records with mapped data
@@ -175,23 +203,53 @@ func (tp *TemplatePopulator) updateCSVRecords(records [][]string, templateData *
 
 // populateTextTemplate populates a text template
 func (tp *TemplatePopulator) populateTextTemplate(templatePath string, templateData *TemplateData, mappedData *MappedData, outputPath string) error {
+	originalContent, err := readTextTemplate(templatePath, templateData)
+	if err != nil {
+		return err
+	}
+
+	content := tp.expandTextLoops(originalContent, mappedData)
+	return writeTextOutput(outputPath, tp.fillTextPlaceholders(content, mappedData))
+}
+
+// readTextTemplate returns the content of a text template
+func readTextTemplate(templatePath string, templateData *TemplateData) (string, error) {
 	// Read the original text content
-	originalContent, ok := templateData.Metadata["originalContent"].(string)
-	if !ok {
-		// Fallback: read from file
-		file, err := os.Open(templatePath)
-		if err != nil {
-			return fmt.Errorf("failed to open template: %w", err)
-		}
-		defer file.Close()
+	if originalContent, ok := templateData.Metadata["originalContent"].(string); ok {
+		return originalContent, nil
+	}
 
-		content, err := io.ReadAll(file)
-		if err != nil {
-			return fmt.Errorf("failed to read template: %w", err)
-		}
-		originalContent = string(content)
+	// Fallback: read from file
+	file, err := os.Open(templatePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to open template: %w", err)
 	}
+	defer file.Close()
 
+	content, err := io.ReadAll(file)
+	if err != nil {
+		return "", fmt.Errorf("failed to read template: %w", err)
+	}
+	return string(content), nil
+}
+
+// writeTextOutput writes populated text content
+func writeTextOutput(outputPath, content string) error {
+	outputFile, err := os.Create(outputPath)
+	if err != nil {
+		return fmt.Errorf("failed to create output file: %w", err)
+	}
+	defer outputFile.Close()
+
+	if _, err := outputFile.WriteString(content); err != nil {
+		return fmt.Errorf("failed to write populated content: %w", err)
+	}
+	return nil
+}
+
+// fillTextPlaceholders replaces the placeholders the mapped fields are
+// likely to fill
+func (tp *TemplatePopulator) fillTextPlaceholders(originalContent string, mappedData *MappedData) string {
 	// Replace placeholders with mapped data
 	populatedContent := originalContent
 
@@ -359,19 +417,7 @@ func (tp *TemplatePopulator) populateTextTemplate(templatePath string, templateD
 		}
 	}
 
-	// Write to output file
-	outputFile, err := os.Create(outputPath)
-	if err != nil {
-		return fmt.Errorf("failed to create output file: %w", err)
-	}
-	defer outputFile.Close()
-
-	_, err = outputFile.WriteString(populatedContent)
-	if err != nil {
-		return fmt.Errorf("failed to write populated content: %w", err)
-	}
-
-	return nil
+	return populatedContent
 }
 
 // populateExcelTemplate populates an Excel template while preserving formulas
@@ -383,9 +429,15 @@ func (tp *TemplatePopulator) populateExcelTemplate(templatePath string, template
 	}
 	defer f.Close()
 
+	// List rows are expanded first; the rows below move down with them
+	bound, err := tp.expandExcelRepeatRows(f, mappedData, nil)
+	if err != nil {
+		return err
+	}
+
 	// Process each sheet
 	for _, sheet := range templateData.Sheets {
-		if err := tp.populateExcelSheet(f, sheet, mappedData); err != nil {
+		if err := tp.populateExcelSheet(f, sheet, mappedData, bound); err != nil {
 			return fmt.Errorf("failed to populate sheet %s: %w", sheet.Name, err)
 		}
 	}
@@ -398,8 +450,9 @@ func (tp *TemplatePopulator) populateExcelTemplate(templatePath string, template
 	return nil
 }
 
-// populateExcelSheet populates a single Excel sheet
-func (tp *TemplatePopulator) populateExcelSheet(f *excelize.File, sheet SheetData, mappedData *MappedData) error {
+// populateExcelSheet populates a single Excel sheet, leaving the
+// sheet-qualified cells in bound untouched
+func (tp *TemplatePopulator) populateExcelSheet(f *excelize.File, sheet SheetData, mappedData *MappedData, bound map[string]bool) error {
 	// Get all rows in the sheet
 	rows, err := f.GetRows(sheet.Name)
 	if err != nil {
@@ -432,6 +485,9 @@ func (tp *TemplatePopulator) populateExcelSheet(f *excelize.File, sheet SheetDat
 			if err != nil {
 				continue
 			}
+			if bound[sheet.Name+"!"+cellName] {
+				continue
+			}
 
 			// Check if this cell has a formula
 			formula, err := f.GetCellFormula(sheet.Name, cellName)
@@ -738,6 +794,10 @@ func (tp *TemplatePopulator) ValidatePopulatedTemplate(populatedPath string, ori
 		return tp.validateCSVFormulas(populatedPath, originalFormulas)
 	case ".txt", ".md":
 		return tp.validateTextTemplate(populatedPath, originalFormulas)
+	case ".docx":
+		return tp.validateOfficeTemplate(populatedPath, docxKind)
+	case ".pptx":
+		return tp.validateOfficeTemplate(populatedPath, pptxKind)
 	default:
 		return fmt.Errorf("unsupported format for validation: %s", ext)
 	}
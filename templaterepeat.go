@@ -0,0 +1,592 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// listPlaceholderPattern matches {{list}} and {{list.key}} placeholders,
+// which repeat the table or worksheet row holding them once per list item
+var listPlaceholderPattern = regexp.MustCompile(`\{\{\s*([^{}.]+?)\s*(?:\.\s*([^{}]+?)\s*)?\}\}`)
+
+// textLoopTagPattern matches the {{#each list}} and {{/each}} tags around a
+// loop block of a text template
+var textLoopTagPattern = regexp.MustCompile(`\{\{\s*(?:#each\s+([^{}]+?)|/each)\s*\}\}`)
+
+// listItemFields returns the fields of a map or struct list item by their
+// canonical names
+func listItemFields(item interface{}) map[string]interface{} {
+	fields := make(map[string]interface{})
+	v := reflect.ValueOf(item)
+	if v.Kind() == reflect.Map && v.Type().Key().Kind() == reflect.String {
+		for _, key := range v.MapKeys() {
+			fields[canonicalFieldName(key.String())] = v.MapIndex(key).Interface()
+		}
+		return fields
+	}
+
+	// Structs are read through their JSON form, so tagged names work
+	var decoded map[string]interface{}
+	if data, err := json.Marshal(item); err == nil && json.Unmarshal(data, &decoded) == nil {
+		for key, value := range decoded {
+			fields[canonicalFieldName(key)] = value
+		}
+	}
+	if v.Kind() == reflect.Struct {
+		for i := 0; i < v.NumField(); i++ {
+			if v.Type().Field(i).IsExported() {
+				fields[canonicalFieldName(v.Type().Field(i).Name)] = v.Field(i).Interface()
+			}
+		}
+	}
+	return fields
+}
+
+// listItemValue returns a field of a list item, or the item itself when key
+// is empty
+func listItemValue(item interface{}, key string) (interface{}, bool) {
+	if key == "" {
+		return item, item != nil
+	}
+	value, ok := listItemFields(item)[canonicalFieldName(key)]
+	return value, ok && value != nil
+}
+
+// rowLists returns the list fields named by the {{list}} and {{list.key}}
+// placeholders of a row's text, and the number of copies of the row they
+// need
+func rowLists(text string, mappedData *MappedData) (map[string][]interface{}, int) {
+	lists := make(map[string][]interface{})
+	count := 0
+	for _, m := range listPlaceholderPattern.FindAllStringSubmatch(text, -1) {
+		name := canonicalFieldName(m[1])
+		if _, seen := lists[name]; seen {
+			continue
+		}
+		value, ok := lookupBoundField(mappedData, m[1])
+		if !ok {
+			continue
+		}
+		if items := bindingListValues(value); items != nil {
+			lists[name] = items
+			count = max(count, len(items))
+		}
+	}
+	return lists, count
+}
+
+// expandExcelRepeatRows copies each worksheet row holding {{list}} or
+// {{list.key}} placeholders once per list item and fills the copies. Rows
+// below move down, and formulas and defined names follow them; ranges that
+// end on a repeated row grow to cover its copies, so totals include every
+// item. The placeholders of a row for an empty list are cleared. It returns
+// bound with its cells moved along and the filled cells added.
+func (tp *TemplatePopulator) expandExcelRepeatRows(f *excelize.File, mappedData *MappedData, bound map[string]bool) (map[string]bool, error) {
+	if bound == nil {
+		bound = make(map[string]bool)
+	}
+	if mappedData == nil {
+		return bound, nil
+	}
+
+	for _, sheet := range f.GetSheetList() {
+		rows, err := f.GetRows(sheet, excelize.Options{RawCellValue: true})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get rows: %w", err)
+		}
+		// Working upwards keeps the rows still to be expanded in place
+		for row := len(rows); row >= 1; row-- {
+			lists, count := rowLists(strings.Join(rows[row-1], "\n"), mappedData)
+			if len(lists) == 0 {
+				continue
+			}
+			if err := tp.repeatExcelRow(f, sheet, row, rows[row-1], lists, count, bound); err != nil {
+				return nil, fmt.Errorf("failed to repeat row %d of %s: %w", row, sheet, err)
+			}
+		}
+	}
+	return bound, nil
+}
+
+// repeatExcelRow makes count rows of a template row and fills each with one
+// list item
+func (tp *TemplatePopulator) repeatExcelRow(f *excelize.File, sheet string, row int, cells []string, lists map[string][]interface{}, count int, bound map[string]bool) error {
+	copies := max(count, 1) - 1
+	if copies > 0 {
+		if err := f.InsertRows(sheet, row+1, copies); err != nil {
+			return err
+		}
+		shiftBoundRows(bound, sheet, row, copies)
+		if err := copyExcelRow(f, sheet, row, len(cells), copies); err != nil {
+			return err
+		}
+		if err := extendRangesToRow(f, tp.templateParser, sheet, row, row+copies); err != nil {
+			return err
+		}
+	}
+
+	for i := 0; i <= copies; i++ {
+		for col, text := range cells {
+			if !listPlaceholderPattern.MatchString(text) {
+				continue
+			}
+			cell, _ := excelize.CoordinatesToCellName(col+1, row+i)
+			if formula, _ := f.GetCellFormula(sheet, cell); formula != "" {
+				continue
+			}
+			if err := f.SetCellValue(sheet, cell, tp.excelListCellValue(text, lists, i)); err != nil {
+				return fmt.Errorf("failed to set %s!%s: %w", sheet, cell, err)
+			}
+			bound[sheet+"!"+cell] = true
+		}
+	}
+	return nil
+}
+
+// excelListCellValue fills the list placeholders of a cell with the i-th
+// item. A cell holding only a placeholder takes the typed value so numbers
+// stay numeric.
+func (tp *TemplatePopulator) excelListCellValue(text string, lists map[string][]interface{}, i int) interface{} {
+	item := func(m []string) (interface{}, string, bool) {
+		items, ok := lists[canonicalFieldName(m[1])]
+		if !ok {
+			return nil, "", false
+		}
+		name := m[1]
+		if m[2] != "" {
+			name = m[2]
+		}
+		if i >= len(items) {
+			return nil, name, true
+		}
+		value, _ := listItemValue(items[i], m[2])
+		return value, name, true
+	}
+	context := func(name string) FormattingContext {
+		return FormattingContext{FieldName: name, TemplateType: "excel", Metadata: make(map[string]interface{})}
+	}
+
+	if m := listPlaceholderPattern.FindStringSubmatch(strings.TrimSpace(text)); m != nil && m[0] == strings.TrimSpace(text) {
+		if value, name, ok := item(m); ok {
+			if value == nil {
+				return ""
+			}
+			return tp.formatValueForExcelWithContext(value, context(name))
+		}
+	}
+	return listPlaceholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		value, name, ok := item(listPlaceholderPattern.FindStringSubmatch(placeholder))
+		switch {
+		case !ok:
+			return placeholder
+		case value == nil:
+			return ""
+		}
+		return tp.formatValueWithContext(value, context(name))
+	})
+}
+
+// copyExcelRow copies the values, formulas, styles, height and merged cells
+// of a row into the copies rows inserted below it. Relative row references
+// in formulas move with each copy, as when copying in Excel.
+func copyExcelRow(f *excelize.File, sheet string, row, width, copies int) error {
+	if dimension, err := f.GetSheetDimension(sheet); err == nil {
+		if _, end, ok := strings.Cut(dimension, ":"); ok {
+			if col, _, err := excelize.CellNameToCoordinates(end); err == nil {
+				width = max(width, col)
+			}
+		}
+	}
+
+	for col := 1; col <= width; col++ {
+		source, _ := excelize.CoordinatesToCellName(col, row)
+		style, err := f.GetCellStyle(sheet, source)
+		if err != nil {
+			return err
+		}
+		formula, err := f.GetCellFormula(sheet, source)
+		if err != nil {
+			return err
+		}
+		value, err := excelRowCellValue(f, sheet, source)
+		if err != nil {
+			return err
+		}
+
+		for k := 1; k <= copies; k++ {
+			dest, _ := excelize.CoordinatesToCellName(col, row+k)
+			if style != 0 {
+				if err := f.SetCellStyle(sheet, dest, dest, style); err != nil {
+					return err
+				}
+			}
+			switch {
+			case formula != "":
+				shifted := rewriteFormulaReferences(formula, sheet, func(ref *formulaRange) bool {
+					if !ref.absolute[1] {
+						ref.fromRow += k
+					}
+					if !ref.absolute[3] {
+						ref.toRow += k
+					}
+					return !ref.absolute[1] || !ref.absolute[3]
+				})
+				if err := f.SetCellFormula(sheet, dest, shifted); err != nil {
+					return err
+				}
+			case value != nil:
+				if err := f.SetCellValue(sheet, dest, value); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	if height, err := f.GetRowHeight(sheet, row); err == nil {
+		for k := 1; k <= copies; k++ {
+			if err := f.SetRowHeight(sheet, row+k, height); err != nil {
+				return err
+			}
+		}
+	}
+
+	merged, err := f.GetMergeCells(sheet)
+	if err != nil {
+		return err
+	}
+	for _, m := range merged {
+		startCol, startRow, err := excelize.CellNameToCoordinates(m.GetStartAxis())
+		if err != nil {
+			continue
+		}
+		endCol, endRow, err := excelize.CellNameToCoordinates(m.GetEndAxis())
+		if err != nil || startRow != row || endRow != row {
+			continue
+		}
+		for k := 1; k <= copies; k++ {
+			from, _ := excelize.CoordinatesToCellName(startCol, row+k)
+			to, _ := excelize.CoordinatesToCellName(endCol, row+k)
+			if err := f.MergeCell(sheet, from, to); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// excelRowCellValue reads a cell's constant value with its type, or nil for
+// an empty cell
+func excelRowCellValue(f *excelize.File, sheet, cell string) (interface{}, error) {
+	raw, err := f.GetCellValue(sheet, cell, excelize.Options{RawCellValue: true})
+	if err != nil || raw == "" {
+		return nil, err
+	}
+	cellType, err := f.GetCellType(sheet, cell)
+	if err != nil {
+		return nil, err
+	}
+	switch cellType {
+	case excelize.CellTypeNumber, excelize.CellTypeUnset:
+		if n, err := strconv.ParseFloat(raw, 64); err == nil {
+			return n, nil
+		}
+	case excelize.CellTypeBool:
+		return raw == "1" || strings.EqualFold(raw, "true"), nil
+	}
+	return raw, nil
+}
+
+// extendRangesToRow stretches ranges on sheet that end on row, and start at
+// or above it, to end on last instead. Formulas on every sheet and defined
+// names are updated.
+func extendRangesToRow(f *excelize.File, parser *TemplateParser, sheet string, row, last int) error {
+	extend := func(ref *formulaRange) bool {
+		if ref.sheet != sheet || !ref.isRange || ref.toRow != row || ref.fromRow > row {
+			return false
+		}
+		ref.toRow = last
+		return true
+	}
+
+	for _, formulaSheet := range f.GetSheetList() {
+		sheetData := SheetData{Name: formulaSheet, Formulas: make(map[string]string)}
+		parser.extractFormulas(f, formulaSheet, &sheetData)
+		for cell, formula := range sheetData.Formulas {
+			if updated := rewriteFormulaReferences(formula, formulaSheet, extend); updated != formula {
+				if err := f.SetCellFormula(formulaSheet, cell, updated); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	names := f.GetDefinedName()
+	for _, name := range names {
+		scope := ""
+		if name.Scope != "Workbook" {
+			scope = name.Scope
+		}
+		refersTo := strings.TrimPrefix(name.RefersTo, "=")
+		updated := rewriteFormulaReferences(refersTo, scope, extend)
+		if updated == refersTo {
+			continue
+		}
+		if err := f.DeleteDefinedName(&excelize.DefinedName{Name: name.Name, Scope: name.Scope}); err != nil {
+			return err
+		}
+		name.RefersTo = updated
+		if err := f.SetDefinedName(&name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shiftBoundRows moves the bound cells of sheet below row down by n rows
+func shiftBoundRows(bound map[string]bool, sheet string, row, n int) {
+	moved := make(map[string]bool)
+	for ref := range bound {
+		refSheet, cell := splitBoundCell(ref)
+		col, r, err := excelize.CellNameToCoordinates(cell)
+		if refSheet != sheet || err != nil || r <= row {
+			continue
+		}
+		delete(bound, ref)
+		cell, _ = excelize.CoordinatesToCellName(col, r+n)
+		moved[refSheet+"!"+cell] = true
+	}
+	for ref := range moved {
+		bound[ref] = true
+	}
+}
+
+// textLoopScope is the list item a loop block is being filled with
+type textLoopScope struct {
+	name string
+	item interface{}
+}
+
+// expandTextLoops repeats the body of each {{#each list}} ... {{/each}}
+// block once per item of the list. Within a block {{key}} and {{list.key}}
+// name fields of the item and {{list}} or {{this}} the item itself; other
+// placeholders are left for the rest of population. Blocks nest, and a
+// tag alone on its line takes the line with it. Blocks for empty lists are
+// removed, as are nested blocks for a field the item lacks; blocks for
+// fields with no value are left for review.
+func (tp *TemplatePopulator) expandTextLoops(content string, mappedData *MappedData) string {
+	if mappedData == nil {
+		return content
+	}
+	return tp.expandLoops(content, mappedData, nil)
+}
+
+func (tp *TemplatePopulator) expandLoops(content string, mappedData *MappedData, scopes []textLoopScope) string {
+	var sb strings.Builder
+	for {
+		open, close, name, ok := nextTextLoop(content)
+		if !ok {
+			sb.WriteString(content)
+			return sb.String()
+		}
+		sb.WriteString(content[:open[0]])
+
+		value, found := loopValue(name, mappedData, scopes)
+		if !found {
+			sb.WriteString(content[open[0]:close[1]])
+		} else {
+			items := bindingListValues(value)
+			if items == nil {
+				items = []interface{}{value}
+			}
+			body := content[open[1]:close[0]]
+			for _, item := range items {
+				scope := textLoopScope{name: name, item: item}
+				inner := append(scopes[:len(scopes):len(scopes)], scope)
+				sb.WriteString(tp.fillLoopItem(tp.expandLoops(body, mappedData, inner), scope))
+			}
+		}
+		content = content[close[1]:]
+	}
+}
+
+// nextTextLoop finds the first loop block, returning the spans of its
+// opening and closing tags and the list it names
+func nextTextLoop(content string) (open, close [2]int, name string, ok bool) {
+	depth := 0
+	var openTag [2]int
+	for _, m := range textLoopTagPattern.FindAllStringSubmatchIndex(content, -1) {
+		isOpen := m[2] >= 0
+		if depth == 0 {
+			if !isOpen {
+				continue
+			}
+			openTag = [2]int{m[0], m[1]}
+			name = strings.TrimSpace(content[m[2]:m[3]])
+		}
+		if isOpen {
+			depth++
+			continue
+		}
+		if depth--; depth == 0 {
+			open = standaloneTagSpan(content, openTag[0], openTag[1])
+			close = standaloneTagSpan(content, m[0], m[1])
+			if close[0] < open[1] {
+				// Both tags share a line, so neither takes it
+				open, close = openTag, [2]int{m[0], m[1]}
+			}
+			return open, close, name, true
+		}
+	}
+	return open, close, "", false
+}
+
+// standaloneTagSpan widens the span of a tag to its whole line, including
+// the line break, when nothing else is on the line
+func standaloneTagSpan(content string, start, end int) [2]int {
+	lineStart := strings.LastIndexByte(content[:start], '\n') + 1
+	lineEnd := len(content)
+	if i := strings.IndexByte(content[end:], '\n'); i >= 0 {
+		lineEnd = end + i + 1
+	}
+	if strings.TrimSpace(content[lineStart:start]) == "" && strings.TrimSpace(content[end:lineEnd]) == "" {
+		return [2]int{lineStart, lineEnd}
+	}
+	return [2]int{start, end}
+}
+
+// loopValue resolves the list a block names: a field of an enclosing item,
+// innermost first, then a mapped field
+func loopValue(name string, mappedData *MappedData, scopes []textLoopScope) (interface{}, bool) {
+	for i := len(scopes) - 1; i >= 0; i-- {
+		if before, after, ok := strings.Cut(name, "."); ok && canonicalFieldName(before) == canonicalFieldName(scopes[i].name) {
+			// An item without the field has an empty list
+			if value, ok := listItemValue(scopes[i].item, after); ok {
+				return value, true
+			}
+			return []interface{}{}, true
+		}
+		if value, ok := listItemValue(scopes[i].item, name); ok && !strings.Contains(name, ".") {
+			return value, true
+		}
+	}
+	return lookupBoundField(mappedData, name)
+}
+
+// fillLoopItem replaces the placeholders of a loop body that name the item
+func (tp *TemplatePopulator) fillLoopItem(text string, scope textLoopScope) string {
+	return listPlaceholderPattern.ReplaceAllStringFunc(text, func(placeholder string) string {
+		m := listPlaceholderPattern.FindStringSubmatch(placeholder)
+		name, key := m[1], m[2]
+		var value interface{}
+		var ok bool
+		switch {
+		case name == "this" || canonicalFieldName(name) == canonicalFieldName(scope.name):
+			if value, ok = listItemValue(scope.item, key); !ok {
+				return ""
+			}
+			if key == "" {
+				key = scope.name
+			}
+		case key == "":
+			if value, ok = listItemValue(scope.item, name); !ok {
+				return placeholder
+			}
+			key = name
+		default:
+			return placeholder
+		}
+		return tp.formatValueWithContext(value, FormattingContext{
+			FieldName:    key,
+			TemplateType: "text",
+			Metadata:     make(map[string]interface{}),
+		})
+	})
+}
+
+// templateListFields returns the list fields a template repeats rows or
+// loop blocks for, with the item fields it uses
+func templateListFields(templateData *TemplateData) []DataField {
+	var fields []DataField
+	index := make(map[string]int)
+	add := func(name, key, sheet string) {
+		name = strings.TrimSpace(name)
+		if name == "" || name == "this" || strings.ContainsAny(name, "#/") {
+			return
+		}
+		i, ok := index[canonicalFieldName(name)]
+		if !ok {
+			i = len(fields)
+			index[canonicalFieldName(name)] = i
+			fields = append(fields, DataField{Name: name, Path: name, DataType: "list", Sheet: sheet})
+		}
+		if key = strings.TrimSpace(key); key != "" && key != "this" && !containsFold(fields[i].ItemFields, key) {
+			fields[i].ItemFields = append(fields[i].ItemFields, key)
+		}
+	}
+
+	scan := func(text, sheet string) {
+		for content := text; ; {
+			open, close, name, ok := nextTextLoop(content)
+			if !ok {
+				break
+			}
+			if !strings.Contains(name, ".") {
+				add(name, "", sheet)
+				for _, m := range listPlaceholderPattern.FindAllStringSubmatch(content[open[1]:close[0]], -1) {
+					if m[2] == "" {
+						add(name, m[1], sheet)
+					}
+				}
+			}
+			content = content[close[1]:]
+		}
+		for _, m := range listPlaceholderPattern.FindAllStringSubmatch(text, -1) {
+			if m[2] != "" {
+				add(m[1], m[2], sheet)
+			}
+		}
+	}
+
+	for _, sheet := range templateData.Sheets {
+		var cells []string
+		cells = append(cells, sheet.Headers...)
+		for _, row := range sheet.Data {
+			cells = append(cells, row...)
+		}
+		scan(strings.Join(cells, "\n"), sheet.Name)
+	}
+	if content, ok := templateData.Metadata["originalContent"].(string); ok {
+		scan(content, "")
+	}
+	return fields
+}
+
+// isListItemPlaceholder reports whether a template header is a {{list.key}}
+// placeholder of one of the list fields
+func isListItemPlaceholder(header string, lists []DataField) bool {
+	name, _, ok := strings.Cut(strings.Trim(strings.TrimSpace(header), "{}"), ".")
+	if !ok {
+		return false
+	}
+	for _, list := range lists {
+		if canonicalFieldName(list.Name) == canonicalFieldName(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if canonicalFieldName(v) == canonicalFieldName(value) {
+			return true
+		}
+	}
+	return false
+}
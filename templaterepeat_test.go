@@ -0,0 +1,228 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/xuri/excelize/v2"
+)
+
+// newCapTableWorkbook writes a cap table whose holder row repeats, with a
+// total below it and a summary sheet referring to both
+func newCapTableWorkbook(t *testing.T, dir string) string {
+	t.Helper()
+	f := excelize.NewFile()
+	defer f.Close()
+	require.NoError(t, f.SetSheetName("Sheet1", "Cap Table"))
+	_, err := f.NewSheet("Summary")
+	require.NoError(t, err)
+
+	for cell, value := range map[string]string{
+		"A1": "Cap table for {{target}}",
+		"A3": "Holder", "B3": "Shares", "C3": "Ownership",
+		"A4": "{{holders.name}} ({{holders.class}})", "B4": "{{holders.shares}}",
+		"A5": "Total",
+		"A7": "Option pool",
+	} {
+		require.NoError(t, f.SetCellValue("Cap Table", cell, value))
+	}
+	require.NoError(t, f.SetCellFormula("Cap Table", "C4", "B4/$B$5"))
+	require.NoError(t, f.SetCellFormula("Cap Table", "B5", "SUM(B4:B4)"))
+	require.NoError(t, f.SetCellFormula("Summary", "B1", "'Cap Table'!B5"))
+	require.NoError(t, f.SetCellFormula("Summary", "B2", "MAX('Cap Table'!B4:B4)"))
+	require.NoError(t, f.SetDefinedName(&excelize.DefinedName{Name: "Holders", RefersTo: "'Cap Table'!$A$4:$C$4"}))
+	require.NoError(t, f.SetDefinedName(&excelize.DefinedName{Name: "TotalShares", RefersTo: "'Cap Table'!$B$5"}))
+
+	style, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Italic: true}})
+	require.NoError(t, err)
+	require.NoError(t, f.SetCellStyle("Cap Table", "A4", "C4", style))
+
+	path := filepath.Join(dir, "Cap Table.xlsx")
+	require.NoError(t, f.SaveAs(path))
+	return path
+}
+
+func TestPopulateTemplate_ExcelRepeatRows(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := newCapTableWorkbook(t, dir)
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "Cap Table.bindings.yaml"), []byte(`
+bindings:
+  - field: target
+    placeholder: "{{target}}"
+  - field: option_pool
+    cell: "'Cap Table'!B7"
+    format: number
+`), 0644))
+
+	data := bindingTestData(map[string]interface{}{
+		"target":      "Acme Corp",
+		"option_pool": 150000,
+		"holders": []interface{}{
+			map[string]interface{}{"name": "Founders", "class": "Common", "shares": 600000.0},
+			map[string]interface{}{"name": "Series A", "class": "Preferred", "shares": 300000.0},
+			map[string]interface{}{"name": "Angels", "class": "Common", "shares": 100000.0},
+		},
+	})
+	outputPath := filepath.Join(dir, "out.xlsx")
+	require.NoError(t, NewTemplatePopulator(NewTemplateParser(dir)).PopulateTemplate(templatePath, data, outputPath))
+
+	f, err := excelize.OpenFile(outputPath)
+	require.NoError(t, err)
+	defer f.Close()
+	get := func(sheet, cell string) string {
+		value, err := f.GetCellValue(sheet, cell, excelize.Options{RawCellValue: true})
+		require.NoError(t, err)
+		return value
+	}
+	formula := func(sheet, cell string) string {
+		value, err := f.GetCellFormula(sheet, cell)
+		require.NoError(t, err)
+		return value
+	}
+
+	assert.Equal(t, "Cap table for Acme Corp", get("Cap Table", "A1"))
+	assert.Equal(t, []string{"Founders (Common)", "Series A (Preferred)", "Angels (Common)"},
+		[]string{get("Cap Table", "A4"), get("Cap Table", "A5"), get("Cap Table", "A6")})
+	assert.Equal(t, []string{"600000", "300000", "100000"},
+		[]string{get("Cap Table", "B4"), get("Cap Table", "B5"), get("Cap Table", "B6")})
+
+	// Copies keep the row's formulas and styles; the total grows to cover
+	// every holder and everything below moves down
+	assert.Equal(t, []string{"B4/$B$7", "B5/$B$7", "B6/$B$7"},
+		[]string{formula("Cap Table", "C4"), formula("Cap Table", "C5"), formula("Cap Table", "C6")})
+	assert.Equal(t, "Total", get("Cap Table", "A7"))
+	assert.Equal(t, "SUM(B4:B6)", formula("Cap Table", "B7"))
+	styleA4, err := f.GetCellStyle("Cap Table", "A4")
+	require.NoError(t, err)
+	styleA6, err := f.GetCellStyle("Cap Table", "A6")
+	require.NoError(t, err)
+	assert.Equal(t, styleA4, styleA6)
+
+	// The bound cell below the repeated row moved with it
+	assert.Equal(t, "Option pool", get("Cap Table", "A9"))
+	assert.Equal(t, "150000", get("Cap Table", "B9"))
+
+	assert.Equal(t, "'Cap Table'!B7", formula("Summary", "B1"))
+	assert.Equal(t, "MAX('Cap Table'!B4:B6)", formula("Summary", "B2"))
+	names := make(map[string]string)
+	for _, name := range f.GetDefinedName() {
+		names[name.Name] = name.RefersTo
+	}
+	assert.Equal(t, "'Cap Table'!$A$4:$C$6", names["Holders"])
+	assert.Equal(t, "'Cap Table'!$B$7", names["TotalShares"])
+
+	total, err := f.CalcCellValue("Cap Table", "C5")
+	require.NoError(t, err)
+	assert.Equal(t, "0.3", total)
+
+	// An empty list leaves one row with its placeholders cleared
+	data.Fields["holders"] = MappedField{FieldName: "holders", Value: []interface{}{}}
+	require.NoError(t, NewTemplatePopulator(NewTemplateParser(dir)).PopulateTemplate(templatePath, data, outputPath))
+	empty, err := excelize.OpenFile(outputPath)
+	require.NoError(t, err)
+	defer empty.Close()
+	value, err := empty.GetCellValue("Cap Table", "A4")
+	require.NoError(t, err)
+	assert.Equal(t, " ()", value)
+	value, err = empty.GetCellValue("Cap Table", "A5")
+	require.NoError(t, err)
+	assert.Equal(t, "Total", value)
+}
+
+func TestPopulateTemplate_TextLoops(t *testing.T) {
+	dir := t.TempDir()
+	templatePath := filepath.Join(dir, "memo.md")
+	require.NoError(t, os.WriteFile(templatePath, []byte(`# [target]
+
+## Management
+{{#each management}}
+- {{name}}, {{title}}{{#each management.boards}} / {{this}}{{/each}}
+{{/each}}
+
+## Customers
+{{#each customers}}{{this}}; {{/each}}
+
+## Tranches
+{{#each tranches}}
+- {{tranches.name}}: {{amount}}
+{{/each}}
+{{#each advisors}}
+- {{name}}
+{{/each}}
+`), 0644))
+
+	data := bindingTestData(map[string]interface{}{
+		"target": "Acme Corp",
+		"management": []map[string]interface{}{
+			{"name": "Jane Smith", "title": "CEO", "boards": []string{"Widget Co", "Gadget Inc"}},
+			{"name": "John Doe", "title": "CFO"},
+		},
+		"customers": []string{"Globex", "Initech"},
+		"tranches":  []interface{}{},
+	})
+	outputPath := filepath.Join(dir, "out.md")
+	require.NoError(t, NewTemplatePopulator(NewTemplateParser(dir)).PopulateTemplate(templatePath, data, outputPath))
+
+	output, err := os.ReadFile(outputPath)
+	require.NoError(t, err)
+	assert.Equal(t, `# Acme Corp
+
+## Management
+- Jane Smith, CEO / Widget Co / Gadget Inc
+- John Doe, CFO
+
+## Customers
+Globex; Initech; 
+
+## Tranches
+{{#each advisors}}
+- {{name}}
+{{/each}}
+`, string(output), "blocks for lists with no value are left for review")
+}
+
+func TestExtractDataFields_ListFields(t *testing.T) {
+	dir := t.TempDir()
+	parser := NewTemplateParser(dir)
+	templateData, err := parser.ParseTemplate(newCapTableWorkbook(t, dir))
+	require.NoError(t, err)
+
+	var lists []DataField
+	for _, field := range parser.ExtractDataFields(templateData) {
+		if field.DataType == "list" {
+			lists = append(lists, field)
+		}
+	}
+	assert.Equal(t, []DataField{{
+		Name: "holders", Path: "holders", DataType: "list", Sheet: "Cap Table",
+		ItemFields: []string{"name", "class", "shares"},
+	}}, lists)
+
+	// People from personnel extraction fill the lists templates name
+	mapper := NewDataMapper(nil, parser)
+	extraction := &PersonnelRoleExtraction{
+		Confidence: 0.85,
+		Personnel: []PersonEntity{
+			{Name: "Jane Smith", Title: "CEO", Role: "decision_maker", Contact: ContactInfo{Email: "jane@acme.com"}},
+			{Name: "Tom Lee", Title: "Partner", Company: "Lee & Co", Role: "advisor"},
+		},
+	}
+	context := &ExtractionContext{Personnel: extraction}
+	mapped, err := mapper.mapField(DataField{Name: "Management Team", DataType: "list"}, context)
+	require.NoError(t, err)
+	require.NotNil(t, mapped)
+	assert.Equal(t, []map[string]interface{}{{
+		"name": "Jane Smith", "title": "CEO", "company": "", "role": "decision_maker",
+		"department": "", "email": "jane@acme.com", "phone": "",
+	}}, mapped.Value)
+	assert.Equal(t, 0.85, mapped.Confidence)
+	assert.True(t, mapper.isValidType(mapped.Value, "list"))
+
+	mapped, err = mapper.mapField(DataField{Name: "holders", DataType: "list"}, context)
+	require.NoError(t, err)
+	assert.Nil(t, mapped, "lists never take defaults")
+	assert.Equal(t, "Tom Lee", PersonnelListFields(extraction)["advisors"][0]["name"])
+}
@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"log"
+	"path/filepath"
+	"strings"
 	"sync"
 )
 
@@ -59,3 +62,84 @@ func (tl *TestLogger) Reset() {
 	defer tl.mutex.Unlock()
 	tl.entries = []string{}
 }
+
+// FakeOCREngine is a deterministic OCREngine for tests. Unless pages are
+// registered for a path, it returns a single page whose text and word
+// layout are derived from the file name.
+type FakeOCREngine struct {
+	pages       map[string][]OCRPage
+	orientation int
+	calls       []OCROptions
+	mutex       sync.Mutex
+}
+
+func NewFakeOCREngine() *FakeOCREngine {
+	return &FakeOCREngine{
+		pages: make(map[string][]OCRPage),
+	}
+}
+
+func (fe *FakeOCREngine) Name() string {
+	return "fake"
+}
+
+func (fe *FakeOCREngine) IsAvailable() bool {
+	return true
+}
+
+// SetPages registers the pages returned for a path
+func (fe *FakeOCREngine) SetPages(path string, pages ...OCRPage) {
+	fe.mutex.Lock()
+	defer fe.mutex.Unlock()
+	fe.pages[path] = pages
+}
+
+// SetOrientation sets the rotation returned by DetectOrientation
+func (fe *FakeOCREngine) SetOrientation(degrees int) {
+	fe.mutex.Lock()
+	defer fe.mutex.Unlock()
+	fe.orientation = degrees
+}
+
+// Calls returns the options of every Recognize call
+func (fe *FakeOCREngine) Calls() []OCROptions {
+	fe.mutex.Lock()
+	defer fe.mutex.Unlock()
+	calls := make([]OCROptions, len(fe.calls))
+	copy(calls, fe.calls)
+	return calls
+}
+
+func (fe *FakeOCREngine) Recognize(ctx context.Context, path string, options OCROptions) ([]OCRPage, error) {
+	fe.mutex.Lock()
+	defer fe.mutex.Unlock()
+	fe.calls = append(fe.calls, options)
+
+	if pages, ok := fe.pages[path]; ok {
+		return pages, nil
+	}
+
+	// Lay the label and file name out as two table columns
+	words := make([]OCRWord, 0)
+	left := 0
+	for _, text := range append(strings.Fields("OCR text from"), filepath.Base(path)) {
+		if text == filepath.Base(path) {
+			left += 100
+		}
+		words = append(words, OCRWord{Text: text, Left: left, Top: 10, Width: len(text) * 8, Height: 12, Confidence: 0.9, Block: 1, Line: 1})
+		left += len(text)*8 + 6
+	}
+
+	return []OCRPage{{
+		Number:     1,
+		Text:       fmt.Sprintf("OCR text from %s", filepath.Base(path)),
+		Confidence: 0.9,
+		Words:      words,
+	}}, nil
+}
+
+func (fe *FakeOCREngine) DetectOrientation(ctx context.Context, imagePath string) (int, error) {
+	fe.mutex.Lock()
+	defer fe.mutex.Unlock()
+	return fe.orientation, nil
+}
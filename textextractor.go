@@ -0,0 +1,1226 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// ExtractedPage holds the text of a single page, slide or worksheet
+type ExtractedPage struct {
+	Number     int     `json:"number"`
+	Label      string  `json:"label,omitempty"` // Sheet name or slide title where available
+	Text       string  `json:"text"`
+	Confidence float64 `json:"confidence,omitempty"` // OCR confidence (0-1) for recognized pages
+}
+
+// TextExtraction is the result of extracting text from a document
+type TextExtraction struct {
+	Path    string          `json:"path"`
+	Method  string          `json:"method"` // "native" or "ocr"
+	Pages   []ExtractedPage `json:"pages"`
+	Scanned bool            `json:"scanned"` // Image or PDF without a text layer
+}
+
+// Text returns the text of all pages joined together
+func (te *TextExtraction) Text() string {
+	parts := make([]string, 0, len(te.Pages))
+	for _, page := range te.Pages {
+		if strings.TrimSpace(page.Text) != "" {
+			parts = append(parts, page.Text)
+		}
+	}
+	return strings.Join(parts, "\n\n")
+}
+
+// PagedText returns the text of all pages separated by form feeds so page
+// numbers survive into chunked AI analysis
+func (te *TextExtraction) PagedText() string {
+	parts := make([]string, 0, len(te.Pages))
+	for _, page := range te.Pages {
+		parts = append(parts, page.Text)
+	}
+	return strings.Join(parts, "\f")
+}
+
+// HasText reports whether any page contains non-whitespace text
+func (te *TextExtraction) HasText() bool {
+	for _, page := range te.Pages {
+		if strings.TrimSpace(page.Text) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// extractNativeText extracts text from born-digital documents without OCR.
+// It returns an error for formats that have no native extractor.
+func extractNativeText(filePath string) (*TextExtraction, error) {
+	ext := strings.ToLower(filepath.Ext(filePath))
+
+	var pages []ExtractedPage
+	var err error
+
+	switch ext {
+	case ".txt", ".md":
+		var content []byte
+		content, err = os.ReadFile(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read text file: %w", err)
+		}
+		pages = []ExtractedPage{{Number: 1, Text: string(content)}}
+	case ".csv":
+		pages, err = extractCSVPages(filePath)
+	case ".rtf":
+		pages, err = extractRTFPages(filePath)
+	case ".pdf":
+		pages, err = extractPDFPages(filePath)
+	case ".docx":
+		pages, err = extractDOCXPages(filePath)
+	case ".pptx":
+		pages, err = extractPPTXPages(filePath)
+	case ".xlsx", ".xlsm":
+		pages, err = extractSpreadsheetPages(filePath)
+	default:
+		return nil, fmt.Errorf("native text extraction not supported for %s files", ext)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	extraction := &TextExtraction{
+		Path:   filePath,
+		Method: "native",
+		Pages:  pages,
+	}
+	extraction.Scanned = ext == ".pdf" && !extraction.HasText()
+	return extraction, nil
+}
+
+// extractCSVPages renders a CSV file as tab-separated text
+func extractCSVPages(filePath string) ([]ExtractedPage, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open CSV file: %w", err)
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+
+	var sb strings.Builder
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CSV file: %w", err)
+		}
+		sb.WriteString(strings.Join(record, "\t"))
+		sb.WriteString("\n")
+	}
+
+	return []ExtractedPage{{Number: 1, Text: sb.String()}}, nil
+}
+
+// extractSpreadsheetPages renders each worksheet as tab-separated text
+func extractSpreadsheetPages(filePath string) ([]ExtractedPage, error) {
+	f, err := excelize.OpenFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open spreadsheet: %w", err)
+	}
+	defer f.Close()
+
+	pages := make([]ExtractedPage, 0)
+	for i, sheet := range f.GetSheetList() {
+		rows, err := f.GetRows(sheet)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read sheet %s: %w", sheet, err)
+		}
+
+		var sb strings.Builder
+		for _, row := range rows {
+			line := strings.TrimRight(strings.Join(row, "\t"), "\t")
+			if line == "" {
+				continue
+			}
+			sb.WriteString(line)
+			sb.WriteString("\n")
+		}
+
+		pages = append(pages, ExtractedPage{
+			Number: i + 1,
+			Label:  sheet,
+			Text:   sb.String(),
+		})
+	}
+
+	return pages, nil
+}
+
+// extractDOCXPages extracts the body text of a Word document. Headers and
+// footers are appended after the body so their content remains searchable.
+func extractDOCXPages(filePath string) ([]ExtractedPage, error) {
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open DOCX file: %w", err)
+	}
+	defer reader.Close()
+
+	var body string
+	var extras []string
+	found := false
+
+	for _, name := range sortedZipNames(&reader.Reader) {
+		isBody := name == "word/document.xml"
+		isExtra := strings.HasPrefix(name, "word/header") || strings.HasPrefix(name, "word/footer") ||
+			name == "word/footnotes.xml"
+		if !isBody && !isExtra {
+			continue
+		}
+
+		data, err := readZipEntry(&reader.Reader, name)
+		if err != nil {
+			return nil, err
+		}
+		text, err := extractOOXMLText(data, "p")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", name, err)
+		}
+
+		if isBody {
+			body = text
+			found = true
+		} else if strings.TrimSpace(text) != "" {
+			extras = append(extras, text)
+		}
+	}
+
+	if !found {
+		return nil, fmt.Errorf("DOCX file has no word/document.xml part")
+	}
+
+	text := body
+	if len(extras) > 0 {
+		text = strings.TrimRight(body, "\n") + "\n\n" + strings.Join(extras, "\n")
+	}
+
+	return []ExtractedPage{{Number: 1, Text: text}}, nil
+}
+
+// pptxSlidePattern matches slide parts inside a PPTX package
+var pptxSlidePattern = regexp.MustCompile(`^ppt/slides/slide(\d+)\.xml$`)
+
+// extractPPTXPages extracts the text of each slide in presentation order
+func extractPPTXPages(filePath string) ([]ExtractedPage, error) {
+	reader, err := zip.OpenReader(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open PPTX file: %w", err)
+	}
+	defer reader.Close()
+
+	type slidePart struct {
+		number int
+		name   string
+	}
+	slides := make([]slidePart, 0)
+	for _, file := range reader.File {
+		if match := pptxSlidePattern.FindStringSubmatch(file.Name); match != nil {
+			number, _ := strconv.Atoi(match[1])
+			slides = append(slides, slidePart{number: number, name: file.Name})
+		}
+	}
+	sort.Slice(slides, func(i, j int) bool { return slides[i].number < slides[j].number })
+
+	pages := make([]ExtractedPage, 0, len(slides))
+	for _, slide := range slides {
+		data, err := readZipEntry(&reader.Reader, slide.name)
+		if err != nil {
+			return nil, err
+		}
+		text, err := extractOOXMLText(data, "p")
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse %s: %w", slide.name, err)
+		}
+		pages = append(pages, ExtractedPage{
+			Number: slide.number,
+			Label:  fmt.Sprintf("Slide %d", slide.number),
+			Text:   text,
+		})
+	}
+
+	return pages, nil
+}
+
+// extractOOXMLText walks WordprocessingML or DrawingML markup and returns the
+// text runs, breaking lines at the given paragraph element
+func extractOOXMLText(data []byte, paragraphElement string) (string, error) {
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	var sb strings.Builder
+	inText := false
+
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch t.Name.Local {
+			case "t":
+				inText = true
+			case "tab":
+				sb.WriteString("\t")
+			case "br", "cr":
+				sb.WriteString("\n")
+			}
+		case xml.EndElement:
+			switch t.Name.Local {
+			case "t":
+				inText = false
+			case paragraphElement:
+				sb.WriteString("\n")
+			case "tc":
+				// Separate table cells so values do not run together
+				sb.WriteString("\t")
+			}
+		case xml.CharData:
+			if inText {
+				sb.Write(t)
+			}
+		}
+	}
+
+	return sb.String(), nil
+}
+
+// sortedZipNames returns the entry names of a zip archive in sorted order
+func sortedZipNames(reader *zip.Reader) []string {
+	names := make([]string, 0, len(reader.File))
+	for _, file := range reader.File {
+		names = append(names, file.Name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// readZipEntry reads a named entry from a zip archive
+func readZipEntry(reader *zip.Reader, name string) ([]byte, error) {
+	for _, file := range reader.File {
+		if file.Name != name {
+			continue
+		}
+		rc, err := file.Open()
+		if err != nil {
+			return nil, fmt.Errorf("failed to open %s: %w", name, err)
+		}
+		defer rc.Close()
+		return io.ReadAll(rc)
+	}
+	return nil, fmt.Errorf("entry %s not found", name)
+}
+
+// extractRTFPages strips RTF control words and returns the plain text
+func extractRTFPages(filePath string) ([]ExtractedPage, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read RTF file: %w", err)
+	}
+	return []ExtractedPage{{Number: 1, Text: stripRTF(data)}}, nil
+}
+
+// rtfSkipDestinations are RTF groups that carry no document text
+var rtfSkipDestinations = map[string]bool{
+	"fonttbl": true, "colortbl": true, "stylesheet": true, "info": true,
+	"pict": true, "header": true, "footer": true, "listtable": true,
+	"listoverridetable": true, "themedata": true, "datastore": true,
+	"latentstyles": true, "rsidtbl": true, "generator": true, "xmlnstbl": true,
+}
+
+// stripRTF converts RTF markup into plain text
+func stripRTF(data []byte) string {
+	var sb strings.Builder
+	// Each entry records whether the enclosing group is being skipped
+	skipStack := []bool{false}
+	skipping := func() bool { return skipStack[len(skipStack)-1] }
+
+	for i := 0; i < len(data); i++ {
+		c := data[i]
+		switch c {
+		case '{':
+			skipStack = append(skipStack, skipping())
+		case '}':
+			if len(skipStack) > 1 {
+				skipStack = skipStack[:len(skipStack)-1]
+			}
+		case '\\':
+			if i+1 >= len(data) {
+				continue
+			}
+			next := data[i+1]
+			switch {
+			case next == '\\' || next == '{' || next == '}':
+				if !skipping() {
+					sb.WriteByte(next)
+				}
+				i++
+			case next == '*':
+				// Ignorable destination
+				skipStack[len(skipStack)-1] = true
+				i++
+			case next == '\'':
+				if i+3 < len(data) {
+					if b, err := hex.DecodeString(string(data[i+2 : i+4])); err == nil && !skipping() {
+						sb.WriteRune(rune(b[0]))
+					}
+				}
+				i += 3
+			case next == '~':
+				if !skipping() {
+					sb.WriteByte(' ')
+				}
+				i++
+			case isASCIILetter(next):
+				j := i + 1
+				for j < len(data) && isASCIILetter(data[j]) {
+					j++
+				}
+				word := string(data[i+1 : j])
+				k := j
+				if k < len(data) && (data[k] == '-' || isASCIIDigit(data[k])) {
+					k++
+					for k < len(data) && isASCIIDigit(data[k]) {
+						k++
+					}
+				}
+				param := string(data[j:k])
+				if k < len(data) && data[k] == ' ' {
+					k++
+				}
+				i = k - 1
+
+				if rtfSkipDestinations[word] {
+					skipStack[len(skipStack)-1] = true
+					continue
+				}
+				if skipping() {
+					continue
+				}
+				switch word {
+				case "par", "line", "sect", "page", "row":
+					sb.WriteString("\n")
+				case "tab", "cell":
+					sb.WriteString("\t")
+				case "u":
+					if code, err := strconv.Atoi(param); err == nil {
+						if code < 0 {
+							code += 65536
+						}
+						sb.WriteRune(rune(code))
+						// Skip the single-character fallback that follows \uN
+						if i+1 < len(data) && data[i+1] != '\\' && data[i+1] != '{' && data[i+1] != '}' {
+							i++
+						}
+					}
+				}
+			default:
+				i++
+			}
+		case '\r', '\n':
+			// Line breaks in RTF source are not significant
+		default:
+			if !skipping() {
+				sb.WriteByte(c)
+			}
+		}
+	}
+
+	return sb.String()
+}
+
+func isASCIILetter(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isASCIIDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+// pdfObject is a parsed indirect object from a PDF file
+type pdfObject struct {
+	number    int
+	dict      string
+	stream    []byte
+	hasStream bool
+	raw       []byte // Undecoded data, kept only for image streams
+}
+
+var (
+	pdfObjectHeader  = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+	pdfReference     = regexp.MustCompile(`(\d+)\s+\d+\s+R\b`)
+	pdfTypePage      = regexp.MustCompile(`/Type\s*/Page\b`)
+	pdfTypePages     = regexp.MustCompile(`/Type\s*/Pages\b`)
+	pdfContentsRef   = regexp.MustCompile(`/Contents\s*(\[[^\]]*\]|\d+\s+\d+\s+R)`)
+	pdfKidsArray     = regexp.MustCompile(`/Kids\s*\[([^\]]*)\]`)
+	pdfResourcesRef  = regexp.MustCompile(`/Resources\s+(\d+)\s+\d+\s+R`)
+	pdfFontDictRef   = regexp.MustCompile(`/Font\s+(\d+)\s+\d+\s+R`)
+	pdfFontDictInner = regexp.MustCompile(`/Font\s*<<([^>]*)>>`)
+	pdfFontEntry     = regexp.MustCompile(`/([^\s/<>\[\]()]+)\s+(\d+)\s+\d+\s+R`)
+	pdfToUnicodeRef  = regexp.MustCompile(`/ToUnicode\s+(\d+)\s+\d+\s+R`)
+	pdfIntEntry      = func(key string) *regexp.Regexp { return regexp.MustCompile(`/` + key + `\s+(\d+)`) }
+	pdfObjStmCount   = pdfIntEntry("N")
+	pdfObjStmFirst   = pdfIntEntry("First")
+)
+
+// extractPDFPages extracts the text layer of a PDF page by page. Pages with
+// no text layer are returned with empty text so callers can fall back to OCR.
+func extractPDFPages(filePath string) ([]ExtractedPage, error) {
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read PDF file: %w", err)
+	}
+	if !bytes.HasPrefix(bytes.TrimLeft(data, " \r\n\t"), []byte("%PDF")) {
+		return nil, fmt.Errorf("file is not a PDF document")
+	}
+	if bytes.Contains(data, []byte("/Encrypt")) {
+		return nil, fmt.Errorf("encrypted PDF documents are not supported")
+	}
+
+	objects := parsePDFObjects(data)
+	pageObjects := orderPDFPages(objects)
+
+	pages := make([]ExtractedPage, 0, len(pageObjects))
+	for i, page := range pageObjects {
+		fonts := resolvePDFFonts(page, objects)
+
+		var sb strings.Builder
+		for _, ref := range pdfContentRefs(page.dict) {
+			content, ok := objects[ref]
+			if !ok || !content.hasStream {
+				continue
+			}
+			sb.WriteString(interpretPDFContent(content.stream, fonts))
+		}
+
+		pages = append(pages, ExtractedPage{
+			Number: i + 1,
+			Text:   normalizeExtractedText(sb.String()),
+		})
+	}
+
+	// Fall back to scanning every content stream when the page tree could not
+	// be resolved (e.g. damaged cross-reference data)
+	if len(pages) == 0 {
+		numbers := make([]int, 0, len(objects))
+		for number := range objects {
+			numbers = append(numbers, number)
+		}
+		sort.Ints(numbers)
+
+		var sb strings.Builder
+		for _, number := range numbers {
+			obj := objects[number]
+			if obj.hasStream && bytes.Contains(obj.stream, []byte("BT")) {
+				sb.WriteString(interpretPDFContent(obj.stream, nil))
+			}
+		}
+		pages = append(pages, ExtractedPage{Number: 1, Text: normalizeExtractedText(sb.String())})
+	}
+
+	return pages, nil
+}
+
+// parsePDFObjects scans a PDF file for indirect objects, decoding streams and
+// unpacking compressed object streams
+func parsePDFObjects(data []byte) map[int]*pdfObject {
+	objects := make(map[int]*pdfObject)
+	cursor := 0
+
+	for cursor < len(data) {
+		loc := pdfObjectHeader.FindSubmatchIndex(data[cursor:])
+		if loc == nil {
+			break
+		}
+		number, _ := strconv.Atoi(string(data[cursor+loc[2] : cursor+loc[3]]))
+		bodyStart := cursor + loc[1]
+		body := data[bodyStart:]
+
+		endObj := bytes.Index(body, []byte("endobj"))
+		if endObj < 0 {
+			endObj = len(body)
+		}
+		streamIdx := indexStreamKeyword(body[:endObj])
+
+		obj := &pdfObject{number: number}
+		if streamIdx >= 0 {
+			obj.dict = string(body[:streamIdx])
+			raw := body[streamIdx+len("stream"):]
+			raw = bytes.TrimPrefix(raw, []byte("\r"))
+			raw = bytes.TrimPrefix(raw, []byte("\n"))
+			endStream := bytes.Index(raw, []byte("endstream"))
+			if endStream < 0 {
+				endStream = len(raw)
+			}
+			streamData := bytes.TrimSuffix(raw[:endStream], []byte("\n"))
+			streamData = bytes.TrimSuffix(streamData, []byte("\r"))
+			obj.stream = decodePDFStream(obj.dict, streamData)
+			obj.hasStream = obj.stream != nil
+			if isPDFImage(obj.dict) {
+				obj.raw = streamData
+			}
+
+			consumed := len(body) - len(raw) + endStream
+			cursor = bodyStart + consumed
+		} else {
+			obj.dict = string(body[:endObj])
+			cursor = bodyStart + endObj
+		}
+		objects[number] = obj
+
+		if obj.hasStream && strings.Contains(obj.dict, "/ObjStm") {
+			for n, inner := range unpackPDFObjectStream(obj) {
+				if _, exists := objects[n]; !exists {
+					objects[n] = inner
+				}
+			}
+		}
+	}
+
+	return objects
+}
+
+// indexStreamKeyword finds the "stream" keyword that follows an object dictionary
+func indexStreamKeyword(body []byte) int {
+	offset := 0
+	for {
+		idx := bytes.Index(body[offset:], []byte("stream"))
+		if idx < 0 {
+			return -1
+		}
+		abs := offset + idx
+		if abs >= 3 && string(body[abs-3:abs]) == "end" {
+			offset = abs + len("stream")
+			continue
+		}
+		return abs
+	}
+}
+
+// decodePDFStream decodes a stream body according to its filter. Only
+// FlateDecode and unfiltered streams are supported; image filters return nil.
+func decodePDFStream(dict string, raw []byte) []byte {
+	if isPDFImage(dict) || strings.Contains(dict, "/Length1") || strings.Contains(dict, "/XRef") {
+		return nil
+	}
+
+	if !strings.Contains(dict, "/Filter") {
+		return raw
+	}
+	if !isPDFFlate(dict) {
+		return nil
+	}
+	return inflatePDFStream(raw)
+}
+
+// isPDFFlate reports whether a stream dictionary uses FlateDecode
+func isPDFFlate(dict string) bool {
+	return strings.Contains(dict, "/FlateDecode") || strings.Contains(dict, "/Fl ") || strings.Contains(dict, "/Fl]")
+}
+
+// inflatePDFStream decompresses FlateDecode data, or returns nil if it is
+// not valid deflate data
+func inflatePDFStream(raw []byte) []byte {
+	if zr, err := zlib.NewReader(bytes.NewReader(raw)); err == nil {
+		decoded, err := io.ReadAll(zr)
+		zr.Close()
+		if err == nil || len(decoded) > 0 {
+			return decoded
+		}
+	}
+
+	// Some producers omit the zlib header
+	fr := flate.NewReader(bytes.NewReader(raw))
+	defer fr.Close()
+	decoded, _ := io.ReadAll(fr)
+	if len(decoded) == 0 {
+		return nil
+	}
+	return decoded
+}
+
+// isPDFImage reports whether an object dictionary describes an image XObject
+func isPDFImage(dict string) bool {
+	return strings.Contains(dict, "/Subtype/Image") || strings.Contains(dict, "/Subtype /Image")
+}
+
+// unpackPDFObjectStream extracts the objects stored inside an /ObjStm stream
+func unpackPDFObjectStream(obj *pdfObject) map[int]*pdfObject {
+	result := make(map[int]*pdfObject)
+
+	countMatch := pdfObjStmCount.FindStringSubmatch(obj.dict)
+	firstMatch := pdfObjStmFirst.FindStringSubmatch(obj.dict)
+	if countMatch == nil || firstMatch == nil {
+		return result
+	}
+	count, _ := strconv.Atoi(countMatch[1])
+	first, _ := strconv.Atoi(firstMatch[1])
+	if first > len(obj.stream) {
+		return result
+	}
+
+	header := strings.Fields(string(obj.stream[:first]))
+	type entry struct{ number, offset int }
+	entries := make([]entry, 0, count)
+	for i := 0; i+1 < len(header) && len(entries) < count; i += 2 {
+		number, err1 := strconv.Atoi(header[i])
+		offset, err2 := strconv.Atoi(header[i+1])
+		if err1 != nil || err2 != nil {
+			break
+		}
+		entries = append(entries, entry{number: number, offset: offset})
+	}
+
+	for i, e := range entries {
+		start := first + e.offset
+		end := len(obj.stream)
+		if i+1 < len(entries) {
+			end = first + entries[i+1].offset
+		}
+		if start < 0 || start > end || end > len(obj.stream) {
+			continue
+		}
+		result[e.number] = &pdfObject{number: e.number, dict: string(obj.stream[start:end])}
+	}
+
+	return result
+}
+
+// orderPDFPages returns page objects in reading order by walking the page tree,
+// falling back to object order when no tree root is found
+func orderPDFPages(objects map[int]*pdfObject) []*pdfObject {
+	var root *pdfObject
+	for _, obj := range objects {
+		if pdfTypePages.MatchString(obj.dict) && !strings.Contains(obj.dict, "/Parent") {
+			root = obj
+			break
+		}
+	}
+
+	pages := make([]*pdfObject, 0)
+	if root != nil {
+		visited := make(map[int]bool)
+		var walk func(node *pdfObject)
+		walk = func(node *pdfObject) {
+			if node == nil || visited[node.number] {
+				return
+			}
+			visited[node.number] = true
+			if pdfTypePages.MatchString(node.dict) {
+				kids := pdfKidsArray.FindStringSubmatch(node.dict)
+				if kids == nil {
+					return
+				}
+				for _, ref := range pdfReference.FindAllStringSubmatch(kids[1], -1) {
+					number, _ := strconv.Atoi(ref[1])
+					walk(objects[number])
+				}
+				return
+			}
+			if pdfTypePage.MatchString(node.dict) {
+				pages = append(pages, node)
+			}
+		}
+		walk(root)
+	}
+
+	if len(pages) > 0 {
+		return pages
+	}
+
+	numbers := make([]int, 0)
+	for number, obj := range objects {
+		if pdfTypePage.MatchString(obj.dict) {
+			numbers = append(numbers, number)
+		}
+	}
+	sort.Ints(numbers)
+	for _, number := range numbers {
+		pages = append(pages, objects[number])
+	}
+	return pages
+}
+
+// pdfContentRefs returns the object numbers of a page's content streams
+func pdfContentRefs(pageDict string) []int {
+	match := pdfContentsRef.FindStringSubmatch(pageDict)
+	if match == nil {
+		return nil
+	}
+	refs := make([]int, 0)
+	for _, ref := range pdfReference.FindAllStringSubmatch(match[1], -1) {
+		number, _ := strconv.Atoi(ref[1])
+		refs = append(refs, number)
+	}
+	return refs
+}
+
+// resolvePDFFonts maps a page's font resource names to their ToUnicode CMaps
+func resolvePDFFonts(page *pdfObject, objects map[int]*pdfObject) map[string]map[string]string {
+	fonts := make(map[string]map[string]string)
+
+	resources := page.dict
+	if match := pdfResourcesRef.FindStringSubmatch(page.dict); match != nil {
+		number, _ := strconv.Atoi(match[1])
+		if obj, ok := objects[number]; ok {
+			resources = obj.dict
+		}
+	}
+
+	fontDict := ""
+	if match := pdfFontDictRef.FindStringSubmatch(resources); match != nil {
+		number, _ := strconv.Atoi(match[1])
+		if obj, ok := objects[number]; ok {
+			fontDict = obj.dict
+		}
+	} else if match := pdfFontDictInner.FindStringSubmatch(resources); match != nil {
+		fontDict = match[1]
+	}
+
+	for _, entry := range pdfFontEntry.FindAllStringSubmatch(fontDict, -1) {
+		number, _ := strconv.Atoi(entry[2])
+		font, ok := objects[number]
+		if !ok {
+			continue
+		}
+		toUnicode := pdfToUnicodeRef.FindStringSubmatch(font.dict)
+		if toUnicode == nil {
+			continue
+		}
+		cmapNumber, _ := strconv.Atoi(toUnicode[1])
+		if cmapObj, ok := objects[cmapNumber]; ok && cmapObj.hasStream {
+			fonts[entry[1]] = parsePDFCMap(cmapObj.stream)
+		}
+	}
+
+	return fonts
+}
+
+var (
+	pdfBFCharBlock  = regexp.MustCompile(`(?s)beginbfchar(.*?)endbfchar`)
+	pdfBFRangeBlock = regexp.MustCompile(`(?s)beginbfrange(.*?)endbfrange`)
+	pdfHexToken     = regexp.MustCompile(`<([0-9A-Fa-f]*)>`)
+	pdfBFRangeLine  = regexp.MustCompile(`<([0-9A-Fa-f]+)>\s*<([0-9A-Fa-f]+)>\s*(<[0-9A-Fa-f]+>|\[[^\]]*\])`)
+)
+
+// parsePDFCMap parses the bfchar and bfrange sections of a ToUnicode CMap.
+// Keys are upper-case hex character codes.
+func parsePDFCMap(data []byte) map[string]string {
+	cmap := make(map[string]string)
+	text := string(data)
+
+	for _, block := range pdfBFCharBlock.FindAllStringSubmatch(text, -1) {
+		tokens := pdfHexToken.FindAllStringSubmatch(block[1], -1)
+		for i := 0; i+1 < len(tokens); i += 2 {
+			cmap[strings.ToUpper(tokens[i][1])] = decodeUTF16Hex(tokens[i+1][1])
+		}
+	}
+
+	for _, block := range pdfBFRangeBlock.FindAllStringSubmatch(text, -1) {
+		for _, line := range pdfBFRangeLine.FindAllStringSubmatch(block[1], -1) {
+			width := len(line[1])
+			start, err1 := strconv.ParseUint(line[1], 16, 32)
+			end, err2 := strconv.ParseUint(line[2], 16, 32)
+			if err1 != nil || err2 != nil || end < start || end-start > 0xFFFF {
+				continue
+			}
+
+			if strings.HasPrefix(line[3], "[") {
+				targets := pdfHexToken.FindAllStringSubmatch(line[3], -1)
+				for i := 0; i < len(targets) && start+uint64(i) <= end; i++ {
+					cmap[fmt.Sprintf("%0*X", width, start+uint64(i))] = decodeUTF16Hex(targets[i][1])
+				}
+				continue
+			}
+
+			base := strings.Trim(line[3], "<>")
+			baseValue, err := strconv.ParseUint(base, 16, 32)
+			if err != nil {
+				continue
+			}
+			for code := start; code <= end; code++ {
+				target := fmt.Sprintf("%0*X", len(base), baseValue+(code-start))
+				cmap[fmt.Sprintf("%0*X", width, code)] = decodeUTF16Hex(target)
+			}
+		}
+	}
+
+	return cmap
+}
+
+// decodeUTF16Hex decodes a hex string of big-endian UTF-16 code units
+func decodeUTF16Hex(h string) string {
+	raw, err := hex.DecodeString(h)
+	if err != nil {
+		return ""
+	}
+	return decodeUTF16BE(raw)
+}
+
+func decodeUTF16BE(raw []byte) string {
+	units := make([]uint16, 0, len(raw)/2)
+	for i := 0; i+1 < len(raw); i += 2 {
+		units = append(units, uint16(raw[i])<<8|uint16(raw[i+1]))
+	}
+	return string(utf16.Decode(units))
+}
+
+// pdfToken is a lexical token from a PDF content stream
+type pdfToken struct {
+	kind  byte // 's' string, 'h' hex string, 'n' number, 'o' operator, '[' / ']' array delimiters, '/' name
+	value string
+}
+
+// interpretPDFContent runs the text operators of a content stream and returns
+// the text they draw. fonts maps resource names to ToUnicode CMaps.
+func interpretPDFContent(content []byte, fonts map[string]map[string]string) string {
+	var sb strings.Builder
+	var operands []pdfToken
+	var cmap map[string]string
+	inArray := false
+	var array []pdfToken
+
+	emit := func(tok pdfToken) {
+		sb.WriteString(decodePDFString(tok, cmap))
+	}
+
+	lex := newPDFLexer(content)
+	for {
+		tok, ok := lex.next()
+		if !ok {
+			break
+		}
+
+		switch tok.kind {
+		case '[':
+			inArray = true
+			array = array[:0]
+			continue
+		case ']':
+			inArray = false
+			operands = append(operands, pdfToken{kind: ']'})
+			continue
+		}
+
+		if inArray {
+			array = append(array, tok)
+			continue
+		}
+
+		if tok.kind != 'o' {
+			operands = append(operands, tok)
+			continue
+		}
+
+		switch tok.value {
+		case "Tf":
+			for _, op := range operands {
+				if op.kind == '/' {
+					cmap = fonts[op.value]
+				}
+			}
+		case "Tj":
+			if len(operands) > 0 {
+				emit(operands[len(operands)-1])
+			}
+		case "'", "\"":
+			sb.WriteString("\n")
+			if len(operands) > 0 {
+				emit(operands[len(operands)-1])
+			}
+		case "TJ":
+			for _, element := range array {
+				switch element.kind {
+				case 's', 'h':
+					emit(element)
+				case 'n':
+					// Large negative kerning adjustments represent word gaps
+					if adjustment, err := strconv.ParseFloat(element.value, 64); err == nil && adjustment < -180 {
+						sb.WriteString(" ")
+					}
+				}
+			}
+		case "Td", "TD":
+			if len(operands) >= 2 {
+				if ty, err := strconv.ParseFloat(operands[len(operands)-1].value, 64); err == nil && ty != 0 {
+					sb.WriteString("\n")
+				} else {
+					sb.WriteString(" ")
+				}
+			}
+		case "T*", "Tm":
+			sb.WriteString("\n")
+		case "ET":
+			sb.WriteString("\n")
+		case "BI":
+			lex.skipInlineImage()
+		}
+		operands = operands[:0]
+	}
+
+	return sb.String()
+}
+
+// decodePDFString converts a string operand into text, using the current
+// font's CMap when one is available
+func decodePDFString(tok pdfToken, cmap map[string]string) string {
+	raw := []byte(tok.value)
+
+	if len(cmap) > 0 {
+		if text, ok := mapPDFCodes(raw, cmap, 2); ok {
+			return text
+		}
+		if text, ok := mapPDFCodes(raw, cmap, 1); ok {
+			return text
+		}
+	}
+
+	if len(raw) >= 2 && raw[0] == 0xFE && raw[1] == 0xFF {
+		return decodeUTF16BE(raw[2:])
+	}
+
+	// Treat single-byte strings as Latin-1 (close to WinAnsi/PDFDocEncoding)
+	runes := make([]rune, 0, len(raw))
+	for _, b := range raw {
+		runes = append(runes, rune(b))
+	}
+	return string(runes)
+}
+
+// mapPDFCodes maps fixed-width character codes through a CMap, failing if
+// any code is missing
+func mapPDFCodes(raw []byte, cmap map[string]string, width int) (string, bool) {
+	if len(raw)%width != 0 {
+		return "", false
+	}
+	var sb strings.Builder
+	for i := 0; i < len(raw); i += width {
+		code := strings.ToUpper(hex.EncodeToString(raw[i : i+width]))
+		text, ok := cmap[code]
+		if !ok {
+			return "", false
+		}
+		sb.WriteString(text)
+	}
+	return sb.String(), true
+}
+
+// pdfLexer tokenizes PDF content streams
+type pdfLexer struct {
+	data []byte
+	pos  int
+}
+
+func newPDFLexer(data []byte) *pdfLexer {
+	return &pdfLexer{data: data}
+}
+
+func isPDFWhitespace(c byte) bool {
+	return c == ' ' || c == '\n' || c == '\r' || c == '\t' || c == '\f' || c == 0
+}
+
+func isPDFDelimiter(c byte) bool {
+	return strings.IndexByte("()<>[]{}/%", c) >= 0
+}
+
+func (l *pdfLexer) next() (pdfToken, bool) {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch {
+		case isPDFWhitespace(c):
+			l.pos++
+		case c == '%':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+		case c == '(':
+			return pdfToken{kind: 's', value: l.readLiteralString()}, true
+		case c == '<':
+			if l.pos+1 < len(l.data) && l.data[l.pos+1] == '<' {
+				l.pos += 2
+				return pdfToken{kind: 'o', value: "<<"}, true
+			}
+			return pdfToken{kind: 'h', value: l.readHexString()}, true
+		case c == '>':
+			l.pos++
+			if l.pos < len(l.data) && l.data[l.pos] == '>' {
+				l.pos++
+			}
+			return pdfToken{kind: 'o', value: ">>"}, true
+		case c == '[' || c == ']':
+			l.pos++
+			return pdfToken{kind: c}, true
+		case c == '{' || c == '}':
+			l.pos++
+		case c == '/':
+			l.pos++
+			return pdfToken{kind: '/', value: l.readRegular()}, true
+		default:
+			word := l.readRegular()
+			if word == "" {
+				l.pos++
+				continue
+			}
+			if _, err := strconv.ParseFloat(word, 64); err == nil {
+				return pdfToken{kind: 'n', value: word}, true
+			}
+			return pdfToken{kind: 'o', value: word}, true
+		}
+	}
+	return pdfToken{}, false
+}
+
+func (l *pdfLexer) readRegular() string {
+	start := l.pos
+	for l.pos < len(l.data) && !isPDFWhitespace(l.data[l.pos]) && !isPDFDelimiter(l.data[l.pos]) {
+		l.pos++
+	}
+	return string(l.data[start:l.pos])
+}
+
+func (l *pdfLexer) readLiteralString() string {
+	l.pos++ // opening parenthesis
+	depth := 1
+	var out []byte
+
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+		switch c {
+		case '(':
+			depth++
+			out = append(out, c)
+		case ')':
+			depth--
+			if depth == 0 {
+				return string(out)
+			}
+			out = append(out, c)
+		case '\\':
+			if l.pos >= len(l.data) {
+				break
+			}
+			e := l.data[l.pos]
+			l.pos++
+			switch e {
+			case 'n':
+				out = append(out, '\n')
+			case 'r':
+				out = append(out, '\r')
+			case 't':
+				out = append(out, '\t')
+			case 'b':
+				out = append(out, '\b')
+			case 'f':
+				out = append(out, '\f')
+			case '\r':
+				if l.pos < len(l.data) && l.data[l.pos] == '\n' {
+					l.pos++
+				}
+			case '\n':
+				// Line continuation
+			default:
+				if e >= '0' && e <= '7' {
+					value := int(e - '0')
+					for n := 0; n < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; n++ {
+						value = value*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					out = append(out, byte(value))
+				} else {
+					out = append(out, e)
+				}
+			}
+		default:
+			out = append(out, c)
+		}
+	}
+	return string(out)
+}
+
+func (l *pdfLexer) readHexString() string {
+	l.pos++ // opening angle bracket
+	var digits []byte
+	for l.pos < len(l.data) && l.data[l.pos] != '>' {
+		if c := l.data[l.pos]; !isPDFWhitespace(c) {
+			digits = append(digits, c)
+		}
+		l.pos++
+	}
+	l.pos++ // closing angle bracket
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+	decoded, err := hex.DecodeString(string(digits))
+	if err != nil {
+		return ""
+	}
+	return string(decoded)
+}
+
+// skipInlineImage advances past inline image data (BI ... ID <data> EI)
+func (l *pdfLexer) skipInlineImage() {
+	idx := bytes.Index(l.data[l.pos:], []byte("ID"))
+	if idx < 0 {
+		l.pos = len(l.data)
+		return
+	}
+	l.pos += idx + 2
+	end := bytes.Index(l.data[l.pos:], []byte("EI"))
+	if end < 0 {
+		l.pos = len(l.data)
+		return
+	}
+	l.pos += end + 2
+}
+
+// normalizeExtractedText collapses runs of blank lines and trailing spaces
+func normalizeExtractedText(text string) string {
+	lines := strings.Split(text, "\n")
+	result := make([]string, 0, len(lines))
+	blank := false
+	for _, line := range lines {
+		line = strings.TrimRight(line, " \t\r")
+		if strings.TrimSpace(line) == "" {
+			if !blank && len(result) > 0 {
+				result = append(result, "")
+			}
+			blank = true
+			continue
+		}
+		blank = false
+		result = append(result, line)
+	}
+	return strings.TrimSpace(strings.Join(result, "\n"))
+}
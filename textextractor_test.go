@@ -0,0 +1,366 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// writeTestPDF builds a minimal PDF with one content stream per page.
+// Compressed pages use FlateDecode.
+func writeTestPDF(t *testing.T, path string, pages []string, compress bool) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	buf.WriteString("%PDF-1.4\n")
+
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 3+i*2)
+	}
+	buf.WriteString("1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n")
+	buf.WriteString(fmt.Sprintf("2 0 obj\n<< /Type /Pages /Kids [%s] /Count %d >>\nendobj\n", strings.Join(kids, " "), len(pages)))
+
+	for i, content := range pages {
+		pageNum := 3 + i*2
+		contentNum := pageNum + 1
+		buf.WriteString(fmt.Sprintf("%d 0 obj\n<< /Type /Page /Parent 2 0 R /Contents %d 0 R >>\nendobj\n", pageNum, contentNum))
+
+		stream := []byte(content)
+		filter := ""
+		if compress {
+			var zbuf bytes.Buffer
+			zw := zlib.NewWriter(&zbuf)
+			zw.Write(stream)
+			zw.Close()
+			stream = zbuf.Bytes()
+			filter = " /Filter /FlateDecode"
+		}
+		buf.WriteString(fmt.Sprintf("%d 0 obj\n<< /Length %d%s >>\nstream\n", contentNum, len(stream), filter))
+		buf.Write(stream)
+		buf.WriteString("\nendstream\nendobj\n")
+	}
+	buf.WriteString("trailer\n<< /Root 1 0 R >>\n%%EOF\n")
+
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write PDF: %v", err)
+	}
+}
+
+// writeTestZip writes an OOXML-style package from name/content pairs
+func writeTestZip(t *testing.T, path string, entries map[string]string) {
+	t.Helper()
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for name, content := range entries {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatalf("Failed to create zip entry: %v", err)
+		}
+		w.Write([]byte(content))
+	}
+	zw.Close()
+
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatalf("Failed to write zip: %v", err)
+	}
+}
+
+func TestExtractPDFPages(t *testing.T) {
+	tempDir := t.TempDir()
+
+	t.Run("extracts text from uncompressed and compressed pages", func(t *testing.T) {
+		for _, compress := range []bool{false, true} {
+			path := filepath.Join(tempDir, fmt.Sprintf("report_%v.pdf", compress))
+			writeTestPDF(t, path, []string{
+				"BT /F1 12 Tf 72 700 Td (Revenue FY2023) Tj 0 -14 Td (EBITDA \\(adjusted\\)) Tj ET",
+				"BT /F1 12 Tf 72 700 Td [(Net)-250(Income)] TJ ET",
+			}, compress)
+
+			pages, err := extractPDFPages(path)
+			if err != nil {
+				t.Fatalf("extractPDFPages failed: %v", err)
+			}
+			if len(pages) != 2 {
+				t.Fatalf("Expected 2 pages, got %d", len(pages))
+			}
+			if !strings.Contains(pages[0].Text, "Revenue FY2023") {
+				t.Errorf("Expected page 1 to contain revenue text, got %q", pages[0].Text)
+			}
+			if !strings.Contains(pages[0].Text, "EBITDA (adjusted)") {
+				t.Errorf("Expected escaped parentheses to be decoded, got %q", pages[0].Text)
+			}
+			if pages[1].Text != "Net Income" {
+				t.Errorf("Expected kerned TJ text 'Net Income', got %q", pages[1].Text)
+			}
+		}
+	})
+
+	t.Run("returns empty pages for scanned PDFs", func(t *testing.T) {
+		path := filepath.Join(tempDir, "scan.pdf")
+		writeTestPDF(t, path, []string{"q 612 0 0 792 0 0 cm /Im0 Do Q"}, true)
+
+		pages, err := extractPDFPages(path)
+		if err != nil {
+			t.Fatalf("extractPDFPages failed: %v", err)
+		}
+		if (&TextExtraction{Pages: pages}).HasText() {
+			t.Error("Expected no text layer for image-only PDF")
+		}
+	})
+
+	t.Run("applies ToUnicode CMaps", func(t *testing.T) {
+		cmap := "begincmap\n2 beginbfchar\n<0001> <0048>\n<0002> <0069>\nendbfchar\nendcmap"
+		content := "BT /F1 12 Tf <00010002> Tj ET"
+		pdf := "%PDF-1.5\n" +
+			"1 0 obj\n<< /Type /Catalog /Pages 2 0 R >>\nendobj\n" +
+			"2 0 obj\n<< /Type /Pages /Kids [3 0 R] /Count 1 >>\nendobj\n" +
+			"3 0 obj\n<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >>\nendobj\n" +
+			fmt.Sprintf("4 0 obj\n<< /Length %d >>\nstream\n%s\nendstream\nendobj\n", len(content), content) +
+			"5 0 obj\n<< /Type /Font /Subtype /Type0 /ToUnicode 6 0 R >>\nendobj\n" +
+			fmt.Sprintf("6 0 obj\n<< /Length %d >>\nstream\n%s\nendstream\nendobj\n", len(cmap), cmap)
+		path := filepath.Join(tempDir, "cid.pdf")
+		os.WriteFile(path, []byte(pdf), 0644)
+
+		pages, err := extractPDFPages(path)
+		if err != nil {
+			t.Fatalf("extractPDFPages failed: %v", err)
+		}
+		if len(pages) != 1 || pages[0].Text != "Hi" {
+			t.Errorf("Expected CMap-decoded text 'Hi', got %+v", pages)
+		}
+	})
+
+	t.Run("rejects non-PDF files", func(t *testing.T) {
+		path := filepath.Join(tempDir, "fake.pdf")
+		os.WriteFile(path, []byte("not a pdf"), 0644)
+		if _, err := extractPDFPages(path); err == nil {
+			t.Error("Expected error for non-PDF content")
+		}
+	})
+}
+
+func TestExtractOOXMLDocuments(t *testing.T) {
+	tempDir := t.TempDir()
+
+	t.Run("DOCX body, tables and headers", func(t *testing.T) {
+		path := filepath.Join(tempDir, "memo.docx")
+		writeTestZip(t, path, map[string]string{
+			"word/document.xml": `<?xml version="1.0"?><w:document xmlns:w="w"><w:body>` +
+				`<w:p><w:r><w:t>Change of </w:t></w:r><w:r><w:t>Control</w:t></w:r></w:p>` +
+				`<w:tbl><w:tr><w:tc><w:p><w:r><w:t>Revenue</w:t></w:r></w:p></w:tc><w:tc><w:p><w:r><w:t>25.0</w:t></w:r></w:p></w:tc></w:tr></w:tbl>` +
+				`</w:body></w:document>`,
+			"word/header1.xml": `<w:hdr xmlns:w="w"><w:p><w:r><w:t>Strictly Confidential</w:t></w:r></w:p></w:hdr>`,
+		})
+
+		pages, err := extractDOCXPages(path)
+		if err != nil {
+			t.Fatalf("extractDOCXPages failed: %v", err)
+		}
+		text := pages[0].Text
+		for _, expected := range []string{"Change of Control", "Revenue", "25.0", "Strictly Confidential"} {
+			if !strings.Contains(text, expected) {
+				t.Errorf("Expected DOCX text to contain %q, got %q", expected, text)
+			}
+		}
+	})
+
+	t.Run("PPTX slides in numeric order", func(t *testing.T) {
+		path := filepath.Join(tempDir, "teaser.pptx")
+		slide := func(text string) string {
+			return `<p:sld xmlns:p="p" xmlns:a="a"><p:cSld><p:spTree><p:sp><p:txBody><a:p><a:r><a:t>` + text + `</a:t></a:r></a:p></p:txBody></p:sp></p:spTree></p:cSld></p:sld>`
+		}
+		writeTestZip(t, path, map[string]string{
+			"ppt/slides/slide10.xml": slide("Appendix"),
+			"ppt/slides/slide2.xml":  slide("Investment Highlights"),
+			"ppt/slides/slide1.xml":  slide("Project Falcon"),
+		})
+
+		pages, err := extractPPTXPages(path)
+		if err != nil {
+			t.Fatalf("extractPPTXPages failed: %v", err)
+		}
+		if len(pages) != 3 {
+			t.Fatalf("Expected 3 slides, got %d", len(pages))
+		}
+		expected := []string{"Project Falcon", "Investment Highlights", "Appendix"}
+		for i, want := range expected {
+			if strings.TrimSpace(pages[i].Text) != want {
+				t.Errorf("Slide %d: expected %q, got %q", i+1, want, pages[i].Text)
+			}
+		}
+		if pages[2].Number != 10 {
+			t.Errorf("Expected last slide number 10, got %d", pages[2].Number)
+		}
+	})
+
+	t.Run("XLSX sheets as pages", func(t *testing.T) {
+		path := filepath.Join(tempDir, "financials.xlsx")
+		f := excelize.NewFile()
+		f.SetSheetName("Sheet1", "P&L")
+		f.SetCellValue("P&L", "A1", "Line Item")
+		f.SetCellValue("P&L", "B1", "FY2023")
+		f.SetCellValue("P&L", "A2", "Revenue")
+		f.SetCellValue("P&L", "B2", 25000000)
+		f.NewSheet("Balance Sheet")
+		f.SetCellValue("Balance Sheet", "A1", "Total Assets")
+		if err := f.SaveAs(path); err != nil {
+			t.Fatalf("Failed to save workbook: %v", err)
+		}
+
+		pages, err := extractSpreadsheetPages(path)
+		if err != nil {
+			t.Fatalf("extractSpreadsheetPages failed: %v", err)
+		}
+		if len(pages) != 2 {
+			t.Fatalf("Expected 2 sheets, got %d", len(pages))
+		}
+		if pages[0].Label != "P&L" || !strings.Contains(pages[0].Text, "Revenue\t25000000") {
+			t.Errorf("Unexpected first sheet: %+v", pages[0])
+		}
+		if pages[1].Label != "Balance Sheet" {
+			t.Errorf("Expected second sheet label 'Balance Sheet', got %q", pages[1].Label)
+		}
+	})
+}
+
+func TestStripRTF(t *testing.T) {
+	rtf := `{\rtf1\ansi{\fonttbl{\f0 Times;}}{\*\generator Writer;}\f0 Purchase Price\tab \'2425m\par Caf\u233?\par}`
+	text := stripRTF([]byte(rtf))
+
+	if strings.Contains(text, "Times") || strings.Contains(text, "Writer") {
+		t.Errorf("Expected font table and ignorable destinations to be skipped, got %q", text)
+	}
+	if !strings.Contains(text, "Purchase Price\t$25m\n") {
+		t.Errorf("Expected tab, hex escape and paragraph to be decoded, got %q", text)
+	}
+	if !strings.Contains(text, "Café") {
+		t.Errorf("Expected unicode escape to be decoded, got %q", text)
+	}
+}
+
+func TestDocumentProcessorNativeExtraction(t *testing.T) {
+	dp := NewDocumentProcessor(nil)
+	tempDir := t.TempDir()
+
+	t.Run("ExtractText reads PDF text layer without OCR", func(t *testing.T) {
+		path := filepath.Join(tempDir, "cim.pdf")
+		writeTestPDF(t, path, []string{"BT (Company Overview) Tj ET"}, true)
+
+		text, err := dp.ExtractText(path)
+		if err != nil {
+			t.Fatalf("ExtractText failed: %v", err)
+		}
+		if text != "Company Overview" {
+			t.Errorf("Expected 'Company Overview', got %q", text)
+		}
+	})
+
+	t.Run("ExtractText reads CSV files", func(t *testing.T) {
+		path := filepath.Join(tempDir, "data.csv")
+		os.WriteFile(path, []byte("Metric,Value\nRevenue,100\n"), 0644)
+
+		text, err := dp.ExtractText(path)
+		if err != nil {
+			t.Fatalf("ExtractText failed: %v", err)
+		}
+		if !strings.Contains(text, "Revenue\t100") {
+			t.Errorf("Expected CSV rows, got %q", text)
+		}
+	})
+
+	t.Run("scanned PDF is flagged and uses OCR when enabled", func(t *testing.T) {
+		path := filepath.Join(tempDir, "signed_spa.pdf")
+		writeTestPDF(t, path, []string{"q /Im0 Do Q"}, false)
+
+		docInfo, err := dp.ProcessDocument(path)
+		if err != nil {
+			t.Fatalf("ProcessDocument failed: %v", err)
+		}
+		if !docInfo.IsScanned {
+			t.Error("Expected PDF without text layer to be marked as scanned")
+		}
+
+		text, err := dp.ExtractText(path)
+		if err != nil || text != "" {
+			t.Errorf("Expected empty text without OCR, got %q (err %v)", text, err)
+		}
+
+		ocrDP := NewDocumentProcessor(nil)
+		ocrDP.SetOCRService(NewOCRServiceWithEngine(NewFakeOCREngine()))
+		extraction, err := ocrDP.ExtractPages(path)
+		if err != nil {
+			t.Fatalf("ExtractPages failed: %v", err)
+		}
+		if extraction.Method != "ocr" || !extraction.Scanned {
+			t.Errorf("Expected scanned OCR fallback for scanned PDF, got method %q", extraction.Method)
+		}
+	})
+
+	t.Run("multi-page TIFF keeps OCR pages and confidence", func(t *testing.T) {
+		path := filepath.Join(tempDir, "board_pack.tif")
+		os.WriteFile(path, []byte("II*\x00"), 0644)
+
+		engine := NewFakeOCREngine()
+		engine.SetPages(path,
+			OCRPage{Number: 1, Text: "Board minutes", Confidence: 0.92},
+			OCRPage{Number: 2, Warning: "unreadable frame"},
+			OCRPage{Number: 3, Text: "Resolutions", Confidence: 0.81})
+		ocrDP := NewDocumentProcessor(nil)
+		ocrDP.SetOCRService(NewOCRServiceWithEngine(engine))
+
+		extraction, err := ocrDP.ExtractPages(path)
+		if err != nil {
+			t.Fatalf("ExtractPages failed: %v", err)
+		}
+		if len(extraction.Pages) != 3 {
+			t.Fatalf("Expected one page per frame, got %+v", extraction.Pages)
+		}
+		if page := extraction.Pages[2]; page.Number != 3 || page.Text != "Resolutions" || page.Confidence != 0.81 {
+			t.Errorf("Unexpected third page %+v", page)
+		}
+		if extraction.Pages[1].Text != "" {
+			t.Errorf("Expected the unreadable frame to stay empty, got %q", extraction.Pages[1].Text)
+		}
+	})
+
+	t.Run("preprocessed OCR images are removed", func(t *testing.T) {
+		scratch := t.TempDir()
+		t.Setenv("TMPDIR", scratch)
+
+		path := filepath.Join(tempDir, "receipt.png")
+		file, err := os.Create(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		png.Encode(file, image.NewGray(image.Rect(0, 0, 4, 4)))
+		file.Close()
+
+		ocrDP := NewDocumentProcessor(nil)
+		ocrDP.SetOCRService(NewOCRServiceWithEngine(NewFakeOCREngine()))
+		if _, err := ocrDP.ExtractTextWithOCR(path); err != nil {
+			t.Fatalf("ExtractTextWithOCR failed: %v", err)
+		}
+		if left, _ := os.ReadDir(scratch); len(left) != 0 {
+			t.Errorf("Expected preprocessed images to be removed, found %d files", len(left))
+		}
+	})
+
+	t.Run("legacy binary formats are rejected", func(t *testing.T) {
+		path := filepath.Join(tempDir, "old.xls")
+		os.WriteFile(path, []byte{0xD0, 0xCF, 0x11, 0xE0}, 0644)
+		if _, err := dp.ExtractText(path); err == nil {
+			t.Error("Expected error for legacy .xls file")
+		}
+	})
+}
@@ -4,14 +4,22 @@ import (
 	"context"
 	"fmt"
 	"math"
+	"path/filepath"
+	"sort"
+	"strings"
 	"time"
 )
 
+// DefaultMinTrendPeriods is the fewest periods a metric needs before a
+// trend is reported for it
+const DefaultMinTrendPeriods = 3
+
 // TrendAnalyzer performs trend analysis across multiple documents
 type TrendAnalyzer struct {
 	aiService  *AIService
 	dataMapper *DataMapper
 	timeWindow time.Duration // Default analysis window
+	minPeriods int           // Minimum periods required per metric
 }
 
 // NewTrendAnalyzer creates a new trend analyzer
@@ -20,7 +28,16 @@ func NewTrendAnalyzer(aiService *AIService, dataMapper *DataMapper) *TrendAnalyz
 		aiService:  aiService,
 		dataMapper: dataMapper,
 		timeWindow: 365 * 24 * time.Hour, // Default 1 year
+		minPeriods: DefaultMinTrendPeriods,
+	}
+}
+
+// SetMinPeriods sets the minimum number of periods a metric needs
+func (ta *TrendAnalyzer) SetMinPeriods(periods int) {
+	if periods < 2 {
+		periods = 2
 	}
+	ta.minPeriods = periods
 }
 
 // TrendAnalysisResult contains comprehensive trend analysis
@@ -36,6 +53,8 @@ type TrendAnalysisResult struct {
 	KeyInsights       []TrendInsight       `json:"keyInsights"`
 	Anomalies         []TrendAnomaly       `json:"anomalies"`
 	Summary           string               `json:"summary"`
+	InsufficientData  bool                 `json:"insufficientData"`
+	DataWarnings      []string             `json:"dataWarnings,omitempty"`
 }
 
 // TimeRange represents the time period analyzed
@@ -70,9 +89,10 @@ type MetricTrend struct {
 
 // DataPoint represents a single data point in time
 type DataPoint struct {
-	Timestamp time.Time `json:"timestamp"`
-	Value     float64   `json:"value"`
-	Label     string    `json:"label,omitempty"`
+	Timestamp time.Time       `json:"timestamp"`
+	Value     float64         `json:"value"`
+	Label     string          `json:"label,omitempty"`
+	Source    *LineItemSource `json:"source,omitempty"` // Where the value was read from
 }
 
 // TrendLine represents the mathematical trend line
@@ -226,14 +246,24 @@ func (ta *TrendAnalyzer) AnalyzeTrends(ctx context.Context, dealName string, doc
 	}
 
 	// Extract time series data from documents
-	timeSeriesData, err := ta.extractTimeSeriesData(ctx, documents)
+	timeSeriesData, warnings, err := ta.extractTimeSeriesData(ctx, documents, historicalData)
 	if err != nil {
 		return nil, fmt.Errorf("failed to extract time series data: %w", err)
 	}
+	result.DataWarnings = warnings
 
 	// Determine time range and granularity
 	result.TimeRange = ta.determineTimeRange(timeSeriesData)
 
+	// Without enough periods any trend would be invented, so say so instead
+	if len(timeSeriesData) == 0 {
+		result.InsufficientData = true
+		result.Summary = fmt.Sprintf("Trend Analysis Summary for %s\n"+
+			"Insufficient data: no metric has at least %d reported periods across %d documents.\n",
+			dealName, ta.minPeriods, len(documents))
+		return result, nil
+	}
+
 	// Analyze financial trends
 	result.FinancialTrends = ta.analyzeFinancialTrends(timeSeriesData, historicalData)
 
@@ -261,61 +291,215 @@ func (ta *TrendAnalyzer) AnalyzeTrends(ctx context.Context, dealName string, doc
 	return result, nil
 }
 
-// extractTimeSeriesData extracts time series data from documents
-func (ta *TrendAnalyzer) extractTimeSeriesData(ctx context.Context, documents []DocumentInfo) (map[string][]DataPoint, error) {
+// extractTimeSeriesData builds one series per canonical line item from the
+// period columns of the deal's financial documents and templates. Metrics with
+// fewer than minPeriods actual periods are dropped with a warning.
+func (ta *TrendAnalyzer) extractTimeSeriesData(ctx context.Context, documents []DocumentInfo, historicalData map[string]interface{}) (map[string][]DataPoint, []string, error) {
+	allSeries, warnings, err := ta.collectTimeSeries(ctx, documents, historicalData)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	timeSeriesData := make(map[string][]DataPoint)
+	for metric, points := range allSeries {
+		if len(points) < ta.minPeriods {
+			warnings = append(warnings, fmt.Sprintf("insufficient data for %s: %d of %d required periods",
+				metric, len(points), ta.minPeriods))
+			continue
+		}
+		timeSeriesData[metric] = points
+	}
 
-	// In a real implementation, this would parse documents and extract time series
-	// For now, generate sample data
-
-	// Revenue data
-	baseRevenue := 10000000.0
-	revenueData := make([]DataPoint, 0)
-	for i := 0; i < 12; i++ {
-		timestamp := time.Now().AddDate(0, -12+i, 0)
-		growth := 1.0 + (0.02 * float64(i)) + (0.01 * math.Sin(float64(i)))
-		value := baseRevenue * growth
-		revenueData = append(revenueData, DataPoint{
-			Timestamp: timestamp,
-			Value:     value,
-		})
+	sort.Strings(warnings)
+	return timeSeriesData, warnings, nil
+}
+
+// collectTimeSeries extracts every period-tagged series regardless of length
+func (ta *TrendAnalyzer) collectTimeSeries(ctx context.Context, documents []DocumentInfo, historicalData map[string]interface{}) (map[string][]DataPoint, []string, error) {
+	warnings := make([]string, 0)
+	extractor := ta.tableExtractor()
+
+	items := make([]FinancialLineItem, 0)
+	for _, doc := range documents {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+		if !isTrendSourceDocument(doc) {
+			continue
+		}
+
+		lineItems, err := extractor.ExtractLineItems(doc.Path)
+		if err != nil {
+			warnings = append(warnings, fmt.Sprintf("%s: %v", doc.Name, err))
+			continue
+		}
+		items = append(items, lineItems...)
 	}
-	timeSeriesData["revenue"] = revenueData
+	items = append(items, historicalLineItems(historicalData)...)
 
-	// EBITDA data
-	ebitdaData := make([]DataPoint, 0)
-	for i := 0; i < 12; i++ {
-		timestamp := time.Now().AddDate(0, -12+i, 0)
-		margin := 0.20 + (0.005 * float64(i))
-		value := revenueData[i].Value * margin
-		ebitdaData = append(ebitdaData, DataPoint{
-			Timestamp: timestamp,
-			Value:     value,
-		})
+	series := make(map[string][]DataPoint)
+	for metric, lineItems := range GroupLineItemSeries(items) {
+		series[metric] = buildTrendSeries(lineItems)
 	}
-	timeSeriesData["ebitda"] = ebitdaData
-
-	// Customer data
-	baseCustomers := 1000.0
-	customerData := make([]DataPoint, 0)
-	for i := 0; i < 12; i++ {
-		timestamp := time.Now().AddDate(0, -12+i, 0)
-		growth := 1.0 + (0.03 * float64(i))
-		value := baseCustomers * growth
-		customerData = append(customerData, DataPoint{
-			Timestamp: timestamp,
-			Value:     value,
+	return series, warnings, nil
+}
+
+// tableExtractor returns the data mapper's statement extractor, if any
+func (ta *TrendAnalyzer) tableExtractor() *FinancialTableExtractor {
+	if ta.dataMapper != nil && ta.dataMapper.tableExtractor != nil {
+		return ta.dataMapper.tableExtractor
+	}
+	return NewFinancialTableExtractor(nil)
+}
+
+// isTrendSourceDocument reports whether a document can carry period columns:
+// financial documents plus any spreadsheet, which covers populated templates
+func isTrendSourceDocument(doc DocumentInfo) bool {
+	if doc.Path == "" {
+		return false
+	}
+	if doc.Type == DocTypeFinancial {
+		return true
+	}
+	switch strings.ToLower(filepath.Ext(doc.Path)) {
+	case ".xlsx", ".xlsm", ".csv":
+		return true
+	}
+	return false
+}
+
+// historicalLineItems converts caller-supplied series keyed by period label,
+// e.g. {"revenue": {"FY2021": 1.2e7, "FY2022": 1.5e7}}, into line items
+func historicalLineItems(historicalData map[string]interface{}) []FinancialLineItem {
+	items := make([]FinancialLineItem, 0)
+	for key, raw := range historicalData {
+		canonical := canonicalLineItem(key)
+		if canonical == "" {
+			if _, known := lineItemSynonyms[key]; !known {
+				continue
+			}
+			canonical = key
+		}
+
+		values := make(map[string]float64)
+		switch series := raw.(type) {
+		case map[string]float64:
+			values = series
+		case map[string]interface{}:
+			for label, value := range series {
+				if number, ok := value.(float64); ok {
+					values[label] = number
+				}
+			}
+		default:
+			continue
+		}
+
+		for label, value := range values {
+			period, ok := parsePeriodLabel(label)
+			if !ok {
+				continue
+			}
+			items = append(items, FinancialLineItem{
+				LineItem:  key,
+				Canonical: canonical,
+				Statement: canonicalStatements[canonical],
+				Period:    period,
+				Value:     value,
+				Scale:     1,
+				Source:    LineItemSource{Document: "historicalData"},
+			})
+		}
+	}
+	return items
+}
+
+// buildTrendSeries turns period-ordered line items into data points. Only
+// actual figures are used, at the granularity with the most periods, and a
+// period reported by several documents is taken from the first one.
+func buildTrendSeries(items []FinancialLineItem) []DataPoint {
+	counts := make(map[string]int)
+	for _, item := range items {
+		if !item.Period.Projected {
+			counts[periodGranularity(item.Period)]++
+		}
+	}
+
+	granularity := ""
+	for _, candidate := range []string{"yearly", "half-yearly", "quarterly", "monthly"} {
+		if counts[candidate] > counts[granularity] {
+			granularity = candidate
+		}
+	}
+	if granularity == "" {
+		return nil
+	}
+
+	points := make([]DataPoint, 0)
+	seen := make(map[int]bool)
+	for _, item := range items {
+		if item.Period.Projected || periodGranularity(item.Period) != granularity {
+			continue
+		}
+		key := item.Period.SortKey()
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		source := item.Source
+		points = append(points, DataPoint{
+			Timestamp: periodEndDate(item.Period),
+			Value:     item.Value,
+			Label:     item.Period.Label,
+			Source:    &source,
 		})
 	}
-	timeSeriesData["customers"] = customerData
+	return points
+}
+
+// periodGranularity classifies a period as yearly, half-yearly, quarterly or monthly
+func periodGranularity(period PeriodInfo) string {
+	switch {
+	case period.Month > 0:
+		return "monthly"
+	case period.Quarter > 0:
+		return "quarterly"
+	case period.Half > 0:
+		return "half-yearly"
+	default:
+		return "yearly"
+	}
+}
 
-	return timeSeriesData, nil
+// periodEndDate returns the last day of a period, assuming calendar years
+func periodEndDate(period PeriodInfo) time.Time {
+	month := period.SortKey() % 100
+	return time.Date(period.Year, time.Month(month)+1, 0, 0, 0, 0, 0, time.UTC)
+}
+
+// seriesStepMonths estimates the spacing of a series in whole months
+func seriesStepMonths(data []DataPoint) int {
+	if len(data) < 2 {
+		return 1
+	}
+	gaps := make([]int, 0, len(data)-1)
+	for i := 1; i < len(data); i++ {
+		prev, next := data[i-1].Timestamp, data[i].Timestamp
+		gaps = append(gaps, (next.Year()-prev.Year())*12+int(next.Month())-int(prev.Month()))
+	}
+	sort.Ints(gaps)
+	if step := gaps[len(gaps)/2]; step > 0 {
+		return step
+	}
+	return 1
 }
 
 // determineTimeRange determines the time range of the data
 func (ta *TrendAnalyzer) determineTimeRange(data map[string][]DataPoint) TimeRange {
 	var start, end time.Time
 	dataPoints := 0
+	step := 1
 
 	for _, series := range data {
 		if len(series) > 0 {
@@ -327,15 +511,21 @@ func (ta *TrendAnalyzer) determineTimeRange(data map[string][]DataPoint) TimeRan
 			}
 			if len(series) > dataPoints {
 				dataPoints = len(series)
+				step = seriesStepMonths(series)
 			}
 		}
 	}
 
-	// Determine granularity
+	// Determine granularity from the spacing of the longest series
 	granularity := "monthly"
-	if dataPoints > 365 {
+	switch {
+	case dataPoints > 365:
 		granularity = "daily"
-	} else if dataPoints < 12 {
+	case step >= 12:
+		granularity = "yearly"
+	case step >= 6:
+		granularity = "half-yearly"
+	case step >= 3:
 		granularity = "quarterly"
 	}
 
@@ -369,6 +559,13 @@ func (ta *TrendAnalyzer) analyzeFinancialTrends(data map[string][]DataPoint, his
 		trends.Volatility["ebitda"] = ta.calculateVolatility(ebitdaData)
 	}
 
+	// Analyze cash flow trend
+	if cashFlowData, exists := data["operating_cash_flow"]; exists {
+		trends.CashFlowTrend = ta.analyzeMetricTrend("Operating Cash Flow", cashFlowData)
+		trends.GrowthRates["operating_cash_flow"] = ta.calculateCAGR(cashFlowData)
+		trends.Volatility["operating_cash_flow"] = ta.calculateVolatility(cashFlowData)
+	}
+
 	// Calculate margin trends
 	if revenueData, revExists := data["revenue"]; revExists {
 		if ebitdaData, ebitdaExists := data["ebitda"]; ebitdaExists {
@@ -568,6 +765,7 @@ func (ta *TrendAnalyzer) generateForecast(trendLine TrendLine, historicalData []
 
 	lastIndex := float64(len(historicalData) - 1)
 	lastTimestamp := historicalData[len(historicalData)-1].Timestamp
+	step := seriesStepMonths(historicalData)
 
 	// Calculate standard error for confidence intervals
 	stdError := ta.calculateStandardError(historicalData, trendLine)
@@ -576,8 +774,8 @@ func (ta *TrendAnalyzer) generateForecast(trendLine TrendLine, historicalData []
 		forecastIndex := lastIndex + float64(i+1)
 		forecastValue := trendLine.Slope*forecastIndex + trendLine.Intercept
 
-		// Add time based on data granularity (assume monthly)
-		forecastTime := lastTimestamp.AddDate(0, i+1, 0)
+		// Add time based on data granularity
+		forecastTime := lastTimestamp.AddDate(0, step*(i+1), 0)
 
 		// Calculate confidence intervals (95%)
 		margin := 1.96 * stdError
@@ -1059,11 +1257,8 @@ func (ta *TrendAnalyzer) generateTrendSummary(analysis *TrendAnalysisResult) str
 
 // QuickTrendAssessment performs a quick trend assessment
 func (ta *TrendAnalyzer) QuickTrendAssessment(metricName string, values []float64) map[string]interface{} {
-	assessment := make(map[string]interface{})
-
-	if len(values) < 2 {
-		assessment["error"] = "Insufficient data points"
-		return assessment
+	if len(values) < ta.minPeriods {
+		return ta.insufficientAssessment(len(values))
 	}
 
 	// Convert to data points
@@ -1076,6 +1271,55 @@ func (ta *TrendAnalyzer) QuickTrendAssessment(metricName string, values []float6
 		}
 	}
 
+	return ta.assessDataPoints(metricName, dataPoints)
+}
+
+// QuickTrendAssessmentFromDocuments assesses the trend of one line item, such
+// as "Revenue" or "ebitda", using the periods reported in the documents
+func (ta *TrendAnalyzer) QuickTrendAssessmentFromDocuments(ctx context.Context, metricName string, documents []DocumentInfo) (map[string]interface{}, error) {
+	metric := canonicalLineItem(metricName)
+	if metric == "" {
+		metric = strings.ToLower(strings.TrimSpace(metricName))
+	}
+
+	data, _, err := ta.collectTimeSeries(ctx, documents, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to extract time series data: %w", err)
+	}
+
+	series := data[metric]
+	if len(series) < ta.minPeriods {
+		return ta.insufficientAssessment(len(series)), nil
+	}
+
+	assessment := ta.assessDataPoints(metricName, series)
+	periods := make([]string, len(series))
+	sources := make([]LineItemSource, len(series))
+	for i, point := range series {
+		periods[i] = point.Label
+		if point.Source != nil {
+			sources[i] = *point.Source
+		}
+	}
+	assessment["periods"] = periods
+	assessment["sources"] = sources
+	return assessment, nil
+}
+
+// insufficientAssessment is returned when a series is too short to trend
+func (ta *TrendAnalyzer) insufficientAssessment(available int) map[string]interface{} {
+	return map[string]interface{}{
+		"error":            "Insufficient data points",
+		"insufficientData": true,
+		"requiredPeriods":  ta.minPeriods,
+		"availablePeriods": available,
+	}
+}
+
+// assessDataPoints computes the quick assessment for a series
+func (ta *TrendAnalyzer) assessDataPoints(metricName string, dataPoints []DataPoint) map[string]interface{} {
+	assessment := make(map[string]interface{})
+
 	// Analyze trend
 	trend := ta.analyzeMetricTrend(metricName, dataPoints)
 
@@ -1087,7 +1331,7 @@ func (ta *TrendAnalyzer) QuickTrendAssessment(metricName string, values []float6
 
 	// Simple projection
 	if trend.TrendLine.Slope != 0 {
-		nextValue := trend.TrendLine.Slope*float64(len(values)) + trend.TrendLine.Intercept
+		nextValue := trend.TrendLine.Slope*float64(len(dataPoints)) + trend.TrendLine.Intercept
 		assessment["nextPeriodEstimate"] = nextValue
 	}
 
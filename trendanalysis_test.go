@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 	"time"
@@ -399,16 +401,29 @@ func TestQuickTrendAssessment(t *testing.T) {
 	assert.Contains(t, shortAssessment, "error")
 }
 
+func writeTrendFixture(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	return path
+}
+
 func TestAnalyzeTrendsIntegration(t *testing.T) {
 	aiService := &AIService{}
 	dataMapper := &DataMapper{}
 	analyzer := NewTrendAnalyzer(aiService, dataMapper)
 
+	path := writeTrendFixture(t, "financials.csv", "Income Statement (USD in thousands),,,,\n"+
+		"Line Item,FY2020,FY2021,FY2022,FY2023,FY2024E\n"+
+		"Revenue,\"10,000\",\"12,000\",\"14,500\",\"17,000\",\"20,000\"\n"+
+		"EBITDA,\"2,000\",\"2,500\",\"3,100\",\"3,800\",\"4,500\"\n"+
+		"Net Income,\"1,000\",\"1,200\",,,\n")
+
 	documents := []DocumentInfo{
 		{
-			Name: "financials_2023.xlsx",
+			Name: "financials.csv",
 			Type: DocTypeFinancial,
-			Path: "/test/financials_2023.xlsx",
+			Path: path,
 		},
 		{
 			Name: "metrics_report.pdf",
@@ -427,14 +442,80 @@ func TestAnalyzeTrendsIntegration(t *testing.T) {
 
 	require.NoError(t, err)
 	assert.NotNil(t, result)
+	assert.False(t, result.InsufficientData)
 	assert.Equal(t, "Test Deal", result.DealName)
 	assert.NotNil(t, result.TimeRange)
+	assert.Equal(t, "yearly", result.TimeRange.Granularity)
+	assert.Equal(t, 4, result.TimeRange.DataPoints, "projected FY2024E should be excluded")
 	assert.NotNil(t, result.FinancialTrends)
 	assert.NotNil(t, result.OperationalTrends)
 	assert.NotNil(t, result.MarketTrends)
 	assert.NotNil(t, result.RiskTrends)
 	assert.NotNil(t, result.Projections)
 	assert.NotEmpty(t, result.Summary)
+
+	revenue := result.FinancialTrends.RevenueTrend
+	require.NotNil(t, revenue)
+	require.Len(t, revenue.DataPoints, 4)
+	assert.Equal(t, 10000000.0, revenue.DataPoints[0].Value)
+	assert.Equal(t, "FY2023", revenue.DataPoints[3].Label)
+	require.NotNil(t, revenue.DataPoints[3].Source)
+	assert.Equal(t, "financials.csv", revenue.DataPoints[3].Source.Document)
+	assert.Equal(t, "increasing", revenue.Direction)
+	assert.InDelta(t, 0.19, result.FinancialTrends.GrowthRates["revenue"], 0.01)
+	assert.NotNil(t, result.FinancialTrends.ProfitabilityTrend)
+
+	// Net income only has two actual periods
+	assert.Contains(t, strings.Join(result.DataWarnings, "\n"), "insufficient data for net_income")
+}
+
+func TestAnalyzeTrendsInsufficientData(t *testing.T) {
+	analyzer := NewTrendAnalyzer(nil, &DataMapper{})
+
+	path := writeTrendFixture(t, "financials.csv", "Line Item,FY2022,FY2023\n"+
+		"Revenue,\"20,000\",\"25,000\"\n")
+	documents := []DocumentInfo{{Name: "financials.csv", Type: DocTypeFinancial, Path: path}}
+
+	result, err := analyzer.AnalyzeTrends(context.Background(), "Thin Deal", documents, nil)
+	require.NoError(t, err)
+	assert.True(t, result.InsufficientData)
+	assert.Nil(t, result.FinancialTrends)
+	assert.Nil(t, result.Projections)
+	assert.Contains(t, result.Summary, "Insufficient data")
+
+	// Caller-supplied history can fill in the missing periods
+	historical := map[string]interface{}{
+		"revenue": map[string]interface{}{"FY2020": 15000000.0, "FY2021": 17000000.0},
+	}
+	result, err = analyzer.AnalyzeTrends(context.Background(), "Thin Deal", documents, historical)
+	require.NoError(t, err)
+	assert.False(t, result.InsufficientData)
+	require.NotNil(t, result.FinancialTrends.RevenueTrend)
+	points := result.FinancialTrends.RevenueTrend.DataPoints
+	require.Len(t, points, 4)
+	assert.Equal(t, "historicalData", points[0].Source.Document)
+	assert.Equal(t, "FY2023", points[3].Label)
+}
+
+func TestQuickTrendAssessmentFromDocuments(t *testing.T) {
+	analyzer := NewTrendAnalyzer(nil, nil)
+
+	path := writeTrendFixture(t, "quarterly.csv", "Line Item,Q1 2023,Q2 2023,Q3 2023,Q4 2023\n"+
+		"Revenue,100,90,80,70\n"+
+		"EBITDA,20,,,\n")
+	documents := []DocumentInfo{{Name: "quarterly.csv", Type: DocTypeGeneral, Path: path}}
+
+	assessment, err := analyzer.QuickTrendAssessmentFromDocuments(context.Background(), "Revenue", documents)
+	require.NoError(t, err)
+	assert.Equal(t, "decreasing", assessment["direction"])
+	assert.Equal(t, []string{"Q1 2023", "Q2 2023", "Q3 2023", "Q4 2023"}, assessment["periods"])
+	sources := assessment["sources"].([]LineItemSource)
+	assert.Equal(t, 2, sources[0].Row)
+
+	assessment, err = analyzer.QuickTrendAssessmentFromDocuments(context.Background(), "EBITDA", documents)
+	require.NoError(t, err)
+	assert.Equal(t, true, assessment["insufficientData"])
+	assert.Equal(t, 1, assessment["availablePeriods"])
 }
 
 func TestGenerateTrendSummary(t *testing.T) {
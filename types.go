@@ -624,6 +624,7 @@ type QueueItem struct {
 	Metadata          map[string]interface{} `json:"metadata"`
 	Dependencies      []string               `json:"dependencies,omitempty"`
 	RetryCount        int                    `json:"retryCount"`
+	NextAttemptAt     *time.Time             `json:"nextAttemptAt,omitempty"`
 	LastError         *QueueError            `json:"lastError,omitempty"`
 	EstimatedDuration time.Duration          `json:"estimatedDuration"`
 	ActualDuration    time.Duration          `json:"actualDuration"`
@@ -744,6 +745,7 @@ type UserCorrection struct {
 type QueueConfiguration struct {
 	MaxConcurrentJobs      int           `json:"maxConcurrentJobs"`
 	MaxRetryAttempts       int           `json:"maxRetryAttempts"`
+	InitialRetryBackoff    time.Duration `json:"initialRetryBackoff"`
 	RetryBackoffMultiplier float64       `json:"retryBackoffMultiplier"`
 	MaxRetryBackoff        time.Duration `json:"maxRetryBackoff"`
 	QueueTimeout           time.Duration `json:"queueTimeout"`
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// VectorEntry is one stored vector with its metadata
+type VectorEntry struct {
+	ID        string            `json:"id"`
+	Vector    []float64         `json:"vector"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	UpdatedAt time.Time         `json:"updatedAt"`
+}
+
+// VectorMatch is a search hit ranked by cosine similarity
+type VectorMatch struct {
+	ID       string            `json:"id"`
+	Score    float64           `json:"score"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+// VectorIndex is a persistent, in-memory vector index with exact cosine
+// top-k search. Entries are tagged with the embedding model that produced
+// them; loading an index built by a different model discards its entries so
+// callers can re-embed.
+type VectorIndex struct {
+	path       string
+	model      string
+	dimensions int
+	entries    map[string]*VectorEntry
+	mu         sync.RWMutex
+}
+
+type vectorIndexFile struct {
+	Model      string         `json:"model"`
+	Dimensions int            `json:"dimensions"`
+	Entries    []*VectorEntry `json:"entries"`
+	SavedAt    time.Time      `json:"savedAt"`
+}
+
+// NewVectorIndex creates an index stored at path for vectors produced by the
+// named model
+func NewVectorIndex(path, model string, dimensions int) *VectorIndex {
+	return &VectorIndex{
+		path:       path,
+		model:      model,
+		dimensions: dimensions,
+		entries:    make(map[string]*VectorEntry),
+	}
+}
+
+// Load reads the index from disk. It reports false when the file was built by
+// a different model or dimensions and its entries were discarded.
+func (vi *VectorIndex) Load() (bool, error) {
+	vi.mu.Lock()
+	defer vi.mu.Unlock()
+
+	data, err := os.ReadFile(vi.path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return true, nil
+		}
+		return false, fmt.Errorf("failed to read vector index: %w", err)
+	}
+
+	var file vectorIndexFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return false, fmt.Errorf("failed to parse vector index: %w", err)
+	}
+
+	vi.entries = make(map[string]*VectorEntry)
+	if file.Model != vi.model || (vi.dimensions > 0 && file.Dimensions != vi.dimensions) {
+		return false, nil
+	}
+
+	for _, entry := range file.Entries {
+		if entry != nil && entry.ID != "" {
+			vi.entries[entry.ID] = entry
+		}
+	}
+	return true, nil
+}
+
+// Save writes the index to disk atomically
+func (vi *VectorIndex) Save() error {
+	vi.mu.RLock()
+	file := vectorIndexFile{
+		Model:      vi.model,
+		Dimensions: vi.dimensions,
+		Entries:    make([]*VectorEntry, 0, len(vi.entries)),
+		SavedAt:    time.Now(),
+	}
+	for _, entry := range vi.entries {
+		file.Entries = append(file.Entries, entry)
+	}
+	vi.mu.RUnlock()
+
+	sort.Slice(file.Entries, func(i, j int) bool {
+		return file.Entries[i].ID < file.Entries[j].ID
+	})
+
+	data, err := json.Marshal(file)
+	if err != nil {
+		return fmt.Errorf("failed to marshal vector index: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(vi.path), 0755); err != nil {
+		return fmt.Errorf("failed to create vector index directory: %w", err)
+	}
+
+	tempPath := vi.path + ".tmp"
+	if err := os.WriteFile(tempPath, data, 0644); err != nil {
+		return fmt.Errorf("failed to write vector index: %w", err)
+	}
+	if err := os.Rename(tempPath, vi.path); err != nil {
+		return fmt.Errorf("failed to replace vector index: %w", err)
+	}
+	return nil
+}
+
+// Reset drops all entries and switches the index to a new model
+func (vi *VectorIndex) Reset(model string, dimensions int) {
+	vi.mu.Lock()
+	defer vi.mu.Unlock()
+
+	vi.model = model
+	vi.dimensions = dimensions
+	vi.entries = make(map[string]*VectorEntry)
+}
+
+// Model returns the embedding model the index holds vectors for
+func (vi *VectorIndex) Model() string {
+	vi.mu.RLock()
+	defer vi.mu.RUnlock()
+	return vi.model
+}
+
+// Upsert adds or replaces a vector
+func (vi *VectorIndex) Upsert(id string, vector []float64, metadata map[string]string) error {
+	if id == "" {
+		return fmt.Errorf("vector id is required")
+	}
+
+	vi.mu.Lock()
+	defer vi.mu.Unlock()
+
+	if vi.dimensions == 0 {
+		vi.dimensions = len(vector)
+	}
+	if len(vector) != vi.dimensions {
+		return fmt.Errorf("vector has %d dimensions, index expects %d", len(vector), vi.dimensions)
+	}
+
+	vi.entries[id] = &VectorEntry{
+		ID:        id,
+		Vector:    vector,
+		Metadata:  metadata,
+		UpdatedAt: time.Now(),
+	}
+	return nil
+}
+
+// Remove deletes a vector; removing a missing id is a no-op
+func (vi *VectorIndex) Remove(id string) {
+	vi.mu.Lock()
+	defer vi.mu.Unlock()
+	delete(vi.entries, id)
+}
+
+// Len returns the number of stored vectors
+func (vi *VectorIndex) Len() int {
+	vi.mu.RLock()
+	defer vi.mu.RUnlock()
+	return len(vi.entries)
+}
+
+// Search returns up to k entries with cosine similarity of at least
+// minScore, best first. Ties are broken by id so results are stable.
+func (vi *VectorIndex) Search(query []float64, k int, minScore float64) []VectorMatch {
+	vi.mu.RLock()
+	defer vi.mu.RUnlock()
+
+	matches := make([]VectorMatch, 0)
+	if k <= 0 {
+		return matches
+	}
+
+	for _, entry := range vi.entries {
+		score := cosineSimilarity(query, entry.Vector)
+		if score < minScore {
+			continue
+		}
+		matches = append(matches, VectorMatch{ID: entry.ID, Score: score, Metadata: entry.Metadata})
+	}
+
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].ID < matches[j].ID
+	})
+
+	if len(matches) > k {
+		matches = matches[:k]
+	}
+	return matches
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestVectorIndexSearchAndPersistence(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rag", "vector_index.json")
+	index := NewVectorIndex(path, "test-model", 3)
+
+	require.NoError(t, index.Upsert("a", []float64{1, 0, 0}, map[string]string{"field_name": "revenue"}))
+	require.NoError(t, index.Upsert("b", []float64{0.8, 0.6, 0}, nil))
+	require.NoError(t, index.Upsert("c", []float64{0, 0, 1}, nil))
+	assert.Error(t, index.Upsert("d", []float64{1, 0}, nil), "dimension mismatch")
+
+	matches := index.Search([]float64{1, 0, 0}, 2, 0.5)
+	require.Len(t, matches, 2)
+	assert.Equal(t, "a", matches[0].ID)
+	assert.InDelta(t, 1.0, matches[0].Score, 1e-9)
+	assert.Equal(t, "revenue", matches[0].Metadata["field_name"])
+	assert.Equal(t, "b", matches[1].ID)
+	assert.InDelta(t, 0.8, matches[1].Score, 1e-9)
+
+	require.NoError(t, index.Save())
+
+	reloaded := NewVectorIndex(path, "test-model", 3)
+	current, err := reloaded.Load()
+	require.NoError(t, err)
+	assert.True(t, current)
+	assert.Equal(t, 3, reloaded.Len())
+
+	reloaded.Remove("a")
+	assert.Equal(t, "b", reloaded.Search([]float64{1, 0, 0}, 1, 0)[0].ID)
+
+	// An index built by another model is discarded
+	other := NewVectorIndex(path, "other-model", 3)
+	current, err = other.Load()
+	require.NoError(t, err)
+	assert.False(t, current)
+	assert.Zero(t, other.Len())
+}
@@ -1,13 +1,16 @@
 package main
 
 import (
+	"bytes"
 	"context"
 	"encoding/base64"
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"path/filepath"
+	"strconv"
 	"sync"
 	"time"
 )
@@ -44,6 +47,10 @@ func (wh *WebhookHandlers) HandleProcessingResults(w http.ResponseWriter, r *htt
 		return
 	}
 
+	if !wh.authorizeResultPayload(w, r) {
+		return
+	}
+
 	// Use the webhook service to receive and validate the payload
 	resultPayload, err := wh.webhookService.ReceiveProcessingResults(w, r)
 	if err != nil {
@@ -65,6 +72,42 @@ func (wh *WebhookHandlers) HandleProcessingResults(w http.ResponseWriter, r *htt
 	}
 }
 
+// authorizeResultPayload checks the deal, job and files a results payload
+// names before the webhook service accepts it, leaving the body unread
+func (wh *WebhookHandlers) authorizeResultPayload(w http.ResponseWriter, r *http.Request) bool {
+	body, err := io.ReadAll(r.Body)
+	if err != nil {
+		http.Error(w, "Failed to read request body", http.StatusBadRequest)
+		return false
+	}
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	// A payload that does not decode names no deal, and the webhook
+	// service rejects it anyway
+	var payload WebhookResultPayload
+	json.Unmarshal(body, &payload)
+	var paths []string
+	if payload.Results != nil {
+		for _, document := range payload.Results.DocumentResults {
+			paths = append(paths, document.FilePath)
+		}
+		for _, template := range payload.Results.TemplateResults {
+			paths = append(paths, template.TemplatePath)
+		}
+	}
+	if !wh.authorizeDeal(w, r, payload.DealName, paths...) {
+		return false
+	}
+
+	// The job being reported on must belong to the same deal
+	if wh.app != nil && wh.app.jobTracker != nil {
+		if job, err := wh.app.jobTracker.GetJob(payload.JobID); err == nil && job.DealName != payload.DealName {
+			return wh.authorizeDeal(w, r, job.DealName)
+		}
+	}
+	return true
+}
+
 // HandleStatusQuery handles status queries from the frontend or n8n
 func (wh *WebhookHandlers) HandleStatusQuery(w http.ResponseWriter, r *http.Request) {
 	// Set CORS headers
@@ -85,6 +128,17 @@ func (wh *WebhookHandlers) HandleStatusQuery(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
+	// Keys restricted to particular deals may read only their deals' jobs
+	jobDeal := ""
+	if wh.app != nil && wh.app.jobTracker != nil {
+		if job, err := wh.app.jobTracker.GetJob(jobID); err == nil {
+			jobDeal = job.DealName
+		}
+	}
+	if !wh.authorizeDeal(w, r, jobDeal) {
+		return
+	}
+
 	// Create status query
 	query := &WebhookStatusQuery{
 		JobID:     jobID,
@@ -109,6 +163,34 @@ func (wh *WebhookHandlers) HandleStatusQuery(w http.ResponseWriter, r *http.Requ
 	json.NewEncoder(w).Encode(statusResponse)
 }
 
+// authorizeDeal checks the deal a handler resolved from its request, and
+// any deal files the request names, against the deals the caller's API key
+// may access. It writes the error response and returns false on denial.
+func (wh *WebhookHandlers) authorizeDeal(w http.ResponseWriter, r *http.Request, deal string, paths ...string) bool {
+	auth, ok := r.Context().Value("authResult").(*AuthenticationResult)
+	if !ok || len(auth.AllowedDeals) == 0 {
+		return true
+	}
+
+	dealsPath := ""
+	if wh.app.configService != nil {
+		dealsPath = wh.app.configService.GetDealsPath()
+	}
+	req := &AuthenticationRequest{
+		Method:    r.Method,
+		Path:      r.URL.Path,
+		ClientIP:  remoteIP(r),
+		UserAgent: r.UserAgent(),
+		RequestID: r.Header.Get("X-Request-ID"),
+	}
+	result := wh.app.authManager.AuthorizeDeal(auth, req, dealsPath, deal, paths)
+	if !result.Success {
+		http.Error(w, result.ErrorMessage, authFailureStatus(result.ErrorCode))
+		return false
+	}
+	return true
+}
+
 // HandleHealthCheck handles health check requests
 func (wh *WebhookHandlers) HandleHealthCheck(w http.ResponseWriter, r *http.Request) {
 	// Set CORS headers
@@ -183,6 +265,109 @@ func (wh *WebhookHandlers) HandleHealthCheck(w http.ResponseWriter, r *http.Requ
 	json.NewEncoder(w).Encode(healthStatus)
 }
 
+// HandleAIUsage reports AI spend by deal, provider, model and operation
+// between the optional from and to dates (YYYY-MM-DD, inclusive)
+func (wh *WebhookHandlers) HandleAIUsage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	report, err := wh.app.GetAIUsageReport(r.URL.Query().Get("from"), r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
+
+// HandleContentSearch searches the text of a deal's documents. q takes the
+// query syntax of parseSearchQuery; limit caps the hits returned.
+func (wh *WebhookHandlers) HandleContentSearch(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	limit := 0
+	if value := query.Get("limit"); value != "" {
+		var err error
+		if limit, err = strconv.Atoi(value); err != nil || limit < 0 {
+			http.Error(w, "limit must be a non-negative integer", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if !wh.authorizeDeal(w, r, query.Get("dealName")) {
+		return
+	}
+
+	result, err := wh.app.SearchDealContent(query.Get("dealName"), query.Get("q"), limit)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// SetDealBudgetRequest is the request body of HandleAIBudgets
+type SetDealBudgetRequest struct {
+	DealName string     `json:"dealName"`
+	Budget   DealBudget `json:"budget"`
+}
+
+// HandleAIBudgets reads, sets and removes per-deal AI budgets. GET returns a
+// deal's spend against its budget, or every budget without a dealName.
+func (wh *WebhookHandlers) HandleAIBudgets(w http.ResponseWriter, r *http.Request) {
+	dealName := r.URL.Query().Get("dealName")
+	if r.Method != http.MethodPost && !wh.authorizeDeal(w, r, dealName) {
+		return
+	}
+
+	var response interface{}
+	var err error
+	switch r.Method {
+	case http.MethodGet:
+		if dealName == "" {
+			response, err = wh.app.GetAIBudgets()
+		} else {
+			response, err = wh.app.GetDealAIBudgetStatus(dealName)
+		}
+	case http.MethodPost:
+		var request SetDealBudgetRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
+			return
+		}
+		if !wh.authorizeDeal(w, r, request.DealName) {
+			return
+		}
+		if err = wh.app.SetDealAIBudget(request.DealName, request.Budget); err == nil {
+			response, err = wh.app.GetDealAIBudgetStatus(request.DealName)
+		}
+	case http.MethodDelete:
+		if err = wh.app.RemoveDealAIBudget(dealName); err == nil {
+			response = map[string]interface{}{"success": true, "dealName": dealName}
+		}
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
 // GetResultChannel returns the channel for listening to webhook results
 func (wh *WebhookHandlers) GetResultChannel() <-chan *WebhookResultPayload {
 	return wh.resultChannel
@@ -320,100 +505,241 @@ func (wh *WebhookHandlers) resultProcessor() {
 	}
 }
 
-// RegisterHandlers registers all webhook handlers with an HTTP mux
+// WebhookRoute is an HTTP route, the policy API keys calling it must meet
+// and the shape of its requests and responses
+type WebhookRoute struct {
+	Path     string // Versioned path under /api/v1
+	Legacy   string // Path the route was first served at, kept as an alias
+	Methods  []string
+	Summary  string
+	Query    []QueryParam
+	Request  *SchemaRef
+	Response *SchemaRef
+	Handler  http.HandlerFunc
+	Policy   RoutePolicy
+}
+
+// QueryParam is a query string parameter a route reads
+type QueryParam struct {
+	Name     string
+	Required bool
+}
+
+func newRoute(methods []string, legacy, summary string, handler http.HandlerFunc, policy RoutePolicy) WebhookRoute {
+	return WebhookRoute{Path: apiV1Path(legacy), Legacy: legacy, Methods: methods, Summary: summary, Handler: handler, Policy: policy}
+}
+
+func (r WebhookRoute) body(ref *SchemaRef) WebhookRoute {
+	r.Request = ref
+	return r
+}
+
+func (r WebhookRoute) returns(ref *SchemaRef) WebhookRoute {
+	r.Response = ref
+	return r
+}
+
+func (r WebhookRoute) query(names ...string) WebhookRoute {
+	for _, name := range names {
+		r.Query = append(r.Query, QueryParam{Name: name})
+	}
+	return r
+}
+
+func (r WebhookRoute) requireQuery(names ...string) WebhookRoute {
+	for _, name := range names {
+		r.Query = append(r.Query, QueryParam{Name: name, Required: true})
+	}
+	return r
+}
+
+// Routes returns every webhook route with the scope it requires
+func (wh *WebhookHandlers) Routes() []WebhookRoute {
+	scoped := func(scope string) RoutePolicy { return RoutePolicy{Scope: scope} }
+	noDeals := func(scope string) RoutePolicy { return RoutePolicy{Scope: scope, Deals: NoDealData} }
+	allDeals := func(scope string) RoutePolicy { return RoutePolicy{Scope: scope, Deals: AllDeals} }
+	get := []string{http.MethodGet}
+	post := []string{http.MethodPost}
+
+	return []WebhookRoute{
+		{Path: apiV1Prefix + "/openapi.json", Methods: get, Summary: "OpenAPI description of this API",
+			Handler: wh.HandleOpenAPISpec, Policy: RoutePolicy{Public: true}},
+		newRoute(post, "/webhook/results", "Receive processing results from n8n", wh.HandleProcessingResults, scoped(ScopeWriteJobs)).
+			body(namedSchema("webhook-result-payload")),
+		newRoute(get, "/webhook/status", "Query the status of a processing job", wh.HandleStatusQuery, scoped(ScopeReadJobs)).
+			requireQuery("jobId").query("dealName").returns(bodyType[WebhookStatusResponse]()),
+		newRoute(get, "/webhook/health", "Health of the webhook services", wh.HandleHealthCheck, RoutePolicy{Public: true}),
+		newRoute(get, "/webhook/ai-usage", "AI spend by deal, provider, model and operation", wh.HandleAIUsage, allDeals(ScopeReadAnalytics)).
+			query("from", "to").returns(bodyType[AIUsageReport]()),
+		newRoute([]string{http.MethodGet, http.MethodPost, http.MethodDelete}, "/webhook/ai-budgets", "Read, set or remove a deal's AI budget", wh.HandleAIBudgets, RoutePolicy{
+			Scope:        ScopeReadAnalytics,
+			MethodScopes: map[string]string{http.MethodPost: ScopeAdminConfig, http.MethodDelete: ScopeAdminConfig},
+		}).query("dealName").body(bodyType[SetDealBudgetRequest]()).returns(bodyType[DealBudgetStatus]()),
+		WebhookRoute{Path: apiV1Prefix + "/search", Methods: get, Summary: "Full-text search across a deal's documents",
+			Handler: wh.HandleContentSearch, Policy: scoped(ScopeReadDocuments)}.
+			requireQuery("dealName", "q").query("limit").returns(bodyType[ContentSearchResult]()),
+
+		// Template analysis endpoints for n8n workflows
+		newRoute(post, "/discover-templates", "Find templates matching a document", wh.HandleDiscoverTemplates, scoped(ScopeReadTemplates)).
+			body(bodyType[DiscoverTemplatesRequest]()),
+		newRoute(post, "/extract-document-fields", "Extract template fields from a document", wh.HandleExtractDocumentFields, scoped(ScopeWriteDocuments)).
+			body(bodyType[ExtractDocumentFieldsRequest]()),
+		newRoute(post, "/map-template-fields", "Map extracted fields onto a template", wh.HandleMapTemplateFields, scoped(ScopeWriteTemplates)).
+			body(bodyType[MapTemplateFieldsRequest]()),
+		newRoute(post, "/populate-template", "Populate a template with mapped fields", wh.HandlePopulateTemplate, scoped(ScopeWriteTemplates)).
+			body(bodyType[PopulateTemplateRequest]()),
+
+		// NEW ENHANCED N8N WEBHOOK ENDPOINTS FOR TASK 1.2.2
+		newRoute(post, "/webhook/n8n/enhanced/extract-document-fields", "Extract fields from document content with AI", wh.HandleEnhancedExtractDocumentFields, scoped(ScopeWriteDocuments)).
+			body(bodyType[EnhancedExtractDocumentFieldsRequest]()),
+		newRoute(post, "/webhook/n8n/enhanced/map-fields-to-template", "Map extracted fields to template fields with AI", wh.HandleEnhancedMapFieldsToTemplate, scoped(ScopeWriteTemplates)).
+			body(bodyType[EnhancedMapFieldsToTemplateRequest]()),
+		newRoute(post, "/webhook/n8n/enhanced/format-field-value", "Format a raw value for a field type", wh.HandleEnhancedFormatFieldValue, noDeals(ScopeWriteTemplates)).
+			body(bodyType[EnhancedFormatFieldValueRequest]()),
+		newRoute(post, "/webhook/n8n/enhanced/validate-template-data", "Validate template data against rules", wh.HandleEnhancedValidateTemplateData, scoped(ScopeWriteTemplates)).
+			body(bodyType[EnhancedValidateTemplateDataRequest]()),
+		newRoute(post, "/webhook/n8n/enhanced/analyze-document", "Classify a document or analyze its financials, risks or insights", wh.HandleEnhancedAnalyzeDocument, scoped(ScopeWriteDocuments)).
+			body(bodyType[EnhancedAnalyzeDocumentRequest]()),
+
+		// ENHANCED ENTITY EXTRACTION WEBHOOK ENDPOINTS FOR TASK 1.3
+		// These and the semantic endpoints take content, not a document, so a
+		// restricted key names the deal it belongs to in dealName
+		newRoute(post, "/webhook/entity-extraction/company-and-deal-names", "Extract company and deal names", wh.handleExtractCompanyAndDealNames, scoped(ScopeWriteDocuments)).
+			body(bodyType[ExtractCompanyAndDealNamesRequest]()),
+		newRoute(post, "/webhook/entity-extraction/financial-metrics", "Extract financial metrics", wh.handleExtractFinancialMetrics, scoped(ScopeWriteDocuments)).
+			body(bodyType[ExtractFinancialMetricsRequest]()),
+		newRoute(post, "/webhook/entity-extraction/personnel-and-roles", "Extract people and their roles", wh.handleExtractPersonnelAndRoles, scoped(ScopeWriteDocuments)).
+			body(bodyType[ExtractPersonnelAndRolesRequest]()),
+		newRoute(post, "/webhook/entity-extraction/validate-entities-across-documents", "Check extracted entities agree across documents", wh.handleValidateEntitiesAcrossDocuments, scoped(ScopeWriteDocuments)).
+			body(bodyType[ValidateEntitiesAcrossDocumentsRequest]()),
+
+		// SEMANTIC FIELD MAPPING WEBHOOK ENDPOINTS FOR TASK 2.1
+		newRoute(post, "/webhook/analyze-field-semantics", "Analyze what a field means", wh.handleAnalyzeFieldSemantics, scoped(ScopeWriteDocuments)).
+			body(bodyType[AnalyzeFieldSemanticsRequest]()),
+		newRoute(post, "/webhook/create-semantic-mapping", "Map source fields to template fields by meaning", wh.handleCreateSemanticMapping, scoped(ScopeWriteTemplates)).
+			body(bodyType[CreateSemanticMappingRequest]()),
+		newRoute(post, "/webhook/resolve-field-conflicts", "Resolve conflicting values for a field", wh.handleResolveFieldConflicts, scoped(ScopeWriteTemplates)).
+			body(bodyType[ResolveFieldConflictsRequest]()),
+		newRoute(post, "/webhook/analyze-template-structure", "Analyze a template's structure", wh.handleAnalyzeTemplateStructure, scoped(ScopeReadTemplates)).
+			body(bodyType[AnalyzeTemplateStructureRequest]()),
+		newRoute(post, "/webhook/validate-field-mapping", "Validate a field mapping", wh.handleValidateFieldMapping, scoped(ScopeWriteTemplates)).
+			body(bodyType[ValidateFieldMappingRequest]()),
+
+		// Task 2.2: Professional Template Population Engine endpoints
+		newRoute(post, "/webhook/populate-template-professional", "Populate a template with professional formatting", wh.HandlePopulateTemplateProfessional, scoped(ScopeWriteTemplates)).
+			body(bodyType[PopulateTemplateProfessionalRequest]()),
+		newRoute(post, "/webhook/format-currency", "Format a currency value", wh.handleFormatCurrency, noDeals(ScopeReadTemplates)).
+			body(bodyType[FormatCurrencyRequest]()),
+		newRoute(post, "/webhook/format-date", "Format a date value", wh.handleFormatDate, noDeals(ScopeReadTemplates)).
+			body(bodyType[FormatDateRequest]()),
+		newRoute(post, "/webhook/format-business-text", "Format business text", wh.handleFormatBusinessText, noDeals(ScopeReadTemplates)).
+			body(bodyType[FormatBusinessTextRequest]()),
+		newRoute(post, "/webhook/enhance-formula-preservation", "Preserve a template's formulas while populating it", wh.handleEnhanceFormulaPreservation, scoped(ScopeWriteTemplates)).
+			body(bodyType[EnhanceFormulaPreservationRequest]()),
+
+		// Task 2.3: Quality Assurance and Validation System Webhook Endpoints
+		newRoute(post, "/webhook/validate-template-quality", "Validate a populated template's quality", wh.validateTemplateQualityHandler, scoped(ScopeWriteTemplates)).
+			body(bodyType[ValidateTemplateQualityRequest]()),
+		newRoute(post, "/webhook/get-quality-report", "Summary, detailed or trend quality report", wh.getQualityReportHandler, scoped(ScopeReadAnalytics)).
+			body(bodyType[GetQualityReportRequest]()).returns(bodyType[GetQualityReportResponse]()),
+		newRoute(post, "/webhook/update-validation-rules", "Replace or extend validation rules", wh.updateValidationRulesHandler, allDeals(ScopeAdminConfig)).
+			body(bodyType[UpdateValidationRulesRequest]()),
+		newRoute(post, "/webhook/detect-anomalies", "Detect anomalies in template data", wh.detectAnomaliesHandler, scoped(ScopeReadAnalytics)).
+			body(bodyType[DetectAnomaliesRequest]()),
+
+		// Task 2.4: Template Analytics and Insights Engine Webhook Endpoints
+		newRoute(post, "/webhook/get-usage-analytics", "Template usage analytics", wh.getUsageAnalyticsHandler, allDeals(ScopeReadAnalytics)),
+		newRoute(post, "/webhook/get-field-insights", "Field extraction insights", wh.getFieldInsightsHandler, allDeals(ScopeReadAnalytics)),
+		newRoute(post, "/webhook/predict-quality", "Predict population quality", wh.predictQualityHandler, scoped(ScopeReadAnalytics)),
+		newRoute(post, "/webhook/estimate-processing-time", "Estimate processing time", wh.estimateProcessingTimeHandler, scoped(ScopeReadAnalytics)),
+		newRoute(post, "/webhook/generate-executive-dashboard", "Executive dashboard", wh.generateExecutiveDashboardHandler, allDeals(ScopeReadAnalytics)),
+		newRoute(post, "/webhook/generate-operational-dashboard", "Operational dashboard", wh.generateOperationalDashboardHandler, allDeals(ScopeReadAnalytics)),
+		newRoute(post, "/webhook/get-analytics-trends", "Analytics trends", wh.getAnalyticsTrendsHandler, allDeals(ScopeReadAnalytics)),
+
+		// Task 3.1: Comprehensive Workflow Testing Webhook Endpoints
+		newRoute(post, "/webhook/create-test-session", "Create a workflow test session", wh.handleCreateTestSession, allDeals(ScopeAdminConfig)).
+			body(bodyType[CreateTestSessionRequest]()),
+		newRoute(post, "/webhook/execute-test-session", "Run a workflow test session", wh.handleExecuteTestSession, allDeals(ScopeAdminConfig)).
+			body(bodyType[ExecuteTestSessionRequest]()),
+		newRoute(get, "/webhook/get-test-session-status", "Status of a test session", wh.handleGetTestSessionStatus, allDeals(ScopeReadAnalytics)).
+			requireQuery("sessionId"),
+		newRoute(get, "/webhook/get-test-results", "Results of a test session", wh.handleGetTestResults, allDeals(ScopeReadAnalytics)).
+			requireQuery("sessionId"),
+		newRoute(post, "/webhook/run-integration-test", "Run an integration test", wh.handleRunIntegrationTest, allDeals(ScopeAdminConfig)).
+			body(bodyType[RunIntegrationTestRequest]()),
+		newRoute(get, "/webhook/get-performance-metrics", "Performance metrics of a test", wh.handleGetPerformanceMetrics, allDeals(ScopeReadAnalytics)).
+			query("testId"),
+		newRoute(post, "/webhook/generate-test-report", "Report on a test session", wh.handleGenerateTestReport, allDeals(ScopeReadAnalytics)).
+			body(bodyType[GenerateTestReportRequest]()),
+		newRoute(post, "/webhook/validate-system-health", "Check the health of system components", wh.handleValidateSystemHealth, allDeals(ScopeReadAnalytics)).
+			body(bodyType[ValidateSystemHealthRequest]()),
+
+		// Task 3.2: Performance Optimization Webhook Endpoints
+		newRoute(post, "/webhook/optimize-ai-calls", "Run an AI request through caching and batching", wh.handleOptimizeAICalls, allDeals(ScopeAdminConfig)).
+			body(bodyType[OptimizeAICallsRequest]()),
+		newRoute(post, "/webhook/optimize-workflow-performance", "Optimize workflow execution", wh.handleOptimizeWorkflowPerformance, allDeals(ScopeAdminConfig)).
+			body(bodyType[OptimizeWorkflowPerformanceRequest]()),
+		newRoute(post, "/webhook/optimize-template-processing", "Optimize template processing", wh.handleOptimizeTemplateProcessing, allDeals(ScopeAdminConfig)).
+			body(bodyType[OptimizeTemplateProcessingRequest]()),
+		newRoute(get, "/webhook/get-optimization-metrics", "Optimization metrics by component", wh.handleGetOptimizationMetrics, allDeals(ScopeReadAnalytics)).
+			query("component"),
+		newRoute(get, "/webhook/get-performance-bottlenecks", "Performance bottlenecks by severity", wh.handleGetPerformanceBottlenecks, allDeals(ScopeReadAnalytics)).
+			query("severity"),
+		newRoute(get, "/webhook/get-cache-statistics", "Cache statistics by cache type", wh.handleGetCacheStatistics, allDeals(ScopeReadAnalytics)).
+			query("type"),
+		newRoute(post, "/webhook/configure-performance-settings", "Change performance settings of a component", wh.handleConfigurePerformanceSettings, allDeals(ScopeAdminConfig)).
+			body(bodyType[ConfigurePerformanceSettingsRequest]()),
+		newRoute(get, "/webhook/monitor-system-performance", "System performance over a period", wh.handleMonitorSystemPerformance, allDeals(ScopeReadAnalytics)).
+			query("duration"),
+
+		// Template population endpoints
+		newRoute(post, "/populate-template-automated", "Populate a template without review", wh.handlePopulateTemplateAutomated, scoped(ScopeWriteTemplates)).
+			body(bodyType[PopulateTemplateAutomatedRequest]()),
+		newRoute(post, "/populate-template-assisted", "Populate a template for review", wh.handlePopulateTemplateAssisted, scoped(ScopeWriteTemplates)).
+			body(bodyType[PopulateTemplateAssistedRequest]()),
+		newRoute(post, "/validate-populated-template", "Validate a populated template", wh.handleValidatePopulatedTemplate, scoped(ScopeWriteTemplates)).
+			body(bodyType[ValidatePopulatedTemplateRequest]()),
+		newRoute(post, "/no-templates-available", "Report that no template matched a document", wh.HandleNoTemplatesAvailable, scoped(ScopeWriteJobs)).
+			body(bodyType[NoTemplatesAvailableRequest]()),
+	}
+}
+
+// RegisterHandlers registers all webhook handlers with an HTTP mux, at their
+// versioned paths and their legacy aliases
 func (wh *WebhookHandlers) RegisterHandlers(mux *http.ServeMux) {
-	mux.HandleFunc("/webhook/results", wh.HandleProcessingResults)
-	mux.HandleFunc("/webhook/status", wh.HandleStatusQuery)
-	mux.HandleFunc("/webhook/health", wh.HandleHealthCheck)
-
-	// Template analysis endpoints for n8n workflows
-	mux.HandleFunc("/discover-templates", wh.HandleDiscoverTemplates)
-	mux.HandleFunc("/extract-document-fields", wh.HandleExtractDocumentFields)
-	mux.HandleFunc("/map-template-fields", wh.HandleMapTemplateFields)
-	mux.HandleFunc("/populate-template", wh.HandlePopulateTemplate)
-
-	// NEW ENHANCED N8N WEBHOOK ENDPOINTS FOR TASK 1.2.2
-	mux.HandleFunc("/webhook/n8n/enhanced/extract-document-fields", wh.HandleEnhancedExtractDocumentFields)
-	mux.HandleFunc("/webhook/n8n/enhanced/map-fields-to-template", wh.HandleEnhancedMapFieldsToTemplate)
-	mux.HandleFunc("/webhook/n8n/enhanced/format-field-value", wh.HandleEnhancedFormatFieldValue)
-	mux.HandleFunc("/webhook/n8n/enhanced/validate-template-data", wh.HandleEnhancedValidateTemplateData)
-	mux.HandleFunc("/webhook/n8n/enhanced/analyze-document", wh.HandleEnhancedAnalyzeDocument)
-
-	// ENHANCED ENTITY EXTRACTION WEBHOOK ENDPOINTS FOR TASK 1.3
-	mux.HandleFunc("/webhook/entity-extraction/company-and-deal-names", wh.handleExtractCompanyAndDealNames)
-	mux.HandleFunc("/webhook/entity-extraction/financial-metrics", wh.handleExtractFinancialMetrics)
-	mux.HandleFunc("/webhook/entity-extraction/personnel-and-roles", wh.handleExtractPersonnelAndRoles)
-	mux.HandleFunc("/webhook/entity-extraction/validate-entities-across-documents", wh.handleValidateEntitiesAcrossDocuments)
-
-	// SEMANTIC FIELD MAPPING WEBHOOK ENDPOINTS FOR TASK 2.1
-
-	// handleAnalyzeFieldSemantics handles field semantic analysis requests
-	mux.HandleFunc("/webhook/analyze-field-semantics", wh.handleAnalyzeFieldSemantics)
-
-	// handleCreateSemanticMapping handles semantic field mapping requests
-	mux.HandleFunc("/webhook/create-semantic-mapping", wh.handleCreateSemanticMapping)
-
-	// handleResolveFieldConflicts handles field conflict resolution requests
-	mux.HandleFunc("/webhook/resolve-field-conflicts", wh.handleResolveFieldConflicts)
-
-	// handleAnalyzeTemplateStructure handles template structure analysis requests
-	mux.HandleFunc("/webhook/analyze-template-structure", wh.handleAnalyzeTemplateStructure)
-
-	// handleValidateFieldMapping handles field mapping validation requests
-	mux.HandleFunc("/webhook/validate-field-mapping", wh.handleValidateFieldMapping)
-
-	// Task 2.2: Professional Template Population Engine endpoints
-	mux.HandleFunc("/webhook/populate-template-professional", wh.handlePopulateTemplateProfessional)
-	mux.HandleFunc("/webhook/format-currency", wh.handleFormatCurrency)
-	mux.HandleFunc("/webhook/format-date", wh.handleFormatDate)
-	mux.HandleFunc("/webhook/format-business-text", wh.handleFormatBusinessText)
-	mux.HandleFunc("/webhook/enhance-formula-preservation", wh.handleEnhanceFormulaPreservation)
-
-	// Task 2.3: Quality Assurance and Validation System Webhook Endpoints
-	mux.HandleFunc("/webhook/validate-template-quality", wh.validateTemplateQualityHandler)
-	mux.HandleFunc("/webhook/get-quality-report", wh.getQualityReportHandler)
-	mux.HandleFunc("/webhook/update-validation-rules", wh.updateValidationRulesHandler)
-	mux.HandleFunc("/webhook/detect-anomalies", wh.detectAnomaliesHandler)
-
-	// Task 2.4: Template Analytics and Insights Engine Webhook Endpoints
-	mux.HandleFunc("/webhook/get-usage-analytics", wh.getUsageAnalyticsHandler)
-	mux.HandleFunc("/webhook/get-field-insights", wh.getFieldInsightsHandler)
-	mux.HandleFunc("/webhook/predict-quality", wh.predictQualityHandler)
-	mux.HandleFunc("/webhook/estimate-processing-time", wh.estimateProcessingTimeHandler)
-	mux.HandleFunc("/webhook/generate-executive-dashboard", wh.generateExecutiveDashboardHandler)
-	mux.HandleFunc("/webhook/generate-operational-dashboard", wh.generateOperationalDashboardHandler)
-	mux.HandleFunc("/webhook/get-analytics-trends", wh.getAnalyticsTrendsHandler)
-
-	// Task 3.1: Comprehensive Workflow Testing Webhook Endpoints
-	mux.HandleFunc("/webhook/create-test-session", wh.handleCreateTestSession)
-	mux.HandleFunc("/webhook/execute-test-session", wh.handleExecuteTestSession)
-	mux.HandleFunc("/webhook/get-test-session-status", wh.handleGetTestSessionStatus)
-	mux.HandleFunc("/webhook/get-test-results", wh.handleGetTestResults)
-	mux.HandleFunc("/webhook/run-integration-test", wh.handleRunIntegrationTest)
-	mux.HandleFunc("/webhook/get-performance-metrics", wh.handleGetPerformanceMetrics)
-	mux.HandleFunc("/webhook/generate-test-report", wh.handleGenerateTestReport)
-	mux.HandleFunc("/webhook/validate-system-health", wh.handleValidateSystemHealth)
-
-	// Task 3.2: Performance Optimization Webhook Endpoints
-	mux.HandleFunc("/webhook/optimize-ai-calls", wh.handleOptimizeAICalls)
-	mux.HandleFunc("/webhook/optimize-workflow-performance", wh.handleOptimizeWorkflowPerformance)
-	mux.HandleFunc("/webhook/optimize-template-processing", wh.handleOptimizeTemplateProcessing)
-	mux.HandleFunc("/webhook/get-optimization-metrics", wh.handleGetOptimizationMetrics)
-	mux.HandleFunc("/webhook/get-performance-bottlenecks", wh.handleGetPerformanceBottlenecks)
-	mux.HandleFunc("/webhook/get-cache-statistics", wh.handleGetCacheStatistics)
-	mux.HandleFunc("/webhook/configure-performance-settings", wh.handleConfigurePerformanceSettings)
-	mux.HandleFunc("/webhook/monitor-system-performance", wh.handleMonitorSystemPerformance)
-
-	// Enhanced workflow endpoints
-	mux.HandleFunc("/webhook/n8n/enhanced/analyze-document", wh.HandleEnhancedAnalyzeDocument)
-
-	// Template population endpoints
-	mux.HandleFunc("/populate-template", wh.HandlePopulateTemplate)
-	mux.HandleFunc("/populate-template-automated", wh.handlePopulateTemplateAutomated)
-	mux.HandleFunc("/populate-template-assisted", wh.handlePopulateTemplateAssisted)
-	mux.HandleFunc("/validate-populated-template", wh.handleValidatePopulatedTemplate)
-	mux.HandleFunc("/webhook/populate-template-professional", wh.HandlePopulateTemplateProfessional)
-	mux.HandleFunc("/no-templates-available", wh.HandleNoTemplatesAvailable)
+	for _, route := range wh.Routes() {
+		registerRoute(mux, route, route.Handler)
+	}
+}
+
+// registerRoute mounts handler at the route's versioned path and its legacy
+// alias, which tells callers where the route has moved
+func registerRoute(mux *http.ServeMux, route WebhookRoute, handler http.HandlerFunc) {
+	mux.HandleFunc(route.Path, handler)
+	if route.Legacy == "" {
+		return
+	}
+	mux.HandleFunc(route.Legacy, func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Deprecation", "true")
+		w.Header().Set("Link", fmt.Sprintf("<%s>; rel=\"successor-version\"", route.Path))
+		handler(w, r)
+	})
+}
+
+// HandleOpenAPISpec serves the OpenAPI 3 description of the webhook API
+func (wh *WebhookHandlers) HandleOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	validator := NewWebhookSchemaValidator()
+	if wh.app != nil && wh.app.schemaValidator != nil {
+		validator = wh.app.schemaValidator
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(BuildOpenAPIDocument(wh.Routes(), validator))
 }
 
 // CreateHTTPServer creates an HTTP server with webhook handlers
@@ -472,6 +798,15 @@ func (wh *WebhookHandlers) StartWebhookServer(config *WebhookServerConfig) error
 	return nil
 }
 
+// DiscoverTemplatesRequest is the request body of HandleDiscoverTemplates
+type DiscoverTemplatesRequest struct {
+	DocumentType   string                 `json:"documentType"`
+	DealName       string                 `json:"dealName"`
+	DocumentPath   string                 `json:"documentPath"`
+	JobID          string                 `json:"jobId"`
+	Classification map[string]interface{} `json:"classification"`
+}
+
 // HandleDiscoverTemplates handles template discovery requests from n8n
 func (wh *WebhookHandlers) HandleDiscoverTemplates(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -479,19 +814,17 @@ func (wh *WebhookHandlers) HandleDiscoverTemplates(w http.ResponseWriter, r *htt
 		return
 	}
 
-	var request struct {
-		DocumentType   string                 `json:"documentType"`
-		DealName       string                 `json:"dealName"`
-		DocumentPath   string                 `json:"documentPath"`
-		JobID          string                 `json:"jobId"`
-		Classification map[string]interface{} `json:"classification"`
-	}
+	var request DiscoverTemplatesRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
+	if !wh.authorizeDeal(w, r, request.DealName, request.DocumentPath) {
+		return
+	}
+
 	// Call the template discovery method
 	result, err := wh.app.DiscoverTemplatesForN8n(request.DocumentType, request.DealName, request.DocumentPath, request.Classification)
 	if err != nil {
@@ -512,6 +845,13 @@ func (wh *WebhookHandlers) HandleDiscoverTemplates(w http.ResponseWriter, r *htt
 	json.NewEncoder(w).Encode(transformedResult)
 }
 
+// ExtractDocumentFieldsRequest is the request body of HandleExtractDocumentFields
+type ExtractDocumentFieldsRequest struct {
+	MappingParams map[string]interface{} `json:"mappingParams"`
+	DealName      string                 `json:"dealName"`
+	JobID         string                 `json:"jobId"`
+}
+
 // HandleExtractDocumentFields handles document field extraction requests from n8n
 func (wh *WebhookHandlers) HandleExtractDocumentFields(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -519,17 +859,21 @@ func (wh *WebhookHandlers) HandleExtractDocumentFields(w http.ResponseWriter, r
 		return
 	}
 
-	var request struct {
-		MappingParams map[string]interface{} `json:"mappingParams"`
-		DealName      string                 `json:"dealName"`
-		JobID         string                 `json:"jobId"`
-	}
+	var request ExtractDocumentFieldsRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
+	documentPath := ""
+	if documentData, ok := request.MappingParams["documentData"].(map[string]interface{}); ok {
+		documentPath, _ = documentData["filePath"].(string)
+	}
+	if !wh.authorizeDeal(w, r, request.DealName, documentPath) {
+		return
+	}
+
 	// Call the field extraction method
 	result, err := wh.app.ExtractDocumentFields(request.MappingParams, request.DealName)
 	if err != nil {
@@ -542,6 +886,13 @@ func (wh *WebhookHandlers) HandleExtractDocumentFields(w http.ResponseWriter, r
 	json.NewEncoder(w).Encode(result)
 }
 
+// MapTemplateFieldsRequest is the request body of HandleMapTemplateFields
+type MapTemplateFieldsRequest struct {
+	MappingParams   map[string]interface{} `json:"mappingParams"`
+	ExtractedFields map[string]interface{} `json:"extractedFields"`
+	JobID           string                 `json:"jobId"`
+}
+
 // HandleMapTemplateFields handles template field mapping requests from n8n
 func (wh *WebhookHandlers) HandleMapTemplateFields(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -549,11 +900,7 @@ func (wh *WebhookHandlers) HandleMapTemplateFields(w http.ResponseWriter, r *htt
 		return
 	}
 
-	var request struct {
-		MappingParams   map[string]interface{} `json:"mappingParams"`
-		ExtractedFields map[string]interface{} `json:"extractedFields"`
-		JobID           string                 `json:"jobId"`
-	}
+	var request MapTemplateFieldsRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
@@ -572,6 +919,15 @@ func (wh *WebhookHandlers) HandleMapTemplateFields(w http.ResponseWriter, r *htt
 	json.NewEncoder(w).Encode(result)
 }
 
+// PopulateTemplateRequest is the request body of HandlePopulateTemplate
+type PopulateTemplateRequest struct {
+	TemplateID       string                   `json:"templateId"`
+	FieldMappings    []map[string]interface{} `json:"fieldMappings"`
+	PreserveFormulas bool                     `json:"preserveFormulas"`
+	DealName         string                   `json:"dealName"`
+	JobID            string                   `json:"jobId"`
+}
+
 // HandlePopulateTemplate handles template population requests from n8n
 func (wh *WebhookHandlers) HandlePopulateTemplate(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -579,19 +935,17 @@ func (wh *WebhookHandlers) HandlePopulateTemplate(w http.ResponseWriter, r *http
 		return
 	}
 
-	var request struct {
-		TemplateID       string                   `json:"templateId"`
-		FieldMappings    []map[string]interface{} `json:"fieldMappings"`
-		PreserveFormulas bool                     `json:"preserveFormulas"`
-		DealName         string                   `json:"dealName"`
-		JobID            string                   `json:"jobId"`
-	}
+	var request PopulateTemplateRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
+	if !wh.authorizeDeal(w, r, request.DealName) {
+		return
+	}
+
 	// Extract deal name from context if not provided
 	dealName := request.DealName
 	if dealName == "" {
@@ -606,13 +960,40 @@ func (wh *WebhookHandlers) HandlePopulateTemplate(w http.ResponseWriter, r *http
 		http.Error(w, fmt.Sprintf("Template population failed: %v", err), http.StatusInternalServerError)
 		return
 	}
+	wh.attachIntegrityReport(request.JobID, request.DealName, result["integrityReport"])
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(result)
 }
 
+// attachIntegrityReport records the integrity report of a workbook
+// populated for dealName on the job that requested it. Jobs of other deals
+// are left alone.
+func (wh *WebhookHandlers) attachIntegrityReport(jobID, dealName string, report interface{}) {
+	integrity, ok := report.(*ModelIntegrityReport)
+	if !ok || integrity == nil || jobID == "" || wh.app.jobTracker == nil {
+		return
+	}
+	if job, err := wh.app.jobTracker.GetJob(jobID); err == nil && job.DealName != dealName {
+		log.Printf("Not attaching integrity report for deal %s to job %s of deal %s", dealName, jobID, job.DealName)
+		return
+	}
+	if err := wh.app.jobTracker.AttachIntegrityReport(jobID, integrity); err != nil {
+		log.Printf("Failed to attach integrity report to job %s: %v", jobID, err)
+	}
+}
+
 // NEW ENHANCED WEBHOOK HANDLERS FOR TASK 1.2.2
 
+// EnhancedExtractDocumentFieldsRequest is the request body of HandleEnhancedExtractDocumentFields
+type EnhancedExtractDocumentFieldsRequest struct {
+	Content         string                 `json:"content"`
+	DocumentType    string                 `json:"documentType"`
+	TemplateContext map[string]interface{} `json:"templateContext"`
+	JobID           string                 `json:"jobId"`
+	DealName        string                 `json:"dealName"`
+}
+
 // HandleEnhancedExtractDocumentFields handles enhanced document field extraction using AI
 func (wh *WebhookHandlers) HandleEnhancedExtractDocumentFields(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -620,27 +1001,25 @@ func (wh *WebhookHandlers) HandleEnhancedExtractDocumentFields(w http.ResponseWr
 		return
 	}
 
-	var request struct {
-		Content         string                 `json:"content"`
-		DocumentType    string                 `json:"documentType"`
-		TemplateContext map[string]interface{} `json:"templateContext"`
-		JobID           string                 `json:"jobId"`
-		DealName        string                 `json:"dealName"`
-	}
+	var request EnhancedExtractDocumentFieldsRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
+	if !wh.authorizeDeal(w, r, request.DealName) {
+		return
+	}
+
 	// Use AI service to extract document fields
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	ctx, cancel := context.WithTimeout(WithAIDeal(context.Background(), request.DealName), 60*time.Second)
 	defer cancel()
 
 	result, err := wh.app.aiService.ExtractDocumentFields(ctx, request.Content, request.DocumentType, request.TemplateContext)
 	if err != nil {
 		log.Printf("Enhanced field extraction error: %v", err)
-		http.Error(w, fmt.Sprintf("Enhanced field extraction failed: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Enhanced field extraction failed: %v", err), aiErrorStatus(err))
 		return
 	}
 
@@ -648,6 +1027,15 @@ func (wh *WebhookHandlers) HandleEnhancedExtractDocumentFields(w http.ResponseWr
 	json.NewEncoder(w).Encode(result)
 }
 
+// EnhancedMapFieldsToTemplateRequest is the request body of HandleEnhancedMapFieldsToTemplate
+type EnhancedMapFieldsToTemplateRequest struct {
+	ExtractedFields map[string]interface{} `json:"extractedFields"`
+	TemplateFields  []TemplateField        `json:"templateFields"`
+	MappingContext  map[string]interface{} `json:"mappingContext"`
+	JobID           string                 `json:"jobId"`
+	DealName        string                 `json:"dealName"`
+}
+
 // HandleEnhancedMapFieldsToTemplate handles enhanced field mapping using AI
 func (wh *WebhookHandlers) HandleEnhancedMapFieldsToTemplate(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -655,27 +1043,25 @@ func (wh *WebhookHandlers) HandleEnhancedMapFieldsToTemplate(w http.ResponseWrit
 		return
 	}
 
-	var request struct {
-		ExtractedFields map[string]interface{} `json:"extractedFields"`
-		TemplateFields  []TemplateField        `json:"templateFields"`
-		MappingContext  map[string]interface{} `json:"mappingContext"`
-		JobID           string                 `json:"jobId"`
-		DealName        string                 `json:"dealName"`
-	}
+	var request EnhancedMapFieldsToTemplateRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
+	if !wh.authorizeDeal(w, r, request.DealName) {
+		return
+	}
+
 	// Use AI service to map fields to template
-	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
+	ctx, cancel := context.WithTimeout(WithAIDeal(context.Background(), request.DealName), 60*time.Second)
 	defer cancel()
 
 	result, err := wh.app.aiService.MapFieldsToTemplate(ctx, request.ExtractedFields, request.TemplateFields, request.MappingContext)
 	if err != nil {
 		log.Printf("Enhanced field mapping error: %v", err)
-		http.Error(w, fmt.Sprintf("Enhanced field mapping failed: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Enhanced field mapping failed: %v", err), aiErrorStatus(err))
 		return
 	}
 
@@ -683,6 +1069,15 @@ func (wh *WebhookHandlers) HandleEnhancedMapFieldsToTemplate(w http.ResponseWrit
 	json.NewEncoder(w).Encode(result)
 }
 
+// EnhancedFormatFieldValueRequest is the request body of HandleEnhancedFormatFieldValue
+type EnhancedFormatFieldValueRequest struct {
+	RawValue           interface{}            `json:"rawValue"`
+	FieldType          string                 `json:"fieldType"`
+	FormatRequirements map[string]interface{} `json:"formatRequirements"`
+	JobID              string                 `json:"jobId"`
+	DealName           string                 `json:"dealName"`
+}
+
 // HandleEnhancedFormatFieldValue handles enhanced field value formatting using AI
 func (wh *WebhookHandlers) HandleEnhancedFormatFieldValue(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -690,13 +1085,7 @@ func (wh *WebhookHandlers) HandleEnhancedFormatFieldValue(w http.ResponseWriter,
 		return
 	}
 
-	var request struct {
-		RawValue           interface{}            `json:"rawValue"`
-		FieldType          string                 `json:"fieldType"`
-		FormatRequirements map[string]interface{} `json:"formatRequirements"`
-		JobID              string                 `json:"jobId"`
-		DealName           string                 `json:"dealName"`
-	}
+	var request EnhancedFormatFieldValueRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
@@ -704,13 +1093,13 @@ func (wh *WebhookHandlers) HandleEnhancedFormatFieldValue(w http.ResponseWriter,
 	}
 
 	// Use AI service to format field value
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(WithAIDeal(context.Background(), request.DealName), 30*time.Second)
 	defer cancel()
 
 	result, err := wh.app.aiService.FormatFieldValue(ctx, request.RawValue, request.FieldType, request.FormatRequirements)
 	if err != nil {
 		log.Printf("Enhanced field formatting error: %v", err)
-		http.Error(w, fmt.Sprintf("Enhanced field formatting failed: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Enhanced field formatting failed: %v", err), aiErrorStatus(err))
 		return
 	}
 
@@ -718,6 +1107,14 @@ func (wh *WebhookHandlers) HandleEnhancedFormatFieldValue(w http.ResponseWriter,
 	json.NewEncoder(w).Encode(result)
 }
 
+// EnhancedValidateTemplateDataRequest is the request body of HandleEnhancedValidateTemplateData
+type EnhancedValidateTemplateDataRequest struct {
+	TemplateData    map[string]interface{} `json:"templateData"`
+	ValidationRules []ValidationRule       `json:"validationRules"`
+	JobID           string                 `json:"jobId"`
+	DealName        string                 `json:"dealName"`
+}
+
 // HandleEnhancedValidateTemplateData handles enhanced template data validation using AI
 func (wh *WebhookHandlers) HandleEnhancedValidateTemplateData(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -725,26 +1122,25 @@ func (wh *WebhookHandlers) HandleEnhancedValidateTemplateData(w http.ResponseWri
 		return
 	}
 
-	var request struct {
-		TemplateData    map[string]interface{} `json:"templateData"`
-		ValidationRules []ValidationRule       `json:"validationRules"`
-		JobID           string                 `json:"jobId"`
-		DealName        string                 `json:"dealName"`
-	}
+	var request EnhancedValidateTemplateDataRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
+	if !wh.authorizeDeal(w, r, request.DealName) {
+		return
+	}
+
 	// Use AI service to validate template data
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(WithAIDeal(context.Background(), request.DealName), 30*time.Second)
 	defer cancel()
 
 	result, err := wh.app.aiService.ValidateTemplateData(ctx, request.TemplateData, request.ValidationRules)
 	if err != nil {
 		log.Printf("Enhanced template validation error: %v", err)
-		http.Error(w, fmt.Sprintf("Enhanced template validation failed: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Enhanced template validation failed: %v", err), aiErrorStatus(err))
 		return
 	}
 
@@ -752,6 +1148,16 @@ func (wh *WebhookHandlers) HandleEnhancedValidateTemplateData(w http.ResponseWri
 	json.NewEncoder(w).Encode(result)
 }
 
+// EnhancedAnalyzeDocumentRequest is the request body of HandleEnhancedAnalyzeDocument
+type EnhancedAnalyzeDocumentRequest struct {
+	Content      string                 `json:"content"`
+	DocumentType string                 `json:"documentType"`
+	AnalysisType string                 `json:"analysisType"` // "classification", "financial", "risks", "insights"
+	Context      map[string]interface{} `json:"context"`
+	JobID        string                 `json:"jobId"`
+	DealName     string                 `json:"dealName"`
+}
+
 // HandleEnhancedAnalyzeDocument handles comprehensive document analysis using AI
 func (wh *WebhookHandlers) HandleEnhancedAnalyzeDocument(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -759,21 +1165,18 @@ func (wh *WebhookHandlers) HandleEnhancedAnalyzeDocument(w http.ResponseWriter,
 		return
 	}
 
-	var request struct {
-		Content      string                 `json:"content"`
-		DocumentType string                 `json:"documentType"`
-		AnalysisType string                 `json:"analysisType"` // "classification", "financial", "risks", "insights"
-		Context      map[string]interface{} `json:"context"`
-		JobID        string                 `json:"jobId"`
-		DealName     string                 `json:"dealName"`
-	}
+	var request EnhancedAnalyzeDocumentRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), 120*time.Second)
+	if !wh.authorizeDeal(w, r, request.DealName) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(WithAIDeal(context.Background(), request.DealName), 120*time.Second)
 	defer cancel()
 
 	var result interface{}
@@ -798,7 +1201,7 @@ func (wh *WebhookHandlers) HandleEnhancedAnalyzeDocument(w http.ResponseWriter,
 
 	if err != nil {
 		log.Printf("Enhanced document analysis error: %v", err)
-		http.Error(w, fmt.Sprintf("Enhanced document analysis failed: %v", err), http.StatusInternalServerError)
+		http.Error(w, fmt.Sprintf("Enhanced document analysis failed: %v", err), aiErrorStatus(err))
 		return
 	}
 
@@ -808,21 +1211,29 @@ func (wh *WebhookHandlers) HandleEnhancedAnalyzeDocument(w http.ResponseWriter,
 
 // ENHANCED ENTITY EXTRACTION WEBHOOK ENDPOINTS FOR TASK 1.3
 
+// ExtractCompanyAndDealNamesRequest is the request body of handleExtractCompanyAndDealNames
+type ExtractCompanyAndDealNamesRequest struct {
+	Content      string `json:"content"`
+	DocumentType string `json:"documentType"`
+	DealName     string `json:"dealName,omitempty"`
+}
+
 // handleExtractCompanyAndDealNames handles company and deal name extraction requests
 func (wh *WebhookHandlers) handleExtractCompanyAndDealNames(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-	defer cancel()
-
-	var request struct {
-		Content      string `json:"content"`
-		DocumentType string `json:"documentType"`
-	}
+	var request ExtractCompanyAndDealNamesRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
 		return
 	}
 
+	if !wh.authorizeDeal(w, r, request.DealName) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(WithAIDeal(context.Background(), request.DealName), 2*time.Minute)
+	defer cancel()
+
 	if request.Content == "" {
 		http.Error(w, "Content is required", http.StatusBadRequest)
 		return
@@ -843,21 +1254,29 @@ func (wh *WebhookHandlers) handleExtractCompanyAndDealNames(w http.ResponseWrite
 	})
 }
 
+// ExtractFinancialMetricsRequest is the request body of handleExtractFinancialMetrics
+type ExtractFinancialMetricsRequest struct {
+	Content      string `json:"content"`
+	DocumentType string `json:"documentType"`
+	DealName     string `json:"dealName,omitempty"`
+}
+
 // handleExtractFinancialMetrics handles financial metrics extraction requests
 func (wh *WebhookHandlers) handleExtractFinancialMetrics(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-	defer cancel()
-
-	var request struct {
-		Content      string `json:"content"`
-		DocumentType string `json:"documentType"`
-	}
+	var request ExtractFinancialMetricsRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
 		return
 	}
 
+	if !wh.authorizeDeal(w, r, request.DealName) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(WithAIDeal(context.Background(), request.DealName), 2*time.Minute)
+	defer cancel()
+
 	if request.Content == "" {
 		http.Error(w, "Content is required", http.StatusBadRequest)
 		return
@@ -878,21 +1297,29 @@ func (wh *WebhookHandlers) handleExtractFinancialMetrics(w http.ResponseWriter,
 	})
 }
 
+// ExtractPersonnelAndRolesRequest is the request body of handleExtractPersonnelAndRoles
+type ExtractPersonnelAndRolesRequest struct {
+	Content      string `json:"content"`
+	DocumentType string `json:"documentType"`
+	DealName     string `json:"dealName,omitempty"`
+}
+
 // handleExtractPersonnelAndRoles handles personnel and roles extraction requests
 func (wh *WebhookHandlers) handleExtractPersonnelAndRoles(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-	defer cancel()
-
-	var request struct {
-		Content      string `json:"content"`
-		DocumentType string `json:"documentType"`
-	}
+	var request ExtractPersonnelAndRolesRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
 		return
 	}
 
+	if !wh.authorizeDeal(w, r, request.DealName) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(WithAIDeal(context.Background(), request.DealName), 2*time.Minute)
+	defer cancel()
+
 	if request.Content == "" {
 		http.Error(w, "Content is required", http.StatusBadRequest)
 		return
@@ -906,27 +1333,38 @@ func (wh *WebhookHandlers) handleExtractPersonnelAndRoles(w http.ResponseWriter,
 		return
 	}
 
+	// The lists can be passed straight back as field mappings for templates
+	// with repeated rows or loop blocks
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(map[string]interface{}{
 		"success": true,
 		"data":    result,
+		"lists":   PersonnelListFields(result),
 	})
 }
 
+// ValidateEntitiesAcrossDocumentsRequest is the request body of handleValidateEntitiesAcrossDocuments
+type ValidateEntitiesAcrossDocumentsRequest struct {
+	DocumentExtractions []DocumentEntityExtraction `json:"documentExtractions"`
+	DealName            string                     `json:"dealName,omitempty"`
+}
+
 // handleValidateEntitiesAcrossDocuments handles cross-document entity validation requests
 func (wh *WebhookHandlers) handleValidateEntitiesAcrossDocuments(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
-	defer cancel()
-
-	var request struct {
-		DocumentExtractions []DocumentEntityExtraction `json:"documentExtractions"`
-	}
+	var request ValidateEntitiesAcrossDocumentsRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
 		return
 	}
 
+	if !wh.authorizeDeal(w, r, request.DealName) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(WithAIDeal(context.Background(), request.DealName), 3*time.Minute)
+	defer cancel()
+
 	if len(request.DocumentExtractions) == 0 {
 		http.Error(w, "Document extractions are required", http.StatusBadRequest)
 		return
@@ -949,22 +1387,30 @@ func (wh *WebhookHandlers) handleValidateEntitiesAcrossDocuments(w http.Response
 
 // SEMANTIC FIELD MAPPING WEBHOOK ENDPOINTS FOR TASK 2.1
 
+// AnalyzeFieldSemanticsRequest is the request body of handleAnalyzeFieldSemantics
+type AnalyzeFieldSemanticsRequest struct {
+	FieldName       string      `json:"field_name"`
+	FieldValue      interface{} `json:"field_value"`
+	DocumentContext string      `json:"document_context"`
+	DealName        string      `json:"dealName,omitempty"`
+}
+
 // handleAnalyzeFieldSemantics handles field semantic analysis requests
 func (wh *WebhookHandlers) handleAnalyzeFieldSemantics(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-	defer cancel()
-
-	var request struct {
-		FieldName       string      `json:"field_name"`
-		FieldValue      interface{} `json:"field_value"`
-		DocumentContext string      `json:"document_context"`
-	}
+	var request AnalyzeFieldSemanticsRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
 		return
 	}
 
+	if !wh.authorizeDeal(w, r, request.DealName) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(WithAIDeal(context.Background(), request.DealName), 2*time.Minute)
+	defer cancel()
+
 	if request.FieldName == "" {
 		http.Error(w, "Field name is required", http.StatusBadRequest)
 		return
@@ -981,22 +1427,30 @@ func (wh *WebhookHandlers) handleAnalyzeFieldSemantics(w http.ResponseWriter, r
 	json.NewEncoder(w).Encode(result)
 }
 
+// CreateSemanticMappingRequest is the request body of handleCreateSemanticMapping
+type CreateSemanticMappingRequest struct {
+	SourceFields   map[string]interface{} `json:"source_fields"`
+	TemplateFields []string               `json:"template_fields"`
+	DocumentType   string                 `json:"document_type"`
+	DealName       string                 `json:"dealName,omitempty"`
+}
+
 // handleCreateSemanticMapping handles semantic field mapping requests
 func (wh *WebhookHandlers) handleCreateSemanticMapping(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
-	defer cancel()
-
-	var request struct {
-		SourceFields   map[string]interface{} `json:"source_fields"`
-		TemplateFields []string               `json:"template_fields"`
-		DocumentType   string                 `json:"document_type"`
-	}
+	var request CreateSemanticMappingRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
 		return
 	}
 
+	if !wh.authorizeDeal(w, r, request.DealName) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(WithAIDeal(context.Background(), request.DealName), 3*time.Minute)
+	defer cancel()
+
 	if len(request.SourceFields) == 0 {
 		http.Error(w, "Source fields are required", http.StatusBadRequest)
 		return
@@ -1018,21 +1472,29 @@ func (wh *WebhookHandlers) handleCreateSemanticMapping(w http.ResponseWriter, r
 	json.NewEncoder(w).Encode(result)
 }
 
+// ResolveFieldConflictsRequest is the request body of handleResolveFieldConflicts
+type ResolveFieldConflictsRequest struct {
+	Conflicts         []FieldConflict            `json:"conflicts"`
+	ResolutionContext *ConflictResolutionContext `json:"resolution_context"`
+	DealName          string                     `json:"dealName,omitempty"`
+}
+
 // handleResolveFieldConflicts handles field conflict resolution requests
 func (wh *WebhookHandlers) handleResolveFieldConflicts(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-	defer cancel()
-
-	var request struct {
-		Conflicts         []FieldConflict            `json:"conflicts"`
-		ResolutionContext *ConflictResolutionContext `json:"resolution_context"`
-	}
+	var request ResolveFieldConflictsRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
 		return
 	}
 
+	if !wh.authorizeDeal(w, r, request.DealName) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(WithAIDeal(context.Background(), request.DealName), 2*time.Minute)
+	defer cancel()
+
 	if len(request.Conflicts) == 0 {
 		http.Error(w, "Conflicts are required", http.StatusBadRequest)
 		return
@@ -1049,21 +1511,29 @@ func (wh *WebhookHandlers) handleResolveFieldConflicts(w http.ResponseWriter, r
 	json.NewEncoder(w).Encode(result)
 }
 
+// AnalyzeTemplateStructureRequest is the request body of handleAnalyzeTemplateStructure
+type AnalyzeTemplateStructureRequest struct {
+	TemplatePath    string `json:"template_path"`
+	TemplateContent string `json:"template_content"` // Base64 encoded content
+	DealName        string `json:"dealName,omitempty"`
+}
+
 // handleAnalyzeTemplateStructure handles template structure analysis requests
 func (wh *WebhookHandlers) handleAnalyzeTemplateStructure(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Minute)
-	defer cancel()
-
-	var request struct {
-		TemplatePath    string `json:"template_path"`
-		TemplateContent string `json:"template_content"` // Base64 encoded content
-	}
+	var request AnalyzeTemplateStructureRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
 		return
 	}
 
+	if !wh.authorizeDeal(w, r, request.DealName) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(WithAIDeal(context.Background(), request.DealName), 3*time.Minute)
+	defer cancel()
+
 	if request.TemplatePath == "" {
 		http.Error(w, "Template path is required", http.StatusBadRequest)
 		return
@@ -1092,21 +1562,29 @@ func (wh *WebhookHandlers) handleAnalyzeTemplateStructure(w http.ResponseWriter,
 	json.NewEncoder(w).Encode(result)
 }
 
+// ValidateFieldMappingRequest is the request body of handleValidateFieldMapping
+type ValidateFieldMappingRequest struct {
+	Mapping         *FieldMapping    `json:"mapping"`
+	ValidationRules []ValidationRule `json:"validation_rules"`
+	DealName        string           `json:"dealName,omitempty"`
+}
+
 // handleValidateFieldMapping handles field mapping validation requests
 func (wh *WebhookHandlers) handleValidateFieldMapping(w http.ResponseWriter, r *http.Request) {
-	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Minute)
-	defer cancel()
-
-	var request struct {
-		Mapping         *FieldMapping    `json:"mapping"`
-		ValidationRules []ValidationRule `json:"validation_rules"`
-	}
+	var request ValidateFieldMappingRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
 		return
 	}
 
+	if !wh.authorizeDeal(w, r, request.DealName) {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(WithAIDeal(context.Background(), request.DealName), 2*time.Minute)
+	defer cancel()
+
 	if request.Mapping == nil {
 		http.Error(w, "Field mapping is required", http.StatusBadRequest)
 		return
@@ -1150,6 +1628,9 @@ func (wh *WebhookHandlers) handlePopulateTemplateProfessional(w http.ResponseWri
 		http.Error(w, "Missing required fields: templateId, dealName", http.StatusBadRequest)
 		return
 	}
+	if !wh.authorizeDeal(w, r, request.DealName) {
+		return
+	}
 
 	// Find template by ID
 	templateInfo, err := wh.app.templateDiscovery.GetTemplateByID(request.TemplateID)
@@ -1220,6 +1701,12 @@ func (wh *WebhookHandlers) handlePopulateTemplateProfessional(w http.ResponseWri
 		return
 	}
 
+	integrity, err := wh.app.templatePopulator.CheckPopulatedModel(analysisTemplatePath)
+	if err != nil {
+		log.Printf("Model integrity check failed for %s: %v", analysisTemplatePath, err)
+	}
+	wh.attachIntegrityReport(request.JobID, request.DealName, integrity)
+
 	// Build response
 	response := map[string]interface{}{
 		"success":              true,
@@ -1246,22 +1733,28 @@ func (wh *WebhookHandlers) handlePopulateTemplateProfessional(w http.ResponseWri
 			"validationPassed":  formulaPreservation.PreservationStats.ValidationsPassed > 0,
 		}
 	}
+	if integrity != nil {
+		response["integrityReport"] = integrity
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(response)
 }
 
+// FormatCurrencyRequest is the request body of handleFormatCurrency
+type FormatCurrencyRequest struct {
+	Value    interface{}            `json:"value"`
+	Currency string                 `json:"currency"`
+	Context  map[string]interface{} `json:"context"`
+}
+
 func (wh *WebhookHandlers) handleFormatCurrency(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var request struct {
-		Value    interface{}            `json:"value"`
-		Currency string                 `json:"currency"`
-		Context  map[string]interface{} `json:"context"`
-	}
+	var request FormatCurrencyRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
@@ -1297,17 +1790,20 @@ func (wh *WebhookHandlers) handleFormatCurrency(w http.ResponseWriter, r *http.R
 	json.NewEncoder(w).Encode(result)
 }
 
+// FormatDateRequest is the request body of handleFormatDate
+type FormatDateRequest struct {
+	Value      interface{}            `json:"value"`
+	DateFormat string                 `json:"dateFormat"`
+	Context    map[string]interface{} `json:"context"`
+}
+
 func (wh *WebhookHandlers) handleFormatDate(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var request struct {
-		Value      interface{}            `json:"value"`
-		DateFormat string                 `json:"dateFormat"`
-		Context    map[string]interface{} `json:"context"`
-	}
+	var request FormatDateRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
@@ -1343,17 +1839,20 @@ func (wh *WebhookHandlers) handleFormatDate(w http.ResponseWriter, r *http.Reque
 	json.NewEncoder(w).Encode(result)
 }
 
+// FormatBusinessTextRequest is the request body of handleFormatBusinessText
+type FormatBusinessTextRequest struct {
+	Value     interface{}            `json:"value"`
+	FieldName string                 `json:"fieldName"`
+	Context   map[string]interface{} `json:"context"`
+}
+
 func (wh *WebhookHandlers) handleFormatBusinessText(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var request struct {
-		Value     interface{}            `json:"value"`
-		FieldName string                 `json:"fieldName"`
-		Context   map[string]interface{} `json:"context"`
-	}
+	var request FormatBusinessTextRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
@@ -1382,17 +1881,20 @@ func (wh *WebhookHandlers) handleFormatBusinessText(w http.ResponseWriter, r *ht
 	json.NewEncoder(w).Encode(result)
 }
 
+// EnhanceFormulaPreservationRequest is the request body of handleEnhanceFormulaPreservation
+type EnhanceFormulaPreservationRequest struct {
+	TemplateID    string                   `json:"templateId"`
+	FieldMappings []map[string]interface{} `json:"fieldMappings"`
+	DealName      string                   `json:"dealName"`
+}
+
 func (wh *WebhookHandlers) handleEnhanceFormulaPreservation(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var request struct {
-		TemplateID    string                   `json:"templateId"`
-		FieldMappings []map[string]interface{} `json:"fieldMappings"`
-		DealName      string                   `json:"dealName"`
-	}
+	var request EnhanceFormulaPreservationRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
@@ -1404,6 +1906,9 @@ func (wh *WebhookHandlers) handleEnhanceFormulaPreservation(w http.ResponseWrite
 		http.Error(w, "Missing required fields: templateId, dealName", http.StatusBadRequest)
 		return
 	}
+	if !wh.authorizeDeal(w, r, request.DealName) {
+		return
+	}
 
 	// Find template by ID
 	templateInfo, err := wh.app.templateDiscovery.GetTemplateByID(request.TemplateID)
@@ -1523,6 +2028,9 @@ func (wh *WebhookHandlers) getQualityReportHandler(w http.ResponseWriter, r *htt
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
+	if !wh.authorizeDeal(w, r, req.DealName) {
+		return
+	}
 
 	// Generate quality report based on type
 	var qualityReport map[string]interface{}
@@ -1707,18 +2215,21 @@ func (wh *WebhookHandlers) getAnalyticsTrendsHandler(w http.ResponseWriter, r *h
 
 // Task 3.1: Comprehensive Workflow Testing Webhook Endpoints
 
+// CreateTestSessionRequest is the request body of handleCreateTestSession
+type CreateTestSessionRequest struct {
+	SessionName   string                 `json:"sessionName"`
+	Description   string                 `json:"description"`
+	TestTypes     []string               `json:"testTypes"`
+	Configuration map[string]interface{} `json:"configuration"`
+}
+
 func (wh *WebhookHandlers) handleCreateTestSession(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var request struct {
-		SessionName   string                 `json:"sessionName"`
-		Description   string                 `json:"description"`
-		TestTypes     []string               `json:"testTypes"`
-		Configuration map[string]interface{} `json:"configuration"`
-	}
+	var request CreateTestSessionRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
@@ -1739,16 +2250,19 @@ func (wh *WebhookHandlers) handleCreateTestSession(w http.ResponseWriter, r *htt
 	json.NewEncoder(w).Encode(response)
 }
 
+// ExecuteTestSessionRequest is the request body of handleExecuteTestSession
+type ExecuteTestSessionRequest struct {
+	SessionID string `json:"sessionId"`
+	Async     bool   `json:"async"`
+}
+
 func (wh *WebhookHandlers) handleExecuteTestSession(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var request struct {
-		SessionID string `json:"sessionId"`
-		Async     bool   `json:"async"`
-	}
+	var request ExecuteTestSessionRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
@@ -1872,17 +2386,20 @@ func (wh *WebhookHandlers) handleGetTestResults(w http.ResponseWriter, r *http.R
 	json.NewEncoder(w).Encode(response)
 }
 
+// RunIntegrationTestRequest is the request body of handleRunIntegrationTest
+type RunIntegrationTestRequest struct {
+	TestSuite  string                 `json:"testSuite"`
+	TestCase   string                 `json:"testCase"`
+	Parameters map[string]interface{} `json:"parameters"`
+}
+
 func (wh *WebhookHandlers) handleRunIntegrationTest(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var request struct {
-		TestSuite  string                 `json:"testSuite"`
-		TestCase   string                 `json:"testCase"`
-		Parameters map[string]interface{} `json:"parameters"`
-	}
+	var request RunIntegrationTestRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
@@ -1944,18 +2461,21 @@ func (wh *WebhookHandlers) handleGetPerformanceMetrics(w http.ResponseWriter, r
 	json.NewEncoder(w).Encode(response)
 }
 
+// GenerateTestReportRequest is the request body of handleGenerateTestReport
+type GenerateTestReportRequest struct {
+	SessionID      string `json:"sessionId"`
+	ReportType     string `json:"reportType"`
+	Format         string `json:"format"`
+	IncludeDetails bool   `json:"includeDetails"`
+}
+
 func (wh *WebhookHandlers) handleGenerateTestReport(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var request struct {
-		SessionID      string `json:"sessionId"`
-		ReportType     string `json:"reportType"`
-		Format         string `json:"format"`
-		IncludeDetails bool   `json:"includeDetails"`
-	}
+	var request GenerateTestReportRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
@@ -1996,17 +2516,20 @@ func (wh *WebhookHandlers) handleGenerateTestReport(w http.ResponseWriter, r *ht
 	json.NewEncoder(w).Encode(response)
 }
 
+// ValidateSystemHealthRequest is the request body of handleValidateSystemHealth
+type ValidateSystemHealthRequest struct {
+	HealthCheckType string   `json:"healthCheckType"`
+	Components      []string `json:"components"`
+	Depth           string   `json:"depth"`
+}
+
 func (wh *WebhookHandlers) handleValidateSystemHealth(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var request struct {
-		HealthCheckType string   `json:"healthCheckType"`
-		Components      []string `json:"components"`
-		Depth           string   `json:"depth"`
-	}
+	var request ValidateSystemHealthRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
@@ -2051,20 +2574,23 @@ func (wh *WebhookHandlers) handleValidateSystemHealth(w http.ResponseWriter, r *
 
 // Task 3.2: Performance Optimization Webhook Endpoints
 
+// OptimizeAICallsRequest is the request body of handleOptimizeAICalls
+type OptimizeAICallsRequest struct {
+	DealName    string                 `json:"dealName"`
+	RequestType string                 `json:"requestType"`
+	Content     string                 `json:"content"`
+	Parameters  map[string]interface{} `json:"parameters"`
+	EnableCache bool                   `json:"enableCache"`
+	Parallel    bool                   `json:"parallel"`
+}
+
 func (wh *WebhookHandlers) handleOptimizeAICalls(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var request struct {
-		DealName    string                 `json:"dealName"`
-		RequestType string                 `json:"requestType"`
-		Content     string                 `json:"content"`
-		Parameters  map[string]interface{} `json:"parameters"`
-		EnableCache bool                   `json:"enableCache"`
-		Parallel    bool                   `json:"parallel"`
-	}
+	var request OptimizeAICallsRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
@@ -2089,19 +2615,22 @@ func (wh *WebhookHandlers) handleOptimizeAICalls(w http.ResponseWriter, r *http.
 	json.NewEncoder(w).Encode(result)
 }
 
+// OptimizeWorkflowPerformanceRequest is the request body of handleOptimizeWorkflowPerformance
+type OptimizeWorkflowPerformanceRequest struct {
+	WorkflowType string                 `json:"workflowType"`
+	Payload      map[string]interface{} `json:"payload"`
+	BatchSize    int                    `json:"batchSize"`
+	Compression  bool                   `json:"compression"`
+	LoadBalance  bool                   `json:"loadBalance"`
+}
+
 func (wh *WebhookHandlers) handleOptimizeWorkflowPerformance(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var request struct {
-		WorkflowType string                 `json:"workflowType"`
-		Payload      map[string]interface{} `json:"payload"`
-		BatchSize    int                    `json:"batchSize"`
-		Compression  bool                   `json:"compression"`
-		LoadBalance  bool                   `json:"loadBalance"`
-	}
+	var request OptimizeWorkflowPerformanceRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
@@ -2142,19 +2671,22 @@ func (wh *WebhookHandlers) handleOptimizeWorkflowPerformance(w http.ResponseWrit
 	json.NewEncoder(w).Encode(response)
 }
 
+// OptimizeTemplateProcessingRequest is the request body of handleOptimizeTemplateProcessing
+type OptimizeTemplateProcessingRequest struct {
+	Templates          []string               `json:"templates"`
+	Data               map[string]interface{} `json:"data"`
+	EnableIndexing     bool                   `json:"enableIndexing"`
+	ParallelProcessing bool                   `json:"parallelProcessing"`
+	MemoryOptimization bool                   `json:"memoryOptimization"`
+}
+
 func (wh *WebhookHandlers) handleOptimizeTemplateProcessing(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var request struct {
-		Templates          []string               `json:"templates"`
-		Data               map[string]interface{} `json:"data"`
-		EnableIndexing     bool                   `json:"enableIndexing"`
-		ParallelProcessing bool                   `json:"parallelProcessing"`
-		MemoryOptimization bool                   `json:"memoryOptimization"`
-	}
+	var request OptimizeTemplateProcessingRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
@@ -2380,17 +2912,20 @@ func (wh *WebhookHandlers) handleGetCacheStatistics(w http.ResponseWriter, r *ht
 	json.NewEncoder(w).Encode(response)
 }
 
+// ConfigurePerformanceSettingsRequest is the request body of handleConfigurePerformanceSettings
+type ConfigurePerformanceSettingsRequest struct {
+	Component string                 `json:"component"` // "ai", "workflow", "template"
+	Settings  map[string]interface{} `json:"settings"`
+	ApplyNow  bool                   `json:"applyNow"`
+}
+
 func (wh *WebhookHandlers) handleConfigurePerformanceSettings(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
-	var request struct {
-		Component string                 `json:"component"` // "ai", "workflow", "template"
-		Settings  map[string]interface{} `json:"settings"`
-		ApplyNow  bool                   `json:"applyNow"`
-	}
+	var request ConfigurePerformanceSettingsRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
@@ -2471,6 +3006,17 @@ func (wh *WebhookHandlers) handleMonitorSystemPerformance(w http.ResponseWriter,
 	json.NewEncoder(w).Encode(response)
 }
 
+// PopulateTemplateAutomatedRequest is the request body of handlePopulateTemplateAutomated
+type PopulateTemplateAutomatedRequest struct {
+	PopulationParams struct {
+		TemplateInfo  map[string]interface{}   `json:"templateInfo"`
+		FieldMappings []map[string]interface{} `json:"fieldMappings"`
+		ContextData   map[string]interface{}   `json:"contextData"`
+	} `json:"populationParams"`
+	DealName string `json:"dealName"`
+	JobID    string `json:"jobId"`
+}
+
 // handlePopulateTemplateAutomated handles automated template population requests
 func (wh *WebhookHandlers) handlePopulateTemplateAutomated(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -2478,15 +3024,7 @@ func (wh *WebhookHandlers) handlePopulateTemplateAutomated(w http.ResponseWriter
 		return
 	}
 
-	var request struct {
-		PopulationParams struct {
-			TemplateInfo  map[string]interface{}   `json:"templateInfo"`
-			FieldMappings []map[string]interface{} `json:"fieldMappings"`
-			ContextData   map[string]interface{}   `json:"contextData"`
-		} `json:"populationParams"`
-		DealName string `json:"dealName"`
-		JobID    string `json:"jobId"`
-	}
+	var request PopulateTemplateAutomatedRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
@@ -2499,6 +3037,9 @@ func (wh *WebhookHandlers) handlePopulateTemplateAutomated(w http.ResponseWriter
 		http.Error(w, "Missing template ID", http.StatusBadRequest)
 		return
 	}
+	if !wh.authorizeDeal(w, r, request.DealName) {
+		return
+	}
 
 	// Use the existing PopulateTemplateWithData method
 	result, err := wh.app.PopulateTemplateWithData(templateId, request.PopulationParams.FieldMappings, true, request.DealName)
@@ -2506,12 +3047,25 @@ func (wh *WebhookHandlers) handlePopulateTemplateAutomated(w http.ResponseWriter
 		http.Error(w, fmt.Sprintf("Failed to populate template: %v", err), http.StatusInternalServerError)
 		return
 	}
+	wh.attachIntegrityReport(request.JobID, request.DealName, result["integrityReport"])
 
 	// Send success response
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(result)
 }
 
+// PopulateTemplateAssistedRequest is the request body of handlePopulateTemplateAssisted
+type PopulateTemplateAssistedRequest struct {
+	PopulationParams struct {
+		TemplateInfo  map[string]interface{}   `json:"templateInfo"`
+		FieldMappings []map[string]interface{} `json:"fieldMappings"`
+		ContextData   map[string]interface{}   `json:"contextData"`
+	} `json:"populationParams"`
+	DealName       string `json:"dealName"`
+	JobID          string `json:"jobId"`
+	RequiresReview bool   `json:"requiresReview"`
+}
+
 // handlePopulateTemplateAssisted handles assisted template population requests
 func (wh *WebhookHandlers) handlePopulateTemplateAssisted(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -2519,16 +3073,7 @@ func (wh *WebhookHandlers) handlePopulateTemplateAssisted(w http.ResponseWriter,
 		return
 	}
 
-	var request struct {
-		PopulationParams struct {
-			TemplateInfo  map[string]interface{}   `json:"templateInfo"`
-			FieldMappings []map[string]interface{} `json:"fieldMappings"`
-			ContextData   map[string]interface{}   `json:"contextData"`
-		} `json:"populationParams"`
-		DealName       string `json:"dealName"`
-		JobID          string `json:"jobId"`
-		RequiresReview bool   `json:"requiresReview"`
-	}
+	var request PopulateTemplateAssistedRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
@@ -2541,6 +3086,9 @@ func (wh *WebhookHandlers) handlePopulateTemplateAssisted(w http.ResponseWriter,
 		http.Error(w, "Missing template ID", http.StatusBadRequest)
 		return
 	}
+	if !wh.authorizeDeal(w, r, request.DealName) {
+		return
+	}
 
 	// Use the existing PopulateTemplateWithData method (same as automated for now)
 	result, err := wh.app.PopulateTemplateWithData(templateId, request.PopulationParams.FieldMappings, true, request.DealName)
@@ -2548,6 +3096,7 @@ func (wh *WebhookHandlers) handlePopulateTemplateAssisted(w http.ResponseWriter,
 		http.Error(w, fmt.Sprintf("Failed to populate template: %v", err), http.StatusInternalServerError)
 		return
 	}
+	wh.attachIntegrityReport(request.JobID, request.DealName, result["integrityReport"])
 
 	// Add review information to the result
 	result["requiresReview"] = request.RequiresReview
@@ -2558,6 +3107,13 @@ func (wh *WebhookHandlers) handlePopulateTemplateAssisted(w http.ResponseWriter,
 	json.NewEncoder(w).Encode(result)
 }
 
+// ValidatePopulatedTemplateRequest is the request body of handleValidatePopulatedTemplate
+type ValidatePopulatedTemplateRequest struct {
+	TemplateData map[string]interface{} `json:"templateData"`
+	DealName     string                 `json:"dealName"`
+	JobID        string                 `json:"jobId"`
+}
+
 // handleValidatePopulatedTemplate handles template validation requests
 func (wh *WebhookHandlers) handleValidatePopulatedTemplate(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -2565,11 +3121,7 @@ func (wh *WebhookHandlers) handleValidatePopulatedTemplate(w http.ResponseWriter
 		return
 	}
 
-	var request struct {
-		TemplateData map[string]interface{} `json:"templateData"`
-		DealName     string                 `json:"dealName"`
-		JobID        string                 `json:"jobId"`
-	}
+	var request ValidatePopulatedTemplateRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON payload", http.StatusBadRequest)
@@ -2599,6 +3151,16 @@ func (wh *WebhookHandlers) handleValidatePopulatedTemplate(w http.ResponseWriter
 	json.NewEncoder(w).Encode(validationResult)
 }
 
+// PopulateTemplateProfessionalRequest is the request body of HandlePopulateTemplateProfessional
+type PopulateTemplateProfessionalRequest struct {
+	TemplateID        string                   `json:"templateId"`
+	FieldMappings     []map[string]interface{} `json:"fieldMappings"`
+	FormattingOptions map[string]interface{}   `json:"formattingOptions"`
+	PreserveFormulas  bool                     `json:"preserveFormulas"`
+	DealName          string                   `json:"dealName"`
+	JobID             string                   `json:"jobId"`
+}
+
 // HandlePopulateTemplateProfessional handles professional template population requests from n8n
 func (wh *WebhookHandlers) HandlePopulateTemplateProfessional(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -2606,20 +3168,17 @@ func (wh *WebhookHandlers) HandlePopulateTemplateProfessional(w http.ResponseWri
 		return
 	}
 
-	var request struct {
-		TemplateID        string                   `json:"templateId"`
-		FieldMappings     []map[string]interface{} `json:"fieldMappings"`
-		FormattingOptions map[string]interface{}   `json:"formattingOptions"`
-		PreserveFormulas  bool                     `json:"preserveFormulas"`
-		DealName          string                   `json:"dealName"`
-		JobID             string                   `json:"jobId"`
-	}
+	var request PopulateTemplateProfessionalRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
 		return
 	}
 
+	if !wh.authorizeDeal(w, r, request.DealName) {
+		return
+	}
+
 	// Extract deal name from context if not provided
 	dealName := request.DealName
 	if dealName == "" {
@@ -2633,6 +3192,7 @@ func (wh *WebhookHandlers) HandlePopulateTemplateProfessional(w http.ResponseWri
 		http.Error(w, fmt.Sprintf("Professional template population failed: %v", err), http.StatusInternalServerError)
 		return
 	}
+	wh.attachIntegrityReport(request.JobID, request.DealName, result["integrityReport"])
 
 	// Add professional formatting metadata
 	if result != nil {
@@ -2692,6 +3252,16 @@ func (wh *WebhookHandlers) HandleValidateTemplateQuality(w http.ResponseWriter,
 	json.NewEncoder(w).Encode(validation)
 }
 
+// NoTemplatesAvailableRequest is the request body of HandleNoTemplatesAvailable
+type NoTemplatesAvailableRequest struct {
+	JobID             string                 `json:"jobId"`
+	DealName          string                 `json:"dealName"`
+	DocumentTypes     []string               `json:"documentTypes"`
+	Reason            string                 `json:"reason"`
+	SuggestedAction   string                 `json:"suggestedAction"`
+	EntitiesExtracted map[string]interface{} `json:"entitiesExtracted"`
+}
+
 // HandleNoTemplatesAvailable handles cases where no templates are available
 func (wh *WebhookHandlers) HandleNoTemplatesAvailable(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
@@ -2699,14 +3269,7 @@ func (wh *WebhookHandlers) HandleNoTemplatesAvailable(w http.ResponseWriter, r *
 		return
 	}
 
-	var request struct {
-		JobID             string                 `json:"jobId"`
-		DealName          string                 `json:"dealName"`
-		DocumentTypes     []string               `json:"documentTypes"`
-		Reason            string                 `json:"reason"`
-		SuggestedAction   string                 `json:"suggestedAction"`
-		EntitiesExtracted map[string]interface{} `json:"entitiesExtracted"`
-	}
+	var request NoTemplatesAvailableRequest
 
 	if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
 		http.Error(w, "Invalid JSON", http.StatusBadRequest)
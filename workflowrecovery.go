@@ -2,9 +2,7 @@ package main
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io/ioutil"
 	"os"
 	"path/filepath"
 	"sync"
@@ -115,6 +113,23 @@ type WorkflowRecoveryConfig struct {
 	NotificationThreshold ErrorSeverity `json:"notification_threshold"`
 	EnablePartialResults  bool          `json:"enable_partial_results"`
 	StoragePath           string        `json:"storage_path"`
+
+	// Repository persists executions; when nil they are kept in a state
+	// store under StoragePath
+	Repository WorkflowRepository `json:"-"`
+}
+
+// WorkflowRepository persists workflow executions
+type WorkflowRepository interface {
+	LoadWorkflowState() (*WorkflowRecoveryState, error)
+	SaveWorkflowState(state *WorkflowRecoveryState) error
+}
+
+// WorkflowRecoveryState is the persisted part of the recovery service
+type WorkflowRecoveryState struct {
+	Executions       map[string]*WorkflowExecution `json:"executions"`
+	ExecutionHistory []*WorkflowExecution          `json:"execution_history"`
+	ErrorStats       map[string]int                `json:"error_stats"`
 }
 
 // WorkflowRecoveryService handles workflow recovery and error management
@@ -163,6 +178,13 @@ func NewWorkflowRecoveryService(config WorkflowRecoveryConfig, logger Logger, no
 	if err := os.MkdirAll(config.StoragePath, 0755); err != nil {
 		logger.Error("Failed to create storage directory: %v", err)
 	}
+	if service.config.Repository == nil {
+		repo := openComponentStore(config.StoragePath)
+		if err := repo.importLegacyWorkflows(filepath.Join(config.StoragePath, "workflow_recovery_state.json")); err != nil {
+			logger.Warn("Failed to import workflow state: %v", err)
+		}
+		service.config.Repository = repo
+	}
 
 	// Load existing state
 	if err := service.loadState(); err != nil {
@@ -639,32 +661,13 @@ func (wrs *WorkflowRecoveryService) saveState() error {
 	wrs.mutex.RLock()
 	defer wrs.mutex.RUnlock()
 
-	state := struct {
-		Executions       map[string]*WorkflowExecution `json:"executions"`
-		ExecutionHistory []*WorkflowExecution          `json:"execution_history"`
-		ErrorStats       map[string]int                `json:"error_stats"`
-		LastSaved        time.Time                     `json:"last_saved"`
-	}{
+	err := wrs.config.Repository.SaveWorkflowState(&WorkflowRecoveryState{
 		Executions:       wrs.executions,
 		ExecutionHistory: wrs.executionHistory,
 		ErrorStats:       wrs.errorStats,
-		LastSaved:        time.Now(),
-	}
-
-	data, err := json.MarshalIndent(state, "", "  ")
+	})
 	if err != nil {
-		return fmt.Errorf("failed to marshal state: %v", err)
-	}
-
-	statePath := filepath.Join(wrs.config.StoragePath, "workflow_recovery_state.json")
-	tempPath := statePath + ".tmp"
-
-	if err := ioutil.WriteFile(tempPath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write temp state file: %v", err)
-	}
-
-	if err := os.Rename(tempPath, statePath); err != nil {
-		return fmt.Errorf("failed to rename temp state file: %v", err)
+		return err
 	}
 
 	wrs.logger.Debug("State saved successfully")
@@ -672,26 +675,9 @@ func (wrs *WorkflowRecoveryService) saveState() error {
 }
 
 func (wrs *WorkflowRecoveryService) loadState() error {
-	statePath := filepath.Join(wrs.config.StoragePath, "workflow_recovery_state.json")
-
-	data, err := ioutil.ReadFile(statePath)
+	state, err := wrs.config.Repository.LoadWorkflowState()
 	if err != nil {
-		if os.IsNotExist(err) {
-			wrs.logger.Info("No existing state file found, starting fresh")
-			return nil
-		}
-		return fmt.Errorf("failed to read state file: %v", err)
-	}
-
-	var state struct {
-		Executions       map[string]*WorkflowExecution `json:"executions"`
-		ExecutionHistory []*WorkflowExecution          `json:"execution_history"`
-		ErrorStats       map[string]int                `json:"error_stats"`
-		LastSaved        time.Time                     `json:"last_saved"`
-	}
-
-	if err := json.Unmarshal(data, &state); err != nil {
-		return fmt.Errorf("failed to unmarshal state: %v", err)
+		return err
 	}
 
 	wrs.mutex.Lock()
@@ -712,7 +698,7 @@ func (wrs *WorkflowRecoveryService) loadState() error {
 		wrs.errorStats = make(map[string]int)
 	}
 
-	wrs.logger.Info("State loaded successfully (last saved: %v)", state.LastSaved)
+	wrs.logger.Info("State loaded (%d executions)", len(wrs.executions))
 	return nil
 }
 